@@ -0,0 +1,409 @@
+/*
+ * Network packet analysis framework.
+ *
+ * Copyright (c) 2014, Alessandro Ghedini
+ * All rights reserved.
+ *
+ * Redistribution and use in source and binary forms, with or without
+ * modification, are permitted provided that the following conditions are
+ * met:
+ *
+ *     * Redistributions of source code must retain the above copyright
+ *       notice, this list of conditions and the following disclaimer.
+ *
+ *     * Redistributions in binary form must reproduce the above copyright
+ *       notice, this list of conditions and the following disclaimer in the
+ *       documentation and/or other materials provided with the distribution.
+ *
+ * THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS
+ * IS" AND ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO,
+ * THE IMPLIED WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR
+ * PURPOSE ARE DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT HOLDER OR
+ * CONTRIBUTORS BE LIABLE FOR ANY DIRECT, INDIRECT, INCIDENTAL, SPECIAL,
+ * EXEMPLARY, OR CONSEQUENTIAL DAMAGES (INCLUDING, BUT NOT LIMITED TO,
+ * PROCUREMENT OF SUBSTITUTE GOODS OR SERVICES; LOSS OF USE, DATA, OR
+ * PROFITS; OR BUSINESS INTERRUPTION) HOWEVER CAUSED AND ON ANY THEORY OF
+ * LIABILITY, WHETHER IN CONTRACT, STRICT LIABILITY, OR TORT (INCLUDING
+ * NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE OF THIS
+ * SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+ */
+
+// Provides packet capturing and injection on live network interfaces via Linux
+// AF_PACKET sockets, without requiring the libpcap library. Note that this
+// requires root privileges (or the CAP_NET_RAW capability).
+package afpacket
+
+import "fmt"
+import "net"
+import "syscall"
+import "time"
+import "unsafe"
+
+import "github.com/adigal150/go.pkt/capture"
+import "github.com/adigal150/go.pkt/filter"
+import "github.com/adigal150/go.pkt/packet"
+
+type Handle struct {
+    Device  string
+    fd      int
+    index   int
+    link    uint32
+    buf     []byte
+    filter  *filter.Filter
+    stats   capture.Stats
+    snaplen int
+    timeout time.Duration
+}
+
+/* struct ifreq, as used by SIOCGIFHWADDR */
+type ifreq_hwaddr struct {
+    name    [syscall.IFNAMSIZ]byte
+    family  uint16
+    data    [14]byte
+    pad     [8]byte
+}
+
+/* map of ARPHRD types to PCAP link types */
+var arphrd_to_link_type_map = map[uint16]uint32{
+    syscall.ARPHRD_ETHER:              1,
+    syscall.ARPHRD_LOOPBACK:           1,
+    syscall.ARPHRD_IEEE80211_RADIOTAP: 127,
+}
+
+/* struct packet_mreq */
+type packet_mreq struct {
+    ifindex int32
+    mr_type uint16
+    alen    uint16
+    address [8]byte
+}
+
+/* struct tpacket_stats */
+type tpacket_stats struct {
+    packets uint32
+    drops   uint32
+}
+
+// Create a new capture handle bound to the given network interface.
+func Open(dev_name string) (*Handle, error) {
+    iface, err := net.InterfaceByName(dev_name)
+    if err != nil {
+        return nil, fmt.Errorf("Could not find device: %s", err)
+    }
+
+    fd, err := syscall.Socket(syscall.AF_PACKET, syscall.SOCK_RAW,
+                              int(htons(syscall.ETH_P_ALL)))
+    if err == syscall.EPERM || err == syscall.EACCES {
+        return nil, fmt.Errorf(
+            "Could not open socket: %s (root or CAP_NET_RAW required)", err,
+        )
+    }
+
+    if err != nil {
+        return nil, fmt.Errorf("Could not open socket: %s", err)
+    }
+
+    addr := &syscall.SockaddrLinklayer{
+        Protocol: htons(syscall.ETH_P_ALL),
+        Ifindex:  iface.Index,
+    }
+
+    err = syscall.Bind(fd, addr)
+    if err != nil {
+        syscall.Close(fd)
+        return nil, fmt.Errorf("Could not bind socket: %s", err)
+    }
+
+    link, err := get_link_type(fd, dev_name)
+    if err != nil {
+        syscall.Close(fd)
+        return nil, err
+    }
+
+    handle := &Handle{
+        Device: dev_name,
+        fd:     fd,
+        index:  iface.Index,
+        link:   link,
+        buf:    make([]byte, 65536),
+    }
+
+    return handle, nil
+}
+
+// Return the link type of the capture handle (that is, the type of packets that
+// come out of the packet source).
+func (h *Handle) LinkType() packet.Type {
+    return packet.LinkType(h.link)
+}
+
+// Return the PCAP link type (DLT) of the capture handle, as derived from the
+// hardware type (ARPHRD) of the interface, or 0 if the hardware type is not
+// supported.
+func (h *Handle) DataLink() uint32 {
+    return h.link
+}
+
+// Not supported.
+func (h *Handle) SetMTU(mtu int) error {
+    return fmt.Errorf("Unsupported")
+}
+
+// Set the maximum number of bytes captured for each packet (0 means no limit).
+// Longer packets are truncated, and their CaptureInfo.CaptureLength is lower
+// than their Length.
+func (h *Handle) SetSnapLen(snaplen int) error {
+    if snaplen < 0 {
+        return fmt.Errorf("Invalid snap length: %d", snaplen)
+    }
+
+    h.snaplen = snaplen
+    return nil
+}
+
+// Enable/disable promiscuous mode. By default the interface is left in the mode
+// it is already in. The interface leaves promiscuous mode when the handle is
+// closed, unless other sockets requested it too.
+func (h *Handle) SetPromiscMode(promisc bool) error {
+    mreq := packet_mreq{
+        ifindex: int32(h.index),
+        mr_type: syscall.PACKET_MR_PROMISC,
+    }
+
+    opt := syscall.PACKET_ADD_MEMBERSHIP
+    if !promisc {
+        opt = syscall.PACKET_DROP_MEMBERSHIP
+    }
+
+    _, _, errno := syscall.Syscall6(
+        syscall.SYS_SETSOCKOPT, uintptr(h.fd), syscall.SOL_PACKET,
+        uintptr(opt), uintptr(unsafe.Pointer(&mreq)), unsafe.Sizeof(mreq), 0,
+    )
+    /* the socket didn't request promiscuous mode, nothing to drop */
+    if !promisc && errno == syscall.EADDRNOTAVAIL {
+        return nil
+    }
+
+    if errno != 0 {
+        return fmt.Errorf("Could not set promiscuous mode: %s", errno)
+    }
+
+    return nil
+}
+
+// Not supported.
+func (h *Handle) SetMonitorMode(monitor bool) error {
+    return fmt.Errorf("Unsupported")
+}
+
+// Set the maximum time to wait for a packet when capturing, after which
+// capture.ErrTimeout is returned, or 0 to wait forever. The time spent reading
+// packets rejected by the filter counts towards the timeout.
+func (h *Handle) SetReadTimeout(timeout time.Duration) error {
+    err := h.set_rcvtimeo(timeout)
+    if err != nil {
+        return err
+    }
+
+    h.timeout = timeout
+
+    return nil
+}
+
+func (h *Handle) set_rcvtimeo(timeout time.Duration) error {
+    tv := syscall.NsecToTimeval(timeout.Nanoseconds())
+
+    /* a zero timeval means no timeout, so round up sub-microsecond values */
+    if timeout > 0 && tv.Sec == 0 && tv.Usec == 0 {
+        tv.Usec = 1
+    }
+
+    err := syscall.SetsockoptTimeval(h.fd, syscall.SOL_SOCKET,
+                                     syscall.SO_RCVTIMEO, &tv)
+    if err != nil {
+        return fmt.Errorf("Could not set timeout: %s", err)
+    }
+
+    return nil
+}
+
+// Enable/disable immediate mode (this is not needed for the AF_PACKET capture
+// handle, since packets are read from the socket one at a time, as soon as they
+// arrive, which favours latency over throughput).
+func (h *Handle) SetImmediate(immediate bool) error {
+    return nil
+}
+
+// Apply the given filter it to the packet source. Only packets that match this
+// filter will be captured. Note that filtering is done in userspace.
+func (h *Handle) ApplyFilter(filter *filter.Filter) error {
+    if !filter.Validate() {
+        return fmt.Errorf("Invalid filter")
+    }
+
+    h.filter = filter
+    return nil
+}
+
+// Compile the given tcpdump-like expression and apply it to the packet source,
+// like ApplyFilter(). Filtering is always done in userspace.
+func (h *Handle) SetFilter(expr string) error {
+    flt, err := filter.Compile(expr, h.LinkType(), 0, true)
+    if err != nil {
+        return fmt.Errorf("Could not compile filter '%s': %s", expr, err)
+    }
+
+    return h.ApplyFilter(flt)
+}
+
+// Activate the capture handle (this is not needed for the AF_PACKET capture
+// handle, since the socket is already bound by Open()).
+func (h *Handle) Activate() error {
+    return nil
+}
+
+// Capture a single packet from the packet source. This will block until a
+// packet is received, or until the read timeout expires.
+func (h *Handle) Capture() ([]byte, error) {
+    buf, _, err := h.CaptureWithInfo()
+    return buf, err
+}
+
+// Capture a single packet from the packet source, like Capture(), and also
+// return its metadata. The timestamp is the time the packet was read from the
+// socket.
+func (h *Handle) CaptureWithInfo() ([]byte, capture.CaptureInfo, error) {
+    var info capture.CaptureInfo
+
+    buf := h.buf
+    if h.snaplen > 0 && h.snaplen < len(buf) {
+        buf = buf[:h.snaplen]
+    }
+
+    /* packets rejected by the filter don't restart the timeout, so the
+     * socket timeout is shortened to the time left, and restored after */
+    deadline  := time.Now().Add(h.timeout)
+    shortened := false
+
+    defer func() {
+        if shortened {
+            h.set_rcvtimeo(h.timeout)
+        }
+    }()
+
+    for {
+        n, _, err := syscall.Recvfrom(h.fd, buf, syscall.MSG_TRUNC)
+        if err == syscall.EINTR {
+            continue
+        }
+
+        if err == syscall.EAGAIN {
+            return nil, info, capture.ErrTimeout
+        }
+
+        if err != nil {
+            return nil, info, fmt.Errorf("Could not read packet: %s", err)
+        }
+
+        caplen := n
+        if caplen > len(buf) {
+            caplen = len(buf)
+        }
+
+        if h.filter != nil && !h.filter.Match(h.buf[:caplen]) {
+            if h.timeout <= 0 {
+                continue
+            }
+
+            left := time.Until(deadline)
+            if left <= 0 {
+                return nil, info, capture.ErrTimeout
+            }
+
+            err = h.set_rcvtimeo(left)
+            if err != nil {
+                return nil, info, err
+            }
+
+            shortened = true
+            continue
+        }
+
+        info.Timestamp     = time.Now()
+        info.CaptureLength = caplen
+        info.Length        = n
+
+        return append([]byte(nil), h.buf[:caplen]...), info, nil
+    }
+}
+
+// Inject a packet in the packet source.
+func (h *Handle) Inject(buf []byte) error {
+    _, err := syscall.Write(h.fd, buf)
+    if err != nil {
+        return fmt.Errorf("Could not inject packet: %s", err)
+    }
+
+    return nil
+}
+
+// Send a raw frame on the interface. This is the same as Inject().
+func (h *Handle) Send(buf []byte) error {
+    return h.Inject(buf)
+}
+
+// Return the packet counters of the socket. The kernel only counts packets
+// received and dropped by the socket itself, so IfDropped is always 0.
+func (h *Handle) Stats() (capture.Stats, error) {
+    var tp_stats tpacket_stats
+
+    tp_len := uint32(unsafe.Sizeof(tp_stats))
+
+    /* the kernel resets its counters on every read, so accumulate them */
+    _, _, errno := syscall.Syscall6(
+        syscall.SYS_GETSOCKOPT, uintptr(h.fd),
+        syscall.SOL_PACKET, syscall.PACKET_STATISTICS,
+        uintptr(unsafe.Pointer(&tp_stats)), uintptr(unsafe.Pointer(&tp_len)),
+        0,
+    )
+    if errno != 0 {
+        return h.stats, fmt.Errorf("Could not get stats: %s", errno)
+    }
+
+    /* tp_packets counts the dropped packets as well, while Received only
+     * counts the ones queued to the socket (as with libpcap) */
+    received := tp_stats.packets
+    if received >= tp_stats.drops {
+        received -= tp_stats.drops
+    }
+
+    h.stats.Received += uint64(received)
+    h.stats.Dropped  += uint64(tp_stats.drops)
+
+    return h.stats, nil
+}
+
+// Close the packet source.
+func (h *Handle) Close() {
+    syscall.Close(h.fd)
+}
+
+func get_link_type(fd int, dev_name string) (uint32, error) {
+    var ifr ifreq_hwaddr
+
+    copy(ifr.name[:syscall.IFNAMSIZ - 1], dev_name)
+
+    _, _, errno := syscall.Syscall(
+        syscall.SYS_IOCTL, uintptr(fd), syscall.SIOCGIFHWADDR,
+        uintptr(unsafe.Pointer(&ifr)),
+    )
+    if errno != 0 {
+        return 0, fmt.Errorf("Could not get hardware type: %s", errno)
+    }
+
+    return arphrd_to_link_type_map[ifr.family], nil
+}
+
+func htons(v uint16) uint16 {
+    return v << 8 | v >> 8
+}
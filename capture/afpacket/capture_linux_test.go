@@ -0,0 +1,452 @@
+/*
+ * Network packet analysis framework.
+ *
+ * Copyright (c) 2014, Alessandro Ghedini
+ * All rights reserved.
+ *
+ * Redistribution and use in source and binary forms, with or without
+ * modification, are permitted provided that the following conditions are
+ * met:
+ *
+ *     * Redistributions of source code must retain the above copyright
+ *       notice, this list of conditions and the following disclaimer.
+ *
+ *     * Redistributions in binary form must reproduce the above copyright
+ *       notice, this list of conditions and the following disclaimer in the
+ *       documentation and/or other materials provided with the distribution.
+ *
+ * THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS
+ * IS" AND ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO,
+ * THE IMPLIED WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR
+ * PURPOSE ARE DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT HOLDER OR
+ * CONTRIBUTORS BE LIABLE FOR ANY DIRECT, INDIRECT, INCIDENTAL, SPECIAL,
+ * EXEMPLARY, OR CONSEQUENTIAL DAMAGES (INCLUDING, BUT NOT LIMITED TO,
+ * PROCUREMENT OF SUBSTITUTE GOODS OR SERVICES; LOSS OF USE, DATA, OR
+ * PROFITS; OR BUSINESS INTERRUPTION) HOWEVER CAUSED AND ON ANY THEORY OF
+ * LIABILITY, WHETHER IN CONTRACT, STRICT LIABILITY, OR TORT (INCLUDING
+ * NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE OF THIS
+ * SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+ */
+
+package afpacket_test
+
+import "bytes"
+import "net"
+import "os"
+import "strconv"
+import "strings"
+import "syscall"
+import "testing"
+import "time"
+
+import "github.com/adigal150/go.pkt/capture"
+import "github.com/adigal150/go.pkt/capture/afpacket"
+import "github.com/adigal150/go.pkt/filter"
+import "github.com/adigal150/go.pkt/layers"
+import "github.com/adigal150/go.pkt/packet"
+import "github.com/adigal150/go.pkt/packet/arp"
+import "github.com/adigal150/go.pkt/packet/eth"
+import "github.com/adigal150/go.pkt/packet/ipv4"
+import "github.com/adigal150/go.pkt/packet/raw"
+import "github.com/adigal150/go.pkt/packet/udp"
+
+/* Open a capture handle on the loopback interface, skipping the test if the
+ * required privileges are missing */
+func open_lo(t *testing.T) *afpacket.Handle {
+    h, err := afpacket.Open("lo")
+    if err != nil && strings.Contains(err.Error(), "CAP_NET_RAW") {
+        t.Skipf("Skipping: %s", err)
+    }
+
+    if err != nil {
+        t.Fatalf("Error opening: %s", err)
+    }
+
+    return h
+}
+
+/* Return a broadcast ARP request for the given address, both as a packet and
+ * packed */
+func make_arp(t *testing.T, dst string) (packet.Packet, []byte) {
+    eth_pkt := eth.Make()
+    eth_pkt.SrcAddr = make([]byte, 6)
+    eth_pkt.DstAddr, _ = net.ParseMAC("ff:ff:ff:ff:ff:ff")
+
+    arp_pkt := arp.Make()
+    arp_pkt.HWSrcAddr = eth_pkt.SrcAddr
+    arp_pkt.HWDstAddr = make([]byte, 6)
+    arp_pkt.ProtoSrcAddr = net.ParseIP("127.0.0.1")
+    arp_pkt.ProtoDstAddr = net.ParseIP(dst)
+
+    buf, err := layers.Pack(eth_pkt, arp_pkt)
+    if err != nil {
+        t.Fatalf("Error packing: %s", err)
+    }
+
+    return eth_pkt, buf
+}
+
+func TestSendARP(t *testing.T) {
+    h := open_lo(t)
+    defer h.Close()
+
+    _, buf := make_arp(t, "127.0.0.2")
+
+    rx := open_lo(t)
+    defer rx.Close()
+
+    recv := make(chan bool, 1)
+
+    go func() {
+        for {
+            pkt_buf, err := rx.Capture()
+            if err != nil {
+                return
+            }
+
+            if bytes.Equal(pkt_buf, buf) {
+                recv <- true
+                return
+            }
+        }
+    }()
+
+    err := h.Send(buf)
+    if err != nil {
+        t.Fatalf("Error sending: %s", err)
+    }
+
+    select {
+    case <-recv:
+    case <-time.After(time.Second):
+        t.Fatalf("Sent packet not received")
+    }
+}
+
+func TestSendPacketARP(t *testing.T) {
+    h := open_lo(t)
+    defer h.Close()
+
+    eth_pkt, buf := make_arp(t, "127.0.0.3")
+
+    rx := open_lo(t)
+    defer rx.Close()
+
+    recv := make(chan bool, 1)
+
+    go func() {
+        for {
+            pkt_buf, err := rx.Capture()
+            if err != nil {
+                return
+            }
+
+            if bytes.Equal(pkt_buf, buf) {
+                recv <- true
+                return
+            }
+        }
+    }()
+
+    err := capture.SendPacket(h, eth_pkt)
+    if err != nil {
+        t.Fatalf("Error sending: %s", err)
+    }
+
+    select {
+    case <-recv:
+    case <-time.After(time.Second):
+        t.Fatalf("Sent packet not received")
+    }
+}
+
+func TestOpenInvalid(t *testing.T) {
+    _, err := afpacket.Open("invalid-device-name")
+    if err == nil {
+        t.Fatalf("Invalid device opened")
+    }
+}
+
+func TestStats(t *testing.T) {
+    h := open_lo(t)
+    defer h.Close()
+
+    before, err := h.Stats()
+    if err != nil {
+        t.Fatalf("Error getting stats: %s", err)
+    }
+
+    _, buf := make_arp(t, "127.0.0.2")
+
+    for i := 0; i < 5; i++ {
+        err = h.Send(buf)
+        if err != nil {
+            t.Fatalf("Error sending: %s", err)
+        }
+    }
+
+    time.Sleep(10 * time.Millisecond)
+
+    after, err := h.Stats()
+    if err != nil {
+        t.Fatalf("Error getting stats: %s", err)
+    }
+
+    if after.Received < before.Received + 5 {
+        t.Fatalf("Received count mismatch: %d %d",
+                 before.Received, after.Received)
+    }
+}
+
+func TestSnapLen(t *testing.T) {
+    h := open_lo(t)
+    defer h.Close()
+
+    eth_pkt := eth.Make()
+    eth_pkt.SrcAddr = make([]byte, 6)
+    eth_pkt.DstAddr = make([]byte, 6)
+
+    ip4_pkt := ipv4.Make()
+    ip4_pkt.SrcAddr = net.ParseIP("127.0.0.1")
+    ip4_pkt.DstAddr = net.ParseIP("127.0.0.1")
+
+    udp_pkt := udp.Make()
+    udp_pkt.SrcPort = 41235
+    udp_pkt.DstPort = 9
+
+    raw_pkt := raw.Make()
+    raw_pkt.Data = []byte("some payload")
+
+    buf, err := layers.Pack(eth_pkt, ip4_pkt, udp_pkt, raw_pkt)
+    if err != nil {
+        t.Fatalf("Error packing: %s", err)
+    }
+
+    rx := open_lo(t)
+    defer rx.Close()
+
+    /* Ethernet and IPv4 headers only */
+    rx.SetSnapLen(34)
+
+    recv := make(chan []byte, 1)
+
+    go func() {
+        for {
+            pkt_buf, info, err := rx.CaptureWithInfo()
+            if err != nil {
+                return
+            }
+
+            if info.Length == len(buf) && bytes.Equal(pkt_buf, buf[:34]) {
+                recv <- pkt_buf
+                return
+            }
+        }
+    }()
+
+    err = h.Send(buf)
+    if err != nil {
+        t.Fatalf("Error sending: %s", err)
+    }
+
+    select {
+    case pkt_buf := <-recv:
+        pkt, err := layers.UnpackAll(pkt_buf, rx.LinkType())
+        if err != nil {
+            t.Fatalf("Error unpacking: %s", err)
+        }
+
+        if layers.FindLayer(pkt, packet.IPv4) == nil ||
+           layers.FindLayer(pkt, packet.UDP) != nil {
+            t.Fatalf("Truncated packet mismatch: %s", pkt)
+        }
+
+    case <-time.After(time.Second):
+        t.Fatalf("Sent packet not received")
+    }
+}
+
+func TestReadTimeout(t *testing.T) {
+    h := open_lo(t)
+    defer h.Close()
+
+    /* drop everything, so that the interface looks idle */
+    flt := filter.NewBuilder().RET(filter.Const, 0).Build()
+    defer flt.Cleanup()
+
+    err := h.ApplyFilter(flt)
+    if err != nil {
+        t.Fatalf("Error applying filter: %s", err)
+    }
+
+    err = h.SetReadTimeout(100 * time.Millisecond)
+    if err != nil {
+        t.Fatalf("Error setting timeout: %s", err)
+    }
+
+    start := time.Now()
+
+    buf, err := h.Capture()
+    if err != capture.ErrTimeout {
+        t.Fatalf("Unexpected result: %v %x", err, buf)
+    }
+
+    elapsed := time.Since(start)
+    if elapsed < 90 * time.Millisecond || elapsed > time.Second {
+        t.Fatalf("Timeout mismatch: %s", elapsed)
+    }
+}
+
+func TestReadTimeoutFiltered(t *testing.T) {
+    h := open_lo(t)
+    defer h.Close()
+
+    tx := open_lo(t)
+    defer tx.Close()
+
+    flt := filter.NewBuilder().RET(filter.Const, 0).Build()
+    defer flt.Cleanup()
+
+    err := h.ApplyFilter(flt)
+    if err != nil {
+        t.Fatalf("Error applying filter: %s", err)
+    }
+
+    err = h.SetReadTimeout(100 * time.Millisecond)
+    if err != nil {
+        t.Fatalf("Error setting timeout: %s", err)
+    }
+
+    _, buf := make_arp(t, "127.0.0.5")
+
+    /* keep sending packets that don't match the filter */
+    done := make(chan bool)
+    defer close(done)
+
+    go func() {
+        for {
+            select {
+            case <-done:
+                return
+
+            case <-time.After(10 * time.Millisecond):
+                tx.Send(buf)
+            }
+        }
+    }()
+
+    start := time.Now()
+
+    pkt_buf, err := h.Capture()
+    if err != capture.ErrTimeout {
+        t.Fatalf("Unexpected result: %v %x", err, pkt_buf)
+    }
+
+    elapsed := time.Since(start)
+    if elapsed < 90 * time.Millisecond || elapsed > 500 * time.Millisecond {
+        t.Fatalf("Timeout mismatch: %s", elapsed)
+    }
+}
+
+func TestImmediate(t *testing.T) {
+    h := open_lo(t)
+    defer h.Close()
+
+    _, buf := make_arp(t, "127.0.0.4")
+
+    rx := open_lo(t)
+    defer rx.Close()
+
+    err := rx.SetImmediate(true)
+    if err != nil {
+        t.Fatalf("Error setting immediate mode: %s", err)
+    }
+
+    recv := make(chan time.Time, 1)
+
+    go func() {
+        for {
+            pkt_buf, err := rx.Capture()
+            if err != nil {
+                return
+            }
+
+            if bytes.Equal(pkt_buf, buf) {
+                recv <- time.Now()
+                return
+            }
+        }
+    }()
+
+    sent := time.Now()
+
+    err = h.Send(buf)
+    if err != nil {
+        t.Fatalf("Error sending: %s", err)
+    }
+
+    select {
+    case recv_time := <-recv:
+        if recv_time.Sub(sent) > 100 * time.Millisecond {
+            t.Fatalf("Packet delivered late: %s", recv_time.Sub(sent))
+        }
+
+    case <-time.After(time.Second):
+        t.Fatalf("Sent packet not received")
+    }
+}
+
+func is_promisc(t *testing.T, dev_name string) bool {
+    data, err := os.ReadFile("/sys/class/net/" + dev_name + "/flags")
+    if err != nil {
+        t.Skipf("Skipping: %s", err)
+    }
+
+    flags, err := strconv.ParseUint(strings.TrimSpace(string(data)), 0, 32)
+    if err != nil {
+        t.Fatalf("Error parsing flags: %s", err)
+    }
+
+    return flags & syscall.IFF_PROMISC != 0
+}
+
+func TestPromiscMode(t *testing.T) {
+    h := open_lo(t)
+    defer h.Close()
+
+    if is_promisc(t, "lo") {
+        t.Skipf("Skipping: lo already in promiscuous mode")
+    }
+
+    err := h.SetPromiscMode(true)
+    if err != nil {
+        t.Fatalf("Error setting promiscuous mode: %s", err)
+    }
+
+    err = h.Activate()
+    if err != nil {
+        t.Fatalf("Error activating: %s", err)
+    }
+
+    if !is_promisc(t, "lo") {
+        t.Fatalf("Promiscuous mode not enabled")
+    }
+
+    err = h.SetPromiscMode(false)
+    if err != nil {
+        t.Fatalf("Error unsetting promiscuous mode: %s", err)
+    }
+
+    if is_promisc(t, "lo") {
+        t.Fatalf("Promiscuous mode not disabled")
+    }
+}
+
+func TestLinkType(t *testing.T) {
+    h := open_lo(t)
+    defer h.Close()
+
+    if h.DataLink() != 1 || h.LinkType() != packet.Eth {
+        t.Fatalf("Link type mismatch: %d %s", h.DataLink(), h.LinkType())
+    }
+}
@@ -32,22 +32,205 @@
 // implementations ("pcap", "file", ...) are provided as subpackages.
 package capture
 
+import "errors"
+import "time"
+
 import "github.com/adigal150/go.pkt/filter"
+import "github.com/adigal150/go.pkt/layers"
 import "github.com/adigal150/go.pkt/packet"
 
 type Handle interface {
     LinkType() packet.Type
+    DataLink() uint32
 
     SetMTU(mtu int) error
+    SetSnapLen(snaplen int) error
     SetPromiscMode(promisc bool) error
     SetMonitorMode(monitor bool) error
 
+    /* Make Capture() return ErrTimeout when no packet is received within the
+     * given time. Handles whose reads never block indefinitely (e.g. dump
+     * files) or can't time out (e.g. streams) accept it and do nothing, so
+     * that it can be set on any handle (see Merge()) */
+    SetReadTimeout(timeout time.Duration) error
+
+    /* Deliver packets as soon as they arrive, instead of buffering them.
+     * Handles that always do so (e.g. AF_PACKET sockets) or that don't
+     * capture live traffic (e.g. dump files and streams) accept it and do
+     * nothing */
+    SetImmediate(immediate bool) error
+
     ApplyFilter(filter *filter.Filter) error
+    SetFilter(expr string) error
 
     Activate() error
 
     Capture() ([]byte, error)
+    CaptureWithInfo() ([]byte, CaptureInfo, error)
     Inject(buf []byte) error
 
+    Stats() (Stats, error)
+
     Close()
 }
+
+// Packet counters of a capture handle, since it was activated.
+type Stats struct {
+    /* Number of packets received */
+    Received  uint64
+
+    /* Number of packets dropped by the kernel, e.g. because the capture
+     * buffer was full */
+    Dropped   uint64
+
+    /* Number of packets dropped by the network interface or its driver */
+    IfDropped uint64
+}
+
+// Returned by capture handles when no packet is received before the read timeout
+// expires (see Handle.SetReadTimeout()).
+var ErrTimeout = errors.New("Read timeout")
+
+// Metadata of a captured packet.
+type CaptureInfo struct {
+    /* Time the packet was captured at */
+    Timestamp     time.Time
+
+    /* Number of bytes captured */
+    CaptureLength int
+
+    /* Length of the packet on the wire, which is larger than the captured
+     * length if the packet was truncated */
+    Length        int
+
+    /* Index of the handle the packet was captured by, for packets captured
+     * by a merged handle (see Merge()) */
+    Source        int
+}
+
+// Reader is implemented by packet sources that can be read one packet at a
+// time, along with its metadata (e.g. capture handles and dump files). A nil
+// slice is returned when the end of the source is reached.
+type Reader interface {
+    LinkType() packet.Type
+
+    CaptureWithInfo() ([]byte, CaptureInfo, error)
+}
+
+// Writer is implemented by packet sinks that store packets along with their
+// metadata (e.g. dump files).
+type Writer interface {
+    /* Set the link type of the packets that will be written next */
+    SetLinkType(link_type packet.Type) error
+
+    WritePacket(buf []byte, info CaptureInfo) error
+}
+
+// Sender is implemented by packet sinks that can send raw packets (e.g. capture
+// handles).
+type Sender interface {
+    Inject(buf []byte) error
+}
+
+// Read packets from the given source and call fn for each one of them, until
+// the end of the packet source is reached (i.e. until no packet is returned),
+// or until fn or the source return an error, which is returned.
+func Each(r Reader, fn func(buf []byte, info CaptureInfo) error) error {
+    for {
+        buf, info, err := r.CaptureWithInfo()
+        if err != nil {
+            return err
+        }
+
+        if buf == nil {
+            return nil
+        }
+
+        err = fn(buf, info)
+        if err != nil {
+            return err
+        }
+    }
+}
+
+// Read packets from the given source like Each(), but decode them according to
+// the link type of the source (see layers.UnpackAll()) before calling fn. The
+// packets alias the buffers returned by the source.
+func EachPacket(r Reader, fn func(pkt packet.Packet, info CaptureInfo) error) error {
+    link_type := r.LinkType()
+
+    return Each(r, func(buf []byte, info CaptureInfo) error {
+        pkt, err := layers.UnpackAll(buf, link_type)
+        if err != nil {
+            return err
+        }
+
+        return fn(pkt, info)
+    })
+}
+
+// Copy all the packets read from the given source to the given sink, along with
+// their metadata, until the end of the source is reached. This can be used to
+// convert between dump file formats (e.g. from pcap to pcapng).
+func Convert(in Reader, out Writer) error {
+    err := out.SetLinkType(in.LinkType())
+    if err != nil {
+        return err
+    }
+
+    return Each(in, func(buf []byte, info CaptureInfo) error {
+        return out.WritePacket(buf, info)
+    })
+}
+
+// Read all the packets from the given source and send them to the given sink,
+// honoring the time gaps between the packets' timestamps, scaled by the given
+// speed (e.g. 2 replays them twice as fast). If speed is 0, packets are sent
+// as fast as possible.
+func Replay(in Reader, out Sender, speed float64) error {
+    var start time.Time
+    var first time.Time
+
+    return Each(in, func(buf []byte, info CaptureInfo) error {
+        if speed > 0 {
+            if start.IsZero() {
+                start = time.Now()
+                first = info.Timestamp
+            }
+
+            /* sleep relatively to the first packet, so that delays don't
+             * accumulate over the replay */
+            gap   := time.Duration(float64(info.Timestamp.Sub(first)) / speed)
+            delay := gap - time.Since(start)
+
+            if delay > 0 {
+                time.Sleep(delay)
+            }
+        }
+
+        return out.Inject(buf)
+    })
+}
+
+// Encode the given packet, including all of its payloads, and send it to the
+// given sink. The packet can be a decoded one, possibly with some of its fields
+// modified: lengths and checksums are recomputed before sending (see
+// layers.Pack()), so that e.g. a responder can reply by editing the request.
+func SendPacket(out Sender, pkt packet.Packet) error {
+    buf, err := pack_packet(pkt)
+    if err != nil {
+        return err
+    }
+
+    return out.Inject(buf)
+}
+
+func pack_packet(pkt packet.Packet) ([]byte, error) {
+    var pkts []packet.Packet
+
+    for p := pkt; p != nil; p = p.Payload() {
+        pkts = append(pkts, p)
+    }
+
+    return layers.Pack(pkts...)
+}
@@ -0,0 +1,260 @@
+/*
+ * Network packet analysis framework.
+ *
+ * Copyright (c) 2014, Alessandro Ghedini
+ * All rights reserved.
+ *
+ * Redistribution and use in source and binary forms, with or without
+ * modification, are permitted provided that the following conditions are
+ * met:
+ *
+ *     * Redistributions of source code must retain the above copyright
+ *       notice, this list of conditions and the following disclaimer.
+ *
+ *     * Redistributions in binary form must reproduce the above copyright
+ *       notice, this list of conditions and the following disclaimer in the
+ *       documentation and/or other materials provided with the distribution.
+ *
+ * THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS
+ * IS" AND ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO,
+ * THE IMPLIED WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR
+ * PURPOSE ARE DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT HOLDER OR
+ * CONTRIBUTORS BE LIABLE FOR ANY DIRECT, INDIRECT, INCIDENTAL, SPECIAL,
+ * EXEMPLARY, OR CONSEQUENTIAL DAMAGES (INCLUDING, BUT NOT LIMITED TO,
+ * PROCUREMENT OF SUBSTITUTE GOODS OR SERVICES; LOSS OF USE, DATA, OR
+ * PROFITS; OR BUSINESS INTERRUPTION) HOWEVER CAUSED AND ON ANY THEORY OF
+ * LIABILITY, WHETHER IN CONTRACT, STRICT LIABILITY, OR TORT (INCLUDING
+ * NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE OF THIS
+ * SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+ */
+
+package capture_test
+
+import "bytes"
+import "os"
+import "testing"
+import "time"
+
+import "github.com/adigal150/go.pkt/capture"
+import "github.com/adigal150/go.pkt/capture/stream"
+import "github.com/adigal150/go.pkt/layers"
+import "github.com/adigal150/go.pkt/packet"
+import "github.com/adigal150/go.pkt/packet/eth"
+import "github.com/adigal150/go.pkt/packet/ipv4"
+import "github.com/adigal150/go.pkt/packet/raw"
+import "github.com/adigal150/go.pkt/packet/udp"
+
+type test_reader struct {
+    infos []capture.CaptureInfo
+}
+
+func (r *test_reader) LinkType() packet.Type {
+    return packet.Eth
+}
+
+func (r *test_reader) CaptureWithInfo() ([]byte, capture.CaptureInfo, error) {
+    if len(r.infos) == 0 {
+        return nil, capture.CaptureInfo{}, nil
+    }
+
+    info := r.infos[0]
+    r.infos = r.infos[1:]
+
+    return make([]byte, info.CaptureLength), info, nil
+}
+
+type test_sender struct {
+    times []time.Time
+    bufs  [][]byte
+}
+
+func (s *test_sender) Inject(buf []byte) error {
+    s.times = append(s.times, time.Now())
+    s.bufs  = append(s.bufs, buf)
+    return nil
+}
+
+func make_reader(gaps ...time.Duration) *test_reader {
+    base := time.Unix(1400000000, 0)
+
+    r := &test_reader{}
+
+    for _, gap := range gaps {
+        r.infos = append(r.infos, capture.CaptureInfo{
+            Timestamp: base.Add(gap),
+            CaptureLength: 60,
+            Length: 60,
+        })
+    }
+
+    return r
+}
+
+func TestReplay(t *testing.T) {
+    r := make_reader(0, 200 * time.Millisecond, 400 * time.Millisecond)
+    s := &test_sender{}
+
+    err := capture.Replay(r, s, 2)
+    if err != nil {
+        t.Fatalf("Error replaying: %s", err)
+    }
+
+    if len(s.times) != 3 {
+        t.Fatalf("Packet count mismatch: %d", len(s.times))
+    }
+
+    for i, expected := range []time.Duration{ 100, 200 } {
+        elapsed := s.times[i + 1].Sub(s.times[0])
+        expected *= time.Millisecond
+
+        if elapsed < expected || elapsed > expected + 50 * time.Millisecond {
+            t.Fatalf("Timing mismatch: %s instead of %s", elapsed, expected)
+        }
+    }
+}
+
+func TestReplayFast(t *testing.T) {
+    r := make_reader(0, time.Hour, 2 * time.Hour)
+    s := &test_sender{}
+
+    err := capture.Replay(r, s, 0)
+    if err != nil {
+        t.Fatalf("Error replaying: %s", err)
+    }
+
+    if len(s.times) != 3 || s.times[2].Sub(s.times[0]) > time.Second {
+        t.Fatalf("Replay not immediate: %v", s.times)
+    }
+}
+
+func TestSendPacket(t *testing.T) {
+    eth_pkt := eth.Make()
+    eth_pkt.SrcAddr = make([]byte, 6)
+    eth_pkt.DstAddr = make([]byte, 6)
+
+    ip4_pkt := ipv4.Make()
+    ip4_pkt.SrcAddr = []byte{ 192, 168, 1, 1 }
+    ip4_pkt.DstAddr = []byte{ 192, 168, 1, 2 }
+
+    udp_pkt := udp.Make()
+    udp_pkt.SrcPort = 41562
+    udp_pkt.DstPort = 8338
+
+    raw_pkt := raw.Make()
+    raw_pkt.Data = []byte("payload")
+
+    buf, err := layers.Pack(eth_pkt, ip4_pkt, udp_pkt, raw_pkt)
+    if err != nil {
+        t.Fatalf("Error packing: %s", err)
+    }
+
+    pkt, err := layers.UnpackAll(buf, packet.Eth)
+    if err != nil {
+        t.Fatalf("Error unpacking: %s", err)
+    }
+
+    /* modify the decoded stack, as a responder would */
+    pkt.Payload().(*ipv4.Packet).TTL = 1
+    pkt.Payload().Payload().(*udp.Packet).DstPort = 53
+
+    s := &test_sender{}
+
+    err = capture.SendPacket(s, pkt)
+    if err != nil {
+        t.Fatalf("Error sending: %s", err)
+    }
+
+    if len(s.bufs) != 1 {
+        t.Fatalf("Packet count mismatch: %d", len(s.bufs))
+    }
+
+    ip4_pkt.TTL     = 1
+    udp_pkt.DstPort = 53
+
+    expected, err := layers.Pack(eth_pkt, ip4_pkt, udp_pkt, raw_pkt)
+    if err != nil {
+        t.Fatalf("Error packing: %s", err)
+    }
+
+    if !bytes.Equal(s.bufs[0], expected) {
+        t.Fatalf("Data mismatch:\n%x\n%x", s.bufs[0], expected)
+    }
+}
+
+func TestEachPacket(t *testing.T) {
+    in := &test_reader{
+        infos: []capture.CaptureInfo{
+            { CaptureLength: 60, Length: 60 },
+            { CaptureLength: 64, Length: 64 },
+        },
+    }
+
+    var count int
+
+    err := capture.EachPacket(in,
+        func(pkt packet.Packet, info capture.CaptureInfo) error {
+            if pkt.GetType() != packet.Eth {
+                t.Fatalf("Link type mismatch: %s", pkt.GetType())
+            }
+
+            count++
+            return nil
+        })
+    if err != nil {
+        t.Fatalf("Error reading: %s", err)
+    }
+
+    if count != 2 {
+        t.Fatalf("Count mismatch: %d", count)
+    }
+}
+
+func open_test_pcap(t *testing.T) capture.Reader {
+    data, err := os.ReadFile("file/capture_test.pcap")
+    if err != nil {
+        t.Fatalf("Error reading: %s", err)
+    }
+
+    src, err := stream.Open(bytes.NewReader(data), stream.PCAP, packet.None)
+    if err != nil {
+        t.Fatalf("Error opening: %s", err)
+    }
+
+    return src
+}
+
+func TestEachPacketParallel(t *testing.T) {
+    var bufs [][]byte
+
+    err := capture.Each(open_test_pcap(t),
+        func(buf []byte, info capture.CaptureInfo) error {
+            bufs = append(bufs, buf)
+            return nil
+        })
+    if err != nil {
+        t.Fatalf("Error reading: %s", err)
+    }
+
+    var count int
+
+    err = capture.EachPacketParallel(open_test_pcap(t), 4,
+        func(pkt packet.Packet, info capture.CaptureInfo) error {
+            if count >= len(bufs) {
+                t.Fatalf("Too many packets: %d", count + 1)
+            }
+
+            if !bytes.Equal(pkt.RawBytes(), bufs[count]) {
+                t.Fatalf("Packet %d out of order: %x", count, pkt.RawBytes())
+            }
+
+            count++
+            return nil
+        })
+    if err != nil {
+        t.Fatalf("Error decoding: %s", err)
+    }
+
+    if count != 16 {
+        t.Fatalf("Count mismatch: %d", count)
+    }
+}
@@ -37,7 +37,9 @@ import "encoding/binary"
 import "fmt"
 import "io"
 import "os"
+import "time"
 
+import "github.com/adigal150/go.pkt/capture"
 import "github.com/adigal150/go.pkt/filter"
 import "github.com/adigal150/go.pkt/packet"
 
@@ -49,10 +51,15 @@ type Handle struct {
     link   uint32
     mtu    uint32
     filter *filter.Filter
+    nano   bool
 }
 
-var BigEndian    = []byte{0xa1, 0xb2, 0xc3, 0xd4}
-var LittleEndian = []byte{0xd4, 0xc3, 0xb2, 0xa1}
+var BigEndian        = []byte{0xa1, 0xb2, 0xc3, 0xd4}
+var LittleEndian     = []byte{0xd4, 0xc3, 0xb2, 0xa1}
+
+/* magic numbers of dump files with nanosecond resolution timestamps */
+var NanoBigEndian    = []byte{0xa1, 0xb2, 0x3c, 0x4d}
+var NanoLittleEndian = []byte{0x4d, 0x3c, 0xb2, 0xa1}
 
 // Create a new capture handle from the given dump file. This will either open
 // the file if it exists, or create a new one.
@@ -84,6 +91,14 @@ func Open(file_name string) (*Handle, error) {
     case bytes.Equal(magic, LittleEndian):
         handle.order = binary.LittleEndian
 
+    case bytes.Equal(magic, NanoBigEndian):
+        handle.order = binary.BigEndian
+        handle.nano  = true
+
+    case bytes.Equal(magic, NanoLittleEndian):
+        handle.order = binary.LittleEndian
+        handle.nano  = true
+
     default:
         handle.file.Close()
         return nil, fmt.Errorf("Invalid file")
@@ -145,11 +160,21 @@ func (h *Handle) LinkType() packet.Type {
     return packet.LinkType(h.link)
 }
 
+// Return the PCAP link type (DLT) of the dump file.
+func (h *Handle) DataLink() uint32 {
+    return h.link
+}
+
 // Not supported.
 func (h *Handle) SetMTU(mtu int) error {
     return fmt.Errorf("Unsupported")
 }
 
+// Not supported.
+func (h *Handle) SetSnapLen(snaplen int) error {
+    return fmt.Errorf("Unsupported")
+}
+
 // Not supported.
 func (h *Handle) SetPromiscMode(promisc bool) error {
     return fmt.Errorf("Unsupported")
@@ -160,6 +185,18 @@ func (h *Handle) SetMonitorMode(monitor bool) error {
     return fmt.Errorf("Unsupported")
 }
 
+// Set the read timeout (this is not needed for the file capture handle, since
+// reading from dump files never blocks).
+func (h *Handle) SetReadTimeout(timeout time.Duration) error {
+    return nil
+}
+
+// Enable/disable immediate mode (this is not needed for the file capture handle,
+// since packets are read from the dump file one at a time).
+func (h *Handle) SetImmediate(immediate bool) error {
+    return nil
+}
+
 // Apply the given filter it to the packet source. Only packets that match this
 // filter will be captured.
 func (h *Handle) ApplyFilter(filter *filter.Filter) error {
@@ -171,6 +208,17 @@ func (h *Handle) ApplyFilter(filter *filter.Filter) error {
     return nil
 }
 
+// Compile the given tcpdump-like expression and apply it to the packet source,
+// like ApplyFilter().
+func (h *Handle) SetFilter(expr string) error {
+    flt, err := filter.Compile(expr, h.LinkType(), 0, true)
+    if err != nil {
+        return fmt.Errorf("Could not compile filter '%s': %s", expr, err)
+    }
+
+    return h.ApplyFilter(flt)
+}
+
 // Activate the capture handle (this is not needed for the file capture handle,
 // but you may want to call it anyway in order to make switching to different
 // packet sources easier).
@@ -182,7 +230,16 @@ func (h *Handle) Activate() error {
 // (i.e. if the end of the dump file has been reached) it will return a nil
 // slice.
 func (h *Handle) Capture() ([]byte, error) {
+    buf, _, err := h.CaptureWithInfo()
+    return buf, err
+}
+
+// Capture a single packet from the packet source, like Capture(), and also
+// return its metadata, as recorded in the dump file. Timestamps have nanosecond
+// resolution if the dump file uses it.
+func (h *Handle) CaptureWithInfo() ([]byte, capture.CaptureInfo, error) {
     var buf []byte
+    var info capture.CaptureInfo
     var sec, usec, caplen, wirelen uint32
 
     for {
@@ -192,18 +249,18 @@ func (h *Handle) Capture() ([]byte, error) {
         binary.Read(h.file, h.order, &wirelen)
 
         if caplen == 0 {
-            return nil, nil
+            return nil, info, nil
         }
 
         buf = make([]byte, int(caplen))
 
         _, err := h.file.Read(buf)
         if err == io.EOF {
-            return nil, nil
+            return nil, info, nil
         }
 
         if err != nil  {
-            return nil, fmt.Errorf("Could not capture: %s", err)
+            return nil, info, fmt.Errorf("Could not capture: %s", err)
         }
 
         if h.filter != nil && !h.filter.Match(buf) {
@@ -213,18 +270,75 @@ func (h *Handle) Capture() ([]byte, error) {
         break
     }
 
-    return buf, nil
+    nsec := int64(usec) * 1000
+    if h.nano {
+        nsec = int64(usec)
+    }
+
+    info.Timestamp     = time.Unix(int64(sec), nsec)
+    info.CaptureLength = int(caplen)
+    info.Length        = int(wirelen)
+
+    return buf, info, nil
 }
 
 // Inject a packet in the packet source. This will automatically append packets
 // at the end of the dump file, instead of truncating it.
 func (h *Handle) Inject(buf []byte) error {
+    return h.WritePacket(buf, capture.CaptureInfo{})
+}
+
+// Set the link type of the packets stored in the dump file. This is only
+// possible as long as no packet has been written to the file, since all the
+// packets in a pcap file must have the same link type.
+func (h *Handle) SetLinkType(link_type packet.Type) error {
+    link := link_type.ToLinkType()
+    if link == h.link {
+        return nil
+    }
+
+    info, err := h.out.Stat()
+    if err != nil {
+        return fmt.Errorf("Could not set link type: %s", err)
+    }
+
+    if info.Size() > 24 {
+        return fmt.Errorf("Could not set link type: file not empty")
+    }
+
+    link_buf := make([]byte, 4)
+    h.order.PutUint32(link_buf, link)
+
+    _, err = h.out.WriteAt(link_buf, 20)
+    if err != nil {
+        return fmt.Errorf("Could not set link type: %s", err)
+    }
+
+    h.link = link
+    return nil
+}
+
+// Append a packet to the dump file, with the timestamp and length recorded in
+// the given metadata. If the length is lower than the length of the packet
+// data, the latter is used.
+func (h *Handle) WritePacket(buf []byte, info capture.CaptureInfo) error {
     var sec, usec, caplen, wirelen uint32
 
-    sec     = 0
-    usec    = 0
+    if !info.Timestamp.IsZero() {
+        sec  = uint32(info.Timestamp.Unix())
+        usec = uint32(info.Timestamp.Nanosecond() / 1000)
+
+        if h.nano {
+            usec = uint32(info.Timestamp.Nanosecond())
+        }
+    }
+
     caplen  = uint32(len(buf))
-    wirelen = caplen
+    wirelen = uint32(info.Length)
+
+    if wirelen < caplen {
+        wirelen = caplen
+    }
 
     binary.Write(h.out, h.order, sec)
     binary.Write(h.out, h.order, usec)
@@ -239,6 +353,11 @@ func (h *Handle) Inject(buf []byte) error {
     return nil
 }
 
+// Not supported.
+func (h *Handle) Stats() (capture.Stats, error) {
+    return capture.Stats{}, fmt.Errorf("Unsupported")
+}
+
 // Close the packet source.
 func (h *Handle) Close() {
     h.file.Close()
@@ -30,9 +30,12 @@
 
 package file_test
 
+import "fmt"
 import "log"
+import "os"
 import "testing"
 
+import "github.com/adigal150/go.pkt/capture"
 import "github.com/adigal150/go.pkt/capture/file"
 import "github.com/adigal150/go.pkt/filter"
 
@@ -62,6 +65,34 @@ func TestCapture(t *testing.T) {
     }
 }
 
+func TestEach(t *testing.T) {
+    src, err := file.Open("capture_test.pcap")
+    if err != nil {
+        t.Fatalf("Error opening: %s", err)
+    }
+    defer src.Close()
+
+    var count, bytes int
+
+    err = capture.Each(src, func(buf []byte, info capture.CaptureInfo) error {
+        if len(buf) != info.CaptureLength || info.Length != info.CaptureLength {
+            return fmt.Errorf("Length mismatch: %d %v", len(buf), info)
+        }
+
+        count++
+        bytes += info.Length
+
+        return nil
+    })
+    if err != nil {
+        t.Fatalf("Error reading: %s", err)
+    }
+
+    if count != 16 || bytes != 1736 {
+        t.Fatalf("Count mismatch: %d %d", count, bytes)
+    }
+}
+
 func TestCaptureFilter(t *testing.T) {
     src, err := file.Open("capture_test.pcap")
     if err != nil {
@@ -69,7 +100,7 @@ func TestCaptureFilter(t *testing.T) {
     }
     defer src.Close()
 
-    flt, err := filter.Compile("arp", src.LinkType(), false)
+    flt, err := filter.Compile("arp", src.LinkType(), 0, false)
     if err != nil {
         t.Fatalf("Error parsing filter: %s", err)
     }
@@ -99,6 +130,69 @@ func TestCaptureFilter(t *testing.T) {
     }
 }
 
+func TestSetFilter(t *testing.T) {
+    src, err := file.Open("capture_test.pcap")
+    if err != nil {
+        t.Fatalf("Error opening: %s", err)
+    }
+    defer src.Close()
+
+    err = src.SetFilter("arp and and")
+    if err == nil {
+        t.Fatalf("Invalid filter compiled")
+    }
+
+    err = src.SetFilter("arp")
+    if err != nil {
+        t.Fatalf("Error setting filter: %s", err)
+    }
+
+    var count uint64
+
+    err = capture.Each(src, func(buf []byte, info capture.CaptureInfo) error {
+        if buf[12] != 0x08 || buf[13] != 0x06 {
+            return fmt.Errorf("Non-matching packet: %x", buf)
+        }
+
+        count++
+        return nil
+    })
+    if err != nil {
+        t.Fatalf("Error reading: %s", err)
+    }
+
+    if count != 2 {
+        t.Fatalf("Count mismatch: %d", count)
+    }
+}
+
+func TestCaptureNano(t *testing.T) {
+    src, err := file.Open("capture_nsec_test.pcap")
+    if err != nil {
+        t.Fatalf("Error opening: %s", err)
+    }
+    defer src.Close()
+
+    _, info, err := src.CaptureWithInfo()
+    if err != nil {
+        t.Fatalf("Error reading: %s", err)
+    }
+
+    if info.Timestamp.Unix() != 1400000000 ||
+       info.Timestamp.Nanosecond() != 123456789 {
+        t.Fatalf("Timestamp mismatch: %s", info.Timestamp)
+    }
+
+    _, info, err = src.CaptureWithInfo()
+    if err != nil {
+        t.Fatalf("Error reading: %s", err)
+    }
+
+    if info.Timestamp.Nanosecond() != 1 {
+        t.Fatalf("Timestamp mismatch: %s", info.Timestamp)
+    }
+}
+
 func TestInject(t *testing.T) {
     src, err := file.Open("capture_test.pcap")
     if err != nil {
@@ -110,6 +204,7 @@ func TestInject(t *testing.T) {
     if err != nil {
         t.Fatalf("Error opening: %s", err)
     }
+    defer os.Remove("inject_test.pcap")
     defer dst.Close()
 
     var count uint64
@@ -136,7 +231,7 @@ func TestInject(t *testing.T) {
     }
 }
 
-func ExampleCapture() {
+func ExampleHandle_Capture() {
     src, err := file.Open("/path/to/file/dump.pcap")
     if err != nil {
         log.Fatal(err)
@@ -167,7 +262,7 @@ func ExampleCapture() {
     }
 }
 
-func ExampleInject() {
+func ExampleHandle_Inject() {
     dst, err := file.Open("/path/to/file/dump.pcap")
     if err != nil {
         log.Fatal(err)
@@ -0,0 +1,86 @@
+/*
+ * Network packet analysis framework.
+ *
+ * Copyright (c) 2014, Alessandro Ghedini
+ * All rights reserved.
+ *
+ * Redistribution and use in source and binary forms, with or without
+ * modification, are permitted provided that the following conditions are
+ * met:
+ *
+ *     * Redistributions of source code must retain the above copyright
+ *       notice, this list of conditions and the following disclaimer.
+ *
+ *     * Redistributions in binary form must reproduce the above copyright
+ *       notice, this list of conditions and the following disclaimer in the
+ *       documentation and/or other materials provided with the distribution.
+ *
+ * THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS
+ * IS" AND ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO,
+ * THE IMPLIED WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR
+ * PURPOSE ARE DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT HOLDER OR
+ * CONTRIBUTORS BE LIABLE FOR ANY DIRECT, INDIRECT, INCIDENTAL, SPECIAL,
+ * EXEMPLARY, OR CONSEQUENTIAL DAMAGES (INCLUDING, BUT NOT LIMITED TO,
+ * PROCUREMENT OF SUBSTITUTE GOODS OR SERVICES; LOSS OF USE, DATA, OR
+ * PROFITS; OR BUSINESS INTERRUPTION) HOWEVER CAUSED AND ON ANY THEORY OF
+ * LIABILITY, WHETHER IN CONTRACT, STRICT LIABILITY, OR TORT (INCLUDING
+ * NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE OF THIS
+ * SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+ */
+
+package capture
+
+import "fmt"
+import "net"
+
+// A network interface packets can be captured from.
+type Interface struct {
+    Name        string
+    Description string
+    Addresses   []net.IPNet
+    Flags       net.Flags
+}
+
+// Return the network interfaces of the system, as reported by the operating
+// system (e.g. via netlink on Linux). Capture backends may provide their own
+// list of interfaces (see e.g. the pcap package).
+func Interfaces() ([]Interface, error) {
+    ifaces, err := net.Interfaces()
+    if err != nil {
+        return nil, fmt.Errorf("Could not list interfaces: %s", err)
+    }
+
+    var list []Interface
+
+    for _, iface := range ifaces {
+        dev := Interface{
+            Name:  iface.Name,
+            Flags: iface.Flags,
+        }
+
+        addrs, err := iface.Addrs()
+        if err != nil {
+            return nil, fmt.Errorf("Could not list addresses: %s", err)
+        }
+
+        for _, addr := range addrs {
+            if ipnet, ok := addr.(*net.IPNet); ok {
+                dev.Addresses = append(dev.Addresses, *ipnet)
+            }
+        }
+
+        list = append(list, dev)
+    }
+
+    return list, nil
+}
+
+// Return true if the interface is up.
+func (i Interface) IsUp() bool {
+    return i.Flags & net.FlagUp != 0
+}
+
+// Return true if the interface is a loopback interface.
+func (i Interface) IsLoopback() bool {
+    return i.Flags & net.FlagLoopback != 0
+}
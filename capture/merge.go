@@ -0,0 +1,313 @@
+/*
+ * Network packet analysis framework.
+ *
+ * Copyright (c) 2014, Alessandro Ghedini
+ * All rights reserved.
+ *
+ * Redistribution and use in source and binary forms, with or without
+ * modification, are permitted provided that the following conditions are
+ * met:
+ *
+ *     * Redistributions of source code must retain the above copyright
+ *       notice, this list of conditions and the following disclaimer.
+ *
+ *     * Redistributions in binary form must reproduce the above copyright
+ *       notice, this list of conditions and the following disclaimer in the
+ *       documentation and/or other materials provided with the distribution.
+ *
+ * THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS
+ * IS" AND ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO,
+ * THE IMPLIED WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR
+ * PURPOSE ARE DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT HOLDER OR
+ * CONTRIBUTORS BE LIABLE FOR ANY DIRECT, INDIRECT, INCIDENTAL, SPECIAL,
+ * EXEMPLARY, OR CONSEQUENTIAL DAMAGES (INCLUDING, BUT NOT LIMITED TO,
+ * PROCUREMENT OF SUBSTITUTE GOODS OR SERVICES; LOSS OF USE, DATA, OR
+ * PROFITS; OR BUSINESS INTERRUPTION) HOWEVER CAUSED AND ON ANY THEORY OF
+ * LIABILITY, WHETHER IN CONTRACT, STRICT LIABILITY, OR TORT (INCLUDING
+ * NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE OF THIS
+ * SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+ */
+
+package capture
+
+import "fmt"
+import "sync"
+import "time"
+
+import "github.com/adigal150/go.pkt/filter"
+import "github.com/adigal150/go.pkt/packet"
+
+// MergedHandle is a capture handle that reads packets from several capture
+// handles at once, e.g. to monitor multiple network interfaces (see Merge()).
+type MergedHandle struct {
+    sources []*merge_source
+    start   sync.Once
+    stop    sync.Once
+    quit    chan struct{}
+}
+
+type merge_source struct {
+    handle Handle
+    pkts   chan merge_result
+    head   *merge_result
+    done   bool
+}
+
+type merge_result struct {
+    buf  []byte
+    info CaptureInfo
+    err  error
+}
+
+// Create a capture handle that merges the packets captured by the given
+// handles, ordered by timestamp, like mergecap does for dump files. The Source
+// field of the packets' metadata is set to the index of the handle they were
+// captured by. All the handles must have the same link type.
+//
+// Each handle is read on a separate goroutine, and a packet is only returned
+// once every handle provided one (or reached its end), so live handles should
+// have a read timeout set (see SetReadTimeout()), in order not to delay the
+// packets of the other handles indefinitely. If all the handles time out,
+// ErrTimeout is returned.
+//
+// The errors of each handle are returned along with its index, after which the
+// handle isn't read anymore, while the other handles still are. The end of the
+// merged handle is reached when the end of all the handles is.
+func Merge(handles ...Handle) *MergedHandle {
+    m := &MergedHandle{ quit: make(chan struct{}) }
+
+    for _, h := range handles {
+        m.sources = append(m.sources, &merge_source{
+            handle: h,
+            pkts:   make(chan merge_result, 1),
+        })
+    }
+
+    return m
+}
+
+// Return the link type of the merged handles.
+func (m *MergedHandle) LinkType() packet.Type {
+    if len(m.sources) == 0 {
+        return packet.None
+    }
+
+    return m.sources[0].handle.LinkType()
+}
+
+// Return the PCAP link type (DLT) of the merged handles.
+func (m *MergedHandle) DataLink() uint32 {
+    if len(m.sources) == 0 {
+        return 0
+    }
+
+    return m.sources[0].handle.DataLink()
+}
+
+// Set the MTU of all the handles.
+func (m *MergedHandle) SetMTU(mtu int) error {
+    return m.each(func(h Handle) error { return h.SetMTU(mtu) })
+}
+
+// Set the snapshot length of all the handles.
+func (m *MergedHandle) SetSnapLen(snaplen int) error {
+    return m.each(func(h Handle) error { return h.SetSnapLen(snaplen) })
+}
+
+// Enable/disable promiscuous mode on all the handles.
+func (m *MergedHandle) SetPromiscMode(promisc bool) error {
+    return m.each(func(h Handle) error { return h.SetPromiscMode(promisc) })
+}
+
+// Enable/disable monitor mode on all the handles.
+func (m *MergedHandle) SetMonitorMode(monitor bool) error {
+    return m.each(func(h Handle) error { return h.SetMonitorMode(monitor) })
+}
+
+// Set the read timeout of all the handles.
+func (m *MergedHandle) SetReadTimeout(timeout time.Duration) error {
+    return m.each(func(h Handle) error { return h.SetReadTimeout(timeout) })
+}
+
+// Enable/disable immediate mode on all the handles.
+func (m *MergedHandle) SetImmediate(immediate bool) error {
+    return m.each(func(h Handle) error { return h.SetImmediate(immediate) })
+}
+
+// Apply the given filter to all the handles.
+func (m *MergedHandle) ApplyFilter(filter *filter.Filter) error {
+    return m.each(func(h Handle) error { return h.ApplyFilter(filter) })
+}
+
+// Compile the given tcpdump-like expression and apply it to all the handles.
+func (m *MergedHandle) SetFilter(expr string) error {
+    return m.each(func(h Handle) error { return h.SetFilter(expr) })
+}
+
+// Activate all the handles, and check that their link types match.
+func (m *MergedHandle) Activate() error {
+    err := m.each(func(h Handle) error { return h.Activate() })
+    if err != nil {
+        return err
+    }
+
+    for i, s := range m.sources {
+        if s.handle.LinkType() != m.LinkType() {
+            return fmt.Errorf("Link type mismatch on source %d: %s", i,
+                              s.handle.LinkType())
+        }
+    }
+
+    return nil
+}
+
+// Capture a single packet from the merged handles. If no packet is available
+// (i.e. if the end of all the handles has been reached) it will return a nil
+// slice.
+func (m *MergedHandle) Capture() ([]byte, error) {
+    buf, _, err := m.CaptureWithInfo()
+    return buf, err
+}
+
+// Capture a single packet from the merged handles, like Capture(), and also
+// return its metadata.
+func (m *MergedHandle) CaptureWithInfo() ([]byte, CaptureInfo, error) {
+    m.start.Do(func() {
+        for i, s := range m.sources {
+            go m.read(i, s)
+        }
+    })
+
+    var next *merge_source
+
+    for _, s := range m.sources {
+        if !s.done && s.head == nil {
+            res, ok := <-s.pkts
+            if ok {
+                s.head = &res
+            } else {
+                s.done = true
+            }
+        }
+
+        if s.head == nil || s.head.err == ErrTimeout {
+            continue
+        }
+
+        /* errors are returned as soon as they are seen */
+        if s.head.err != nil {
+            next = s
+            break
+        }
+
+        if next == nil ||
+           s.head.info.Timestamp.Before(next.head.info.Timestamp) {
+            next = s
+        }
+    }
+
+    timeout := false
+
+    /* timeouts are consumed, so that the handles are read again */
+    for _, s := range m.sources {
+        if s.head != nil && s.head.err == ErrTimeout {
+            s.head  = nil
+            timeout = true
+        }
+    }
+
+    if next == nil {
+        if timeout {
+            return nil, CaptureInfo{}, ErrTimeout
+        }
+
+        return nil, CaptureInfo{}, nil
+    }
+
+    res := next.head
+    next.head = nil
+
+    if res.err != nil {
+        return nil, CaptureInfo{}, fmt.Errorf("Source %d: %w",
+                                              res.info.Source, res.err)
+    }
+
+    return res.buf, res.info, nil
+}
+
+// Not supported, since it's not known which handle should send the packet.
+func (m *MergedHandle) Inject(buf []byte) error {
+    return fmt.Errorf("Unsupported")
+}
+
+// Return the sum of the packet counters of all the handles.
+func (m *MergedHandle) Stats() (Stats, error) {
+    var stats Stats
+
+    err := m.each(func(h Handle) error {
+        s, err := h.Stats()
+        if err != nil {
+            return err
+        }
+
+        stats.Received  += s.Received
+        stats.Dropped   += s.Dropped
+        stats.IfDropped += s.IfDropped
+
+        return nil
+    })
+
+    return stats, err
+}
+
+// Close all the handles.
+func (m *MergedHandle) Close() {
+    m.stop.Do(func() {
+        close(m.quit)
+
+        for _, s := range m.sources {
+            s.handle.Close()
+        }
+    })
+}
+
+func (m *MergedHandle) each(fn func(h Handle) error) error {
+    for i, s := range m.sources {
+        err := fn(s.handle)
+        if err != nil {
+            return fmt.Errorf("Source %d: %w", i, err)
+        }
+    }
+
+    return nil
+}
+
+func (m *MergedHandle) read(index int, s *merge_source) {
+    defer close(s.pkts)
+
+    for {
+        buf, info, err := s.handle.CaptureWithInfo()
+        if buf == nil && err == nil {
+            return
+        }
+
+        info.Source = index
+
+        /* handles may reuse their buffer for the next packet */
+        res := merge_result{
+            buf:  append([]byte(nil), buf...),
+            info: info,
+            err:  err,
+        }
+
+        select {
+        case s.pkts <- res:
+        case <-m.quit:
+            return
+        }
+
+        if err != nil && err != ErrTimeout {
+            return
+        }
+    }
+}
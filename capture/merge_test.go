@@ -0,0 +1,112 @@
+/*
+ * Network packet analysis framework.
+ *
+ * Copyright (c) 2014, Alessandro Ghedini
+ * All rights reserved.
+ *
+ * Redistribution and use in source and binary forms, with or without
+ * modification, are permitted provided that the following conditions are
+ * met:
+ *
+ *     * Redistributions of source code must retain the above copyright
+ *       notice, this list of conditions and the following disclaimer.
+ *
+ *     * Redistributions in binary form must reproduce the above copyright
+ *       notice, this list of conditions and the following disclaimer in the
+ *       documentation and/or other materials provided with the distribution.
+ *
+ * THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS
+ * IS" AND ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO,
+ * THE IMPLIED WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR
+ * PURPOSE ARE DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT HOLDER OR
+ * CONTRIBUTORS BE LIABLE FOR ANY DIRECT, INDIRECT, INCIDENTAL, SPECIAL,
+ * EXEMPLARY, OR CONSEQUENTIAL DAMAGES (INCLUDING, BUT NOT LIMITED TO,
+ * PROCUREMENT OF SUBSTITUTE GOODS OR SERVICES; LOSS OF USE, DATA, OR
+ * PROFITS; OR BUSINESS INTERRUPTION) HOWEVER CAUSED AND ON ANY THEORY OF
+ * LIABILITY, WHETHER IN CONTRACT, STRICT LIABILITY, OR TORT (INCLUDING
+ * NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE OF THIS
+ * SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+ */
+
+package capture_test
+
+import "bytes"
+import "testing"
+import "time"
+
+import "github.com/adigal150/go.pkt/capture"
+import "github.com/adigal150/go.pkt/capture/stream"
+import "github.com/adigal150/go.pkt/packet"
+
+func make_stream(t *testing.T, tag byte, gaps ...time.Duration) capture.Handle {
+    var data bytes.Buffer
+
+    out, err := stream.Create(&data, stream.PCAP, packet.Eth)
+    if err != nil {
+        t.Fatalf("Error creating: %s", err)
+    }
+
+    base := time.Unix(1400000000, 0)
+
+    for i, gap := range gaps {
+        buf := make([]byte, 60)
+        buf[0] = tag
+        buf[1] = byte(i)
+
+        err = out.WritePacket(buf, capture.CaptureInfo{
+            Timestamp: base.Add(gap),
+            CaptureLength: len(buf),
+            Length: len(buf),
+        })
+        if err != nil {
+            t.Fatalf("Error writing: %s", err)
+        }
+    }
+
+    in, err := stream.Open(&data, stream.PCAP, packet.None)
+    if err != nil {
+        t.Fatalf("Error opening: %s", err)
+    }
+
+    return in
+}
+
+func TestMerge(t *testing.T) {
+    a := make_stream(t, 'a', 0, 20 * time.Millisecond, 40 * time.Millisecond)
+    b := make_stream(t, 'b', 10 * time.Millisecond, 30 * time.Millisecond)
+
+    var m capture.Handle = capture.Merge(a, b)
+    defer m.Close()
+
+    err := m.Activate()
+    if err != nil {
+        t.Fatalf("Error activating: %s", err)
+    }
+
+    if m.LinkType() != packet.Eth {
+        t.Fatalf("Link type mismatch: %s", m.LinkType())
+    }
+
+    var order []byte
+
+    for {
+        buf, info, err := m.CaptureWithInfo()
+        if err != nil {
+            t.Fatalf("Error capturing: %s", err)
+        }
+
+        if buf == nil {
+            break
+        }
+
+        if info.Source != int(buf[0] - 'a') {
+            t.Fatalf("Source mismatch: %d %c", info.Source, buf[0])
+        }
+
+        order = append(order, buf[0], '0' + buf[1])
+    }
+
+    if string(order) != "a0b0a1b1a2" {
+        t.Fatalf("Packet order mismatch: %s", order)
+    }
+}
@@ -0,0 +1,75 @@
+/*
+ * Network packet analysis framework.
+ *
+ * Copyright (c) 2014, Alessandro Ghedini
+ * All rights reserved.
+ *
+ * Redistribution and use in source and binary forms, with or without
+ * modification, are permitted provided that the following conditions are
+ * met:
+ *
+ *     * Redistributions of source code must retain the above copyright
+ *       notice, this list of conditions and the following disclaimer.
+ *
+ *     * Redistributions in binary form must reproduce the above copyright
+ *       notice, this list of conditions and the following disclaimer in the
+ *       documentation and/or other materials provided with the distribution.
+ *
+ * THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS
+ * IS" AND ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO,
+ * THE IMPLIED WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR
+ * PURPOSE ARE DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT HOLDER OR
+ * CONTRIBUTORS BE LIABLE FOR ANY DIRECT, INDIRECT, INCIDENTAL, SPECIAL,
+ * EXEMPLARY, OR CONSEQUENTIAL DAMAGES (INCLUDING, BUT NOT LIMITED TO,
+ * PROCUREMENT OF SUBSTITUTE GOODS OR SERVICES; LOSS OF USE, DATA, OR
+ * PROFITS; OR BUSINESS INTERRUPTION) HOWEVER CAUSED AND ON ANY THEORY OF
+ * LIABILITY, WHETHER IN CONTRACT, STRICT LIABILITY, OR TORT (INCLUDING
+ * NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE OF THIS
+ * SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+ */
+
+package capture
+
+import "time"
+
+import "github.com/adigal150/go.pkt/packet"
+
+// PacketWriter encodes decoded packets and writes them to a packet sink (e.g. a
+// dump file), so that modified packets can be saved again. The link type of
+// the sink is set according to the type of the outermost layer of the packets.
+type PacketWriter struct {
+    out       Writer
+    link_type packet.Type
+}
+
+// Create a new packet writer that writes to the given sink.
+func NewPacketWriter(out Writer) *PacketWriter {
+    return &PacketWriter{ out: out }
+}
+
+// Encode the given packet, including all of its payloads (see layers.Pack()),
+// and write it to the sink with the given timestamp. Lengths and checksums are
+// updated according to the current value of the packet fields.
+func (w *PacketWriter) WritePacket(pkt packet.Packet, ts time.Time) error {
+    buf, err := pack_packet(pkt)
+    if err != nil {
+        return err
+    }
+
+    if pkt.GetType() != w.link_type {
+        err = w.out.SetLinkType(pkt.GetType())
+        if err != nil {
+            return err
+        }
+
+        w.link_type = pkt.GetType()
+    }
+
+    info := CaptureInfo{
+        Timestamp:     ts,
+        CaptureLength: len(buf),
+        Length:        len(buf),
+    }
+
+    return w.out.WritePacket(buf, info)
+}
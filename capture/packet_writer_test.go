@@ -0,0 +1,118 @@
+/*
+ * Network packet analysis framework.
+ *
+ * Copyright (c) 2014, Alessandro Ghedini
+ * All rights reserved.
+ *
+ * Redistribution and use in source and binary forms, with or without
+ * modification, are permitted provided that the following conditions are
+ * met:
+ *
+ *     * Redistributions of source code must retain the above copyright
+ *       notice, this list of conditions and the following disclaimer.
+ *
+ *     * Redistributions in binary form must reproduce the above copyright
+ *       notice, this list of conditions and the following disclaimer in the
+ *       documentation and/or other materials provided with the distribution.
+ *
+ * THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS
+ * IS" AND ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO,
+ * THE IMPLIED WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR
+ * PURPOSE ARE DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT HOLDER OR
+ * CONTRIBUTORS BE LIABLE FOR ANY DIRECT, INDIRECT, INCIDENTAL, SPECIAL,
+ * EXEMPLARY, OR CONSEQUENTIAL DAMAGES (INCLUDING, BUT NOT LIMITED TO,
+ * PROCUREMENT OF SUBSTITUTE GOODS OR SERVICES; LOSS OF USE, DATA, OR
+ * PROFITS; OR BUSINESS INTERRUPTION) HOWEVER CAUSED AND ON ANY THEORY OF
+ * LIABILITY, WHETHER IN CONTRACT, STRICT LIABILITY, OR TORT (INCLUDING
+ * NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE OF THIS
+ * SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+ */
+
+package capture_test
+
+import "path/filepath"
+import "testing"
+
+import "github.com/adigal150/go.pkt/capture"
+import "github.com/adigal150/go.pkt/capture/file"
+import "github.com/adigal150/go.pkt/layers"
+import "github.com/adigal150/go.pkt/packet"
+import "github.com/adigal150/go.pkt/packet/ipv4"
+
+func TestPacketWriterTTL(t *testing.T) {
+    src, err := file.Open("file/capture_test.pcap")
+    if err != nil {
+        t.Fatalf("Error opening: %s", err)
+    }
+    defer src.Close()
+
+    out_name := filepath.Join(t.TempDir(), "ttl_test.pcap")
+
+    dst, err := file.Open(out_name)
+    if err != nil {
+        t.Fatalf("Error opening: %s", err)
+    }
+
+    w := capture.NewPacketWriter(dst)
+
+    var ttls []uint8
+
+    err = capture.EachPacket(src,
+        func(pkt packet.Packet, info capture.CaptureInfo) error {
+            ip4 := layers.FindLayer(pkt, packet.IPv4)
+            if ip4 != nil {
+                ip4.(*ipv4.Packet).TTL--
+                ttls = append(ttls, ip4.(*ipv4.Packet).TTL)
+            }
+
+            return w.WritePacket(pkt, info.Timestamp)
+        })
+    if err != nil {
+        t.Fatalf("Error rewriting: %s", err)
+    }
+
+    dst.Close()
+
+    if len(ttls) == 0 {
+        t.Fatalf("No IPv4 packets found")
+    }
+
+    res, err := file.Open(out_name)
+    if err != nil {
+        t.Fatalf("Error opening: %s", err)
+    }
+    defer res.Close()
+
+    if res.LinkType() != packet.Eth {
+        t.Fatalf("Link type mismatch: %s", res.LinkType())
+    }
+
+    var count int
+
+    err = capture.EachPacket(res,
+        func(pkt packet.Packet, info capture.CaptureInfo) error {
+            ip4 := layers.FindLayer(pkt, packet.IPv4)
+            if ip4 == nil {
+                return nil
+            }
+
+            if ip4.(*ipv4.Packet).TTL != ttls[count] {
+                t.Fatalf("TTL mismatch: %d", ip4.(*ipv4.Packet).TTL)
+            }
+
+            hdr := ip4.RawBytes()[:ip4.(*ipv4.Packet).IHL * 4]
+            if packet.Checksum(hdr, 0) != 0 {
+                t.Fatalf("Invalid IPv4 checksum: %x", hdr)
+            }
+
+            count++
+            return nil
+        })
+    if err != nil {
+        t.Fatalf("Error reading: %s", err)
+    }
+
+    if count != len(ttls) {
+        t.Fatalf("Count mismatch: %d", count)
+    }
+}
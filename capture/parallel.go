@@ -0,0 +1,147 @@
+/*
+ * Network packet analysis framework.
+ *
+ * Copyright (c) 2014, Alessandro Ghedini
+ * All rights reserved.
+ *
+ * Redistribution and use in source and binary forms, with or without
+ * modification, are permitted provided that the following conditions are
+ * met:
+ *
+ *     * Redistributions of source code must retain the above copyright
+ *       notice, this list of conditions and the following disclaimer.
+ *
+ *     * Redistributions in binary form must reproduce the above copyright
+ *       notice, this list of conditions and the following disclaimer in the
+ *       documentation and/or other materials provided with the distribution.
+ *
+ * THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS
+ * IS" AND ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO,
+ * THE IMPLIED WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR
+ * PURPOSE ARE DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT HOLDER OR
+ * CONTRIBUTORS BE LIABLE FOR ANY DIRECT, INDIRECT, INCIDENTAL, SPECIAL,
+ * EXEMPLARY, OR CONSEQUENTIAL DAMAGES (INCLUDING, BUT NOT LIMITED TO,
+ * PROCUREMENT OF SUBSTITUTE GOODS OR SERVICES; LOSS OF USE, DATA, OR
+ * PROFITS; OR BUSINESS INTERRUPTION) HOWEVER CAUSED AND ON ANY THEORY OF
+ * LIABILITY, WHETHER IN CONTRACT, STRICT LIABILITY, OR TORT (INCLUDING
+ * NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE OF THIS
+ * SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+ */
+package capture
+
+import "runtime"
+import "sync"
+
+import "github.com/adigal150/go.pkt/layers"
+import "github.com/adigal150/go.pkt/packet"
+
+type decode_job struct {
+    buf  []byte
+    info CaptureInfo
+    pkt  packet.Packet
+    err  error
+    done chan struct{}
+}
+
+// Read packets from the given source like EachPacket(), but decode them on the
+// given number of worker goroutines, e.g. to process large dump files faster.
+// If workers is 0, one worker per CPU is used.
+//
+// The packets are read on a separate goroutine, while fn is called on the
+// calling one, in the order the packets were read. At most twice as many
+// packets as workers are in flight at any time, so that a slow fn also slows
+// down the reading. The packets don't alias the buffers returned by the source.
+//
+// Reading stops at the end of the source, or at the first error returned by
+// the source, the decoder or fn, which is returned. The source is not read
+// anymore once this function returns.
+func EachPacketParallel(r Reader, workers int,
+                        fn func(pkt packet.Packet, info CaptureInfo) error) error {
+    if workers <= 0 {
+        workers = runtime.NumCPU()
+    }
+
+    link_type := r.LinkType()
+
+    jobs  := make(chan *decode_job, workers)
+    order := make(chan *decode_job, workers * 2)
+    quit  := make(chan struct{})
+
+    var wg sync.WaitGroup
+
+    for i := 0; i < workers; i++ {
+        wg.Add(1)
+
+        go func() {
+            defer wg.Done()
+
+            for job := range jobs {
+                job.pkt, job.err = layers.UnpackAll(job.buf, link_type)
+                close(job.done)
+            }
+        }()
+    }
+
+    wg.Add(1)
+
+    go func() {
+        defer wg.Done()
+        defer close(order)
+        defer close(jobs)
+
+        for {
+            buf, info, err := r.CaptureWithInfo()
+            if buf == nil && err == nil {
+                return
+            }
+
+            job := &decode_job{
+                buf:  append([]byte(nil), buf...),
+                info: info,
+                err:  err,
+                done: make(chan struct{}),
+            }
+
+            /* jobs are queued in order before being handed to the workers,
+             * so that results can be collected in the same order */
+            select {
+            case order <- job:
+            case <-quit:
+                return
+            }
+
+            if err != nil {
+                close(job.done)
+                return
+            }
+
+            select {
+            case jobs <- job:
+            case <-quit:
+                return
+            }
+        }
+    }()
+
+    var err error
+
+    for job := range order {
+        <-job.done
+
+        err = job.err
+        if err == nil {
+            err = fn(job.pkt, job.info)
+        }
+
+        if err != nil {
+            break
+        }
+    }
+
+    /* unblock the reader, in case it's waiting for room in the queues */
+    close(quit)
+
+    wg.Wait()
+
+    return err
+}
@@ -34,18 +34,44 @@ package pcap
 
 // #cgo LDFLAGS: -lpcap
 // #include <stdlib.h>
+// #include <string.h>
+// #include <sys/socket.h>
+// #include <netinet/in.h>
 // #include <pcap.h>
+//
+// static int sockaddr_ip(struct sockaddr *sa, unsigned char *ip) {
+//     if (sa == NULL)
+//         return 0;
+//
+//     switch (sa->sa_family) {
+//     case AF_INET:
+//         memcpy(ip, &((struct sockaddr_in *) sa)->sin_addr, 4);
+//         return 4;
+//
+//     case AF_INET6:
+//         memcpy(ip, &((struct sockaddr_in6 *) sa)->sin6_addr, 16);
+//         return 16;
+//     }
+//
+//     return 0;
+// }
 import "C"
 
 import "fmt"
+import "net"
+import "time"
 import "unsafe"
 
+import "github.com/adigal150/go.pkt/capture"
 import "github.com/adigal150/go.pkt/filter"
 import "github.com/adigal150/go.pkt/packet"
 
 type Handle struct {
-    Device string
-    pcap   *C.pcap_t
+    Device  string
+    pcap    *C.pcap_t
+    filter  *filter.Filter
+    nano    bool
+    timeout bool
 }
 
 // Create a new capture handle from the given network interface. Noe that this
@@ -60,7 +86,7 @@ func Open(dev_name string) (*Handle, error) {
     defer C.free(unsafe.Pointer(err_str))
 
     handle.pcap = C.pcap_create(dev_str, err_str)
-    if handle == nil {
+    if handle.pcap == nil {
         return nil, fmt.Errorf(
             "Could not open device: %s", C.GoString(err_str),
         )
@@ -69,10 +95,77 @@ func Open(dev_name string) (*Handle, error) {
     return handle, nil
 }
 
+// Return the network interfaces that libpcap can capture from.
+func Interfaces() ([]capture.Interface, error) {
+    var devs *C.pcap_if_t
+
+    err_str := (*C.char)(C.calloc(256, 1))
+    defer C.free(unsafe.Pointer(err_str))
+
+    err := C.pcap_findalldevs(&devs, err_str)
+    if err < 0 {
+        return nil, fmt.Errorf(
+            "Could not list interfaces: %s", C.GoString(err_str),
+        )
+    }
+    defer C.pcap_freealldevs(devs)
+
+    var list []capture.Interface
+
+    for dev := devs; dev != nil; dev = dev.next {
+        iface := capture.Interface{
+            Name:        C.GoString(dev.name),
+            Description: C.GoString(dev.description),
+        }
+
+        if dev.flags & C.PCAP_IF_UP != 0 {
+            iface.Flags |= net.FlagUp
+        }
+
+        if dev.flags & C.PCAP_IF_LOOPBACK != 0 {
+            iface.Flags |= net.FlagLoopback
+        }
+
+        for addr := dev.addresses; addr != nil; addr = addr.next {
+            ip := sockaddr_ip(addr.addr)
+            if ip == nil {
+                continue
+            }
+
+            mask := sockaddr_ip(addr.netmask)
+
+            iface.Addresses = append(iface.Addresses, net.IPNet{
+                IP:   ip,
+                Mask: net.IPMask(mask),
+            })
+        }
+
+        list = append(list, iface)
+    }
+
+    return list, nil
+}
+
+func sockaddr_ip(sa *C.struct_sockaddr) net.IP {
+    ip := make(net.IP, 16)
+
+    n := C.sockaddr_ip(sa, (*C.uchar)(&ip[0]))
+    if n == 0 {
+        return nil
+    }
+
+    return ip[:n]
+}
+
 // Return the link type of the capture handle (that is, the type of packets that
 // come out of the packet source).
 func (h *Handle) LinkType() packet.Type {
-    return packet.LinkType(uint32(C.pcap_datalink(h.pcap)))
+    return packet.LinkType(h.DataLink())
+}
+
+// Return the PCAP link type (DLT) of the capture handle.
+func (h *Handle) DataLink() uint32 {
+    return uint32(C.pcap_datalink(h.pcap))
 }
 
 func (h *Handle) SetMTU(mtu int) error {
@@ -84,6 +177,17 @@ func (h *Handle) SetMTU(mtu int) error {
     return nil
 }
 
+// Set the maximum number of bytes captured for each packet. Longer packets are
+// truncated, and their CaptureInfo.CaptureLength is lower than their Length.
+func (h *Handle) SetSnapLen(snaplen int) error {
+    err := C.pcap_set_snaplen(h.pcap, C.int(snaplen))
+    if err < 0 {
+        return fmt.Errorf("Handle already active")
+    }
+
+    return nil
+}
+
 // Enable/disable promiscuous mode.
 func (h *Handle) SetPromiscMode(promisc bool) error {
     var promisc_int C.int
@@ -121,6 +225,65 @@ func (h *Handle) SetMonitorMode(monitor bool) error {
     return nil
 }
 
+// Set the maximum time to wait for a packet when capturing, after which
+// capture.ErrTimeout is returned, or 0 to wait forever. The timeout can't be
+// changed after the handle is activated. Note that libpcap may wait for the
+// whole timeout before returning the packets received in the meantime.
+func (h *Handle) SetReadTimeout(timeout time.Duration) error {
+    ms := timeout.Nanoseconds() / int64(time.Millisecond)
+    if timeout > 0 && ms == 0 {
+        ms = 1
+    }
+
+    err := C.pcap_set_timeout(h.pcap, C.int(ms))
+    if err < 0 {
+        return fmt.Errorf("Handle already active")
+    }
+
+    h.timeout = timeout > 0
+    return nil
+}
+
+// Enable/disable immediate mode. By default libpcap buffers the received packets
+// and delivers them in batches, which improves throughput. In immediate mode
+// packets are delivered as soon as they arrive, which lowers latency (e.g. for
+// interactive tools) at the cost of more wakeups and lower throughput.
+func (h *Handle) SetImmediate(immediate bool) error {
+    var immediate_int C.int
+
+    if immediate {
+        immediate_int = 1
+    } else {
+        immediate_int = 0
+    }
+
+    err := C.pcap_set_immediate_mode(h.pcap, immediate_int)
+    if err < 0 {
+        return fmt.Errorf("Handle already active")
+    }
+
+    return nil
+}
+
+// Enable/disable nanosecond resolution timestamps (the default is microsecond
+// resolution). This fails if the packet source doesn't support them.
+func (h *Handle) SetNanoTimestamps(nano bool) error {
+    var precision C.int
+
+    if nano {
+        precision = C.PCAP_TSTAMP_PRECISION_NANO
+    } else {
+        precision = C.PCAP_TSTAMP_PRECISION_MICRO
+    }
+
+    err := C.pcap_set_tstamp_precision(h.pcap, precision)
+    if err < 0 {
+        return fmt.Errorf("Could not set timestamp precision")
+    }
+
+    return nil
+}
+
 // Apply the given filter it to the packet source. Only packets that match this
 // filter will be captured.
 func (h *Handle) ApplyFilter(filter *filter.Filter) error {
@@ -142,6 +305,42 @@ func (h *Handle) ApplyFilter(filter *filter.Filter) error {
     return nil
 }
 
+// Compile the given tcpdump-like expression and install the resulting BPF
+// program in the kernel, so that packets that don't match it are discarded
+// before being copied to userspace. The handle must be active, since the
+// expression is compiled for its link type.
+//
+// If the program can't be installed (e.g. because the packet source doesn't
+// support BPF) it is run in userspace against every captured packet instead.
+func (h *Handle) SetFilter(expr string) error {
+    var prog C.struct_bpf_program
+
+    expr_str := C.CString(expr)
+    defer C.free(unsafe.Pointer(expr_str))
+
+    err := C.pcap_compile(h.pcap, &prog, expr_str, 1, C.PCAP_NETMASK_UNKNOWN)
+    if err < 0 {
+        return fmt.Errorf(
+            "Could not compile filter '%s': %s", expr, h.get_error(),
+        )
+    }
+    defer C.pcap_freecode(&prog)
+
+    err = C.pcap_setfilter(h.pcap, &prog)
+    if err < 0 {
+        flt, err := filter.Compile(expr, h.LinkType(), 0, true)
+        if err != nil {
+            return fmt.Errorf("Could not compile filter '%s': %s", expr, err)
+        }
+
+        h.filter = flt
+        return nil
+    }
+
+    h.filter = nil
+    return nil
+}
+
 // Activate the packet source. Note that after calling this method it will not
 // be possible to change the packet source configuration (MTU, promiscuous mode,
 // monitor mode, ...)
@@ -151,36 +350,65 @@ func (h *Handle) Activate() error {
         return fmt.Errorf("Could not activate: %s", h.get_error())
     }
 
+    h.nano = C.pcap_get_tstamp_precision(h.pcap) ==
+             C.PCAP_TSTAMP_PRECISION_NANO
+
     return nil
 }
 
 // Capture a single packet from the packet source. This will block until a
-// packet is received.
+// packet is received, or until the read timeout expires.
 func (h *Handle) Capture() ([]byte, error) {
+    buf, _, err := h.CaptureWithInfo()
+    return buf, err
+}
+
+// Capture a single packet from the packet source, like Capture(), and also
+// return its metadata. See SetNanoTimestamps() for the timestamp resolution.
+func (h *Handle) CaptureWithInfo() ([]byte, capture.CaptureInfo, error) {
     var buf *C.u_char
     var pkt_hdr *C.struct_pcap_pkthdr
+    var info capture.CaptureInfo
 
     for {
         err := C.pcap_next_ex(h.pcap, &pkt_hdr, &buf)
         switch err {
         case -2:
-            return nil, nil
+            return nil, info, nil
 
         case -1:
-            return nil, fmt.Errorf(
+            return nil, info, fmt.Errorf(
                 "Could not read packet: %s", h.get_error(),
             )
 
         case 0:
+            if h.timeout {
+                return nil, info, capture.ErrTimeout
+            }
+
             continue
 
         case 1:
-            return C.GoBytes(unsafe.Pointer(buf),
-                             C.int(pkt_hdr.len)), nil
+            pkt_buf := C.GoBytes(unsafe.Pointer(buf), C.int(pkt_hdr.caplen))
+
+            if h.filter != nil &&
+               (len(pkt_buf) == 0 || !h.filter.Match(pkt_buf)) {
+                continue
+            }
+
+            /* tv_usec holds nanoseconds with nanosecond precision */
+            nsec := int64(pkt_hdr.ts.tv_usec) * 1000
+            if h.nano {
+                nsec = int64(pkt_hdr.ts.tv_usec)
+            }
+
+            info.Timestamp     = time.Unix(int64(pkt_hdr.ts.tv_sec), nsec)
+            info.CaptureLength = int(pkt_hdr.caplen)
+            info.Length        = int(pkt_hdr.len)
+
+            return pkt_buf, info, nil
         }
     }
-
-    return nil, fmt.Errorf("WTF")
 }
 
 // Inject a packet in the packet source.
@@ -196,6 +424,24 @@ func (h *Handle) Inject(buf []byte) error {
     return nil
 }
 
+// Return the packet counters of the packet source, as reported by libpcap. Note
+// that their exact meaning depends on the platform.
+func (h *Handle) Stats() (capture.Stats, error) {
+    var stats capture.Stats
+    var pcap_stats C.struct_pcap_stat
+
+    err := C.pcap_stats(h.pcap, &pcap_stats)
+    if err < 0 {
+        return stats, fmt.Errorf("Could not get stats: %s", h.get_error())
+    }
+
+    stats.Received  = uint64(pcap_stats.ps_recv)
+    stats.Dropped   = uint64(pcap_stats.ps_drop)
+    stats.IfDropped = uint64(pcap_stats.ps_ifdrop)
+
+    return stats, nil
+}
+
 // Close the packet source.
 func (h *Handle) Close() {
     C.pcap_close(h.pcap)
@@ -203,5 +449,5 @@ func (h *Handle) Close() {
 
 func (h *Handle) get_error() error {
     err_str := C.pcap_geterr(h.pcap)
-    return fmt.Errorf(C.GoString(err_str))
+    return fmt.Errorf("%s", C.GoString(err_str))
 }
@@ -31,10 +31,19 @@
 package pcap_test
 
 import "log"
+import "net"
+import "testing"
+import "time"
 
 import "github.com/adigal150/go.pkt/capture/pcap"
+import "github.com/adigal150/go.pkt/layers"
+import "github.com/adigal150/go.pkt/packet"
+import "github.com/adigal150/go.pkt/packet/eth"
+import "github.com/adigal150/go.pkt/packet/icmpv4"
+import "github.com/adigal150/go.pkt/packet/ipv4"
+import "github.com/adigal150/go.pkt/packet/udp"
 
-func ExampleCapture() {
+func ExampleHandle_Capture() {
     src, err := pcap.Open("eth0")
     if err != nil {
         log.Fatal(err)
@@ -61,7 +70,7 @@ func ExampleCapture() {
     }
 }
 
-func ExampleInject() {
+func ExampleHandle_Inject() {
     dst, err := pcap.Open("eth0")
     if err != nil {
         log.Fatal(err)
@@ -81,3 +90,117 @@ func ExampleInject() {
         log.Fatal(err)
     }
 }
+
+func make_loopback_pkt(l4 packet.Packet) ([]byte, error) {
+    eth_pkt := eth.Make()
+    eth_pkt.SrcAddr = make([]byte, 6)
+    eth_pkt.DstAddr = make([]byte, 6)
+
+    ip4_pkt := ipv4.Make()
+    ip4_pkt.SrcAddr = net.ParseIP("127.0.0.1")
+    ip4_pkt.DstAddr = net.ParseIP("127.0.0.1")
+
+    return layers.Pack(eth_pkt, ip4_pkt, l4)
+}
+
+func TestSetFilter(t *testing.T) {
+    h, err := pcap.Open("lo")
+    if err != nil {
+        t.Skipf("Skipping: %s", err)
+    }
+    defer h.Close()
+
+    err = h.Activate()
+    if err != nil {
+        t.Skipf("Skipping: %s", err)
+    }
+
+    err = h.SetFilter("icmp and and")
+    if err == nil {
+        t.Fatalf("Invalid filter compiled")
+    }
+
+    err = h.SetFilter("icmp")
+    if err != nil {
+        t.Fatalf("Error setting filter: %s", err)
+    }
+
+    udp_buf, err := make_loopback_pkt(udp.Make())
+    if err != nil {
+        t.Fatalf("Error packing: %s", err)
+    }
+
+    icmp_buf, err := make_loopback_pkt(icmpv4.Make())
+    if err != nil {
+        t.Fatalf("Error packing: %s", err)
+    }
+
+    recv := make(chan []byte, 1)
+
+    go func() {
+        buf, err := h.Capture()
+        if err == nil {
+            recv <- buf
+        }
+    }()
+
+    for _, buf := range [][]byte{ udp_buf, icmp_buf } {
+        err = h.Inject(buf)
+        if err != nil {
+            t.Fatalf("Error injecting: %s", err)
+        }
+    }
+
+    select {
+    case buf := <-recv:
+        pkt, err := layers.UnpackAll(buf, h.LinkType())
+        if err != nil {
+            t.Fatalf("Error unpacking: %s", err)
+        }
+
+        if layers.FindLayer(pkt, packet.ICMPv4) == nil {
+            t.Fatalf("Non-matching packet captured: %s", pkt)
+        }
+
+    case <-time.After(time.Second):
+        t.Fatalf("Matching packet not captured")
+    }
+}
+
+func TestPromiscMode(t *testing.T) {
+    h, err := pcap.Open("lo")
+    if err != nil {
+        t.Skipf("Skipping: %s", err)
+    }
+    defer h.Close()
+
+    err = h.SetPromiscMode(true)
+    if err != nil {
+        t.Fatalf("Error setting promiscuous mode: %s", err)
+    }
+
+    err = h.Activate()
+    if err != nil {
+        t.Skipf("Skipping: %s", err)
+    }
+
+    err = h.SetPromiscMode(false)
+    if err == nil {
+        t.Fatalf("Promiscuous mode set after activation")
+    }
+}
+
+func TestInterfaces(t *testing.T) {
+    ifaces, err := pcap.Interfaces()
+    if err != nil {
+        t.Skipf("Skipping: %s", err)
+    }
+
+    for _, iface := range ifaces {
+        if iface.IsLoopback() {
+            return
+        }
+    }
+
+    t.Fatalf("Loopback interface not found: %v", ifaces)
+}
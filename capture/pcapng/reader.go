@@ -0,0 +1,340 @@
+/*
+ * Network packet analysis framework.
+ *
+ * Copyright (c) 2014, Alessandro Ghedini
+ * All rights reserved.
+ *
+ * Redistribution and use in source and binary forms, with or without
+ * modification, are permitted provided that the following conditions are
+ * met:
+ *
+ *     * Redistributions of source code must retain the above copyright
+ *       notice, this list of conditions and the following disclaimer.
+ *
+ *     * Redistributions in binary form must reproduce the above copyright
+ *       notice, this list of conditions and the following disclaimer in the
+ *       documentation and/or other materials provided with the distribution.
+ *
+ * THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS
+ * IS" AND ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO,
+ * THE IMPLIED WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR
+ * PURPOSE ARE DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT HOLDER OR
+ * CONTRIBUTORS BE LIABLE FOR ANY DIRECT, INDIRECT, INCIDENTAL, SPECIAL,
+ * EXEMPLARY, OR CONSEQUENTIAL DAMAGES (INCLUDING, BUT NOT LIMITED TO,
+ * PROCUREMENT OF SUBSTITUTE GOODS OR SERVICES; LOSS OF USE, DATA, OR
+ * PROFITS; OR BUSINESS INTERRUPTION) HOWEVER CAUSED AND ON ANY THEORY OF
+ * LIABILITY, WHETHER IN CONTRACT, STRICT LIABILITY, OR TORT (INCLUDING
+ * NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE OF THIS
+ * SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+ */
+
+package pcapng
+
+import "encoding/binary"
+import "fmt"
+import "io"
+import "math/bits"
+import "time"
+
+import "github.com/adigal150/go.pkt/capture"
+import "github.com/adigal150/go.pkt/packet"
+
+type Reader struct {
+    in         io.Reader
+    order      binary.ByteOrder
+    interfaces []iface
+}
+
+/* Interface description, as needed to decode the packets captured on it */
+type iface struct {
+    link   uint32
+    units  uint64 /* timestamp units per second */
+    offset int64  /* seconds added to the timestamps */
+}
+
+const (
+    simple_packet_block      = 0x00000003
+
+    opt_if_tsoffset          = 14
+
+    max_block_len            = 0x1000000
+)
+
+// Create a new reader on the given input, and read the section header and the
+// first interface description. Files in both byte orders are supported, and
+// the timestamps are decoded with the resolution of the interface the packets
+// were captured on (as given by its if_tsresol option).
+func NewReader(in io.Reader) (*Reader, error) {
+    r := &Reader{ in: in, order: binary.LittleEndian }
+
+    block_type, _, err := r.read_block()
+    if err != nil {
+        return nil, err
+    }
+
+    if block_type != section_header_block {
+        return nil, fmt.Errorf("Invalid file")
+    }
+
+    for len(r.interfaces) == 0 {
+        block_type, body, err := r.read_block()
+        if err == io.EOF {
+            break
+        }
+
+        if err != nil {
+            return nil, err
+        }
+
+        switch block_type {
+        case interface_desc_block:
+            err = r.add_interface(body)
+            if err != nil {
+                return nil, err
+            }
+
+        case enhanced_packet_block, simple_packet_block:
+            return nil, fmt.Errorf("No interface description")
+        }
+    }
+
+    return r, nil
+}
+
+// Return the link type of the first interface of the file.
+func (r *Reader) LinkType() packet.Type {
+    if len(r.interfaces) == 0 {
+        return packet.None
+    }
+
+    return packet.LinkType(r.interfaces[0].link)
+}
+
+// Read the next packet from the file, along with its metadata. Blocks other
+// than interface descriptions and packets are skipped. If no packet is left it
+// will return a nil slice.
+func (r *Reader) CaptureWithInfo() ([]byte, capture.CaptureInfo, error) {
+    var info capture.CaptureInfo
+
+    for {
+        block_type, body, err := r.read_block()
+        if err == io.EOF {
+            return nil, info, nil
+        }
+
+        if err != nil {
+            return nil, info, err
+        }
+
+        switch block_type {
+        case section_header_block:
+            r.interfaces = nil
+
+        case interface_desc_block:
+            err = r.add_interface(body)
+            if err != nil {
+                return nil, info, err
+            }
+
+        case enhanced_packet_block:
+            return r.read_enhanced(body)
+
+        case simple_packet_block:
+            return r.read_simple(body)
+        }
+    }
+}
+
+/* Read the next block, and return its type and body. The byte order is
+ * updated when a section header is read. io.EOF is returned if the end of the
+ * input is reached before the block */
+func (r *Reader) read_block() (uint32, []byte, error) {
+    hdr := make([]byte, 12)
+
+    _, err := io.ReadFull(r.in, hdr)
+    if err == io.EOF {
+        return 0, nil, err
+    }
+
+    if err != nil {
+        return 0, nil, fmt.Errorf("Could not read block: %s", err)
+    }
+
+    /* the section header type is the same in both byte orders */
+    block_type := r.order.Uint32(hdr[0:4])
+
+    if block_type == section_header_block {
+        switch binary.LittleEndian.Uint32(hdr[8:12]) {
+        case byte_order_magic:
+            r.order = binary.LittleEndian
+
+        case 0x4D3C2B1A:
+            r.order = binary.BigEndian
+
+        default:
+            return 0, nil, fmt.Errorf("Invalid byte order magic")
+        }
+    }
+
+    block_len := r.order.Uint32(hdr[4:8])
+    if block_len < 12 || block_len % 4 != 0 || block_len > max_block_len {
+        return 0, nil, fmt.Errorf("Invalid block length: %d", block_len)
+    }
+
+    rest := make([]byte, block_len - 12)
+
+    _, err = io.ReadFull(r.in, rest)
+    if err != nil {
+        return 0, nil, fmt.Errorf("Could not read block: %s", err)
+    }
+
+    body := append(hdr[8:], rest...)
+
+    if r.order.Uint32(body[len(body) - 4:]) != block_len {
+        return 0, nil, fmt.Errorf("Block length mismatch")
+    }
+
+    return block_type, body[:len(body) - 4], nil
+}
+
+func (r *Reader) add_interface(body []byte) error {
+    if len(body) < 8 {
+        return fmt.Errorf("Invalid interface description")
+    }
+
+    i := iface{
+        link:  uint32(r.order.Uint16(body[0:2])),
+        units: 1000000,
+    }
+
+    opts := body[8:]
+
+    for len(opts) >= 4 {
+        code := r.order.Uint16(opts[0:2])
+        size := int(r.order.Uint16(opts[2:4]))
+
+        if code == opt_endofopt {
+            break
+        }
+
+        padded := 4 + (size + 3) / 4 * 4
+        if padded > len(opts) {
+            return fmt.Errorf("Truncated interface option: %d", code)
+        }
+
+        value := opts[4:4 + size]
+
+        switch {
+        case code == opt_if_tsresol && size == 1:
+            units, err := decode_tsresol(value[0])
+            if err != nil {
+                return err
+            }
+
+            i.units = units
+
+        case code == opt_if_tsoffset && size == 8:
+            i.offset = int64(r.order.Uint64(value))
+        }
+
+        opts = opts[padded:]
+    }
+
+    r.interfaces = append(r.interfaces, i)
+
+    return nil
+}
+
+/* Return the number of timestamp units per second for the given if_tsresol
+ * value, which is a negative power of 10, or of 2 if the high bit is set */
+func decode_tsresol(tsresol uint8) (uint64, error) {
+    exp := uint64(tsresol & 0x7F)
+
+    if tsresol & 0x80 != 0 {
+        if exp > 63 {
+            return 0, fmt.Errorf("Invalid timestamp resolution: %x", tsresol)
+        }
+
+        return 1 << exp, nil
+    }
+
+    if exp > 19 {
+        return 0, fmt.Errorf("Invalid timestamp resolution: %x", tsresol)
+    }
+
+    units := uint64(1)
+    for ; exp > 0; exp-- {
+        units *= 10
+    }
+
+    return units, nil
+}
+
+func (r *Reader) read_enhanced(body []byte) ([]byte, capture.CaptureInfo,
+                                             error) {
+    var info capture.CaptureInfo
+
+    if len(body) < 20 {
+        return nil, info, fmt.Errorf("Invalid packet block")
+    }
+
+    index := r.order.Uint32(body[0:4])
+    if index >= uint32(len(r.interfaces)) {
+        return nil, info, fmt.Errorf("Invalid interface: %d", index)
+    }
+
+    caplen  := r.order.Uint32(body[12:16])
+    wirelen := r.order.Uint32(body[16:20])
+
+    if caplen > uint32(len(body) - 20) {
+        return nil, info, fmt.Errorf("Invalid packet length: %d", caplen)
+    }
+
+    ts := uint64(r.order.Uint32(body[4:8])) << 32 |
+          uint64(r.order.Uint32(body[8:12]))
+
+    info.Timestamp     = r.interfaces[index].time(ts)
+    info.CaptureLength = int(caplen)
+    info.Length        = int(wirelen)
+
+    return body[20:20 + caplen], info, nil
+}
+
+/* Read a simple packet block, which has no timestamp, and whose packets are
+ * always captured on the first interface */
+func (r *Reader) read_simple(body []byte) ([]byte, capture.CaptureInfo,
+                                           error) {
+    var info capture.CaptureInfo
+
+    if len(body) < 4 {
+        return nil, info, fmt.Errorf("Invalid packet block")
+    }
+
+    if len(r.interfaces) == 0 {
+        return nil, info, fmt.Errorf("No interface description")
+    }
+
+    wirelen := r.order.Uint32(body[0:4])
+
+    caplen := uint32(len(body) - 4)
+    if wirelen < caplen {
+        caplen = wirelen
+    }
+
+    info.CaptureLength = int(caplen)
+    info.Length        = int(wirelen)
+
+    return body[4:4 + caplen], info, nil
+}
+
+/* Convert the given timestamp, in units of the interface's resolution */
+func (i iface) time(ts uint64) time.Time {
+    sec  := ts / i.units
+    frac := ts % i.units
+
+    /* frac < units, so the quotient always fits in 64 bits */
+    hi, lo  := bits.Mul64(frac, 1000000000)
+    nsec, _ := bits.Div64(hi, lo, i.units)
+
+    return time.Unix(int64(sec) + i.offset, int64(nsec))
+}
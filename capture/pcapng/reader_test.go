@@ -0,0 +1,246 @@
+/*
+ * Network packet analysis framework.
+ *
+ * Copyright (c) 2014, Alessandro Ghedini
+ * All rights reserved.
+ *
+ * Redistribution and use in source and binary forms, with or without
+ * modification, are permitted provided that the following conditions are
+ * met:
+ *
+ *     * Redistributions of source code must retain the above copyright
+ *       notice, this list of conditions and the following disclaimer.
+ *
+ *     * Redistributions in binary form must reproduce the above copyright
+ *       notice, this list of conditions and the following disclaimer in the
+ *       documentation and/or other materials provided with the distribution.
+ *
+ * THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS
+ * IS" AND ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO,
+ * THE IMPLIED WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR
+ * PURPOSE ARE DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT HOLDER OR
+ * CONTRIBUTORS BE LIABLE FOR ANY DIRECT, INDIRECT, INCIDENTAL, SPECIAL,
+ * EXEMPLARY, OR CONSEQUENTIAL DAMAGES (INCLUDING, BUT NOT LIMITED TO,
+ * PROCUREMENT OF SUBSTITUTE GOODS OR SERVICES; LOSS OF USE, DATA, OR
+ * PROFITS; OR BUSINESS INTERRUPTION) HOWEVER CAUSED AND ON ANY THEORY OF
+ * LIABILITY, WHETHER IN CONTRACT, STRICT LIABILITY, OR TORT (INCLUDING
+ * NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE OF THIS
+ * SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+ */
+
+package pcapng_test
+
+import "bytes"
+import "encoding/binary"
+import "testing"
+import "time"
+
+import "github.com/adigal150/go.pkt/capture"
+import "github.com/adigal150/go.pkt/capture/file"
+import "github.com/adigal150/go.pkt/capture/pcapng"
+import "github.com/adigal150/go.pkt/packet"
+
+type test_packet struct {
+    Data []byte
+    Info capture.CaptureInfo
+}
+
+func read_all(t *testing.T, src capture.Reader) []test_packet {
+    var pkts []test_packet
+
+    err := capture.Each(src, func(buf []byte, info capture.CaptureInfo) error {
+        pkts = append(pkts, test_packet{ buf, info })
+        return nil
+    })
+    if err != nil {
+        t.Fatalf("Error reading: %s", err)
+    }
+
+    return pkts
+}
+
+func TestReadConverted(t *testing.T) {
+    src, err := file.Open("writer_test.pcap")
+    if err != nil {
+        t.Fatalf("Error opening: %s", err)
+    }
+    defer src.Close()
+
+    var out bytes.Buffer
+
+    dst, err := pcapng.NewWriter(&out)
+    if err != nil {
+        t.Fatalf("Error creating writer: %s", err)
+    }
+
+    err = capture.Convert(src, dst)
+    if err != nil {
+        t.Fatalf("Error converting: %s", err)
+    }
+
+    orig, err := file.Open("writer_test.pcap")
+    if err != nil {
+        t.Fatalf("Error opening: %s", err)
+    }
+    defer orig.Close()
+
+    r, err := pcapng.NewReader(&out)
+    if err != nil {
+        t.Fatalf("Error creating reader: %s", err)
+    }
+
+    if r.LinkType() != orig.LinkType() {
+        t.Fatalf("Link type mismatch: %s", r.LinkType())
+    }
+
+    want := read_all(t, orig)
+    got  := read_all(t, r)
+
+    if len(got) != len(want) {
+        t.Fatalf("Packet count mismatch: %d", len(got))
+    }
+
+    for i := range got {
+        if !bytes.Equal(got[i].Data, want[i].Data) {
+            t.Fatalf("Data mismatch: %x", got[i].Data)
+        }
+
+        if !got[i].Info.Timestamp.Equal(want[i].Info.Timestamp) {
+            t.Fatalf("Timestamp mismatch: %s", got[i].Info.Timestamp)
+        }
+
+        if got[i].Info.CaptureLength != want[i].Info.CaptureLength ||
+           got[i].Info.Length != want[i].Info.Length {
+            t.Fatalf("Length mismatch: %d %d", got[i].Info.CaptureLength,
+                     got[i].Info.Length)
+        }
+    }
+}
+
+func TestReadNanosecond(t *testing.T) {
+    var out bytes.Buffer
+
+    dst, err := pcapng.NewWriter(&out)
+    if err != nil {
+        t.Fatalf("Error creating writer: %s", err)
+    }
+
+    err = dst.SetLinkType(packet.Eth)
+    if err != nil {
+        t.Fatalf("Error writing interface: %s", err)
+    }
+
+    ts   := time.Unix(1400000000, 123456789)
+    data := []byte{ 0x01, 0x02, 0x03 }
+
+    err = dst.WritePacketComment(data, capture.CaptureInfo{
+        Timestamp: ts,
+        Length:    len(data),
+    }, "comment")
+    if err != nil {
+        t.Fatalf("Error writing packet: %s", err)
+    }
+
+    r, err := pcapng.NewReader(&out)
+    if err != nil {
+        t.Fatalf("Error creating reader: %s", err)
+    }
+
+    pkts := read_all(t, r)
+    if len(pkts) != 1 || !bytes.Equal(pkts[0].Data, data) {
+        t.Fatalf("Packet mismatch: %v", pkts)
+    }
+
+    if !pkts[0].Info.Timestamp.Equal(ts) {
+        t.Fatalf("Timestamp mismatch: %s", pkts[0].Info.Timestamp)
+    }
+}
+
+/* Return a big endian block of the given type with the given fields */
+func make_block(block_type uint32, fields ...interface{}) []byte {
+    var body bytes.Buffer
+
+    for _, f := range fields {
+        binary.Write(&body, binary.BigEndian, f)
+    }
+
+    block_len := uint32(12 + body.Len())
+
+    var out bytes.Buffer
+
+    binary.Write(&out, binary.BigEndian, block_type)
+    binary.Write(&out, binary.BigEndian, block_len)
+    out.Write(body.Bytes())
+    binary.Write(&out, binary.BigEndian, block_len)
+
+    return out.Bytes()
+}
+
+func TestReadResolution(t *testing.T) {
+    var in bytes.Buffer
+
+    in.Write(make_block(0x0A0D0D0A,
+        uint32(0x1A2B3C4D), uint16(1), uint16(0), int64(-1)))
+
+    /* default (microsecond) resolution */
+    in.Write(make_block(1, uint16(1), uint16(0), uint32(0)))
+
+    /* 1/1024 second resolution, with a 10 second offset */
+    in.Write(make_block(1, uint16(1), uint16(0), uint32(0),
+        uint16(9), uint16(1), uint8(0x8A), [3]byte{},
+        uint16(14), uint16(8), int64(10),
+        uint16(0), uint16(0)))
+
+    usec := uint64(1400000000123456)
+    in.Write(make_block(6, uint32(0), uint32(usec >> 32), uint32(usec),
+        uint32(4), uint32(4), [4]byte{ 0xAA, 0xBB, 0xCC, 0xDD }))
+
+    ticks := uint64(5 * 1024 + 512)
+    in.Write(make_block(6, uint32(1), uint32(ticks >> 32), uint32(ticks),
+        uint32(4), uint32(8), [4]byte{ 0x01, 0x02, 0x03, 0x04 }))
+
+    /* name resolution blocks are skipped */
+    in.Write(make_block(4, uint16(0), uint16(0)))
+
+    in.Write(make_block(3, uint32(2), [4]byte{ 0x05, 0x06, 0x00, 0x00 }))
+
+    r, err := pcapng.NewReader(&in)
+    if err != nil {
+        t.Fatalf("Error creating reader: %s", err)
+    }
+
+    if r.LinkType() != packet.Eth {
+        t.Fatalf("Link type mismatch: %s", r.LinkType())
+    }
+
+    pkts := read_all(t, r)
+    if len(pkts) != 3 {
+        t.Fatalf("Packet count mismatch: %d", len(pkts))
+    }
+
+    if !pkts[0].Info.Timestamp.Equal(time.Unix(1400000000, 123456000)) {
+        t.Fatalf("Timestamp mismatch: %s", pkts[0].Info.Timestamp)
+    }
+
+    if !pkts[1].Info.Timestamp.Equal(time.Unix(15, 500000000)) {
+        t.Fatalf("Timestamp mismatch: %s", pkts[1].Info.Timestamp)
+    }
+
+    if pkts[1].Info.CaptureLength != 4 || pkts[1].Info.Length != 8 {
+        t.Fatalf("Length mismatch: %d %d", pkts[1].Info.CaptureLength,
+                 pkts[1].Info.Length)
+    }
+
+    if !bytes.Equal(pkts[2].Data, []byte{ 0x05, 0x06 }) ||
+       pkts[2].Info.Length != 2 {
+        t.Fatalf("Simple packet mismatch: %x", pkts[2].Data)
+    }
+}
+
+func TestReadInvalid(t *testing.T) {
+    _, err := pcapng.NewReader(bytes.NewReader(make_block(1,
+        uint16(1), uint16(0), uint32(0))))
+    if err == nil {
+        t.Fatalf("Invalid file accepted")
+    }
+}
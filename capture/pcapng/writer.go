@@ -0,0 +1,248 @@
+/*
+ * Network packet analysis framework.
+ *
+ * Copyright (c) 2014, Alessandro Ghedini
+ * All rights reserved.
+ *
+ * Redistribution and use in source and binary forms, with or without
+ * modification, are permitted provided that the following conditions are
+ * met:
+ *
+ *     * Redistributions of source code must retain the above copyright
+ *       notice, this list of conditions and the following disclaimer.
+ *
+ *     * Redistributions in binary form must reproduce the above copyright
+ *       notice, this list of conditions and the following disclaimer in the
+ *       documentation and/or other materials provided with the distribution.
+ *
+ * THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS
+ * IS" AND ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO,
+ * THE IMPLIED WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR
+ * PURPOSE ARE DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT HOLDER OR
+ * CONTRIBUTORS BE LIABLE FOR ANY DIRECT, INDIRECT, INCIDENTAL, SPECIAL,
+ * EXEMPLARY, OR CONSEQUENTIAL DAMAGES (INCLUDING, BUT NOT LIMITED TO,
+ * PROCUREMENT OF SUBSTITUTE GOODS OR SERVICES; LOSS OF USE, DATA, OR
+ * PROFITS; OR BUSINESS INTERRUPTION) HOWEVER CAUSED AND ON ANY THEORY OF
+ * LIABILITY, WHETHER IN CONTRACT, STRICT LIABILITY, OR TORT (INCLUDING
+ * NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE OF THIS
+ * SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+ */
+
+// Provides reading and writing of pcapng dump files, without requiring the
+// libpcap library.
+//
+// Files are written in the host byte order (little endian), with a single
+// section. Timestamps are stored with nanosecond resolution. Files in either
+// byte order, and with any timestamp resolution, can be read back.
+package pcapng
+
+import "encoding/binary"
+import "fmt"
+import "io"
+import "net"
+
+import "github.com/adigal150/go.pkt/capture"
+import "github.com/adigal150/go.pkt/packet"
+
+type Writer struct {
+    out        io.Writer
+    interfaces uint32
+}
+
+const (
+    section_header_block     = 0x0A0D0D0A
+    interface_desc_block     = 0x00000001
+    enhanced_packet_block    = 0x00000006
+    name_resolution_block    = 0x00000004
+
+    byte_order_magic         = 0x1A2B3C4D
+
+    opt_endofopt             = 0
+    opt_comment              = 1
+    opt_if_tsresol           = 9
+
+    nrb_record_end           = 0
+    nrb_record_ipv4          = 1
+    nrb_record_ipv6          = 2
+)
+
+// A name resolution record, mapping an address to one or more host names.
+type NameRecord struct {
+    Addr  net.IP
+    Names []string
+}
+
+// Create a new writer on the given output, and write the section header.
+func NewWriter(out io.Writer) (*Writer, error) {
+    w := &Writer{ out: out }
+
+    err := w.write_block(section_header_block, []interface{}{
+        uint32(byte_order_magic),
+        uint16(1), /* ver major */
+        uint16(0), /* ver minor */
+        int64(-1), /* section length (unspecified) */
+    })
+    if err != nil {
+        return nil, err
+    }
+
+    return w, nil
+}
+
+// Write a new interface description for the given link type. The packets
+// written after this will be associated with the new interface.
+func (w *Writer) SetLinkType(link_type packet.Type) error {
+    err := w.write_block(interface_desc_block, []interface{}{
+        uint16(link_type.ToLinkType()),
+        uint16(0), /* reserved */
+        uint32(0), /* snap length (unlimited) */
+        uint16(opt_if_tsresol), uint16(1), uint8(9), [3]byte{},
+        uint16(opt_endofopt), uint16(0),
+    })
+    if err != nil {
+        return err
+    }
+
+    w.interfaces++
+
+    return nil
+}
+
+// Write a packet with the given metadata, as an enhanced packet block. The
+// timestamp is stored with nanosecond resolution, so that no precision is lost
+// (e.g. when converting from microsecond resolution pcap files).
+func (w *Writer) WritePacket(buf []byte, info capture.CaptureInfo) error {
+    return w.write_packet(buf, info, nil)
+}
+
+// Write a packet with the given metadata, like WritePacket(), annotated with
+// the given comment (e.g. the result of an analysis), which is shown by tools
+// like Wireshark.
+func (w *Writer) WritePacketComment(buf []byte, info capture.CaptureInfo,
+                                    comment string) error {
+    if len(comment) > 0xFFFF {
+        return fmt.Errorf("Comment too long: %d", len(comment))
+    }
+
+    opts := append(encode_option(opt_comment, []byte(comment)),
+                   uint16(opt_endofopt), uint16(0))
+
+    return w.write_packet(buf, info, opts)
+}
+
+// Write a name resolution block with the given records, so that tools like
+// Wireshark show the host names instead of the addresses.
+func (w *Writer) WriteNameResolution(records []NameRecord) error {
+    var fields []interface{}
+
+    for _, r := range records {
+        var value []byte
+
+        record_type := uint16(nrb_record_ipv4)
+
+        if r.Addr.To4() != nil {
+            value = append(value, r.Addr.To4()...)
+        } else if r.Addr.To16() != nil {
+            value = append(value, r.Addr.To16()...)
+            record_type = nrb_record_ipv6
+        } else {
+            return fmt.Errorf("Invalid address: %s", r.Addr)
+        }
+
+        if len(r.Names) == 0 {
+            return fmt.Errorf("No names for address: %s", r.Addr)
+        }
+
+        for _, name := range r.Names {
+            value = append(value, name...)
+            value = append(value, 0x00)
+        }
+
+        if len(value) > 0xFFFF {
+            return fmt.Errorf("Too many names for address: %s", r.Addr)
+        }
+
+        fields = append(fields, encode_option(record_type, value)...)
+    }
+
+    fields = append(fields, uint16(nrb_record_end), uint16(0))
+
+    return w.write_block(name_resolution_block, fields)
+}
+
+func (w *Writer) write_packet(buf []byte, info capture.CaptureInfo,
+                              opts []interface{}) error {
+    if w.interfaces == 0 {
+        return fmt.Errorf("No interface description")
+    }
+
+    length := info.Length
+    if length < len(buf) {
+        length = len(buf)
+    }
+
+    ts := uint64(info.Timestamp.UnixNano())
+
+    fields := []interface{}{
+        uint32(w.interfaces - 1),
+        uint32(ts >> 32),
+        uint32(ts),
+        uint32(len(buf)),
+        uint32(length),
+        buf,
+        make([]byte, (4 - len(buf) % 4) % 4),
+    }
+
+    return w.write_block(enhanced_packet_block, append(fields, opts...))
+}
+
+/* Return the fields of an option (or name resolution record) with the given
+ * code and value, padded to 32 bits */
+func encode_option(code uint16, value []byte) []interface{} {
+    return []interface{}{
+        code,
+        uint16(len(value)),
+        value,
+        make([]byte, (4 - len(value) % 4) % 4),
+    }
+}
+
+func (w *Writer) write_block(block_type uint32, fields []interface{}) error {
+    body_len := 0
+
+    for _, f := range fields {
+        if b, ok := f.([]byte); ok {
+            body_len += len(b)
+        } else {
+            body_len += binary.Size(f)
+        }
+    }
+
+    block_len := uint32(12 + body_len)
+
+    buf := packet.NewBuffer(int(block_len))
+
+    buf.WriteL(block_type)
+    buf.WriteL(block_len)
+
+    for _, f := range fields {
+        if b, ok := f.([]byte); ok {
+            buf.Write(b)
+        } else {
+            buf.WriteL(f)
+        }
+    }
+
+    buf.WriteL(block_len)
+
+    if buf.Err() != nil {
+        return buf.Err()
+    }
+
+    _, err := w.out.Write(buf.Buffer())
+    if err != nil {
+        return fmt.Errorf("Could not write block: %s", err)
+    }
+
+    return nil
+}
@@ -0,0 +1,230 @@
+/*
+ * Network packet analysis framework.
+ *
+ * Copyright (c) 2014, Alessandro Ghedini
+ * All rights reserved.
+ *
+ * Redistribution and use in source and binary forms, with or without
+ * modification, are permitted provided that the following conditions are
+ * met:
+ *
+ *     * Redistributions of source code must retain the above copyright
+ *       notice, this list of conditions and the following disclaimer.
+ *
+ *     * Redistributions in binary form must reproduce the above copyright
+ *       notice, this list of conditions and the following disclaimer in the
+ *       documentation and/or other materials provided with the distribution.
+ *
+ * THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS
+ * IS" AND ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO,
+ * THE IMPLIED WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR
+ * PURPOSE ARE DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT HOLDER OR
+ * CONTRIBUTORS BE LIABLE FOR ANY DIRECT, INDIRECT, INCIDENTAL, SPECIAL,
+ * EXEMPLARY, OR CONSEQUENTIAL DAMAGES (INCLUDING, BUT NOT LIMITED TO,
+ * PROCUREMENT OF SUBSTITUTE GOODS OR SERVICES; LOSS OF USE, DATA, OR
+ * PROFITS; OR BUSINESS INTERRUPTION) HOWEVER CAUSED AND ON ANY THEORY OF
+ * LIABILITY, WHETHER IN CONTRACT, STRICT LIABILITY, OR TORT (INCLUDING
+ * NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE OF THIS
+ * SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+ */
+
+package pcapng_test
+
+import "bytes"
+import "encoding/binary"
+import "net"
+import "testing"
+import "time"
+
+import "github.com/adigal150/go.pkt/capture"
+import "github.com/adigal150/go.pkt/capture/file"
+import "github.com/adigal150/go.pkt/capture/pcapng"
+import "github.com/adigal150/go.pkt/packet"
+
+type block struct {
+    Type uint32
+    Body []byte
+}
+
+func read_blocks(t *testing.T, data []byte) []block {
+    var blocks []block
+
+    for len(data) > 0 {
+        if len(data) < 12 {
+            t.Fatalf("Truncated block: %x", data)
+        }
+
+        block_type := binary.LittleEndian.Uint32(data[0:4])
+        block_len  := int(binary.LittleEndian.Uint32(data[4:8]))
+
+        if block_len < 12 || block_len % 4 != 0 || block_len > len(data) ||
+           binary.LittleEndian.Uint32(data[block_len - 4:]) != uint32(block_len) {
+            t.Fatalf("Invalid block length: %d", block_len)
+        }
+
+        blocks = append(blocks, block{ block_type, data[8:block_len - 4] })
+        data = data[block_len:]
+    }
+
+    return blocks
+}
+
+func TestConvert(t *testing.T) {
+    src, err := file.Open("writer_test.pcap")
+    if err != nil {
+        t.Fatalf("Error opening: %s", err)
+    }
+    defer src.Close()
+
+    var out bytes.Buffer
+
+    dst, err := pcapng.NewWriter(&out)
+    if err != nil {
+        t.Fatalf("Error creating writer: %s", err)
+    }
+
+    err = capture.Convert(src, dst)
+    if err != nil {
+        t.Fatalf("Error converting: %s", err)
+    }
+
+    blocks := read_blocks(t, out.Bytes())
+    if len(blocks) != 5 {
+        t.Fatalf("Block count mismatch: %d", len(blocks))
+    }
+
+    if blocks[0].Type != 0x0A0D0D0A ||
+       binary.LittleEndian.Uint32(blocks[0].Body) != 0x1A2B3C4D {
+        t.Fatalf("Invalid section header: %x", blocks[0].Body)
+    }
+
+    idb := blocks[1]
+    if idb.Type != 1 || binary.LittleEndian.Uint16(idb.Body) != 1 {
+        t.Fatalf("Invalid interface description: %x", idb.Body)
+    }
+
+    tsresol := []byte{ 0x09, 0x00, 0x01, 0x00, 0x09, 0x00, 0x00, 0x00 }
+    if !bytes.Equal(idb.Body[8:16], tsresol) {
+        t.Fatalf("Invalid timestamp resolution: %x", idb.Body[8:16])
+    }
+
+    for i, b := range blocks[2:] {
+        caplen  := binary.LittleEndian.Uint32(b.Body[12:16])
+        wirelen := binary.LittleEndian.Uint32(b.Body[16:20])
+
+        if b.Type != 6 || caplen != uint32(42 + i) || wirelen != caplen + 4 {
+            t.Fatalf("Invalid packet block: %x", b.Body)
+        }
+    }
+
+    epb := blocks[2].Body
+    ts  := uint64(binary.LittleEndian.Uint32(epb[4:8])) << 32 |
+           uint64(binary.LittleEndian.Uint32(epb[8:12]))
+
+    first := time.Unix(1400000000, 123456000)
+    if ts != uint64(first.UnixNano()) {
+        t.Fatalf("Timestamp mismatch: %d", ts)
+    }
+}
+
+func TestWritePacketNoInterface(t *testing.T) {
+    var out bytes.Buffer
+
+    dst, err := pcapng.NewWriter(&out)
+    if err != nil {
+        t.Fatalf("Error creating writer: %s", err)
+    }
+
+    err = dst.WritePacket([]byte{ 0x00 }, capture.CaptureInfo{})
+    if err == nil {
+        t.Fatalf("Packet written without interface")
+    }
+}
+
+/* Return the options (or name resolution records) in the given data */
+func read_options(t *testing.T, body []byte) map[uint16][]byte {
+    opts := map[uint16][]byte{}
+
+    for len(body) >= 4 {
+        code := binary.LittleEndian.Uint16(body[0:2])
+        size := int(binary.LittleEndian.Uint16(body[2:4]))
+
+        if code == 0 {
+            break
+        }
+
+        padded := 4 + (size + 3) / 4 * 4
+        if padded > len(body) {
+            t.Fatalf("Truncated option: %x", body)
+        }
+
+        opts[code] = body[4:4 + size]
+        body = body[padded:]
+    }
+
+    return opts
+}
+
+func TestWritePacketComment(t *testing.T) {
+    var out bytes.Buffer
+
+    dst, err := pcapng.NewWriter(&out)
+    if err != nil {
+        t.Fatalf("Error creating writer: %s", err)
+    }
+
+    err = dst.SetLinkType(packet.Eth)
+    if err != nil {
+        t.Fatalf("Error writing interface: %s", err)
+    }
+
+    data := []byte{ 0x01, 0x02, 0x03, 0x04, 0x05 }
+
+    err = dst.WritePacketComment(data, capture.CaptureInfo{
+        Timestamp: time.Unix(1400000000, 0),
+        Length:    len(data),
+    }, "suspicious packet")
+    if err != nil {
+        t.Fatalf("Error writing packet: %s", err)
+    }
+
+    err = dst.WriteNameResolution([]pcapng.NameRecord{
+        { Addr: net.ParseIP("192.168.1.1"), Names: []string{ "gateway" } },
+        { Addr: net.ParseIP("fe80::1"), Names: []string{ "a", "b" } },
+    })
+    if err != nil {
+        t.Fatalf("Error writing names: %s", err)
+    }
+
+    blocks := read_blocks(t, out.Bytes())
+    if len(blocks) != 4 {
+        t.Fatalf("Block count mismatch: %d", len(blocks))
+    }
+
+    epb := blocks[2]
+    if epb.Type != 6 || !bytes.Equal(epb.Body[20:25], data) {
+        t.Fatalf("Invalid packet block: %x", epb.Body)
+    }
+
+    opts := read_options(t, epb.Body[28:])
+    if string(opts[1]) != "suspicious packet" {
+        t.Fatalf("Comment mismatch: %q", opts[1])
+    }
+
+    nrb := blocks[3]
+    if nrb.Type != 4 {
+        t.Fatalf("Invalid name resolution block: %x", nrb.Body)
+    }
+
+    records := read_options(t, nrb.Body)
+
+    ipv4_rec := append(net.IP{ 192, 168, 1, 1 }, "gateway\x00"...)
+    if !bytes.Equal(records[1], ipv4_rec) {
+        t.Fatalf("IPv4 record mismatch: %x", records[1])
+    }
+
+    ipv6_rec := append(net.ParseIP("fe80::1"), "a\x00b\x00"...)
+    if !bytes.Equal(records[2], ipv6_rec) {
+        t.Fatalf("IPv6 record mismatch: %x", records[2])
+    }
+}
@@ -0,0 +1,129 @@
+/*
+ * Network packet analysis framework.
+ *
+ * Copyright (c) 2014, Alessandro Ghedini
+ * All rights reserved.
+ *
+ * Redistribution and use in source and binary forms, with or without
+ * modification, are permitted provided that the following conditions are
+ * met:
+ *
+ *     * Redistributions of source code must retain the above copyright
+ *       notice, this list of conditions and the following disclaimer.
+ *
+ *     * Redistributions in binary form must reproduce the above copyright
+ *       notice, this list of conditions and the following disclaimer in the
+ *       documentation and/or other materials provided with the distribution.
+ *
+ * THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS
+ * IS" AND ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO,
+ * THE IMPLIED WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR
+ * PURPOSE ARE DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT HOLDER OR
+ * CONTRIBUTORS BE LIABLE FOR ANY DIRECT, INDIRECT, INCIDENTAL, SPECIAL,
+ * EXEMPLARY, OR CONSEQUENTIAL DAMAGES (INCLUDING, BUT NOT LIMITED TO,
+ * PROCUREMENT OF SUBSTITUTE GOODS OR SERVICES; LOSS OF USE, DATA, OR
+ * PROFITS; OR BUSINESS INTERRUPTION) HOWEVER CAUSED AND ON ANY THEORY OF
+ * LIABILITY, WHETHER IN CONTRACT, STRICT LIABILITY, OR TORT (INCLUDING
+ * NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE OF THIS
+ * SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+ */
+
+package capture
+
+import "sync"
+
+import "github.com/adigal150/go.pkt/packet"
+
+// RingBuffer keeps the most recent packets added to it, up to a fixed number,
+// e.g. to dump the traffic that preceded some event. Packets can be added by a
+// single goroutine and dumped concurrently by others.
+type RingBuffer struct {
+    mutex     sync.Mutex
+    link_type packet.Type
+    bufs      [][]byte
+    infos     []CaptureInfo
+    next      int
+    count     int
+}
+
+// Create a new ring buffer that keeps up to size packets of the given link
+// type.
+func NewRingBuffer(size int, link_type packet.Type) *RingBuffer {
+    return &RingBuffer{
+        link_type: link_type,
+        bufs:      make([][]byte, size),
+        infos:     make([]CaptureInfo, size),
+    }
+}
+
+// Add a copy of the given packet, captured with the given metadata, replacing
+// the oldest one if the buffer is full.
+func (r *RingBuffer) Add(buf []byte, info CaptureInfo) {
+    if len(r.bufs) == 0 {
+        return
+    }
+
+    /* packets are copied to fresh slices, so that dumps don't see them
+     * change while they are being written */
+    buf = append([]byte(nil), buf...)
+
+    r.mutex.Lock()
+    defer r.mutex.Unlock()
+
+    r.bufs[r.next]  = buf
+    r.infos[r.next] = info
+
+    r.next = (r.next + 1) % len(r.bufs)
+
+    if r.count < len(r.bufs) {
+        r.count++
+    }
+}
+
+// Read all the packets from the given source (see Each()) and add them.
+func (r *RingBuffer) Consume(in Reader) error {
+    return Each(in, func(buf []byte, info CaptureInfo) error {
+        r.Add(buf, info)
+        return nil
+    })
+}
+
+// Return the number of packets currently stored.
+func (r *RingBuffer) Len() int {
+    r.mutex.Lock()
+    defer r.mutex.Unlock()
+
+    return r.count
+}
+
+// Write the packets currently stored to the given sink, oldest first. Packets
+// added while the dump is in progress are not written.
+func (r *RingBuffer) Dump(out Writer) error {
+    r.mutex.Lock()
+
+    bufs  := make([][]byte, r.count)
+    infos := make([]CaptureInfo, r.count)
+
+    for i := 0; i < r.count; i++ {
+        slot := (r.next - r.count + i + len(r.bufs)) % len(r.bufs)
+
+        bufs[i]  = r.bufs[slot]
+        infos[i] = r.infos[slot]
+    }
+
+    r.mutex.Unlock()
+
+    err := out.SetLinkType(r.link_type)
+    if err != nil {
+        return err
+    }
+
+    for i := range bufs {
+        err := out.WritePacket(bufs[i], infos[i])
+        if err != nil {
+            return err
+        }
+    }
+
+    return nil
+}
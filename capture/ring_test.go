@@ -0,0 +1,121 @@
+/*
+ * Network packet analysis framework.
+ *
+ * Copyright (c) 2014, Alessandro Ghedini
+ * All rights reserved.
+ *
+ * Redistribution and use in source and binary forms, with or without
+ * modification, are permitted provided that the following conditions are
+ * met:
+ *
+ *     * Redistributions of source code must retain the above copyright
+ *       notice, this list of conditions and the following disclaimer.
+ *
+ *     * Redistributions in binary form must reproduce the above copyright
+ *       notice, this list of conditions and the following disclaimer in the
+ *       documentation and/or other materials provided with the distribution.
+ *
+ * THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS
+ * IS" AND ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO,
+ * THE IMPLIED WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR
+ * PURPOSE ARE DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT HOLDER OR
+ * CONTRIBUTORS BE LIABLE FOR ANY DIRECT, INDIRECT, INCIDENTAL, SPECIAL,
+ * EXEMPLARY, OR CONSEQUENTIAL DAMAGES (INCLUDING, BUT NOT LIMITED TO,
+ * PROCUREMENT OF SUBSTITUTE GOODS OR SERVICES; LOSS OF USE, DATA, OR
+ * PROFITS; OR BUSINESS INTERRUPTION) HOWEVER CAUSED AND ON ANY THEORY OF
+ * LIABILITY, WHETHER IN CONTRACT, STRICT LIABILITY, OR TORT (INCLUDING
+ * NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE OF THIS
+ * SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+ */
+
+package capture_test
+
+import "sync"
+import "testing"
+import "time"
+
+import "github.com/adigal150/go.pkt/capture"
+import "github.com/adigal150/go.pkt/packet"
+
+type test_writer struct {
+    link_type packet.Type
+    bufs      [][]byte
+    infos     []capture.CaptureInfo
+}
+
+func (w *test_writer) SetLinkType(link_type packet.Type) error {
+    w.link_type = link_type
+    return nil
+}
+
+func (w *test_writer) WritePacket(buf []byte, info capture.CaptureInfo) error {
+    w.bufs  = append(w.bufs, buf)
+    w.infos = append(w.infos, info)
+    return nil
+}
+
+func TestRingBuffer(t *testing.T) {
+    r := capture.NewRingBuffer(3, packet.Eth)
+
+    buf := make([]byte, 1)
+
+    for i := 0; i < 5; i++ {
+        buf[0] = byte(i)
+
+        r.Add(buf, capture.CaptureInfo{
+            Timestamp: time.Unix(int64(i), 0),
+            CaptureLength: 1,
+            Length: 1,
+        })
+    }
+
+    if r.Len() != 3 {
+        t.Fatalf("Packet count mismatch: %d", r.Len())
+    }
+
+    w := &test_writer{}
+
+    err := r.Dump(w)
+    if err != nil {
+        t.Fatalf("Error dumping: %s", err)
+    }
+
+    if w.link_type != packet.Eth || len(w.bufs) != 3 {
+        t.Fatalf("Dump mismatch: %s %d", w.link_type, len(w.bufs))
+    }
+
+    for i, buf := range w.bufs {
+        if buf[0] != byte(i + 2) || w.infos[i].Timestamp.Unix() != int64(i + 2) {
+            t.Fatalf("Packet mismatch: %x %s", buf, w.infos[i].Timestamp)
+        }
+    }
+}
+
+func TestRingBufferConcurrentDump(t *testing.T) {
+    r := capture.NewRingBuffer(16, packet.Eth)
+
+    var wg sync.WaitGroup
+
+    for i := 0; i < 4; i++ {
+        wg.Add(1)
+
+        go func() {
+            defer wg.Done()
+
+            for n := 0; n < 100; n++ {
+                w := &test_writer{}
+                r.Dump(w)
+
+                if len(w.bufs) > 16 {
+                    t.Errorf("Packet count mismatch: %d", len(w.bufs))
+                }
+            }
+        }()
+    }
+
+    for n := 0; n < 1000; n++ {
+        r.Add([]byte{ byte(n) }, capture.CaptureInfo{ CaptureLength: 1 })
+    }
+
+    wg.Wait()
+}
@@ -0,0 +1,408 @@
+/*
+ * Network packet analysis framework.
+ *
+ * Copyright (c) 2014, Alessandro Ghedini
+ * All rights reserved.
+ *
+ * Redistribution and use in source and binary forms, with or without
+ * modification, are permitted provided that the following conditions are
+ * met:
+ *
+ *     * Redistributions of source code must retain the above copyright
+ *       notice, this list of conditions and the following disclaimer.
+ *
+ *     * Redistributions in binary form must reproduce the above copyright
+ *       notice, this list of conditions and the following disclaimer in the
+ *       documentation and/or other materials provided with the distribution.
+ *
+ * THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS
+ * IS" AND ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO,
+ * THE IMPLIED WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR
+ * PURPOSE ARE DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT HOLDER OR
+ * CONTRIBUTORS BE LIABLE FOR ANY DIRECT, INDIRECT, INCIDENTAL, SPECIAL,
+ * EXEMPLARY, OR CONSEQUENTIAL DAMAGES (INCLUDING, BUT NOT LIMITED TO,
+ * PROCUREMENT OF SUBSTITUTE GOODS OR SERVICES; LOSS OF USE, DATA, OR
+ * PROFITS; OR BUSINESS INTERRUPTION) HOWEVER CAUSED AND ON ANY THEORY OF
+ * LIABILITY, WHETHER IN CONTRACT, STRICT LIABILITY, OR TORT (INCLUDING
+ * NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE OF THIS
+ * SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+ */
+
+// Provides packet capturing from and injection to arbitrary streams (e.g. pipes
+// or in-memory buffers), without requiring a network interface. This is mostly
+// useful for testing and for piping packets between tools.
+//
+// Streams either contain raw frames, each prefixed by its length as a 32-bit
+// integer in network byte order, or the content of a pcap dump file.
+package stream
+
+import "bytes"
+import "encoding/binary"
+import "fmt"
+import "io"
+import "time"
+
+import "github.com/adigal150/go.pkt/capture"
+import "github.com/adigal150/go.pkt/capture/file"
+import "github.com/adigal150/go.pkt/filter"
+import "github.com/adigal150/go.pkt/packet"
+
+type Handle struct {
+    in      io.Reader
+    out     io.Writer
+    format  Format
+    order   binary.ByteOrder
+    link    uint32
+    nano    bool
+    filter  *filter.Filter
+    started bool
+}
+
+// Format of the packets in a stream.
+type Format uint8
+
+const (
+    Raw Format = iota
+    PCAP
+)
+
+// Create a new capture handle reading from the given stream. The link type is
+// used for the packets of raw streams, while for pcap streams the one from the
+// dump file header is used, unless the given one is not packet.None.
+func Open(in io.Reader, format Format, link_type packet.Type) (*Handle, error) {
+    h := &Handle{
+        in:     in,
+        format: format,
+        order:  binary.BigEndian,
+        link:   link_type.ToLinkType(),
+    }
+
+    switch format {
+    case Raw:
+
+    case PCAP:
+        err := h.read_header()
+        if err != nil {
+            return nil, err
+        }
+
+        if link_type != packet.None {
+            h.link = link_type.ToLinkType()
+        }
+
+    default:
+        return nil, fmt.Errorf("Invalid stream format: %d", format)
+    }
+
+    return h, nil
+}
+
+// Create a new capture handle writing the injected packets to the given stream,
+// with the given link type. The pcap dump file header is written together with
+// the first packet, so that the link type can still be changed until then (see
+// SetLinkType()). Nothing can be captured from the returned handle.
+func Create(out io.Writer, format Format, link_type packet.Type) (*Handle, error) {
+    if format != Raw && format != PCAP {
+        return nil, fmt.Errorf("Invalid stream format: %d", format)
+    }
+
+    h := &Handle{
+        out:    out,
+        format: format,
+        order:  binary.BigEndian,
+        link:   link_type.ToLinkType(),
+    }
+
+    return h, nil
+}
+
+func (h *Handle) read_header() error {
+    hdr := make([]byte, 24)
+
+    _, err := io.ReadFull(h.in, hdr)
+    if err != nil {
+        return fmt.Errorf("Could not read header: %s", err)
+    }
+
+    switch magic := hdr[:4]; {
+    case bytes.Equal(magic, file.BigEndian):
+        h.order = binary.BigEndian
+
+    case bytes.Equal(magic, file.LittleEndian):
+        h.order = binary.LittleEndian
+
+    case bytes.Equal(magic, file.NanoBigEndian):
+        h.order = binary.BigEndian
+        h.nano  = true
+
+    case bytes.Equal(magic, file.NanoLittleEndian):
+        h.order = binary.LittleEndian
+        h.nano  = true
+
+    default:
+        return fmt.Errorf("Invalid file")
+    }
+
+    h.link = h.order.Uint32(hdr[20:24])
+
+    return nil
+}
+
+// Return the link type of the capture handle (that is, the type of packets that
+// come out of the packet source).
+func (h *Handle) LinkType() packet.Type {
+    return packet.LinkType(h.link)
+}
+
+// Return the PCAP link type (DLT) of the stream.
+func (h *Handle) DataLink() uint32 {
+    return h.link
+}
+
+// Not supported.
+func (h *Handle) SetMTU(mtu int) error {
+    return fmt.Errorf("Unsupported")
+}
+
+// Not supported.
+func (h *Handle) SetSnapLen(snaplen int) error {
+    return fmt.Errorf("Unsupported")
+}
+
+// Not supported.
+func (h *Handle) SetPromiscMode(promisc bool) error {
+    return fmt.Errorf("Unsupported")
+}
+
+// Not supported.
+func (h *Handle) SetMonitorMode(monitor bool) error {
+    return fmt.Errorf("Unsupported")
+}
+
+// Set the read timeout (this has no effect on the stream capture handle, since
+// reads block until the stream provides a packet).
+func (h *Handle) SetReadTimeout(timeout time.Duration) error {
+    return nil
+}
+
+// Enable/disable immediate mode (this is not needed for the stream capture
+// handle, since packets are read from the stream one at a time).
+func (h *Handle) SetImmediate(immediate bool) error {
+    return nil
+}
+
+// Apply the given filter it to the packet source. Only packets that match this
+// filter will be captured.
+func (h *Handle) ApplyFilter(filter *filter.Filter) error {
+    if !filter.Validate() {
+        return fmt.Errorf("Invalid filter")
+    }
+
+    h.filter = filter
+    return nil
+}
+
+// Compile the given tcpdump-like expression and apply it to the packet source,
+// like ApplyFilter().
+func (h *Handle) SetFilter(expr string) error {
+    flt, err := filter.Compile(expr, h.LinkType(), 0, true)
+    if err != nil {
+        return fmt.Errorf("Could not compile filter '%s': %s", expr, err)
+    }
+
+    return h.ApplyFilter(flt)
+}
+
+// Activate the capture handle (this is not needed for the stream capture
+// handle, but you may want to call it anyway in order to make switching to
+// different packet sources easier).
+func (h *Handle) Activate() error {
+    return nil
+}
+
+// Capture a single packet from the packet source. If no packet is available
+// (i.e. if the end of the stream has been reached) it will return a nil slice.
+func (h *Handle) Capture() ([]byte, error) {
+    buf, _, err := h.CaptureWithInfo()
+    return buf, err
+}
+
+// Capture a single packet from the packet source, like Capture(), and also
+// return its metadata. The timestamps of packets read from raw streams are the
+// times they were read at.
+func (h *Handle) CaptureWithInfo() ([]byte, capture.CaptureInfo, error) {
+    for {
+        buf, info, err := h.read_packet()
+        if err != nil || buf == nil {
+            return nil, info, err
+        }
+
+        if h.filter != nil && !h.filter.Match(buf) {
+            continue
+        }
+
+        return buf, info, nil
+    }
+}
+
+func (h *Handle) read_packet() ([]byte, capture.CaptureInfo, error) {
+    var info capture.CaptureInfo
+
+    if h.in == nil {
+        return nil, info, nil
+    }
+
+    hdr_len := 4
+    if h.format == PCAP {
+        hdr_len = 16
+    }
+
+    hdr := make([]byte, hdr_len)
+
+    _, err := io.ReadFull(h.in, hdr)
+    if err == io.EOF {
+        return nil, info, nil
+    }
+
+    if err != nil {
+        return nil, info, fmt.Errorf("Could not capture: %s", err)
+    }
+
+    var caplen, wirelen uint32
+
+    if h.format == PCAP {
+        sec  := h.order.Uint32(hdr[0:4])
+        nsec := int64(h.order.Uint32(hdr[4:8]))
+
+        if !h.nano {
+            nsec *= 1000
+        }
+
+        info.Timestamp = time.Unix(int64(sec), nsec)
+
+        caplen  = h.order.Uint32(hdr[8:12])
+        wirelen = h.order.Uint32(hdr[12:16])
+    } else {
+        info.Timestamp = time.Now()
+
+        caplen  = binary.BigEndian.Uint32(hdr)
+        wirelen = caplen
+    }
+
+    if caplen > 0x40000 {
+        return nil, info, fmt.Errorf("Invalid packet length: %d", caplen)
+    }
+
+    buf := make([]byte, caplen)
+
+    _, err = io.ReadFull(h.in, buf)
+    if err != nil {
+        return nil, info, fmt.Errorf("Could not capture: %s", err)
+    }
+
+    info.CaptureLength = int(caplen)
+    info.Length        = int(wirelen)
+
+    return buf, info, nil
+}
+
+// Inject a packet in the packet source, by writing it to the output stream with
+// the current time as timestamp. This is only supported by handles created with
+// Create().
+func (h *Handle) Inject(buf []byte) error {
+    info := capture.CaptureInfo{ Timestamp: time.Now(), Length: len(buf) }
+
+    return h.WritePacket(buf, info)
+}
+
+// Set the link type of the packets written to the output stream. For pcap
+// streams, this is only possible as long as no packet has been written.
+func (h *Handle) SetLinkType(link_type packet.Type) error {
+    link := link_type.ToLinkType()
+    if link == h.link {
+        return nil
+    }
+
+    if h.started && h.format == PCAP {
+        return fmt.Errorf("Could not set link type: stream not empty")
+    }
+
+    h.link = link
+    return nil
+}
+
+// Write a packet to the output stream, with the timestamp and length recorded
+// in the given metadata (for pcap streams). If the length is lower than the
+// length of the packet data, the latter is used.
+func (h *Handle) WritePacket(buf []byte, info capture.CaptureInfo) error {
+    if h.out == nil {
+        return fmt.Errorf("Unsupported")
+    }
+
+    size := 4 + len(buf)
+
+    if h.format == PCAP {
+        size += 12
+
+        if !h.started {
+            size += 24
+        }
+    }
+
+    var out packet.Buffer
+    out.Init(make([]byte, size))
+
+    if h.format == PCAP {
+        if !h.started {
+            out.Write(file.BigEndian)
+            out.WriteN(uint16(2), uint16(4), uint32(0), uint32(0))
+            out.WriteN(uint32(0x7fff), h.link)
+        }
+
+        var sec, usec uint32
+
+        if !info.Timestamp.IsZero() {
+            sec  = uint32(info.Timestamp.Unix())
+            usec = uint32(info.Timestamp.Nanosecond() / 1000)
+        }
+
+        wirelen := uint32(info.Length)
+        if wirelen < uint32(len(buf)) {
+            wirelen = uint32(len(buf))
+        }
+
+        out.WriteN(sec, usec, uint32(len(buf)), wirelen)
+    } else {
+        out.WriteN(uint32(len(buf)))
+    }
+
+    out.Write(buf)
+
+    if out.Err() != nil {
+        return out.Err()
+    }
+
+    _, err := h.out.Write(out.Buffer())
+    if err != nil {
+        return fmt.Errorf("Could not write packet: %s", err)
+    }
+
+    h.started = true
+    return nil
+}
+
+// Not supported.
+func (h *Handle) Stats() (capture.Stats, error) {
+    return capture.Stats{}, fmt.Errorf("Unsupported")
+}
+
+// Close the packet source, if the stream implements io.Closer.
+func (h *Handle) Close() {
+    if c, ok := h.in.(io.Closer); ok {
+        c.Close()
+    }
+
+    if c, ok := h.out.(io.Closer); ok {
+        c.Close()
+    }
+}
@@ -0,0 +1,237 @@
+/*
+ * Network packet analysis framework.
+ *
+ * Copyright (c) 2014, Alessandro Ghedini
+ * All rights reserved.
+ *
+ * Redistribution and use in source and binary forms, with or without
+ * modification, are permitted provided that the following conditions are
+ * met:
+ *
+ *     * Redistributions of source code must retain the above copyright
+ *       notice, this list of conditions and the following disclaimer.
+ *
+ *     * Redistributions in binary form must reproduce the above copyright
+ *       notice, this list of conditions and the following disclaimer in the
+ *       documentation and/or other materials provided with the distribution.
+ *
+ * THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS
+ * IS" AND ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO,
+ * THE IMPLIED WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR
+ * PURPOSE ARE DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT HOLDER OR
+ * CONTRIBUTORS BE LIABLE FOR ANY DIRECT, INDIRECT, INCIDENTAL, SPECIAL,
+ * EXEMPLARY, OR CONSEQUENTIAL DAMAGES (INCLUDING, BUT NOT LIMITED TO,
+ * PROCUREMENT OF SUBSTITUTE GOODS OR SERVICES; LOSS OF USE, DATA, OR
+ * PROFITS; OR BUSINESS INTERRUPTION) HOWEVER CAUSED AND ON ANY THEORY OF
+ * LIABILITY, WHETHER IN CONTRACT, STRICT LIABILITY, OR TORT (INCLUDING
+ * NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE OF THIS
+ * SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+ */
+
+package stream_test
+
+import "bytes"
+import "encoding/binary"
+import "net"
+import "os"
+import "testing"
+
+import "github.com/adigal150/go.pkt/capture"
+import "github.com/adigal150/go.pkt/capture/stream"
+import "github.com/adigal150/go.pkt/layers"
+import "github.com/adigal150/go.pkt/packet"
+import "github.com/adigal150/go.pkt/packet/eth"
+import "github.com/adigal150/go.pkt/packet/ipv4"
+import "github.com/adigal150/go.pkt/packet/udp"
+
+func make_frame(t *testing.T, port uint16) []byte {
+    ip4_pkt := ipv4.Make()
+    ip4_pkt.SrcAddr = net.ParseIP("192.168.1.1")
+    ip4_pkt.DstAddr = net.ParseIP("192.168.1.2")
+
+    udp_pkt := udp.Make()
+    udp_pkt.SrcPort = 41562
+    udp_pkt.DstPort = port
+
+    buf, err := layers.Pack(eth.Make(), ip4_pkt, udp_pkt)
+    if err != nil {
+        t.Fatalf("Error packing: %s", err)
+    }
+
+    return buf
+}
+
+func TestCaptureRaw(t *testing.T) {
+    var in bytes.Buffer
+
+    for _, port := range []uint16{ 53, 123, 161 } {
+        frame := make_frame(t, port)
+
+        binary.Write(&in, binary.BigEndian, uint32(len(frame)))
+        in.Write(frame)
+    }
+
+    src, err := stream.Open(&in, stream.Raw, packet.Eth)
+    if err != nil {
+        t.Fatalf("Error opening: %s", err)
+    }
+    defer src.Close()
+
+    var ports []uint16
+
+    err = capture.EachPacket(src,
+        func(pkt packet.Packet, info capture.CaptureInfo) error {
+            udp_pkt := layers.FindLayer(pkt, packet.UDP)
+            if udp_pkt == nil {
+                t.Fatalf("UDP layer not found: %s", pkt)
+            }
+
+            if info.CaptureLength != 42 || info.Length != 42 {
+                t.Fatalf("Length mismatch: %v", info)
+            }
+
+            ports = append(ports, udp_pkt.(*udp.Packet).DstPort)
+            return nil
+        })
+    if err != nil {
+        t.Fatalf("Error reading: %s", err)
+    }
+
+    if len(ports) != 3 || ports[0] != 53 || ports[2] != 161 {
+        t.Fatalf("Ports mismatch: %v", ports)
+    }
+}
+
+func TestCaptureRawTruncated(t *testing.T) {
+    in := bytes.NewReader([]byte{ 0x00, 0x00, 0x00, 0x10, 0x01, 0x02 })
+
+    src, err := stream.Open(in, stream.Raw, packet.Eth)
+    if err != nil {
+        t.Fatalf("Error opening: %s", err)
+    }
+
+    if _, err := src.Capture(); err == nil {
+        t.Fatalf("Truncated packet not detected")
+    }
+}
+
+func TestCapturePCAP(t *testing.T) {
+    data, err := os.ReadFile("../file/capture_test.pcap")
+    if err != nil {
+        t.Fatalf("Error reading: %s", err)
+    }
+
+    src, err := stream.Open(bytes.NewReader(data), stream.PCAP, packet.None)
+    if err != nil {
+        t.Fatalf("Error opening: %s", err)
+    }
+
+    if src.LinkType() != packet.Eth {
+        t.Fatalf("Link type mismatch: %s", src.LinkType())
+    }
+
+    var count int
+
+    err = capture.EachPacket(src,
+        func(pkt packet.Packet, info capture.CaptureInfo) error {
+            if pkt.GetType() != packet.Eth || info.Timestamp.IsZero() {
+                t.Fatalf("Packet mismatch: %s", pkt)
+            }
+
+            count++
+            return nil
+        })
+    if err != nil {
+        t.Fatalf("Error reading: %s", err)
+    }
+
+    if count != 16 {
+        t.Fatalf("Count mismatch: %d", count)
+    }
+
+    _, err = stream.Open(bytes.NewReader(data[4:]), stream.PCAP, packet.None)
+    if err == nil {
+        t.Fatalf("Invalid header not detected")
+    }
+}
+
+func TestInject(t *testing.T) {
+    var out bytes.Buffer
+
+    dst, err := stream.Create(&out, stream.PCAP, packet.Eth)
+    if err != nil {
+        t.Fatalf("Error creating: %s", err)
+    }
+
+    var frames [][]byte
+
+    for _, port := range []uint16{ 53, 123, 161 } {
+        frame := make_frame(t, port)
+
+        err := dst.Inject(frame)
+        if err != nil {
+            t.Fatalf("Error injecting: %s", err)
+        }
+
+        frames = append(frames, frame)
+    }
+
+    if dst.SetLinkType(packet.IPv4) == nil {
+        t.Fatalf("Link type changed after writing")
+    }
+
+    src, err := stream.Open(&out, stream.PCAP, packet.None)
+    if err != nil {
+        t.Fatalf("Error opening: %s", err)
+    }
+
+    if src.LinkType() != packet.Eth {
+        t.Fatalf("Link type mismatch: %s", src.LinkType())
+    }
+
+    var count int
+
+    err = capture.EachPacket(src,
+        func(pkt packet.Packet, info capture.CaptureInfo) error {
+            sent, _ := layers.UnpackAll(frames[count], packet.Eth)
+
+            if !pkt.Equals(sent) || !pkt.Payload().Equals(sent.Payload()) ||
+               !layers.FindLayer(pkt, packet.UDP).Equals(
+                    layers.FindLayer(sent, packet.UDP)) {
+                t.Fatalf("Packet mismatch:\n%s\n%s", pkt, sent)
+            }
+
+            count++
+            return nil
+        })
+    if err != nil {
+        t.Fatalf("Error reading: %s", err)
+    }
+
+    if count != 3 {
+        t.Fatalf("Count mismatch: %d", count)
+    }
+}
+
+func TestInjectRaw(t *testing.T) {
+    var out bytes.Buffer
+
+    dst, _ := stream.Create(&out, stream.Raw, packet.Eth)
+
+    frame := make_frame(t, 53)
+
+    err := dst.Inject(frame)
+    if err != nil {
+        t.Fatalf("Error injecting: %s", err)
+    }
+
+    if !bytes.Equal(out.Bytes()[:4], []byte{ 0x00, 0x00, 0x00, 0x2a }) ||
+       !bytes.Equal(out.Bytes()[4:], frame) {
+        t.Fatalf("Raw stream mismatch: %x", out.Bytes())
+    }
+
+    src, _ := stream.Open(&out, stream.Raw, packet.Eth)
+    if src.Inject(frame) == nil {
+        t.Fatalf("Packet injected in input stream")
+    }
+}
@@ -74,7 +74,7 @@ var test_ipv4_tcp_single_byte = []byte{
 }
 
 func TestMatch(t *testing.T) {
-    arp, err := filter.Compile("arp", packet.Eth, false)
+    arp, err := filter.Compile("arp", packet.Eth, 0, false)
     if err != nil {
         t.Fatalf("Error compiling arp")
     }
@@ -83,17 +83,17 @@ func TestMatch(t *testing.T) {
         t.Fatalf("Invalid filter ARP\n%s", arp)
     }
 
-    udp, err := filter.Compile("udp", packet.Eth, false)
+    udp, err := filter.Compile("udp", packet.Eth, 0, false)
     if err != nil {
         t.Fatalf("Error compiling udp")
     }
 
-    port, err := filter.Compile("port 8338", packet.Eth, false)
+    port, err := filter.Compile("port 8338", packet.Eth, 0, false)
     if err != nil {
         t.Fatalf("Error compiling port")
     }
 
-    single, err := filter.Compile("tcp[12] != 0xa0", packet.IPv4, false)
+    single, err := filter.Compile("tcp[12] != 0xa0", packet.IPv4, 0, false)
     if err != nil {
         t.Fatalf("Error compiling single")
     }
@@ -132,7 +132,7 @@ func TestMatch(t *testing.T) {
 }
 
 func BenchmarkMatch(b *testing.B) {
-    test_filter, _ := filter.Compile("port 8338", packet.Eth, false)
+    test_filter, _ := filter.Compile("port 8338", packet.Eth, 0, false)
 
     for n := 0; n < b.N; n++ {
         test_filter.Match(test_eth_ipv4_tcp)
@@ -141,7 +141,7 @@ func BenchmarkMatch(b *testing.B) {
 
 func ExampleFilter() {
     // Match UDP or TCP packets on top of Ethernet
-    flt, err := filter.Compile("udp or tcp", packet.Eth, false)
+    flt, err := filter.Compile("udp or tcp", packet.Eth, 0, false)
     if err != nil {
         log.Fatal(err)
     }
@@ -0,0 +1,168 @@
+/*
+ * Network packet analysis framework.
+ *
+ * Copyright (c) 2014, Alessandro Ghedini
+ * All rights reserved.
+ *
+ * Redistribution and use in source and binary forms, with or without
+ * modification, are permitted provided that the following conditions are
+ * met:
+ *
+ *     * Redistributions of source code must retain the above copyright
+ *       notice, this list of conditions and the following disclaimer.
+ *
+ *     * Redistributions in binary form must reproduce the above copyright
+ *       notice, this list of conditions and the following disclaimer in the
+ *       documentation and/or other materials provided with the distribution.
+ *
+ * THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS
+ * IS" AND ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO,
+ * THE IMPLIED WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR
+ * PURPOSE ARE DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT HOLDER OR
+ * CONTRIBUTORS BE LIABLE FOR ANY DIRECT, INDIRECT, INCIDENTAL, SPECIAL,
+ * EXEMPLARY, OR CONSEQUENTIAL DAMAGES (INCLUDING, BUT NOT LIMITED TO,
+ * PROCUREMENT OF SUBSTITUTE GOODS OR SERVICES; LOSS OF USE, DATA, OR
+ * PROFITS; OR BUSINESS INTERRUPTION) HOWEVER CAUSED AND ON ANY THEORY OF
+ * LIABILITY, WHETHER IN CONTRACT, STRICT LIABILITY, OR TORT (INCLUDING
+ * NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE OF THIS
+ * SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+ */
+
+package flow
+
+import "sort"
+import "time"
+
+import "github.com/adigal150/go.pkt/capture"
+import "github.com/adigal150/go.pkt/layers"
+import "github.com/adigal150/go.pkt/packet"
+
+// Aggregator accumulates the number of packets and bytes seen in a capture,
+// both in fixed-size time windows and per flow, e.g. to find the top talkers.
+type Aggregator struct {
+    window  time.Duration
+    buckets map[int64]*Bucket
+    flows   map[Key]*Counters
+}
+
+// Number of packets and bytes (as seen on the wire) accumulated.
+type Counters struct {
+    Packets uint64
+    Bytes   uint64
+}
+
+// Counters of the packets captured within a time window.
+type Bucket struct {
+    Start time.Time
+    Counters
+}
+
+// Counters of the packets belonging to a flow.
+type Talker struct {
+    Key Key
+    Counters
+}
+
+// Create a new aggregator using time windows of the given size. A zero window
+// disables the accounting by time.
+func NewAggregator(window time.Duration) *Aggregator {
+    return &Aggregator{
+        window:  window,
+        buckets: map[int64]*Bucket{},
+        flows:   map[Key]*Counters{},
+    }
+}
+
+// Account for the given packet, captured with the given metadata. Packets that
+// don't belong to an IP flow are only accounted in the time windows.
+func (a *Aggregator) Add(pkt packet.Packet, info capture.CaptureInfo) {
+    length := uint64(info.Length)
+    if length == 0 {
+        length = uint64(info.CaptureLength)
+    }
+
+    if a.window > 0 {
+        start := info.Timestamp.Truncate(a.window)
+
+        bucket := a.buckets[start.UnixNano()]
+        if bucket == nil {
+            bucket = &Bucket{ Start: start }
+            a.buckets[start.UnixNano()] = bucket
+        }
+
+        bucket.Packets++
+        bucket.Bytes += length
+    }
+
+    key, ok := NewKey(pkt)
+    if !ok {
+        return
+    }
+
+    counters := a.flows[key]
+    if counters == nil {
+        counters = &Counters{}
+        a.flows[key] = counters
+    }
+
+    counters.Packets++
+    counters.Bytes += length
+}
+
+// Read all the packets from the given source (see capture.Each()), decode them
+// according to the source's link type, and account for them. Packets that
+// can't be decoded are only accounted in the time windows.
+func (a *Aggregator) Consume(r capture.Reader) error {
+    link_type := r.LinkType()
+
+    return capture.Each(r, func(buf []byte, info capture.CaptureInfo) error {
+        pkt, _ := layers.UnpackAll(buf, link_type)
+
+        a.Add(pkt, info)
+
+        return nil
+    })
+}
+
+// Return the time windows in which packets were seen, oldest first.
+func (a *Aggregator) Buckets() []Bucket {
+    var buckets []Bucket
+
+    for _, bucket := range a.buckets {
+        buckets = append(buckets, *bucket)
+    }
+
+    sort.Slice(buckets, func(i, j int) bool {
+        return buckets[i].Start.Before(buckets[j].Start)
+    })
+
+    return buckets
+}
+
+// Return the n flows with the most bytes, ordered by number of bytes and then
+// of packets. If n is negative, all the flows are returned.
+func (a *Aggregator) TopTalkers(n int) []Talker {
+    var talkers []Talker
+
+    for key, counters := range a.flows {
+        talkers = append(talkers, Talker{ Key: key, Counters: *counters })
+    }
+
+    sort.Slice(talkers, func(i, j int) bool {
+        if talkers[i].Bytes != talkers[j].Bytes {
+            return talkers[i].Bytes > talkers[j].Bytes
+        }
+
+        if talkers[i].Packets != talkers[j].Packets {
+            return talkers[i].Packets > talkers[j].Packets
+        }
+
+        return talkers[i].Key.String() < talkers[j].Key.String()
+    })
+
+    if n >= 0 && n < len(talkers) {
+        talkers = talkers[:n]
+    }
+
+    return talkers
+}
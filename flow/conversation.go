@@ -0,0 +1,141 @@
+/*
+ * Network packet analysis framework.
+ *
+ * Copyright (c) 2014, Alessandro Ghedini
+ * All rights reserved.
+ *
+ * Redistribution and use in source and binary forms, with or without
+ * modification, are permitted provided that the following conditions are
+ * met:
+ *
+ *     * Redistributions of source code must retain the above copyright
+ *       notice, this list of conditions and the following disclaimer.
+ *
+ *     * Redistributions in binary form must reproduce the above copyright
+ *       notice, this list of conditions and the following disclaimer in the
+ *       documentation and/or other materials provided with the distribution.
+ *
+ * THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS
+ * IS" AND ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO,
+ * THE IMPLIED WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR
+ * PURPOSE ARE DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT HOLDER OR
+ * CONTRIBUTORS BE LIABLE FOR ANY DIRECT, INDIRECT, INCIDENTAL, SPECIAL,
+ * EXEMPLARY, OR CONSEQUENTIAL DAMAGES (INCLUDING, BUT NOT LIMITED TO,
+ * PROCUREMENT OF SUBSTITUTE GOODS OR SERVICES; LOSS OF USE, DATA, OR
+ * PROFITS; OR BUSINESS INTERRUPTION) HOWEVER CAUSED AND ON ANY THEORY OF
+ * LIABILITY, WHETHER IN CONTRACT, STRICT LIABILITY, OR TORT (INCLUDING
+ * NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE OF THIS
+ * SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+ */
+
+package flow
+
+import "sort"
+import "time"
+
+import "github.com/adigal150/go.pkt/capture"
+import "github.com/adigal150/go.pkt/layers"
+import "github.com/adigal150/go.pkt/packet"
+
+// Conversations groups the packets seen in a capture into bidirectional flows,
+// identified by their normalized key (see Key.Normalize()).
+type Conversations struct {
+    convs map[Key]*Conversation
+}
+
+// Statistics about the packets exchanged in both directions of a flow, and
+// the timestamps of the first and last of them.
+type Conversation struct {
+    Key   Key
+    Counters
+    First time.Time
+    Last  time.Time
+}
+
+// Create a new, empty, conversation grouper.
+func NewConversations() *Conversations {
+    return &Conversations{
+        convs: map[Key]*Conversation{},
+    }
+}
+
+// Account for the given packet, captured with the given metadata. Packets that
+// don't belong to an IP flow are ignored.
+func (c *Conversations) Add(pkt packet.Packet, info capture.CaptureInfo) {
+    key, ok := NewKey(pkt)
+    if !ok {
+        return
+    }
+
+    key = key.Normalize()
+
+    length := uint64(info.Length)
+    if length == 0 {
+        length = uint64(info.CaptureLength)
+    }
+
+    conv := c.convs[key]
+    if conv == nil {
+        conv = &Conversation{
+            Key:   key,
+            First: info.Timestamp,
+            Last:  info.Timestamp,
+        }
+
+        c.convs[key] = conv
+    }
+
+    if info.Timestamp.Before(conv.First) {
+        conv.First = info.Timestamp
+    }
+
+    if info.Timestamp.After(conv.Last) {
+        conv.Last = info.Timestamp
+    }
+
+    conv.Packets++
+    conv.Bytes += length
+}
+
+// Read all the packets from the given source (see capture.Each()), decode them
+// according to the source's link type, and account for them. Packets that
+// can't be decoded are ignored.
+func (c *Conversations) Consume(r capture.Reader) error {
+    link_type := r.LinkType()
+
+    return capture.Each(r, func(buf []byte, info capture.CaptureInfo) error {
+        pkt, _ := layers.UnpackAll(buf, link_type)
+
+        c.Add(pkt, info)
+
+        return nil
+    })
+}
+
+// Return the conversations, ordered by number of bytes and then of packets.
+func (c *Conversations) Sorted() []Conversation {
+    var convs []Conversation
+
+    for _, conv := range c.convs {
+        convs = append(convs, *conv)
+    }
+
+    sort.Slice(convs, func(i, j int) bool {
+        if convs[i].Bytes != convs[j].Bytes {
+            return convs[i].Bytes > convs[j].Bytes
+        }
+
+        if convs[i].Packets != convs[j].Packets {
+            return convs[i].Packets > convs[j].Packets
+        }
+
+        return convs[i].Key.String() < convs[j].Key.String()
+    })
+
+    return convs
+}
+
+// Return the time elapsed between the first and the last packet.
+func (c Conversation) Duration() time.Duration {
+    return c.Last.Sub(c.First)
+}
@@ -0,0 +1,69 @@
+/*
+ * Network packet analysis framework.
+ *
+ * Copyright (c) 2014, Alessandro Ghedini
+ * All rights reserved.
+ *
+ * Redistribution and use in source and binary forms, with or without
+ * modification, are permitted provided that the following conditions are
+ * met:
+ *
+ *     * Redistributions of source code must retain the above copyright
+ *       notice, this list of conditions and the following disclaimer.
+ *
+ *     * Redistributions in binary form must reproduce the above copyright
+ *       notice, this list of conditions and the following disclaimer in the
+ *       documentation and/or other materials provided with the distribution.
+ *
+ * THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS
+ * IS" AND ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO,
+ * THE IMPLIED WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR
+ * PURPOSE ARE DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT HOLDER OR
+ * CONTRIBUTORS BE LIABLE FOR ANY DIRECT, INDIRECT, INCIDENTAL, SPECIAL,
+ * EXEMPLARY, OR CONSEQUENTIAL DAMAGES (INCLUDING, BUT NOT LIMITED TO,
+ * PROCUREMENT OF SUBSTITUTE GOODS OR SERVICES; LOSS OF USE, DATA, OR
+ * PROFITS; OR BUSINESS INTERRUPTION) HOWEVER CAUSED AND ON ANY THEORY OF
+ * LIABILITY, WHETHER IN CONTRACT, STRICT LIABILITY, OR TORT (INCLUDING
+ * NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE OF THIS
+ * SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+ */
+
+package flow_test
+
+import "testing"
+import "time"
+
+import "github.com/adigal150/go.pkt/capture/file"
+import "github.com/adigal150/go.pkt/flow"
+
+func TestConversations(t *testing.T) {
+    src, err := file.Open("conversation_test.pcap")
+    if err != nil {
+        t.Fatalf("Error opening: %s", err)
+    }
+    defer src.Close()
+
+    c := flow.NewConversations()
+
+    err = c.Consume(src)
+    if err != nil {
+        t.Fatalf("Error consuming: %s", err)
+    }
+
+    convs := c.Sorted()
+    if len(convs) != 2 {
+        t.Fatalf("Conversations count mismatch: %d", len(convs))
+    }
+
+    if convs[0].Key.String() != "10.0.0.1:1000 -> 10.0.0.2:53 UDP" ||
+       convs[0].Packets != 4 || convs[0].Bytes != 320 ||
+       convs[0].First.Unix() != 100 || convs[0].Duration() != 2 * time.Second {
+        t.Fatalf("Conversation mismatch: %s %v", convs[0].Key, convs[0])
+    }
+
+    if convs[1].Key.String() != "10.0.0.3:2000 -> 10.0.0.4:80 TCP" ||
+       convs[1].Packets != 2 || convs[1].Bytes != 120 ||
+       convs[1].Duration() != time.Second {
+        t.Fatalf("Conversation mismatch: %s %v", convs[1].Key, convs[1])
+    }
+}
@@ -0,0 +1,135 @@
+/*
+ * Network packet analysis framework.
+ *
+ * Copyright (c) 2014, Alessandro Ghedini
+ * All rights reserved.
+ *
+ * Redistribution and use in source and binary forms, with or without
+ * modification, are permitted provided that the following conditions are
+ * met:
+ *
+ *     * Redistributions of source code must retain the above copyright
+ *       notice, this list of conditions and the following disclaimer.
+ *
+ *     * Redistributions in binary form must reproduce the above copyright
+ *       notice, this list of conditions and the following disclaimer in the
+ *       documentation and/or other materials provided with the distribution.
+ *
+ * THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS
+ * IS" AND ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO,
+ * THE IMPLIED WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR
+ * PURPOSE ARE DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT HOLDER OR
+ * CONTRIBUTORS BE LIABLE FOR ANY DIRECT, INDIRECT, INCIDENTAL, SPECIAL,
+ * EXEMPLARY, OR CONSEQUENTIAL DAMAGES (INCLUDING, BUT NOT LIMITED TO,
+ * PROCUREMENT OF SUBSTITUTE GOODS OR SERVICES; LOSS OF USE, DATA, OR
+ * PROFITS; OR BUSINESS INTERRUPTION) HOWEVER CAUSED AND ON ANY THEORY OF
+ * LIABILITY, WHETHER IN CONTRACT, STRICT LIABILITY, OR TORT (INCLUDING
+ * NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE OF THIS
+ * SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+ */
+
+// Provides utilities for grouping decoded packets into flows (i.e. packets
+// sharing the same addresses, ports and transport protocol), and for computing
+// statistics about them.
+package flow
+
+import "bytes"
+import "fmt"
+import "net"
+
+import "github.com/adigal150/go.pkt/packet"
+import "github.com/adigal150/go.pkt/packet/ipv4"
+import "github.com/adigal150/go.pkt/packet/ipv6"
+import "github.com/adigal150/go.pkt/packet/tcp"
+import "github.com/adigal150/go.pkt/packet/udp"
+
+// Key identifies a flow by its 5-tuple. Addresses are stored in their 16-byte
+// form and keys are comparable, so they can be used as map keys. Ports are 0
+// for transport protocols other than TCP and UDP.
+type Key struct {
+    SrcAddr  [16]byte
+    DstAddr  [16]byte
+    SrcPort  uint16
+    DstPort  uint16
+    Protocol ipv4.Protocol
+}
+
+// Create the key of the flow the given packet belongs to, from its first IP
+// layer and the TCP or UDP layer that follows it, if any. If the packet has no
+// IP layer, false is returned.
+func NewKey(pkt packet.Packet) (Key, bool) {
+    var key Key
+
+    for ; pkt != nil; pkt = pkt.Payload() {
+        switch p := pkt.(type) {
+        case *ipv4.Packet:
+            copy(key.SrcAddr[:], p.SrcAddr.To16())
+            copy(key.DstAddr[:], p.DstAddr.To16())
+            key.Protocol = p.Protocol
+
+        case *ipv6.Packet:
+            copy(key.SrcAddr[:], p.SrcAddr.To16())
+            copy(key.DstAddr[:], p.DstAddr.To16())
+            key.Protocol = p.NextHdr
+
+        default:
+            continue
+        }
+
+        switch p := pkt.Payload().(type) {
+        case *tcp.Packet:
+            key.SrcPort = p.SrcPort
+            key.DstPort = p.DstPort
+
+        case *udp.Packet:
+            key.SrcPort = p.SrcPort
+            key.DstPort = p.DstPort
+        }
+
+        return key, true
+    }
+
+    return key, false
+}
+
+// Return the key of the flow going in the opposite direction.
+func (k Key) Reverse() Key {
+    return Key{
+        SrcAddr:  k.DstAddr,
+        DstAddr:  k.SrcAddr,
+        SrcPort:  k.DstPort,
+        DstPort:  k.SrcPort,
+        Protocol: k.Protocol,
+    }
+}
+
+// Return the key identifying the flow in either direction, i.e. the key itself
+// or its reverse, whichever has the lowest source address and port.
+func (k Key) Normalize() Key {
+    cmp := bytes.Compare(k.SrcAddr[:], k.DstAddr[:])
+
+    if cmp > 0 || (cmp == 0 && k.SrcPort > k.DstPort) {
+        return k.Reverse()
+    }
+
+    return k
+}
+
+// Return the source address of the flow.
+func (k Key) SrcIP() net.IP {
+    return net.IP(append([]byte(nil), k.SrcAddr[:]...))
+}
+
+// Return the destination address of the flow.
+func (k Key) DstIP() net.IP {
+    return net.IP(append([]byte(nil), k.DstAddr[:]...))
+}
+
+func (k Key) String() string {
+    return fmt.Sprintf("%s -> %s %s",
+                       net.JoinHostPort(k.SrcIP().String(),
+                                        fmt.Sprint(k.SrcPort)),
+                       net.JoinHostPort(k.DstIP().String(),
+                                        fmt.Sprint(k.DstPort)),
+                       k.Protocol)
+}
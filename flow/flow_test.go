@@ -0,0 +1,130 @@
+/*
+ * Network packet analysis framework.
+ *
+ * Copyright (c) 2014, Alessandro Ghedini
+ * All rights reserved.
+ *
+ * Redistribution and use in source and binary forms, with or without
+ * modification, are permitted provided that the following conditions are
+ * met:
+ *
+ *     * Redistributions of source code must retain the above copyright
+ *       notice, this list of conditions and the following disclaimer.
+ *
+ *     * Redistributions in binary form must reproduce the above copyright
+ *       notice, this list of conditions and the following disclaimer in the
+ *       documentation and/or other materials provided with the distribution.
+ *
+ * THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS
+ * IS" AND ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO,
+ * THE IMPLIED WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR
+ * PURPOSE ARE DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT HOLDER OR
+ * CONTRIBUTORS BE LIABLE FOR ANY DIRECT, INDIRECT, INCIDENTAL, SPECIAL,
+ * EXEMPLARY, OR CONSEQUENTIAL DAMAGES (INCLUDING, BUT NOT LIMITED TO,
+ * PROCUREMENT OF SUBSTITUTE GOODS OR SERVICES; LOSS OF USE, DATA, OR
+ * PROFITS; OR BUSINESS INTERRUPTION) HOWEVER CAUSED AND ON ANY THEORY OF
+ * LIABILITY, WHETHER IN CONTRACT, STRICT LIABILITY, OR TORT (INCLUDING
+ * NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE OF THIS
+ * SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+ */
+
+package flow_test
+
+import "net"
+import "testing"
+import "time"
+
+import "github.com/adigal150/go.pkt/capture"
+import "github.com/adigal150/go.pkt/capture/file"
+import "github.com/adigal150/go.pkt/flow"
+import "github.com/adigal150/go.pkt/layers"
+import "github.com/adigal150/go.pkt/packet/eth"
+import "github.com/adigal150/go.pkt/packet/ipv4"
+import "github.com/adigal150/go.pkt/packet/udp"
+
+func TestNewKey(t *testing.T) {
+    ip4_pkt := ipv4.Make()
+    ip4_pkt.SrcAddr = net.ParseIP("10.0.0.1")
+    ip4_pkt.DstAddr = net.ParseIP("10.0.0.2")
+
+    udp_pkt := udp.Make()
+    udp_pkt.SrcPort = 1000
+    udp_pkt.DstPort = 53
+
+    pkt, _ := layers.Compose(eth.Make(), ip4_pkt, udp_pkt)
+
+    key, ok := flow.NewKey(pkt)
+    if !ok {
+        t.Fatalf("No flow key")
+    }
+
+    if key.String() != "10.0.0.1:1000 -> 10.0.0.2:53 UDP" {
+        t.Fatalf("Key mismatch: %s", key)
+    }
+
+    rev := key.Reverse()
+    if !rev.SrcIP().Equal(ip4_pkt.DstAddr) || rev.SrcPort != 53 ||
+       rev.Reverse() != key {
+        t.Fatalf("Reverse key mismatch: %s", rev)
+    }
+
+    if key.Normalize() != key || rev.Normalize() != key {
+        t.Fatalf("Normalized key mismatch: %s", rev.Normalize())
+    }
+
+    if _, ok := flow.NewKey(eth.Make()); ok {
+        t.Fatalf("Flow key without IP layer")
+    }
+}
+
+func TestAggregator(t *testing.T) {
+    src, err := file.Open("flow_test.pcap")
+    if err != nil {
+        t.Fatalf("Error opening: %s", err)
+    }
+    defer src.Close()
+
+    a := flow.NewAggregator(time.Second)
+
+    err = a.Consume(src)
+    if err != nil {
+        t.Fatalf("Error consuming: %s", err)
+    }
+
+    top := a.TopTalkers(1)
+    if len(top) != 1 {
+        t.Fatalf("Talkers count mismatch: %d", len(top))
+    }
+
+    if top[0].Key.String() != "10.0.0.1:1000 -> 10.0.0.2:53 UDP" ||
+       top[0].Packets != 3 || top[0].Bytes != 300 {
+        t.Fatalf("Top talker mismatch: %s %v", top[0].Key, top[0].Counters)
+    }
+
+    if len(a.TopTalkers(-1)) != 2 {
+        t.Fatalf("Talkers count mismatch: %d", len(a.TopTalkers(-1)))
+    }
+
+    buckets := a.Buckets()
+    if len(buckets) != 3 {
+        t.Fatalf("Buckets count mismatch: %d", len(buckets))
+    }
+
+    expected := []flow.Counters{ { 3, 202 }, { 2, 160 }, { 1, 100 } }
+
+    for i, b := range buckets {
+        if b.Start.Unix() != int64(100 + i) || b.Counters != expected[i] {
+            t.Fatalf("Bucket mismatch: %s %v", b.Start, b.Counters)
+        }
+    }
+}
+
+func TestAggregatorNoWindow(t *testing.T) {
+    a := flow.NewAggregator(0)
+
+    a.Add(nil, capture.CaptureInfo{ Length: 100 })
+
+    if len(a.Buckets()) != 0 || len(a.TopTalkers(-1)) != 0 {
+        t.Fatalf("Unexpected accounting")
+    }
+}
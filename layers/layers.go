@@ -31,24 +31,61 @@
 // Provides utility functions for encoding and decoding packets to/from binary
 // data. Differently from the basic "packet" interface, this can encode and
 // decode complete "stacks" of packets, instead of manipulating single ones.
+//
+// The decoding functions don't keep any state between calls, and the protocol
+// registries they consult (e.g. udp.RegisterPort() and RegisterType()) are
+// only modified during initialization, so they are safe to call concurrently
+// on distinct inputs. The input data is only read, so the same slice can also
+// be decoded by many goroutines at once, as long as nothing writes to it. The
+// decoded packets are not safe for concurrent use though (lazily decoded ones
+// are modified even by Payload()), so a packet must be accessed by one
+// goroutine at a time.
+//
+// No state is kept between calls. In particular, NetFlow v9 and IPFIX data
+// records are only decoded using the templates of the same packet, unless a
+// netflow.TemplateCache is set with DecodeOptions.Prepare.
 package layers
 
+import "errors"
+
 import "github.com/adigal150/go.pkt/packet"
 
 import "github.com/adigal150/go.pkt/packet/arp"
+import "github.com/adigal150/go.pkt/packet/bgp"
+import "github.com/adigal150/go.pkt/packet/dccp"
+import "github.com/adigal150/go.pkt/packet/dhcp6"
+import "github.com/adigal150/go.pkt/packet/diameter"
+import "github.com/adigal150/go.pkt/packet/dns"
+import "github.com/adigal150/go.pkt/packet/dtp"
 import "github.com/adigal150/go.pkt/packet/eth"
+import "github.com/adigal150/go.pkt/packet/etherip"
+import "github.com/adigal150/go.pkt/packet/fcoe"
+import "github.com/adigal150/go.pkt/packet/gtpu"
+import "github.com/adigal150/go.pkt/packet/gtpv2"
 import "github.com/adigal150/go.pkt/packet/icmpv4"
 import "github.com/adigal150/go.pkt/packet/icmpv6"
+import "github.com/adigal150/go.pkt/packet/igmp"
 import "github.com/adigal150/go.pkt/packet/ipv4"
 import "github.com/adigal150/go.pkt/packet/ipv6"
+import "github.com/adigal150/go.pkt/packet/isis"
 import "github.com/adigal150/go.pkt/packet/llc"
+import "github.com/adigal150/go.pkt/packet/macsec"
+import "github.com/adigal150/go.pkt/packet/netflow"
+import "github.com/adigal150/go.pkt/packet/pim"
 import "github.com/adigal150/go.pkt/packet/radiotap"
 import "github.com/adigal150/go.pkt/packet/raw"
+import "github.com/adigal150/go.pkt/packet/rip"
+import "github.com/adigal150/go.pkt/packet/ripng"
+import "github.com/adigal150/go.pkt/packet/sip"
 import "github.com/adigal150/go.pkt/packet/sll"
 import "github.com/adigal150/go.pkt/packet/snap"
 import "github.com/adigal150/go.pkt/packet/tcp"
+import "github.com/adigal150/go.pkt/packet/tls"
+import "github.com/adigal150/go.pkt/packet/truncated"
 import "github.com/adigal150/go.pkt/packet/udp"
+import "github.com/adigal150/go.pkt/packet/udplite"
 import "github.com/adigal150/go.pkt/packet/vlan"
+import "github.com/adigal150/go.pkt/packet/wol"
 
 // Compose packets into a chain and update their values (e.g. length, payload
 // protocol) accordingly.
@@ -72,8 +109,6 @@ func Compose(pkts ...packet.Packet) (packet.Packet, error) {
 // Pack packets into their binary form. This will stack the packets before
 // encoding them (see the Compose() method) and also calculate the checksums.
 func Pack(pkts ...packet.Packet) ([]byte, error) {
-    var buf packet.Buffer
-
     base_pkt, err := Compose(pkts...)
     if err != nil {
         return nil, err
@@ -81,7 +116,7 @@ func Pack(pkts ...packet.Packet) ([]byte, error) {
 
     tot_len := int(base_pkt.GetLength())
 
-    buf.Init(make([]byte, tot_len))
+    buf := packet.NewBuffer(tot_len)
 
     for i := len(pkts) - 1; i >= 0; i-- {
         cur_pkt := pkts[i]
@@ -90,7 +125,7 @@ func Pack(pkts ...packet.Packet) ([]byte, error) {
         buf.SetOffset(tot_len - cur_len)
         buf.NewLayer()
 
-        err := cur_pkt.Pack(&buf)
+        err := cur_pkt.Pack(buf)
         if err != nil {
             return nil, err
         }
@@ -144,51 +179,76 @@ func Unpack(buf []byte, pkts ...packet.Packet) (packet.Packet, error) {
 
 // Recursively unpack the given byte slice into a packet. The link_type argument
 // must specify the type of the first layer in the input data, successive layers
-// will be detected automatically.
+// will be detected automatically. Payloads whose type is guessed from the UDP
+// or TCP ports but that fail to decode are kept as raw.Packet layers.
 //
 // Note that unpacking is done without copying the input slice, which means that
 // if the slice is modifed, it may affect the packets that where unpacked from
 // it. If you can't guarantee that the data slice won't change, you'll need to
-// copy it and pass the copy to UnpackAll().
+// copy it and pass the copy to UnpackAll(), or use UnpackAllWith() with the
+// Copy option.
 func UnpackAll(buf []byte, link_type packet.Type) (packet.Packet, error) {
+    return UnpackAllWith(buf, link_type, packet.DecodeOptions{})
+}
+
+// Recursively unpack the given byte slice into a packet, like UnpackAll(), but
+// using the given options to control the decoding (see packet.DecodeOptions).
+func UnpackAllWith(buf []byte, link_type packet.Type, opts packet.DecodeOptions) (packet.Packet, error) {
+    if opts.Copy {
+        buf = append([]byte(nil), buf...)
+    }
+
     var b packet.Buffer
     b.Init(buf)
 
+    return unpack_all(b, link_type, opts, 0, 0)
+}
+
+func unpack_all(b packet.Buffer, link_type packet.Type, opts packet.DecodeOptions, depth int, missing uint32) (packet.Packet, error) {
     first_pkt := packet.Packet(nil)
     prev_pkt  := packet.Packet(nil)
 
-    for link_type != packet.None {
-        var p packet.Packet
+    max_depth := opts.MaxDepth
+    if max_depth == 0 {
+        max_depth = packet.DefaultMaxDepth
+    }
 
+    for link_type != packet.None {
         if b.Len() <= 0 {
             break
         }
 
-        switch link_type {
-        case packet.ARP:      p = &arp.Packet{}
-        case packet.Eth:      p = &eth.Packet{}
-        case packet.ICMPv4:   p = &icmpv4.Packet{}
-        case packet.ICMPv6:   p = &icmpv6.Packet{}
-        case packet.IPv4:     p = &ipv4.Packet{}
-        case packet.IPv6:     p = &ipv6.Packet{}
-        case packet.LLC:      p = &llc.Packet{}
-        case packet.RadioTap: p = &radiotap.Packet{}
-        case packet.SLL:      p = &sll.Packet{}
-        case packet.SNAP:     p = &snap.Packet{}
-        case packet.TCP:      p = &tcp.Packet{}
-        case packet.UDP:      p = &udp.Packet{}
-        case packet.VLAN:     p = &vlan.Packet{}
-        default:              p = &raw.Packet{}
-        }
-
-        if p == nil {
-            break
+        if max_depth > 0 && depth >= max_depth {
+            return first_pkt, packet.ErrMaxDepth
+        }
+
+        p := new_packet(link_type)
+
+        if opts.Prepare != nil {
+            opts.Prepare(p)
         }
 
+        left  := b.Len()
+        saved := b
+
         b.NewLayer()
 
         err := p.Unpack(&b)
-        if err != nil {
+
+        /* payloads whose type is only guessed (e.g. from the UDP and TCP
+         * ports) may well be something else, like TCP continuation
+         * segments, so they are kept as raw data instead of failing */
+        if err != nil && guessed_type(prev_pkt) &&
+           (!opts.Truncated || !errors.Is(err, packet.ErrTruncated)) {
+            b = saved
+            b.NewLayer()
+
+            p   = &raw.Packet{}
+            err = p.Unpack(&b)
+        }
+
+        if err != nil && (!opts.Truncated ||
+                          !errors.Is(err, packet.ErrTruncated)) {
             return nil, err
         }
 
@@ -198,13 +258,161 @@ func UnpackAll(buf []byte, link_type packet.Type) (packet.Packet, error) {
             first_pkt = p
         }
 
+        if err != nil {
+            p.SetPayload(&truncated.Packet{
+                Layer:   p.GetType(),
+                Missing: missing,
+            })
+
+            break
+        }
+
+        if bounded_pkt, ok := p.(packet.BoundedPacket); ok {
+            pl_len := bounded_pkt.PayloadLength()
+
+            /* the bytes missing stay the same while the payload is decoded,
+             * so they only need to be computed for the innermost length */
+            if pl_len > uint32(b.Len()) {
+                missing = pl_len - uint32(b.Len())
+            }
+
+            trim_payload(&b, first_pkt, bounded_pkt, opts)
+        }
+
+        if opts.StopAt != packet.None && p.GetType() == opts.StopAt {
+            break
+        }
+
         prev_pkt  = p
         link_type = p.GuessPayloadType()
+
+        /* consecutive messages (e.g. BGP messages in a TCP segment) don't
+         * nest, so they count as a single layer, as long as each of them
+         * consumes some data */
+        msg_pkt, ok := p.(packet.MessagePacket)
+        if !ok || !msg_pkt.NextMessage() || b.Len() >= left {
+            depth++
+        }
+
+        lazy_pkt, ok := p.(packet.LazyPacket)
+        if opts.Lazy && ok {
+            rest_buf, rest_type, rest_depth := b, link_type, depth
+            rest_missing := missing
+
+            lazy_pkt.SetPayloadDecoder(func() packet.Packet {
+                pl, _ := unpack_all(rest_buf, rest_type, opts, rest_depth,
+                                    rest_missing)
+                return pl
+            })
+
+            break
+        }
     }
 
     return first_pkt, nil
 }
 
+/* Return true if the type of the payload of the given packet is guessed from
+ * the ports, or if it is the next message of the same protocol (see
+ * packet.MessagePacket) */
+func guessed_type(p packet.Packet) bool {
+    if p == nil {
+        return false
+    }
+
+    switch p.GetType() {
+    case packet.TCP, packet.UDP:
+        return true
+    }
+
+    msg_pkt, ok := p.(packet.MessagePacket)
+    return ok && msg_pkt.NextMessage()
+}
+
+/* Discard the data following the declared payload of the given packet, and
+ * detect the Ethernet FCS (see packet.DecodeOptions) */
+func trim_payload(b *packet.Buffer, first_pkt packet.Packet,
+                  p packet.BoundedPacket, opts packet.DecodeOptions) {
+    pl_len := p.PayloadLength()
+
+    if pl_len == 0 || pl_len >= uint32(b.Len()) {
+        return
+    }
+
+    eth_pkt, ok := first_pkt.(*eth.Packet)
+
+    if opts.FCS && ok && eth_pkt.FCS == nil &&
+       (p.GetType() == packet.IPv4 || p.GetType() == packet.IPv6) &&
+       uint32(b.Len()) - pl_len == 4 {
+        eth_pkt.FCS = b.Rest()[pl_len:]
+        b.Truncate(int(pl_len))
+    }
+
+    if opts.Trim {
+        b.Truncate(int(pl_len))
+    }
+}
+
+var type_registry = map[packet.Type]func() packet.Packet{}
+
+// Register a function creating empty packets of the given type, so that packets
+// of types not supported by this package (e.g. experimental or proprietary
+// protocols) are decoded by the returned packet instead of being left opaque.
+// The type needs to be mapped to the enclosing protocol as well, e.g. with
+// ipv4.RegisterProtocol() or udp.RegisterPort(). Built-in types can't be
+// overridden.
+//
+// This is meant to be called during initialization (e.g. from an init()
+// function) and must not be called concurrently with packet decoding.
+func RegisterType(pkt_type packet.Type, make_pkt func() packet.Packet) {
+    type_registry[pkt_type] = make_pkt
+}
+
+func new_packet(pkt_type packet.Type) packet.Packet {
+    switch pkt_type {
+    case packet.ARP:      return &arp.Packet{}
+    case packet.BGP:      return &bgp.Packet{}
+    case packet.DCCP:     return &dccp.Packet{}
+    case packet.DHCPv6:   return &dhcp6.Packet{}
+    case packet.Diameter: return &diameter.Packet{}
+    case packet.DNS:      return &dns.Packet{}
+    case packet.DTP:      return &dtp.Packet{}
+    case packet.Eth:      return &eth.Packet{}
+    case packet.EtherIP:  return &etherip.Packet{}
+    case packet.FCoE:     return &fcoe.Packet{}
+    case packet.GTPU:     return &gtpu.Packet{}
+    case packet.GTPv2:    return &gtpv2.Packet{}
+    case packet.ICMPv4:   return &icmpv4.Packet{}
+    case packet.ICMPv6:   return &icmpv6.Packet{}
+    case packet.IGMP:     return &igmp.Packet{}
+    case packet.IPv4:     return &ipv4.Packet{}
+    case packet.IPv6:     return &ipv6.Packet{}
+    case packet.ISIS:     return &isis.Packet{}
+    case packet.LLC:      return &llc.Packet{}
+    case packet.MACsec:   return &macsec.Packet{}
+    case packet.NetFlow:  return &netflow.Packet{}
+    case packet.PIM:      return &pim.Packet{}
+    case packet.RadioTap: return &radiotap.Packet{}
+    case packet.RIP:      return &rip.Packet{}
+    case packet.RIPng:    return &ripng.Packet{}
+    case packet.SIP:      return &sip.Packet{}
+    case packet.SLL:      return &sll.Packet{}
+    case packet.SNAP:     return &snap.Packet{}
+    case packet.TCP:      return &tcp.Packet{}
+    case packet.TLS:      return &tls.Packet{}
+    case packet.UDP:      return &udp.Packet{}
+    case packet.UDPLite:  return &udplite.Packet{}
+    case packet.VLAN:     return &vlan.Packet{}
+    case packet.WoL:      return &wol.Packet{}
+    }
+
+    if make_pkt, ok := type_registry[pkt_type]; ok {
+        return make_pkt()
+    }
+
+    return &raw.Packet{}
+}
+
 // Return the first layer of the given type in the packet. If no suitable layer
 // is found, return nil.
 func FindLayer(p packet.Packet, layer packet.Type) packet.Packet {
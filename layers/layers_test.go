@@ -31,18 +31,32 @@
 package layers_test
 
 import "bytes"
+import "encoding/binary"
+import "errors"
+import "fmt"
+import "hash/crc32"
 import "log"
 import "net"
+import "sync"
 import "testing"
 
+import "github.com/adigal150/go.pkt/capture"
+import "github.com/adigal150/go.pkt/capture/file"
 import "github.com/adigal150/go.pkt/layers"
 import "github.com/adigal150/go.pkt/packet"
 import "github.com/adigal150/go.pkt/packet/arp"
 import "github.com/adigal150/go.pkt/packet/eth"
+import "github.com/adigal150/go.pkt/packet/etherip"
+import "github.com/adigal150/go.pkt/packet/fcoe"
+import "github.com/adigal150/go.pkt/packet/icmpv4"
+import "github.com/adigal150/go.pkt/packet/icmpv6"
 import "github.com/adigal150/go.pkt/packet/ipv4"
+import "github.com/adigal150/go.pkt/packet/ipv6"
 import "github.com/adigal150/go.pkt/packet/raw"
 import "github.com/adigal150/go.pkt/packet/udp"
 import "github.com/adigal150/go.pkt/packet/tcp"
+import "github.com/adigal150/go.pkt/packet/tls"
+import "github.com/adigal150/go.pkt/packet/truncated"
 import "github.com/adigal150/go.pkt/packet/vlan"
 
 var hwsrc_str = "4c:72:b9:54:e5:3d"
@@ -110,6 +124,36 @@ func TestUnpackAllEthArp(t *testing.T) {
     }
 }
 
+func TestUnpackAllEthArpPadded(t *testing.T) {
+    data := make([]byte, 60)
+    copy(data, test_eth_arp)
+
+    pkt, err := layers.UnpackAll(data, packet.Eth)
+    if err != nil {
+        t.Fatalf("Error unpacking: %s", err)
+    }
+
+    arp_pkt, ok := pkt.Payload().(*arp.Packet)
+    if !ok || arp_pkt.Payload() != nil {
+        t.Fatalf("Packet mismatch: %s", pkt)
+    }
+
+    if !bytes.Equal(arp_pkt.RawBytes(), test_eth_arp[14:]) {
+        t.Fatalf("Padding not discarded: %x", arp_pkt.RawBytes())
+    }
+
+    var cmp arp.Packet
+
+    _, err = layers.Unpack(test_eth_arp, &eth.Packet{}, &cmp)
+    if err != nil {
+        t.Fatalf("Error unpacking: %s", err)
+    }
+
+    if !arp_pkt.Equals(&cmp) {
+        t.Fatalf("Packet mismatch:\n%s\n%s", arp_pkt, &cmp)
+    }
+}
+
 func BenchmarkUnpackAllEthArp(bn *testing.B) {
     for n := 0; n < bn.N; n++ {
         layers.UnpackAll(test_eth_arp, packet.Eth)
@@ -128,8 +172,7 @@ func TestPackEthVLANArp(t *testing.T) {
     eth_pkt.SrcAddr, _ = net.ParseMAC(hwsrc_str)
     eth_pkt.DstAddr, _ = net.ParseMAC("ff:ff:ff:ff:ff:ff")
 
-    vlan_pkt := vlan.Make()
-    vlan_pkt.VLAN = 135
+    vlan_pkt := vlan.Make(135)
 
     arp_pkt := arp.Make()
     arp_pkt.HWSrcAddr, _ = net.ParseMAC(hwsrc_str)
@@ -221,6 +264,26 @@ func TestPackEthIPv4UDP(t *testing.T) {
     }
 }
 
+func BenchmarkPackEthIPv4UDP(bn *testing.B) {
+    bn.ReportAllocs()
+
+    eth_pkt := eth.Make()
+    eth_pkt.SrcAddr, _ = net.ParseMAC(hwsrc_str)
+    eth_pkt.DstAddr, _ = net.ParseMAC(hwdst_str)
+
+    ip4_pkt := ipv4.Make()
+    ip4_pkt.SrcAddr = net.ParseIP(ipsrc_str)
+    ip4_pkt.DstAddr = net.ParseIP(ipdst_str)
+
+    udp_pkt := udp.Make()
+    udp_pkt.SrcPort = 41562
+    udp_pkt.DstPort = 8338
+
+    for n := 0; n < bn.N; n++ {
+        layers.Pack(eth_pkt, ip4_pkt, udp_pkt)
+    }
+}
+
 func TestUnpackEthUPv4UDP(t *testing.T) {
     var eth_pkt eth.Packet
     var ip4_pkt ipv4.Packet
@@ -233,6 +296,8 @@ func TestUnpackEthUPv4UDP(t *testing.T) {
 }
 
 func BenchmarkUnpackEthUPv4UDP(bn *testing.B) {
+    bn.ReportAllocs()
+
     var eth_pkt eth.Packet
     var ip4_pkt ipv4.Packet
     var udp_pkt udp.Packet
@@ -263,12 +328,206 @@ func TestUnpackAllEthIPv4UDP(t *testing.T) {
     }
 }
 
+func TestRepackEthIPv4UDPPadded(t *testing.T) {
+    data := make([]byte, 60)
+    copy(data, test_eth_ipv4_udp)
+
+    for i := len(test_eth_ipv4_udp); i < len(data); i++ {
+        data[i] = 0xaa
+    }
+
+    pkt, err := layers.UnpackAll(data, packet.Eth)
+    if err != nil {
+        t.Fatalf("Error unpacking: %s", err)
+    }
+
+    var pkts []packet.Packet
+
+    for p := pkt; p != nil; p = p.Payload() {
+        pkts = append(pkts, p)
+    }
+
+    buf, err := layers.Pack(pkts...)
+    if err != nil {
+        t.Fatalf("Error packing: %s", err)
+    }
+
+    if !bytes.Equal(buf, data) {
+        t.Fatalf("Raw packet mismatch: %x", buf)
+    }
+}
+
 func BenchmarkUnpackAllEthIPv4UDP(bn *testing.B) {
+    bn.ReportAllocs()
+
     for n := 0; n < bn.N; n++ {
         layers.UnpackAll(test_eth_ipv4_udp, packet.Eth)
     }
 }
 
+func TestTagEthIPv4UDP(t *testing.T) {
+    pkt, err := layers.UnpackAll(test_eth_ipv4_udp, packet.Eth)
+    if err != nil {
+        t.Fatalf("Error unpacking: %s", err)
+    }
+
+    vlan.Tag(pkt.(*eth.Packet), 135, 5)
+
+    check_layers(t, pkt, packet.Eth, packet.VLAN, packet.IPv4, packet.UDP)
+
+    var pkts []packet.Packet
+    for p := pkt; p != nil; p = p.Payload() {
+        pkts = append(pkts, p)
+    }
+
+    buf, err := layers.Pack(pkts...)
+    if err != nil {
+        t.Fatalf("Error packing: %s", err)
+    }
+
+    var tagged []byte
+    tagged = append(tagged, test_eth_ipv4_udp[:12]...)
+    tagged = append(tagged, 0x81, 0x00, 0xa0, 0x87)
+    tagged = append(tagged, test_eth_ipv4_udp[12:]...)
+
+    if !bytes.Equal(tagged, buf) {
+        t.Fatalf("Raw packet mismatch: %x", buf)
+    }
+}
+
+var test_eth_qinq_ipv4_udp = []byte{
+    0x00, 0x21, 0x96, 0x6e, 0xf0, 0x70, 0x4c, 0x72, 0xb9, 0x54, 0xe5, 0x3d,
+    0x88, 0xa8, 0x00, 0x64, 0x81, 0x00, 0x00, 0xc8, 0x08, 0x00, 0x45, 0x00,
+    0x00, 0x1c, 0x00, 0x01, 0x00, 0x00, 0x40, 0x11, 0x27, 0x60, 0xc0, 0xa8,
+    0x01, 0x87, 0xc1, 0x1b, 0xd0, 0x25, 0xa2, 0x5a, 0x20, 0x92, 0x00, 0x08,
+    0xe9, 0x80,
+}
+
+func TestUnpackAllEthQinQ(t *testing.T) {
+    pkt, err := layers.UnpackAll(test_eth_qinq_ipv4_udp, packet.Eth)
+    if err != nil {
+        t.Fatalf("Error unpacking: %s", err)
+    }
+
+    check_layers(t, pkt, packet.Eth, packet.VLAN, packet.VLAN, packet.IPv4,
+                 packet.UDP)
+
+    stag := pkt.Payload().(*vlan.Packet)
+    ctag := stag.Payload().(*vlan.Packet)
+
+    if stag.VLAN != 100 || ctag.VLAN != 200 {
+        t.Fatalf("VLAN mismatch: %d %d", stag.VLAN, ctag.VLAN)
+    }
+}
+
+func TestPackEthQinQ(t *testing.T) {
+    pkt, err := layers.UnpackAll(test_eth_ipv4_udp, packet.Eth)
+    if err != nil {
+        t.Fatalf("Error unpacking: %s", err)
+    }
+
+    vlan.QinQ(pkt.(*eth.Packet), 100, 200)
+
+    if int(pkt.GetLength()) != len(test_eth_ipv4_udp) + 8 {
+        t.Fatalf("Length mismatch: %d", pkt.GetLength())
+    }
+
+    var pkts []packet.Packet
+    for p := pkt; p != nil; p = p.Payload() {
+        pkts = append(pkts, p)
+    }
+
+    buf, err := layers.Pack(pkts...)
+    if err != nil {
+        t.Fatalf("Error packing: %s", err)
+    }
+
+    if !bytes.Equal(test_eth_qinq_ipv4_udp, buf) {
+        t.Fatalf("Raw packet mismatch: %x", buf)
+    }
+}
+
+var test_eth_ipv4_udp_odd = []byte{
+    0x00, 0x21, 0x96, 0x6e, 0xf0, 0x70, 0x4c, 0x72, 0xb9, 0x54, 0xe5, 0x3d,
+    0x08, 0x00, 0x45, 0x00, 0x00, 0x23, 0x00, 0x01, 0x00, 0x00, 0x40, 0x11,
+    0x27, 0x59, 0xc0, 0xa8, 0x01, 0x87, 0xc1, 0x1b, 0xd0, 0x25, 0x9c, 0x40,
+    0x27, 0x0f, 0x00, 0x0f, 0xc6, 0xbb, 0x67, 0x6f, 0x2e, 0x70, 0x6b, 0x74,
+    0x21,
+}
+
+func TestPackEthIPv4UDPOdd(t *testing.T) {
+    eth_pkt := eth.Make()
+    eth_pkt.SrcAddr, _ = net.ParseMAC(hwsrc_str)
+    eth_pkt.DstAddr, _ = net.ParseMAC(hwdst_str)
+
+    ip4_pkt := ipv4.Make()
+    ip4_pkt.SrcAddr = net.ParseIP(ipsrc_str)
+    ip4_pkt.DstAddr = net.ParseIP(ipdst_str)
+
+    udp_pkt := udp.Make()
+    udp_pkt.SrcPort = 40000
+    udp_pkt.DstPort = 9999
+
+    raw_pkt := raw.Make()
+    raw_pkt.Data = []byte("go.pkt!")
+
+    data, err := layers.Pack(eth_pkt, ip4_pkt, udp_pkt, raw_pkt)
+    if err != nil {
+        t.Fatalf("Error packing: %s", err)
+    }
+
+    if !bytes.Equal(test_eth_ipv4_udp_odd, data) {
+        t.Fatalf("Raw packet mismatch: %x", data)
+    }
+}
+
+/* Decoding and re-encoding packets with odd-length payloads taken from a
+ * capture must preserve their (valid) checksums */
+func TestPackOddLengthCapture(t *testing.T) {
+    src, err := file.Open("layers_test.pcap")
+    if err != nil {
+        t.Fatalf("Error opening: %s", err)
+    }
+    defer src.Close()
+
+    var count int
+
+    err = capture.Each(src, func(buf []byte, info capture.CaptureInfo) error {
+        pkt, err := layers.UnpackAll(buf, src.LinkType())
+        if err != nil {
+            return err
+        }
+
+        var pkts []packet.Packet
+        for p := pkt; p != nil; p = p.Payload() {
+            pkts = append(pkts, p)
+        }
+
+        if len(pkts) != 4 || len(pkts[3].RawBytes()) % 2 == 0 {
+            t.Fatalf("Unexpected packet: %s", pkt)
+        }
+
+        data, err := layers.Pack(pkts...)
+        if err != nil {
+            return err
+        }
+
+        if !bytes.Equal(buf, data) {
+            t.Fatalf("Raw packet mismatch: %x", data)
+        }
+
+        count++
+        return nil
+    })
+    if err != nil {
+        t.Fatalf("Error reading: %s", err)
+    }
+
+    if count != 2 {
+        t.Fatalf("Packet count mismatch: %d", count)
+    }
+}
+
 var test_eth_ipv4_udp_raw = []byte{
     0x00, 0x21, 0x96, 0x6e, 0xf0, 0x70, 0x4c, 0x72, 0xb9, 0x54, 0xe5, 0x3d,
     0x08, 0x00, 0x45, 0x00, 0x00, 0x42, 0x00, 0x01, 0x00, 0x00, 0x40, 0x11,
@@ -313,6 +572,54 @@ func TestPackEthIPv4UDPRaw(t *testing.T) {
     }
 }
 
+func TestFinalizeEthIPv4UDPRaw(t *testing.T) {
+    pkt, err := layers.UnpackAll(test_eth_ipv4_udp, packet.Eth)
+    if err != nil {
+        t.Fatalf("Error unpacking: %s", err)
+    }
+
+    ip4_pkt := pkt.Payload().(*ipv4.Packet)
+    udp_pkt := ip4_pkt.Payload().(*udp.Packet)
+
+    raw_pkt := raw.Make()
+    raw_pkt.Data = []byte("fdg agfh ldfhgk hfdkgh kfjdhsg kshfdgk")
+
+    /* only the UDP length is updated */
+    udp_pkt.SetPayload(raw_pkt)
+
+    if ip4_pkt.Length != 28 || udp_pkt.Length != 46 {
+        t.Fatalf("Length mismatch: %d %d", ip4_pkt.Length, udp_pkt.Length)
+    }
+
+    err = packet.Finalize(pkt)
+    if err != nil {
+        t.Fatalf("Error finalizing: %s", err)
+    }
+
+    if ip4_pkt.Length != 66 || udp_pkt.Length != 46 {
+        t.Fatalf("Length mismatch: %d %d", ip4_pkt.Length, udp_pkt.Length)
+    }
+
+    /* pack without composing again, innermost layer first */
+    pkts := []packet.Packet{ pkt, ip4_pkt, udp_pkt, raw_pkt }
+
+    buf := packet.NewBuffer(int(pkt.GetLength()))
+
+    for i := len(pkts) - 1; i >= 0; i-- {
+        buf.SetOffset(int(pkt.GetLength() - pkts[i].GetLength()))
+        buf.NewLayer()
+
+        err := pkts[i].Pack(buf)
+        if err != nil {
+            t.Fatalf("Error packing: %s", err)
+        }
+    }
+
+    if !bytes.Equal(test_eth_ipv4_udp_raw, buf.Buffer()) {
+        t.Fatalf("Raw packet mismatch: %x", buf.Buffer())
+    }
+}
+
 func TestUnpackEthUPv4UDPRaw(t *testing.T) {
     var eth_pkt eth.Packet
     var ip4_pkt ipv4.Packet
@@ -403,6 +710,28 @@ func TestPackEthIPv4TCP(t *testing.T) {
     }
 }
 
+func BenchmarkPackEthIPv4TCP(bn *testing.B) {
+    bn.ReportAllocs()
+
+    eth_pkt := eth.Make()
+    eth_pkt.SrcAddr, _ = net.ParseMAC(hwsrc_str)
+    eth_pkt.DstAddr, _ = net.ParseMAC(hwdst_str)
+
+    ip4_pkt := ipv4.Make()
+    ip4_pkt.SrcAddr = net.ParseIP(ipsrc_str)
+    ip4_pkt.DstAddr = net.ParseIP(ipdst_str)
+
+    tcp_pkt := tcp.Make()
+    tcp_pkt.SrcPort = 41562
+    tcp_pkt.DstPort = 8338
+    tcp_pkt.Flags   = tcp.Syn
+    tcp_pkt.WindowSize = 8192
+
+    for n := 0; n < bn.N; n++ {
+        layers.Pack(eth_pkt, ip4_pkt, tcp_pkt)
+    }
+}
+
 func TestUnpackEthUPv4TCP(t *testing.T) {
     var eth_pkt eth.Packet
     var ip4_pkt ipv4.Packet
@@ -415,6 +744,8 @@ func TestUnpackEthUPv4TCP(t *testing.T) {
 }
 
 func BenchmarkUnpackEthUPv4TCP(bn *testing.B) {
+    bn.ReportAllocs()
+
     var eth_pkt eth.Packet
     var ip4_pkt ipv4.Packet
     var tcp_pkt tcp.Packet
@@ -446,6 +777,8 @@ func TestUnpackAllEthIPv4TCP(t *testing.T) {
 }
 
 func BenchmarkUnpackAllEthIPv4TCP(bn *testing.B) {
+    bn.ReportAllocs()
+
     for n := 0; n < bn.N; n++ {
         layers.UnpackAll(test_eth_ipv4_tcp, packet.Eth)
     }
@@ -555,59 +888,1014 @@ func BenchmarkUnpackAllEthIPv4TCPRaw(bn *testing.B) {
     }
 }
 
-func TestFindLayer(t *testing.T) {
-    pkt, err := layers.UnpackAll(test_eth_ipv4_tcp, packet.Eth)
+func TestHeaderBytesEthIPv4TCPRaw(t *testing.T) {
+    pkt, err := layers.UnpackAll(test_eth_ipv4_tcp_raw, packet.Eth)
     if err != nil {
         t.Fatalf("Error unpacking: %s", err)
     }
 
-    ipv4_pkt := layers.FindLayer(pkt, packet.IPv4)
-    if ipv4_pkt == nil || ipv4_pkt.GetType() != packet.IPv4 {
-        t.Fatalf("Not IPv4: %s", ipv4_pkt)
+    eth_hdr := pkt.HeaderBytes()
+    if !bytes.Equal(eth_hdr, test_eth_ipv4_tcp_raw[:14]) {
+        t.Fatalf("Ethernet header mismatch: %x", eth_hdr)
     }
 
-    tcp_pkt := layers.FindLayer(pkt, packet.TCP)
-    if tcp_pkt == nil || tcp_pkt.GetType() != packet.TCP {
-        t.Fatalf("Not TCP: %s", tcp_pkt)
+    ip4_hdr := pkt.Payload().HeaderBytes()
+    if !bytes.Equal(ip4_hdr, test_eth_ipv4_tcp_raw[14:34]) {
+        t.Fatalf("IPv4 header mismatch: %x", ip4_hdr)
     }
 
-    udp_pkt := layers.FindLayer(pkt, packet.UDP)
-    if udp_pkt != nil {
-        t.Fatalf("Not nil: %s", udp_pkt)
+    tcp_hdr := pkt.Payload().Payload().HeaderBytes()
+    if !bytes.Equal(tcp_hdr, test_eth_ipv4_tcp_raw[34:54]) {
+        t.Fatalf("TCP header mismatch: %x", tcp_hdr)
+    }
+
+    ip4_pkt := ipv4.Make()
+    ip4_pkt.SrcAddr = net.ParseIP(ipsrc_str)
+    ip4_pkt.DstAddr = net.ParseIP(ipdst_str)
+
+    tcp_pkt := tcp.Make()
+    tcp_pkt.SrcPort = 41562
+    tcp_pkt.DstPort = 8338
+    tcp_pkt.Flags   = tcp.Syn
+    tcp_pkt.WindowSize = 8192
+
+    raw_pkt := raw.Make()
+    raw_pkt.Data = []byte("fdg agfh ldfhgk hfdkgh kfjdhsg kshfdgk")
+
+    _, err = layers.Compose(ip4_pkt, tcp_pkt, raw_pkt)
+    if err != nil {
+        t.Fatalf("Error composing: %s", err)
+    }
+
+    tcp_hdr = tcp_pkt.HeaderBytes()
+    if !bytes.Equal(tcp_hdr, test_eth_ipv4_tcp_raw[34:54]) {
+        t.Fatalf("TCP header mismatch: %x", tcp_hdr)
+    }
+
+    if tcp_pkt.Checksum != 0 {
+        t.Fatalf("Packet modified: %s", tcp_pkt)
     }
 }
 
-func ExamplePack() {
-    // Create an Ethernet packet
+func TestUnpackAllTruncated(t *testing.T) {
     eth_pkt := eth.Make()
-    eth_pkt.SrcAddr, _ = net.ParseMAC("4c:72:b9:54:e5:3d")
-    eth_pkt.DstAddr, _ = net.ParseMAC("ff:ff:ff:ff:ff:ff")
+    eth_pkt.SrcAddr, _ = net.ParseMAC(hwsrc_str)
+    eth_pkt.DstAddr, _ = net.ParseMAC(hwdst_str)
 
-    // Create an ARP packet
-    arp_pkt := arp.Make()
-    arp_pkt.HWSrcAddr, _ = net.ParseMAC("4c:72:b9:54:e5:3d")
-    arp_pkt.HWDstAddr, _ = net.ParseMAC("00:00:00:00:00:00")
-    arp_pkt.ProtoSrcAddr = net.ParseIP("192.168.1.135")
-    arp_pkt.ProtoDstAddr = net.ParseIP("192.168.1.254")
+    ip4_pkt := ipv4.Make()
+    ip4_pkt.SrcAddr = net.ParseIP(ipsrc_str)
+    ip4_pkt.DstAddr = net.ParseIP(ipdst_str)
 
-    buf, err := layers.Pack(eth_pkt, arp_pkt)
+    tcp_pkt := tcp.Make()
+    tcp_pkt.SrcPort = 41562
+    tcp_pkt.DstPort = 8338
+    tcp_pkt.Flags   = tcp.Syn
+    tcp_pkt.DataOff = 8
+    tcp_pkt.Options = []tcp.Option{
+        { Type: tcp.MSS, Len: 4, Data: []byte{ 0x05, 0xb4 } },
+        { Type: tcp.Nop },
+        { Type: tcp.WindowScale, Len: 3, Data: []byte{ 0x07 } },
+        { Type: tcp.SAckOk, Len: 2 },
+        { Type: tcp.Nop },
+        { Type: tcp.Nop },
+    }
+
+    buf, err := layers.Pack(eth_pkt, ip4_pkt, tcp_pkt)
     if err != nil {
-        log.Fatal(err)
+        t.Fatalf("Error packing: %s", err)
     }
 
-    // do something with the packet
-    log.Println(buf)
-}
+    /* cut the capture in the middle of the window scale option */
+    data := buf[:14 + 20 + 20 + 6]
 
-func ExampleUnpack() {
-    // Create the buf data
-    buf := []byte("random data")
+    _, err = layers.UnpackAll(data, packet.Eth)
+    if !errors.Is(err, packet.ErrTruncated) {
+        t.Fatalf("Truncated packet error mismatch: %v", err)
+    }
 
-    // Assume Ethernet as datalink layer
-    pkt, err := layers.UnpackAll(buf, packet.Eth)
+    opts := packet.DecodeOptions{ Truncated: true }
+
+    pkt, err := layers.UnpackAllWith(data, packet.Eth, opts)
     if err != nil {
-        log.Fatal(err)
+        t.Fatalf("Error unpacking: %s", err)
+    }
+
+    tcp_dec, ok := layers.FindLayer(pkt, packet.TCP).(*tcp.Packet)
+    if !ok || tcp_dec.SrcPort != 41562 || tcp_dec.DstPort != 8338 ||
+       tcp_dec.Flags != tcp.Syn {
+        t.Fatalf("Packet mismatch: %s", pkt)
+    }
+
+    marker, ok := tcp_dec.Payload().(*truncated.Packet)
+    if !ok {
+        t.Fatalf("Truncated marker missing: %s", pkt)
+    }
+
+    if marker.Layer != packet.TCP ||
+       marker.Missing != uint32(len(buf) - len(data)) {
+        t.Fatalf("Truncated marker mismatch: %s", marker)
+    }
+}
+
+func TestFindLayer(t *testing.T) {
+    pkt, err := layers.UnpackAll(test_eth_ipv4_tcp, packet.Eth)
+    if err != nil {
+        t.Fatalf("Error unpacking: %s", err)
+    }
+
+    ipv4_pkt := layers.FindLayer(pkt, packet.IPv4)
+    if ipv4_pkt == nil || ipv4_pkt.GetType() != packet.IPv4 {
+        t.Fatalf("Not IPv4: %s", ipv4_pkt)
+    }
+
+    tcp_pkt := layers.FindLayer(pkt, packet.TCP)
+    if tcp_pkt == nil || tcp_pkt.GetType() != packet.TCP {
+        t.Fatalf("Not TCP: %s", tcp_pkt)
+    }
+
+    udp_pkt := layers.FindLayer(pkt, packet.UDP)
+    if udp_pkt != nil {
+        t.Fatalf("Not nil: %s", udp_pkt)
+    }
+}
+
+func TestUnpackAllRegisteredProtocol(t *testing.T) {
+    ipv4.RegisterProtocol(253, packet.UDP)
+    defer ipv4.UnregisterProtocol(253)
+
+    buf := make([]byte, len(test_eth_ipv4_udp))
+    copy(buf, test_eth_ipv4_udp)
+    buf[23] = 253
+
+    pkt, err := layers.UnpackAll(buf, packet.Eth)
+    if err != nil {
+        t.Fatalf("Error unpacking: %s", err)
+    }
+
+    udp_pkt := layers.FindLayer(pkt, packet.UDP)
+    if udp_pkt == nil {
+        t.Fatalf("Not UDP")
+    }
+
+    if udp_pkt.(*udp.Packet).DstPort != 8338 {
+        t.Fatalf("Port mismatch: %d", udp_pkt.(*udp.Packet).DstPort)
+    }
+}
+
+var test_tls_client_hello = []byte{
+    0x16, 0x03, 0x01, 0x00, 0x43, 0x01, 0x00, 0x00, 0x3f, 0x03, 0x03, 0x00,
+    0x01, 0x02, 0x03, 0x04, 0x05, 0x06, 0x07, 0x08, 0x09, 0x0a, 0x0b, 0x0c,
+    0x0d, 0x0e, 0x0f, 0x10, 0x11, 0x12, 0x13, 0x14, 0x15, 0x16, 0x17, 0x18,
+    0x19, 0x1a, 0x1b, 0x1c, 0x1d, 0x1e, 0x1f, 0x00, 0x00, 0x02, 0x13, 0x01,
+    0x01, 0x00, 0x00, 0x14, 0x00, 0x00, 0x00, 0x10, 0x00, 0x0e, 0x00, 0x00,
+    0x0b, 0x65, 0x78, 0x61, 0x6d, 0x70, 0x6c, 0x65, 0x2e, 0x63, 0x6f, 0x6d,
+}
+
+func TestUnpackAllEthIPv4TCPTLS(t *testing.T) {
+    eth_pkt := eth.Make()
+    eth_pkt.SrcAddr, _ = net.ParseMAC(hwsrc_str)
+    eth_pkt.DstAddr, _ = net.ParseMAC(hwdst_str)
+
+    ip4_pkt := ipv4.Make()
+    ip4_pkt.SrcAddr = net.ParseIP(ipsrc_str)
+    ip4_pkt.DstAddr = net.ParseIP(ipdst_str)
+
+    tcp_pkt := tcp.Make()
+    tcp_pkt.SrcPort = 41562
+    tcp_pkt.DstPort = 443
+
+    raw_pkt := raw.Make()
+    raw_pkt.Data = test_tls_client_hello
+
+    buf, err := layers.Pack(eth_pkt, ip4_pkt, tcp_pkt, raw_pkt)
+    if err != nil {
+        t.Fatalf("Error packing: %s", err)
+    }
+
+    pkt, err := layers.UnpackAll(buf, packet.Eth)
+    if err != nil {
+        t.Fatalf("Error unpacking: %s", err)
+    }
+
+    tls_pkt := layers.FindLayer(pkt, packet.TLS)
+    if tls_pkt == nil {
+        t.Fatalf("Not TLS")
+    }
+
+    if tls_pkt.(*tls.Packet).ServerName != "example.com" {
+        t.Fatalf("Server name mismatch: %s", tls_pkt.(*tls.Packet).ServerName)
+    }
+}
+
+func TestUnpackAllEthFCoE(t *testing.T) {
+    eth_pkt := eth.Make()
+    eth_pkt.SrcAddr, _ = net.ParseMAC(hwsrc_str)
+    eth_pkt.DstAddr, _ = net.ParseMAC(hwdst_str)
+
+    fcoe_pkt := fcoe.Make()
+    fcoe_pkt.RCtl  = 0x22
+    fcoe_pkt.DstId = 0xfffffe
+    fcoe_pkt.Type  = fcoe.ELS
+    fcoe_pkt.OXId  = 0x1234
+    fcoe_pkt.Data  = []byte{ 0x04, 0x00, 0x00, 0x00 }
+
+    buf, err := layers.Pack(eth_pkt, fcoe_pkt)
+    if err != nil {
+        t.Fatalf("Error packing: %s", err)
+    }
+
+    pkt, err := layers.UnpackAll(buf, packet.Eth)
+    if err != nil {
+        t.Fatalf("Error unpacking: %s", err)
+    }
+
+    fc_pkt := layers.FindLayer(pkt, packet.FCoE)
+    if fc_pkt == nil {
+        t.Fatalf("Not FCoE")
+    }
+
+    if !fc_pkt.Equals(fcoe_pkt) {
+        t.Fatalf("Packet mismatch:\n%s\n%s", fc_pkt, fcoe_pkt)
+    }
+}
+
+func make_eth_ipv4_icmpv4(src, dst string, icmp_type icmpv4.Type, id uint16) packet.Packet {
+    eth_pkt := eth.Make()
+    eth_pkt.SrcAddr, _ = net.ParseMAC(hwsrc_str)
+    eth_pkt.DstAddr, _ = net.ParseMAC(hwdst_str)
+
+    ip4_pkt := ipv4.Make()
+    ip4_pkt.SrcAddr = net.ParseIP(src)
+    ip4_pkt.DstAddr = net.ParseIP(dst)
+
+    icmp4_pkt := icmpv4.Make()
+    icmp4_pkt.Type = icmp_type
+    icmp4_pkt.Id   = id
+    icmp4_pkt.Seq  = 1
+
+    pkt, _ := layers.Compose(eth_pkt, ip4_pkt, icmp4_pkt)
+
+    return pkt
+}
+
+func TestAnswersEthIPv4ICMPv4(t *testing.T) {
+    req := make_eth_ipv4_icmpv4(ipsrc_str, ipdst_str, icmpv4.EchoRequest, 15)
+    rsp := make_eth_ipv4_icmpv4(ipdst_str, ipsrc_str, icmpv4.EchoReply, 15)
+
+    if !rsp.Answers(req) {
+        t.Fatalf("Echo reply does not answer echo request")
+    }
+
+    if req.Answers(rsp) {
+        t.Fatalf("Echo request answers echo reply")
+    }
+
+    rsp = make_eth_ipv4_icmpv4(ipdst_str, ipsrc_str, icmpv4.EchoReply, 16)
+
+    if rsp.Answers(req) {
+        t.Fatalf("Echo reply answers echo request with different id")
+    }
+}
+
+func make_eth_vlan_arp(op arp.Operation, vlan_id uint16,
+                       ip_src, ip_dst string) packet.Packet {
+    eth_pkt := eth.Make()
+    eth_pkt.SrcAddr, _ = net.ParseMAC(hwsrc_str)
+    eth_pkt.DstAddr, _ = net.ParseMAC("ff:ff:ff:ff:ff:ff")
+
+    vlan_pkt := vlan.Make(vlan_id)
+
+    arp_pkt := arp.Make()
+    arp_pkt.Operation    = op
+    arp_pkt.HWSrcAddr, _ = net.ParseMAC(hwsrc_str)
+    arp_pkt.HWDstAddr, _ = net.ParseMAC("00:00:00:00:00:00")
+    arp_pkt.ProtoSrcAddr = net.ParseIP(ip_src)
+    arp_pkt.ProtoDstAddr = net.ParseIP(ip_dst)
+
+    pkt, _ := layers.Compose(eth_pkt, vlan_pkt, arp_pkt)
+
+    return pkt
+}
+
+func TestAnswersEthVLANArp(t *testing.T) {
+    req := make_eth_vlan_arp(arp.Request, 135, ipsrc_str, ipdst_str)
+    rsp := make_eth_vlan_arp(arp.Reply, 135, ipdst_str, ipsrc_str)
+
+    if !rsp.Answers(req) {
+        t.Fatalf("Tagged ARP reply does not answer tagged request")
+    }
+
+    if req.Answers(rsp) {
+        t.Fatalf("Tagged ARP request answers tagged reply")
+    }
+
+    rsp = make_eth_vlan_arp(arp.Reply, 136, ipdst_str, ipsrc_str)
+
+    if rsp.Answers(req) {
+        t.Fatalf("ARP reply answers request from a different VLAN")
+    }
+
+    untagged, _ := layers.Compose(eth.Make(), arp.Make())
+
+    if untagged.Answers(req) || req.Answers(untagged) {
+        t.Fatalf("Untagged ARP packet matches tagged one")
+    }
+}
+
+func check_layers(t *testing.T, pkt packet.Packet, types ...packet.Type) {
+    for _, pkt_type := range types {
+        if pkt == nil || pkt.GetType() != pkt_type {
+            t.Fatalf("Packet type mismatch, %s instead of %s", pkt, pkt_type)
+        }
+
+        pkt = pkt.Payload()
+    }
+
+    if pkt != nil {
+        t.Fatalf("Unexpected payload: %s", pkt)
+    }
+}
+
+func TestUnpackAllEthIPv4EtherIP(t *testing.T) {
+    eth_pkt := eth.Make()
+    eth_pkt.SrcAddr, _ = net.ParseMAC(hwsrc_str)
+    eth_pkt.DstAddr, _ = net.ParseMAC(hwdst_str)
+
+    ip4_pkt := ipv4.Make()
+    ip4_pkt.SrcAddr = net.ParseIP(ipsrc_str)
+    ip4_pkt.DstAddr = net.ParseIP(ipdst_str)
+
+    etherip_pkt := etherip.Make()
+
+    inner_eth_pkt := eth.Make()
+    inner_eth_pkt.SrcAddr, _ = net.ParseMAC(hwdst_str)
+    inner_eth_pkt.DstAddr, _ = net.ParseMAC(hwsrc_str)
+
+    inner_ip4_pkt := ipv4.Make()
+    inner_ip4_pkt.SrcAddr = net.ParseIP("10.0.0.1")
+    inner_ip4_pkt.DstAddr = net.ParseIP("10.0.0.2")
+
+    udp_pkt := udp.Make()
+    udp_pkt.SrcPort = 41562
+    udp_pkt.DstPort = 8338
+
+    buf, err := layers.Pack(eth_pkt, ip4_pkt, etherip_pkt,
+                            inner_eth_pkt, inner_ip4_pkt, udp_pkt)
+    if err != nil {
+        t.Fatalf("Error packing: %s", err)
+    }
+
+    pkt, err := layers.UnpackAll(buf, packet.Eth)
+    if err != nil {
+        t.Fatalf("Error unpacking: %s", err)
+    }
+
+    check_layers(t, pkt, packet.Eth, packet.IPv4, packet.EtherIP,
+                 packet.Eth, packet.IPv4, packet.UDP)
+
+    inner := pkt.Payload().Payload().Payload()
+    if !inner.Equals(inner_eth_pkt) {
+        t.Fatalf("Packet mismatch:\n%s\n%s", inner, inner_eth_pkt)
+    }
+
+    if !inner.Payload().Equals(inner_ip4_pkt) {
+        t.Fatalf("Packet mismatch:\n%s\n%s", inner.Payload(), inner_ip4_pkt)
+    }
+}
+
+func TestUnpackAll6in4(t *testing.T) {
+    eth_pkt := eth.Make()
+    eth_pkt.SrcAddr, _ = net.ParseMAC(hwsrc_str)
+    eth_pkt.DstAddr, _ = net.ParseMAC(hwdst_str)
+
+    ip4_pkt := ipv4.Make()
+    ip4_pkt.SrcAddr = net.ParseIP(ipsrc_str)
+    ip4_pkt.DstAddr = net.ParseIP(ipdst_str)
+
+    ip6_pkt := ipv6.Make()
+    ip6_pkt.SrcAddr = net.ParseIP("2001:db8::1")
+    ip6_pkt.DstAddr = net.ParseIP("2001:db8::2")
+
+    icmp6_pkt := icmpv6.Make()
+
+    buf, err := layers.Pack(eth_pkt, ip4_pkt, ip6_pkt, icmp6_pkt)
+    if err != nil {
+        t.Fatalf("Error packing: %s", err)
+    }
+
+    if buf[23] != 41 {
+        t.Fatalf("IP protocol mismatch: %d", buf[23])
+    }
+
+    pkt, err := layers.UnpackAll(buf, packet.Eth)
+    if err != nil {
+        t.Fatalf("Error unpacking: %s", err)
+    }
+
+    check_layers(t, pkt, packet.Eth, packet.IPv4, packet.IPv6, packet.ICMPv6)
+
+    inner := layers.FindLayer(pkt, packet.IPv6)
+    if !inner.Equals(ip6_pkt) {
+        t.Fatalf("Packet mismatch:\n%s\n%s", inner, ip6_pkt)
+    }
+}
+
+func TestUnpackAll4in6(t *testing.T) {
+    eth_pkt := eth.Make()
+    eth_pkt.SrcAddr, _ = net.ParseMAC(hwsrc_str)
+    eth_pkt.DstAddr, _ = net.ParseMAC(hwdst_str)
+
+    ip6_pkt := ipv6.Make()
+    ip6_pkt.SrcAddr = net.ParseIP("2001:db8::1")
+    ip6_pkt.DstAddr = net.ParseIP("2001:db8::2")
+
+    ip4_pkt := ipv4.Make()
+    ip4_pkt.SrcAddr = net.ParseIP(ipsrc_str)
+    ip4_pkt.DstAddr = net.ParseIP(ipdst_str)
+
+    icmp4_pkt := icmpv4.Make()
+
+    buf, err := layers.Pack(eth_pkt, ip6_pkt, ip4_pkt, icmp4_pkt)
+    if err != nil {
+        t.Fatalf("Error packing: %s", err)
+    }
+
+    if buf[20] != 4 {
+        t.Fatalf("IPv6 next header mismatch: %d", buf[20])
+    }
+
+    pkt, err := layers.UnpackAll(buf, packet.Eth)
+    if err != nil {
+        t.Fatalf("Error unpacking: %s", err)
+    }
+
+    check_layers(t, pkt, packet.Eth, packet.IPv6, packet.IPv4, packet.ICMPv4)
+
+    inner := layers.FindLayer(pkt, packet.IPv4)
+    if !inner.Equals(ip4_pkt) {
+        t.Fatalf("Packet mismatch:\n%s\n%s", inner, ip4_pkt)
+    }
+}
+
+/* Decoding aliases the input data, so frames need to be copied only when the
+ * input slice is going to be reused (e.g. by the capture handle). */
+func BenchmarkUnpackAllAliased(bn *testing.B) {
+    bn.ReportAllocs()
+
+    for n := 0; n < bn.N; n++ {
+        for i := 0; i < 100000; i++ {
+            layers.UnpackAll(test_eth_ipv4_tcp_raw, packet.Eth)
+        }
+    }
+}
+
+func BenchmarkUnpackAllCopied(bn *testing.B) {
+    bn.ReportAllocs()
+
+    for n := 0; n < bn.N; n++ {
+        for i := 0; i < 100000; i++ {
+            buf := make([]byte, len(test_eth_ipv4_tcp_raw))
+            copy(buf, test_eth_ipv4_tcp_raw)
+
+            layers.UnpackAll(buf, packet.Eth)
+        }
+    }
+}
+
+func TestUnpackAllWithMaxDepth(t *testing.T) {
+    opts := packet.DecodeOptions{ MaxDepth: 2 }
+
+    pkt, err := layers.UnpackAllWith(test_eth_ipv4_tcp_raw, packet.Eth, opts)
+    if err != packet.ErrMaxDepth {
+        t.Fatalf("Max depth not detected: %v", err)
+    }
+
+    if layers.FindLayer(pkt, packet.IPv4) == nil {
+        t.Fatalf("Missing IPv4 layer")
+    }
+
+    if pkt.Payload().Payload() != nil {
+        t.Fatalf("Decoded past max depth: %s", pkt.Payload().Payload())
+    }
+}
+
+func TestUnpackAllNested(t *testing.T) {
+    buf := append([]byte{}, test_eth_vlan_arp[:12]...)
+
+    /* a crafted frame with a stack of 40 VLAN tags */
+    for i := 0; i < 40; i++ {
+        buf = append(buf, 0x81, 0x00, 0x00, byte(i))
+    }
+
+    buf = append(buf, 0x08, 0x00)
+
+    pkt, err := layers.UnpackAll(buf, packet.Eth)
+    if err != packet.ErrMaxDepth {
+        t.Fatalf("Max depth not detected: %v", err)
+    }
+
+    var depth int
+
+    for p := pkt; p != nil; p = p.Payload() {
+        depth++
+    }
+
+    if depth != packet.DefaultMaxDepth {
+        t.Fatalf("Depth mismatch: %d", depth)
+    }
+
+    opts := packet.DecodeOptions{ MaxDepth: -1 }
+
+    _, err = layers.UnpackAllWith(buf, packet.Eth, opts)
+    if err != nil {
+        t.Fatalf("Error unpacking: %s", err)
+    }
+}
+
+func TestUnpackAllMessages(t *testing.T) {
+    ip4_pkt := ipv4.Make()
+    ip4_pkt.SrcAddr = net.ParseIP(ipsrc_str)
+    ip4_pkt.DstAddr = net.ParseIP(ipdst_str)
+
+    tcp_pkt := tcp.Make()
+    tcp_pkt.SrcPort = 41562
+    tcp_pkt.DstPort = 179
+    tcp_pkt.Flags   = tcp.PSH | tcp.Ack
+
+    /* a segment with more BGP KEEPALIVE messages than DefaultMaxDepth */
+    keepalive := []byte{
+        0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff,
+        0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff,
+        0x00, 0x13, 0x04,
+    }
+
+    raw_pkt := raw.Make()
+
+    for i := 0; i < 30; i++ {
+        raw_pkt.Data = append(raw_pkt.Data, keepalive...)
+    }
+
+    buf, err := layers.Pack(ip4_pkt, tcp_pkt, raw_pkt)
+    if err != nil {
+        t.Fatalf("Error packing: %s", err)
+    }
+
+    pkt, err := layers.UnpackAll(buf, packet.IPv4)
+    if err != nil {
+        t.Fatalf("Error unpacking: %s", err)
+    }
+
+    var count int
+
+    for p := layers.FindLayer(pkt, packet.BGP); p != nil; p = p.Payload() {
+        count++
+    }
+
+    if count != 30 {
+        t.Fatalf("Message count mismatch: %d", count)
+    }
+}
+
+func TestUnpackAllInvalidUDPPayload(t *testing.T) {
+    for _, port := range []uint16{ 9, 53, 546, 2055, 2152 } {
+        eth_pkt := eth.Make()
+        eth_pkt.SrcAddr, _ = net.ParseMAC(hwsrc_str)
+        eth_pkt.DstAddr, _ = net.ParseMAC(hwdst_str)
+
+        ip4_pkt := ipv4.Make()
+        ip4_pkt.SrcAddr = net.ParseIP(ipsrc_str)
+        ip4_pkt.DstAddr = net.ParseIP(ipdst_str)
+
+        udp_pkt := udp.Make()
+        udp_pkt.SrcPort = 41562
+        udp_pkt.DstPort = port
+
+        raw_pkt := raw.Make()
+        raw_pkt.Data = []byte{ 0x01, 0x02, 0x03 }
+
+        buf, err := layers.Pack(eth_pkt, ip4_pkt, udp_pkt, raw_pkt)
+        if err != nil {
+            t.Fatalf("Error packing: %s", err)
+        }
+
+        pkt, err := layers.UnpackAll(buf, packet.Eth)
+        if err != nil {
+            t.Fatalf("Error unpacking port %d: %s", port, err)
+        }
+
+        check_layers(t, pkt, packet.Eth, packet.IPv4, packet.UDP, packet.Raw)
+
+        pl := layers.FindLayer(pkt, packet.Raw).(*raw.Packet)
+        if !bytes.Equal(pl.Data, raw_pkt.Data) {
+            t.Fatalf("Payload mismatch: %x", pl.Data)
+        }
+    }
+}
+
+func TestUnpackAllInvalidTCPPayload(t *testing.T) {
+    keepalive := []byte{
+        0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff,
+        0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff,
+        0x00, 0x13, 0x04,
+    }
+
+    /* continuation segments, starting in the middle of a message */
+    segment := []byte("some data from the previous segment")
+
+    tests := []struct {
+        port  uint16
+        data  []byte
+        types []packet.Type
+    }{
+        { 179, segment, []packet.Type{ packet.Raw } },
+        { 3868, segment, []packet.Type{ packet.Raw } },
+        { 179, append(keepalive, keepalive[:10]...),
+          []packet.Type{ packet.BGP, packet.Raw } },
+    }
+
+    for _, test := range tests {
+        ip4_pkt := ipv4.Make()
+        ip4_pkt.SrcAddr = net.ParseIP(ipsrc_str)
+        ip4_pkt.DstAddr = net.ParseIP(ipdst_str)
+
+        tcp_pkt := tcp.Make()
+        tcp_pkt.SrcPort = 41562
+        tcp_pkt.DstPort = test.port
+        tcp_pkt.Flags   = tcp.PSH | tcp.Ack
+
+        raw_pkt := raw.Make()
+        raw_pkt.Data = test.data
+
+        buf, err := layers.Pack(ip4_pkt, tcp_pkt, raw_pkt)
+        if err != nil {
+            t.Fatalf("Error packing: %s", err)
+        }
+
+        pkt, err := layers.UnpackAll(buf, packet.IPv4)
+        if err != nil {
+            t.Fatalf("Error unpacking port %d: %s", test.port, err)
+        }
+
+        check_layers(t, pkt, append([]packet.Type{ packet.IPv4, packet.TCP },
+                                    test.types...)...)
+    }
+}
+
+func TestUnpackAllWithStopAt(t *testing.T) {
+    opts := packet.DecodeOptions{ StopAt: packet.TCP }
+
+    pkt, err := layers.UnpackAllWith(test_eth_ipv4_tcp_raw, packet.Eth, opts)
+    if err != nil {
+        t.Fatalf("Error unpacking: %s", err)
+    }
+
+    tcp_pkt := layers.FindLayer(pkt, packet.TCP)
+    if tcp_pkt == nil {
+        t.Fatalf("Missing TCP layer")
+    }
+
+    if tcp_pkt.Payload() != nil {
+        t.Fatalf("Decoded past stop layer: %s", tcp_pkt.Payload())
+    }
+}
+
+func TestUnpackAllWithCopy(t *testing.T) {
+    buf := append([]byte(nil), test_eth_ipv4_tcp...)
+
+    opts := packet.DecodeOptions{ Copy: true }
+
+    pkt, err := layers.UnpackAllWith(buf, packet.Eth, opts)
+    if err != nil {
+        t.Fatalf("Error unpacking: %s", err)
+    }
+
+    buf[0] = 0xff
+
+    eth_pkt := pkt.(*eth.Packet)
+    if eth_pkt.DstAddr[0] != test_eth_ipv4_tcp[0] {
+        t.Fatalf("Packet aliases input: %s", eth_pkt.DstAddr)
+    }
+}
+
+func TestUnpackAllRawBytes(t *testing.T) {
+    pkt, err := layers.UnpackAll(test_eth_ipv4_tcp, packet.Eth)
+    if err != nil {
+        t.Fatalf("Error unpacking: %s", err)
+    }
+
+    if !bytes.Equal(pkt.RawBytes(), test_eth_ipv4_tcp) {
+        t.Fatalf("Raw bytes mismatch: %x", pkt.RawBytes())
+    }
+
+    ip_pkt := pkt.Payload()
+    if !bytes.Equal(ip_pkt.RawBytes(), test_eth_ipv4_tcp[14:]) {
+        t.Fatalf("Raw bytes mismatch: %x", ip_pkt.RawBytes())
+    }
+
+    if ipv4.Make().RawBytes() != nil {
+        t.Fatalf("Raw bytes of packet not decoded")
+    }
+}
+
+func TestUnpackAllWithLazy(t *testing.T) {
+    opts := packet.DecodeOptions{ Lazy: true }
+
+    pkt, err := layers.UnpackAllWith(test_eth_ipv4_tcp_raw, packet.Eth, opts)
+    if err != nil {
+        t.Fatalf("Error unpacking: %s", err)
+    }
+
+    cmp, err := layers.UnpackAll(test_eth_ipv4_tcp_raw, packet.Eth)
+    if err != nil {
+        t.Fatalf("Error unpacking: %s", err)
+    }
+
+    for cmp != nil {
+        if pkt == nil || !pkt.Equals(cmp) {
+            t.Fatalf("Packet mismatch:\n%s\n%s", pkt, cmp)
+        }
+
+        pkt = pkt.Payload()
+        cmp = cmp.Payload()
+    }
+
+    if pkt != nil {
+        t.Fatalf("Unexpected payload: %s", pkt)
+    }
+}
+
+func TestUnpackAllWithLazyLength(t *testing.T) {
+    opts := packet.DecodeOptions{ Lazy: true }
+
+    pkt, err := layers.UnpackAllWith(test_eth_ipv4_tcp_raw, packet.Eth, opts)
+    if err != nil {
+        t.Fatalf("Error unpacking: %s", err)
+    }
+
+    if int(pkt.GetLength()) != len(test_eth_ipv4_tcp_raw) {
+        t.Fatalf("Length mismatch: %d", pkt.GetLength())
+    }
+}
+
+func TestUnpackAllWithTrim(t *testing.T) {
+    buf := append([]byte(nil), test_eth_ipv4_udp_raw...)
+    buf  = append(buf, make([]byte, 10)...)
+
+    pkt, err := layers.UnpackAll(buf, packet.Eth)
+    if err != nil {
+        t.Fatalf("Error unpacking: %s", err)
+    }
+
+    raw_pkt := layers.FindLayer(pkt, packet.Raw).(*raw.Packet)
+    if len(raw_pkt.Data) != 48 {
+        t.Fatalf("Padding not decoded: %x", raw_pkt.Data)
+    }
+
+    opts := packet.DecodeOptions{ Trim: true }
+
+    pkt, err = layers.UnpackAllWith(buf, packet.Eth, opts)
+    if err != nil {
+        t.Fatalf("Error unpacking: %s", err)
+    }
+
+    raw_pkt = layers.FindLayer(pkt, packet.Raw).(*raw.Packet)
+    if string(raw_pkt.Data) != "fdg agfh ldfhgk hfdkgh kfjdhsg kshfdgk" {
+        t.Fatalf("Payload mismatch: %x", raw_pkt.Data)
+    }
+
+    if int(pkt.GetLength()) != len(test_eth_ipv4_udp_raw) {
+        t.Fatalf("Length mismatch: %d", pkt.GetLength())
+    }
+}
+
+func TestUnpackAllWithFCS(t *testing.T) {
+    fcs := make([]byte, 4)
+    binary.LittleEndian.PutUint32(fcs,
+                                  crc32.ChecksumIEEE(test_eth_ipv4_udp_raw))
+
+    buf := append([]byte(nil), test_eth_ipv4_udp_raw...)
+    buf  = append(buf, fcs...)
+
+    opts := packet.DecodeOptions{ FCS: true }
+
+    pkt, err := layers.UnpackAllWith(buf, packet.Eth, opts)
+    if err != nil {
+        t.Fatalf("Error unpacking: %s", err)
+    }
+
+    eth_pkt := pkt.(*eth.Packet)
+    if !bytes.Equal(eth_pkt.FCS, fcs) || !eth_pkt.CheckFCS() {
+        t.Fatalf("FCS mismatch: %x", eth_pkt.FCS)
+    }
+
+    raw_pkt := layers.FindLayer(pkt, packet.Raw).(*raw.Packet)
+    if string(raw_pkt.Data) != "fdg agfh ldfhgk hfdkgh kfjdhsg kshfdgk" {
+        t.Fatalf("Payload mismatch: %x", raw_pkt.Data)
+    }
+
+    buf[len(buf) - 1] ^= 0xff
+
+    pkt, _ = layers.UnpackAllWith(buf, packet.Eth, opts)
+    if pkt.(*eth.Packet).CheckFCS() {
+        t.Fatalf("Invalid FCS not detected")
+    }
+
+    pkt, _ = layers.UnpackAll(buf, packet.Eth)
+    if pkt.(*eth.Packet).FCS != nil {
+        t.Fatalf("FCS stripped without option")
+    }
+}
+
+func read_ips(pkt packet.Packet) {
+    ip4_pkt := layers.FindLayer(pkt, packet.IPv4)
+    if ip4_pkt != nil {
+        _ = ip4_pkt.(*ipv4.Packet).SrcAddr
+    }
+}
+
+func BenchmarkUnpackAllIPsEager(bn *testing.B) {
+    for n := 0; n < bn.N; n++ {
+        for i := 0; i < 100000; i++ {
+            pkt, _ := layers.UnpackAll(test_eth_ipv4_tcp_raw, packet.Eth)
+            read_ips(pkt)
+        }
+    }
+}
+
+func BenchmarkUnpackAllIPsLazy(bn *testing.B) {
+    opts := packet.DecodeOptions{ Lazy: true }
+
+    for n := 0; n < bn.N; n++ {
+        for i := 0; i < 100000; i++ {
+            pkt, _ := layers.UnpackAllWith(test_eth_ipv4_tcp_raw, packet.Eth, opts)
+            read_ips(pkt)
+        }
+    }
+}
+
+func TestUnpackAllConcurrent(t *testing.T) {
+    capture := [][]byte{
+        test_eth_arp,
+        test_eth_vlan_arp,
+        test_eth_ipv4_udp,
+        test_eth_ipv4_udp_raw,
+        test_eth_ipv4_tcp,
+        test_eth_ipv4_tcp_raw,
+    }
+
+    var expected []string
+
+    for _, buf := range capture {
+        pkt, err := layers.UnpackAll(buf, packet.Eth)
+        if err != nil {
+            t.Fatalf("Error unpacking: %s", err)
+        }
+
+        expected = append(expected, pkt.String())
+    }
+
+    var wg sync.WaitGroup
+
+    errs := make(chan error, 16)
+
+    for g := 0; g < 16; g++ {
+        wg.Add(1)
+
+        go func() {
+            defer wg.Done()
+
+            for n := 0; n < 100; n++ {
+                for i, src := range capture {
+                    buf := append([]byte(nil), src...)
+
+                    pkt, err := layers.UnpackAll(buf, packet.Eth)
+                    if err != nil {
+                        errs <- err
+                        return
+                    }
+
+                    if pkt.String() != expected[i] {
+                        errs <- fmt.Errorf("Packet mismatch:\n%s\n%s",
+                                           pkt, expected[i])
+                        return
+                    }
+                }
+            }
+        }()
+    }
+
+    wg.Wait()
+    close(errs)
+
+    for err := range errs {
+        t.Fatal(err)
+    }
+}
+
+func TestUnpackAllAllocs(t *testing.T) {
+    /* allocations budgets for the hot path, only raise them with good reason */
+    budgets := []struct {
+        buf    []byte
+        allocs float64
+    }{
+        { test_eth_ipv4_udp, 17 },
+        { test_eth_ipv4_tcp, 22 },
+    }
+
+    for _, b := range budgets {
+        allocs := testing.AllocsPerRun(100, func() {
+            layers.UnpackAll(b.buf, packet.Eth)
+        })
+
+        if allocs > b.allocs {
+            t.Fatalf("Allocations over budget: %v > %v", allocs, b.allocs)
+        }
+    }
+}
+
+func ExamplePack() {
+    // Create an Ethernet packet
+    eth_pkt := eth.Make()
+    eth_pkt.SrcAddr, _ = net.ParseMAC("4c:72:b9:54:e5:3d")
+    eth_pkt.DstAddr, _ = net.ParseMAC("ff:ff:ff:ff:ff:ff")
+
+    // Create an ARP packet
+    arp_pkt := arp.Make()
+    arp_pkt.HWSrcAddr, _ = net.ParseMAC("4c:72:b9:54:e5:3d")
+    arp_pkt.HWDstAddr, _ = net.ParseMAC("00:00:00:00:00:00")
+    arp_pkt.ProtoSrcAddr = net.ParseIP("192.168.1.135")
+    arp_pkt.ProtoDstAddr = net.ParseIP("192.168.1.254")
+
+    buf, err := layers.Pack(eth_pkt, arp_pkt)
+    if err != nil {
+        log.Fatal(err)
+    }
+
+    // do something with the packet
+    log.Println(buf)
+}
+
+func ExampleUnpack() {
+    // Create the buf data
+    buf := []byte("random data")
+
+    // Assume Ethernet as datalink layer
+    pkt, err := layers.UnpackAll(buf, packet.Eth)
+    if err != nil {
+        log.Fatal(err)
     }
 
     log.Println(pkt)
 }
+
+const test_proto_type = packet.Type(0x8000)
+
+type test_proto struct {
+    raw.Packet
+}
+
+func (p *test_proto) GetType() packet.Type {
+    return test_proto_type
+}
+
+func TestRegisterType(t *testing.T) {
+    var calls int
+
+    ipv4.RegisterProtocol(200, test_proto_type)
+    defer ipv4.UnregisterProtocol(200)
+
+    layers.RegisterType(test_proto_type, func() packet.Packet {
+        calls++
+        return &test_proto{}
+    })
+
+    ip4_pkt := ipv4.Make()
+    ip4_pkt.SrcAddr = net.ParseIP(ipsrc_str)
+    ip4_pkt.DstAddr = net.ParseIP(ipdst_str)
+
+    proto_pkt := &test_proto{}
+    proto_pkt.Data = []byte{ 0x01, 0x02, 0x03, 0x04 }
+
+    buf, err := layers.Pack(ip4_pkt, proto_pkt)
+    if err != nil {
+        t.Fatalf("Error packing: %s", err)
+    }
+
+    if ip4_pkt.Protocol != 200 {
+        t.Fatalf("Protocol mismatch: %s", ip4_pkt.Protocol)
+    }
+
+    pkt, err := layers.UnpackAll(buf, packet.IPv4)
+    if err != nil {
+        t.Fatalf("Error unpacking: %s", err)
+    }
+
+    if calls != 1 {
+        t.Fatalf("Decoder not invoked: %d", calls)
+    }
+
+    pl, ok := pkt.Payload().(*test_proto)
+    if !ok || !bytes.Equal(pl.Data, proto_pkt.Data) {
+        t.Fatalf("Payload mismatch: %v", pkt.Payload())
+    }
+}
@@ -0,0 +1,223 @@
+/*
+ * Network packet analysis framework.
+ *
+ * Copyright (c) 2014, Alessandro Ghedini
+ * All rights reserved.
+ *
+ * Redistribution and use in source and binary forms, with or without
+ * modification, are permitted provided that the following conditions are
+ * met:
+ *
+ *     * Redistributions of source code must retain the above copyright
+ *       notice, this list of conditions and the following disclaimer.
+ *
+ *     * Redistributions in binary form must reproduce the above copyright
+ *       notice, this list of conditions and the following disclaimer in the
+ *       documentation and/or other materials provided with the distribution.
+ *
+ * THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS
+ * IS" AND ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO,
+ * THE IMPLIED WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR
+ * PURPOSE ARE DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT HOLDER OR
+ * CONTRIBUTORS BE LIABLE FOR ANY DIRECT, INDIRECT, INCIDENTAL, SPECIAL,
+ * EXEMPLARY, OR CONSEQUENTIAL DAMAGES (INCLUDING, BUT NOT LIMITED TO,
+ * PROCUREMENT OF SUBSTITUTE GOODS OR SERVICES; LOSS OF USE, DATA, OR
+ * PROFITS; OR BUSINESS INTERRUPTION) HOWEVER CAUSED AND ON ANY THEORY OF
+ * LIABILITY, WHETHER IN CONTRACT, STRICT LIABILITY, OR TORT (INCLUDING
+ * NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE OF THIS
+ * SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+ */
+
+package layers
+
+import "encoding/binary"
+import "net"
+
+import "github.com/adigal150/go.pkt/packet"
+import "github.com/adigal150/go.pkt/packet/ipv4"
+import "github.com/adigal150/go.pkt/packet/ipv6"
+import "github.com/adigal150/go.pkt/packet/tcp"
+import "github.com/adigal150/go.pkt/packet/udp"
+
+// The addresses and ports set by RewriteAddresses(). Nil addresses and zero
+// ports leave the corresponding fields unchanged.
+type RewriteOptions struct {
+    SrcAddr net.IP
+    DstAddr net.IP
+    SrcPort uint16
+    DstPort uint16
+}
+
+// Rewrite the addresses of the first IP layer of the given packet and the ports
+// of the TCP or UDP layer that follows it, e.g. to implement a simple NAT, then
+// update all the lengths and checksums (see packet.RewriteChecksums()).
+//
+// If the IP layer carries an ICMP error message instead, the packet embedded in
+// the message (which travelled in the opposite direction) is rewritten too,
+// with the source and destination swapped, so that e.g. traceroute works
+// through the NAT. Since the embedded packet is usually truncated, its lengths
+// and transport checksum are kept as-is (and its checksum is updated
+// incrementally), and its packets are marked to be encoded that way.
+func RewriteAddresses(head packet.Packet, opts RewriteOptions) error {
+    for p := head; p != nil; p = p.Payload() {
+        if p.GetType() != packet.IPv4 && p.GetType() != packet.IPv6 {
+            continue
+        }
+
+        rewrite_ip(p, opts, false)
+
+        l4 := p.Payload()
+        if l4 == nil {
+            break
+        }
+
+        switch l4.GetType() {
+        case packet.TCP, packet.UDP:
+            rewrite_ports(l4, opts, false, 0)
+
+        case packet.ICMPv4, packet.ICMPv6:
+            inner := l4.Payload()
+            if inner == nil {
+                break
+            }
+
+            swapped := RewriteOptions{
+                SrcAddr: opts.DstAddr,
+                DstAddr: opts.SrcAddr,
+                SrcPort: opts.DstPort,
+                DstPort: opts.SrcPort,
+            }
+
+            csum_delta := rewrite_ip(inner, swapped, true)
+
+            if inner.Payload() != nil {
+                rewrite_ports(inner.Payload(), swapped, true, csum_delta)
+            }
+        }
+
+        break
+    }
+
+    return packet.RewriteChecksums(head)
+}
+
+/* Rewrite the addresses of the given IP packet, and return the checksum delta
+ * (see checksum_delta()) to apply to the transport layer checksum, if the
+ * latter is kept as-is. If keep is true, the length is kept as-is too */
+func rewrite_ip(p packet.Packet, opts RewriteOptions, keep bool) uint32 {
+    var delta uint32
+
+    switch p := p.(type) {
+    case *ipv4.Packet:
+        if opts.SrcAddr != nil {
+            delta += checksum_delta(p.SrcAddr.To4(), opts.SrcAddr.To4())
+            p.SrcAddr = opts.SrcAddr
+        }
+
+        if opts.DstAddr != nil {
+            delta += checksum_delta(p.DstAddr.To4(), opts.DstAddr.To4())
+            p.DstAddr = opts.DstAddr
+        }
+
+        /* decoding updates the length according to the (truncated) payload,
+         * so restore the original one */
+        if keep {
+            p.KeepLength = true
+
+            if raw_bytes := p.RawBytes(); len(raw_bytes) >= 4 {
+                p.Length = binary.BigEndian.Uint16(raw_bytes[2:4])
+            }
+        }
+
+    case *ipv6.Packet:
+        if opts.SrcAddr != nil {
+            delta += checksum_delta(p.SrcAddr.To16(), opts.SrcAddr.To16())
+            p.SrcAddr = opts.SrcAddr
+        }
+
+        if opts.DstAddr != nil {
+            delta += checksum_delta(p.DstAddr.To16(), opts.DstAddr.To16())
+            p.DstAddr = opts.DstAddr
+        }
+    }
+
+    return delta
+}
+
+/* Rewrite the ports of the given TCP or UDP packet. If keep is true, the
+ * checksum is kept as-is, adjusted by the given delta plus that of the ports */
+func rewrite_ports(p packet.Packet, opts RewriteOptions, keep bool,
+                   delta uint32) {
+    var src_port, dst_port *uint16
+
+    switch p := p.(type) {
+    case *tcp.Packet:
+        src_port, dst_port = &p.SrcPort, &p.DstPort
+
+    case *udp.Packet:
+        src_port, dst_port = &p.SrcPort, &p.DstPort
+
+    default:
+        return
+    }
+
+    if opts.SrcPort != 0 {
+        delta += checksum_delta(port_bytes(*src_port), port_bytes(opts.SrcPort))
+        *src_port = opts.SrcPort
+    }
+
+    if opts.DstPort != 0 {
+        delta += checksum_delta(port_bytes(*dst_port), port_bytes(opts.DstPort))
+        *dst_port = opts.DstPort
+    }
+
+    if !keep {
+        return
+    }
+
+    switch p := p.(type) {
+    case *tcp.Packet:
+        p.Checksum     = adjust_checksum(p.Checksum, delta)
+        p.KeepChecksum = true
+
+    case *udp.Packet:
+        /* a zero UDP checksum means that there's no checksum */
+        if p.Checksum != 0 {
+            p.Checksum = adjust_checksum(p.Checksum, delta)
+        }
+
+        if raw_bytes := p.RawBytes(); len(raw_bytes) >= 6 {
+            p.Length = binary.BigEndian.Uint16(raw_bytes[4:6])
+        }
+
+        p.KeepLength   = true
+        p.KeepChecksum = true
+    }
+}
+
+/* Return the sum to add to a checksum when the old data is replaced by the new
+ * one, as per RFC 1624 */
+func checksum_delta(old, new []byte) uint32 {
+    var delta uint32
+
+    for i := 0; i + 1 < len(old) && i + 1 < len(new); i += 2 {
+        delta += uint32(^(uint16(old[i]) << 8 | uint16(old[i + 1])))
+        delta += uint32(uint16(new[i]) << 8 | uint16(new[i + 1]))
+    }
+
+    return delta
+}
+
+func adjust_checksum(csum uint16, delta uint32) uint16 {
+    sum := uint32(^csum) + delta
+
+    for sum > 0xffff {
+        sum = (sum >> 16) + (sum & 0xffff)
+    }
+
+    return ^uint16(sum)
+}
+
+func port_bytes(port uint16) []byte {
+    return []byte{ byte(port >> 8), byte(port) }
+}
@@ -0,0 +1,164 @@
+/*
+ * Network packet analysis framework.
+ *
+ * Copyright (c) 2014, Alessandro Ghedini
+ * All rights reserved.
+ *
+ * Redistribution and use in source and binary forms, with or without
+ * modification, are permitted provided that the following conditions are
+ * met:
+ *
+ *     * Redistributions of source code must retain the above copyright
+ *       notice, this list of conditions and the following disclaimer.
+ *
+ *     * Redistributions in binary form must reproduce the above copyright
+ *       notice, this list of conditions and the following disclaimer in the
+ *       documentation and/or other materials provided with the distribution.
+ *
+ * THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS
+ * IS" AND ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO,
+ * THE IMPLIED WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR
+ * PURPOSE ARE DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT HOLDER OR
+ * CONTRIBUTORS BE LIABLE FOR ANY DIRECT, INDIRECT, INCIDENTAL, SPECIAL,
+ * EXEMPLARY, OR CONSEQUENTIAL DAMAGES (INCLUDING, BUT NOT LIMITED TO,
+ * PROCUREMENT OF SUBSTITUTE GOODS OR SERVICES; LOSS OF USE, DATA, OR
+ * PROFITS; OR BUSINESS INTERRUPTION) HOWEVER CAUSED AND ON ANY THEORY OF
+ * LIABILITY, WHETHER IN CONTRACT, STRICT LIABILITY, OR TORT (INCLUDING
+ * NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE OF THIS
+ * SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+ */
+
+package layers_test
+
+import "bytes"
+import "net"
+import "testing"
+
+import "github.com/adigal150/go.pkt/layers"
+import "github.com/adigal150/go.pkt/packet"
+import "github.com/adigal150/go.pkt/packet/eth"
+import "github.com/adigal150/go.pkt/packet/icmpv4"
+import "github.com/adigal150/go.pkt/packet/ipv4"
+import "github.com/adigal150/go.pkt/packet/raw"
+import "github.com/adigal150/go.pkt/packet/udp"
+
+var nat_host_str   = "192.168.1.10"
+var nat_public_str = "203.0.113.1"
+var nat_dst_str    = "198.51.100.7"
+var nat_router_str = "198.51.100.1"
+
+func make_nat_pkt(src, dst string, l4 ...packet.Packet) ([]byte, error) {
+    ip4_pkt := ipv4.Make()
+    ip4_pkt.SrcAddr = net.ParseIP(src)
+    ip4_pkt.DstAddr = net.ParseIP(dst)
+
+    return layers.Pack(append([]packet.Packet{ eth.Make(), ip4_pkt }, l4...)...)
+}
+
+func TestRewriteAddresses(t *testing.T) {
+    udp_pkt := udp.Make()
+    udp_pkt.SrcPort = 33435
+    udp_pkt.DstPort = 33434
+
+    raw_pkt := raw.Make()
+    raw_pkt.Data = []byte("traceroute probe")
+
+    orig_buf, err := make_nat_pkt(nat_host_str, nat_dst_str, udp_pkt, raw_pkt)
+    if err != nil {
+        t.Fatalf("Error packing: %s", err)
+    }
+
+    /* outbound: translate the source */
+    out_pkt, err := layers.UnpackAll(append([]byte(nil), orig_buf...),
+                                     packet.Eth)
+    if err != nil {
+        t.Fatalf("Error unpacking: %s", err)
+    }
+
+    err = layers.RewriteAddresses(out_pkt, layers.RewriteOptions{
+        SrcAddr: net.ParseIP(nat_public_str),
+        SrcPort: 40000,
+    })
+    if err != nil {
+        t.Fatalf("Error rewriting: %s", err)
+    }
+
+    out_buf, err := layers.Pack(flatten(out_pkt)...)
+    if err != nil {
+        t.Fatalf("Error packing: %s", err)
+    }
+
+    udp_pkt.SrcPort = 40000
+
+    cmp_buf, err := make_nat_pkt(nat_public_str, nat_dst_str, udp_pkt, raw_pkt)
+    if err != nil {
+        t.Fatalf("Error packing: %s", err)
+    }
+
+    if !bytes.Equal(out_buf, cmp_buf) {
+        t.Fatalf("Outbound packet mismatch:\n%x\n%x", out_buf, cmp_buf)
+    }
+
+    /* inbound: ICMP error quoting the translated packet */
+    icmp_pkt := icmpv4.Make()
+    icmp_pkt.Type = icmpv4.TimeExceeded
+
+    quote_pkt := raw.Make()
+    quote_pkt.Data = out_buf[14:14 + 28]
+
+    in_buf, err := make_nat_pkt(nat_router_str, nat_public_str,
+                                icmp_pkt, quote_pkt)
+    if err != nil {
+        t.Fatalf("Error packing: %s", err)
+    }
+
+    in_pkt, err := layers.UnpackAll(in_buf, packet.Eth)
+    if err != nil {
+        t.Fatalf("Error unpacking: %s", err)
+    }
+
+    err = layers.RewriteAddresses(in_pkt, layers.RewriteOptions{
+        DstAddr: net.ParseIP(nat_host_str),
+        DstPort: 33435,
+    })
+    if err != nil {
+        t.Fatalf("Error rewriting: %s", err)
+    }
+
+    outer := layers.FindLayer(in_pkt, packet.IPv4).(*ipv4.Packet)
+    if !outer.DstAddr.Equal(net.ParseIP(nat_host_str)) {
+        t.Fatalf("Outer address mismatch: %s", outer)
+    }
+
+    inner := layers.FindLayer(outer.Payload(), packet.IPv4).(*ipv4.Packet)
+    if !inner.SrcAddr.Equal(net.ParseIP(nat_host_str)) ||
+       inner.Payload().(*udp.Packet).SrcPort != 33435 {
+        t.Fatalf("Inner packet mismatch: %s", inner)
+    }
+
+    in_buf, err = layers.Pack(flatten(in_pkt)...)
+    if err != nil {
+        t.Fatalf("Error packing: %s", err)
+    }
+
+    /* the quoted packet must match the untranslated one, checksums included */
+    if !bytes.Equal(in_buf[42:], orig_buf[14:14 + 28]) {
+        t.Fatalf("Inner packet mismatch:\n%x\n%x", in_buf[42:],
+                 orig_buf[14:14 + 28])
+    }
+
+    if packet.Checksum(in_buf[14:34], 0) != 0 ||
+       packet.Checksum(in_buf[34:], 0) != 0 {
+        t.Fatalf("Invalid outer checksums: %x", in_buf)
+    }
+}
+
+func flatten(pkt packet.Packet) []packet.Packet {
+    var pkts []packet.Packet
+
+    for p := pkt; p != nil; p = p.Payload() {
+        pkts = append(pkts, p)
+    }
+
+    return pkts
+}
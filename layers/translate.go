@@ -0,0 +1,190 @@
+/*
+ * Network packet analysis framework.
+ *
+ * Copyright (c) 2014, Alessandro Ghedini
+ * All rights reserved.
+ *
+ * Redistribution and use in source and binary forms, with or without
+ * modification, are permitted provided that the following conditions are
+ * met:
+ *
+ *     * Redistributions of source code must retain the above copyright
+ *       notice, this list of conditions and the following disclaimer.
+ *
+ *     * Redistributions in binary form must reproduce the above copyright
+ *       notice, this list of conditions and the following disclaimer in the
+ *       documentation and/or other materials provided with the distribution.
+ *
+ * THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS
+ * IS" AND ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO,
+ * THE IMPLIED WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR
+ * PURPOSE ARE DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT HOLDER OR
+ * CONTRIBUTORS BE LIABLE FOR ANY DIRECT, INDIRECT, INCIDENTAL, SPECIAL,
+ * EXEMPLARY, OR CONSEQUENTIAL DAMAGES (INCLUDING, BUT NOT LIMITED TO,
+ * PROCUREMENT OF SUBSTITUTE GOODS OR SERVICES; LOSS OF USE, DATA, OR
+ * PROFITS; OR BUSINESS INTERRUPTION) HOWEVER CAUSED AND ON ANY THEORY OF
+ * LIABILITY, WHETHER IN CONTRACT, STRICT LIABILITY, OR TORT (INCLUDING
+ * NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE OF THIS
+ * SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+ */
+
+package layers
+
+import "fmt"
+import "net"
+
+import "github.com/adigal150/go.pkt/packet"
+import "github.com/adigal150/go.pkt/packet/icmpv4"
+import "github.com/adigal150/go.pkt/packet/icmpv6"
+import "github.com/adigal150/go.pkt/packet/ipv4"
+import "github.com/adigal150/go.pkt/packet/ipv6"
+
+// The Well-Known Prefix used to embed IPv4 addresses in IPv6 addresses by
+// Translate46() and Translate64() (RFC 6052).
+var NAT64Prefix = net.IPNet{
+    IP:   net.ParseIP("64:ff9b::"),
+    Mask: net.CIDRMask(96, 128),
+}
+
+// Translate the given IPv6 packet, including its payload, to the equivalent
+// IPv4 packet, as done by NAT64 and 464XLAT translators (RFC 7915). Both the
+// IPv6 addresses must embed an IPv4 address in NAT64Prefix. ICMPv6 Echo
+// messages are translated to ICMPv4 ones, and other payloads (e.g. TCP and
+// UDP) are copied as-is. The lengths and checksums of the returned packet are
+// recomputed, and the given packet isn't modified.
+//
+// ICMPv6 error messages, which would require the embedded packet to be
+// translated as well, are not supported.
+func Translate46(v6 packet.Packet) (packet.Packet, error) {
+    ip6_pkt, ok := v6.(*ipv6.Packet)
+    if !ok {
+        return nil, fmt.Errorf("Not an IPv6 packet: %s", v6.GetType())
+    }
+
+    src, err := extract_ipv4_addr(ip6_pkt.SrcAddr)
+    if err != nil {
+        return nil, err
+    }
+
+    dst, err := extract_ipv4_addr(ip6_pkt.DstAddr)
+    if err != nil {
+        return nil, err
+    }
+
+    ip4_pkt := ipv4.Make()
+    ip4_pkt.Id      = 0
+    ip4_pkt.Flags   = ipv4.DontFragment
+    ip4_pkt.TOS     = ip6_pkt.Class
+    ip4_pkt.TTL     = ip6_pkt.HopLimit
+    ip4_pkt.SrcAddr = src
+    ip4_pkt.DstAddr = dst
+
+    pl := ip6_pkt.Payload()
+
+    if icmp6_pkt, ok := pl.(*icmpv6.Packet); ok {
+        icmp4_pkt := icmpv4.Make()
+
+        switch icmp6_pkt.Type {
+        case icmpv6.EchoRequest: icmp4_pkt.Type = icmpv4.EchoRequest
+        case icmpv6.EchoReply:   icmp4_pkt.Type = icmpv4.EchoReply
+        default:
+            return nil, fmt.Errorf("Untranslatable ICMPv6 message: %s",
+                                   icmp6_pkt.Type)
+        }
+
+        icmp4_pkt.Id  = uint16(icmp6_pkt.Body >> 16)
+        icmp4_pkt.Seq = uint16(icmp6_pkt.Body)
+
+        pl = icmp4_pkt
+    } else {
+        pl = packet.ClonePayload(pl)
+    }
+
+    return finalize_translation(ip4_pkt, pl)
+}
+
+// Translate the given IPv4 packet, including its payload, to the equivalent
+// IPv6 packet, embedding its addresses in NAT64Prefix. This is the reverse of
+// Translate46(), and has the same limitations.
+func Translate64(v4 packet.Packet) (packet.Packet, error) {
+    ip4_pkt, ok := v4.(*ipv4.Packet)
+    if !ok {
+        return nil, fmt.Errorf("Not an IPv4 packet: %s", v4.GetType())
+    }
+
+    src, err := embed_ipv4_addr(ip4_pkt.SrcAddr)
+    if err != nil {
+        return nil, err
+    }
+
+    dst, err := embed_ipv4_addr(ip4_pkt.DstAddr)
+    if err != nil {
+        return nil, err
+    }
+
+    ip6_pkt := ipv6.Make()
+    ip6_pkt.Class    = ip4_pkt.TOS
+    ip6_pkt.HopLimit = ip4_pkt.TTL
+    ip6_pkt.SrcAddr  = src
+    ip6_pkt.DstAddr  = dst
+
+    pl := ip4_pkt.Payload()
+
+    if icmp4_pkt, ok := pl.(*icmpv4.Packet); ok {
+        icmp6_pkt := icmpv6.Make()
+
+        switch icmp4_pkt.Type {
+        case icmpv4.EchoRequest: icmp6_pkt.Type = icmpv6.EchoRequest
+        case icmpv4.EchoReply:   icmp6_pkt.Type = icmpv6.EchoReply
+        default:
+            return nil, fmt.Errorf("Untranslatable ICMPv4 message: %s",
+                                   icmp4_pkt.Type)
+        }
+
+        icmp6_pkt.Body = uint32(icmp4_pkt.Id) << 16 | uint32(icmp4_pkt.Seq)
+
+        pl = icmp6_pkt
+    } else {
+        pl = packet.ClonePayload(pl)
+    }
+
+    return finalize_translation(ip6_pkt, pl)
+}
+
+func finalize_translation(ip, pl packet.Packet) (packet.Packet, error) {
+    if pl != nil {
+        err := ip.SetPayload(pl)
+        if err != nil {
+            return nil, err
+        }
+    }
+
+    err := packet.RewriteChecksums(ip)
+    if err != nil {
+        return nil, err
+    }
+
+    return ip, nil
+}
+
+func extract_ipv4_addr(addr net.IP) (net.IP, error) {
+    if len(addr) != net.IPv6len || !NAT64Prefix.Contains(addr) {
+        return nil, fmt.Errorf("Address outside the NAT64 prefix: %s", addr)
+    }
+
+    return packet.CloneBytes(addr[12:]), nil
+}
+
+func embed_ipv4_addr(addr net.IP) (net.IP, error) {
+    addr4 := addr.To4()
+    if addr4 == nil {
+        return nil, fmt.Errorf("Invalid IPv4 address: %s", addr)
+    }
+
+    addr6 := make(net.IP, net.IPv6len)
+
+    copy(addr6, NAT64Prefix.IP.To16())
+    copy(addr6[12:], addr4)
+
+    return addr6, nil
+}
@@ -0,0 +1,115 @@
+/*
+ * Network packet analysis framework.
+ *
+ * Copyright (c) 2014, Alessandro Ghedini
+ * All rights reserved.
+ *
+ * Redistribution and use in source and binary forms, with or without
+ * modification, are permitted provided that the following conditions are
+ * met:
+ *
+ *     * Redistributions of source code must retain the above copyright
+ *       notice, this list of conditions and the following disclaimer.
+ *
+ *     * Redistributions in binary form must reproduce the above copyright
+ *       notice, this list of conditions and the following disclaimer in the
+ *       documentation and/or other materials provided with the distribution.
+ *
+ * THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS
+ * IS" AND ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO,
+ * THE IMPLIED WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR
+ * PURPOSE ARE DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT HOLDER OR
+ * CONTRIBUTORS BE LIABLE FOR ANY DIRECT, INDIRECT, INCIDENTAL, SPECIAL,
+ * EXEMPLARY, OR CONSEQUENTIAL DAMAGES (INCLUDING, BUT NOT LIMITED TO,
+ * PROCUREMENT OF SUBSTITUTE GOODS OR SERVICES; LOSS OF USE, DATA, OR
+ * PROFITS; OR BUSINESS INTERRUPTION) HOWEVER CAUSED AND ON ANY THEORY OF
+ * LIABILITY, WHETHER IN CONTRACT, STRICT LIABILITY, OR TORT (INCLUDING
+ * NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE OF THIS
+ * SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+ */
+
+package layers_test
+
+import "bytes"
+import "net"
+import "testing"
+
+import "github.com/adigal150/go.pkt/layers"
+import "github.com/adigal150/go.pkt/packet"
+import "github.com/adigal150/go.pkt/packet/icmpv4"
+import "github.com/adigal150/go.pkt/packet/icmpv6"
+import "github.com/adigal150/go.pkt/packet/ipv4"
+import "github.com/adigal150/go.pkt/packet/ipv6"
+
+func TestTranslateICMPEcho(t *testing.T) {
+    ip6_pkt := ipv6.Make()
+    ip6_pkt.SrcAddr = net.ParseIP("64:ff9b::c000:221")
+    ip6_pkt.DstAddr = net.ParseIP("64:ff9b::c633:6407")
+
+    icmp6_pkt := icmpv6.Make()
+    icmp6_pkt.Body = 0x12340001
+
+    orig_buf, err := layers.Pack(ip6_pkt, icmp6_pkt)
+    if err != nil {
+        t.Fatalf("Error packing: %s", err)
+    }
+
+    pkt, err := layers.UnpackAll(orig_buf, packet.IPv6)
+    if err != nil {
+        t.Fatalf("Error unpacking: %s", err)
+    }
+
+    v4, err := layers.Translate46(pkt)
+    if err != nil {
+        t.Fatalf("Error translating: %s", err)
+    }
+
+    ip4_pkt := v4.(*ipv4.Packet)
+    if !ip4_pkt.SrcAddr.Equal(net.ParseIP("192.0.2.33")) ||
+       !ip4_pkt.DstAddr.Equal(net.ParseIP("198.51.100.7")) ||
+       ip4_pkt.TTL != 64 || ip4_pkt.Protocol != ipv4.ICMPv4 ||
+       ip4_pkt.Length != 28 {
+        t.Fatalf("IPv4 packet mismatch: %s", ip4_pkt)
+    }
+
+    icmp4_pkt := ip4_pkt.Payload().(*icmpv4.Packet)
+    if icmp4_pkt.Type != icmpv4.EchoRequest ||
+       icmp4_pkt.Id != 0x1234 || icmp4_pkt.Seq != 1 {
+        t.Fatalf("ICMPv4 packet mismatch: %s", icmp4_pkt)
+    }
+
+    v4_buf, err := layers.Pack(ip4_pkt, icmp4_pkt)
+    if err != nil {
+        t.Fatalf("Error packing: %s", err)
+    }
+
+    if packet.Checksum(v4_buf[:20], 0) != 0 ||
+       packet.Checksum(v4_buf[20:], 0) != 0 {
+        t.Fatalf("Invalid checksums: %x", v4_buf)
+    }
+
+    v6, err := layers.Translate64(v4)
+    if err != nil {
+        t.Fatalf("Error translating: %s", err)
+    }
+
+    v6_buf, err := layers.Pack(v6, v6.Payload())
+    if err != nil {
+        t.Fatalf("Error packing: %s", err)
+    }
+
+    if !bytes.Equal(v6_buf, orig_buf) {
+        t.Fatalf("Raw packet mismatch:\n%x\n%x", v6_buf, orig_buf)
+    }
+}
+
+func TestTranslateInvalidAddress(t *testing.T) {
+    ip6_pkt := ipv6.Make()
+    ip6_pkt.SrcAddr = net.ParseIP("2001:db8::1")
+    ip6_pkt.DstAddr = net.ParseIP("64:ff9b::c633:6407")
+
+    _, err := layers.Translate46(ip6_pkt)
+    if err == nil {
+        t.Fatalf("Address outside the NAT64 prefix translated")
+    }
+}
@@ -76,7 +76,7 @@ func Recv(c capture.Handle) (packet.Packet, error) {
 
     pkt, err := layers.UnpackAll(buf, c.LinkType())
     if err != nil {
-        return nil, fmt.Errorf("Could not unpack: %s", err)
+        return nil, fmt.Errorf("Could not unpack: %w", err)
     }
 
     return pkt, nil
@@ -0,0 +1,174 @@
+/*
+ * Network packet analysis framework.
+ *
+ * Copyright (c) 2014, Alessandro Ghedini
+ * All rights reserved.
+ *
+ * Redistribution and use in source and binary forms, with or without
+ * modification, are permitted provided that the following conditions are
+ * met:
+ *
+ *     * Redistributions of source code must retain the above copyright
+ *       notice, this list of conditions and the following disclaimer.
+ *
+ *     * Redistributions in binary form must reproduce the above copyright
+ *       notice, this list of conditions and the following disclaimer in the
+ *       documentation and/or other materials provided with the distribution.
+ *
+ * THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS
+ * IS" AND ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO,
+ * THE IMPLIED WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR
+ * PURPOSE ARE DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT HOLDER OR
+ * CONTRIBUTORS BE LIABLE FOR ANY DIRECT, INDIRECT, INCIDENTAL, SPECIAL,
+ * EXEMPLARY, OR CONSEQUENTIAL DAMAGES (INCLUDING, BUT NOT LIMITED TO,
+ * PROCUREMENT OF SUBSTITUTE GOODS OR SERVICES; LOSS OF USE, DATA, OR
+ * PROFITS; OR BUSINESS INTERRUPTION) HOWEVER CAUSED AND ON ANY THEORY OF
+ * LIABILITY, WHETHER IN CONTRACT, STRICT LIABILITY, OR TORT (INCLUDING
+ * NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE OF THIS
+ * SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+ */
+
+package arp
+
+import "bytes"
+import "net"
+import "sync"
+import "time"
+
+// Cache of the IP to MAC address bindings learned from observed ARP packets,
+// e.g. to implement a passive ARP monitor. Conflicting bindings (the same IP
+// address announced by different MAC addresses) are recorded, since they are
+// a common sign of ARP spoofing. It is safe for concurrent use.
+type Cache struct {
+    mutex     sync.Mutex
+    ttl       time.Duration
+    entries   map[string]*Entry
+    conflicts []Conflict
+}
+
+// A binding between an IP and a MAC address, and the time it was last seen.
+type Entry struct {
+    IP     net.IP
+    HWAddr net.HardwareAddr
+    Time   time.Time
+}
+
+// A change of the MAC address bound to an IP address, seen before the previous
+// binding expired.
+type Conflict struct {
+    IP        net.IP
+    OldHWAddr net.HardwareAddr
+    NewHWAddr net.HardwareAddr
+    Time      time.Time
+}
+
+// Create a new cache whose bindings expire after the given time without being
+// seen again. A zero ttl means that bindings never expire.
+func NewCache(ttl time.Duration) *Cache {
+    return &Cache{
+        ttl:     ttl,
+        entries: map[string]*Entry{},
+    }
+}
+
+// Learn the binding announced by the sender of the given packet, at the current
+// time. See ObserveAt().
+func (c *Cache) Observe(p *Packet) *Conflict {
+    return c.ObserveAt(p, time.Now())
+}
+
+// Learn the binding announced by the sender of the given packet, as seen at the
+// given time (e.g. the timestamp of a captured packet). ARP probes, which have
+// no sender IP address, are ignored.
+//
+// If the IP address was bound to a different MAC address, and the binding
+// didn't expire yet, the conflict is recorded and returned, and the new binding
+// replaces the old one. Otherwise nil is returned.
+func (c *Cache) ObserveAt(p *Packet, ts time.Time) *Conflict {
+    if p.ProtoSrcAddr == nil || p.ProtoSrcAddr.IsUnspecified() {
+        return nil
+    }
+
+    /* the packet addresses may alias the capture buffer, so copy them */
+    ip  := append(net.IP(nil), p.ProtoSrcAddr...)
+    hw  := append(net.HardwareAddr(nil), p.HWSrcAddr...)
+    key := string(ip.To16())
+
+    c.mutex.Lock()
+    defer c.mutex.Unlock()
+
+    var conflict *Conflict
+
+    entry := c.entries[key]
+    if entry != nil && !c.expired(entry, ts) &&
+       !bytes.Equal(entry.HWAddr, hw) {
+        conflict = &Conflict{
+            IP:        ip,
+            OldHWAddr: entry.HWAddr,
+            NewHWAddr: hw,
+            Time:      ts,
+        }
+
+        c.conflicts = append(c.conflicts, *conflict)
+    }
+
+    c.entries[key] = &Entry{ IP: ip, HWAddr: hw, Time: ts }
+
+    return conflict
+}
+
+// Return the MAC address bound to the given IP address, if the binding is known
+// and didn't expire.
+func (c *Cache) Lookup(ip net.IP) (net.HardwareAddr, bool) {
+    c.mutex.Lock()
+    defer c.mutex.Unlock()
+
+    entry := c.entries[string(ip.To16())]
+    if entry == nil || c.expired(entry, time.Now()) {
+        return nil, false
+    }
+
+    return entry.HWAddr, true
+}
+
+// Remove the bindings that expired at the given time.
+func (c *Cache) Expire(now time.Time) {
+    c.mutex.Lock()
+    defer c.mutex.Unlock()
+
+    for key, entry := range c.entries {
+        if c.expired(entry, now) {
+            delete(c.entries, key)
+        }
+    }
+}
+
+// Return the bindings that didn't expire yet.
+func (c *Cache) Entries() []Entry {
+    c.mutex.Lock()
+    defer c.mutex.Unlock()
+
+    var entries []Entry
+
+    now := time.Now()
+
+    for _, entry := range c.entries {
+        if !c.expired(entry, now) {
+            entries = append(entries, *entry)
+        }
+    }
+
+    return entries
+}
+
+// Return the conflicts recorded so far, oldest first.
+func (c *Cache) Conflicts() []Conflict {
+    c.mutex.Lock()
+    defer c.mutex.Unlock()
+
+    return append([]Conflict(nil), c.conflicts...)
+}
+
+func (c *Cache) expired(entry *Entry, now time.Time) bool {
+    return c.ttl > 0 && now.Sub(entry.Time) > c.ttl
+}
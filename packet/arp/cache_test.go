@@ -0,0 +1,144 @@
+/*
+ * Network packet analysis framework.
+ *
+ * Copyright (c) 2014, Alessandro Ghedini
+ * All rights reserved.
+ *
+ * Redistribution and use in source and binary forms, with or without
+ * modification, are permitted provided that the following conditions are
+ * met:
+ *
+ *     * Redistributions of source code must retain the above copyright
+ *       notice, this list of conditions and the following disclaimer.
+ *
+ *     * Redistributions in binary form must reproduce the above copyright
+ *       notice, this list of conditions and the following disclaimer in the
+ *       documentation and/or other materials provided with the distribution.
+ *
+ * THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS
+ * IS" AND ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO,
+ * THE IMPLIED WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR
+ * PURPOSE ARE DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT HOLDER OR
+ * CONTRIBUTORS BE LIABLE FOR ANY DIRECT, INDIRECT, INCIDENTAL, SPECIAL,
+ * EXEMPLARY, OR CONSEQUENTIAL DAMAGES (INCLUDING, BUT NOT LIMITED TO,
+ * PROCUREMENT OF SUBSTITUTE GOODS OR SERVICES; LOSS OF USE, DATA, OR
+ * PROFITS; OR BUSINESS INTERRUPTION) HOWEVER CAUSED AND ON ANY THEORY OF
+ * LIABILITY, WHETHER IN CONTRACT, STRICT LIABILITY, OR TORT (INCLUDING
+ * NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE OF THIS
+ * SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+ */
+
+package arp_test
+
+import "bytes"
+import "net"
+import "testing"
+import "time"
+
+import "github.com/adigal150/go.pkt/packet/arp"
+
+func make_reply(ip_str, hw_str string) *arp.Packet {
+    p := arp.Make()
+    p.Operation = arp.Reply
+
+    p.HWSrcAddr, _ = net.ParseMAC(hw_str)
+    p.HWDstAddr, _ = net.ParseMAC(hwdst_str)
+
+    p.ProtoSrcAddr = net.ParseIP(ip_str).To4()
+    p.ProtoDstAddr = net.ParseIP(ipdst_str).To4()
+
+    return p
+}
+
+func TestCacheLearn(t *testing.T) {
+    c := arp.NewCache(time.Minute)
+
+    if _, ok := c.Lookup(net.ParseIP(ipsrc_str)); ok {
+        t.Fatalf("Lookup of unknown address succeeded")
+    }
+
+    conflict := c.Observe(make_reply(ipsrc_str, hwsrc_str))
+    if conflict != nil {
+        t.Fatalf("Unexpected conflict: %v", conflict)
+    }
+
+    hw, ok := c.Lookup(net.ParseIP(ipsrc_str))
+    if !ok || hw.String() != hwsrc_str {
+        t.Fatalf("Binding mismatch: %s", hw)
+    }
+
+    probe := make_reply("0.0.0.0", hwdst_str)
+    c.Observe(probe)
+
+    if len(c.Entries()) != 1 {
+        t.Fatalf("Entry count mismatch: %d", len(c.Entries()))
+    }
+}
+
+func TestCacheAliasing(t *testing.T) {
+    c := arp.NewCache(0)
+
+    p := make_reply(ipsrc_str, hwsrc_str)
+    c.Observe(p)
+
+    p.HWSrcAddr[0] = 0xff
+
+    hw, _ := c.Lookup(net.ParseIP(ipsrc_str))
+    if hw.String() != hwsrc_str {
+        t.Fatalf("Binding aliases packet: %s", hw)
+    }
+}
+
+func TestCacheExpiry(t *testing.T) {
+    c := arp.NewCache(time.Minute)
+
+    c.ObserveAt(make_reply(ipsrc_str, hwsrc_str),
+                time.Now().Add(-2 * time.Minute))
+
+    if _, ok := c.Lookup(net.ParseIP(ipsrc_str)); ok {
+        t.Fatalf("Lookup of expired binding succeeded")
+    }
+
+    conflict := c.Observe(make_reply(ipsrc_str, hwdst_str))
+    if conflict != nil {
+        t.Fatalf("Conflict with expired binding: %v", conflict)
+    }
+
+    c.Expire(time.Now().Add(2 * time.Minute))
+
+    if len(c.Entries()) != 0 {
+        t.Fatalf("Entry count mismatch: %d", len(c.Entries()))
+    }
+}
+
+func TestCacheConflict(t *testing.T) {
+    c := arp.NewCache(time.Minute)
+
+    c.Observe(make_reply(ipsrc_str, hwsrc_str))
+
+    conflict := c.Observe(make_reply(ipsrc_str, hwdst_str))
+    if conflict == nil {
+        t.Fatalf("Conflict not detected")
+    }
+
+    if !conflict.IP.Equal(net.ParseIP(ipsrc_str)) ||
+       conflict.OldHWAddr.String() != hwsrc_str ||
+       conflict.NewHWAddr.String() != hwdst_str {
+        t.Fatalf("Conflict mismatch: %v", conflict)
+    }
+
+    hw, _ := c.Lookup(net.ParseIP(ipsrc_str))
+    if hw.String() != hwdst_str {
+        t.Fatalf("Binding not updated: %s", hw)
+    }
+
+    conflicts := c.Conflicts()
+    if len(conflicts) != 1 ||
+       !bytes.Equal(conflicts[0].NewHWAddr, conflict.NewHWAddr) {
+        t.Fatalf("Conflicts mismatch: %v", conflicts)
+    }
+
+    if c.Observe(make_reply(ipsrc_str, hwdst_str)) != nil {
+        t.Fatalf("Conflict on unchanged binding")
+    }
+}
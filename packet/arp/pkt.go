@@ -48,6 +48,8 @@ type Packet struct {
     ProtoAddrLen  uint8            `string:"plen"`
     ProtoSrcAddr  net.IP           `string:"psrc"`
     ProtoDstAddr  net.IP           `string:"pdst"`
+
+    pkt_raw       []byte           `cmp:"skip" string:"skip"`
 }
 
 type Operation uint16
@@ -69,6 +71,24 @@ func Make() *Packet {
     }
 }
 
+// Create an unsolicited ARP reply, sent to the given victim, announcing that
+// the spoofed IP address is at the attacker MAC address, e.g. to test ARP
+// spoofing detection. The packet can then be wrapped in an Ethernet frame
+// addressed to the victim MAC address.
+func Poison(victim_ip net.IP, victim_hw net.HardwareAddr,
+            spoof_ip net.IP, attacker_hw net.HardwareAddr) *Packet {
+    p := Make()
+    p.Operation = Reply
+
+    p.HWSrcAddr = append(net.HardwareAddr(nil), attacker_hw...)
+    p.HWDstAddr = append(net.HardwareAddr(nil), victim_hw...)
+
+    p.ProtoSrcAddr = spoof_ip.To4()
+    p.ProtoDstAddr = victim_ip.To4()
+
+    return p
+}
+
 func (p *Packet) GetType() packet.Type {
     return packet.ARP
 }
@@ -103,16 +123,32 @@ func (p *Packet) Pack(buf *packet.Buffer) error {
 
     buf.WriteN(p.Operation)
 
+    if len(p.HWSrcAddr) < int(p.HWAddrLen) ||
+       len(p.HWDstAddr) < int(p.HWAddrLen) {
+        return packet.Errorf(packet.ErrInvalidLength,
+                             "Invalid ARP hardware address length: %d",
+                             p.HWAddrLen)
+    }
+
+    if len(p.ProtoSrcAddr) < int(p.ProtoAddrLen) ||
+       len(p.ProtoDstAddr) < int(p.ProtoAddrLen) {
+        return packet.Errorf(packet.ErrInvalidLength,
+                             "Invalid ARP protocol address length: %d",
+                             p.ProtoAddrLen)
+    }
+
     buf.Write(p.HWSrcAddr[len(p.HWSrcAddr) - int(p.HWAddrLen):])
     buf.Write(p.ProtoSrcAddr[len(p.ProtoSrcAddr) - int(p.ProtoAddrLen):])
 
     buf.Write(p.HWDstAddr[len(p.HWDstAddr) - int(p.HWAddrLen):])
     buf.Write(p.ProtoDstAddr[len(p.ProtoDstAddr) - int(p.ProtoAddrLen):])
 
-    return nil
+    return buf.Err()
 }
 
 func (p *Packet) Unpack(buf *packet.Buffer) error {
+    p.pkt_raw = buf.Bytes()
+
     buf.ReadN(&p.HWType)
     buf.ReadN(&p.ProtoType)
 
@@ -127,6 +163,16 @@ func (p *Packet) Unpack(buf *packet.Buffer) error {
     p.HWDstAddr = net.HardwareAddr(buf.Next(int(p.HWAddrLen)))
     p.ProtoDstAddr = net.IP(buf.Next(int(p.ProtoAddrLen)))
 
+    if buf.Err() != nil {
+        return buf.Err()
+    }
+
+    /* discard the Ethernet padding following the packet */
+    if len(p.pkt_raw) > int(p.GetLength()) {
+        p.pkt_raw = p.pkt_raw[:p.GetLength()]
+        buf.Next(buf.Len())
+    }
+
     return nil
 }
 
@@ -134,6 +180,20 @@ func (p *Packet) Payload() packet.Packet {
     return nil
 }
 
+func (p *Packet) RawBytes() []byte {
+    return p.pkt_raw
+}
+
+func (p *Packet) HeaderBytes() []byte {
+    /* the packet has no payload, so decoded packets are all header, even
+     * when they are truncated */
+    if p.pkt_raw != nil {
+        return p.pkt_raw
+    }
+
+    return packet.HeaderBytes(p)
+}
+
 func (p *Packet) GuessPayloadType() packet.Type {
     return packet.None
 }
@@ -145,6 +205,17 @@ func (p *Packet) SetPayload(pl packet.Packet) error {
 func (p *Packet) InitChecksum(csum uint32) {
 }
 
+func (p *Packet) Clone() packet.Packet {
+    c := *p
+
+    c.HWSrcAddr    = packet.CloneBytes(p.HWSrcAddr)
+    c.HWDstAddr    = packet.CloneBytes(p.HWDstAddr)
+    c.ProtoSrcAddr = packet.CloneBytes(p.ProtoSrcAddr)
+    c.ProtoDstAddr = packet.CloneBytes(p.ProtoDstAddr)
+
+    return &c
+}
+
 func (p *Packet) String() string {
     return packet.Stringify(p)
 }
@@ -31,6 +31,7 @@
 package arp_test
 
 import "bytes"
+import "errors"
 import "net"
 import "testing"
 
@@ -124,3 +125,93 @@ func BenchmarkUnpack(bn *testing.B) {
         p.Unpack(&b)
     }
 }
+
+func TestPoison(t *testing.T) {
+    victim_hw, _ := net.ParseMAC(hwdst_str)
+    attacker_hw, _ := net.ParseMAC("de:ad:be:ef:00:01")
+
+    p := arp.Poison(net.ParseIP(ipdst_str), victim_hw,
+                    net.ParseIP(ipsrc_str), attacker_hw)
+
+    if p.Operation != arp.Reply ||
+       p.HWSrcAddr.String() != "de:ad:be:ef:00:01" ||
+       p.HWDstAddr.String() != hwdst_str ||
+       !p.ProtoSrcAddr.Equal(net.ParseIP(ipsrc_str)) ||
+       !p.ProtoDstAddr.Equal(net.ParseIP(ipdst_str)) {
+        t.Fatalf("Packet mismatch: %s", p)
+    }
+
+    var b packet.Buffer
+    b.Init(make([]byte, p.GetLength()))
+
+    err := p.Pack(&b)
+    if err != nil {
+        t.Fatalf("Error packing: %s", err)
+    }
+
+    var q arp.Packet
+
+    b.Init(b.Buffer())
+
+    err = q.Unpack(&b)
+    if err != nil {
+        t.Fatalf("Error unpacking: %s", err)
+    }
+
+    if !q.Equals(p) {
+        t.Fatalf("Packet mismatch:\n%s\n%s", &q, p)
+    }
+
+    c := arp.NewCache(0)
+    c.Observe(make_reply(ipsrc_str, hwsrc_str))
+
+    if c.Observe(p) == nil {
+        t.Fatalf("Poisoning not detected")
+    }
+}
+
+func TestHeaderBytesTruncated(t *testing.T) {
+    var p arp.Packet
+
+    var b packet.Buffer
+    b.Init(test_simple[:20])
+
+    /* the destination addresses are shorter than declared */
+    err := p.Unpack(&b)
+    if err != nil {
+        t.Fatalf("Error unpacking: %s", err)
+    }
+
+    if !bytes.Equal(p.HeaderBytes(), test_simple[:20]) {
+        t.Fatalf("Header mismatch: %x", p.HeaderBytes())
+    }
+
+    b.Init(make([]byte, len(test_simple)))
+
+    err = p.Pack(&b)
+    if !errors.Is(err, packet.ErrInvalidLength) {
+        t.Fatalf("Invalid length not detected: %v", err)
+    }
+}
+
+func TestPackInvalidLength(t *testing.T) {
+    var b packet.Buffer
+    b.Init(make([]byte, len(test_simple)))
+
+    p := MakeTestSimple()
+    p.HWDstAddr = p.HWDstAddr[:4]
+
+    err := p.Pack(&b)
+    if !errors.Is(err, packet.ErrInvalidLength) {
+        t.Fatalf("Invalid length not detected: %v", err)
+    }
+
+    p = MakeTestSimple()
+    p.ProtoAddrLen = 16
+    p.ProtoSrcAddr = p.ProtoSrcAddr.To4()
+
+    err = p.Pack(&b)
+    if !errors.Is(err, packet.ErrInvalidLength) {
+        t.Fatalf("Invalid length not detected: %v", err)
+    }
+}
@@ -0,0 +1,353 @@
+/*
+ * Network packet analysis framework.
+ *
+ * Copyright (c) 2014, Alessandro Ghedini
+ * All rights reserved.
+ *
+ * Redistribution and use in source and binary forms, with or without
+ * modification, are permitted provided that the following conditions are
+ * met:
+ *
+ *     * Redistributions of source code must retain the above copyright
+ *       notice, this list of conditions and the following disclaimer.
+ *
+ *     * Redistributions in binary form must reproduce the above copyright
+ *       notice, this list of conditions and the following disclaimer in the
+ *       documentation and/or other materials provided with the distribution.
+ *
+ * THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS
+ * IS" AND ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO,
+ * THE IMPLIED WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR
+ * PURPOSE ARE DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT HOLDER OR
+ * CONTRIBUTORS BE LIABLE FOR ANY DIRECT, INDIRECT, INCIDENTAL, SPECIAL,
+ * EXEMPLARY, OR CONSEQUENTIAL DAMAGES (INCLUDING, BUT NOT LIMITED TO,
+ * PROCUREMENT OF SUBSTITUTE GOODS OR SERVICES; LOSS OF USE, DATA, OR
+ * PROFITS; OR BUSINESS INTERRUPTION) HOWEVER CAUSED AND ON ANY THEORY OF
+ * LIABILITY, WHETHER IN CONTRACT, STRICT LIABILITY, OR TORT (INCLUDING
+ * NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE OF THIS
+ * SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+ */
+
+// Provides encoding and decoding for BGP (Border Gateway Protocol) packets.
+//
+// Every BGP message is decoded as a separate packet. Since multiple messages
+// may share the same TCP segment, further messages are chained as the payload
+// of the previous one.
+package bgp
+
+import "net"
+
+import "github.com/adigal150/go.pkt/packet"
+import "github.com/adigal150/go.pkt/packet/tcp"
+
+type Packet struct {
+    Marker      [16]byte      `cmp:"skip" string:"skip"`
+    Length      uint16        `string:"len"`
+    Type        Type
+
+    /* OPEN */
+    Version     uint8         `string:"ver"`
+    MyAS        uint16        `string:"as"`
+    HoldTime    uint16        `string:"hold"`
+    Id          net.IP
+    Params      []Param       `cmp:"skip" string:"skip"`
+
+    /* NOTIFICATION */
+    ErrCode     uint8         `string:"code"`
+    ErrSubcode  uint8         `string:"subcode"`
+
+    /* UPDATE, NOTIFICATION data and unknown messages */
+    Data        []byte        `cmp:"skip" string:"skip"`
+
+    // Encode the Length field as-is, instead of computing it from the
+    // message, e.g. to craft malformed packets.
+    KeepLength  bool          `cmp:"skip" string:"skip"`
+
+    pkt_payload packet.Packet `cmp:"skip" string:"skip"`
+    pkt_raw     []byte        `cmp:"skip" string:"skip"`
+}
+
+type Type uint8
+
+const (
+    Open         Type = 1
+    Update            = 2
+    Notification      = 3
+    Keepalive         = 4
+    RouteRefresh      = 5
+)
+
+type Param struct {
+    Type  uint8
+    Value []byte
+}
+
+func init() {
+    tcp.RegisterPort(179, packet.BGP)
+}
+
+func Make() *Packet {
+    p := &Packet{
+        Type: Keepalive,
+        Length: 19,
+    }
+
+    for i := range p.Marker {
+        p.Marker[i] = 0xff
+    }
+
+    return p
+}
+
+func (p *Packet) GetType() packet.Type {
+    return packet.BGP
+}
+
+func (p *Packet) GetLength() uint16 {
+    length := 19 + p.body_len()
+
+    if p.pkt_payload != nil {
+        return p.pkt_payload.GetLength() + length
+    }
+
+    return length
+}
+
+func (p *Packet) body_len() uint16 {
+    switch p.Type {
+    case Open:
+        length := uint16(10)
+
+        for _, param := range p.Params {
+            length += 2 + uint16(len(param.Value))
+        }
+
+        return length
+
+    case Notification:
+        return 2 + uint16(len(p.Data))
+
+    case Keepalive:
+        return 0
+
+    default:
+        return uint16(len(p.Data))
+    }
+}
+
+func (p *Packet) Equals(other packet.Packet) bool {
+    return packet.Compare(p, other)
+}
+
+func (p *Packet) Answers(other packet.Packet) bool {
+    return false
+}
+
+func (p *Packet) Pack(buf *packet.Buffer) error {
+    id         := net.IPv4zero.To4()
+    params_len := 0
+
+    if p.Type == Open {
+        if p.Id != nil {
+            id = p.Id.To4()
+        }
+
+        if id == nil {
+            return packet.Errorf(packet.ErrInvalidLength,
+                                 "Invalid BGP identifier: %s", p.Id)
+        }
+
+        for _, param := range p.Params {
+            if len(param.Value) > 0xff {
+                return packet.Errorf(packet.ErrInvalidLength,
+                                     "Invalid BGP OPEN parameter length: %d",
+                                     len(param.Value))
+            }
+
+            params_len += 2 + len(param.Value)
+        }
+
+        if params_len > 0xff {
+            return packet.Errorf(packet.ErrInvalidLength,
+                                 "Invalid BGP OPEN parameters length: %d",
+                                 params_len)
+        }
+    }
+
+    if !p.KeepLength {
+        p.Length = 19 + p.body_len()
+    }
+
+    buf.Write(p.Marker[:])
+    buf.WriteN(p.Length)
+    buf.WriteN(p.Type)
+
+    switch p.Type {
+    case Open:
+        buf.WriteN(p.Version)
+        buf.WriteN(p.MyAS)
+        buf.WriteN(p.HoldTime)
+        buf.Write(id)
+        buf.WriteN(uint8(params_len))
+
+        for _, param := range p.Params {
+            buf.WriteN(param.Type)
+            buf.WriteN(uint8(len(param.Value)))
+            buf.Write(param.Value)
+        }
+
+    case Notification:
+        buf.WriteN(p.ErrCode)
+        buf.WriteN(p.ErrSubcode)
+        buf.Write(p.Data)
+
+    case Keepalive:
+
+    default:
+        buf.Write(p.Data)
+    }
+
+    return buf.Err()
+}
+
+func (p *Packet) Unpack(buf *packet.Buffer) error {
+    p.pkt_raw = buf.Bytes()
+
+    if buf.Len() < 19 {
+        return packet.Errorf(packet.ErrTruncated, "Invalid BGP header")
+    }
+
+    buf.ReadN(&p.Marker)
+    buf.ReadN(&p.Length)
+    buf.ReadN(&p.Type)
+
+    for _, b := range p.Marker {
+        if b != 0xff {
+            return packet.Errorf(packet.ErrUnsupported, "Invalid BGP marker")
+        }
+    }
+
+    if p.Length < 19 {
+        return packet.Errorf(packet.ErrInvalidLength,
+                             "Invalid BGP length: %d", p.Length)
+    }
+
+    body := buf.Next(int(p.Length) - 19)
+
+    switch p.Type {
+    case Open:
+        if len(body) < 10 {
+            return packet.Errorf(packet.ErrTruncated,
+                                 "Invalid BGP OPEN message")
+        }
+
+        p.Version  = body[0]
+        p.MyAS     = uint16(body[1]) << 8 | uint16(body[2])
+        p.HoldTime = uint16(body[3]) << 8 | uint16(body[4])
+        p.Id       = net.IP(body[5:9])
+
+        params := body[10:]
+        if int(body[9]) < len(params) {
+            params = params[:body[9]]
+        }
+
+        p.Params = nil
+
+        for len(params) >= 2 {
+            param_len := int(params[1])
+            if 2 + param_len > len(params) {
+                return packet.Errorf(packet.ErrTruncated,
+                                     "Invalid BGP OPEN parameter")
+            }
+
+            p.Params = append(p.Params, Param{
+                Type:  params[0],
+                Value: params[2:2 + param_len],
+            })
+
+            params = params[2 + param_len:]
+        }
+
+    case Notification:
+        if len(body) < 2 {
+            return packet.Errorf(packet.ErrTruncated,
+                                 "Invalid BGP NOTIFICATION message")
+        }
+
+        p.ErrCode    = body[0]
+        p.ErrSubcode = body[1]
+        p.Data       = body[2:]
+
+    case Keepalive:
+
+    default:
+        p.Data = body
+    }
+
+    return buf.Err()
+}
+
+func (p *Packet) Payload() packet.Packet {
+    return p.pkt_payload
+}
+
+func (p *Packet) RawBytes() []byte {
+    return p.pkt_raw
+}
+
+func (p *Packet) HeaderBytes() []byte {
+    return packet.HeaderBytes(p)
+}
+
+func (p *Packet) GuessPayloadType() packet.Type {
+    /* multiple messages can share the same segment */
+    return packet.BGP
+}
+
+// Return true, since the payload of a message can only be the next message in
+// the same segment (see packet.MessagePacket).
+func (p *Packet) NextMessage() bool {
+    return true
+}
+
+func (p *Packet) SetPayload(pl packet.Packet) error {
+    p.pkt_payload = pl
+
+    return nil
+}
+
+func (p *Packet) InitChecksum(csum uint32) {
+}
+
+func (p *Packet) Clone() packet.Packet {
+    c := *p
+
+    c.Id          = packet.CloneBytes(p.Id)
+    c.Data        = packet.CloneBytes(p.Data)
+    c.pkt_payload = packet.ClonePayload(p.pkt_payload)
+
+    if p.Params != nil {
+        c.Params = make([]Param, len(p.Params))
+
+        for i, param := range p.Params {
+            c.Params[i] = Param{ Type: param.Type, Value: packet.CloneBytes(param.Value) }
+        }
+    }
+
+    return &c
+}
+
+func (p *Packet) String() string {
+    return packet.Stringify(p)
+}
+
+func (t Type) String() string {
+    switch t {
+    case Open:         return "open"
+    case Update:       return "update"
+    case Notification: return "notification"
+    case Keepalive:    return "keepalive"
+    case RouteRefresh: return "route-refresh"
+    default:           return "unknown"
+    }
+}
@@ -0,0 +1,264 @@
+/*
+ * Network packet analysis framework.
+ *
+ * Copyright (c) 2014, Alessandro Ghedini
+ * All rights reserved.
+ *
+ * Redistribution and use in source and binary forms, with or without
+ * modification, are permitted provided that the following conditions are
+ * met:
+ *
+ *     * Redistributions of source code must retain the above copyright
+ *       notice, this list of conditions and the following disclaimer.
+ *
+ *     * Redistributions in binary form must reproduce the above copyright
+ *       notice, this list of conditions and the following disclaimer in the
+ *       documentation and/or other materials provided with the distribution.
+ *
+ * THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS
+ * IS" AND ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO,
+ * THE IMPLIED WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR
+ * PURPOSE ARE DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT HOLDER OR
+ * CONTRIBUTORS BE LIABLE FOR ANY DIRECT, INDIRECT, INCIDENTAL, SPECIAL,
+ * EXEMPLARY, OR CONSEQUENTIAL DAMAGES (INCLUDING, BUT NOT LIMITED TO,
+ * PROCUREMENT OF SUBSTITUTE GOODS OR SERVICES; LOSS OF USE, DATA, OR
+ * PROFITS; OR BUSINESS INTERRUPTION) HOWEVER CAUSED AND ON ANY THEORY OF
+ * LIABILITY, WHETHER IN CONTRACT, STRICT LIABILITY, OR TORT (INCLUDING
+ * NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE OF THIS
+ * SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+ */
+
+package bgp_test
+
+import "bytes"
+import "errors"
+import "net"
+import "testing"
+
+import "github.com/adigal150/go.pkt/packet"
+import "github.com/adigal150/go.pkt/packet/bgp"
+
+var test_open = []byte{
+    0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff,
+    0xff, 0xff, 0xff, 0xff, 0x00, 0x25, 0x01, 0x04, 0xfd, 0xe9, 0x00, 0xb4,
+    0x0a, 0x00, 0x00, 0x01, 0x08, 0x02, 0x06, 0x01, 0x04, 0x00, 0x01, 0x00,
+    0x01,
+}
+
+var test_open_keepalive = []byte{
+    0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff,
+    0xff, 0xff, 0xff, 0xff, 0x00, 0x25, 0x01, 0x04, 0xfd, 0xe9, 0x00, 0xb4,
+    0x0a, 0x00, 0x00, 0x01, 0x08, 0x02, 0x06, 0x01, 0x04, 0x00, 0x01, 0x00,
+    0x01, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff,
+    0xff, 0xff, 0xff, 0xff, 0xff, 0x00, 0x13, 0x04,
+}
+
+func MakeTestSimple() *bgp.Packet {
+    p := bgp.Make()
+
+    p.Type     = bgp.Open
+    p.Length   = 37
+    p.Version  = 4
+    p.MyAS     = 65001
+    p.HoldTime = 180
+    p.Id       = net.ParseIP("10.0.0.1")
+    p.Params   = []bgp.Param{
+        { Type: 2, Value: []byte{ 0x01, 0x04, 0x00, 0x01, 0x00, 0x01 } },
+    }
+
+    return p
+}
+
+func TestPack(t *testing.T) {
+    var b packet.Buffer
+    b.Init(make([]byte, len(test_open)))
+
+    p := MakeTestSimple()
+
+    if p.GetLength() != uint16(len(test_open)) {
+        t.Fatalf("Length mismatch: %d", p.GetLength())
+    }
+
+    err := p.Pack(&b)
+    if err != nil {
+        t.Fatalf("Error packing: %s", err)
+    }
+
+    if !bytes.Equal(test_open, b.Buffer()) {
+        t.Fatalf("Raw packet mismatch: %x", b.Buffer())
+    }
+}
+
+func BenchmarkPack(bn *testing.B) {
+    var b packet.Buffer
+    b.Init(make([]byte, len(test_open)))
+
+    p := MakeTestSimple()
+
+    for n := 0; n < bn.N; n++ {
+        p.Pack(&b)
+    }
+}
+
+func TestUnpack(t *testing.T) {
+    var p bgp.Packet
+
+    cmp := MakeTestSimple()
+
+    var b packet.Buffer
+    b.Init(test_open)
+
+    err := p.Unpack(&b)
+    if err != nil {
+        t.Fatalf("Error unpacking: %s", err)
+    }
+
+    if !p.Equals(cmp) {
+        t.Fatalf("Packet mismatch:\n%s\n%s", &p, cmp)
+    }
+
+    if len(p.Params) != 1 || p.Params[0].Type != 2 ||
+       !bytes.Equal(p.Params[0].Value, cmp.Params[0].Value) {
+        t.Fatalf("Params mismatch: %v", p.Params)
+    }
+}
+
+func BenchmarkUnpack(bn *testing.B) {
+    var p bgp.Packet
+    var b packet.Buffer
+
+    for n := 0; n < bn.N; n++ {
+        b.Init(test_open)
+        p.Unpack(&b)
+    }
+}
+
+func TestUnpackMultiple(t *testing.T) {
+    var open bgp.Packet
+    var keepalive bgp.Packet
+
+    var b packet.Buffer
+    b.Init(test_open_keepalive)
+
+    b.NewLayer()
+
+    err := open.Unpack(&b)
+    if err != nil {
+        t.Fatalf("Error unpacking: %s", err)
+    }
+
+    if open.Type != bgp.Open || open.GuessPayloadType() != packet.BGP {
+        t.Fatalf("Type mismatch: %s", open.Type)
+    }
+
+    b.NewLayer()
+
+    err = keepalive.Unpack(&b)
+    if err != nil {
+        t.Fatalf("Error unpacking: %s", err)
+    }
+
+    if keepalive.Type != bgp.Keepalive || keepalive.Length != 19 {
+        t.Fatalf("Type mismatch: %s", keepalive.Type)
+    }
+
+    if b.Len() != 0 {
+        t.Fatalf("Trailing data: %d", b.Len())
+    }
+}
+
+func TestPackLength(t *testing.T) {
+    var b packet.Buffer
+    b.Init(make([]byte, 24))
+
+    p := bgp.Make()
+    p.Type       = bgp.Notification
+    p.ErrCode    = 6
+    p.ErrSubcode = 2
+    p.Data       = []byte{ 0x01, 0x02, 0x03 }
+
+    err := p.Pack(&b)
+    if err != nil {
+        t.Fatalf("Error packing: %s", err)
+    }
+
+    if p.Length != 24 ||
+       !bytes.Equal(b.Buffer()[16:18], []byte{ 0x00, 0x18 }) {
+        t.Fatalf("Length mismatch: %d %x", p.Length, b.Buffer())
+    }
+
+    p.Length     = 1000
+    p.KeepLength = true
+
+    b.Init(make([]byte, 24))
+
+    err = p.Pack(&b)
+    if err != nil {
+        t.Fatalf("Error packing: %s", err)
+    }
+
+    if !bytes.Equal(b.Buffer()[16:18], []byte{ 0x03, 0xe8 }) {
+        t.Fatalf("Raw packet mismatch: %x", b.Buffer())
+    }
+}
+
+func TestPackOpenNoId(t *testing.T) {
+    var b packet.Buffer
+    b.Init(make([]byte, len(test_open)))
+
+    p := MakeTestSimple()
+    p.Id = nil
+
+    err := p.Pack(&b)
+    if err != nil {
+        t.Fatalf("Error packing: %s", err)
+    }
+
+    if len(b.Buffer()) != int(p.Length) ||
+       !bytes.Equal(b.Buffer()[24:28], []byte{ 0x00, 0x00, 0x00, 0x00 }) {
+        t.Fatalf("Raw packet mismatch: %x", b.Buffer())
+    }
+
+    p.Id = net.ParseIP("fe80::1")
+
+    err = p.Pack(&b)
+    if !errors.Is(err, packet.ErrInvalidLength) {
+        t.Fatalf("Unexpected error: %v", err)
+    }
+}
+
+func TestPackOpenParamsTooLong(t *testing.T) {
+    var b packet.Buffer
+    b.Init(make([]byte, 1024))
+
+    p := MakeTestSimple()
+    p.Params = nil
+
+    for i := 0; i < 2; i++ {
+        p.Params = append(p.Params, bgp.Param{
+            Type:  2,
+            Value: make([]byte, 200),
+        })
+    }
+
+    err := p.Pack(&b)
+    if !errors.Is(err, packet.ErrInvalidLength) {
+        t.Fatalf("Unexpected error: %v", err)
+    }
+}
+
+func TestUnpackInvalidMarker(t *testing.T) {
+    var b packet.Buffer
+
+    data := append([]byte(nil), test_open...)
+    data[3] = 0x00
+
+    b.Init(data)
+
+    var p bgp.Packet
+
+    err := p.Unpack(&b)
+    if !errors.Is(err, packet.ErrUnsupported) {
+        t.Fatalf("Unexpected error: %v", err)
+    }
+}
@@ -0,0 +1,125 @@
+/*
+ * Network packet analysis framework.
+ *
+ * Copyright (c) 2014, Alessandro Ghedini
+ * All rights reserved.
+ *
+ * Redistribution and use in source and binary forms, with or without
+ * modification, are permitted provided that the following conditions are
+ * met:
+ *
+ *     * Redistributions of source code must retain the above copyright
+ *       notice, this list of conditions and the following disclaimer.
+ *
+ *     * Redistributions in binary form must reproduce the above copyright
+ *       notice, this list of conditions and the following disclaimer in the
+ *       documentation and/or other materials provided with the distribution.
+ *
+ * THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS
+ * IS" AND ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO,
+ * THE IMPLIED WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR
+ * PURPOSE ARE DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT HOLDER OR
+ * CONTRIBUTORS BE LIABLE FOR ANY DIRECT, INDIRECT, INCIDENTAL, SPECIAL,
+ * EXEMPLARY, OR CONSEQUENTIAL DAMAGES (INCLUDING, BUT NOT LIMITED TO,
+ * PROCUREMENT OF SUBSTITUTE GOODS OR SERVICES; LOSS OF USE, DATA, OR
+ * PROFITS; OR BUSINESS INTERRUPTION) HOWEVER CAUSED AND ON ANY THEORY OF
+ * LIABILITY, WHETHER IN CONTRACT, STRICT LIABILITY, OR TORT (INCLUDING
+ * NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE OF THIS
+ * SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+ */
+
+package packet
+
+import "fmt"
+
+// A BitWriter appends sub-byte fields (e.g. the version and header length of
+// an IPv4 packet) to a buffer, most significant bit first. Complete bytes are
+// written to the buffer as soon as they are filled, and errors are recorded in
+// the buffer as usual.
+type BitWriter struct {
+    buf  *Buffer
+    acc  uint64
+    bits uint
+}
+
+// A BitReader reads sub-byte fields from a buffer, most significant bit first.
+type BitReader struct {
+    buf  *Buffer
+    acc  uint64
+    bits uint
+}
+
+// Create a new bit writer appending to the given buffer.
+func NewBitWriter(buf *Buffer) *BitWriter {
+    return &BitWriter{ buf: buf }
+}
+
+// Append the lowest n bits of val, where n is at most 56.
+func (w *BitWriter) WriteBits(val uint64, n uint) {
+    if n > 56 {
+        w.buf.set_err(fmt.Errorf("Invalid bit count: %d", n))
+        return
+    }
+
+    w.acc   = w.acc << n | val & (1 << n - 1)
+    w.bits += n
+
+    for w.bits >= 8 {
+        w.bits -= 8
+        w.buf.WriteN(uint8(w.acc >> w.bits))
+    }
+
+    w.acc &= 1 << w.bits - 1
+}
+
+// Write the pending bits, if any, padding them with zeros up to the next byte
+// boundary, and return the first error encountered by the buffer.
+func (w *BitWriter) Flush() error {
+    if w.bits > 0 {
+        w.WriteBits(0, 8 - w.bits)
+    }
+
+    return w.buf.Err()
+}
+
+// Create a new bit reader reading from the given buffer.
+func NewBitReader(buf *Buffer) *BitReader {
+    return &BitReader{ buf: buf }
+}
+
+// Read the next n bits, where n is at most 56. Zero is returned in case of
+// error, which is recorded in the buffer.
+func (r *BitReader) ReadBits(n uint) uint64 {
+    if n > 56 {
+        r.buf.set_err(fmt.Errorf("Invalid bit count: %d", n))
+        return 0
+    }
+
+    for r.bits < n {
+        var b uint8
+
+        if r.buf.ReadN(&b) != nil {
+            return 0
+        }
+
+        r.acc   = r.acc << 8 | uint64(b)
+        r.bits += 8
+    }
+
+    r.bits -= n
+
+    val := r.acc >> r.bits
+
+    r.acc &= 1 << r.bits - 1
+
+    return val
+}
+
+// Discard the bits left in the current byte, so that the next read starts at
+// a byte boundary, and return the first error encountered by the buffer.
+func (r *BitReader) Align() error {
+    r.acc  = 0
+    r.bits = 0
+
+    return r.buf.Err()
+}
@@ -0,0 +1,98 @@
+/*
+ * Network packet analysis framework.
+ *
+ * Copyright (c) 2014, Alessandro Ghedini
+ * All rights reserved.
+ *
+ * Redistribution and use in source and binary forms, with or without
+ * modification, are permitted provided that the following conditions are
+ * met:
+ *
+ *     * Redistributions of source code must retain the above copyright
+ *       notice, this list of conditions and the following disclaimer.
+ *
+ *     * Redistributions in binary form must reproduce the above copyright
+ *       notice, this list of conditions and the following disclaimer in the
+ *       documentation and/or other materials provided with the distribution.
+ *
+ * THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS
+ * IS" AND ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO,
+ * THE IMPLIED WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR
+ * PURPOSE ARE DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT HOLDER OR
+ * CONTRIBUTORS BE LIABLE FOR ANY DIRECT, INDIRECT, INCIDENTAL, SPECIAL,
+ * EXEMPLARY, OR CONSEQUENTIAL DAMAGES (INCLUDING, BUT NOT LIMITED TO,
+ * PROCUREMENT OF SUBSTITUTE GOODS OR SERVICES; LOSS OF USE, DATA, OR
+ * PROFITS; OR BUSINESS INTERRUPTION) HOWEVER CAUSED AND ON ANY THEORY OF
+ * LIABILITY, WHETHER IN CONTRACT, STRICT LIABILITY, OR TORT (INCLUDING
+ * NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE OF THIS
+ * SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+ */
+
+package packet_test
+
+import "bytes"
+import "testing"
+
+import "github.com/adigal150/go.pkt/packet"
+
+func TestBits(t *testing.T) {
+    var b packet.Buffer
+    b.Init(make([]byte, 3))
+
+    w := packet.NewBitWriter(&b)
+
+    w.WriteBits(4, 4)
+    w.WriteBits(5, 4)
+    w.WriteBits(2, 3)
+    w.WriteBits(0x1abc, 13)
+
+    err := w.Flush()
+    if err != nil {
+        t.Fatalf("Error writing: %s", err)
+    }
+
+    if !bytes.Equal(b.Buffer(), []byte{ 0x45, 0x5a, 0xbc }) {
+        t.Fatalf("Raw buffer mismatch: %x", b.Buffer())
+    }
+
+    b.Init(b.Buffer())
+
+    r := packet.NewBitReader(&b)
+
+    vals := []uint64{
+        r.ReadBits(4), r.ReadBits(4), r.ReadBits(3), r.ReadBits(13),
+    }
+
+    if b.Err() != nil {
+        t.Fatalf("Error reading: %s", b.Err())
+    }
+
+    for i, v := range []uint64{ 4, 5, 2, 0x1abc } {
+        if vals[i] != v {
+            t.Fatalf("Value mismatch: %x", vals)
+        }
+    }
+
+    if r.ReadBits(1) != 0 || b.Err() == nil {
+        t.Fatalf("Short read not detected")
+    }
+}
+
+func TestBitsPadding(t *testing.T) {
+    var b packet.Buffer
+    b.Init(make([]byte, 2))
+
+    w := packet.NewBitWriter(&b)
+
+    w.WriteBits(0xff, 3)
+    w.WriteBits(1, 6)
+
+    err := w.Flush()
+    if err != nil {
+        t.Fatalf("Error writing: %s", err)
+    }
+
+    if !bytes.Equal(b.Buffer(), []byte{ 0xe0, 0x80 }) {
+        t.Fatalf("Raw buffer mismatch: %x", b.Buffer())
+    }
+}
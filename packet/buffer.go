@@ -31,24 +31,65 @@
 package packet
 
 import "encoding/binary"
+import "fmt"
+import "io"
 
 // A Buffer is a variable-sized buffer of bytes with Read and Write methods.
 // It's based on the bytes.Buffer code provided by the standard library, but
 // implements additional convenience methods.
 //
+// The first error encountered while reading or writing (e.g. a short read or a
+// write past the end of the buffer) is recorded and can be retrieved with Err().
+// Once an error has been recorded, all subsequent reads and writes do nothing,
+// so that packet encoders and decoders only need to check for errors once, at
+// the end.
+//
 // This is used internally to provide packet encoding and decoding, and should
 // not be used directly.
 type Buffer struct {
     buf       []byte
     off       int
     layer_off int
+    err       error
+    growable  bool
+}
+
+// Create a new buffer of the given size. Unlike buffers initialized with
+// Init(), the returned buffer grows when data is written past its end, so the
+// size is only an estimate of the space that will be needed. Growing the
+// buffer reallocates it, which invalidates the slices previously returned by
+// it.
+func NewBuffer(size int) *Buffer {
+    b := &Buffer{ }
+
+    b.Init(make([]byte, size))
+    b.growable = true
+
+    return b
 }
 
-// Initialize the buffer with the given slice.
+// Initialize the buffer with the given slice. The buffer will not grow past
+// the length of the slice.
 func (b *Buffer) Init(buf []byte) {
     b.buf = buf
     b.off = 0
     b.layer_off = 0
+    b.err = nil
+    b.growable = false
+}
+
+// Return the first error encountered while reading from or writing to the
+// buffer, or nil.
+func (b *Buffer) Err() error {
+    return b.err
+}
+
+func (b *Buffer) set_err(err error) error {
+    if b.err == nil {
+        b.err = err
+    }
+
+    return err
 }
 
 // Return the unread portion of the buffer as slice.
@@ -66,6 +107,26 @@ func (b *Buffer) Len() int {
     return len(b.buf) - b.off
 }
 
+// Return the number of bytes left to decode, which is what decoders use to
+// bound variable-length fields and trailers. This is the same as Len().
+func (b *Buffer) Remaining() int {
+    return b.Len()
+}
+
+// Return the unread tail of the buffer, without consuming it. The returned
+// slice aliases the buffer's data. This is the same as Bytes().
+func (b *Buffer) Rest() []byte {
+    return b.Bytes()
+}
+
+// Discard all but the first n unread bytes of the buffer. Nothing is done if
+// fewer than n bytes are left.
+func (b *Buffer) Truncate(n int) {
+    if n >= 0 && n < b.Len() {
+        b.buf = b.buf[:b.off + n]
+    }
+}
+
 // Manually set the buffer offset to off.
 func (b *Buffer) SetOffset(off int) {
     b.off = off
@@ -86,56 +147,144 @@ func (b *Buffer) LayerLen() int {
     return b.off - b.layer_off
 }
 
-// Append the contents of p to the buffer.
+// Append the contents of p to the buffer. If p doesn't fit in the buffer, the
+// buffer is grown if it was created with NewBuffer(), otherwise only the part
+// that fits is written and an error is recorded.
 func (b *Buffer) Write(p []byte) (n int, err error) {
+    if b.err != nil {
+        return 0, b.err
+    }
+
+    if b.growable && b.off + len(p) > len(b.buf) {
+        b.grow(b.off + len(p))
+    }
+
     n = copy(b.buf[b.off:], p)
     b.off += n
+
+    if n < len(p) {
+        return n, b.set_err(fmt.Errorf("Buffer overflow"))
+    }
+
     return
 }
 
-// Append the value of data to the buffer in network byter order.
-func (b *Buffer) WriteN(data interface{}) error {
-    return binary.Write(b, binary.BigEndian, data)
+func (b *Buffer) grow(size int) {
+    if size <= cap(b.buf) {
+        b.buf = b.buf[:size]
+        return
+    }
+
+    buf := make([]byte, size, 2 * cap(b.buf) + size)
+    copy(buf, b.buf)
+
+    b.buf = buf
+}
+
+// Append the values of data to the buffer in network byter order, one after
+// the other. Any fixed-size value can be written, up to 64-bit integers (e.g.
+// NTP timestamps). Slices of fixed-size values (e.g. []uint16) are written
+// element by element, so that repeated fields don't need an explicit loop.
+func (b *Buffer) WriteN(data ...interface{}) error {
+    for _, d := range data {
+        if b.err != nil {
+            return b.err
+        }
+
+        b.set_err(binary.Write(b, binary.BigEndian, d))
+    }
+
+    return b.err
 }
 
 // Append the value of data to the buffer in little endian byter order.
 func (b *Buffer) WriteL(data interface{}) error {
-    return binary.Write(b, binary.LittleEndian, data)
+    if b.err != nil {
+        return b.err
+    }
+
+    return b.set_err(binary.Write(b, binary.LittleEndian, data))
 }
 
 // Write data in network byte order to the specified offset relative to the
 // start of the current layer.
 func (b *Buffer) PutUint16N(off int, data uint16) {
+    if b.err != nil {
+        return
+    }
+
+    if b.layer_off + off < 0 || b.layer_off + off + 2 > len(b.buf) {
+        b.set_err(fmt.Errorf("Buffer overflow"))
+        return
+    }
+
     binary.BigEndian.PutUint16(b.buf[b.layer_off + off:], data)
 }
 
 // Read the next len(p) bytes from the buffer or until the buffer is drained.
+// If the buffer has no data left, io.EOF is returned.
 func (b *Buffer) Read(p []byte) (n int, err error) {
+    if b.off >= len(b.buf) && len(p) > 0 {
+        return 0, io.EOF
+    }
+
     n = copy(p, b.buf[b.off:])
     b.off += n
     return
 }
 
-// Read structured data from the buffer in network byte order.
-func (p *Buffer) ReadN(data interface{}) error {
-    return binary.Read(p, binary.BigEndian, data)
+// Read structured data from the buffer in network byte order, into each of the
+// given values in turn. Slices are filled for their whole length.
+func (p *Buffer) ReadN(data ...interface{}) error {
+    for _, d := range data {
+        if p.err != nil {
+            return p.err
+        }
+
+        p.set_err(read_err(binary.Read(p, binary.BigEndian, d)))
+    }
+
+    return p.err
 }
 
 // Read structured data from the buffer in little endian byte order.
 func (p *Buffer) ReadL(data interface{}) error {
-    return binary.Read(p, binary.LittleEndian, data)
+    if p.err != nil {
+        return p.err
+    }
+
+    return p.set_err(read_err(binary.Read(p, binary.LittleEndian, data)))
 }
 
 // Read aligned structured data from the buffer in little endian byte order.
 func (p *Buffer) ReadLAligned(data interface{}, width uintptr) error {
+    if p.err != nil {
+        return p.err
+    }
+
     p.off = ((((p.off) + ((int(width)) - 1)) & (^((int(width)) - 1))) - p.off)
 
-    return binary.Read(p, binary.LittleEndian, data)
+    return p.set_err(read_err(binary.Read(p, binary.LittleEndian, data)))
 }
 
 // Return a slice containing the next n bytes from the buffer, advancing the
-// buffer as if the bytes had been returned by Read
+// buffer as if the bytes had been returned by Read. If there are fewer than n
+// bytes in the buffer, Next returns the entire buffer.
+//
+// The returned slice aliases the buffer's underlying data, no copy is made.
+// Decoders use it to store variable-length fields (e.g. addresses), so that
+// decoded packets remain valid only as long as the input slice is not
+// modified.
 func (b *Buffer) Next(n int) []byte {
+    if b.err != nil {
+        return nil
+    }
+
+    if n < 0 {
+        b.set_err(Errorf(ErrInvalidLength, "Invalid length: %d", n))
+        return nil
+    }
+
     m := b.Len()
     if n > m {
         n = m
@@ -144,3 +293,12 @@ func (b *Buffer) Next(n int) []byte {
     b.off += n
     return data
 }
+
+/* short reads mean that the packet is truncated */
+func read_err(err error) error {
+    if err == io.EOF || err == io.ErrUnexpectedEOF {
+        return ErrTruncated
+    }
+
+    return err
+}
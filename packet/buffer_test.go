@@ -0,0 +1,283 @@
+/*
+ * Network packet analysis framework.
+ *
+ * Copyright (c) 2014, Alessandro Ghedini
+ * All rights reserved.
+ *
+ * Redistribution and use in source and binary forms, with or without
+ * modification, are permitted provided that the following conditions are
+ * met:
+ *
+ *     * Redistributions of source code must retain the above copyright
+ *       notice, this list of conditions and the following disclaimer.
+ *
+ *     * Redistributions in binary form must reproduce the above copyright
+ *       notice, this list of conditions and the following disclaimer in the
+ *       documentation and/or other materials provided with the distribution.
+ *
+ * THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS
+ * IS" AND ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO,
+ * THE IMPLIED WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR
+ * PURPOSE ARE DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT HOLDER OR
+ * CONTRIBUTORS BE LIABLE FOR ANY DIRECT, INDIRECT, INCIDENTAL, SPECIAL,
+ * EXEMPLARY, OR CONSEQUENTIAL DAMAGES (INCLUDING, BUT NOT LIMITED TO,
+ * PROCUREMENT OF SUBSTITUTE GOODS OR SERVICES; LOSS OF USE, DATA, OR
+ * PROFITS; OR BUSINESS INTERRUPTION) HOWEVER CAUSED AND ON ANY THEORY OF
+ * LIABILITY, WHETHER IN CONTRACT, STRICT LIABILITY, OR TORT (INCLUDING
+ * NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE OF THIS
+ * SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+ */
+
+package packet_test
+
+import "bytes"
+import "net"
+import "testing"
+
+import "github.com/adigal150/go.pkt/packet"
+import "github.com/adigal150/go.pkt/packet/ipv4"
+import "github.com/adigal150/go.pkt/packet/udp"
+
+func TestBufferWriteOverflow(t *testing.T) {
+    var b packet.Buffer
+    b.Init(make([]byte, 3))
+
+    b.WriteN(uint16(0x1234))
+
+    if b.Err() != nil {
+        t.Fatalf("Unexpected error: %s", b.Err())
+    }
+
+    b.WriteN(uint16(0x5678))
+
+    if b.Err() == nil {
+        t.Fatalf("Overflow not detected")
+    }
+
+    b.PutUint16N(2, 0xffff)
+
+    if b.Buffer()[2] != 0x56 {
+        t.Fatalf("Write after error: %x", b.Buffer())
+    }
+}
+
+func TestBufferReadShort(t *testing.T) {
+    var b packet.Buffer
+    b.Init([]byte{ 0x00, 0x01, 0x02 })
+
+    var v uint32
+
+    err := b.ReadN(&v)
+    if err == nil || b.Err() != err {
+        t.Fatalf("Short read not detected")
+    }
+
+    if b.Next(1) != nil {
+        t.Fatalf("Read after error")
+    }
+
+    b.Init([]byte{ 0x00, 0x01 })
+
+    if b.Err() != nil {
+        t.Fatalf("Error not reset: %s", b.Err())
+    }
+}
+
+func TestBufferUint64(t *testing.T) {
+    var b packet.Buffer
+    b.Init(make([]byte, 9))
+
+    ts := uint64(0xe3a1b2c3d4e5f607)
+
+    b.WriteN(uint8(0x01), ts)
+
+    if b.Err() != nil {
+        t.Fatalf("Error writing: %s", b.Err())
+    }
+
+    cmp := []byte{ 0x01, 0xe3, 0xa1, 0xb2, 0xc3, 0xd4, 0xe5, 0xf6, 0x07 }
+    if !bytes.Equal(b.Buffer(), cmp) {
+        t.Fatalf("Raw buffer mismatch: %x", b.Buffer())
+    }
+
+    b.Init(b.Buffer())
+
+    var v uint8
+    var r uint64
+
+    err := b.ReadN(&v, &r)
+    if err != nil {
+        t.Fatalf("Error reading: %s", err)
+    }
+
+    if r != ts {
+        t.Fatalf("Value mismatch: %x", r)
+    }
+}
+
+func TestBufferWriteSlice(t *testing.T) {
+    var b packet.Buffer
+    b.Init(make([]byte, 9))
+
+    vals := []uint16{ 0x0102, 0x0304, 0x0506 }
+
+    err := b.WriteN(uint8(0xff), vals, uint16(0x0708))
+    if err != nil {
+        t.Fatalf("Error writing: %s", err)
+    }
+
+    if !bytes.Equal(b.Buffer(), []byte{
+        0xff, 0x01, 0x02, 0x03, 0x04, 0x05, 0x06, 0x07, 0x08,
+    }) {
+        t.Fatalf("Raw buffer mismatch: %x", b.Buffer())
+    }
+
+    var first uint8
+    var last uint16
+
+    read := make([]uint16, len(vals))
+
+    b.Init(b.Buffer())
+
+    err = b.ReadN(&first, read, &last)
+    if err != nil {
+        t.Fatalf("Error reading: %s", err)
+    }
+
+    if first != 0xff || last != 0x0708 {
+        t.Fatalf("Value mismatch: %x %x", first, last)
+    }
+
+    for i := range vals {
+        if read[i] != vals[i] {
+            t.Fatalf("Slice mismatch: %x", read)
+        }
+    }
+
+    if b.WriteN(vals) == nil {
+        t.Fatalf("Overflow not detected")
+    }
+}
+
+func TestBufferRemaining(t *testing.T) {
+    var b packet.Buffer
+    b.Init([]byte{ 0x00, 0x01, 0x02, 0x03, 0x04, 0x05, 0x06, 0x07 })
+
+    if b.Remaining() != 8 {
+        t.Fatalf("Remaining mismatch: %d", b.Remaining())
+    }
+
+    b.Next(3)
+
+    if b.Remaining() != 5 || b.Rest()[0] != 0x03 {
+        t.Fatalf("Remaining mismatch: %d %x", b.Remaining(), b.Rest())
+    }
+
+    var v uint32
+    b.ReadN(&v)
+
+    if b.Remaining() != 1 || !bytes.Equal(b.Rest(), []byte{ 0x07 }) {
+        t.Fatalf("Remaining mismatch: %d %x", b.Remaining(), b.Rest())
+    }
+
+    b.Truncate(2)
+
+    if b.Remaining() != 1 {
+        t.Fatalf("Truncate extended the buffer: %d", b.Remaining())
+    }
+
+    b.Truncate(0)
+
+    if b.Remaining() != 0 || len(b.Rest()) != 0 {
+        t.Fatalf("Remaining mismatch: %d %x", b.Remaining(), b.Rest())
+    }
+
+    b.Next(10)
+
+    if b.Remaining() != 0 || len(b.Rest()) != 0 {
+        t.Fatalf("Remaining mismatch: %d %x", b.Remaining(), b.Rest())
+    }
+}
+
+func TestBufferPutOverflow(t *testing.T) {
+    var b packet.Buffer
+    b.Init(make([]byte, 4))
+
+    b.PutUint16N(3, 0x1234)
+
+    if b.Err() == nil {
+        t.Fatalf("Overflow not detected")
+    }
+}
+
+func TestPackTooSmall(t *testing.T) {
+    var b packet.Buffer
+    b.Init(make([]byte, 10))
+
+    p := ipv4.Make()
+    p.SrcAddr = net.ParseIP("192.168.1.135")
+    p.DstAddr = net.ParseIP("8.8.4.4")
+
+    err := p.Pack(&b)
+    if err == nil {
+        t.Fatalf("Overflow not detected")
+    }
+
+    if b.Err() != err {
+        t.Fatalf("Error mismatch: %s", b.Err())
+    }
+}
+
+func TestUnpackTruncated(t *testing.T) {
+    var b packet.Buffer
+    b.Init([]byte{ 0x00, 0x35, 0x00 })
+
+    var p udp.Packet
+
+    err := p.Unpack(&b)
+    if err == nil {
+        t.Fatalf("Truncation not detected")
+    }
+}
+
+func TestNewBufferGrow(t *testing.T) {
+    b := packet.NewBuffer(2)
+
+    b.WriteN(uint16(0x1234))
+    b.WriteN(uint32(0x56789abc))
+    b.Write([]byte{ 0xde, 0xf0 })
+
+    if b.Err() != nil {
+        t.Fatalf("Unexpected error: %s", b.Err())
+    }
+
+    cmp := []byte{ 0x12, 0x34, 0x56, 0x78, 0x9a, 0xbc, 0xde, 0xf0 }
+
+    if !bytes.Equal(cmp, b.Buffer()) {
+        t.Fatalf("Raw buffer mismatch: %x", b.Buffer())
+    }
+}
+
+var test_chunk = make([]byte, 100)
+
+func write_frame(b *packet.Buffer) {
+    for i := 0; i < 15; i++ {
+        b.Write(test_chunk)
+    }
+}
+
+func BenchmarkWritePresized(bn *testing.B) {
+    bn.ReportAllocs()
+
+    for n := 0; n < bn.N; n++ {
+        write_frame(packet.NewBuffer(1500))
+    }
+}
+
+func BenchmarkWriteGrow(bn *testing.B) {
+    bn.ReportAllocs()
+
+    for n := 0; n < bn.N; n++ {
+        write_frame(packet.NewBuffer(0))
+    }
+}
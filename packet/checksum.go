@@ -0,0 +1,121 @@
+/*
+ * Network packet analysis framework.
+ *
+ * Copyright (c) 2014, Alessandro Ghedini
+ * All rights reserved.
+ *
+ * Redistribution and use in source and binary forms, with or without
+ * modification, are permitted provided that the following conditions are
+ * met:
+ *
+ *     * Redistributions of source code must retain the above copyright
+ *       notice, this list of conditions and the following disclaimer.
+ *
+ *     * Redistributions in binary form must reproduce the above copyright
+ *       notice, this list of conditions and the following disclaimer in the
+ *       documentation and/or other materials provided with the distribution.
+ *
+ * THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS
+ * IS" AND ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO,
+ * THE IMPLIED WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR
+ * PURPOSE ARE DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT HOLDER OR
+ * CONTRIBUTORS BE LIABLE FOR ANY DIRECT, INDIRECT, INCIDENTAL, SPECIAL,
+ * EXEMPLARY, OR CONSEQUENTIAL DAMAGES (INCLUDING, BUT NOT LIMITED TO,
+ * PROCUREMENT OF SUBSTITUTE GOODS OR SERVICES; LOSS OF USE, DATA, OR
+ * PROFITS; OR BUSINESS INTERRUPTION) HOWEVER CAUSED AND ON ANY THEORY OF
+ * LIABILITY, WHETHER IN CONTRACT, STRICT LIABILITY, OR TORT (INCLUDING
+ * NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE OF THIS
+ * SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+ */
+
+package packet
+
+import "hash/crc32"
+import "net"
+
+// Calculate the Internet checksum (RFC 1071) of the given data, starting from
+// the given initial value (e.g. a pseudo-header sum). Data of odd length is
+// padded with a zero byte.
+func Checksum(data []byte, initial uint32) uint16 {
+    csum := initial
+
+    for i := 0; i < len(data) - 1; i += 2 {
+        csum += uint32(data[i]) << 8
+        csum += uint32(data[i + 1])
+    }
+
+    if len(data) % 2 != 0 {
+        csum += uint32(data[len(data) - 1]) << 8
+    }
+
+    for csum > 0xffff {
+        csum = (csum >> 16) + (csum & 0xffff)
+    }
+
+    return ^uint16(csum)
+}
+
+// Calculate the sum of the IPv4 pseudo-header used by the checksum of upper
+// layer protocols (e.g. TCP and UDP), to be used as initial value of
+// Checksum().
+func PseudoHeaderV4(src, dst net.IP, proto uint8, length uint16) uint32 {
+    var csum uint32
+
+    csum += sum_words(src.To4())
+    csum += sum_words(dst.To4())
+    csum += uint32(proto)
+    csum += uint32(length)
+
+    return csum
+}
+
+// Calculate the sum of the IPv6 pseudo-header used by the checksum of upper
+// layer protocols (e.g. TCP, UDP and ICMPv6), to be used as initial value of
+// Checksum(). The length is the one of the upper layer packet.
+func PseudoHeaderV6(src, dst net.IP, proto uint8, length uint32) uint32 {
+    var csum uint32
+
+    csum += sum_words(src.To16())
+    csum += sum_words(dst.To16())
+    csum += uint32(proto)
+    csum += length >> 16
+    csum += length & 0xffff
+
+    return csum
+}
+
+var castagnoli_table = crc32.MakeTable(crc32.Castagnoli)
+
+// Calculate the CRC32c (Castagnoli) checksum of the given data, as used e.g.
+// by SCTP and iSCSI. The result must be encoded in little endian byte order.
+func CRC32c(data []byte) uint32 {
+    return crc32.Checksum(data, castagnoli_table)
+}
+
+func sum_words(data []byte) uint32 {
+    var csum uint32
+
+    for i := 0; i < len(data) - 1; i += 2 {
+        csum += uint32(data[i]) << 8
+        csum += uint32(data[i + 1])
+    }
+
+    return csum
+}
+
+// Recompute the checksums (e.g. IPv4 header, ICMP, and TCP/UDP with their
+// pseudo-header) of every packet in the chain starting at head, after some of
+// their fields were modified. The payload-dependent fields are updated first
+// (see Finalize()), then the packets are encoded from the innermost one
+// outwards, so that each checksum covers the final value of its payload. The
+// encoded data is discarded. Calling this more than once has no further effect.
+func RewriteChecksums(head Packet) error {
+    err := Finalize(head)
+    if err != nil {
+        return err
+    }
+
+    _, err = pack_chain(head)
+
+    return err
+}
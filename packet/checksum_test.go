@@ -0,0 +1,187 @@
+/*
+ * Network packet analysis framework.
+ *
+ * Copyright (c) 2014, Alessandro Ghedini
+ * All rights reserved.
+ *
+ * Redistribution and use in source and binary forms, with or without
+ * modification, are permitted provided that the following conditions are
+ * met:
+ *
+ *     * Redistributions of source code must retain the above copyright
+ *       notice, this list of conditions and the following disclaimer.
+ *
+ *     * Redistributions in binary form must reproduce the above copyright
+ *       notice, this list of conditions and the following disclaimer in the
+ *       documentation and/or other materials provided with the distribution.
+ *
+ * THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS
+ * IS" AND ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO,
+ * THE IMPLIED WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR
+ * PURPOSE ARE DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT HOLDER OR
+ * CONTRIBUTORS BE LIABLE FOR ANY DIRECT, INDIRECT, INCIDENTAL, SPECIAL,
+ * EXEMPLARY, OR CONSEQUENTIAL DAMAGES (INCLUDING, BUT NOT LIMITED TO,
+ * PROCUREMENT OF SUBSTITUTE GOODS OR SERVICES; LOSS OF USE, DATA, OR
+ * PROFITS; OR BUSINESS INTERRUPTION) HOWEVER CAUSED AND ON ANY THEORY OF
+ * LIABILITY, WHETHER IN CONTRACT, STRICT LIABILITY, OR TORT (INCLUDING
+ * NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE OF THIS
+ * SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+ */
+
+package packet_test
+
+import "net"
+import "testing"
+
+import "github.com/adigal150/go.pkt/layers"
+import "github.com/adigal150/go.pkt/packet"
+import "github.com/adigal150/go.pkt/packet/eth"
+import "github.com/adigal150/go.pkt/packet/icmpv4"
+import "github.com/adigal150/go.pkt/packet/ipv4"
+import "github.com/adigal150/go.pkt/packet/raw"
+import "github.com/adigal150/go.pkt/packet/tcp"
+
+var test_checksums = []struct {
+    data []byte
+    csum uint16
+}{
+    /* RFC 1071 example */
+    { []byte{ 0x00, 0x01, 0xf2, 0x03, 0xf4, 0xf5, 0xf6, 0xf7 }, 0x220d },
+
+    /* odd length, padded with a zero byte */
+    { []byte{ 0x00, 0x01, 0xf2, 0x03, 0xf4, 0xf5, 0xf6 }, 0x2304 },
+
+    /* IPv4 header */
+    { []byte{
+        0x45, 0x00, 0x00, 0x73, 0x00, 0x00, 0x40, 0x00, 0x40, 0x11,
+        0x00, 0x00, 0xc0, 0xa8, 0x00, 0x01, 0xc0, 0xa8, 0x00, 0xc7,
+      }, 0xb861 },
+
+    { []byte{}, 0xffff },
+}
+
+func TestChecksum(t *testing.T) {
+    for _, test := range test_checksums {
+        csum := packet.Checksum(test.data, 0)
+        if csum != test.csum {
+            t.Fatalf("Checksum mismatch for %x: %x", test.data, csum)
+        }
+    }
+}
+
+func TestChecksumInitial(t *testing.T) {
+    data := []byte{ 0x00, 0x01, 0xf2, 0x03, 0xf4, 0xf5, 0xf6, 0xf7 }
+
+    csum := packet.Checksum(data[4:], 0x0001 + 0xf203)
+    if csum != 0x220d {
+        t.Fatalf("Checksum mismatch: %x", csum)
+    }
+}
+
+func TestPseudoHeaderV4(t *testing.T) {
+    src := net.ParseIP("192.168.0.1")
+    dst := net.ParseIP("192.168.0.199")
+
+    csum := packet.PseudoHeaderV4(src, dst, 17, 15)
+    if csum != 0x18238 {
+        t.Fatalf("Pseudo-header mismatch: %x", csum)
+    }
+}
+
+func TestPseudoHeaderV6(t *testing.T) {
+    src := net.ParseIP("fe80::1")
+    dst := net.ParseIP("ff02::1")
+
+    csum := packet.PseudoHeaderV6(src, dst, 58, 70000)
+    if csum != 0x20f2f {
+        t.Fatalf("Pseudo-header mismatch: %x", csum)
+    }
+}
+
+func TestCRC32c(t *testing.T) {
+    csum := packet.CRC32c([]byte("123456789"))
+    if csum != 0xe3069283 {
+        t.Fatalf("CRC32c mismatch: %x", csum)
+    }
+
+    /* RFC 3720 B.4, 32 bytes of zeros */
+    csum = packet.CRC32c(make([]byte, 32))
+    if csum != 0x8a9136aa {
+        t.Fatalf("CRC32c mismatch: %x", csum)
+    }
+}
+
+func TestRewriteChecksums(t *testing.T) {
+    ip4_pkt := ipv4.Make()
+    ip4_pkt.SrcAddr = net.ParseIP("192.168.1.135")
+    ip4_pkt.DstAddr = net.ParseIP("193.27.208.37")
+
+    tcp_pkt := tcp.Make()
+    tcp_pkt.SrcPort = 41562
+    tcp_pkt.DstPort = 8338
+
+    icmp_pkt := icmpv4.Make()
+
+    for _, l4 := range []packet.Packet{ tcp_pkt, icmp_pkt } {
+        raw_pkt := raw.Make()
+        raw_pkt.Data = []byte("payload")
+
+        buf, err := layers.Pack(eth.Make(), ip4_pkt, l4, raw_pkt)
+        if err != nil {
+            t.Fatalf("Error packing: %s", err)
+        }
+
+        pkt, err := layers.UnpackAll(buf, packet.Eth)
+        if err != nil {
+            t.Fatalf("Error unpacking: %s", err)
+        }
+
+        ip4 := layers.FindLayer(pkt, packet.IPv4).(*ipv4.Packet)
+        ip4.SrcAddr = net.ParseIP("10.0.0.1")
+
+        err = packet.RewriteChecksums(pkt)
+        if err != nil {
+            t.Fatalf("Error rewriting checksums: %s", err)
+        }
+
+        ip4_csum := ip4.Checksum
+
+        err = packet.RewriteChecksums(pkt)
+        if err != nil || ip4.Checksum != ip4_csum {
+            t.Fatalf("Rewrite not idempotent: %x %x", ip4_csum, ip4.Checksum)
+        }
+
+        /* encode the rewritten checksums as-is, and validate them */
+        var pkts []packet.Packet
+
+        for p := pkt; p != nil; p = p.Payload() {
+            switch p := p.(type) {
+            case *ipv4.Packet:   p.KeepChecksum = true
+            case *tcp.Packet:    p.KeepChecksum = true
+            case *icmpv4.Packet: p.KeepChecksum = true
+            }
+
+            pkts = append(pkts, p)
+        }
+
+        buf, err = layers.Pack(pkts...)
+        if err != nil {
+            t.Fatalf("Error packing: %s", err)
+        }
+
+        if packet.Checksum(buf[14:34], 0) != 0 {
+            t.Fatalf("Invalid IPv4 checksum: %x", buf[14:34])
+        }
+
+        seed := uint32(0)
+        if l4.GetType() == packet.TCP {
+            seed = packet.PseudoHeaderV4(ip4.SrcAddr, ip4.DstAddr,
+                                         uint8(ipv4.TCP),
+                                         uint16(len(buf) - 34))
+        }
+
+        if packet.Checksum(buf[34:], seed) != 0 {
+            t.Fatalf("Invalid %s checksum: %x", l4.GetType(), buf[34:])
+        }
+    }
+}
@@ -0,0 +1,64 @@
+/*
+ * Network packet analysis framework.
+ *
+ * Copyright (c) 2014, Alessandro Ghedini
+ * All rights reserved.
+ *
+ * Redistribution and use in source and binary forms, with or without
+ * modification, are permitted provided that the following conditions are
+ * met:
+ *
+ *     * Redistributions of source code must retain the above copyright
+ *       notice, this list of conditions and the following disclaimer.
+ *
+ *     * Redistributions in binary form must reproduce the above copyright
+ *       notice, this list of conditions and the following disclaimer in the
+ *       documentation and/or other materials provided with the distribution.
+ *
+ * THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS
+ * IS" AND ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO,
+ * THE IMPLIED WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR
+ * PURPOSE ARE DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT HOLDER OR
+ * CONTRIBUTORS BE LIABLE FOR ANY DIRECT, INDIRECT, INCIDENTAL, SPECIAL,
+ * EXEMPLARY, OR CONSEQUENTIAL DAMAGES (INCLUDING, BUT NOT LIMITED TO,
+ * PROCUREMENT OF SUBSTITUTE GOODS OR SERVICES; LOSS OF USE, DATA, OR
+ * PROFITS; OR BUSINESS INTERRUPTION) HOWEVER CAUSED AND ON ANY THEORY OF
+ * LIABILITY, WHETHER IN CONTRACT, STRICT LIABILITY, OR TORT (INCLUDING
+ * NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE OF THIS
+ * SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+ */
+package packet
+
+// Return a copy of the given data, or nil if it's nil. This is meant to help
+// implementing the Clone() method of packets, e.g. to duplicate addresses.
+func CloneBytes(data []byte) []byte {
+    if data == nil {
+        return nil
+    }
+
+    return append([]byte{}, data...)
+}
+
+// Return a deep copy of the given TLVs, values included.
+func CloneTLVs(tlvs []TLV) []TLV {
+    if tlvs == nil {
+        return nil
+    }
+
+    clone := make([]TLV, len(tlvs))
+
+    for i, tlv := range tlvs {
+        clone[i] = TLV{ Type: tlv.Type, Value: CloneBytes(tlv.Value) }
+    }
+
+    return clone
+}
+
+// Return a deep copy of the given payload, or nil if it's nil.
+func ClonePayload(p Packet) Packet {
+    if p == nil {
+        return nil
+    }
+
+    return p.Clone()
+}
@@ -0,0 +1,391 @@
+/*
+ * Network packet analysis framework.
+ *
+ * Copyright (c) 2014, Alessandro Ghedini
+ * All rights reserved.
+ *
+ * Redistribution and use in source and binary forms, with or without
+ * modification, are permitted provided that the following conditions are
+ * met:
+ *
+ *     * Redistributions of source code must retain the above copyright
+ *       notice, this list of conditions and the following disclaimer.
+ *
+ *     * Redistributions in binary form must reproduce the above copyright
+ *       notice, this list of conditions and the following disclaimer in the
+ *       documentation and/or other materials provided with the distribution.
+ *
+ * THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS
+ * IS" AND ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO,
+ * THE IMPLIED WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR
+ * PURPOSE ARE DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT HOLDER OR
+ * CONTRIBUTORS BE LIABLE FOR ANY DIRECT, INDIRECT, INCIDENTAL, SPECIAL,
+ * EXEMPLARY, OR CONSEQUENTIAL DAMAGES (INCLUDING, BUT NOT LIMITED TO,
+ * PROCUREMENT OF SUBSTITUTE GOODS OR SERVICES; LOSS OF USE, DATA, OR
+ * PROFITS; OR BUSINESS INTERRUPTION) HOWEVER CAUSED AND ON ANY THEORY OF
+ * LIABILITY, WHETHER IN CONTRACT, STRICT LIABILITY, OR TORT (INCLUDING
+ * NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE OF THIS
+ * SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+ */
+
+// Provides encoding and decoding for DCCP (RFC 4340) packets.
+//
+// The generic header, the acknowledgement number and the fields specific to
+// the Request, Response and Reset packets are decoded. Options are kept as raw
+// bytes, padding included.
+package dccp
+
+import "fmt"
+
+import "github.com/adigal150/go.pkt/packet"
+
+type Packet struct {
+    SrcPort      uint16               `string:"sport"`
+    DstPort      uint16               `string:"dport"`
+    DataOff      uint8                `cmp:"skip" string:"off"`
+    CCVal        uint8                `string:"ccval"`
+    CsCov        uint8                `string:"cscov"`
+    Checksum     uint16               `cmp:"skip" string:"sum"`
+    Type         Type
+    ExtendedSeq  bool                 `string:"x"`
+    Seq          uint64
+    Ack          uint64
+    ServiceCode  uint32               `string:"svc"`
+    ResetCode    uint8                `string:"reset"`
+    ResetData    []byte               `string:"skip"`
+    Options      []byte               `string:"skip"`
+
+    // Encode the Checksum field as-is, instead of computing it from the
+    // packet, e.g. to craft malformed packets.
+    KeepChecksum bool                 `cmp:"skip" string:"skip"`
+
+    csum_seed    uint32               `cmp:"skip" string:"skip"`
+    pkt_payload  packet.Packet        `cmp:"skip" string:"skip"`
+    pkt_decode   func() packet.Packet `cmp:"skip" string:"skip"`
+    pkt_raw      []byte               `cmp:"skip" string:"skip"`
+}
+
+type Type uint8
+
+const (
+    Request Type = 0
+    Response     = 1
+    Data         = 2
+    Ack          = 3
+    DataAck      = 4
+    CloseReq     = 5
+    Close        = 6
+    Reset        = 7
+    Sync         = 8
+    SyncAck      = 9
+)
+
+func Make() *Packet {
+    return &Packet{
+        Type: Request,
+        ExtendedSeq: true,
+    }
+}
+
+func (p *Packet) GetType() packet.Type {
+    return packet.DCCP
+}
+
+func (p *Packet) GetLength() uint16 {
+    if p.Payload() != nil {
+        return p.Payload().GetLength() + p.header_len()
+    }
+
+    return p.header_len()
+}
+
+func (p *Packet) Equals(other packet.Packet) bool {
+    return packet.Compare(p, other)
+}
+
+func (p *Packet) Answers(other packet.Packet) bool {
+    if other == nil || other.GetType() != packet.DCCP {
+        return false
+    }
+
+    if p.SrcPort != other.(*Packet).DstPort ||
+       p.DstPort != other.(*Packet).SrcPort {
+        return false
+    }
+
+    return true
+}
+
+func (p *Packet) Pack(buf *packet.Buffer) error {
+    if len(p.ResetData) > 3 {
+        return fmt.Errorf("Invalid reset data length: %d", len(p.ResetData))
+    }
+
+    p.DataOff = uint8(p.header_len() / 4)
+
+    buf.WriteN(p.SrcPort)
+    buf.WriteN(p.DstPort)
+    buf.WriteN(p.DataOff)
+    buf.WriteN(p.CCVal << 4 | p.CsCov & 0x0F)
+    buf.WriteN(uint16(0x0000))
+
+    if p.ExtendedSeq {
+        buf.WriteN(uint8(p.Type & 0x0F) << 1 | 0x01)
+        buf.WriteN(uint8(0x00))
+        buf.WriteN(uint16(p.Seq >> 32), uint32(p.Seq))
+    } else {
+        buf.WriteN(uint8(p.Type & 0x0F) << 1)
+        buf.WriteN(uint8(p.Seq >> 16), uint16(p.Seq))
+    }
+
+    if p.has_ack() {
+        if p.ExtendedSeq {
+            buf.WriteN(uint16(0x0000))
+            buf.WriteN(uint16(p.Ack >> 32), uint32(p.Ack))
+        } else {
+            buf.WriteN(uint8(0x00))
+            buf.WriteN(uint8(p.Ack >> 16), uint16(p.Ack))
+        }
+    }
+
+    switch p.Type {
+    case Request, Response:
+        buf.WriteN(p.ServiceCode)
+
+    case Reset:
+        buf.WriteN(p.ResetCode)
+        buf.Write(p.ResetData)
+
+        for i := len(p.ResetData); i < 3; i++ {
+            buf.WriteN(uint8(0x00))
+        }
+    }
+
+    buf.Write(p.Options)
+
+    /* add padding */
+    for buf.LayerLen() < int(p.DataOff) * 4 && buf.Err() == nil {
+        buf.WriteN(uint8(0x00))
+    }
+
+    if buf.Err() != nil {
+        return buf.Err()
+    }
+
+    if p.csum_seed != 0 && !p.KeepChecksum {
+        data := buf.LayerBytes()[:p.GetLength()]
+
+        p.Checksum = packet.Checksum(data[:p.CoverageLength(len(data))],
+                                     p.csum_seed)
+    }
+
+    buf.PutUint16N(6, p.Checksum)
+
+    return buf.Err()
+}
+
+func (p *Packet) Unpack(buf *packet.Buffer) error {
+    p.pkt_raw = buf.Bytes()
+
+    if buf.Len() < 12 {
+        return packet.Errorf(packet.ErrTruncated, "Invalid DCCP header")
+    }
+
+    buf.ReadN(&p.SrcPort)
+    buf.ReadN(&p.DstPort)
+    buf.ReadN(&p.DataOff)
+
+    var cov uint8
+    buf.ReadN(&cov)
+
+    p.CCVal = cov >> 4
+    p.CsCov = cov & 0x0F
+
+    buf.ReadN(&p.Checksum)
+
+    var typ uint8
+    buf.ReadN(&typ)
+
+    p.Type        = Type(typ >> 1 & 0x0F)
+    p.ExtendedSeq = typ & 0x01 != 0
+
+    if p.ExtendedSeq {
+        var hi uint16
+        var lo uint32
+
+        buf.Next(1)
+        buf.ReadN(&hi, &lo)
+
+        p.Seq = uint64(hi) << 32 | uint64(lo)
+    } else {
+        p.Seq = read_uint24(buf)
+    }
+
+    if p.has_ack() {
+        if p.ExtendedSeq {
+            var hi uint16
+            var lo uint32
+
+            buf.Next(2)
+            buf.ReadN(&hi, &lo)
+
+            p.Ack = uint64(hi) << 32 | uint64(lo)
+        } else {
+            buf.Next(1)
+            p.Ack = read_uint24(buf)
+        }
+    }
+
+    switch p.Type {
+    case Request, Response:
+        buf.ReadN(&p.ServiceCode)
+
+    case Reset:
+        buf.ReadN(&p.ResetCode)
+        p.ResetData = buf.Next(3)
+    }
+
+    if buf.Err() != nil {
+        return buf.Err()
+    }
+
+    opts_len := int(p.DataOff) * 4 - buf.LayerLen()
+    if opts_len < 0 {
+        return packet.Errorf(packet.ErrInvalidLength,
+                             "Invalid data offset: %d", p.DataOff)
+    }
+
+    if opts_len > buf.Len() {
+        return packet.Errorf(packet.ErrTruncated,
+                             "Truncated DCCP options: %d", opts_len)
+    }
+
+    if opts_len > 0 {
+        p.Options = buf.Next(opts_len)
+    }
+
+    return buf.Err()
+}
+
+func (p *Packet) Payload() packet.Packet {
+    if p.pkt_decode != nil {
+        p.pkt_payload = p.pkt_decode()
+        p.pkt_decode  = nil
+    }
+
+    return p.pkt_payload
+}
+
+func (p *Packet) RawBytes() []byte {
+    return p.pkt_raw
+}
+
+func (p *Packet) HeaderBytes() []byte {
+    return packet.HeaderBytes(p)
+}
+
+func (p *Packet) GuessPayloadType() packet.Type {
+    return packet.Raw
+}
+
+func (p *Packet) SetPayload(pl packet.Packet) error {
+    p.pkt_payload = pl
+    p.pkt_decode  = nil
+
+    return nil
+}
+
+func (p *Packet) SetPayloadDecoder(decode func() packet.Packet) {
+    p.pkt_payload = nil
+    p.pkt_decode  = decode
+}
+
+func (p *Packet) InitChecksum(csum uint32) {
+    p.csum_seed = csum
+}
+
+func (p *Packet) Clone() packet.Packet {
+    c := *p
+
+    c.pkt_payload = packet.ClonePayload(p.Payload())
+    c.pkt_decode  = nil
+
+    c.ResetData = packet.CloneBytes(p.ResetData)
+    c.Options   = packet.CloneBytes(p.Options)
+
+    return &c
+}
+
+func (p *Packet) String() string {
+    return packet.Stringify(p)
+}
+
+// Return the number of bytes covered by the checksum, for a packet of the
+// given total length. The header is always covered, while CsCov is the number
+// of 4-byte words of application data covered plus one, or 0 for all of them.
+func (p *Packet) CoverageLength(length int) int {
+    if p.CsCov == 0 {
+        return length
+    }
+
+    cov := int(p.DataOff) * 4 + (int(p.CsCov) - 1) * 4
+    if cov > length {
+        return length
+    }
+
+    return cov
+}
+
+func (p *Packet) has_ack() bool {
+    return p.Type != Request && p.Type != Data
+}
+
+func (p *Packet) header_len() uint16 {
+    length := 12
+
+    if p.ExtendedSeq {
+        length = 16
+    }
+
+    if p.has_ack() {
+        if p.ExtendedSeq {
+            length += 8
+        } else {
+            length += 4
+        }
+    }
+
+    switch p.Type {
+    case Request, Response, Reset:
+        length += 4
+    }
+
+    length += len(p.Options)
+
+    return uint16((length + 3) &^ 3)
+}
+
+func read_uint24(buf *packet.Buffer) uint64 {
+    var hi uint8
+    var lo uint16
+
+    buf.ReadN(&hi, &lo)
+
+    return uint64(hi) << 16 | uint64(lo)
+}
+
+func (t Type) String() string {
+    switch t {
+    case Request:  return "request"
+    case Response: return "response"
+    case Data:     return "data"
+    case Ack:      return "ack"
+    case DataAck:  return "dataack"
+    case CloseReq: return "closereq"
+    case Close:    return "close"
+    case Reset:    return "reset"
+    case Sync:     return "sync"
+    case SyncAck:  return "syncack"
+    default:       return fmt.Sprintf("0x%x", uint8(t))
+    }
+}
@@ -0,0 +1,192 @@
+/*
+ * Network packet analysis framework.
+ *
+ * Copyright (c) 2014, Alessandro Ghedini
+ * All rights reserved.
+ *
+ * Redistribution and use in source and binary forms, with or without
+ * modification, are permitted provided that the following conditions are
+ * met:
+ *
+ *     * Redistributions of source code must retain the above copyright
+ *       notice, this list of conditions and the following disclaimer.
+ *
+ *     * Redistributions in binary form must reproduce the above copyright
+ *       notice, this list of conditions and the following disclaimer in the
+ *       documentation and/or other materials provided with the distribution.
+ *
+ * THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS
+ * IS" AND ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO,
+ * THE IMPLIED WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR
+ * PURPOSE ARE DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT HOLDER OR
+ * CONTRIBUTORS BE LIABLE FOR ANY DIRECT, INDIRECT, INCIDENTAL, SPECIAL,
+ * EXEMPLARY, OR CONSEQUENTIAL DAMAGES (INCLUDING, BUT NOT LIMITED TO,
+ * PROCUREMENT OF SUBSTITUTE GOODS OR SERVICES; LOSS OF USE, DATA, OR
+ * PROFITS; OR BUSINESS INTERRUPTION) HOWEVER CAUSED AND ON ANY THEORY OF
+ * LIABILITY, WHETHER IN CONTRACT, STRICT LIABILITY, OR TORT (INCLUDING
+ * NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE OF THIS
+ * SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+ */
+
+package dccp_test
+
+import "bytes"
+import "net"
+import "testing"
+
+import "github.com/adigal150/go.pkt/layers"
+import "github.com/adigal150/go.pkt/packet"
+import "github.com/adigal150/go.pkt/packet/dccp"
+import "github.com/adigal150/go.pkt/packet/ipv4"
+
+/* DCCP-Request with 48-bit sequence number */
+var test_simple = []byte{
+    0xc3, 0x50, 0x13, 0x89, 0x05, 0x00, 0x00, 0x00, 0x01, 0x00, 0x00, 0x00,
+    0x12, 0x34, 0x56, 0x78, 0x50, 0x45, 0x52, 0x46,
+}
+
+/* DCCP-Ack with 24-bit sequence and acknowledgement numbers */
+var test_short_seq = []byte{
+    0x13, 0x89, 0xc3, 0x50, 0x04, 0x00, 0x00, 0x00, 0x06, 0x12, 0x34, 0x56,
+    0x00, 0xab, 0xcd, 0xef,
+}
+
+func MakeTestSimple() *dccp.Packet {
+    return &dccp.Packet{
+        SrcPort: 50000,
+        DstPort: 5001,
+        Type: dccp.Request,
+        ExtendedSeq: true,
+        Seq: 0x12345678,
+        ServiceCode: 0x50455246,
+    }
+}
+
+func MakeTestShortSeq() *dccp.Packet {
+    return &dccp.Packet{
+        SrcPort: 5001,
+        DstPort: 50000,
+        Type: dccp.Ack,
+        Seq: 0x123456,
+        Ack: 0xabcdef,
+    }
+}
+
+func TestPack(t *testing.T) {
+    var b packet.Buffer
+    b.Init(make([]byte, len(test_simple)))
+
+    p := MakeTestSimple()
+
+    err := p.Pack(&b)
+    if err != nil {
+        t.Fatalf("Error packing: %s", err)
+    }
+
+    if !bytes.Equal(test_simple, b.Buffer()) {
+        t.Fatalf("Raw packet mismatch: %x", b.Buffer())
+    }
+}
+
+func BenchmarkPack(bn *testing.B) {
+    var b packet.Buffer
+    b.Init(make([]byte, len(test_simple)))
+
+    p := MakeTestSimple()
+
+    for n := 0; n < bn.N; n++ {
+        p.Pack(&b)
+    }
+}
+
+func TestUnpack(t *testing.T) {
+    var p dccp.Packet
+
+    cmp := MakeTestSimple()
+
+    var b packet.Buffer
+    b.Init(test_simple)
+
+    err := p.Unpack(&b)
+    if err != nil {
+        t.Fatalf("Error unpacking: %s", err)
+    }
+
+    if !p.Equals(cmp) {
+        t.Fatalf("Packet mismatch:\n%s\n%s", &p, cmp)
+    }
+
+    if p.DataOff != 5 || b.Len() != 0 {
+        t.Fatalf("Data offset mismatch: %d %d", p.DataOff, b.Len())
+    }
+}
+
+func BenchmarkUnpack(bn *testing.B) {
+    var p dccp.Packet
+    var b packet.Buffer
+
+    for n := 0; n < bn.N; n++ {
+        b.Init(test_simple)
+        p.Unpack(&b)
+    }
+}
+
+func TestPackShortSeq(t *testing.T) {
+    var b packet.Buffer
+    b.Init(make([]byte, len(test_short_seq)))
+
+    p := MakeTestShortSeq()
+
+    err := p.Pack(&b)
+    if err != nil {
+        t.Fatalf("Error packing: %s", err)
+    }
+
+    if !bytes.Equal(test_short_seq, b.Buffer()) {
+        t.Fatalf("Raw packet mismatch: %x", b.Buffer())
+    }
+}
+
+func TestUnpackShortSeq(t *testing.T) {
+    var p dccp.Packet
+
+    cmp := MakeTestShortSeq()
+
+    var b packet.Buffer
+    b.Init(test_short_seq)
+
+    err := p.Unpack(&b)
+    if err != nil {
+        t.Fatalf("Error unpacking: %s", err)
+    }
+
+    if !p.Equals(cmp) {
+        t.Fatalf("Packet mismatch:\n%s\n%s", &p, cmp)
+    }
+}
+
+func TestUnpackIPv4(t *testing.T) {
+    ip4 := ipv4.Make()
+    ip4.SrcAddr = net.ParseIP("10.0.0.1")
+    ip4.DstAddr = net.ParseIP("10.0.0.2")
+
+    p := MakeTestSimple()
+
+    data, err := layers.Pack(ip4, p)
+    if err != nil {
+        t.Fatalf("Error packing: %s", err)
+    }
+
+    if ip4.Protocol != ipv4.DCCP || p.Checksum != 0x03b6 {
+        t.Fatalf("Header mismatch: %s", ip4)
+    }
+
+    pkt, err := layers.UnpackAll(data, packet.IPv4)
+    if err != nil {
+        t.Fatalf("Error unpacking: %s", err)
+    }
+
+    if !pkt.Payload().Equals(MakeTestSimple()) {
+        t.Fatalf("Packet mismatch: %s", pkt)
+    }
+}
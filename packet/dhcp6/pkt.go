@@ -0,0 +1,405 @@
+/*
+ * Network packet analysis framework.
+ *
+ * Copyright (c) 2014, Alessandro Ghedini
+ * All rights reserved.
+ *
+ * Redistribution and use in source and binary forms, with or without
+ * modification, are permitted provided that the following conditions are
+ * met:
+ *
+ *     * Redistributions of source code must retain the above copyright
+ *       notice, this list of conditions and the following disclaimer.
+ *
+ *     * Redistributions in binary form must reproduce the above copyright
+ *       notice, this list of conditions and the following disclaimer in the
+ *       documentation and/or other materials provided with the distribution.
+ *
+ * THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS
+ * IS" AND ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO,
+ * THE IMPLIED WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR
+ * PURPOSE ARE DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT HOLDER OR
+ * CONTRIBUTORS BE LIABLE FOR ANY DIRECT, INDIRECT, INCIDENTAL, SPECIAL,
+ * EXEMPLARY, OR CONSEQUENTIAL DAMAGES (INCLUDING, BUT NOT LIMITED TO,
+ * PROCUREMENT OF SUBSTITUTE GOODS OR SERVICES; LOSS OF USE, DATA, OR
+ * PROFITS; OR BUSINESS INTERRUPTION) HOWEVER CAUSED AND ON ANY THEORY OF
+ * LIABILITY, WHETHER IN CONTRACT, STRICT LIABILITY, OR TORT (INCLUDING
+ * NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE OF THIS
+ * SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+ */
+
+// Provides encoding and decoding for DHCPv6 packets.
+package dhcp6
+
+import "encoding/binary"
+import "fmt"
+import "net"
+
+import "github.com/adigal150/go.pkt/packet"
+import "github.com/adigal150/go.pkt/packet/udp"
+
+type Packet struct {
+    MsgType       MsgType  `string:"type"`
+    TransactionId uint32   `string:"xid"`
+
+    /* relay-forward and relay-reply messages only */
+    HopCount      uint8    `string:"hops"`
+    LinkAddr      net.IP   `string:"link"`
+    PeerAddr      net.IP   `string:"peer"`
+
+    Options       []Option `cmp:"skip" string:"skip"`
+
+    pkt_raw       []byte   `cmp:"skip" string:"skip"`
+}
+
+type MsgType uint8
+
+const (
+    Solicit MsgType = 1
+    Advertise       = 2
+    Request         = 3
+    Confirm         = 4
+    Renew           = 5
+    Rebind          = 6
+    Reply           = 7
+    Release         = 8
+    Decline         = 9
+    Reconfigure     = 10
+    InfoRequest     = 11
+    RelayForw       = 12
+    RelayRepl       = 13
+)
+
+type Option struct {
+    Code OptCode
+    Data []byte
+}
+
+type OptCode uint16
+
+const (
+    ClientID OptCode = 1
+    ServerID         = 2
+    IANA             = 3
+    IATA             = 4
+    IAAddr           = 5
+    ORO              = 6
+    Preference       = 7
+    ElapsedTime      = 8
+    RelayMsg         = 9
+    Auth             = 11
+    Unicast          = 12
+    StatusCode       = 13
+    RapidCommit      = 14
+    UserClass        = 15
+    VendorClass      = 16
+    VendorOpts       = 17
+    InterfaceID      = 18
+    ReconfMsg        = 19
+    ReconfAccept     = 20
+    DNSServers       = 23
+    DomainList       = 24
+    IAPD             = 25
+    IAPrefix         = 26
+)
+
+// Identity association for non-temporary addresses (IA_NA option).
+type IdentityAssoc struct {
+    IAID    uint32
+    T1      uint32
+    T2      uint32
+    Options []Option
+}
+
+// Address assigned to an identity association (IA Address option).
+type IAAddress struct {
+    Addr      net.IP
+    Preferred uint32
+    Valid     uint32
+    Options   []Option
+}
+
+// Status of a message or of an identity association (Status Code option).
+type Status struct {
+    Code    uint16
+    Message string
+}
+
+func init() {
+    udp.RegisterPort(546, packet.DHCPv6)
+    udp.RegisterPort(547, packet.DHCPv6)
+}
+
+func Make() *Packet {
+    return &Packet{
+        MsgType: Solicit,
+    }
+}
+
+func (p *Packet) GetType() packet.Type {
+    return packet.DHCPv6
+}
+
+func (p *Packet) GetLength() uint16 {
+    length := 4
+
+    if p.IsRelay() {
+        length = 34
+    }
+
+    for _, opt := range p.Options {
+        length += 4 + len(opt.Data)
+    }
+
+    return uint16(length)
+}
+
+func (p *Packet) Equals(other packet.Packet) bool {
+    return packet.Compare(p, other)
+}
+
+func (p *Packet) Answers(other packet.Packet) bool {
+    if other == nil || other.GetType() != packet.DHCPv6 {
+        return false
+    }
+
+    if p.IsRelay() || other.(*Packet).IsRelay() {
+        return p.MsgType == RelayRepl &&
+               other.(*Packet).MsgType == RelayForw &&
+               p.PeerAddr.Equal(other.(*Packet).PeerAddr)
+    }
+
+    return p.TransactionId == other.(*Packet).TransactionId
+}
+
+func (p *Packet) Pack(buf *packet.Buffer) error {
+    if p.IsRelay() {
+        buf.WriteN(p.MsgType)
+        buf.WriteN(p.HopCount)
+        buf.Write(p.LinkAddr.To16())
+        buf.Write(p.PeerAddr.To16())
+    } else {
+        buf.WriteN(uint32(p.MsgType) << 24 | p.TransactionId & 0xFFFFFF)
+    }
+
+    return pack_options(buf, p.Options)
+}
+
+func (p *Packet) Unpack(buf *packet.Buffer) error {
+    p.pkt_raw = buf.Bytes()
+
+    if buf.Len() < 4 {
+        return packet.Errorf(packet.ErrTruncated, "Invalid DHCPv6 header")
+    }
+
+    buf.ReadN(&p.MsgType)
+
+    if p.IsRelay() {
+        if buf.Len() < 33 {
+            return packet.Errorf(packet.ErrTruncated,
+                                 "Invalid DHCPv6 relay header")
+        }
+
+        buf.ReadN(&p.HopCount)
+
+        p.LinkAddr = net.IP(buf.Next(16))
+        p.PeerAddr = net.IP(buf.Next(16))
+    } else {
+        xid := buf.Next(3)
+        p.TransactionId = uint32(xid[0]) << 16 | uint32(xid[1]) << 8 |
+                          uint32(xid[2])
+    }
+
+    var err error
+
+    p.Options, err = unpack_options(buf.Next(buf.Len()))
+    if err != nil {
+        return err
+    }
+
+    return buf.Err()
+}
+
+func (p *Packet) Payload() packet.Packet {
+    return nil
+}
+
+func (p *Packet) RawBytes() []byte {
+    return p.pkt_raw
+}
+
+func (p *Packet) HeaderBytes() []byte {
+    return packet.HeaderBytes(p)
+}
+
+func (p *Packet) GuessPayloadType() packet.Type {
+    return packet.None
+}
+
+func (p *Packet) SetPayload(pl packet.Packet) error {
+    return nil
+}
+
+func (p *Packet) InitChecksum(csum uint32) {
+}
+
+func (p *Packet) Clone() packet.Packet {
+    c := *p
+
+    c.LinkAddr = packet.CloneBytes(p.LinkAddr)
+    c.PeerAddr = packet.CloneBytes(p.PeerAddr)
+
+    if p.Options != nil {
+        c.Options = make([]Option, len(p.Options))
+
+        for i, opt := range p.Options {
+            c.Options[i] = Option{ Code: opt.Code, Data: packet.CloneBytes(opt.Data) }
+        }
+    }
+
+    return &c
+}
+
+func (p *Packet) String() string {
+    return packet.Stringify(p)
+}
+
+// Check whether the packet is a relay-forward or relay-reply message.
+func (p *Packet) IsRelay() bool {
+    return p.MsgType == RelayForw || p.MsgType == RelayRepl
+}
+
+// Return the first option with the given code, or nil.
+func (p *Packet) Option(code OptCode) *Option {
+    return find_option(p.Options, code)
+}
+
+// Decode the message encapsulated in the Relay Message option of a
+// relay-forward or relay-reply message.
+func (p *Packet) RelayMessage() (*Packet, error) {
+    opt := p.Option(RelayMsg)
+    if opt == nil {
+        return nil, fmt.Errorf("No relay message")
+    }
+
+    var b packet.Buffer
+    b.Init(opt.Data)
+
+    var msg Packet
+
+    err := msg.Unpack(&b)
+    if err != nil {
+        return nil, err
+    }
+
+    return &msg, nil
+}
+
+// Decode the payload of an IA_NA option.
+func (o *Option) IdentityAssoc() (*IdentityAssoc, error) {
+    if o.Code != IANA || len(o.Data) < 12 {
+        return nil, fmt.Errorf("Invalid IA_NA option")
+    }
+
+    opts, err := unpack_options(o.Data[12:])
+    if err != nil {
+        return nil, err
+    }
+
+    return &IdentityAssoc{
+        IAID:    binary.BigEndian.Uint32(o.Data[0:4]),
+        T1:      binary.BigEndian.Uint32(o.Data[4:8]),
+        T2:      binary.BigEndian.Uint32(o.Data[8:12]),
+        Options: opts,
+    }, nil
+}
+
+// Decode the payload of an IA Address option.
+func (o *Option) IAAddress() (*IAAddress, error) {
+    if o.Code != IAAddr || len(o.Data) < 24 {
+        return nil, fmt.Errorf("Invalid IA Address option")
+    }
+
+    opts, err := unpack_options(o.Data[24:])
+    if err != nil {
+        return nil, err
+    }
+
+    return &IAAddress{
+        Addr:      net.IP(o.Data[0:16]),
+        Preferred: binary.BigEndian.Uint32(o.Data[16:20]),
+        Valid:     binary.BigEndian.Uint32(o.Data[20:24]),
+        Options:   opts,
+    }, nil
+}
+
+// Decode the payload of a Status Code option.
+func (o *Option) Status() (*Status, error) {
+    if o.Code != StatusCode || len(o.Data) < 2 {
+        return nil, fmt.Errorf("Invalid Status Code option")
+    }
+
+    return &Status{
+        Code:    binary.BigEndian.Uint16(o.Data[0:2]),
+        Message: string(o.Data[2:]),
+    }, nil
+}
+
+// Return the first option with the given code, or nil.
+func (ia *IdentityAssoc) Option(code OptCode) *Option {
+    return find_option(ia.Options, code)
+}
+
+func find_option(opts []Option, code OptCode) *Option {
+    for i := range opts {
+        if opts[i].Code == code {
+            return &opts[i]
+        }
+    }
+
+    return nil
+}
+
+func pack_options(buf *packet.Buffer, opts []Option) error {
+    var tlvs []packet.TLV
+
+    for _, opt := range opts {
+        tlvs = append(tlvs, packet.TLV{ Type: uint16(opt.Code), Value: opt.Data })
+    }
+
+    return packet.EncodeTLV16(buf, tlvs)
+}
+
+func unpack_options(data []byte) ([]Option, error) {
+    var opts []Option
+
+    tlvs, err := packet.DecodeTLV16(data)
+    if err != nil {
+        return nil, err
+    }
+
+    for _, tlv := range tlvs {
+        opts = append(opts, Option{ Code: OptCode(tlv.Type), Data: tlv.Value })
+    }
+
+    return opts, nil
+}
+
+func (t MsgType) String() string {
+    switch t {
+    case Solicit:     return "solicit"
+    case Advertise:   return "advertise"
+    case Request:     return "request"
+    case Confirm:     return "confirm"
+    case Renew:       return "renew"
+    case Rebind:      return "rebind"
+    case Reply:       return "reply"
+    case Release:     return "release"
+    case Decline:     return "decline"
+    case Reconfigure: return "reconfigure"
+    case InfoRequest: return "info-request"
+    case RelayForw:   return "relay-forw"
+    case RelayRepl:   return "relay-repl"
+    default:          return "unknown"
+    }
+}
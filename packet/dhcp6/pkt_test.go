@@ -0,0 +1,253 @@
+/*
+ * Network packet analysis framework.
+ *
+ * Copyright (c) 2014, Alessandro Ghedini
+ * All rights reserved.
+ *
+ * Redistribution and use in source and binary forms, with or without
+ * modification, are permitted provided that the following conditions are
+ * met:
+ *
+ *     * Redistributions of source code must retain the above copyright
+ *       notice, this list of conditions and the following disclaimer.
+ *
+ *     * Redistributions in binary form must reproduce the above copyright
+ *       notice, this list of conditions and the following disclaimer in the
+ *       documentation and/or other materials provided with the distribution.
+ *
+ * THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS
+ * IS" AND ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO,
+ * THE IMPLIED WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR
+ * PURPOSE ARE DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT HOLDER OR
+ * CONTRIBUTORS BE LIABLE FOR ANY DIRECT, INDIRECT, INCIDENTAL, SPECIAL,
+ * EXEMPLARY, OR CONSEQUENTIAL DAMAGES (INCLUDING, BUT NOT LIMITED TO,
+ * PROCUREMENT OF SUBSTITUTE GOODS OR SERVICES; LOSS OF USE, DATA, OR
+ * PROFITS; OR BUSINESS INTERRUPTION) HOWEVER CAUSED AND ON ANY THEORY OF
+ * LIABILITY, WHETHER IN CONTRACT, STRICT LIABILITY, OR TORT (INCLUDING
+ * NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE OF THIS
+ * SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+ */
+
+package dhcp6_test
+
+import "bytes"
+import "net"
+import "testing"
+
+import "github.com/adigal150/go.pkt/packet"
+import "github.com/adigal150/go.pkt/packet/dhcp6"
+
+var test_simple = []byte{
+    0x01, 0x10, 0x20, 0x30, 0x00, 0x01, 0x00, 0x0a, 0x00, 0x03, 0x00, 0x01,
+    0x4c, 0x72, 0xb9, 0x54, 0xe5, 0x3d, 0x00, 0x08, 0x00, 0x02, 0x00, 0x00,
+    0x00, 0x03, 0x00, 0x0c, 0x00, 0x00, 0x00, 0x01, 0x00, 0x00, 0x00, 0x00,
+    0x00, 0x00, 0x00, 0x00,
+}
+
+var test_advertise = []byte{
+    0x02, 0x10, 0x20, 0x30, 0x00, 0x01, 0x00, 0x0a, 0x00, 0x03, 0x00, 0x01,
+    0x4c, 0x72, 0xb9, 0x54, 0xe5, 0x3d, 0x00, 0x02, 0x00, 0x0a, 0x00, 0x03,
+    0x00, 0x01, 0x00, 0x11, 0x22, 0x33, 0x44, 0x55, 0x00, 0x03, 0x00, 0x28,
+    0x00, 0x00, 0x00, 0x01, 0x00, 0x00, 0x0e, 0x10, 0x00, 0x00, 0x15, 0x18,
+    0x00, 0x05, 0x00, 0x18, 0x20, 0x01, 0x0d, 0xb8, 0x00, 0x00, 0x00, 0x00,
+    0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x01, 0x00, 0x00, 0x00, 0x1c, 0x20,
+    0x00, 0x00, 0x1d, 0x4c, 0x00, 0x0d, 0x00, 0x09, 0x00, 0x00, 0x73, 0x75,
+    0x63, 0x63, 0x65, 0x73, 0x73,
+}
+
+var test_relay_forw = []byte{
+    0x0c, 0x00, 0x20, 0x01, 0x0d, 0xb8, 0x00, 0x01, 0x00, 0x00, 0x00, 0x00,
+    0x00, 0x00, 0x00, 0x00, 0x00, 0x01, 0xfe, 0x80, 0x00, 0x00, 0x00, 0x00,
+    0x00, 0x00, 0x4e, 0x72, 0xb9, 0xff, 0xfe, 0x54, 0xe5, 0x3d, 0x00, 0x09,
+    0x00, 0x28, 0x01, 0x10, 0x20, 0x30, 0x00, 0x01, 0x00, 0x0a, 0x00, 0x03,
+    0x00, 0x01, 0x4c, 0x72, 0xb9, 0x54, 0xe5, 0x3d, 0x00, 0x08, 0x00, 0x02,
+    0x00, 0x00, 0x00, 0x03, 0x00, 0x0c, 0x00, 0x00, 0x00, 0x01, 0x00, 0x00,
+    0x00, 0x00, 0x00, 0x00, 0x00, 0x00,
+}
+
+func MakeTestSimple() *dhcp6.Packet {
+    return &dhcp6.Packet{
+        MsgType: dhcp6.Solicit,
+        TransactionId: 0x102030,
+        Options: []dhcp6.Option{
+            {
+                Code: dhcp6.ClientID,
+                Data: []byte{ 0x00, 0x03, 0x00, 0x01,
+                              0x4c, 0x72, 0xb9, 0x54, 0xe5, 0x3d },
+            },
+            {
+                Code: dhcp6.ElapsedTime,
+                Data: []byte{ 0x00, 0x00 },
+            },
+            {
+                Code: dhcp6.IANA,
+                Data: []byte{ 0x00, 0x00, 0x00, 0x01, 0x00, 0x00, 0x00, 0x00,
+                              0x00, 0x00, 0x00, 0x00 },
+            },
+        },
+    }
+}
+
+func TestPack(t *testing.T) {
+    var b packet.Buffer
+    b.Init(make([]byte, len(test_simple)))
+
+    p := MakeTestSimple()
+
+    if int(p.GetLength()) != len(test_simple) {
+        t.Fatalf("Length mismatch: %d", p.GetLength())
+    }
+
+    err := p.Pack(&b)
+    if err != nil {
+        t.Fatalf("Error packing: %s", err)
+    }
+
+    if !bytes.Equal(test_simple, b.Buffer()) {
+        t.Fatalf("Raw packet mismatch: %x", b.Buffer())
+    }
+}
+
+func BenchmarkPack(bn *testing.B) {
+    var b packet.Buffer
+    b.Init(make([]byte, len(test_simple)))
+
+    p := MakeTestSimple()
+
+    for n := 0; n < bn.N; n++ {
+        p.Pack(&b)
+    }
+}
+
+func TestUnpack(t *testing.T) {
+    var p dhcp6.Packet
+
+    cmp := MakeTestSimple()
+
+    var b packet.Buffer
+    b.Init(test_simple)
+
+    err := p.Unpack(&b)
+    if err != nil {
+        t.Fatalf("Error unpacking: %s", err)
+    }
+
+    if !p.Equals(cmp) {
+        t.Fatalf("Packet mismatch:\n%s\n%s", &p, cmp)
+    }
+
+    if len(p.Options) != len(cmp.Options) {
+        t.Fatalf("Options mismatch: %v", p.Options)
+    }
+
+    for i := range p.Options {
+        if p.Options[i].Code != cmp.Options[i].Code ||
+           !bytes.Equal(p.Options[i].Data, cmp.Options[i].Data) {
+            t.Fatalf("Option mismatch: %v", p.Options[i])
+        }
+    }
+}
+
+func BenchmarkUnpack(bn *testing.B) {
+    var p dhcp6.Packet
+    var b packet.Buffer
+
+    for n := 0; n < bn.N; n++ {
+        b.Init(test_simple)
+        p.Unpack(&b)
+    }
+}
+
+func TestUnpackAdvertise(t *testing.T) {
+    var p dhcp6.Packet
+
+    var b packet.Buffer
+    b.Init(test_advertise)
+
+    err := p.Unpack(&b)
+    if err != nil {
+        t.Fatalf("Error unpacking: %s", err)
+    }
+
+    if p.MsgType != dhcp6.Advertise || p.TransactionId != 0x102030 {
+        t.Fatalf("Header mismatch: %s", &p)
+    }
+
+    if !p.Answers(MakeTestSimple()) {
+        t.Fatalf("Advertise does not answer solicit")
+    }
+
+    duid := []byte{ 0x00, 0x03, 0x00, 0x01, 0x00, 0x11, 0x22, 0x33, 0x44, 0x55 }
+
+    sid := p.Option(dhcp6.ServerID)
+    if sid == nil || !bytes.Equal(sid.Data, duid) {
+        t.Fatalf("Server ID mismatch: %v", sid)
+    }
+
+    ia, err := p.Option(dhcp6.IANA).IdentityAssoc()
+    if err != nil {
+        t.Fatalf("Error decoding IA_NA: %s", err)
+    }
+
+    if ia.IAID != 1 || ia.T1 != 3600 || ia.T2 != 5400 {
+        t.Fatalf("IA_NA mismatch: %v", ia)
+    }
+
+    addr, err := ia.Option(dhcp6.IAAddr).IAAddress()
+    if err != nil {
+        t.Fatalf("Error decoding IA Address: %s", err)
+    }
+
+    if !addr.Addr.Equal(net.ParseIP("2001:db8::100")) ||
+       addr.Preferred != 7200 || addr.Valid != 7500 {
+        t.Fatalf("IA Address mismatch: %v", addr)
+    }
+
+    status, err := p.Option(dhcp6.StatusCode).Status()
+    if err != nil {
+        t.Fatalf("Error decoding Status Code: %s", err)
+    }
+
+    if status.Code != 0 || status.Message != "success" {
+        t.Fatalf("Status mismatch: %v", status)
+    }
+}
+
+func TestUnpackRelayForw(t *testing.T) {
+    var p dhcp6.Packet
+
+    var b packet.Buffer
+    b.Init(test_relay_forw)
+
+    err := p.Unpack(&b)
+    if err != nil {
+        t.Fatalf("Error unpacking: %s", err)
+    }
+
+    if !p.IsRelay() || p.HopCount != 0 ||
+       !p.LinkAddr.Equal(net.ParseIP("2001:db8:1::1")) ||
+       !p.PeerAddr.Equal(net.ParseIP("fe80::4e72:b9ff:fe54:e53d")) {
+        t.Fatalf("Relay header mismatch: %s", &p)
+    }
+
+    msg, err := p.RelayMessage()
+    if err != nil {
+        t.Fatalf("Error decoding relay message: %s", err)
+    }
+
+    if !msg.Equals(MakeTestSimple()) {
+        t.Fatalf("Relay message mismatch: %s", msg)
+    }
+
+    var out packet.Buffer
+    out.Init(make([]byte, p.GetLength()))
+
+    err = p.Pack(&out)
+    if err != nil {
+        t.Fatalf("Error packing: %s", err)
+    }
+
+    if !bytes.Equal(test_relay_forw, out.Buffer()) {
+        t.Fatalf("Raw packet mismatch: %x", out.Buffer())
+    }
+}
@@ -0,0 +1,443 @@
+/*
+ * Network packet analysis framework.
+ *
+ * Copyright (c) 2014, Alessandro Ghedini
+ * All rights reserved.
+ *
+ * Redistribution and use in source and binary forms, with or without
+ * modification, are permitted provided that the following conditions are
+ * met:
+ *
+ *     * Redistributions of source code must retain the above copyright
+ *       notice, this list of conditions and the following disclaimer.
+ *
+ *     * Redistributions in binary form must reproduce the above copyright
+ *       notice, this list of conditions and the following disclaimer in the
+ *       documentation and/or other materials provided with the distribution.
+ *
+ * THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS
+ * IS" AND ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO,
+ * THE IMPLIED WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR
+ * PURPOSE ARE DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT HOLDER OR
+ * CONTRIBUTORS BE LIABLE FOR ANY DIRECT, INDIRECT, INCIDENTAL, SPECIAL,
+ * EXEMPLARY, OR CONSEQUENTIAL DAMAGES (INCLUDING, BUT NOT LIMITED TO,
+ * PROCUREMENT OF SUBSTITUTE GOODS OR SERVICES; LOSS OF USE, DATA, OR
+ * PROFITS; OR BUSINESS INTERRUPTION) HOWEVER CAUSED AND ON ANY THEORY OF
+ * LIABILITY, WHETHER IN CONTRACT, STRICT LIABILITY, OR TORT (INCLUDING
+ * NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE OF THIS
+ * SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+ */
+// Provides encoding and decoding for Diameter (RFC 6733) packets.
+//
+// AVPs are decoded as a flat list, grouped AVPs can be further decoded with
+// AVP.AVPs(). Multiple messages sharing the same segment are decoded as the
+// payload of each other.
+package diameter
+
+import "encoding/binary"
+import "fmt"
+import "strings"
+
+import "github.com/adigal150/go.pkt/packet"
+import "github.com/adigal150/go.pkt/packet/tcp"
+
+type Packet struct {
+    Version     uint8
+    Length      uint32        `cmp:"skip" string:"len"`
+    Flags       Flags
+    Command     Command       `string:"cmd"`
+    AppId       uint32        `string:"app"`
+    HopByHopId  uint32        `string:"hbh"`
+    EndToEndId  uint32        `string:"e2e"`
+    AVPs        []AVP         `cmp:"skip" string:"skip"`
+    pkt_payload packet.Packet `cmp:"skip" string:"skip"`
+    pkt_raw     []byte        `cmp:"skip" string:"skip"`
+}
+
+type Flags uint8
+
+const (
+    Request       Flags = 0x80
+    Proxiable           = 0x40
+    Error               = 0x20
+    Retransmitted       = 0x10
+)
+
+type Command uint32
+
+const (
+    CapabilitiesExchange      Command = 257
+    ReAuth                            = 258
+    Accounting                        = 271
+    CreditControl                     = 272
+    AbortSession                      = 274
+    SessionTermination                = 275
+    DeviceWatchdog                    = 280
+    DisconnectPeer                    = 282
+    UpdateLocation                    = 316
+    CancelLocation                    = 317
+    AuthenticationInformation         = 318
+)
+
+// Attribute-value pair. The length is not stored, since it's implied by the
+// data, and the padding is removed.
+type AVP struct {
+    Code     AVPCode
+    Flags    AVPFlags
+    VendorId uint32
+    Data     []byte
+}
+
+type AVPFlags uint8
+
+const (
+    VendorSpecific AVPFlags = 0x80
+    Mandatory               = 0x40
+    Protected               = 0x20
+)
+
+type AVPCode uint32
+
+const (
+    UserName                    AVPCode = 1
+    HostIPAddress                       = 257
+    AuthApplicationId                   = 258
+    AcctApplicationId                   = 259
+    VendorSpecificApplicationId         = 260
+    SessionId                           = 263
+    OriginHost                          = 264
+    SupportedVendorId                   = 265
+    VendorId                            = 266
+    FirmwareRevision                    = 267
+    ResultCode                          = 268
+    ProductName                         = 269
+    DisconnectCause                     = 273
+    OriginStateId                       = 278
+    FailedAVP                           = 279
+    ErrorMessage                        = 281
+    DestinationRealm                    = 283
+    DestinationHost                     = 293
+    OriginRealm                         = 296
+    ExperimentalResult                  = 297
+    InbandSecurityId                    = 299
+)
+
+func init() {
+    tcp.RegisterPort(3868, packet.Diameter)
+}
+
+func Make() *Packet {
+    return &Packet{
+        Version: 1,
+        Flags:   Request,
+    }
+}
+
+func (p *Packet) GetType() packet.Type {
+    return packet.Diameter
+}
+
+func (p *Packet) GetLength() uint16 {
+    if p.pkt_payload != nil {
+        return uint16(p.msg_len()) + p.pkt_payload.GetLength()
+    }
+
+    return uint16(p.msg_len())
+}
+
+func (p *Packet) Equals(other packet.Packet) bool {
+    return packet.Compare(p, other)
+}
+
+func (p *Packet) Answers(other packet.Packet) bool {
+    if other == nil || other.GetType() != packet.Diameter {
+        return false
+    }
+
+    req := other.(*Packet)
+
+    return p.Flags & Request == 0 && req.Flags & Request != 0 &&
+           p.Command == req.Command &&
+           p.HopByHopId == req.HopByHopId &&
+           p.EndToEndId == req.EndToEndId
+}
+
+func (p *Packet) Pack(buf *packet.Buffer) error {
+    length := p.msg_len()
+
+    if length > 0xFFFFFF {
+        return fmt.Errorf("Invalid Diameter length: %d", length)
+    }
+
+    buf.WriteN(uint32(p.Version) << 24 | length)
+    buf.WriteN(uint32(p.Flags) << 24 | uint32(p.Command) & 0xFFFFFF)
+    buf.WriteN(p.AppId)
+    buf.WriteN(p.HopByHopId)
+    buf.WriteN(p.EndToEndId)
+
+    return pack_avps(buf, p.AVPs)
+}
+
+func (p *Packet) Unpack(buf *packet.Buffer) error {
+    p.pkt_raw = buf.Bytes()
+
+    if buf.Len() < 20 {
+        return packet.Errorf(packet.ErrTruncated, "Invalid Diameter header")
+    }
+
+    var word uint32
+
+    buf.ReadN(&word)
+    p.Version = uint8(word >> 24)
+    p.Length  = word & 0xFFFFFF
+
+    if p.Version != 1 {
+        return packet.Errorf(packet.ErrUnsupported,
+                             "Unsupported Diameter version: %d", p.Version)
+    }
+
+    if p.Length < 20 || int(p.Length) - 4 > buf.Len() {
+        return packet.Errorf(packet.ErrInvalidLength,
+                             "Invalid Diameter length: %d", p.Length)
+    }
+
+    buf.ReadN(&word)
+    p.Flags   = Flags(word >> 24)
+    p.Command = Command(word & 0xFFFFFF)
+
+    buf.ReadN(&p.AppId)
+    buf.ReadN(&p.HopByHopId)
+    buf.ReadN(&p.EndToEndId)
+
+    var err error
+
+    p.AVPs, err = unpack_avps(buf.Next(int(p.Length) - 20))
+    if err != nil {
+        return err
+    }
+
+    return buf.Err()
+}
+
+func (p *Packet) Payload() packet.Packet {
+    return p.pkt_payload
+}
+
+func (p *Packet) RawBytes() []byte {
+    return p.pkt_raw
+}
+
+func (p *Packet) HeaderBytes() []byte {
+    return packet.HeaderBytes(p)
+}
+
+func (p *Packet) GuessPayloadType() packet.Type {
+    /* multiple messages can share the same segment */
+    return packet.Diameter
+}
+
+func (p *Packet) SetPayload(pl packet.Packet) error {
+    p.pkt_payload = pl
+    return nil
+}
+
+func (p *Packet) InitChecksum(csum uint32) {
+}
+
+func (p *Packet) Clone() packet.Packet {
+    c := *p
+
+    c.AVPs        = clone_avps(p.AVPs)
+    c.pkt_payload = packet.ClonePayload(p.pkt_payload)
+
+    return &c
+}
+
+func (p *Packet) String() string {
+    return packet.Stringify(p)
+}
+
+// Return the first AVP with the given code, or nil.
+func (p *Packet) AVP(code AVPCode) *AVP {
+    return find_avp(p.AVPs, code)
+}
+
+// Decode the data of a grouped AVP (e.g. Vendor-Specific-Application-Id) as a
+// list of AVPs.
+func (a *AVP) AVPs() ([]AVP, error) {
+    return unpack_avps(a.Data)
+}
+
+// Decode the data of an Unsigned32 (or Enumerated) AVP.
+func (a *AVP) Uint32() (uint32, error) {
+    if len(a.Data) != 4 {
+        return 0, fmt.Errorf("Invalid Unsigned32 AVP: %d", len(a.Data))
+    }
+
+    return binary.BigEndian.Uint32(a.Data), nil
+}
+
+/* length of the message, excluding any following message */
+func (p *Packet) msg_len() uint32 {
+    length := uint32(20)
+
+    for _, avp := range p.AVPs {
+        length += avp_len(&avp, true)
+    }
+
+    return length
+}
+
+func avp_len(avp *AVP, padded bool) uint32 {
+    length := uint32(8 + len(avp.Data))
+
+    if avp.Flags & VendorSpecific != 0 {
+        length += 4
+    }
+
+    if padded {
+        length = (length + 3) &^ 3
+    }
+
+    return length
+}
+
+func find_avp(avps []AVP, code AVPCode) *AVP {
+    for i := range avps {
+        if avps[i].Code == code {
+            return &avps[i]
+        }
+    }
+
+    return nil
+}
+
+func clone_avps(avps []AVP) []AVP {
+    if avps == nil {
+        return nil
+    }
+
+    clone := make([]AVP, len(avps))
+
+    for i, avp := range avps {
+        avp.Data = packet.CloneBytes(avp.Data)
+
+        clone[i] = avp
+    }
+
+    return clone
+}
+
+func pack_avps(buf *packet.Buffer, avps []AVP) error {
+    for _, avp := range avps {
+        length := avp_len(&avp, false)
+
+        if length > 0xFFFFFF {
+            return fmt.Errorf("Invalid AVP length: %d", length)
+        }
+
+        buf.WriteN(avp.Code)
+        buf.WriteN(uint32(avp.Flags) << 24 | length)
+
+        if avp.Flags & VendorSpecific != 0 {
+            buf.WriteN(avp.VendorId)
+        }
+
+        buf.Write(avp.Data)
+
+        for i := length; i < avp_len(&avp, true); i++ {
+            buf.WriteN(uint8(0x00))
+        }
+    }
+
+    return buf.Err()
+}
+
+func unpack_avps(data []byte) ([]AVP, error) {
+    var avps []AVP
+
+    for len(data) > 0 {
+        if len(data) < 8 {
+            return avps, packet.Errorf(packet.ErrTruncated,
+                                       "Truncated AVP header")
+        }
+
+        avp := AVP{
+            Code:  AVPCode(binary.BigEndian.Uint32(data[0:4])),
+            Flags: AVPFlags(data[4]),
+        }
+
+        l := int(data[5]) << 16 | int(data[6]) << 8 | int(data[7])
+        h := 8
+
+        if avp.Flags & VendorSpecific != 0 {
+            h = 12
+        }
+
+        if l < h {
+            return avps, packet.Errorf(packet.ErrInvalidLength,
+                                       "Invalid AVP length: %d", l)
+        }
+
+        if l > len(data) {
+            return avps, packet.Errorf(packet.ErrTruncated,
+                                       "Truncated AVP value: %d", l)
+        }
+
+        if h == 12 {
+            avp.VendorId = binary.BigEndian.Uint32(data[8:12])
+        }
+
+        avp.Data = data[h:l]
+        avps     = append(avps, avp)
+
+        /* the padding of the last AVP may be missing */
+        l = (l + 3) &^ 3
+        if l > len(data) {
+            l = len(data)
+        }
+
+        data = data[l:]
+    }
+
+    return avps, nil
+}
+
+func (f Flags) String() string {
+    var flags []string
+
+    if f & Request != 0 {
+        flags = append(flags, "r")
+    }
+
+    if f & Proxiable != 0 {
+        flags = append(flags, "p")
+    }
+
+    if f & Error != 0 {
+        flags = append(flags, "e")
+    }
+
+    if f & Retransmitted != 0 {
+        flags = append(flags, "t")
+    }
+
+    return strings.Join(flags, "|")
+}
+
+func (c Command) String() string {
+    switch c {
+    case CapabilitiesExchange:      return "capabilities-exchange"
+    case ReAuth:                    return "re-auth"
+    case Accounting:                return "accounting"
+    case CreditControl:             return "credit-control"
+    case AbortSession:              return "abort-session"
+    case SessionTermination:        return "session-termination"
+    case DeviceWatchdog:            return "device-watchdog"
+    case DisconnectPeer:            return "disconnect-peer"
+    case UpdateLocation:            return "update-location"
+    case CancelLocation:            return "cancel-location"
+    case AuthenticationInformation: return "authentication-information"
+    default:                        return "unknown"
+    }
+}
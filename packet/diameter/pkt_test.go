@@ -0,0 +1,232 @@
+/*
+ * Network packet analysis framework.
+ *
+ * Copyright (c) 2014, Alessandro Ghedini
+ * All rights reserved.
+ *
+ * Redistribution and use in source and binary forms, with or without
+ * modification, are permitted provided that the following conditions are
+ * met:
+ *
+ *     * Redistributions of source code must retain the above copyright
+ *       notice, this list of conditions and the following disclaimer.
+ *
+ *     * Redistributions in binary form must reproduce the above copyright
+ *       notice, this list of conditions and the following disclaimer in the
+ *       documentation and/or other materials provided with the distribution.
+ *
+ * THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS
+ * IS" AND ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO,
+ * THE IMPLIED WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR
+ * PURPOSE ARE DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT HOLDER OR
+ * CONTRIBUTORS BE LIABLE FOR ANY DIRECT, INDIRECT, INCIDENTAL, SPECIAL,
+ * EXEMPLARY, OR CONSEQUENTIAL DAMAGES (INCLUDING, BUT NOT LIMITED TO,
+ * PROCUREMENT OF SUBSTITUTE GOODS OR SERVICES; LOSS OF USE, DATA, OR
+ * PROFITS; OR BUSINESS INTERRUPTION) HOWEVER CAUSED AND ON ANY THEORY OF
+ * LIABILITY, WHETHER IN CONTRACT, STRICT LIABILITY, OR TORT (INCLUDING
+ * NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE OF THIS
+ * SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+ */
+package diameter_test
+
+import "bytes"
+import "testing"
+
+import "github.com/adigal150/go.pkt/layers"
+import "github.com/adigal150/go.pkt/packet"
+import "github.com/adigal150/go.pkt/packet/diameter"
+
+/* Capabilities-Exchange-Request */
+var test_simple = []byte{
+    0x01, 0x00, 0x00, 0x90, 0x80, 0x00, 0x01, 0x01, 0x00, 0x00, 0x00, 0x00,
+    0x11, 0x22, 0x33, 0x44, 0x55, 0x66, 0x77, 0x88, 0x00, 0x00, 0x01, 0x08,
+    0x40, 0x00, 0x00, 0x1a, 0x63, 0x6c, 0x69, 0x65, 0x6e, 0x74, 0x2e, 0x65,
+    0x78, 0x61, 0x6d, 0x70, 0x6c, 0x65, 0x2e, 0x63, 0x6f, 0x6d, 0x00, 0x00,
+    0x00, 0x00, 0x01, 0x28, 0x40, 0x00, 0x00, 0x13, 0x65, 0x78, 0x61, 0x6d,
+    0x70, 0x6c, 0x65, 0x2e, 0x63, 0x6f, 0x6d, 0x00, 0x00, 0x00, 0x01, 0x01,
+    0x40, 0x00, 0x00, 0x0e, 0x00, 0x01, 0xc0, 0xa8, 0x00, 0x01, 0x00, 0x00,
+    0x00, 0x00, 0x01, 0x0a, 0x40, 0x00, 0x00, 0x0c, 0x00, 0x00, 0x00, 0x00,
+    0x00, 0x00, 0x01, 0x0d, 0x00, 0x00, 0x00, 0x0e, 0x67, 0x6f, 0x2e, 0x70,
+    0x6b, 0x74, 0x00, 0x00, 0x00, 0x00, 0x01, 0x04, 0x40, 0x00, 0x00, 0x20,
+    0x00, 0x00, 0x01, 0x0a, 0x40, 0x00, 0x00, 0x0c, 0x00, 0x00, 0x28, 0xaf,
+    0x00, 0x00, 0x01, 0x02, 0x40, 0x00, 0x00, 0x0c, 0x01, 0x00, 0x00, 0x23,
+}
+
+/* Capabilities-Exchange-Answer */
+var test_answer = []byte{
+    0x01, 0x00, 0x00, 0x50, 0x00, 0x00, 0x01, 0x01, 0x00, 0x00, 0x00, 0x00,
+    0x11, 0x22, 0x33, 0x44, 0x55, 0x66, 0x77, 0x88, 0x00, 0x00, 0x01, 0x0c,
+    0x40, 0x00, 0x00, 0x0c, 0x00, 0x00, 0x07, 0xd1, 0x00, 0x00, 0x01, 0x08,
+    0x40, 0x00, 0x00, 0x1a, 0x73, 0x65, 0x72, 0x76, 0x65, 0x72, 0x2e, 0x65,
+    0x78, 0x61, 0x6d, 0x70, 0x6c, 0x65, 0x2e, 0x63, 0x6f, 0x6d, 0x00, 0x00,
+    0x00, 0x00, 0x01, 0x28, 0x40, 0x00, 0x00, 0x13, 0x65, 0x78, 0x61, 0x6d,
+    0x70, 0x6c, 0x65, 0x2e, 0x63, 0x6f, 0x6d, 0x00,
+}
+
+func MakeTestSimple() *diameter.Packet {
+    return &diameter.Packet{
+        Version:    1,
+        Flags:      diameter.Request,
+        Command:    diameter.CapabilitiesExchange,
+        HopByHopId: 0x11223344,
+        EndToEndId: 0x55667788,
+        AVPs: []diameter.AVP{
+            {
+                Code:  diameter.OriginHost,
+                Flags: diameter.Mandatory,
+                Data:  []byte("client.example.com"),
+            },
+            {
+                Code:  diameter.OriginRealm,
+                Flags: diameter.Mandatory,
+                Data:  []byte("example.com"),
+            },
+            {
+                Code:  diameter.HostIPAddress,
+                Flags: diameter.Mandatory,
+                Data:  []byte{ 0x00, 0x01, 0xc0, 0xa8, 0x00, 0x01 },
+            },
+            {
+                Code:  diameter.VendorId,
+                Flags: diameter.Mandatory,
+                Data:  []byte{ 0x00, 0x00, 0x00, 0x00 },
+            },
+            {
+                Code:  diameter.ProductName,
+                Data:  []byte("go.pkt"),
+            },
+            {
+                Code:  diameter.VendorSpecificApplicationId,
+                Flags: diameter.Mandatory,
+                Data:  []byte{
+                    0x00, 0x00, 0x01, 0x0a, 0x40, 0x00, 0x00, 0x0c,
+                    0x00, 0x00, 0x28, 0xaf, 0x00, 0x00, 0x01, 0x02,
+                    0x40, 0x00, 0x00, 0x0c, 0x01, 0x00, 0x00, 0x23,
+                },
+            },
+        },
+    }
+}
+
+func TestPack(t *testing.T) {
+    var b packet.Buffer
+    b.Init(make([]byte, len(test_simple)))
+
+    p := MakeTestSimple()
+
+    if int(p.GetLength()) != len(test_simple) {
+        t.Fatalf("Length mismatch: %d", p.GetLength())
+    }
+
+    err := p.Pack(&b)
+    if err != nil {
+        t.Fatalf("Error packing: %s", err)
+    }
+
+    if !bytes.Equal(test_simple, b.Buffer()) {
+        t.Fatalf("Raw packet mismatch: %x", b.Buffer())
+    }
+}
+
+func BenchmarkPack(bn *testing.B) {
+    var b packet.Buffer
+    b.Init(make([]byte, len(test_simple)))
+
+    p := MakeTestSimple()
+
+    for n := 0; n < bn.N; n++ {
+        p.Pack(&b)
+    }
+}
+
+func TestUnpack(t *testing.T) {
+    var p diameter.Packet
+
+    cmp := MakeTestSimple()
+
+    var b packet.Buffer
+    b.Init(test_simple)
+
+    err := p.Unpack(&b)
+    if err != nil {
+        t.Fatalf("Error unpacking: %s", err)
+    }
+
+    if !p.Equals(cmp) {
+        t.Fatalf("Packet mismatch:\n%s\n%s", &p, cmp)
+    }
+
+    if len(p.AVPs) != len(cmp.AVPs) {
+        t.Fatalf("AVPs mismatch: %v", p.AVPs)
+    }
+
+    for i := range p.AVPs {
+        if p.AVPs[i].Code != cmp.AVPs[i].Code ||
+           p.AVPs[i].Flags != cmp.AVPs[i].Flags ||
+           !bytes.Equal(p.AVPs[i].Data, cmp.AVPs[i].Data) {
+            t.Fatalf("AVP mismatch: %v", p.AVPs[i])
+        }
+    }
+
+    avps, err := p.AVP(diameter.VendorSpecificApplicationId).AVPs()
+    if err != nil {
+        t.Fatalf("Error decoding grouped AVP: %s", err)
+    }
+
+    app, err := find(avps, diameter.AuthApplicationId).Uint32()
+    if err != nil || app != 16777251 {
+        t.Fatalf("Auth-Application-Id mismatch: %d", app)
+    }
+}
+
+func BenchmarkUnpack(bn *testing.B) {
+    var p diameter.Packet
+    var b packet.Buffer
+
+    for n := 0; n < bn.N; n++ {
+        b.Init(test_simple)
+        p.Unpack(&b)
+    }
+}
+
+func TestUnpackExchange(t *testing.T) {
+    data := append(append([]byte{}, test_simple...), test_answer...)
+
+    req, err := layers.UnpackAll(data, packet.Diameter)
+    if err != nil {
+        t.Fatalf("Error unpacking: %s", err)
+    }
+
+    if !req.Equals(MakeTestSimple()) {
+        t.Fatalf("Request mismatch: %s", req)
+    }
+
+    ans, ok := req.Payload().(*diameter.Packet)
+    if !ok || ans.Command != diameter.CapabilitiesExchange {
+        t.Fatalf("Answer mismatch: %v", req.Payload())
+    }
+
+    if !ans.Answers(req) || req.(*diameter.Packet).Answers(ans) {
+        t.Fatalf("Answer does not match the request")
+    }
+
+    code, err := ans.AVP(diameter.ResultCode).Uint32()
+    if err != nil || code != 2001 {
+        t.Fatalf("Result-Code mismatch: %d", code)
+    }
+
+    host := ans.AVP(diameter.OriginHost)
+    if host == nil || string(host.Data) != "server.example.com" {
+        t.Fatalf("Origin-Host mismatch: %v", host)
+    }
+}
+
+func find(avps []diameter.AVP, code diameter.AVPCode) *diameter.AVP {
+    for i := range avps {
+        if avps[i].Code == code {
+            return &avps[i]
+        }
+    }
+
+    return nil
+}
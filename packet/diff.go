@@ -0,0 +1,151 @@
+/*
+ * Network packet analysis framework.
+ *
+ * Copyright (c) 2014, Alessandro Ghedini
+ * All rights reserved.
+ *
+ * Redistribution and use in source and binary forms, with or without
+ * modification, are permitted provided that the following conditions are
+ * met:
+ *
+ *     * Redistributions of source code must retain the above copyright
+ *       notice, this list of conditions and the following disclaimer.
+ *
+ *     * Redistributions in binary form must reproduce the above copyright
+ *       notice, this list of conditions and the following disclaimer in the
+ *       documentation and/or other materials provided with the distribution.
+ *
+ * THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS
+ * IS" AND ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO,
+ * THE IMPLIED WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR
+ * PURPOSE ARE DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT HOLDER OR
+ * CONTRIBUTORS BE LIABLE FOR ANY DIRECT, INDIRECT, INCIDENTAL, SPECIAL,
+ * EXEMPLARY, OR CONSEQUENTIAL DAMAGES (INCLUDING, BUT NOT LIMITED TO,
+ * PROCUREMENT OF SUBSTITUTE GOODS OR SERVICES; LOSS OF USE, DATA, OR
+ * PROFITS; OR BUSINESS INTERRUPTION) HOWEVER CAUSED AND ON ANY THEORY OF
+ * LIABILITY, WHETHER IN CONTRACT, STRICT LIABILITY, OR TORT (INCLUDING
+ * NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE OF THIS
+ * SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+ */
+
+package packet
+
+import "fmt"
+import "reflect"
+import "strings"
+
+// A difference between two packets found by Diff(). If the two packets have a
+// different structure (e.g. one of them has an additional layer), the last
+// change has an empty Field, and Old and New hold the types of the layers found
+// at the given depth.
+type FieldChange struct {
+    /* Index of the layer in the packet stack, starting from 0 */
+    Depth int
+
+    /* Type of the layer in the first packet */
+    Layer Type
+
+    /* Name of the field (as used by Stringify()) */
+    Field string
+
+    Old   string
+    New   string
+}
+
+// Compare two packets layer by layer, and return the differences between the
+// fields of each pair of layers, from the outermost layer inwards. Comparison
+// stops at the first pair of layers with different types. Fields with a
+// "skip" string tag are ignored, fields with a "skip" cmp tag (e.g. checksums)
+// are not.
+func Diff(a, b Packet) []FieldChange {
+    var changes []FieldChange
+
+    for depth := 0; a != nil || b != nil; depth++ {
+        if a == nil || b == nil || a.GetType() != b.GetType() {
+            change := FieldChange{ Depth: depth, Old: "None", New: "None" }
+
+            if a != nil {
+                change.Layer = a.GetType()
+                change.Old   = a.GetType().String()
+            }
+
+            if b != nil {
+                change.New = b.GetType().String()
+            }
+
+            return append(changes, change)
+        }
+
+        changes = append(changes, diff_fields(depth, a, b)...)
+
+        a = a.Payload()
+        b = b.Payload()
+    }
+
+    return changes
+}
+
+func diff_fields(depth int, a, b Packet) []FieldChange {
+    var changes []FieldChange
+
+    aval := reflect.ValueOf(a).Elem()
+    bval := reflect.ValueOf(b).Elem()
+
+    if aval.Type() != bval.Type() {
+        return nil
+    }
+
+    for i := 0; i < aval.NumField(); i++ {
+        ftype := aval.Type().Field(i)
+
+        if ftype.PkgPath != "" {
+            continue
+        }
+
+        key := strings.ToLower(ftype.Name)
+
+        if ftype.Tag.Get("string") != "" {
+            key = ftype.Tag.Get("string")
+        }
+
+        if key == "skip" {
+            continue
+        }
+
+        afield := aval.Field(i)
+        bfield := bval.Field(i)
+
+        if compare_value(afield, bfield) ||
+           reflect.DeepEqual(afield.Interface(), bfield.Interface()) {
+            continue
+        }
+
+        changes = append(changes, FieldChange{
+            Depth: depth,
+            Layer: a.GetType(),
+            Field: key,
+            Old:   diff_value(key, afield),
+            New:   diff_value(key, bfield),
+        })
+    }
+
+    return changes
+}
+
+func diff_value(key string, val reflect.Value) string {
+    s := stringify_value(key, val)
+    if s == "" {
+        s = fmt.Sprint(val.Interface())
+    }
+
+    return s
+}
+
+func (c FieldChange) String() string {
+    if c.Field == "" {
+        return fmt.Sprintf("%d: %s -> %s", c.Depth, c.Old, c.New)
+    }
+
+    return fmt.Sprintf("%d: %s.%s: %s -> %s", c.Depth,
+                       strings.ToLower(c.Layer.String()), c.Field, c.Old, c.New)
+}
@@ -0,0 +1,104 @@
+/*
+ * Network packet analysis framework.
+ *
+ * Copyright (c) 2014, Alessandro Ghedini
+ * All rights reserved.
+ *
+ * Redistribution and use in source and binary forms, with or without
+ * modification, are permitted provided that the following conditions are
+ * met:
+ *
+ *     * Redistributions of source code must retain the above copyright
+ *       notice, this list of conditions and the following disclaimer.
+ *
+ *     * Redistributions in binary form must reproduce the above copyright
+ *       notice, this list of conditions and the following disclaimer in the
+ *       documentation and/or other materials provided with the distribution.
+ *
+ * THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS
+ * IS" AND ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO,
+ * THE IMPLIED WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR
+ * PURPOSE ARE DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT HOLDER OR
+ * CONTRIBUTORS BE LIABLE FOR ANY DIRECT, INDIRECT, INCIDENTAL, SPECIAL,
+ * EXEMPLARY, OR CONSEQUENTIAL DAMAGES (INCLUDING, BUT NOT LIMITED TO,
+ * PROCUREMENT OF SUBSTITUTE GOODS OR SERVICES; LOSS OF USE, DATA, OR
+ * PROFITS; OR BUSINESS INTERRUPTION) HOWEVER CAUSED AND ON ANY THEORY OF
+ * LIABILITY, WHETHER IN CONTRACT, STRICT LIABILITY, OR TORT (INCLUDING
+ * NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE OF THIS
+ * SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+ */
+
+package packet_test
+
+import "net"
+import "testing"
+
+import "github.com/adigal150/go.pkt/layers"
+import "github.com/adigal150/go.pkt/packet"
+import "github.com/adigal150/go.pkt/packet/eth"
+import "github.com/adigal150/go.pkt/packet/ipv4"
+import "github.com/adigal150/go.pkt/packet/tcp"
+import "github.com/adigal150/go.pkt/packet/vlan"
+
+func make_ipv4_tcp(src string, sport uint16) packet.Packet {
+    ip4_pkt := ipv4.Make()
+    ip4_pkt.SrcAddr = net.ParseIP(src)
+    ip4_pkt.DstAddr = net.ParseIP("198.51.100.1")
+
+    tcp_pkt := tcp.Make()
+    tcp_pkt.SrcPort = sport
+    tcp_pkt.DstPort = 80
+
+    buf, _ := layers.Pack(eth.Make(), ip4_pkt, tcp_pkt)
+
+    pkt, _ := layers.UnpackAll(buf, packet.Eth)
+
+    return pkt
+}
+
+func TestDiffNAT(t *testing.T) {
+    a := make_ipv4_tcp("192.168.1.10", 40000)
+    b := make_ipv4_tcp("203.0.113.5", 61000)
+
+    changes := packet.Diff(a, b)
+
+    expected := []string{
+        "1: ipv4.sum:",
+        "1: ipv4.src: 192.168.1.10 -> 203.0.113.5",
+        "2: tcp.sport: 40000 -> 61000",
+        "2: tcp.sum:",
+    }
+
+    if len(changes) != len(expected) {
+        t.Fatalf("Changes count mismatch: %v", changes)
+    }
+
+    for i, c := range changes {
+        s := c.String()
+
+        if len(s) < len(expected[i]) || s[:len(expected[i])] != expected[i] {
+            t.Fatalf("Change mismatch: %s", s)
+        }
+    }
+
+    if len(packet.Diff(a, a)) != 0 {
+        t.Fatalf("Changes between equal packets")
+    }
+}
+
+func TestDiffStructure(t *testing.T) {
+    a := make_ipv4_tcp("192.168.1.10", 40000)
+    b := make_ipv4_tcp("192.168.1.10", 40000)
+
+    vlan.Tag(b.(*eth.Packet), 10, 0)
+
+    changes := packet.Diff(a, b)
+    if len(changes) != 2 {
+        t.Fatalf("Changes count mismatch: %v", changes)
+    }
+
+    if changes[0].Field != "type" || changes[1].Field != "" ||
+       changes[1].Old != "IPv4" || changes[1].New != "VLAN" {
+        t.Fatalf("Change mismatch: %v", changes)
+    }
+}
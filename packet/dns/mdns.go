@@ -0,0 +1,66 @@
+/*
+ * Network packet analysis framework.
+ *
+ * Copyright (c) 2014, Alessandro Ghedini
+ * All rights reserved.
+ *
+ * Redistribution and use in source and binary forms, with or without
+ * modification, are permitted provided that the following conditions are
+ * met:
+ *
+ *     * Redistributions of source code must retain the above copyright
+ *       notice, this list of conditions and the following disclaimer.
+ *
+ *     * Redistributions in binary form must reproduce the above copyright
+ *       notice, this list of conditions and the following disclaimer in the
+ *       documentation and/or other materials provided with the distribution.
+ *
+ * THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS
+ * IS" AND ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO,
+ * THE IMPLIED WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR
+ * PURPOSE ARE DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT HOLDER OR
+ * CONTRIBUTORS BE LIABLE FOR ANY DIRECT, INDIRECT, INCIDENTAL, SPECIAL,
+ * EXEMPLARY, OR CONSEQUENTIAL DAMAGES (INCLUDING, BUT NOT LIMITED TO,
+ * PROCUREMENT OF SUBSTITUTE GOODS OR SERVICES; LOSS OF USE, DATA, OR
+ * PROFITS; OR BUSINESS INTERRUPTION) HOWEVER CAUSED AND ON ANY THEORY OF
+ * LIABILITY, WHETHER IN CONTRACT, STRICT LIABILITY, OR TORT (INCLUDING
+ * NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE OF THIS
+ * SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+ */
+
+package dns
+
+import "github.com/adigal150/go.pkt/packet"
+import "github.com/adigal150/go.pkt/packet/udp"
+
+/*
+ * Multicast DNS (RFC 6762) reuses the DNS wire format, but steals the top bit
+ * of the class field: in questions it requests a unicast response (QU), and in
+ * resource records it tells the receiver to flush its cache for the record.
+ */
+
+func init() {
+    udp.RegisterPort(5353, packet.DNS)
+}
+
+// Check whether an mDNS question requests a unicast response (QU question), as
+// opposed to a multicast one (QM question).
+func (q *Question) UnicastResponse() bool {
+    return q.Class & 0x8000 != 0
+}
+
+// Return the class of an mDNS question, without the unicast-response bit.
+func (q *Question) MDNSClass() Class {
+    return q.Class & 0x7FFF
+}
+
+// Check whether the cache-flush bit is set in an mDNS record, meaning that it
+// replaces any previously cached record with the same name, type and class.
+func (rr *RR) CacheFlush() bool {
+    return rr.Class & 0x8000 != 0
+}
+
+// Return the class of an mDNS record, without the cache-flush bit.
+func (rr *RR) MDNSClass() Class {
+    return rr.Class & 0x7FFF
+}
@@ -0,0 +1,657 @@
+/*
+ * Network packet analysis framework.
+ *
+ * Copyright (c) 2014, Alessandro Ghedini
+ * All rights reserved.
+ *
+ * Redistribution and use in source and binary forms, with or without
+ * modification, are permitted provided that the following conditions are
+ * met:
+ *
+ *     * Redistributions of source code must retain the above copyright
+ *       notice, this list of conditions and the following disclaimer.
+ *
+ *     * Redistributions in binary form must reproduce the above copyright
+ *       notice, this list of conditions and the following disclaimer in the
+ *       documentation and/or other materials provided with the distribution.
+ *
+ * THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS
+ * IS" AND ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO,
+ * THE IMPLIED WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR
+ * PURPOSE ARE DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT HOLDER OR
+ * CONTRIBUTORS BE LIABLE FOR ANY DIRECT, INDIRECT, INCIDENTAL, SPECIAL,
+ * EXEMPLARY, OR CONSEQUENTIAL DAMAGES (INCLUDING, BUT NOT LIMITED TO,
+ * PROCUREMENT OF SUBSTITUTE GOODS OR SERVICES; LOSS OF USE, DATA, OR
+ * PROFITS; OR BUSINESS INTERRUPTION) HOWEVER CAUSED AND ON ANY THEORY OF
+ * LIABILITY, WHETHER IN CONTRACT, STRICT LIABILITY, OR TORT (INCLUDING
+ * NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE OF THIS
+ * SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+ */
+
+// Provides encoding and decoding for DNS packets.
+//
+// Names embedded in the RDATA of NS, CNAME, PTR, MX and SRV records are
+// decompressed into the Target field (and the Data field is left empty), so
+// that decoded records can be encoded again. The RDATA of any other record type
+// is kept as-is.
+package dns
+
+import "fmt"
+import "math/rand"
+import "net"
+import "strings"
+
+import "github.com/adigal150/go.pkt/packet"
+import "github.com/adigal150/go.pkt/packet/udp"
+
+type Packet struct {
+    Id                 uint16
+    Response           bool       `string:"qr"`
+    Opcode             uint8      `string:"op"`
+    Authoritative      bool       `string:"aa"`
+    Truncated          bool       `string:"tc"`
+    RecursionDesired   bool       `string:"rd"`
+    RecursionAvailable bool       `string:"ra"`
+    RCode              uint8      `string:"rcode"`
+    QDCount            uint16     `string:"qd"`
+    ANCount            uint16     `string:"an"`
+    NSCount            uint16     `string:"ns"`
+    ARCount            uint16     `string:"ar"`
+    Question           []Question `cmp:"skip" string:"skip"`
+    Answer             []RR       `cmp:"skip" string:"skip"`
+    Authority          []RR       `cmp:"skip" string:"skip"`
+    Additional         []RR       `cmp:"skip" string:"skip"`
+
+    // Encode the QDCount, ANCount, NSCount and ARCount fields as-is, instead
+    // of computing them from the sections, e.g. to craft malformed packets.
+    KeepCounts         bool       `cmp:"skip" string:"skip"`
+
+    pkt_raw            []byte     `cmp:"skip" string:"skip"`
+}
+
+type Question struct {
+    Name  string
+    Type  Type
+    Class Class
+}
+
+type RR struct {
+    Name     string
+    Type     Type
+    Class    Class
+    TTL      uint32
+    Data     []byte
+
+    /* NS, CNAME, PTR, MX and SRV records */
+    Target   string
+
+    /* MX (preference) and SRV records */
+    Priority uint16
+
+    /* SRV records */
+    Weight   uint16
+    Port     uint16
+}
+
+type Type uint16
+
+const (
+    A     Type = 1
+    NS         = 2
+    CNAME      = 5
+    SOA        = 6
+    PTR        = 12
+    MX         = 15
+    TXT        = 16
+    AAAA       = 28
+    SRV        = 33
+    OPT        = 41
+    ANY        = 255
+)
+
+type Class uint16
+
+const (
+    IN       Class = 1
+    CH             = 3
+    HS             = 4
+    AnyClass       = 255
+)
+
+func init() {
+    udp.RegisterPort(53, packet.DNS)
+}
+
+func Make() *Packet {
+    return &Packet{ }
+}
+
+// Create a new recursive query for the records of the given type and name, with
+// a random identifier.
+func Query(name string, qtype Type) *Packet {
+    return &Packet{
+        Id:               uint16(rand.Uint32()),
+        RecursionDesired: true,
+        QDCount:          1,
+        Question:         []Question{
+            { Name: name, Type: qtype, Class: IN },
+        },
+    }
+}
+
+// Create a new response to the given query, with the given answer records.
+func Response(q *Packet, answers ...RR) *Packet {
+    return &Packet{
+        Id:                 q.Id,
+        Response:           true,
+        Opcode:             q.Opcode,
+        RecursionDesired:   q.RecursionDesired,
+        RecursionAvailable: true,
+        QDCount:            uint16(len(q.Question)),
+        ANCount:            uint16(len(answers)),
+        Question:           append([]Question(nil), q.Question...),
+        Answer:             answers,
+    }
+}
+
+func (p *Packet) GetType() packet.Type {
+    return packet.DNS
+}
+
+func (p *Packet) GetLength() uint16 {
+    length := 12
+
+    for _, q := range p.Question {
+        length += name_len(q.Name) + 4
+    }
+
+    for _, section := range [][]RR{ p.Answer, p.Authority, p.Additional } {
+        for _, rr := range section {
+            length += name_len(rr.Name) + 10 + len(rr.rdata())
+        }
+    }
+
+    return uint16(length)
+}
+
+func (p *Packet) Equals(other packet.Packet) bool {
+    return packet.Compare(p, other)
+}
+
+func (p *Packet) Answers(other packet.Packet) bool {
+    if other == nil || other.GetType() != packet.DNS {
+        return false
+    }
+
+    return p.Response && !other.(*Packet).Response &&
+           p.Id == other.(*Packet).Id
+}
+
+func (p *Packet) Pack(buf *packet.Buffer) error {
+    var flags uint16
+
+    if p.Response {
+        flags |= 0x8000
+    }
+
+    flags |= uint16(p.Opcode & 0x0F) << 11
+
+    if p.Authoritative {
+        flags |= 0x0400
+    }
+
+    if p.Truncated {
+        flags |= 0x0200
+    }
+
+    if p.RecursionDesired {
+        flags |= 0x0100
+    }
+
+    if p.RecursionAvailable {
+        flags |= 0x0080
+    }
+
+    flags |= uint16(p.RCode & 0x0F)
+
+    if !p.KeepCounts {
+        p.QDCount = uint16(len(p.Question))
+        p.ANCount = uint16(len(p.Answer))
+        p.NSCount = uint16(len(p.Authority))
+        p.ARCount = uint16(len(p.Additional))
+    }
+
+    buf.WriteN(p.Id)
+    buf.WriteN(flags)
+    buf.WriteN(p.QDCount)
+    buf.WriteN(p.ANCount)
+    buf.WriteN(p.NSCount)
+    buf.WriteN(p.ARCount)
+
+    for _, q := range p.Question {
+        name, err := encode_name(q.Name)
+        if err != nil {
+            return err
+        }
+
+        buf.Write(name)
+        buf.WriteN(q.Type)
+        buf.WriteN(q.Class)
+    }
+
+    for _, section := range [][]RR{ p.Answer, p.Authority, p.Additional } {
+        for _, rr := range section {
+            name, err := encode_name(rr.Name)
+            if err != nil {
+                return err
+            }
+
+            rdata := rr.rdata()
+            if rdata == nil && rr.Target != "" {
+                return fmt.Errorf("Invalid DNS name: %s", rr.Target)
+            }
+
+            buf.Write(name)
+            buf.WriteN(rr.Type)
+            buf.WriteN(rr.Class)
+            buf.WriteN(rr.TTL)
+            buf.WriteN(uint16(len(rdata)))
+            buf.Write(rdata)
+        }
+    }
+
+    return buf.Err()
+}
+
+func (p *Packet) Unpack(buf *packet.Buffer) error {
+    p.pkt_raw = buf.Bytes()
+
+    msg := buf.Bytes()
+
+    if len(msg) < 12 {
+        return packet.Errorf(packet.ErrTruncated, "Invalid DNS header")
+    }
+
+    var flags uint16
+
+    buf.ReadN(&p.Id)
+    buf.ReadN(&flags)
+
+    p.Response           = flags & 0x8000 != 0
+    p.Opcode             = uint8(flags >> 11) & 0x0F
+    p.Authoritative      = flags & 0x0400 != 0
+    p.Truncated          = flags & 0x0200 != 0
+    p.RecursionDesired   = flags & 0x0100 != 0
+    p.RecursionAvailable = flags & 0x0080 != 0
+    p.RCode              = uint8(flags) & 0x0F
+
+    buf.ReadN(&p.QDCount)
+    buf.ReadN(&p.ANCount)
+    buf.ReadN(&p.NSCount)
+    buf.ReadN(&p.ARCount)
+
+    off := 12
+
+    p.Question = nil
+
+    for i := 0; i < int(p.QDCount); i++ {
+        var q Question
+        var err error
+
+        q.Name, off, err = read_name(msg, off)
+        if err != nil {
+            return err
+        }
+
+        if off + 4 > len(msg) {
+            return packet.Errorf(packet.ErrTruncated, "Invalid DNS question")
+        }
+
+        q.Type  = Type(uint16(msg[off]) << 8 | uint16(msg[off + 1]))
+        q.Class = Class(uint16(msg[off + 2]) << 8 | uint16(msg[off + 3]))
+        off += 4
+
+        p.Question = append(p.Question, q)
+    }
+
+    var err error
+
+    p.Answer, off, err = read_section(msg, off, int(p.ANCount))
+    if err != nil {
+        return err
+    }
+
+    p.Authority, off, err = read_section(msg, off, int(p.NSCount))
+    if err != nil {
+        return err
+    }
+
+    p.Additional, off, err = read_section(msg, off, int(p.ARCount))
+    if err != nil {
+        return err
+    }
+
+    buf.Next(off - 12)
+
+    return buf.Err()
+}
+
+func (p *Packet) Payload() packet.Packet {
+    return nil
+}
+
+func (p *Packet) RawBytes() []byte {
+    return p.pkt_raw
+}
+
+func (p *Packet) HeaderBytes() []byte {
+    return packet.HeaderBytes(p)
+}
+
+func (p *Packet) GuessPayloadType() packet.Type {
+    return packet.None
+}
+
+func (p *Packet) SetPayload(pl packet.Packet) error {
+    return nil
+}
+
+func (p *Packet) InitChecksum(csum uint32) {
+}
+
+func (p *Packet) Clone() packet.Packet {
+    c := *p
+
+    c.Question   = append([]Question(nil), p.Question...)
+    c.Answer     = clone_rrs(p.Answer)
+    c.Authority  = clone_rrs(p.Authority)
+    c.Additional = clone_rrs(p.Additional)
+
+    return &c
+}
+
+func (p *Packet) String() string {
+    return packet.Stringify(p)
+}
+
+// Return the address carried by an A or AAAA record, or nil.
+func (rr *RR) IP() net.IP {
+    switch {
+    case rr.Type == A && len(rr.Data) == 4,
+         rr.Type == AAAA && len(rr.Data) == 16:
+        return net.IP(rr.Data)
+    }
+
+    return nil
+}
+
+// Return the strings carried by a TXT record.
+func (rr *RR) Text() []string {
+    var txt []string
+
+    if rr.Type != TXT {
+        return nil
+    }
+
+    for data := rr.Data; len(data) > 0; {
+        l := int(data[0])
+        if 1 + l > len(data) {
+            break
+        }
+
+        txt = append(txt, string(data[1:1 + l]))
+        data = data[1 + l:]
+    }
+
+    return txt
+}
+
+func (rr *RR) rdata() []byte {
+    if rr.Data != nil {
+        return rr.Data
+    }
+
+    switch rr.Type {
+    case NS, CNAME, PTR:
+        name, err := encode_name(rr.Target)
+        if err != nil {
+            return nil
+        }
+
+        return name
+
+    case MX:
+        name, err := encode_name(rr.Target)
+        if err != nil {
+            return nil
+        }
+
+        return append([]byte{ byte(rr.Priority >> 8), byte(rr.Priority) },
+                      name...)
+
+    case SRV:
+        name, err := encode_name(rr.Target)
+        if err != nil {
+            return nil
+        }
+
+        return append([]byte{
+            byte(rr.Priority >> 8), byte(rr.Priority),
+            byte(rr.Weight >> 8), byte(rr.Weight),
+            byte(rr.Port >> 8), byte(rr.Port),
+        }, name...)
+    }
+
+    return nil
+}
+
+func read_section(msg []byte, off int, count int) ([]RR, int, error) {
+    var rrs []RR
+
+    for i := 0; i < count; i++ {
+        var rr RR
+        var err error
+
+        rr.Name, off, err = read_name(msg, off)
+        if err != nil {
+            return nil, 0, err
+        }
+
+        if off + 10 > len(msg) {
+            return nil, 0, packet.Errorf(packet.ErrTruncated,
+                                         "Invalid DNS record")
+        }
+
+        rr.Type  = Type(uint16(msg[off]) << 8 | uint16(msg[off + 1]))
+        rr.Class = Class(uint16(msg[off + 2]) << 8 | uint16(msg[off + 3]))
+        rr.TTL   = uint32(msg[off + 4]) << 24 | uint32(msg[off + 5]) << 16 |
+                   uint32(msg[off + 6]) << 8  | uint32(msg[off + 7])
+
+        rdlen := int(msg[off + 8]) << 8 | int(msg[off + 9])
+        off += 10
+
+        if off + rdlen > len(msg) {
+            return nil, 0, packet.Errorf(packet.ErrTruncated,
+                                         "Invalid DNS record data")
+        }
+
+        rdata := msg[off:off + rdlen]
+
+        switch rr.Type {
+        case NS, CNAME, PTR:
+            rr.Target, _, err = read_name(msg, off)
+
+        case MX:
+            if rdlen < 2 {
+                return nil, 0, packet.Errorf(packet.ErrInvalidLength,
+                                             "Invalid DNS MX record")
+            }
+
+            rr.Priority = uint16(rdata[0]) << 8 | uint16(rdata[1])
+            rr.Target, _, err = read_name(msg, off + 2)
+
+        case SRV:
+            if rdlen < 6 {
+                return nil, 0, packet.Errorf(packet.ErrInvalidLength,
+                                             "Invalid DNS SRV record")
+            }
+
+            rr.Priority = uint16(rdata[0]) << 8 | uint16(rdata[1])
+            rr.Weight   = uint16(rdata[2]) << 8 | uint16(rdata[3])
+            rr.Port     = uint16(rdata[4]) << 8 | uint16(rdata[5])
+            rr.Target, _, err = read_name(msg, off + 6)
+
+        default:
+            rr.Data = rdata
+        }
+
+        if err != nil {
+            return nil, 0, err
+        }
+
+        off += rdlen
+
+        rrs = append(rrs, rr)
+    }
+
+    return rrs, off, nil
+}
+
+/* maximum length of an encoded name, and number of compression pointers
+ * followed while decoding it */
+const max_name_len   = 255
+const max_name_jumps = 64
+
+/* decode a (possibly compressed) name, and return the offset following it */
+func read_name(msg []byte, off int) (string, int, error) {
+    var labels []string
+
+    end   := -1
+    start := off
+    size  := 1
+    jumps := 0
+
+    for {
+        if off >= len(msg) {
+            return "", 0, packet.Errorf(packet.ErrTruncated, "Invalid DNS name")
+        }
+
+        l := int(msg[off])
+
+        switch {
+        case l == 0:
+            if end < 0 {
+                end = off + 1
+            }
+
+            return strings.Join(labels, "."), end, nil
+
+        case l & 0xC0 == 0xC0:
+            if off + 1 >= len(msg) {
+                return "", 0, packet.Errorf(packet.ErrTruncated,
+                                            "Invalid DNS name pointer")
+            }
+
+            ptr := (l & 0x3F) << 8 | int(msg[off + 1])
+
+            /* only allow pointers before the labels decoded so far (i.e.
+             * before the target of the previous pointer), to avoid loops */
+            if ptr >= start || jumps >= max_name_jumps {
+                return "", 0, packet.Errorf(packet.ErrInvalidLength,
+                                            "Invalid DNS name pointer")
+            }
+
+            start  = ptr
+            jumps += 1
+
+            if end < 0 {
+                end = off + 2
+            }
+
+            off = ptr
+
+        case l & 0xC0 != 0:
+            return "", 0, packet.Errorf(packet.ErrUnsupported,
+                                        "Invalid DNS label")
+
+        default:
+            if off + 1 + l > len(msg) {
+                return "", 0, packet.Errorf(packet.ErrTruncated,
+                                            "Invalid DNS name")
+            }
+
+            size += 1 + l
+            if size > max_name_len {
+                return "", 0, packet.Errorf(packet.ErrInvalidLength,
+                                            "Invalid DNS name length")
+            }
+
+            labels = append(labels, string(msg[off + 1:off + 1 + l]))
+            off += 1 + l
+        }
+    }
+}
+
+func encode_name(name string) ([]byte, error) {
+    var buf []byte
+
+    for _, label := range strings.Split(name, ".") {
+        if label == "" {
+            continue
+        }
+
+        if len(label) > 63 {
+            return nil, fmt.Errorf("Invalid DNS label: %s", label)
+        }
+
+        buf = append(buf, byte(len(label)))
+        buf = append(buf, label...)
+    }
+
+    return append(buf, 0x00), nil
+}
+
+func name_len(name string) int {
+    length := 1
+
+    for _, label := range strings.Split(name, ".") {
+        if label != "" {
+            length += 1 + len(label)
+        }
+    }
+
+    return length
+}
+
+func (t Type) String() string {
+    switch t {
+    case A:     return "A"
+    case NS:    return "NS"
+    case CNAME: return "CNAME"
+    case SOA:   return "SOA"
+    case PTR:   return "PTR"
+    case MX:    return "MX"
+    case TXT:   return "TXT"
+    case AAAA:  return "AAAA"
+    case SRV:   return "SRV"
+    case OPT:   return "OPT"
+    case ANY:   return "ANY"
+    default:    return fmt.Sprintf("0x%x", uint16(t))
+    }
+}
+
+func clone_rrs(rrs []RR) []RR {
+    if rrs == nil {
+        return nil
+    }
+
+    clone := make([]RR, len(rrs))
+
+    for i, rr := range rrs {
+        rr.Data = packet.CloneBytes(rr.Data)
+
+        clone[i] = rr
+    }
+
+    return clone
+}
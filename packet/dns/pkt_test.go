@@ -0,0 +1,427 @@
+/*
+ * Network packet analysis framework.
+ *
+ * Copyright (c) 2014, Alessandro Ghedini
+ * All rights reserved.
+ *
+ * Redistribution and use in source and binary forms, with or without
+ * modification, are permitted provided that the following conditions are
+ * met:
+ *
+ *     * Redistributions of source code must retain the above copyright
+ *       notice, this list of conditions and the following disclaimer.
+ *
+ *     * Redistributions in binary form must reproduce the above copyright
+ *       notice, this list of conditions and the following disclaimer in the
+ *       documentation and/or other materials provided with the distribution.
+ *
+ * THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS
+ * IS" AND ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO,
+ * THE IMPLIED WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR
+ * PURPOSE ARE DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT HOLDER OR
+ * CONTRIBUTORS BE LIABLE FOR ANY DIRECT, INDIRECT, INCIDENTAL, SPECIAL,
+ * EXEMPLARY, OR CONSEQUENTIAL DAMAGES (INCLUDING, BUT NOT LIMITED TO,
+ * PROCUREMENT OF SUBSTITUTE GOODS OR SERVICES; LOSS OF USE, DATA, OR
+ * PROFITS; OR BUSINESS INTERRUPTION) HOWEVER CAUSED AND ON ANY THEORY OF
+ * LIABILITY, WHETHER IN CONTRACT, STRICT LIABILITY, OR TORT (INCLUDING
+ * NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE OF THIS
+ * SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+ */
+
+package dns_test
+
+import "bytes"
+import "errors"
+import "net"
+import "testing"
+
+import "github.com/adigal150/go.pkt/packet"
+import "github.com/adigal150/go.pkt/packet/dns"
+
+var test_simple = []byte{
+    0x12, 0x34, 0x81, 0x80, 0x00, 0x01, 0x00, 0x01, 0x00, 0x00, 0x00, 0x00,
+    0x07, 0x65, 0x78, 0x61, 0x6d, 0x70, 0x6c, 0x65, 0x03, 0x63, 0x6f, 0x6d,
+    0x00, 0x00, 0x01, 0x00, 0x01, 0x07, 0x65, 0x78, 0x61, 0x6d, 0x70, 0x6c,
+    0x65, 0x03, 0x63, 0x6f, 0x6d, 0x00, 0x00, 0x01, 0x00, 0x01, 0x00, 0x00,
+    0x0e, 0x10, 0x00, 0x04, 0x5d, 0xb8, 0xd8, 0x22,
+}
+
+var test_mdns_response = []byte{
+    0x00, 0x00, 0x84, 0x00, 0x00, 0x00, 0x00, 0x03, 0x00, 0x00, 0x00, 0x01,
+    0x05, 0x5f, 0x68, 0x74, 0x74, 0x70, 0x04, 0x5f, 0x74, 0x63, 0x70, 0x05,
+    0x6c, 0x6f, 0x63, 0x61, 0x6c, 0x00, 0x00, 0x0c, 0x00, 0x01, 0x00, 0x00,
+    0x11, 0x94, 0x00, 0x06, 0x03, 0x77, 0x65, 0x62, 0xc0, 0x0c, 0xc0, 0x28,
+    0x00, 0x21, 0x80, 0x01, 0x00, 0x00, 0x00, 0x78, 0x00, 0x0d, 0x00, 0x00,
+    0x00, 0x00, 0x1f, 0x90, 0x04, 0x68, 0x6f, 0x73, 0x74, 0xc0, 0x17, 0xc0,
+    0x28, 0x00, 0x10, 0x80, 0x01, 0x00, 0x00, 0x11, 0x94, 0x00, 0x0a, 0x09,
+    0x70, 0x61, 0x74, 0x68, 0x3d, 0x2f, 0x77, 0x65, 0x62, 0xc0, 0x40, 0x00,
+    0x01, 0x80, 0x01, 0x00, 0x00, 0x00, 0x78, 0x00, 0x04, 0xc0, 0xa8, 0x01,
+    0x0a,
+}
+
+var test_mdns_query = []byte{
+    0x00, 0x00, 0x00, 0x00, 0x00, 0x01, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00,
+    0x05, 0x5f, 0x68, 0x74, 0x74, 0x70, 0x04, 0x5f, 0x74, 0x63, 0x70, 0x05,
+    0x6c, 0x6f, 0x63, 0x61, 0x6c, 0x00, 0x00, 0x0c, 0x80, 0x01,
+}
+
+func MakeTestSimple() *dns.Packet {
+    return &dns.Packet{
+        Id: 0x1234,
+        Response: true,
+        RecursionDesired: true,
+        RecursionAvailable: true,
+        QDCount: 1,
+        ANCount: 1,
+        Question: []dns.Question{
+            { Name: "example.com", Type: dns.A, Class: dns.IN },
+        },
+        Answer: []dns.RR{
+            {
+                Name: "example.com", Type: dns.A, Class: dns.IN, TTL: 3600,
+                Data: net.ParseIP("93.184.216.34").To4(),
+            },
+        },
+    }
+}
+
+func TestPack(t *testing.T) {
+    var b packet.Buffer
+    b.Init(make([]byte, len(test_simple)))
+
+    p := MakeTestSimple()
+
+    if int(p.GetLength()) != len(test_simple) {
+        t.Fatalf("Length mismatch: %d", p.GetLength())
+    }
+
+    err := p.Pack(&b)
+    if err != nil {
+        t.Fatalf("Error packing: %s", err)
+    }
+
+    if !bytes.Equal(test_simple, b.Buffer()) {
+        t.Fatalf("Raw packet mismatch: %x", b.Buffer())
+    }
+}
+
+func BenchmarkPack(bn *testing.B) {
+    var b packet.Buffer
+    b.Init(make([]byte, len(test_simple)))
+
+    p := MakeTestSimple()
+
+    for n := 0; n < bn.N; n++ {
+        p.Pack(&b)
+    }
+}
+
+func TestUnpack(t *testing.T) {
+    var p dns.Packet
+
+    cmp := MakeTestSimple()
+
+    var b packet.Buffer
+    b.Init(test_simple)
+
+    err := p.Unpack(&b)
+    if err != nil {
+        t.Fatalf("Error unpacking: %s", err)
+    }
+
+    if !p.Equals(cmp) {
+        t.Fatalf("Packet mismatch:\n%s\n%s", &p, cmp)
+    }
+
+    if len(p.Question) != 1 || p.Question[0] != cmp.Question[0] {
+        t.Fatalf("Question mismatch: %v", p.Question)
+    }
+
+    if len(p.Answer) != 1 || !p.Answer[0].IP().Equal(cmp.Answer[0].IP()) {
+        t.Fatalf("Answer mismatch: %v", p.Answer)
+    }
+
+    if b.Len() != 0 {
+        t.Fatalf("Trailing data: %d", b.Len())
+    }
+}
+
+func BenchmarkUnpack(bn *testing.B) {
+    var p dns.Packet
+    var b packet.Buffer
+
+    for n := 0; n < bn.N; n++ {
+        b.Init(test_simple)
+        p.Unpack(&b)
+    }
+}
+
+func TestUnpackMDNSResponse(t *testing.T) {
+    var p dns.Packet
+
+    var b packet.Buffer
+    b.Init(test_mdns_response)
+
+    err := p.Unpack(&b)
+    if err != nil {
+        t.Fatalf("Error unpacking: %s", err)
+    }
+
+    if !p.Response || !p.Authoritative {
+        t.Fatalf("Flags mismatch: %s", &p)
+    }
+
+    if len(p.Answer) != 3 || len(p.Additional) != 1 {
+        t.Fatalf("Section mismatch: %d %d", len(p.Answer), len(p.Additional))
+    }
+
+    ptr := p.Answer[0]
+    if ptr.Type != dns.PTR || ptr.Name != "_http._tcp.local" ||
+       ptr.Target != "web._http._tcp.local" || ptr.CacheFlush() {
+        t.Fatalf("PTR mismatch: %v", ptr)
+    }
+
+    srv := p.Answer[1]
+    if srv.Type != dns.SRV || srv.Name != "web._http._tcp.local" ||
+       srv.Port != 8080 || srv.Target != "host.local" {
+        t.Fatalf("SRV mismatch: %v", srv)
+    }
+
+    if !srv.CacheFlush() || srv.MDNSClass() != dns.IN {
+        t.Fatalf("SRV class mismatch: %x", srv.Class)
+    }
+
+    txt := p.Answer[2].Text()
+    if len(txt) != 1 || txt[0] != "path=/web" {
+        t.Fatalf("TXT mismatch: %v", txt)
+    }
+
+    a := p.Additional[0]
+    if a.Name != "host.local" || !a.IP().Equal(net.ParseIP("192.168.1.10")) {
+        t.Fatalf("A mismatch: %v", a)
+    }
+}
+
+func TestUnpackMDNSQuery(t *testing.T) {
+    var p dns.Packet
+
+    var b packet.Buffer
+    b.Init(test_mdns_query)
+
+    err := p.Unpack(&b)
+    if err != nil {
+        t.Fatalf("Error unpacking: %s", err)
+    }
+
+    if p.Response || len(p.Question) != 1 {
+        t.Fatalf("Packet mismatch: %s", &p)
+    }
+
+    q := p.Question[0]
+    if q.Name != "_http._tcp.local" || q.Type != dns.PTR {
+        t.Fatalf("Question mismatch: %v", q)
+    }
+
+    if !q.UnicastResponse() || q.MDNSClass() != dns.IN {
+        t.Fatalf("Question class mismatch: %x", q.Class)
+    }
+}
+
+func TestRepackCompressed(t *testing.T) {
+    var p dns.Packet
+
+    var b packet.Buffer
+    b.Init(test_mdns_response)
+
+    err := p.Unpack(&b)
+    if err != nil {
+        t.Fatalf("Error unpacking: %s", err)
+    }
+
+    var out packet.Buffer
+    out.Init(make([]byte, p.GetLength()))
+
+    err = p.Pack(&out)
+    if err != nil {
+        t.Fatalf("Error packing: %s", err)
+    }
+
+    var q dns.Packet
+
+    out.Init(out.Buffer())
+
+    err = q.Unpack(&out)
+    if err != nil {
+        t.Fatalf("Error unpacking: %s", err)
+    }
+
+    if q.Answer[1].Target != "host.local" || q.Answer[1].Port != 8080 {
+        t.Fatalf("SRV mismatch: %v", q.Answer[1])
+    }
+}
+
+func TestUnpackPointerLoop(t *testing.T) {
+    var p dns.Packet
+
+    msg := []byte{
+        0x00, 0x00, 0x00, 0x00, 0x00, 0x01, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00,
+        0xc0, 0x0c, 0x00, 0x01, 0x00, 0x01,
+    }
+
+    var b packet.Buffer
+    b.Init(msg)
+
+    err := p.Unpack(&b)
+    if !errors.Is(err, packet.ErrInvalidLength) {
+        t.Fatalf("Expected invalid length error: %v", err)
+    }
+}
+
+func TestUnpackPointerSelfLoop(t *testing.T) {
+    var p dns.Packet
+
+    /* the pointer targets the start of its own name */
+    msg := []byte{
+        0x00, 0x01, 0x00, 0x00, 0x00, 0x01, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00,
+        0x01, 'a', 0xc0, 0x0c,
+    }
+
+    var b packet.Buffer
+    b.Init(msg)
+
+    err := p.Unpack(&b)
+    if !errors.Is(err, packet.ErrInvalidLength) {
+        t.Fatalf("Expected invalid length error: %v", err)
+    }
+}
+
+func TestUnpackNameTooLong(t *testing.T) {
+    var p dns.Packet
+
+    msg := []byte{
+        0x00, 0x01, 0x00, 0x00, 0x00, 0x01, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00,
+    }
+
+    /* 5 labels of 63 bytes, longer than 255 bytes in total */
+    for i := 0; i < 5; i++ {
+        msg = append(msg, 63)
+        msg = append(msg, bytes.Repeat([]byte{ 'a' }, 63)...)
+    }
+
+    msg = append(msg, 0x00, 0x00, 0x01, 0x00, 0x01)
+
+    var b packet.Buffer
+    b.Init(msg)
+
+    err := p.Unpack(&b)
+    if !errors.Is(err, packet.ErrInvalidLength) {
+        t.Fatalf("Expected invalid length error: %v", err)
+    }
+}
+
+func TestUnpackInvalidLabel(t *testing.T) {
+    var p dns.Packet
+
+    /* 0x40 is a reserved label type */
+    msg := []byte{
+        0x00, 0x01, 0x00, 0x00, 0x00, 0x01, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00,
+        0x40, 0x00, 0x01, 0x00, 0x01,
+    }
+
+    var b packet.Buffer
+    b.Init(msg)
+
+    err := p.Unpack(&b)
+    if !errors.Is(err, packet.ErrUnsupported) {
+        t.Fatalf("Expected unsupported error: %v", err)
+    }
+}
+
+func TestPackCounts(t *testing.T) {
+    var b packet.Buffer
+    b.Init(make([]byte, len(test_simple)))
+
+    p := MakeTestSimple()
+    p.QDCount = 0
+    p.ANCount = 0
+    p.ARCount = 5
+
+    err := p.Pack(&b)
+    if err != nil {
+        t.Fatalf("Error packing: %s", err)
+    }
+
+    if p.QDCount != 1 || p.ANCount != 1 || p.ARCount != 0 ||
+       !bytes.Equal(test_simple, b.Buffer()) {
+        t.Fatalf("Raw packet mismatch: %x", b.Buffer())
+    }
+
+    p.ARCount    = 5
+    p.KeepCounts = true
+
+    b.Init(make([]byte, len(test_simple)))
+
+    err = p.Pack(&b)
+    if err != nil {
+        t.Fatalf("Error packing: %s", err)
+    }
+
+    if !bytes.Equal(b.Buffer()[10:12], []byte{ 0x00, 0x05 }) {
+        t.Fatalf("Raw packet mismatch: %x", b.Buffer())
+    }
+}
+
+func TestQueryResponse(t *testing.T) {
+    q := dns.Query("example.com", dns.A)
+
+    rsp := dns.Response(q,
+        dns.RR{
+            Name: "example.com", Type: dns.A, Class: dns.IN, TTL: 60,
+            Data: net.ParseIP("93.184.216.34").To4(),
+        },
+        dns.RR{
+            Name: "example.com", Type: dns.A, Class: dns.IN, TTL: 60,
+            Data: net.ParseIP("93.184.216.35").To4(),
+        },
+    )
+
+    if !rsp.Answers(q) || q.Answers(rsp) {
+        t.Fatalf("Response does not answer query")
+    }
+
+    for _, p := range []*dns.Packet{ q, rsp } {
+        var b packet.Buffer
+        b.Init(make([]byte, p.GetLength()))
+
+        err := p.Pack(&b)
+        if err != nil {
+            t.Fatalf("Error packing: %s", err)
+        }
+
+        var cmp dns.Packet
+
+        b.Init(b.Buffer())
+
+        err = cmp.Unpack(&b)
+        if err != nil {
+            t.Fatalf("Error unpacking: %s", err)
+        }
+
+        if !cmp.Equals(p) {
+            t.Fatalf("Packet mismatch:\n%s\n%s", &cmp, p)
+        }
+
+        if len(cmp.Question) != 1 || cmp.Question[0].Name != "example.com" ||
+           cmp.Question[0].Type != dns.A {
+            t.Fatalf("Question mismatch: %v", cmp.Question)
+        }
+
+        if len(cmp.Answer) != len(p.Answer) {
+            t.Fatalf("Answer count mismatch: %d", len(cmp.Answer))
+        }
+    }
+
+    if rsp.ANCount != 2 || !rsp.RecursionDesired || !rsp.RecursionAvailable {
+        t.Fatalf("Header mismatch: %s", rsp)
+    }
+}
@@ -0,0 +1,259 @@
+/*
+ * Network packet analysis framework.
+ *
+ * Copyright (c) 2014, Alessandro Ghedini
+ * All rights reserved.
+ *
+ * Redistribution and use in source and binary forms, with or without
+ * modification, are permitted provided that the following conditions are
+ * met:
+ *
+ *     * Redistributions of source code must retain the above copyright
+ *       notice, this list of conditions and the following disclaimer.
+ *
+ *     * Redistributions in binary form must reproduce the above copyright
+ *       notice, this list of conditions and the following disclaimer in the
+ *       documentation and/or other materials provided with the distribution.
+ *
+ * THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS
+ * IS" AND ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO,
+ * THE IMPLIED WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR
+ * PURPOSE ARE DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT HOLDER OR
+ * CONTRIBUTORS BE LIABLE FOR ANY DIRECT, INDIRECT, INCIDENTAL, SPECIAL,
+ * EXEMPLARY, OR CONSEQUENTIAL DAMAGES (INCLUDING, BUT NOT LIMITED TO,
+ * PROCUREMENT OF SUBSTITUTE GOODS OR SERVICES; LOSS OF USE, DATA, OR
+ * PROFITS; OR BUSINESS INTERRUPTION) HOWEVER CAUSED AND ON ANY THEORY OF
+ * LIABILITY, WHETHER IN CONTRACT, STRICT LIABILITY, OR TORT (INCLUDING
+ * NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE OF THIS
+ * SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+ */
+
+// Provides encoding and decoding for DTP (Cisco Dynamic Trunking Protocol)
+// packets, carried over 802.3 frames with LLC and SNAP headers.
+//
+// The domain, status, trunk type and neighbor TLVs are decoded into the
+// corresponding fields. Any other TLV is kept as-is in the Options field, and
+// encoded after the known ones.
+package dtp
+
+import "fmt"
+import "net"
+import "strings"
+
+import "github.com/adigal150/go.pkt/packet"
+
+type Packet struct {
+    Version     uint8
+    Domain      string           `string:"domain"`
+    Status      Status
+    TrunkType   TrunkType        `string:"trunk"`
+    Neighbor    net.HardwareAddr `string:"neigh"`
+    Options     []packet.TLV     `cmp:"skip" string:"skip"`
+    pkt_raw     []byte           `cmp:"skip" string:"skip"`
+}
+
+// Trunking status of a port, combining its operational status (access or
+// trunk) and its administrative mode.
+type Status uint8
+
+// Administrative mode of a port.
+type Mode uint8
+
+const (
+    On        Mode = 0x01
+    Off            = 0x02
+    Desirable      = 0x03
+    Auto           = 0x04
+)
+
+// Trunk encapsulation type, with the operational type in the 3 most significant
+// bits and the administrative one in the 3 least significant bits.
+type TrunkType uint8
+
+const (
+    tlv_domain   = 0x0001
+    tlv_status   = 0x0002
+    tlv_type     = 0x0003
+    tlv_neighbor = 0x0004
+
+    /* the operational status bit of the status TLV */
+    status_trunk = 0x80
+)
+
+func Make() *Packet {
+    return &Packet{
+        Version:   1,
+        Status:    Status(Desirable),
+        TrunkType: 0xa5,
+    }
+}
+
+func (p *Packet) GetType() packet.Type {
+    return packet.DTP
+}
+
+func (p *Packet) GetLength() uint16 {
+    length := uint16(1 + 4 + len(p.Domain) + 1 + 5 + 5)
+
+    if p.Neighbor != nil {
+        length += 4 + uint16(len(p.Neighbor))
+    }
+
+    for _, opt := range p.Options {
+        length += 4 + uint16(len(opt.Value))
+    }
+
+    return length
+}
+
+func (p *Packet) Equals(other packet.Packet) bool {
+    return packet.Compare(p, other)
+}
+
+func (p *Packet) Answers(other packet.Packet) bool {
+    return false
+}
+
+func (p *Packet) Pack(buf *packet.Buffer) error {
+    buf.WriteN(p.Version)
+
+    write_tlv(buf, tlv_domain, append([]byte(p.Domain), 0x00))
+    write_tlv(buf, tlv_status, []byte{ byte(p.Status) })
+    write_tlv(buf, tlv_type, []byte{ byte(p.TrunkType) })
+
+    if p.Neighbor != nil {
+        write_tlv(buf, tlv_neighbor, p.Neighbor)
+    }
+
+    for _, opt := range p.Options {
+        write_tlv(buf, opt.Type, opt.Value)
+    }
+
+    return buf.Err()
+}
+
+func (p *Packet) Unpack(buf *packet.Buffer) error {
+    p.pkt_raw = buf.Bytes()
+
+    buf.ReadN(&p.Version)
+
+    p.Domain    = ""
+    p.Status    = 0
+    p.TrunkType = 0
+    p.Neighbor  = nil
+    p.Options   = nil
+
+    for buf.Len() > 0 && buf.Err() == nil {
+        var t, l uint16
+
+        buf.ReadN(&t, &l)
+
+        /* the length includes the type and length fields */
+        if l < 4 || int(l) - 4 > buf.Len() {
+            return packet.Errorf(packet.ErrInvalidLength,
+                                 "Invalid DTP TLV length: %d", l)
+        }
+
+        value := buf.Next(int(l) - 4)
+
+        switch {
+        case t == tlv_domain:
+            p.Domain = strings.TrimRight(string(value), "\x00")
+
+        case t == tlv_status && len(value) == 1:
+            p.Status = Status(value[0])
+
+        case t == tlv_type && len(value) == 1:
+            p.TrunkType = TrunkType(value[0])
+
+        case t == tlv_neighbor && len(value) == 6:
+            p.Neighbor = net.HardwareAddr(value)
+
+        default:
+            p.Options = append(p.Options, packet.TLV{ Type: t, Value: value })
+        }
+    }
+
+    return buf.Err()
+}
+
+func (p *Packet) Payload() packet.Packet {
+    return nil
+}
+
+func (p *Packet) RawBytes() []byte {
+    return p.pkt_raw
+}
+
+func (p *Packet) HeaderBytes() []byte {
+    return packet.HeaderBytes(p)
+}
+
+func (p *Packet) GuessPayloadType() packet.Type {
+    return packet.None
+}
+
+func (p *Packet) SetPayload(pl packet.Packet) error {
+    return nil
+}
+
+func (p *Packet) InitChecksum(csum uint32) {
+}
+
+func (p *Packet) Clone() packet.Packet {
+    c := *p
+
+    c.Neighbor = packet.CloneBytes(p.Neighbor)
+    c.Options  = packet.CloneTLVs(p.Options)
+
+    return &c
+}
+
+func (p *Packet) String() string {
+    return packet.Stringify(p)
+}
+
+// Return whether the port is operating as a trunk.
+func (s Status) Trunking() bool {
+    return s & status_trunk != 0
+}
+
+// Return the administrative mode of the port.
+func (s Status) Mode() Mode {
+    return Mode(s & 0x07)
+}
+
+func (s Status) String() string {
+    op := "access"
+
+    if s.Trunking() {
+        op = "trunk"
+    }
+
+    return op + "/" + s.Mode().String()
+}
+
+func (m Mode) String() string {
+    switch m {
+    case On:        return "on"
+    case Off:       return "off"
+    case Desirable: return "desirable"
+    case Auto:      return "auto"
+    default:        return "unknown"
+    }
+}
+
+// Return the operational encapsulation of the trunk (e.g. "802.1q").
+func (t TrunkType) String() string {
+    switch t >> 5 {
+    case 0x00: return "native"
+    case 0x02: return "isl"
+    case 0x05: return "802.1q"
+    default:   return fmt.Sprintf("%x", uint8(t))
+    }
+}
+
+func write_tlv(buf *packet.Buffer, tlv_type uint16, value []byte) {
+    buf.WriteN(tlv_type, uint16(4 + len(value)))
+    buf.Write(value)
+}
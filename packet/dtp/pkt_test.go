@@ -0,0 +1,114 @@
+/*
+ * Network packet analysis framework.
+ *
+ * Copyright (c) 2014, Alessandro Ghedini
+ * All rights reserved.
+ *
+ * Redistribution and use in source and binary forms, with or without
+ * modification, are permitted provided that the following conditions are
+ * met:
+ *
+ *     * Redistributions of source code must retain the above copyright
+ *       notice, this list of conditions and the following disclaimer.
+ *
+ *     * Redistributions in binary form must reproduce the above copyright
+ *       notice, this list of conditions and the following disclaimer in the
+ *       documentation and/or other materials provided with the distribution.
+ *
+ * THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS
+ * IS" AND ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO,
+ * THE IMPLIED WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR
+ * PURPOSE ARE DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT HOLDER OR
+ * CONTRIBUTORS BE LIABLE FOR ANY DIRECT, INDIRECT, INCIDENTAL, SPECIAL,
+ * EXEMPLARY, OR CONSEQUENTIAL DAMAGES (INCLUDING, BUT NOT LIMITED TO,
+ * PROCUREMENT OF SUBSTITUTE GOODS OR SERVICES; LOSS OF USE, DATA, OR
+ * PROFITS; OR BUSINESS INTERRUPTION) HOWEVER CAUSED AND ON ANY THEORY OF
+ * LIABILITY, WHETHER IN CONTRACT, STRICT LIABILITY, OR TORT (INCLUDING
+ * NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE OF THIS
+ * SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+ */
+
+package dtp_test
+
+import "bytes"
+import "testing"
+
+import "github.com/adigal150/go.pkt/layers"
+import "github.com/adigal150/go.pkt/packet"
+import "github.com/adigal150/go.pkt/packet/dtp"
+
+var test_frame = []byte{
+    0x01, 0x00, 0x0c, 0xcc, 0xcc, 0xcc, 0x00, 0x1a, 0x2b, 0x3c, 0x4d, 0x5e,
+    0x00, 0x26, 0xaa, 0xaa, 0x03, 0x00, 0x00, 0x0c, 0x20, 0x04, 0x01, 0x00,
+    0x01, 0x00, 0x09, 0x63, 0x6f, 0x72, 0x70, 0x00, 0x00, 0x02, 0x00, 0x05,
+    0x83, 0x00, 0x03, 0x00, 0x05, 0xa5, 0x00, 0x04, 0x00, 0x0a, 0x00, 0x1a,
+    0x2b, 0x3c, 0x4d, 0x5e,
+}
+
+var test_simple = test_frame[22:]
+
+var hwsrc_str = "00:1a:2b:3c:4d:5e"
+
+func TestUnpackFrame(t *testing.T) {
+    pkt, err := layers.UnpackAll(test_frame, packet.Eth)
+    if err != nil {
+        t.Fatalf("Error unpacking: %s", err)
+    }
+
+    p, ok := layers.FindLayer(pkt, packet.DTP).(*dtp.Packet)
+    if !ok {
+        t.Fatalf("DTP layer not found: %s", pkt)
+    }
+
+    if p.Version != 1 || p.Domain != "corp" ||
+       p.Neighbor.String() != hwsrc_str || len(p.Options) != 0 {
+        t.Fatalf("Packet mismatch: %s", p)
+    }
+
+    if !p.Status.Trunking() || p.Status.Mode() != dtp.Desirable ||
+       p.Status.String() != "trunk/desirable" {
+        t.Fatalf("Status mismatch: %s", p.Status)
+    }
+
+    if p.TrunkType.String() != "802.1q" {
+        t.Fatalf("Trunk type mismatch: %s", p.TrunkType)
+    }
+}
+
+func TestPack(t *testing.T) {
+    var p dtp.Packet
+
+    var b packet.Buffer
+    b.Init(test_simple)
+
+    err := p.Unpack(&b)
+    if err != nil {
+        t.Fatalf("Error unpacking: %s", err)
+    }
+
+    if p.GetLength() != uint16(len(test_simple)) {
+        t.Fatalf("Length mismatch: %d", p.GetLength())
+    }
+
+    b.Init(make([]byte, len(test_simple)))
+
+    err = p.Pack(&b)
+    if err != nil {
+        t.Fatalf("Error packing: %s", err)
+    }
+
+    if !bytes.Equal(test_simple, b.Buffer()) {
+        t.Fatalf("Raw packet mismatch: %x", b.Buffer())
+    }
+}
+
+func TestUnpackInvalid(t *testing.T) {
+    var p dtp.Packet
+
+    var b packet.Buffer
+    b.Init([]byte{ 0x01, 0x00, 0x01, 0x00, 0x20, 0x00 })
+
+    if p.Unpack(&b) == nil {
+        t.Fatalf("Invalid TLV length not detected")
+    }
+}
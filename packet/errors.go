@@ -0,0 +1,67 @@
+/*
+ * Network packet analysis framework.
+ *
+ * Copyright (c) 2014, Alessandro Ghedini
+ * All rights reserved.
+ *
+ * Redistribution and use in source and binary forms, with or without
+ * modification, are permitted provided that the following conditions are
+ * met:
+ *
+ *     * Redistributions of source code must retain the above copyright
+ *       notice, this list of conditions and the following disclaimer.
+ *
+ *     * Redistributions in binary form must reproduce the above copyright
+ *       notice, this list of conditions and the following disclaimer in the
+ *       documentation and/or other materials provided with the distribution.
+ *
+ * THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS
+ * IS" AND ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO,
+ * THE IMPLIED WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR
+ * PURPOSE ARE DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT HOLDER OR
+ * CONTRIBUTORS BE LIABLE FOR ANY DIRECT, INDIRECT, INCIDENTAL, SPECIAL,
+ * EXEMPLARY, OR CONSEQUENTIAL DAMAGES (INCLUDING, BUT NOT LIMITED TO,
+ * PROCUREMENT OF SUBSTITUTE GOODS OR SERVICES; LOSS OF USE, DATA, OR
+ * PROFITS; OR BUSINESS INTERRUPTION) HOWEVER CAUSED AND ON ANY THEORY OF
+ * LIABILITY, WHETHER IN CONTRACT, STRICT LIABILITY, OR TORT (INCLUDING
+ * NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE OF THIS
+ * SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+ */
+
+package packet
+
+import "errors"
+import "fmt"
+
+// Errors returned by the decoders, possibly wrapped with more details about
+// the failure, so that they can be checked with errors.Is().
+var (
+    // The data ends before the end of a header or field.
+    ErrTruncated     = errors.New("Truncated packet")
+
+    // A length field is inconsistent with the data or the protocol.
+    ErrInvalidLength = errors.New("Invalid length")
+
+    // A version or type that can't be decoded.
+    ErrUnsupported   = errors.New("Unsupported packet")
+)
+
+type decode_error struct {
+    err error
+    msg string
+}
+
+// Create an error wrapping one of the sentinel errors, formatted according to
+// the given format specifier. The sentinel error itself doesn't appear in the
+// message.
+func Errorf(err error, format string, args ...interface{}) error {
+    return &decode_error{ err: err, msg: fmt.Sprintf(format, args...) }
+}
+
+func (e *decode_error) Error() string {
+    return e.msg
+}
+
+func (e *decode_error) Unwrap() error {
+    return e.err
+}
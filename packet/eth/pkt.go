@@ -30,19 +30,27 @@
 
 // Provides encoding and decoding for Ethernet (both EthernetII and 802.3)
 // packets.
+//
+// Decoded addresses are slices of the input data, not copies (see the
+// packet.Buffer Next() method).
 package eth
 
+import "encoding/binary"
 import "fmt"
+import "hash/crc32"
 import "net"
 
 import "github.com/adigal150/go.pkt/packet"
 
 type Packet struct {
-    DstAddr     net.HardwareAddr `string:"dst"`
-    SrcAddr     net.HardwareAddr `string:"src"`
+    DstAddr     net.HardwareAddr     `string:"dst"`
+    SrcAddr     net.HardwareAddr     `string:"src"`
     Type        EtherType
-    Length      uint16           `cmp:"skip"`
-    pkt_payload packet.Packet    `cmp:"skip" string:"skip"`
+    Length      uint16               `cmp:"skip"`
+    FCS         []byte               `cmp:"skip" string:"skip"`
+    pkt_payload packet.Packet        `cmp:"skip" string:"skip"`
+    pkt_decode  func() packet.Packet `cmp:"skip" string:"skip"`
+    pkt_raw     []byte               `cmp:"skip" string:"skip"`
 }
 
 type EtherType uint16
@@ -50,10 +58,12 @@ type EtherType uint16
 const (
     None EtherType = 0x0000
     ARP            = 0x0806
+    FCoE           = 0x8906
     IPv4           = 0x0800
     IPv6           = 0x86dd
     LLC            = 0x0001  /* pseudo ethertype */
     LLDP           = 0x088cc
+    MACsec         = 0x88e5
     QinQ           = 0x88a8
     TRILL          = 0x22f3
     VLAN           = 0x8100
@@ -93,8 +103,8 @@ func (p *Packet) GetType() packet.Type {
 }
 
 func (p *Packet) GetLength() uint16 {
-    if p.pkt_payload != nil {
-        return p.pkt_payload.GetLength() + 14
+    if p.Payload() != nil {
+        return p.Payload().GetLength() + 14
     }
 
     return 14
@@ -110,10 +120,12 @@ func (p *Packet) Pack(buf *packet.Buffer) error {
         buf.WriteN(p.Length)
     }
 
-    return nil
+    return buf.Err()
 }
 
 func (p *Packet) Unpack(buf *packet.Buffer) error {
+    p.pkt_raw = buf.Bytes()
+
     p.DstAddr = net.HardwareAddr(buf.Next(6))
     p.SrcAddr = net.HardwareAddr(buf.Next(6))
 
@@ -124,20 +136,38 @@ func (p *Packet) Unpack(buf *packet.Buffer) error {
         p.Type   = LLC
     }
 
-    return nil
+    return buf.Err()
 }
 
 func (p *Packet) Payload() packet.Packet {
+    if p.pkt_decode != nil {
+        p.pkt_payload = p.pkt_decode()
+        p.pkt_decode  = nil
+    }
+
     return p.pkt_payload
 }
 
+func (p *Packet) RawBytes() []byte {
+    return p.pkt_raw
+}
+
+func (p *Packet) HeaderBytes() []byte {
+    return packet.HeaderBytes(p)
+}
+
 func (p *Packet) GuessPayloadType() packet.Type {
     return EtherTypeToType(p.Type)
 }
 
 func (p *Packet) SetPayload(pl packet.Packet) error {
     p.pkt_payload = pl
-    p.Type        = TypeToEtherType(pl.GetType())
+    p.pkt_decode  = nil
+
+    /* keep the 802.1ad EtherType of S-TAGs (see vlan.QinQ()) */
+    if p.Type != QinQ || pl.GetType() != packet.VLAN {
+        p.Type = TypeToEtherType(pl.GetType())
+    }
 
     if p.Type < 0x0600 {
         p.Length = p.GetLength()
@@ -146,24 +176,65 @@ func (p *Packet) SetPayload(pl packet.Packet) error {
     return nil
 }
 
+func (p *Packet) SetPayloadDecoder(decode func() packet.Packet) {
+    p.pkt_payload = nil
+    p.pkt_decode  = decode
+}
+
 func (p *Packet) InitChecksum(csum uint32) {
 }
 
+func (p *Packet) Clone() packet.Packet {
+    c := *p
+
+    c.DstAddr     = packet.CloneBytes(p.DstAddr)
+    c.SrcAddr     = packet.CloneBytes(p.SrcAddr)
+    c.FCS         = packet.CloneBytes(p.FCS)
+    c.pkt_payload = packet.ClonePayload(p.Payload())
+    c.pkt_decode  = nil
+
+    return &c
+}
+
 func (p *Packet) String() string {
     return packet.Stringify(p)
 }
 
+func (p *Packet) Validate() error {
+    if len(p.DstAddr) != 6 || len(p.SrcAddr) != 6 {
+        return fmt.Errorf("Invalid address length: %d/%d",
+                          len(p.DstAddr), len(p.SrcAddr))
+    }
+
+    return nil
+}
+
+// Check whether the FCS stripped from the end of the decoded frame (see the
+// packet.DecodeOptions FCS option) matches the frame data. False is returned
+// if no FCS was stripped.
+func (p *Packet) CheckFCS() bool {
+    if len(p.FCS) != 4 || len(p.pkt_raw) < 4 {
+        return false
+    }
+
+    data := p.pkt_raw[:len(p.pkt_raw) - 4]
+
+    return crc32.ChecksumIEEE(data) == binary.LittleEndian.Uint32(p.FCS)
+}
+
 var ethertype_to_type_map = map[EtherType]packet.Type{
-    None:  packet.None,
-    ARP:   packet.ARP,
-    IPv4:  packet.IPv4,
-    IPv6:  packet.IPv6,
-    LLC:   packet.LLC,
-    LLDP:  packet.LLDP,
-    VLAN:  packet.VLAN,
-    QinQ:  packet.VLAN,
-    TRILL: packet.TRILL,
-    WoL:   packet.WoL,
+    None:   packet.None,
+    ARP:    packet.ARP,
+    FCoE:   packet.FCoE,
+    IPv4:   packet.IPv4,
+    IPv6:   packet.IPv6,
+    LLC:    packet.LLC,
+    LLDP:   packet.LLDP,
+    MACsec: packet.MACsec,
+    VLAN:   packet.VLAN,
+    QinQ:   packet.VLAN,
+    TRILL:  packet.TRILL,
+    WoL:    packet.WoL,
 }
 
 // Create a new Type from the given EtherType.
@@ -195,16 +266,18 @@ func TypeToEtherType(pkttype packet.Type) EtherType {
 
 func (t EtherType) String() string {
     switch t {
-    case ARP:   return "ARP"
-    case IPv4:  return "IPv4"
-    case IPv6:  return "IPv6"
-    case LLC:   return "LLC"
-    case LLDP:  return "LLDP"
-    case None:  return "None"
-    case QinQ:  return "QinQ"
-    case TRILL: return "TRILL"
-    case VLAN:  return "VLAN"
-    case WoL:   return "WoL"
-    default:    return fmt.Sprintf("0x%x", uint16(t))
+    case ARP:    return "ARP"
+    case FCoE:   return "FCoE"
+    case IPv4:   return "IPv4"
+    case IPv6:   return "IPv6"
+    case LLC:    return "LLC"
+    case LLDP:   return "LLDP"
+    case MACsec: return "MACsec"
+    case None:   return "None"
+    case QinQ:   return "QinQ"
+    case TRILL:  return "TRILL"
+    case VLAN:   return "VLAN"
+    case WoL:    return "WoL"
+    default:     return fmt.Sprintf("0x%x", uint16(t))
     }
 }
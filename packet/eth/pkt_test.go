@@ -36,6 +36,7 @@ import "testing"
 
 import "github.com/adigal150/go.pkt/packet"
 import "github.com/adigal150/go.pkt/packet/eth"
+import "github.com/adigal150/go.pkt/packet/raw"
 
 var hwsrc_str = "4c:72:b9:54:e5:3d"
 var hwdst_str = "1f:92:2b:56:ed:77"
@@ -101,6 +102,27 @@ func TestUnpack(t *testing.T) {
     }
 }
 
+func TestUnpackAliasing(t *testing.T) {
+    var p eth.Packet
+
+    data := make([]byte, len(test_simple))
+    copy(data, test_simple)
+
+    var b packet.Buffer
+    b.Init(data)
+
+    err := p.Unpack(&b)
+    if err != nil {
+        t.Fatalf("Error unpacking: %s", err)
+    }
+
+    data[0] = 0xff
+
+    if p.DstAddr[0] != 0xff {
+        t.Fatalf("Address not aliased to the input: %s", p.DstAddr)
+    }
+}
+
 func BenchmarkUnpack(bn *testing.B) {
     var p eth.Packet
     var b packet.Buffer
@@ -110,3 +132,46 @@ func BenchmarkUnpack(bn *testing.B) {
         p.Unpack(&b)
     }
 }
+
+func TestClone(t *testing.T) {
+    p := MakeTestSimple()
+
+    pl := raw.Make()
+    pl.Data = []byte{ 0x01, 0x02, 0x03 }
+    p.SetPayload(pl)
+
+    c := p.Clone().(*eth.Packet)
+
+    if !c.Equals(p) {
+        t.Fatalf("Clone mismatch:\n%s\n%s", c, p)
+    }
+
+    p.DstAddr[0] = 0xff
+
+    if c.DstAddr[0] == 0xff {
+        t.Fatalf("Address shared with the original: %s", c.DstAddr)
+    }
+
+    pl.Data[0] = 0xff
+
+    cpl := c.Payload().(*raw.Packet)
+    if cpl == pl || cpl.Data[0] == 0xff {
+        t.Fatalf("Payload shared with the original: %x", cpl.Data)
+    }
+}
+
+func TestValidate(t *testing.T) {
+    p := MakeTestSimple()
+
+    err := p.Validate()
+    if err != nil {
+        t.Fatalf("Error validating: %s", err)
+    }
+
+    p.SrcAddr = p.SrcAddr[:4]
+
+    err = p.Validate()
+    if err == nil || err.Error() != "Invalid address length: 6/4" {
+        t.Fatalf("Invalid address not detected: %v", err)
+    }
+}
@@ -0,0 +1,273 @@
+/*
+ * Network packet analysis framework.
+ *
+ * Copyright (c) 2014, Alessandro Ghedini
+ * All rights reserved.
+ *
+ * Redistribution and use in source and binary forms, with or without
+ * modification, are permitted provided that the following conditions are
+ * met:
+ *
+ *     * Redistributions of source code must retain the above copyright
+ *       notice, this list of conditions and the following disclaimer.
+ *
+ *     * Redistributions in binary form must reproduce the above copyright
+ *       notice, this list of conditions and the following disclaimer in the
+ *       documentation and/or other materials provided with the distribution.
+ *
+ * THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS
+ * IS" AND ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO,
+ * THE IMPLIED WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR
+ * PURPOSE ARE DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT HOLDER OR
+ * CONTRIBUTORS BE LIABLE FOR ANY DIRECT, INDIRECT, INCIDENTAL, SPECIAL,
+ * EXEMPLARY, OR CONSEQUENTIAL DAMAGES (INCLUDING, BUT NOT LIMITED TO,
+ * PROCUREMENT OF SUBSTITUTE GOODS OR SERVICES; LOSS OF USE, DATA, OR
+ * PROFITS; OR BUSINESS INTERRUPTION) HOWEVER CAUSED AND ON ANY THEORY OF
+ * LIABILITY, WHETHER IN CONTRACT, STRICT LIABILITY, OR TORT (INCLUDING
+ * NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE OF THIS
+ * SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+ */
+
+// Provides encoding and decoding for FCoE (Fibre Channel over Ethernet)
+// packets.
+//
+// The encapsulated Fibre Channel frame header is decoded as part of the FCoE
+// packet, while the FC payload is kept as raw bytes. The FC CRC is neither
+// computed nor verified.
+package fcoe
+
+import "fmt"
+
+import "github.com/adigal150/go.pkt/packet"
+
+type Packet struct {
+    Version     uint8         `string:"ver"`
+    SOF         SOF           `string:"sof"`
+
+    /* Fibre Channel frame header */
+    RCtl        uint8         `string:"r_ctl"`
+    DstId       uint32        `string:"d_id"`
+    CSCtl       uint8         `string:"cs_ctl"`
+    SrcId       uint32        `string:"s_id"`
+    Type        FCType
+    FCtl        uint32        `string:"f_ctl"`
+    SeqId       uint8         `string:"seq_id"`
+    DFCtl       uint8         `string:"df_ctl"`
+    SeqCnt      uint16        `string:"seq_cnt"`
+    OXId        uint16        `string:"ox_id"`
+    RXId        uint16        `string:"rx_id"`
+    Parameter   uint32        `string:"param"`
+
+    Data        []byte        `cmp:"skip" string:"skip"`
+
+    /* trailer */
+    CRC         uint32        `cmp:"skip" string:"crc"`
+    EOF         EOF           `string:"eof"`
+
+    pkt_raw     []byte        `cmp:"skip" string:"skip"`
+}
+
+type SOF uint8
+
+const (
+    SOFf SOF = 0x28
+    SOFi2    = 0x2D
+    SOFn2    = 0x35
+    SOFi3    = 0x2E
+    SOFn3    = 0x36
+    SOFi4    = 0x29
+    SOFn4    = 0x31
+    SOFc4    = 0x39
+)
+
+type EOF uint8
+
+const (
+    EOFn EOF = 0x41
+    EOFt     = 0x42
+    EOFrt    = 0x44
+    EOFdt    = 0x46
+    EOFni    = 0x49
+    EOFdti   = 0x4E
+    EOFrti   = 0x4F
+    EOFa     = 0x50
+)
+
+type FCType uint8
+
+const (
+    BLS FCType = 0x00
+    ELS        = 0x01
+    FCP        = 0x08
+    CT         = 0x20
+)
+
+func Make() *Packet {
+    return &Packet{
+        SOF: SOFi3,
+        EOF: EOFt,
+    }
+}
+
+func (p *Packet) GetType() packet.Type {
+    return packet.FCoE
+}
+
+func (p *Packet) GetLength() uint16 {
+    return uint16(14 + 24 + len(p.Data) + 8)
+}
+
+func (p *Packet) Equals(other packet.Packet) bool {
+    return packet.Compare(p, other)
+}
+
+func (p *Packet) Answers(other packet.Packet) bool {
+    if other == nil || other.GetType() != packet.FCoE {
+        return false
+    }
+
+    return p.OXId == other.(*Packet).OXId &&
+           p.SrcId == other.(*Packet).DstId &&
+           p.DstId == other.(*Packet).SrcId
+}
+
+func (p *Packet) Pack(buf *packet.Buffer) error {
+    buf.WriteN(p.Version << 4)
+    buf.Write(make([]byte, 12))
+    buf.WriteN(p.SOF)
+
+    buf.WriteN(uint32(p.RCtl) << 24 | p.DstId & 0xFFFFFF)
+    buf.WriteN(uint32(p.CSCtl) << 24 | p.SrcId & 0xFFFFFF)
+    buf.WriteN(uint32(p.Type) << 24 | p.FCtl & 0xFFFFFF)
+    buf.WriteN(p.SeqId)
+    buf.WriteN(p.DFCtl)
+    buf.WriteN(p.SeqCnt)
+    buf.WriteN(p.OXId)
+    buf.WriteN(p.RXId)
+    buf.WriteN(p.Parameter)
+
+    buf.Write(p.Data)
+
+    buf.WriteN(p.CRC)
+    buf.WriteN(p.EOF)
+    buf.Write(make([]byte, 3))
+
+    return buf.Err()
+}
+
+func (p *Packet) Unpack(buf *packet.Buffer) error {
+    p.pkt_raw = buf.Bytes()
+
+    if buf.Len() < 14 + 24 + 8 {
+        return packet.Errorf(packet.ErrTruncated, "Invalid FCoE frame")
+    }
+
+    var ver uint8
+    buf.ReadN(&ver)
+    p.Version = ver >> 4
+
+    buf.Next(12)
+    buf.ReadN(&p.SOF)
+
+    var word uint32
+
+    buf.ReadN(&word)
+    p.RCtl  = uint8(word >> 24)
+    p.DstId = word & 0xFFFFFF
+
+    buf.ReadN(&word)
+    p.CSCtl = uint8(word >> 24)
+    p.SrcId = word & 0xFFFFFF
+
+    buf.ReadN(&word)
+    p.Type = FCType(word >> 24)
+    p.FCtl = word & 0xFFFFFF
+
+    buf.ReadN(&p.SeqId)
+    buf.ReadN(&p.DFCtl)
+    buf.ReadN(&p.SeqCnt)
+    buf.ReadN(&p.OXId)
+    buf.ReadN(&p.RXId)
+    buf.ReadN(&p.Parameter)
+
+    p.Data = buf.Next(buf.Len() - 8)
+
+    buf.ReadN(&p.CRC)
+    buf.ReadN(&p.EOF)
+    buf.Next(3)
+
+    return buf.Err()
+}
+
+func (p *Packet) Payload() packet.Packet {
+    return nil
+}
+
+func (p *Packet) RawBytes() []byte {
+    return p.pkt_raw
+}
+
+func (p *Packet) HeaderBytes() []byte {
+    return packet.HeaderBytes(p)
+}
+
+func (p *Packet) GuessPayloadType() packet.Type {
+    return packet.None
+}
+
+func (p *Packet) SetPayload(pl packet.Packet) error {
+    return nil
+}
+
+func (p *Packet) InitChecksum(csum uint32) {
+}
+
+func (p *Packet) Clone() packet.Packet {
+    c := *p
+
+    c.Data = packet.CloneBytes(p.Data)
+
+    return &c
+}
+
+func (p *Packet) String() string {
+    return packet.Stringify(p)
+}
+
+func (s SOF) String() string {
+    switch s {
+    case SOFf:  return "SOFf"
+    case SOFi2: return "SOFi2"
+    case SOFn2: return "SOFn2"
+    case SOFi3: return "SOFi3"
+    case SOFn3: return "SOFn3"
+    case SOFi4: return "SOFi4"
+    case SOFn4: return "SOFn4"
+    case SOFc4: return "SOFc4"
+    default:    return fmt.Sprintf("0x%x", uint8(s))
+    }
+}
+
+func (e EOF) String() string {
+    switch e {
+    case EOFn:   return "EOFn"
+    case EOFt:   return "EOFt"
+    case EOFrt:  return "EOFrt"
+    case EOFdt:  return "EOFdt"
+    case EOFni:  return "EOFni"
+    case EOFdti: return "EOFdti"
+    case EOFrti: return "EOFrti"
+    case EOFa:   return "EOFa"
+    default:     return fmt.Sprintf("0x%x", uint8(e))
+    }
+}
+
+func (t FCType) String() string {
+    switch t {
+    case BLS: return "BLS"
+    case ELS: return "ELS"
+    case FCP: return "FCP"
+    case CT:  return "CT"
+    default:  return fmt.Sprintf("0x%x", uint8(t))
+    }
+}
@@ -0,0 +1,466 @@
+/*
+ * Network packet analysis framework.
+ *
+ * Copyright (c) 2014, Alessandro Ghedini
+ * All rights reserved.
+ *
+ * Redistribution and use in source and binary forms, with or without
+ * modification, are permitted provided that the following conditions are
+ * met:
+ *
+ *     * Redistributions of source code must retain the above copyright
+ *       notice, this list of conditions and the following disclaimer.
+ *
+ *     * Redistributions in binary form must reproduce the above copyright
+ *       notice, this list of conditions and the following disclaimer in the
+ *       documentation and/or other materials provided with the distribution.
+ *
+ * THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS
+ * IS" AND ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO,
+ * THE IMPLIED WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR
+ * PURPOSE ARE DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT HOLDER OR
+ * CONTRIBUTORS BE LIABLE FOR ANY DIRECT, INDIRECT, INCIDENTAL, SPECIAL,
+ * EXEMPLARY, OR CONSEQUENTIAL DAMAGES (INCLUDING, BUT NOT LIMITED TO,
+ * PROCUREMENT OF SUBSTITUTE GOODS OR SERVICES; LOSS OF USE, DATA, OR
+ * PROFITS; OR BUSINESS INTERRUPTION) HOWEVER CAUSED AND ON ANY THEORY OF
+ * LIABILITY, WHETHER IN CONTRACT, STRICT LIABILITY, OR TORT (INCLUDING
+ * NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE OF THIS
+ * SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+ */
+
+// Provides encoding and decoding for GTP-U (GPRS Tunnelling Protocol version 1,
+// user plane) packets.
+//
+// The payload of G-PDU messages is decoded as IPv4 or IPv6, according to its
+// version field. Extension headers are decoded as a list, without interpreting
+// their content. Information elements of signalling messages (e.g. Echo) are
+// decoded as a flat list.
+package gtpu
+
+import "fmt"
+import "strings"
+
+import "github.com/adigal150/go.pkt/packet"
+import "github.com/adigal150/go.pkt/packet/udp"
+
+type Packet struct {
+    Version     uint8
+    Flags       Flags
+    MsgType     MsgType       `string:"type"`
+    Length      uint16        `cmp:"skip" string:"len"`
+    TEID        uint32        `string:"teid"`
+    Seq         uint16
+    NPDU        uint8         `string:"npdu"`
+    ExtHeaders  []ExtHeader   `cmp:"skip" string:"skip"`
+    IEs         []IE          `cmp:"skip" string:"skip"`
+    pkt_payload packet.Packet `cmp:"skip" string:"skip"`
+    pkt_raw     []byte        `cmp:"skip" string:"skip"`
+}
+
+type Flags uint8
+
+const (
+    ExtPresent  Flags = 0x04
+    SeqPresent        = 0x02
+    NPDUPresent       = 0x01
+)
+
+type MsgType uint8
+
+const (
+    EchoRequest         MsgType = 1
+    EchoResponse                = 2
+    ErrorIndication             = 26
+    SupportedExtHeaders         = 31
+    EndMarker                   = 254
+    GPDU                        = 255
+)
+
+// Extension header. The content excludes the length and next type fields, and
+// its length must be a multiple of 4 bytes plus 2.
+type ExtHeader struct {
+    Type uint8
+    Data []byte
+}
+
+// Information element. Only the type and value are stored, since the length is
+// implied by the value (or by the type, for TV elements).
+type IE struct {
+    Type IEType
+    Data []byte
+}
+
+type IEType uint8
+
+const (
+    Recovery        IEType = 14
+    TEIDData                = 16
+    PeerAddress             = 133
+    ExtHeaderList           = 141
+    PrivateExtension        = 255
+)
+
+/* length of the value of the TV information elements (i.e. types below 128) */
+var tv_len = map[IEType]int{
+    Recovery: 1,
+    TEIDData: 4,
+}
+
+func init() {
+    udp.RegisterPort(2152, packet.GTPU)
+}
+
+func Make() *Packet {
+    return &Packet{
+        Version: 1,
+        MsgType: GPDU,
+    }
+}
+
+// Create an Echo Request message with the given sequence number.
+func MakeEchoRequest(seq uint16) *Packet {
+    return &Packet{
+        Version: 1,
+        Flags:   SeqPresent,
+        MsgType: EchoRequest,
+        Seq:     seq,
+    }
+}
+
+// Create the Echo Response message answering the given Echo Request, with the
+// given restart counter in its Recovery IE (which GTP-U peers set to zero).
+func MakeEchoResponse(req *Packet, restart uint8) *Packet {
+    return &Packet{
+        Version: 1,
+        Flags:   SeqPresent,
+        MsgType: EchoResponse,
+        Seq:     req.Seq,
+        IEs:     []IE{ { Type: Recovery, Data: []byte{ restart } } },
+    }
+}
+
+func (p *Packet) GetType() packet.Type {
+    return packet.GTPU
+}
+
+func (p *Packet) GetLength() uint16 {
+    if p.pkt_payload != nil {
+        return p.msg_len() + p.pkt_payload.GetLength()
+    }
+
+    return p.msg_len()
+}
+
+func (p *Packet) Equals(other packet.Packet) bool {
+    return packet.Compare(p, other)
+}
+
+func (p *Packet) Answers(other packet.Packet) bool {
+    if other == nil || other.GetType() != packet.GTPU {
+        return false
+    }
+
+    return p.MsgType == EchoResponse &&
+           other.(*Packet).MsgType == EchoRequest &&
+           p.Seq == other.(*Packet).Seq
+}
+
+func (p *Packet) Pack(buf *packet.Buffer) error {
+    var length uint16
+
+    if p.pkt_payload != nil {
+        length = p.pkt_payload.GetLength()
+    }
+
+    buf.WriteN(p.Version << 5 | 0x10 | uint8(p.Flags & 0x07))
+    buf.WriteN(p.MsgType)
+    buf.WriteN(p.msg_len() - 8 + length)
+    buf.WriteN(p.TEID)
+
+    if p.Flags & (ExtPresent | SeqPresent | NPDUPresent) != 0 {
+        buf.WriteN(p.Seq)
+        buf.WriteN(p.NPDU)
+
+        for _, ext := range p.ExtHeaders {
+            if (len(ext.Data) + 2) % 4 != 0 || len(ext.Data) > 0x3FE {
+                return fmt.Errorf("Invalid extension header length: %d",
+                                  len(ext.Data))
+            }
+
+            buf.WriteN(ext.Type)
+            buf.WriteN(uint8((len(ext.Data) + 2) / 4))
+            buf.Write(ext.Data)
+        }
+
+        buf.WriteN(uint8(0x00))
+    }
+
+    for _, ie := range p.IEs {
+        buf.WriteN(ie.Type)
+
+        if ie.Type < 128 {
+            if len(ie.Data) != tv_len[ie.Type] {
+                return fmt.Errorf("Invalid IE length: %d", len(ie.Data))
+            }
+        } else {
+            if len(ie.Data) > 0xFFFF {
+                return fmt.Errorf("Invalid IE length: %d", len(ie.Data))
+            }
+
+            buf.WriteN(uint16(len(ie.Data)))
+        }
+
+        buf.Write(ie.Data)
+    }
+
+    return buf.Err()
+}
+
+func (p *Packet) Unpack(buf *packet.Buffer) error {
+    p.pkt_raw = buf.Bytes()
+
+    if buf.Len() < 8 {
+        return packet.Errorf(packet.ErrTruncated, "Invalid GTP-U header")
+    }
+
+    var flags uint8
+    buf.ReadN(&flags)
+
+    p.Version = flags >> 5
+    p.Flags   = Flags(flags & 0x07)
+
+    if p.Version != 1 || flags & 0x10 == 0 {
+        return packet.Errorf(packet.ErrUnsupported,
+                             "Unsupported GTP version: %d", p.Version)
+    }
+
+    buf.ReadN(&p.MsgType)
+    buf.ReadN(&p.Length)
+    buf.ReadN(&p.TEID)
+
+    if int(p.Length) > buf.Len() {
+        return packet.Errorf(packet.ErrTruncated,
+                             "Truncated GTP-U message: %d", p.Length)
+    }
+
+    p.ExtHeaders = nil
+    p.IEs        = nil
+
+    if p.Flags & (ExtPresent | SeqPresent | NPDUPresent) != 0 {
+        if p.Length < 4 {
+            return packet.Errorf(packet.ErrTruncated, "Invalid GTP-U header")
+        }
+
+        var next uint8
+
+        buf.ReadN(&p.Seq)
+        buf.ReadN(&p.NPDU)
+        buf.ReadN(&next)
+
+        for next != 0 {
+            var units uint8
+            buf.ReadN(&units)
+
+            l := int(units) * 4
+
+            if l == 0 || buf.LayerLen() - 9 + l > int(p.Length) {
+                return packet.Errorf(packet.ErrTruncated,
+                                     "Truncated extension header")
+            }
+
+            p.ExtHeaders = append(p.ExtHeaders, ExtHeader{
+                Type: next,
+                Data: buf.Next(l - 2),
+            })
+
+            buf.ReadN(&next)
+        }
+    }
+
+    /* the payload of G-PDUs is decoded from the rest of the message */
+    if p.MsgType == GPDU {
+        return buf.Err()
+    }
+
+    var err error
+
+    p.IEs, err = unpack_ies(buf.Next(int(p.Length) - (buf.LayerLen() - 8)))
+    if err != nil {
+        return err
+    }
+
+    return buf.Err()
+}
+
+func (p *Packet) Payload() packet.Packet {
+    return p.pkt_payload
+}
+
+func (p *Packet) RawBytes() []byte {
+    return p.pkt_raw
+}
+
+func (p *Packet) HeaderBytes() []byte {
+    return packet.HeaderBytes(p)
+}
+
+func (p *Packet) GuessPayloadType() packet.Type {
+    if p.MsgType != GPDU {
+        return packet.None
+    }
+
+    hdr_len := int(p.msg_len())
+    if len(p.pkt_raw) <= hdr_len {
+        return packet.None
+    }
+
+    switch p.pkt_raw[hdr_len] >> 4 {
+    case 4:  return packet.IPv4
+    case 6:  return packet.IPv6
+    default: return packet.Raw
+    }
+}
+
+func (p *Packet) SetPayload(pl packet.Packet) error {
+    p.pkt_payload = pl
+
+    return nil
+}
+
+func (p *Packet) InitChecksum(csum uint32) {
+}
+
+func (p *Packet) Clone() packet.Packet {
+    c := *p
+
+    c.pkt_payload = packet.ClonePayload(p.pkt_payload)
+
+    if p.ExtHeaders != nil {
+        c.ExtHeaders = make([]ExtHeader, len(p.ExtHeaders))
+
+        for i, ext := range p.ExtHeaders {
+            ext.Data = packet.CloneBytes(ext.Data)
+
+            c.ExtHeaders[i] = ext
+        }
+    }
+
+    if p.IEs != nil {
+        c.IEs = make([]IE, len(p.IEs))
+
+        for i, ie := range p.IEs {
+            ie.Data = packet.CloneBytes(ie.Data)
+
+            c.IEs[i] = ie
+        }
+    }
+
+    return &c
+}
+
+func (p *Packet) String() string {
+    return packet.Stringify(p)
+}
+
+// Return the first IE with the given type, or nil.
+func (p *Packet) IE(t IEType) *IE {
+    for i := range p.IEs {
+        if p.IEs[i].Type == t {
+            return &p.IEs[i]
+        }
+    }
+
+    return nil
+}
+
+/* length of the message, excluding the payload of G-PDUs */
+func (p *Packet) msg_len() uint16 {
+    length := uint16(8)
+
+    if p.Flags & (ExtPresent | SeqPresent | NPDUPresent) != 0 {
+        length += 4
+
+        for _, ext := range p.ExtHeaders {
+            length += 2 + uint16(len(ext.Data))
+        }
+    }
+
+    for _, ie := range p.IEs {
+        length += 1 + uint16(len(ie.Data))
+
+        if ie.Type >= 128 {
+            length += 2
+        }
+    }
+
+    return length
+}
+
+func unpack_ies(data []byte) ([]IE, error) {
+    var ies []IE
+
+    for len(data) > 0 {
+        t := IEType(data[0])
+        data = data[1:]
+
+        var l int
+
+        if t < 128 {
+            var ok bool
+
+            l, ok = tv_len[t]
+            if !ok {
+                return ies, packet.Errorf(packet.ErrUnsupported,
+                                          "Unsupported IE type: %d", t)
+            }
+        } else {
+            if len(data) < 2 {
+                return ies, packet.Errorf(packet.ErrTruncated,
+                                          "Truncated IE header")
+            }
+
+            l    = int(data[0]) << 8 | int(data[1])
+            data = data[2:]
+        }
+
+        if l > len(data) {
+            return ies, packet.Errorf(packet.ErrTruncated,
+                                      "Truncated IE value: %d", l)
+        }
+
+        ies  = append(ies, IE{ Type: t, Data: data[:l] })
+        data = data[l:]
+    }
+
+    return ies, nil
+}
+
+func (f Flags) String() string {
+    var flags []string
+
+    if f & ExtPresent != 0 {
+        flags = append(flags, "e")
+    }
+
+    if f & SeqPresent != 0 {
+        flags = append(flags, "s")
+    }
+
+    if f & NPDUPresent != 0 {
+        flags = append(flags, "pn")
+    }
+
+    return strings.Join(flags, "|")
+}
+
+func (t MsgType) String() string {
+    switch t {
+    case EchoRequest:         return "echo-request"
+    case EchoResponse:        return "echo-response"
+    case ErrorIndication:     return "error-indication"
+    case SupportedExtHeaders: return "supported-ext-headers"
+    case EndMarker:           return "end-marker"
+    case GPDU:                return "g-pdu"
+    default:                  return "unknown"
+    }
+}
@@ -0,0 +1,199 @@
+/*
+ * Network packet analysis framework.
+ *
+ * Copyright (c) 2014, Alessandro Ghedini
+ * All rights reserved.
+ *
+ * Redistribution and use in source and binary forms, with or without
+ * modification, are permitted provided that the following conditions are
+ * met:
+ *
+ *     * Redistributions of source code must retain the above copyright
+ *       notice, this list of conditions and the following disclaimer.
+ *
+ *     * Redistributions in binary form must reproduce the above copyright
+ *       notice, this list of conditions and the following disclaimer in the
+ *       documentation and/or other materials provided with the distribution.
+ *
+ * THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS
+ * IS" AND ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO,
+ * THE IMPLIED WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR
+ * PURPOSE ARE DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT HOLDER OR
+ * CONTRIBUTORS BE LIABLE FOR ANY DIRECT, INDIRECT, INCIDENTAL, SPECIAL,
+ * EXEMPLARY, OR CONSEQUENTIAL DAMAGES (INCLUDING, BUT NOT LIMITED TO,
+ * PROCUREMENT OF SUBSTITUTE GOODS OR SERVICES; LOSS OF USE, DATA, OR
+ * PROFITS; OR BUSINESS INTERRUPTION) HOWEVER CAUSED AND ON ANY THEORY OF
+ * LIABILITY, WHETHER IN CONTRACT, STRICT LIABILITY, OR TORT (INCLUDING
+ * NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE OF THIS
+ * SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+ */
+
+package gtpu_test
+
+import "bytes"
+import "net"
+import "testing"
+
+import "github.com/adigal150/go.pkt/layers"
+import "github.com/adigal150/go.pkt/packet"
+import "github.com/adigal150/go.pkt/packet/gtpu"
+import "github.com/adigal150/go.pkt/packet/ipv4"
+import "github.com/adigal150/go.pkt/packet/raw"
+import "github.com/adigal150/go.pkt/packet/udp"
+
+/* Echo Response with sequence number 0x1234 and Recovery IE */
+var test_simple = []byte{
+    0x32, 0x02, 0x00, 0x06, 0x00, 0x00, 0x00, 0x00, 0x12, 0x34, 0x00, 0x00,
+    0x0e, 0x00,
+}
+
+func MakeTestSimple() *gtpu.Packet {
+    return &gtpu.Packet{
+        Version: 1,
+        Flags:   gtpu.SeqPresent,
+        MsgType: gtpu.EchoResponse,
+        Seq:     0x1234,
+        IEs:     []gtpu.IE{ { Type: gtpu.Recovery, Data: []byte{ 0x00 } } },
+    }
+}
+
+func TestPack(t *testing.T) {
+    var b packet.Buffer
+    b.Init(make([]byte, len(test_simple)))
+
+    p := MakeTestSimple()
+
+    err := p.Pack(&b)
+    if err != nil {
+        t.Fatalf("Error packing: %s", err)
+    }
+
+    if !bytes.Equal(test_simple, b.Buffer()) {
+        t.Fatalf("Raw packet mismatch: %x", b.Buffer())
+    }
+}
+
+func BenchmarkPack(bn *testing.B) {
+    var b packet.Buffer
+    b.Init(make([]byte, len(test_simple)))
+
+    p := MakeTestSimple()
+
+    for n := 0; n < bn.N; n++ {
+        p.Pack(&b)
+    }
+}
+
+func TestUnpack(t *testing.T) {
+    var p gtpu.Packet
+
+    cmp := MakeTestSimple()
+
+    var b packet.Buffer
+    b.Init(test_simple)
+
+    err := p.Unpack(&b)
+    if err != nil {
+        t.Fatalf("Error unpacking: %s", err)
+    }
+
+    if !p.Equals(cmp) {
+        t.Fatalf("Packet mismatch:\n%s\n%s", &p, cmp)
+    }
+
+    ie := p.IE(gtpu.Recovery)
+    if ie == nil || !bytes.Equal(ie.Data, []byte{ 0x00 }) {
+        t.Fatalf("Recovery IE mismatch: %v", p.IEs)
+    }
+}
+
+func BenchmarkUnpack(bn *testing.B) {
+    var p gtpu.Packet
+    var b packet.Buffer
+
+    for n := 0; n < bn.N; n++ {
+        b.Init(test_simple)
+        p.Unpack(&b)
+    }
+}
+
+func TestEchoAnswers(t *testing.T) {
+    req := gtpu.MakeEchoRequest(0x1234)
+    rsp := gtpu.MakeEchoResponse(req, 0)
+
+    buf, err := layers.Pack(rsp)
+    if err != nil {
+        t.Fatalf("Error packing: %s", err)
+    }
+
+    if !bytes.Equal(buf, test_simple) {
+        t.Fatalf("Raw packet mismatch: %x", buf)
+    }
+
+    if !rsp.Answers(req) {
+        t.Fatalf("Response doesn't answer request")
+    }
+
+    if req.Answers(rsp) {
+        t.Fatalf("Request answers response")
+    }
+
+    if rsp.Answers(gtpu.MakeEchoRequest(0x1235)) {
+        t.Fatalf("Response answers request with different sequence")
+    }
+}
+
+func TestUnpackAllGPDU(t *testing.T) {
+    outer_ip := ipv4.Make()
+    outer_ip.SrcAddr = net.ParseIP("10.0.0.1")
+    outer_ip.DstAddr = net.ParseIP("10.0.0.2")
+
+    outer_udp := udp.Make()
+    outer_udp.SrcPort = 2152
+    outer_udp.DstPort = 2152
+
+    gtp_pkt := gtpu.Make()
+    gtp_pkt.TEID  = 0x0badcafe
+    gtp_pkt.Flags = gtpu.ExtPresent
+    gtp_pkt.ExtHeaders = []gtpu.ExtHeader{
+        { Type: 0x85, Data: []byte{ 0x00, 0x09 } },
+    }
+
+    inner_ip := ipv4.Make()
+    inner_ip.SrcAddr = net.ParseIP("192.168.1.10")
+    inner_ip.DstAddr = net.ParseIP("198.51.100.7")
+
+    inner_udp := udp.Make()
+    inner_udp.SrcPort = 41562
+    inner_udp.DstPort = 8338
+
+    raw_pkt := raw.Make()
+    raw_pkt.Data = []byte("query")
+
+    buf, err := layers.Pack(outer_ip, outer_udp, gtp_pkt, inner_ip, inner_udp,
+                            raw_pkt)
+    if err != nil {
+        t.Fatalf("Error packing: %s", err)
+    }
+
+    pkt, err := layers.UnpackAll(buf, packet.IPv4)
+    if err != nil {
+        t.Fatalf("Error unpacking: %s", err)
+    }
+
+    gtp_dec, ok := layers.FindLayer(pkt, packet.GTPU).(*gtpu.Packet)
+    if !ok || gtp_dec.TEID != 0x0badcafe || len(gtp_dec.ExtHeaders) != 1 ||
+       gtp_dec.ExtHeaders[0].Type != 0x85 {
+        t.Fatalf("GTP-U packet mismatch: %s", pkt)
+    }
+
+    ip_dec, ok := gtp_dec.Payload().(*ipv4.Packet)
+    if !ok || !ip_dec.DstAddr.Equal(inner_ip.DstAddr) {
+        t.Fatalf("Inner packet mismatch: %s", pkt)
+    }
+
+    raw_dec, ok := layers.FindLayer(ip_dec, packet.Raw).(*raw.Packet)
+    if !ok || string(raw_dec.Data) != "query" {
+        t.Fatalf("Inner payload mismatch: %s", pkt)
+    }
+}
@@ -0,0 +1,411 @@
+/*
+ * Network packet analysis framework.
+ *
+ * Copyright (c) 2014, Alessandro Ghedini
+ * All rights reserved.
+ *
+ * Redistribution and use in source and binary forms, with or without
+ * modification, are permitted provided that the following conditions are
+ * met:
+ *
+ *     * Redistributions of source code must retain the above copyright
+ *       notice, this list of conditions and the following disclaimer.
+ *
+ *     * Redistributions in binary form must reproduce the above copyright
+ *       notice, this list of conditions and the following disclaimer in the
+ *       documentation and/or other materials provided with the distribution.
+ *
+ * THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS
+ * IS" AND ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO,
+ * THE IMPLIED WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR
+ * PURPOSE ARE DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT HOLDER OR
+ * CONTRIBUTORS BE LIABLE FOR ANY DIRECT, INDIRECT, INCIDENTAL, SPECIAL,
+ * EXEMPLARY, OR CONSEQUENTIAL DAMAGES (INCLUDING, BUT NOT LIMITED TO,
+ * PROCUREMENT OF SUBSTITUTE GOODS OR SERVICES; LOSS OF USE, DATA, OR
+ * PROFITS; OR BUSINESS INTERRUPTION) HOWEVER CAUSED AND ON ANY THEORY OF
+ * LIABILITY, WHETHER IN CONTRACT, STRICT LIABILITY, OR TORT (INCLUDING
+ * NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE OF THIS
+ * SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+ */
+// Provides encoding and decoding for GTPv2-C (GPRS Tunnelling Protocol version
+// 2, control plane) packets.
+//
+// Information elements are decoded as a flat list, grouped IEs (e.g. Bearer
+// Context) can be further decoded with IE.IEs(). A piggybacked message is
+// decoded as the payload of the message carrying it.
+package gtpv2
+
+import "fmt"
+import "strings"
+
+import "github.com/adigal150/go.pkt/packet"
+import "github.com/adigal150/go.pkt/packet/udp"
+
+type Packet struct {
+    Version     uint8
+    Flags       Flags
+    MsgType     MsgType       `string:"type"`
+    Length      uint16        `cmp:"skip" string:"len"`
+    TEID        uint32        `string:"teid"`
+    Seq         uint32
+    Priority    uint8         `string:"prio"`
+    IEs         []IE          `cmp:"skip" string:"skip"`
+    pkt_payload packet.Packet `cmp:"skip" string:"skip"`
+    pkt_raw     []byte        `cmp:"skip" string:"skip"`
+}
+
+type Flags uint8
+
+const (
+    Piggyback   Flags = 0x10
+    TEIDPresent       = 0x08
+    MsgPriority       = 0x04
+)
+
+type MsgType uint8
+
+const (
+    EchoRequest              MsgType = 1
+    EchoResponse                     = 2
+    VersionNotSupported              = 3
+    CreateSessionRequest             = 32
+    CreateSessionResponse            = 33
+    ModifyBearerRequest              = 34
+    ModifyBearerResponse             = 35
+    DeleteSessionRequest             = 36
+    DeleteSessionResponse            = 37
+    CreateBearerRequest              = 95
+    CreateBearerResponse             = 96
+    UpdateBearerRequest              = 97
+    UpdateBearerResponse             = 98
+    DeleteBearerRequest              = 99
+    DeleteBearerResponse             = 100
+    ReleaseAccessBearersRequest      = 170
+    ReleaseAccessBearersResponse     = 171
+    DownlinkDataNotification         = 176
+    DownlinkDataNotificationAck      = 177
+)
+
+// Information element. Only the type, instance and value are stored, since the
+// length is implied by the value.
+type IE struct {
+    Type     IEType
+    Instance uint8
+    Data     []byte
+}
+
+type IEType uint8
+
+const (
+    IMSI           IEType = 1
+    Cause                 = 2
+    Recovery              = 3
+    APN                   = 71
+    AMBR                  = 72
+    EBI                   = 73
+    IPAddress             = 74
+    MEI                   = 75
+    MSISDN                = 76
+    Indication            = 77
+    PCO                   = 78
+    PAA                   = 79
+    BearerQoS             = 80
+    RATType               = 82
+    ServingNetwork        = 83
+    BearerTFT             = 84
+    ULI                   = 86
+    FTEID                 = 87
+    BearerContext         = 93
+    ChargingID            = 94
+    PDNType               = 99
+    APNRestriction        = 127
+    SelectionMode         = 128
+)
+
+func init() {
+    udp.RegisterPort(2123, packet.GTPv2)
+}
+
+func Make() *Packet {
+    return &Packet{
+        Version: 2,
+        Flags:   TEIDPresent,
+    }
+}
+
+func (p *Packet) GetType() packet.Type {
+    return packet.GTPv2
+}
+
+func (p *Packet) GetLength() uint16 {
+    if p.pkt_payload != nil {
+        return p.msg_len() + p.pkt_payload.GetLength()
+    }
+
+    return p.msg_len()
+}
+
+func (p *Packet) Equals(other packet.Packet) bool {
+    return packet.Compare(p, other)
+}
+
+func (p *Packet) Answers(other packet.Packet) bool {
+    if other == nil || other.GetType() != packet.GTPv2 {
+        return false
+    }
+
+    /* responses have the type following the one of their request */
+    return p.MsgType == other.(*Packet).MsgType + 1 &&
+           p.Seq == other.(*Packet).Seq
+}
+
+func (p *Packet) Pack(buf *packet.Buffer) error {
+    buf.WriteN(p.Version << 5 | uint8(p.Flags & 0x1C))
+    buf.WriteN(p.MsgType)
+    buf.WriteN(p.msg_len() - 4)
+
+    if p.Flags & TEIDPresent != 0 {
+        buf.WriteN(p.TEID)
+    }
+
+    var prio uint8
+
+    if p.Flags & MsgPriority != 0 {
+        prio = p.Priority << 4
+    }
+
+    buf.WriteN(p.Seq << 8 | uint32(prio))
+
+    for _, ie := range p.IEs {
+        if len(ie.Data) > 0xFFFF {
+            return fmt.Errorf("Invalid IE length: %d", len(ie.Data))
+        }
+
+        buf.WriteN(ie.Type)
+        buf.WriteN(uint16(len(ie.Data)))
+        buf.WriteN(ie.Instance & 0x0F)
+        buf.Write(ie.Data)
+    }
+
+    return buf.Err()
+}
+
+func (p *Packet) Unpack(buf *packet.Buffer) error {
+    p.pkt_raw = buf.Bytes()
+
+    if buf.Len() < 8 {
+        return packet.Errorf(packet.ErrTruncated, "Invalid GTPv2 header")
+    }
+
+    var flags uint8
+    buf.ReadN(&flags)
+
+    p.Version = flags >> 5
+    p.Flags   = Flags(flags & 0x1C)
+
+    if p.Version != 2 {
+        return packet.Errorf(packet.ErrUnsupported,
+                             "Unsupported GTP version: %d", p.Version)
+    }
+
+    buf.ReadN(&p.MsgType)
+    buf.ReadN(&p.Length)
+
+    if int(p.Length) > buf.Len() {
+        return packet.Errorf(packet.ErrTruncated,
+                             "Truncated GTPv2 message: %d", p.Length)
+    }
+
+    msg := buf.Next(int(p.Length))
+
+    hdr_len := 4
+    if p.Flags & TEIDPresent != 0 {
+        hdr_len += 4
+    }
+
+    if len(msg) < hdr_len {
+        return packet.Errorf(packet.ErrTruncated, "Invalid GTPv2 header")
+    }
+
+    if p.Flags & TEIDPresent != 0 {
+        p.TEID = uint32(msg[0]) << 24 | uint32(msg[1]) << 16 |
+                 uint32(msg[2]) << 8 | uint32(msg[3])
+        msg = msg[4:]
+    }
+
+    p.Seq = uint32(msg[0]) << 16 | uint32(msg[1]) << 8 | uint32(msg[2])
+
+    if p.Flags & MsgPriority != 0 {
+        p.Priority = msg[3] >> 4
+    }
+
+    var err error
+
+    p.IEs, err = unpack_ies(msg[4:])
+    if err != nil {
+        return err
+    }
+
+    return buf.Err()
+}
+
+func (p *Packet) Payload() packet.Packet {
+    return p.pkt_payload
+}
+
+func (p *Packet) RawBytes() []byte {
+    return p.pkt_raw
+}
+
+func (p *Packet) HeaderBytes() []byte {
+    return packet.HeaderBytes(p)
+}
+
+func (p *Packet) GuessPayloadType() packet.Type {
+    if p.Flags & Piggyback != 0 {
+        return packet.GTPv2
+    }
+
+    return packet.None
+}
+
+func (p *Packet) SetPayload(pl packet.Packet) error {
+    p.pkt_payload = pl
+
+    if pl != nil && pl.GetType() == packet.GTPv2 {
+        p.Flags |= Piggyback
+    }
+
+    return nil
+}
+
+func (p *Packet) InitChecksum(csum uint32) {
+}
+
+func (p *Packet) Clone() packet.Packet {
+    c := *p
+
+    c.pkt_payload = packet.ClonePayload(p.pkt_payload)
+
+    if p.IEs != nil {
+        c.IEs = make([]IE, len(p.IEs))
+
+        for i, ie := range p.IEs {
+            ie.Data = packet.CloneBytes(ie.Data)
+
+            c.IEs[i] = ie
+        }
+    }
+
+    return &c
+}
+
+func (p *Packet) String() string {
+    return packet.Stringify(p)
+}
+
+// Return the first IE with the given type and instance, or nil.
+func (p *Packet) IE(t IEType, instance uint8) *IE {
+    return find_ie(p.IEs, t, instance)
+}
+
+// Decode the value of a grouped IE (e.g. Bearer Context) as a list of IEs.
+func (ie *IE) IEs() ([]IE, error) {
+    return unpack_ies(ie.Data)
+}
+
+/* length of the message, excluding any piggybacked message */
+func (p *Packet) msg_len() uint16 {
+    length := uint16(8)
+
+    if p.Flags & TEIDPresent != 0 {
+        length += 4
+    }
+
+    for _, ie := range p.IEs {
+        length += 4 + uint16(len(ie.Data))
+    }
+
+    return length
+}
+
+func find_ie(ies []IE, t IEType, instance uint8) *IE {
+    for i := range ies {
+        if ies[i].Type == t && ies[i].Instance == instance {
+            return &ies[i]
+        }
+    }
+
+    return nil
+}
+
+func unpack_ies(data []byte) ([]IE, error) {
+    var ies []IE
+
+    for len(data) > 0 {
+        if len(data) < 4 {
+            return ies, packet.Errorf(packet.ErrTruncated,
+                                      "Truncated IE header")
+        }
+
+        l := int(data[1]) << 8 | int(data[2])
+
+        if 4 + l > len(data) {
+            return ies, packet.Errorf(packet.ErrTruncated,
+                                      "Truncated IE value: %d", l)
+        }
+
+        ies = append(ies, IE{
+            Type:     IEType(data[0]),
+            Instance: data[3] & 0x0F,
+            Data:     data[4:4 + l],
+        })
+
+        data = data[4 + l:]
+    }
+
+    return ies, nil
+}
+
+func (f Flags) String() string {
+    var flags []string
+
+    if f & Piggyback != 0 {
+        flags = append(flags, "p")
+    }
+
+    if f & TEIDPresent != 0 {
+        flags = append(flags, "t")
+    }
+
+    if f & MsgPriority != 0 {
+        flags = append(flags, "mp")
+    }
+
+    return strings.Join(flags, "|")
+}
+
+func (t MsgType) String() string {
+    switch t {
+    case EchoRequest:                  return "echo-request"
+    case EchoResponse:                 return "echo-response"
+    case VersionNotSupported:          return "version-not-supported"
+    case CreateSessionRequest:         return "create-session-request"
+    case CreateSessionResponse:        return "create-session-response"
+    case ModifyBearerRequest:          return "modify-bearer-request"
+    case ModifyBearerResponse:         return "modify-bearer-response"
+    case DeleteSessionRequest:         return "delete-session-request"
+    case DeleteSessionResponse:        return "delete-session-response"
+    case CreateBearerRequest:          return "create-bearer-request"
+    case CreateBearerResponse:         return "create-bearer-response"
+    case UpdateBearerRequest:          return "update-bearer-request"
+    case UpdateBearerResponse:         return "update-bearer-response"
+    case DeleteBearerRequest:          return "delete-bearer-request"
+    case DeleteBearerResponse:         return "delete-bearer-response"
+    case ReleaseAccessBearersRequest:  return "release-access-bearers-request"
+    case ReleaseAccessBearersResponse: return "release-access-bearers-response"
+    case DownlinkDataNotification:     return "downlink-data-notification"
+    case DownlinkDataNotificationAck:  return "downlink-data-notification-ack"
+    default:                           return "unknown"
+    }
+}
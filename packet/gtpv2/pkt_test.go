@@ -0,0 +1,188 @@
+/*
+ * Network packet analysis framework.
+ *
+ * Copyright (c) 2014, Alessandro Ghedini
+ * All rights reserved.
+ *
+ * Redistribution and use in source and binary forms, with or without
+ * modification, are permitted provided that the following conditions are
+ * met:
+ *
+ *     * Redistributions of source code must retain the above copyright
+ *       notice, this list of conditions and the following disclaimer.
+ *
+ *     * Redistributions in binary form must reproduce the above copyright
+ *       notice, this list of conditions and the following disclaimer in the
+ *       documentation and/or other materials provided with the distribution.
+ *
+ * THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS
+ * IS" AND ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO,
+ * THE IMPLIED WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR
+ * PURPOSE ARE DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT HOLDER OR
+ * CONTRIBUTORS BE LIABLE FOR ANY DIRECT, INDIRECT, INCIDENTAL, SPECIAL,
+ * EXEMPLARY, OR CONSEQUENTIAL DAMAGES (INCLUDING, BUT NOT LIMITED TO,
+ * PROCUREMENT OF SUBSTITUTE GOODS OR SERVICES; LOSS OF USE, DATA, OR
+ * PROFITS; OR BUSINESS INTERRUPTION) HOWEVER CAUSED AND ON ANY THEORY OF
+ * LIABILITY, WHETHER IN CONTRACT, STRICT LIABILITY, OR TORT (INCLUDING
+ * NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE OF THIS
+ * SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+ */
+package gtpv2_test
+
+import "bytes"
+import "testing"
+
+import "github.com/adigal150/go.pkt/layers"
+import "github.com/adigal150/go.pkt/packet"
+import "github.com/adigal150/go.pkt/packet/gtpv2"
+
+/* Create Session Request with IMSI, RAT Type, sender F-TEID, APN and a Bearer
+ * Context grouping an EBI */
+var test_simple = []byte{
+    0x48, 0x20, 0x00, 0x3c, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x01, 0x00,
+    0x01, 0x00, 0x08, 0x00, 0x21, 0x43, 0x65, 0x87, 0x09, 0x21, 0x43, 0xf5,
+    0x52, 0x00, 0x01, 0x00, 0x06, 0x57, 0x00, 0x09, 0x00, 0x8a, 0x00, 0x00,
+    0x00, 0x01, 0xc0, 0xa8, 0x00, 0x01, 0x47, 0x00, 0x09, 0x00, 0x08, 0x69,
+    0x6e, 0x74, 0x65, 0x72, 0x6e, 0x65, 0x74, 0x5d, 0x00, 0x05, 0x00, 0x49,
+    0x00, 0x01, 0x00, 0x05,
+}
+
+func MakeTestSimple() *gtpv2.Packet {
+    return &gtpv2.Packet{
+        Version: 2,
+        Flags:   gtpv2.TEIDPresent,
+        MsgType: gtpv2.CreateSessionRequest,
+        Seq:     1,
+        IEs: []gtpv2.IE{
+            {
+                Type: gtpv2.IMSI,
+                Data: []byte{ 0x21, 0x43, 0x65, 0x87, 0x09, 0x21, 0x43, 0xf5 },
+            },
+            {
+                Type: gtpv2.RATType,
+                Data: []byte{ 0x06 },
+            },
+            {
+                Type: gtpv2.FTEID,
+                Data: []byte{ 0x8a, 0x00, 0x00, 0x00, 0x01, 0xc0, 0xa8, 0x00,
+                              0x01 },
+            },
+            {
+                Type: gtpv2.APN,
+                Data: append([]byte{ 0x08 }, "internet"...),
+            },
+            {
+                Type: gtpv2.BearerContext,
+                Data: []byte{ 0x49, 0x00, 0x01, 0x00, 0x05 },
+            },
+        },
+    }
+}
+
+func TestPack(t *testing.T) {
+    var b packet.Buffer
+    b.Init(make([]byte, len(test_simple)))
+
+    p := MakeTestSimple()
+
+    if int(p.GetLength()) != len(test_simple) {
+        t.Fatalf("Length mismatch: %d", p.GetLength())
+    }
+
+    err := p.Pack(&b)
+    if err != nil {
+        t.Fatalf("Error packing: %s", err)
+    }
+
+    if !bytes.Equal(test_simple, b.Buffer()) {
+        t.Fatalf("Raw packet mismatch: %x", b.Buffer())
+    }
+}
+
+func BenchmarkPack(bn *testing.B) {
+    var b packet.Buffer
+    b.Init(make([]byte, len(test_simple)))
+
+    p := MakeTestSimple()
+
+    for n := 0; n < bn.N; n++ {
+        p.Pack(&b)
+    }
+}
+
+func TestUnpack(t *testing.T) {
+    var p gtpv2.Packet
+
+    cmp := MakeTestSimple()
+
+    var b packet.Buffer
+    b.Init(test_simple)
+
+    err := p.Unpack(&b)
+    if err != nil {
+        t.Fatalf("Error unpacking: %s", err)
+    }
+
+    if !p.Equals(cmp) {
+        t.Fatalf("Packet mismatch:\n%s\n%s", &p, cmp)
+    }
+
+    if p.MsgType.String() != "create-session-request" {
+        t.Fatalf("Message type mismatch: %s", p.MsgType)
+    }
+
+    if len(p.IEs) != len(cmp.IEs) {
+        t.Fatalf("IEs mismatch: %v", p.IEs)
+    }
+
+    for i := range p.IEs {
+        if p.IEs[i].Type != cmp.IEs[i].Type ||
+           p.IEs[i].Instance != cmp.IEs[i].Instance ||
+           !bytes.Equal(p.IEs[i].Data, cmp.IEs[i].Data) {
+            t.Fatalf("IE mismatch: %v", p.IEs[i])
+        }
+    }
+
+    bearer := p.IE(gtpv2.BearerContext, 0)
+    if bearer == nil {
+        t.Fatalf("Bearer Context not found")
+    }
+
+    ies, err := bearer.IEs()
+    if err != nil {
+        t.Fatalf("Error decoding Bearer Context: %s", err)
+    }
+
+    if len(ies) != 1 || ies[0].Type != gtpv2.EBI ||
+       !bytes.Equal(ies[0].Data, []byte{ 0x05 }) {
+        t.Fatalf("Bearer Context mismatch: %v", ies)
+    }
+}
+
+func BenchmarkUnpack(bn *testing.B) {
+    var p gtpv2.Packet
+    var b packet.Buffer
+
+    for n := 0; n < bn.N; n++ {
+        b.Init(test_simple)
+        p.Unpack(&b)
+    }
+}
+
+func TestUnpackPiggyback(t *testing.T) {
+    data := append([]byte{}, test_simple...)
+    data[0] |= uint8(gtpv2.Piggyback)
+
+    /* Echo Request without TEID, piggybacked on the request */
+    data = append(data, 0x40, 0x01, 0x00, 0x04, 0x00, 0x00, 0x02, 0x00)
+
+    p, err := layers.UnpackAll(data, packet.GTPv2)
+    if err != nil {
+        t.Fatalf("Error unpacking: %s", err)
+    }
+
+    echo, ok := p.Payload().(*gtpv2.Packet)
+    if !ok || echo.MsgType != gtpv2.EchoRequest || echo.Seq != 2 {
+        t.Fatalf("Piggybacked message mismatch: %v", p.Payload())
+    }
+}
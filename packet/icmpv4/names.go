@@ -0,0 +1,113 @@
+/*
+ * Network packet analysis framework.
+ *
+ * Copyright (c) 2014, Alessandro Ghedini
+ * All rights reserved.
+ *
+ * Redistribution and use in source and binary forms, with or without
+ * modification, are permitted provided that the following conditions are
+ * met:
+ *
+ *     * Redistributions of source code must retain the above copyright
+ *       notice, this list of conditions and the following disclaimer.
+ *
+ *     * Redistributions in binary form must reproduce the above copyright
+ *       notice, this list of conditions and the following disclaimer in the
+ *       documentation and/or other materials provided with the distribution.
+ *
+ * THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS
+ * IS" AND ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO,
+ * THE IMPLIED WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR
+ * PURPOSE ARE DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT HOLDER OR
+ * CONTRIBUTORS BE LIABLE FOR ANY DIRECT, INDIRECT, INCIDENTAL, SPECIAL,
+ * EXEMPLARY, OR CONSEQUENTIAL DAMAGES (INCLUDING, BUT NOT LIMITED TO,
+ * PROCUREMENT OF SUBSTITUTE GOODS OR SERVICES; LOSS OF USE, DATA, OR
+ * PROFITS; OR BUSINESS INTERRUPTION) HOWEVER CAUSED AND ON ANY THEORY OF
+ * LIABILITY, WHETHER IN CONTRACT, STRICT LIABILITY, OR TORT (INCLUDING
+ * NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE OF THIS
+ * SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+ */
+
+package icmpv4
+
+import "fmt"
+
+var type_names = map[Type]string{
+    EchoReply:       "Echo Reply",
+    DstUnreachable:  "Destination Unreachable",
+    SrcQuench:       "Source Quench",
+    RedirectMsg:     "Redirect",
+    EchoRequest:     "Echo Request",
+    RouterAdv:       "Router Advertisement",
+    RouterSol:       "Router Solicitation",
+    TimeExceeded:    "Time Exceeded",
+    ParamProblem:    "Parameter Problem",
+    Timestamp:       "Timestamp",
+    TimestampReply:  "Timestamp Reply",
+    InfoRequest:     "Information Request",
+    InfoReply:       "Information Reply",
+    AddrMaskRequest: "Address Mask Request",
+    AddrMaskReply:   "Address Mask Reply",
+}
+
+var code_names = map[Type]map[Code]string{
+    DstUnreachable: {
+        0:  "Network unreachable",
+        1:  "Host unreachable",
+        2:  "Protocol unreachable",
+        3:  "Port unreachable",
+        4:  "Fragmentation needed",
+        5:  "Source route failed",
+        6:  "Destination network unknown",
+        7:  "Destination host unknown",
+        8:  "Source host isolated",
+        9:  "Network administratively prohibited",
+        10: "Host administratively prohibited",
+        11: "Network unreachable for TOS",
+        12: "Host unreachable for TOS",
+        13: "Communication administratively prohibited",
+        14: "Host precedence violation",
+        15: "Precedence cutoff in effect",
+    },
+
+    RedirectMsg: {
+        0: "Network",
+        1: "Host",
+        2: "TOS and network",
+        3: "TOS and host",
+    },
+
+    TimeExceeded: {
+        0: "TTL exceeded in transit",
+        1: "Fragment reassembly time exceeded",
+    },
+
+    ParamProblem: {
+        0: "Pointer indicates the error",
+        1: "Missing a required option",
+        2: "Bad length",
+    },
+}
+
+// Return the name of the given message type, followed by the name of the given
+// code in parentheses when the type defines codes, e.g. "Destination
+// Unreachable (Host unreachable)". Unknown types and codes are shown as
+// numbers, e.g. "Type 42 (Code 1)".
+func TypeName(t Type, code Code) string {
+    name, ok := type_names[t]
+    if !ok {
+        name = fmt.Sprintf("Type %d", t)
+    }
+
+    codes, ok := code_names[t]
+    if !ok && code == 0 {
+        return name
+    }
+
+    code_name, ok := codes[code]
+    if !ok {
+        code_name = fmt.Sprintf("Code %d", code)
+    }
+
+    return fmt.Sprintf("%s (%s)", name, code_name)
+}
@@ -29,20 +29,38 @@
  */
 
 // Provides encoding and decoding for ICMPv4 packets.
+//
+// Redirect messages are decoded into their gateway address (followed by the
+// embedded packet) and Router Advertisement messages into their lifetime and
+// router addresses. For the other messages the 4 bytes following the checksum
+// are decoded as identifier and sequence number.
 package icmpv4
 
 import "fmt"
+import "net"
 
 import "github.com/adigal150/go.pkt/packet"
-import "github.com/adigal150/go.pkt/packet/ipv4"
 
 type Packet struct {
-    Type        Type
-    Code        Code
-    Checksum    uint16        `string:"sum"`
-    Id          uint16
-    Seq         uint16
-    pkt_payload packet.Packet `cmp:"skip" string:"skip"`
+    Type         Type
+    Code         Code
+    Checksum     uint16        `string:"sum"`
+    Id           uint16
+    Seq          uint16
+
+    /* Redirect messages only */
+    Gateway      net.IP        `string:"gw"`
+
+    /* Router Advertisement messages only */
+    Lifetime     uint16
+    Routers      []RouterAddr  `cmp:"skip" string:"skip"`
+
+    // Encode the Checksum field as-is, instead of computing it from the
+    // packet, e.g. to craft malformed packets.
+    KeepChecksum bool          `cmp:"skip" string:"skip"`
+
+    pkt_payload  packet.Packet `cmp:"skip" string:"skip"`
+    pkt_raw      []byte        `cmp:"skip" string:"skip"`
 }
 
 type Type uint8
@@ -85,7 +103,7 @@ func (p *Packet) GetLength() uint16 {
         return p.pkt_payload.GetLength() + 8
     }
 
-    return 8
+    return 8 + p.router_len()
 }
 
 func (p *Packet) Equals(other packet.Packet) bool {
@@ -112,31 +130,60 @@ func (p *Packet) Pack(buf *packet.Buffer) error {
     buf.WriteN(byte(p.Type))
     buf.WriteN(byte(p.Code))
     buf.WriteN(uint16(0x0000))
-    buf.WriteN(p.Id)
-    buf.WriteN(p.Seq)
 
-    p.Checksum = ipv4.CalculateChecksum(buf.LayerBytes(), 0)
+    ok, err := p.pack_router(buf)
+    if err != nil {
+        return err
+    }
+
+    if !ok {
+        buf.WriteN(p.Id)
+        buf.WriteN(p.Seq)
+    }
+
+    if !p.KeepChecksum {
+        p.Checksum = packet.Checksum(buf.LayerBytes(), 0)
+    }
+
     buf.PutUint16N(2, p.Checksum)
 
-    return nil
+    return buf.Err()
 }
 
 func (p *Packet) Unpack(buf *packet.Buffer) error {
+    p.pkt_raw = buf.Bytes()
+
     buf.ReadN(&p.Type)
     buf.ReadN(&p.Code)
     buf.ReadN(&p.Checksum)
-    buf.ReadN(&p.Id)
-    buf.ReadN(&p.Seq)
+
+    ok, err := p.unpack_router(buf)
+    if err != nil {
+        return err
+    }
+
+    if !ok {
+        buf.ReadN(&p.Id)
+        buf.ReadN(&p.Seq)
+    }
 
     /* TODO: data */
 
-    return nil
+    return buf.Err()
 }
 
 func (p *Packet) Payload() packet.Packet {
     return p.pkt_payload
 }
 
+func (p *Packet) RawBytes() []byte {
+    return p.pkt_raw
+}
+
+func (p *Packet) HeaderBytes() []byte {
+    return packet.HeaderBytes(p)
+}
+
 func (p *Packet) GuessPayloadType() packet.Type {
     switch p.Type {
     case DstUnreachable, SrcQuench, RedirectMsg, TimeExceeded, ParamProblem:
@@ -158,10 +205,35 @@ func (p *Packet) SetPayload(pl packet.Packet) error {
 func (p *Packet) InitChecksum(csum uint32) {
 }
 
+func (p *Packet) Clone() packet.Packet {
+    c := *p
+
+    c.Gateway     = packet.CloneBytes(p.Gateway)
+    c.pkt_payload = packet.ClonePayload(p.pkt_payload)
+
+    if p.Routers != nil {
+        c.Routers = make([]RouterAddr, len(p.Routers))
+
+        for i, r := range p.Routers {
+            c.Routers[i] = RouterAddr{
+                Addr:       packet.CloneBytes(r.Addr),
+                Preference: r.Preference,
+            }
+        }
+    }
+
+    return &c
+}
+
 func (p *Packet) String() string {
     return packet.Stringify(p)
 }
 
+// Return the name of the message type and code (see TypeName()).
+func (p *Packet) Summary() string {
+    return TypeName(p.Type, p.Code)
+}
+
 func (t Type) String() string {
     switch t {
     case EchoReply:         return "echo-reply"
@@ -31,6 +31,8 @@
 package icmpv4_test
 
 import "bytes"
+import "net"
+import "strings"
 import "testing"
 
 import "github.com/adigal150/go.pkt/packet"
@@ -104,3 +106,167 @@ func BenchmarkUnpack(bn *testing.B) {
         p.Unpack(&b)
     }
 }
+
+func TestAnswers(t *testing.T) {
+    req := MakeTestSimple()
+
+    rsp := MakeTestSimple()
+    rsp.Type = icmpv4.EchoReply
+
+    if !rsp.Answers(req) {
+        t.Fatalf("Echo reply does not answer echo request")
+    }
+
+    if req.Answers(rsp) {
+        t.Fatalf("Echo request answers echo reply")
+    }
+
+    rsp.Id = 16
+
+    if rsp.Answers(req) {
+        t.Fatalf("Echo reply answers echo request with different id")
+    }
+}
+
+var test_redirect = []byte{
+    0x05, 0x01, 0x39, 0x55, 0xc0, 0xa8, 0x01, 0x01,
+}
+
+func TestRedirect(t *testing.T) {
+    var b packet.Buffer
+    b.Init(make([]byte, len(test_redirect)))
+
+    p := icmpv4.Make()
+    p.Type    = icmpv4.RedirectMsg
+    p.Code    = 1
+    p.Gateway = net.ParseIP("192.168.1.1")
+
+    err := p.Pack(&b)
+    if err != nil {
+        t.Fatalf("Error packing: %s", err)
+    }
+
+    if !bytes.Equal(test_redirect, b.Buffer()) {
+        t.Fatalf("Raw packet mismatch: %x", b.Buffer())
+    }
+
+    var q icmpv4.Packet
+
+    b.Init(test_redirect)
+
+    err = q.Unpack(&b)
+    if err != nil {
+        t.Fatalf("Error unpacking: %s", err)
+    }
+
+    if !q.Equals(p) || !q.Gateway.Equal(p.Gateway) {
+        t.Fatalf("Packet mismatch:\n%s\n%s", &q, p)
+    }
+
+    if q.GuessPayloadType() != packet.IPv4 {
+        t.Fatalf("Payload type mismatch: %s", q.GuessPayloadType())
+    }
+}
+
+var test_router_adv = []byte{
+    0x09, 0x00, 0x6a, 0x97, 0x02, 0x02, 0x07, 0x08, 0xc0, 0xa8, 0x01, 0x01,
+    0x00, 0x00, 0x00, 0x0a, 0xc0, 0xa8, 0x01, 0x02, 0xff, 0xff, 0xff, 0xff,
+}
+
+func TestRouterAdv(t *testing.T) {
+    var b packet.Buffer
+    b.Init(make([]byte, len(test_router_adv)))
+
+    p := icmpv4.Make()
+    p.Type     = icmpv4.RouterAdv
+    p.Lifetime = 1800
+    p.Routers  = []icmpv4.RouterAddr{
+        { Addr: net.ParseIP("192.168.1.1"), Preference: 10 },
+        { Addr: net.ParseIP("192.168.1.2"), Preference: -1 },
+    }
+
+    if p.GetLength() != uint16(len(test_router_adv)) {
+        t.Fatalf("Length mismatch: %d", p.GetLength())
+    }
+
+    err := p.Pack(&b)
+    if err != nil {
+        t.Fatalf("Error packing: %s", err)
+    }
+
+    if !bytes.Equal(test_router_adv, b.Buffer()) {
+        t.Fatalf("Raw packet mismatch: %x", b.Buffer())
+    }
+
+    var q icmpv4.Packet
+
+    b.Init(test_router_adv)
+
+    err = q.Unpack(&b)
+    if err != nil {
+        t.Fatalf("Error unpacking: %s", err)
+    }
+
+    if !q.Equals(p) || len(q.Routers) != 2 {
+        t.Fatalf("Packet mismatch:\n%s\n%s", &q, p)
+    }
+
+    for i, r := range q.Routers {
+        if !r.Addr.Equal(p.Routers[i].Addr) ||
+           r.Preference != p.Routers[i].Preference {
+            t.Fatalf("Router mismatch: %v", r)
+        }
+    }
+
+    b.Init(test_router_adv[:20])
+
+    if q.Unpack(&b) == nil {
+        t.Fatalf("Truncated router address not detected")
+    }
+}
+
+func TestTypeName(t *testing.T) {
+    names := []struct {
+        t    icmpv4.Type
+        code icmpv4.Code
+        name string
+    }{
+        { icmpv4.EchoRequest, 0, "Echo Request" },
+        { icmpv4.EchoReply, 0, "Echo Reply" },
+        { icmpv4.DstUnreachable, 0,
+          "Destination Unreachable (Network unreachable)" },
+        { icmpv4.DstUnreachable, 1,
+          "Destination Unreachable (Host unreachable)" },
+        { icmpv4.DstUnreachable, 3,
+          "Destination Unreachable (Port unreachable)" },
+        { icmpv4.DstUnreachable, 4,
+          "Destination Unreachable (Fragmentation needed)" },
+        { icmpv4.DstUnreachable, 42, "Destination Unreachable (Code 42)" },
+        { icmpv4.TimeExceeded, 0, "Time Exceeded (TTL exceeded in transit)" },
+        { icmpv4.TimeExceeded, 1,
+          "Time Exceeded (Fragment reassembly time exceeded)" },
+        { icmpv4.EchoRequest, 1, "Echo Request (Code 1)" },
+        { 42, 0, "Type 42" },
+    }
+
+    for _, n := range names {
+        name := icmpv4.TypeName(n.t, n.code)
+        if name != n.name {
+            t.Fatalf("Name mismatch: %s", name)
+        }
+    }
+
+    p := MakeTestSimple()
+    p.Type = icmpv4.DstUnreachable
+    p.Code = 3
+
+    s := "icmpv4(Destination Unreachable (Port unreachable), type=dst-unreach"
+    if !strings.HasPrefix(p.String(), s) {
+        t.Fatalf("String mismatch: %s", p.String())
+    }
+
+    s = "ICMPv4 (Destination Unreachable (Port unreachable))\n"
+    if !strings.HasPrefix(packet.Tree(p), s) {
+        t.Fatalf("Tree mismatch: %s", packet.Tree(p))
+    }
+}
@@ -0,0 +1,133 @@
+/*
+ * Network packet analysis framework.
+ *
+ * Copyright (c) 2014, Alessandro Ghedini
+ * All rights reserved.
+ *
+ * Redistribution and use in source and binary forms, with or without
+ * modification, are permitted provided that the following conditions are
+ * met:
+ *
+ *     * Redistributions of source code must retain the above copyright
+ *       notice, this list of conditions and the following disclaimer.
+ *
+ *     * Redistributions in binary form must reproduce the above copyright
+ *       notice, this list of conditions and the following disclaimer in the
+ *       documentation and/or other materials provided with the distribution.
+ *
+ * THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS
+ * IS" AND ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO,
+ * THE IMPLIED WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR
+ * PURPOSE ARE DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT HOLDER OR
+ * CONTRIBUTORS BE LIABLE FOR ANY DIRECT, INDIRECT, INCIDENTAL, SPECIAL,
+ * EXEMPLARY, OR CONSEQUENTIAL DAMAGES (INCLUDING, BUT NOT LIMITED TO,
+ * PROCUREMENT OF SUBSTITUTE GOODS OR SERVICES; LOSS OF USE, DATA, OR
+ * PROFITS; OR BUSINESS INTERRUPTION) HOWEVER CAUSED AND ON ANY THEORY OF
+ * LIABILITY, WHETHER IN CONTRACT, STRICT LIABILITY, OR TORT (INCLUDING
+ * NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE OF THIS
+ * SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+ */
+
+package icmpv4
+
+import "fmt"
+import "net"
+
+import "github.com/adigal150/go.pkt/packet"
+
+// A router address announced by a Router Advertisement message, together with
+// its preference level (higher is preferred).
+type RouterAddr struct {
+    Addr       net.IP
+    Preference int32
+}
+
+func (p *Packet) router_len() uint16 {
+    if p.Type == RouterAdv {
+        return uint16(len(p.Routers)) * 8
+    }
+
+    return 0
+}
+
+/* Write the fields following the checksum, if the message type defines them,
+ * and return false otherwise */
+func (p *Packet) pack_router(buf *packet.Buffer) (bool, error) {
+    switch p.Type {
+    case RedirectMsg:
+        if len(p.Gateway.To4()) != 4 {
+            return true, fmt.Errorf("Invalid redirect gateway: %s", p.Gateway)
+        }
+
+        buf.Write(p.Gateway.To4())
+
+    case RouterAdv:
+        if len(p.Routers) > 0xFF {
+            return true, fmt.Errorf("Too many routers: %d", len(p.Routers))
+        }
+
+        buf.WriteN(uint8(len(p.Routers)), uint8(2), p.Lifetime)
+
+        for _, r := range p.Routers {
+            if len(r.Addr.To4()) != 4 {
+                return true, fmt.Errorf("Invalid router address: %s", r.Addr)
+            }
+
+            buf.Write(r.Addr.To4())
+            buf.WriteN(r.Preference)
+        }
+
+    default:
+        return false, nil
+    }
+
+    return true, buf.Err()
+}
+
+/* Read the fields following the checksum, if the message type defines them,
+ * and return false otherwise */
+func (p *Packet) unpack_router(buf *packet.Buffer) (bool, error) {
+    switch p.Type {
+    case RedirectMsg:
+        p.Gateway = net.IP(buf.Next(4))
+
+    case RouterAdv:
+        var num_addrs, entry_size uint8
+
+        buf.ReadN(&num_addrs, &entry_size, &p.Lifetime)
+
+        if buf.Err() != nil {
+            return true, buf.Err()
+        }
+
+        if entry_size < 2 {
+            return true, packet.Errorf(packet.ErrInvalidLength,
+                                       "Invalid address entry size: %d",
+                                       entry_size)
+        }
+
+        p.Routers = nil
+
+        for i := 0; i < int(num_addrs); i++ {
+            if buf.Len() < int(entry_size) * 4 {
+                return true, packet.Errorf(packet.ErrTruncated,
+                                           "Truncated router address")
+            }
+
+            var r RouterAddr
+
+            r.Addr = net.IP(buf.Next(4))
+            buf.ReadN(&r.Preference)
+
+            /* skip any additional field of the entry */
+            buf.Next(int(entry_size) * 4 - 8)
+
+            p.Routers = append(p.Routers, r)
+        }
+
+    default:
+        return false, nil
+    }
+
+    return true, buf.Err()
+}
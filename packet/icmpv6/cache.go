@@ -0,0 +1,254 @@
+/*
+ * Network packet analysis framework.
+ *
+ * Copyright (c) 2014, Alessandro Ghedini
+ * All rights reserved.
+ *
+ * Redistribution and use in source and binary forms, with or without
+ * modification, are permitted provided that the following conditions are
+ * met:
+ *
+ *     * Redistributions of source code must retain the above copyright
+ *       notice, this list of conditions and the following disclaimer.
+ *
+ *     * Redistributions in binary form must reproduce the above copyright
+ *       notice, this list of conditions and the following disclaimer in the
+ *       documentation and/or other materials provided with the distribution.
+ *
+ * THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS
+ * IS" AND ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO,
+ * THE IMPLIED WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR
+ * PURPOSE ARE DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT HOLDER OR
+ * CONTRIBUTORS BE LIABLE FOR ANY DIRECT, INDIRECT, INCIDENTAL, SPECIAL,
+ * EXEMPLARY, OR CONSEQUENTIAL DAMAGES (INCLUDING, BUT NOT LIMITED TO,
+ * PROCUREMENT OF SUBSTITUTE GOODS OR SERVICES; LOSS OF USE, DATA, OR
+ * PROFITS; OR BUSINESS INTERRUPTION) HOWEVER CAUSED AND ON ANY THEORY OF
+ * LIABILITY, WHETHER IN CONTRACT, STRICT LIABILITY, OR TORT (INCLUDING
+ * NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE OF THIS
+ * SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+ */
+
+package icmpv6
+
+import "bytes"
+import "net"
+import "sync"
+import "time"
+
+// Cache of the IPv6 to MAC address bindings learned from observed Neighbor
+// Discovery messages, and of the routers that advertised themselves, e.g. to
+// implement a passive IPv6 monitor. Conflicting bindings (the same IP address
+// announced by different MAC addresses) are recorded, since they are a common
+// sign of Neighbor Advertisement spoofing. It is safe for concurrent use.
+type Cache struct {
+    mutex     sync.Mutex
+    ttl       time.Duration
+    entries   map[string]*Entry
+    routers   map[string]*Router
+    conflicts []Conflict
+}
+
+// A binding between an IPv6 and a MAC address, and the time it was last seen.
+type Entry struct {
+    IP     net.IP
+    HWAddr net.HardwareAddr
+    Time   time.Time
+}
+
+// A change of the MAC address bound to an IPv6 address, seen before the
+// previous binding expired.
+type Conflict struct {
+    IP        net.IP
+    OldHWAddr net.HardwareAddr
+    NewHWAddr net.HardwareAddr
+    Time      time.Time
+}
+
+// The last Router Advertisement seen from a router. The MAC address is nil if
+// the advertisement didn't include it.
+type Router struct {
+    IP       net.IP
+    HWAddr   net.HardwareAddr
+    Flags    RAFlags
+    Lifetime time.Duration
+    Prefixes []PrefixInfo
+    Time     time.Time
+}
+
+// Create a new cache whose bindings expire after the given time without being
+// seen again. A zero ttl means that bindings never expire. Routers expire
+// according to the lifetime they advertised instead.
+func NewCache(ttl time.Duration) *Cache {
+    return &Cache{
+        ttl:     ttl,
+        entries: map[string]*Entry{},
+        routers: map[string]*Router{},
+    }
+}
+
+// Learn from the given message, sent from the given IPv6 address, at the
+// current time. See ObserveAt().
+func (c *Cache) Observe(src net.IP, p *Packet) *Conflict {
+    return c.ObserveAt(src, p, time.Now())
+}
+
+// Learn from the given message, sent from the given IPv6 address, as seen at
+// the given time (e.g. the timestamp of a captured packet):
+//
+//  - Neighbor Advertisements bind their target address to the MAC address of
+//    their Target Link-Layer Address option.
+//  - Neighbor Solicitations and Router Advertisements bind the source address
+//    to the MAC address of their Source Link-Layer Address option.
+//  - Router Advertisements also update the list of routers.
+//
+// Messages without a link-layer address option, or with an unspecified address
+// (e.g. duplicate address detection probes), don't bind anything.
+//
+// If the IP address was bound to a different MAC address, and the binding
+// didn't expire yet, the conflict is recorded and returned, and the new binding
+// replaces the old one. Otherwise nil is returned.
+func (c *Cache) ObserveAt(src net.IP, p *Packet, ts time.Time) *Conflict {
+    var ip net.IP
+    var hw net.HardwareAddr
+
+    switch p.Type {
+    case NeighborAdvert:
+        ip = p.TargetAddr
+        hw = p.LinkAddr(NDTargetLinkAddr)
+
+    case NeighborSolicit, RouterAdvert:
+        ip = src
+        hw = p.LinkAddr(NDSourceLinkAddr)
+
+    default:
+        return nil
+    }
+
+    /* the packet addresses may alias the capture buffer, so copy them */
+    ip = append(net.IP(nil), ip.To16()...)
+    hw = append(net.HardwareAddr(nil), hw...)
+
+    c.mutex.Lock()
+    defer c.mutex.Unlock()
+
+    if p.Type == RouterAdvert && len(ip) == net.IPv6len {
+        c.routers[string(ip)] = &Router{
+            IP:       ip,
+            HWAddr:   hw,
+            Flags:    p.RAFlags(),
+            Lifetime: time.Duration(p.RouterLifetime()) * time.Second,
+            Prefixes: p.Prefixes(),
+            Time:     ts,
+        }
+    }
+
+    if len(ip) != net.IPv6len || ip.IsUnspecified() || len(hw) == 0 {
+        return nil
+    }
+
+    var conflict *Conflict
+
+    key := string(ip)
+
+    entry := c.entries[key]
+    if entry != nil && !c.expired(entry, ts) &&
+       !bytes.Equal(entry.HWAddr, hw) {
+        conflict = &Conflict{
+            IP:        ip,
+            OldHWAddr: entry.HWAddr,
+            NewHWAddr: hw,
+            Time:      ts,
+        }
+
+        c.conflicts = append(c.conflicts, *conflict)
+    }
+
+    c.entries[key] = &Entry{ IP: ip, HWAddr: hw, Time: ts }
+
+    return conflict
+}
+
+// Return the MAC address bound to the given IPv6 address, if the binding is
+// known and didn't expire.
+func (c *Cache) Lookup(ip net.IP) (net.HardwareAddr, bool) {
+    c.mutex.Lock()
+    defer c.mutex.Unlock()
+
+    entry := c.entries[string(ip.To16())]
+    if entry == nil || c.expired(entry, time.Now()) {
+        return nil, false
+    }
+
+    return entry.HWAddr, true
+}
+
+// Remove the bindings and the routers that expired at the given time.
+func (c *Cache) Expire(now time.Time) {
+    c.mutex.Lock()
+    defer c.mutex.Unlock()
+
+    for key, entry := range c.entries {
+        if c.expired(entry, now) {
+            delete(c.entries, key)
+        }
+    }
+
+    for key, router := range c.routers {
+        if router.expired(now) {
+            delete(c.routers, key)
+        }
+    }
+}
+
+// Return the bindings that didn't expire yet.
+func (c *Cache) Entries() []Entry {
+    c.mutex.Lock()
+    defer c.mutex.Unlock()
+
+    var entries []Entry
+
+    now := time.Now()
+
+    for _, entry := range c.entries {
+        if !c.expired(entry, now) {
+            entries = append(entries, *entry)
+        }
+    }
+
+    return entries
+}
+
+// Return the routers whose advertised lifetime didn't expire yet. Routers that
+// advertised a zero lifetime (i.e. that aren't default routers) never expire.
+func (c *Cache) Routers() []Router {
+    c.mutex.Lock()
+    defer c.mutex.Unlock()
+
+    var routers []Router
+
+    now := time.Now()
+
+    for _, router := range c.routers {
+        if !router.expired(now) {
+            routers = append(routers, *router)
+        }
+    }
+
+    return routers
+}
+
+// Return the conflicts recorded so far, oldest first.
+func (c *Cache) Conflicts() []Conflict {
+    c.mutex.Lock()
+    defer c.mutex.Unlock()
+
+    return append([]Conflict(nil), c.conflicts...)
+}
+
+func (c *Cache) expired(entry *Entry, now time.Time) bool {
+    return c.ttl > 0 && now.Sub(entry.Time) > c.ttl
+}
+
+func (r *Router) expired(now time.Time) bool {
+    return r.Lifetime > 0 && now.Sub(r.Time) > r.Lifetime
+}
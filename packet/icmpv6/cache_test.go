@@ -0,0 +1,157 @@
+/*
+ * Network packet analysis framework.
+ *
+ * Copyright (c) 2014, Alessandro Ghedini
+ * All rights reserved.
+ *
+ * Redistribution and use in source and binary forms, with or without
+ * modification, are permitted provided that the following conditions are
+ * met:
+ *
+ *     * Redistributions of source code must retain the above copyright
+ *       notice, this list of conditions and the following disclaimer.
+ *
+ *     * Redistributions in binary form must reproduce the above copyright
+ *       notice, this list of conditions and the following disclaimer in the
+ *       documentation and/or other materials provided with the distribution.
+ *
+ * THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS
+ * IS" AND ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO,
+ * THE IMPLIED WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR
+ * PURPOSE ARE DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT HOLDER OR
+ * CONTRIBUTORS BE LIABLE FOR ANY DIRECT, INDIRECT, INCIDENTAL, SPECIAL,
+ * EXEMPLARY, OR CONSEQUENTIAL DAMAGES (INCLUDING, BUT NOT LIMITED TO,
+ * PROCUREMENT OF SUBSTITUTE GOODS OR SERVICES; LOSS OF USE, DATA, OR
+ * PROFITS; OR BUSINESS INTERRUPTION) HOWEVER CAUSED AND ON ANY THEORY OF
+ * LIABILITY, WHETHER IN CONTRACT, STRICT LIABILITY, OR TORT (INCLUDING
+ * NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE OF THIS
+ * SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+ */
+
+package icmpv6_test
+
+import "net"
+import "testing"
+import "time"
+
+import "github.com/adigal150/go.pkt/packet"
+import "github.com/adigal150/go.pkt/packet/icmpv6"
+
+var hwsrc_str = "4c:72:b9:54:e5:3d"
+var hwdst_str = "00:19:cb:55:18:9c"
+
+func make_advert(ip_str, hw_str string) *icmpv6.Packet {
+    hw, _ := net.ParseMAC(hw_str)
+
+    return icmpv6.NeighborAdvertisement(net.ParseIP(ip_str), hw,
+                                        icmpv6.NAOverride)
+}
+
+func TestCacheLearn(t *testing.T) {
+    c := icmpv6.NewCache(time.Minute)
+
+    if _, ok := c.Lookup(net.ParseIP(ipsrc_str)); ok {
+        t.Fatalf("Lookup of unknown address succeeded")
+    }
+
+    p := make_advert(ipsrc_str, hwsrc_str)
+
+    var b packet.Buffer
+    b.Init(make([]byte, p.GetLength()))
+
+    err := p.Pack(&b)
+    if err != nil {
+        t.Fatalf("Error packing: %s", err)
+    }
+
+    var q icmpv6.Packet
+
+    b.Init(b.Buffer())
+
+    err = q.Unpack(&b)
+    if err != nil {
+        t.Fatalf("Error unpacking: %s", err)
+    }
+
+    conflict := c.Observe(net.ParseIP(ipsrc_str), &q)
+    if conflict != nil {
+        t.Fatalf("Unexpected conflict: %v", conflict)
+    }
+
+    hw, ok := c.Lookup(net.ParseIP(ipsrc_str))
+    if !ok || hw.String() != hwsrc_str {
+        t.Fatalf("Binding mismatch: %s", hw)
+    }
+
+    probe := &icmpv6.Packet{
+        Type: icmpv6.NeighborSolicit,
+        TargetAddr: net.ParseIP(ipdst_str),
+    }
+
+    c.Observe(net.IPv6unspecified, probe)
+
+    if len(c.Entries()) != 1 {
+        t.Fatalf("Entry count mismatch: %d", len(c.Entries()))
+    }
+}
+
+func TestCacheConflict(t *testing.T) {
+    c := icmpv6.NewCache(time.Minute)
+
+    c.Observe(net.ParseIP(ipsrc_str), make_advert(ipsrc_str, hwsrc_str))
+
+    conflict := c.Observe(net.ParseIP(ipdst_str),
+                          make_advert(ipsrc_str, hwdst_str))
+    if conflict == nil {
+        t.Fatalf("Conflict not detected")
+    }
+
+    if !conflict.IP.Equal(net.ParseIP(ipsrc_str)) ||
+       conflict.OldHWAddr.String() != hwsrc_str ||
+       conflict.NewHWAddr.String() != hwdst_str {
+        t.Fatalf("Conflict mismatch: %v", conflict)
+    }
+
+    hw, _ := c.Lookup(net.ParseIP(ipsrc_str))
+    if hw.String() != hwdst_str {
+        t.Fatalf("Binding not updated: %s", hw)
+    }
+
+    if len(c.Conflicts()) != 1 {
+        t.Fatalf("Conflicts mismatch: %v", c.Conflicts())
+    }
+}
+
+func TestCacheRouter(t *testing.T) {
+    c := icmpv6.NewCache(time.Minute)
+
+    _, prefix, _ := net.ParseCIDR("2001:db8:1::/64")
+    hw, _ := net.ParseMAC(hwsrc_str)
+
+    p := icmpv6.RouterAdvertisement(icmpv6.RAOptions{
+        RouterLifetime: 1800,
+        SourceLinkAddr: hw,
+        Prefixes: []icmpv6.PrefixInfo{ { Prefix: prefix } },
+    })
+
+    c.Observe(net.ParseIP("fe80::1"), p)
+
+    routers := c.Routers()
+    if len(routers) != 1 ||
+       !routers[0].IP.Equal(net.ParseIP("fe80::1")) ||
+       routers[0].HWAddr.String() != hwsrc_str ||
+       routers[0].Lifetime != 1800 * time.Second ||
+       len(routers[0].Prefixes) != 1 {
+        t.Fatalf("Routers mismatch: %v", routers)
+    }
+
+    if _, ok := c.Lookup(net.ParseIP("fe80::1")); !ok {
+        t.Fatalf("Router binding not learned")
+    }
+
+    c.Expire(time.Now().Add(time.Hour))
+
+    if len(c.Routers()) != 0 {
+        t.Fatalf("Router not expired: %v", c.Routers())
+    }
+}
@@ -0,0 +1,176 @@
+/*
+ * Network packet analysis framework.
+ *
+ * Copyright (c) 2014, Alessandro Ghedini
+ * All rights reserved.
+ *
+ * Redistribution and use in source and binary forms, with or without
+ * modification, are permitted provided that the following conditions are
+ * met:
+ *
+ *     * Redistributions of source code must retain the above copyright
+ *       notice, this list of conditions and the following disclaimer.
+ *
+ *     * Redistributions in binary form must reproduce the above copyright
+ *       notice, this list of conditions and the following disclaimer in the
+ *       documentation and/or other materials provided with the distribution.
+ *
+ * THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS
+ * IS" AND ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO,
+ * THE IMPLIED WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR
+ * PURPOSE ARE DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT HOLDER OR
+ * CONTRIBUTORS BE LIABLE FOR ANY DIRECT, INDIRECT, INCIDENTAL, SPECIAL,
+ * EXEMPLARY, OR CONSEQUENTIAL DAMAGES (INCLUDING, BUT NOT LIMITED TO,
+ * PROCUREMENT OF SUBSTITUTE GOODS OR SERVICES; LOSS OF USE, DATA, OR
+ * PROFITS; OR BUSINESS INTERRUPTION) HOWEVER CAUSED AND ON ANY THEORY OF
+ * LIABILITY, WHETHER IN CONTRACT, STRICT LIABILITY, OR TORT (INCLUDING
+ * NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE OF THIS
+ * SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+ */
+
+package icmpv6
+
+import "fmt"
+import "net"
+
+import "github.com/adigal150/go.pkt/packet"
+import "github.com/adigal150/go.pkt/packet/igmp"
+
+// A multicast address record of an MLDv2 report. The record types are the same
+// as the IGMPv3 ones.
+type MLDRecord struct {
+    Type          igmp.RecordType
+    MulticastAddr net.IP
+    Sources       []net.IP
+    AuxData       []byte
+}
+
+// Return the maximum response delay (in milliseconds) of an MLD query.
+func (p *Packet) MaxRespDelay() uint16 {
+    return uint16(p.Body >> 16)
+}
+
+func (p *Packet) mld_len() uint16 {
+    switch p.Type {
+    case MLDQuery, MLDReport, MLDDone:
+        return 16
+
+    case MLDv2Report:
+        var length uint16
+
+        for _, r := range p.Records {
+            length += 20 + uint16(len(r.Sources)) * 16 + uint16(len(r.AuxData))
+        }
+
+        return length
+    }
+
+    return 0
+}
+
+func (p *Packet) pack_mld(buf *packet.Buffer) error {
+    if p.Type == MLDv2Report {
+        p.Body = uint32(len(p.Records))
+    }
+
+    buf.WriteN(p.Body)
+
+    switch p.Type {
+    case MLDQuery, MLDReport, MLDDone:
+        buf.Write(p.MulticastAddr.To16())
+
+    case MLDv2Report:
+        for _, r := range p.Records {
+            if len(r.AuxData) % 4 != 0 {
+                return fmt.Errorf("Invalid MLD aux data length: %d",
+                                  len(r.AuxData))
+            }
+
+            buf.WriteN(r.Type)
+            buf.WriteN(uint8(len(r.AuxData) / 4))
+            buf.WriteN(uint16(len(r.Sources)))
+            buf.Write(r.MulticastAddr.To16())
+
+            for _, src := range r.Sources {
+                buf.Write(src.To16())
+            }
+
+            buf.Write(r.AuxData)
+        }
+    }
+
+    return buf.Err()
+}
+
+func (p *Packet) unpack_mld(buf *packet.Buffer) error {
+    switch p.Type {
+    case MLDQuery, MLDReport, MLDDone:
+        if buf.Len() < 16 {
+            return packet.Errorf(packet.ErrTruncated, "Invalid MLD message")
+        }
+
+        p.MulticastAddr = net.IP(buf.Next(16))
+
+    case MLDv2Report:
+        p.Records = nil
+
+        for i := 0; i < int(uint16(p.Body)); i++ {
+            if buf.Len() < 20 {
+                return packet.Errorf(packet.ErrTruncated,
+                                     "Invalid MLD address record")
+            }
+
+            var r MLDRecord
+            var aux_len uint8
+            var sources uint16
+
+            buf.ReadN(&r.Type)
+            buf.ReadN(&aux_len)
+            buf.ReadN(&sources)
+
+            r.MulticastAddr = net.IP(buf.Next(16))
+
+            if buf.Len() < int(sources) * 16 + int(aux_len) * 4 {
+                return packet.Errorf(packet.ErrTruncated,
+                                     "Invalid MLD address record")
+            }
+
+            for j := 0; j < int(sources); j++ {
+                r.Sources = append(r.Sources, net.IP(buf.Next(16)))
+            }
+
+            r.AuxData = buf.Next(int(aux_len) * 4)
+
+            p.Records = append(p.Records, r)
+        }
+    }
+
+    return buf.Err()
+}
+
+func clone_mld_records(records []MLDRecord) []MLDRecord {
+    if records == nil {
+        return nil
+    }
+
+    clone := make([]MLDRecord, len(records))
+
+    for i, rec := range records {
+        rec.MulticastAddr = packet.CloneBytes(rec.MulticastAddr)
+        rec.AuxData       = packet.CloneBytes(rec.AuxData)
+
+        if rec.Sources != nil {
+            sources := make([]net.IP, len(rec.Sources))
+
+            for j, addr := range rec.Sources {
+                sources[j] = packet.CloneBytes(addr)
+            }
+
+            rec.Sources = sources
+        }
+
+        clone[i] = rec
+    }
+
+    return clone
+}
@@ -0,0 +1,96 @@
+/*
+ * Network packet analysis framework.
+ *
+ * Copyright (c) 2014, Alessandro Ghedini
+ * All rights reserved.
+ *
+ * Redistribution and use in source and binary forms, with or without
+ * modification, are permitted provided that the following conditions are
+ * met:
+ *
+ *     * Redistributions of source code must retain the above copyright
+ *       notice, this list of conditions and the following disclaimer.
+ *
+ *     * Redistributions in binary form must reproduce the above copyright
+ *       notice, this list of conditions and the following disclaimer in the
+ *       documentation and/or other materials provided with the distribution.
+ *
+ * THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS
+ * IS" AND ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO,
+ * THE IMPLIED WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR
+ * PURPOSE ARE DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT HOLDER OR
+ * CONTRIBUTORS BE LIABLE FOR ANY DIRECT, INDIRECT, INCIDENTAL, SPECIAL,
+ * EXEMPLARY, OR CONSEQUENTIAL DAMAGES (INCLUDING, BUT NOT LIMITED TO,
+ * PROCUREMENT OF SUBSTITUTE GOODS OR SERVICES; LOSS OF USE, DATA, OR
+ * PROFITS; OR BUSINESS INTERRUPTION) HOWEVER CAUSED AND ON ANY THEORY OF
+ * LIABILITY, WHETHER IN CONTRACT, STRICT LIABILITY, OR TORT (INCLUDING
+ * NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE OF THIS
+ * SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+ */
+
+package icmpv6
+
+import "fmt"
+
+var type_names = map[Type]string{
+    DstUnreachable:  "Destination Unreachable",
+    PacketTooBig:    "Packet Too Big",
+    TimeExceeded:    "Time Exceeded",
+    ParamProblem:    "Parameter Problem",
+    EchoRequest:     "Echo Request",
+    EchoReply:       "Echo Reply",
+    MLDQuery:        "Multicast Listener Query",
+    MLDReport:       "Multicast Listener Report",
+    MLDDone:         "Multicast Listener Done",
+    RouterSolicit:   "Router Solicitation",
+    RouterAdvert:    "Router Advertisement",
+    NeighborSolicit: "Neighbor Solicitation",
+    NeighborAdvert:  "Neighbor Advertisement",
+    MLDv2Report:     "Version 2 Multicast Listener Report",
+}
+
+var code_names = map[Type]map[Code]string{
+    DstUnreachable: {
+        0: "No route to destination",
+        1: "Communication administratively prohibited",
+        2: "Beyond scope of source address",
+        3: "Address unreachable",
+        4: "Port unreachable",
+        5: "Source address failed ingress/egress policy",
+        6: "Reject route to destination",
+    },
+
+    TimeExceeded: {
+        0: "Hop limit exceeded in transit",
+        1: "Fragment reassembly time exceeded",
+    },
+
+    ParamProblem: {
+        0: "Erroneous header field",
+        1: "Unrecognized Next Header type",
+        2: "Unrecognized IPv6 option",
+    },
+}
+
+// Return the name of the given message type, followed by the name of the given
+// code in parentheses when the type defines codes, e.g. "Destination
+// Unreachable (Port unreachable)". Unknown types and codes are shown as
+// numbers, e.g. "Type 42 (Code 1)".
+func TypeName(t Type, code Code) string {
+    name, ok := type_names[t]
+    if !ok {
+        name = fmt.Sprintf("Type %d", t)
+    }
+
+    codes, ok := code_names[t]
+    if !ok && code == 0 {
+        return name
+    }
+
+    code_name, ok := codes[code]
+    if !ok {
+        code_name = fmt.Sprintf("Code %d", code)
+    }
+
+    return fmt.Sprintf("%s (%s)", name, code_name)
+}
@@ -0,0 +1,339 @@
+/*
+ * Network packet analysis framework.
+ *
+ * Copyright (c) 2014, Alessandro Ghedini
+ * All rights reserved.
+ *
+ * Redistribution and use in source and binary forms, with or without
+ * modification, are permitted provided that the following conditions are
+ * met:
+ *
+ *     * Redistributions of source code must retain the above copyright
+ *       notice, this list of conditions and the following disclaimer.
+ *
+ *     * Redistributions in binary form must reproduce the above copyright
+ *       notice, this list of conditions and the following disclaimer in the
+ *       documentation and/or other materials provided with the distribution.
+ *
+ * THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS
+ * IS" AND ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO,
+ * THE IMPLIED WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR
+ * PURPOSE ARE DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT HOLDER OR
+ * CONTRIBUTORS BE LIABLE FOR ANY DIRECT, INDIRECT, INCIDENTAL, SPECIAL,
+ * EXEMPLARY, OR CONSEQUENTIAL DAMAGES (INCLUDING, BUT NOT LIMITED TO,
+ * PROCUREMENT OF SUBSTITUTE GOODS OR SERVICES; LOSS OF USE, DATA, OR
+ * PROFITS; OR BUSINESS INTERRUPTION) HOWEVER CAUSED AND ON ANY THEORY OF
+ * LIABILITY, WHETHER IN CONTRACT, STRICT LIABILITY, OR TORT (INCLUDING
+ * NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE OF THIS
+ * SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+ */
+
+package icmpv6
+
+import "encoding/binary"
+import "fmt"
+import "net"
+import "strings"
+
+import "github.com/adigal150/go.pkt/packet"
+
+type RAFlags uint8
+
+const (
+    Managed     RAFlags = 0x80
+    OtherConfig         = 0x40
+)
+
+type NAFlags uint8
+
+const (
+    NARouter    NAFlags = 0x80
+    NASolicited         = 0x40
+    NAOverride          = 0x20
+)
+
+const (
+    NDSourceLinkAddr = 1
+    NDTargetLinkAddr = 2
+    NDPrefixInfo     = 3
+    NDRedirected     = 4
+    NDMTU            = 5
+)
+
+// Parameters of a Router Advertisement message (see RouterAdvertisement()).
+// Times are in seconds, except the reachable time and the retransmission timer
+// which are in milliseconds. A zero MTU omits the MTU option.
+type RAOptions struct {
+    CurHopLimit    uint8
+    Flags          RAFlags
+    RouterLifetime uint16
+    ReachableTime  uint32
+    RetransTimer   uint32
+    SourceLinkAddr net.HardwareAddr
+    MTU            uint32
+    Prefixes       []PrefixInfo
+}
+
+// A prefix advertised in a Prefix Information option, e.g. for stateless
+// address autoconfiguration (Autonomous) of the hosts on the link (OnLink).
+type PrefixInfo struct {
+    Prefix            *net.IPNet
+    OnLink            bool
+    Autonomous        bool
+    ValidLifetime     uint32
+    PreferredLifetime uint32
+}
+
+// Create a Router Advertisement message with the given parameters. The options
+// are appended in the order source link-layer address, MTU, prefixes. When the
+// packet is the payload of an IPv6 packet, its checksum is computed on Pack.
+func RouterAdvertisement(opts RAOptions) *Packet {
+    p := &Packet{
+        Type:          RouterAdvert,
+        ReachableTime: opts.ReachableTime,
+        RetransTimer:  opts.RetransTimer,
+    }
+
+    p.Body = uint32(opts.CurHopLimit) << 24 |
+             uint32(opts.Flags) << 16 |
+             uint32(opts.RouterLifetime)
+
+    if opts.SourceLinkAddr != nil {
+        p.Options = append(p.Options, packet.TLV{
+            Type:  NDSourceLinkAddr,
+            Value: packet.CloneBytes(opts.SourceLinkAddr),
+        })
+    }
+
+    if opts.MTU != 0 {
+        value := make([]byte, 6)
+        binary.BigEndian.PutUint32(value[2:], opts.MTU)
+
+        p.Options = append(p.Options, packet.TLV{
+            Type:  NDMTU,
+            Value: value,
+        })
+    }
+
+    for _, prefix := range opts.Prefixes {
+        p.Options = append(p.Options, packet.TLV{
+            Type:  NDPrefixInfo,
+            Value: prefix.encode(),
+        })
+    }
+
+    return p
+}
+
+// Create a Neighbor Advertisement message for the given target address, with
+// the given link-layer address in a Target Link-Layer Address option (unless
+// it's nil).
+func NeighborAdvertisement(target net.IP, hw net.HardwareAddr,
+                           flags NAFlags) *Packet {
+    p := &Packet{
+        Type:       NeighborAdvert,
+        Body:       uint32(flags) << 24,
+        TargetAddr: target,
+    }
+
+    if hw != nil {
+        p.Options = append(p.Options, packet.TLV{
+            Type:  NDTargetLinkAddr,
+            Value: packet.CloneBytes(hw),
+        })
+    }
+
+    return p
+}
+
+// Return the hop limit advertised by a Router Advertisement message.
+func (p *Packet) CurHopLimit() uint8 {
+    return uint8(p.Body >> 24)
+}
+
+// Return the flags of a Router Advertisement message.
+func (p *Packet) RAFlags() RAFlags {
+    return RAFlags(p.Body >> 16) & (Managed | OtherConfig)
+}
+
+// Return the router lifetime (in seconds) of a Router Advertisement message.
+func (p *Packet) RouterLifetime() uint16 {
+    return uint16(p.Body)
+}
+
+// Return the flags of a Neighbor Advertisement message.
+func (p *Packet) NAFlags() NAFlags {
+    return NAFlags(p.Body >> 24) & (NARouter | NASolicited | NAOverride)
+}
+
+// Return the Ethernet address carried by the first option of the given type
+// (e.g. NDSourceLinkAddr), or nil if there is none.
+func (p *Packet) LinkAddr(opt_type uint16) net.HardwareAddr {
+    for _, opt := range p.Options {
+        if opt.Type == opt_type && len(opt.Value) >= 6 {
+            return net.HardwareAddr(opt.Value[:6])
+        }
+    }
+
+    return nil
+}
+
+// Return the prefixes advertised in the Prefix Information options of the
+// message. Malformed options are ignored.
+func (p *Packet) Prefixes() []PrefixInfo {
+    var prefixes []PrefixInfo
+
+    for _, opt := range p.Options {
+        if opt.Type != NDPrefixInfo || len(opt.Value) < 30 {
+            continue
+        }
+
+        bits := int(opt.Value[0])
+        if bits > 128 {
+            continue
+        }
+
+        addr := net.IP(packet.CloneBytes(opt.Value[14:30]))
+
+        prefixes = append(prefixes, PrefixInfo{
+            Prefix: &net.IPNet{
+                IP:   addr,
+                Mask: net.CIDRMask(bits, 128),
+            },
+            OnLink:            opt.Value[1] & 0x80 != 0,
+            Autonomous:        opt.Value[1] & 0x40 != 0,
+            ValidLifetime:     binary.BigEndian.Uint32(opt.Value[2:6]),
+            PreferredLifetime: binary.BigEndian.Uint32(opt.Value[6:10]),
+        })
+    }
+
+    return prefixes
+}
+
+func (i PrefixInfo) encode() []byte {
+    value := make([]byte, 30)
+
+    if i.Prefix != nil {
+        bits, _ := i.Prefix.Mask.Size()
+
+        value[0] = uint8(bits)
+        copy(value[14:], i.Prefix.IP.Mask(i.Prefix.Mask).To16())
+    }
+
+    if i.OnLink {
+        value[1] |= 0x80
+    }
+
+    if i.Autonomous {
+        value[1] |= 0x40
+    }
+
+    binary.BigEndian.PutUint32(value[2:], i.ValidLifetime)
+    binary.BigEndian.PutUint32(value[6:], i.PreferredLifetime)
+
+    return value
+}
+
+func (p *Packet) nd_len() uint16 {
+    var length uint16
+
+    switch p.Type {
+    case RouterAdvert:
+        length = 8
+
+    case NeighborSolicit, NeighborAdvert:
+        length = 16
+
+    default:
+        return 0
+    }
+
+    for _, opt := range p.Options {
+        length += (2 + uint16(len(opt.Value)) + 7) / 8 * 8
+    }
+
+    return length
+}
+
+func (p *Packet) pack_nd(buf *packet.Buffer) error {
+    switch p.Type {
+    case RouterAdvert:
+        buf.WriteN(p.ReachableTime)
+        buf.WriteN(p.RetransTimer)
+
+    case NeighborSolicit, NeighborAdvert:
+        if len(p.TargetAddr.To16()) != 16 {
+            return fmt.Errorf("Invalid target address: %s", p.TargetAddr)
+        }
+
+        buf.Write(p.TargetAddr.To16())
+
+    default:
+        return nil
+    }
+
+    return packet.EncodeTLVUnits(buf, p.Options, 8)
+}
+
+func (p *Packet) unpack_nd(buf *packet.Buffer) error {
+    p.Options = nil
+
+    switch p.Type {
+    case RouterAdvert:
+        buf.ReadN(&p.ReachableTime)
+        buf.ReadN(&p.RetransTimer)
+
+    case NeighborSolicit, NeighborAdvert:
+        if buf.Len() < 16 {
+            return packet.Errorf(packet.ErrTruncated,
+                                 "Invalid neighbor discovery message")
+        }
+
+        p.TargetAddr = net.IP(buf.Next(16))
+
+    default:
+        return nil
+    }
+
+    if buf.Err() != nil {
+        return buf.Err()
+    }
+
+    var err error
+
+    p.Options, err = packet.DecodeTLVUnits(buf.Next(buf.Len()), 8)
+
+    return err
+}
+
+func (f RAFlags) String() string {
+    var flags []string
+
+    if f & Managed != 0 {
+        flags = append(flags, "managed")
+    }
+
+    if f & OtherConfig != 0 {
+        flags = append(flags, "other")
+    }
+
+    return strings.Join(flags, "|")
+}
+
+func (f NAFlags) String() string {
+    var flags []string
+
+    if f & NARouter != 0 {
+        flags = append(flags, "router")
+    }
+
+    if f & NASolicited != 0 {
+        flags = append(flags, "solicited")
+    }
+
+    if f & NAOverride != 0 {
+        flags = append(flags, "override")
+    }
+
+    return strings.Join(flags, "|")
+}
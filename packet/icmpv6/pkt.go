@@ -29,20 +29,42 @@
  */
 
 // Provides encoding and decoding for ICMPv6 packets.
+//
+// Multicast Listener Discovery (MLDv1 and MLDv2) messages are decoded into
+// their multicast address and, for MLDv2 reports, their address records. The
+// additional fields of MLDv2 queries are not decoded. Router Advertisement and
+// Neighbor Solicitation/Advertisement messages are decoded into their fields
+// and Neighbor Discovery options.
 package icmpv6
 
 import "fmt"
+import "net"
 
 import "github.com/adigal150/go.pkt/packet"
-import "github.com/adigal150/go.pkt/packet/ipv4"
 
 type Packet struct {
-    Type      Type
-    Code      Code
-    Checksum  uint16 `string:"sum"`
-    csum_seed uint32 `cmp:"skip" string:"skip"`
-    Body      uint32 `cmp:"skip" string:"skip"`
-    pkt_payload packet.Packet `cmp:"skip" string:"skip"`
+    Type          Type
+    Code          Code
+    Checksum      uint16        `string:"sum"`
+    csum_seed     uint32        `cmp:"skip" string:"skip"`
+    Body          uint32        `cmp:"skip" string:"skip"`
+
+    /* MLD messages only */
+    MulticastAddr net.IP        `string:"mcast"`
+    Records       []MLDRecord   `cmp:"skip" string:"skip"`
+
+    /* Neighbor Discovery messages only */
+    TargetAddr    net.IP        `string:"target"`
+    ReachableTime uint32        `string:"reachable"`
+    RetransTimer  uint32        `string:"retrans"`
+    Options       []packet.TLV  `cmp:"skip" string:"skip"`
+
+    // Encode the Checksum field as-is, instead of computing it from the
+    // packet, e.g. to craft malformed packets.
+    KeepChecksum  bool          `cmp:"skip" string:"skip"`
+
+    pkt_payload   packet.Packet `cmp:"skip" string:"skip"`
+    pkt_raw       []byte        `cmp:"skip" string:"skip"`
 }
 
 type Type uint8
@@ -58,6 +80,14 @@ const (
     Reserved1           = 127
     EchoRequest         = 128
     EchoReply           = 129
+    MLDQuery            = 130
+    MLDReport           = 131
+    MLDDone             = 132
+    RouterSolicit       = 133
+    RouterAdvert        = 134
+    NeighborSolicit     = 135
+    NeighborAdvert      = 136
+    MLDv2Report         = 143
     /* TODO: more types */
 )
 
@@ -76,7 +106,7 @@ func (p *Packet) GetLength() uint16 {
         return p.pkt_payload.GetLength() + 8
     }
 
-    return 8
+    return 8 + p.mld_len() + p.nd_len()
 }
 
 func (p *Packet) Equals(other packet.Packet) bool {
@@ -99,17 +129,31 @@ func (p *Packet) Pack(buf *packet.Buffer) error {
     buf.WriteN(byte(p.Type))
     buf.WriteN(byte(p.Code))
     buf.WriteN(uint16(0x00))
-    buf.WriteN(p.Body)
 
-    if p.csum_seed != 0 {
-        p.Checksum = ipv4.CalculateChecksum(buf.LayerBytes(), p.csum_seed)
+    err := p.pack_mld(buf)
+    if err != nil {
+        return err
+    }
+
+    err = p.pack_nd(buf)
+    if err != nil {
+        return err
+    }
+
+    if p.csum_seed != 0 && !p.KeepChecksum {
+        p.Checksum = packet.Checksum(buf.LayerBytes(), p.csum_seed)
+    }
+
+    if p.csum_seed != 0 || p.KeepChecksum {
         buf.PutUint16N(2, p.Checksum)
     }
 
-    return nil
+    return buf.Err()
 }
 
 func (p *Packet) Unpack(buf *packet.Buffer) error {
+    p.pkt_raw = buf.Bytes()
+
     buf.ReadN(&p.Type)
     buf.ReadN(&p.Code)
     buf.ReadN(&p.Checksum)
@@ -117,13 +161,30 @@ func (p *Packet) Unpack(buf *packet.Buffer) error {
     /* TODO: data */
     buf.ReadN(&p.Body)
 
-    return nil
+    if buf.Err() != nil {
+        return buf.Err()
+    }
+
+    err := p.unpack_mld(buf)
+    if err != nil {
+        return err
+    }
+
+    return p.unpack_nd(buf)
 }
 
 func (p *Packet) Payload() packet.Packet {
     return p.pkt_payload
 }
 
+func (p *Packet) RawBytes() []byte {
+    return p.pkt_raw
+}
+
+func (p *Packet) HeaderBytes() []byte {
+    return packet.HeaderBytes(p)
+}
+
 func (p *Packet) GuessPayloadType() packet.Type {
     switch p.Type {
     case DstUnreachable, PacketTooBig, TimeExceeded, ParamProblem:
@@ -146,10 +207,27 @@ func (p *Packet) InitChecksum(csum uint32) {
     p.csum_seed = csum
 }
 
+func (p *Packet) Clone() packet.Packet {
+    c := *p
+
+    c.MulticastAddr = packet.CloneBytes(p.MulticastAddr)
+    c.Records       = clone_mld_records(p.Records)
+    c.TargetAddr    = packet.CloneBytes(p.TargetAddr)
+    c.Options       = packet.CloneTLVs(p.Options)
+    c.pkt_payload   = packet.ClonePayload(p.pkt_payload)
+
+    return &c
+}
+
 func (p *Packet) String() string {
     return packet.Stringify(p)
 }
 
+// Return the name of the message type and code (see TypeName()).
+func (p *Packet) Summary() string {
+    return TypeName(p.Type, p.Code)
+}
+
 func (t Type) String() string {
     switch t {
     case DstUnreachable:    return "dst-unreach"
@@ -158,6 +236,14 @@ func (t Type) String() string {
     case ParamProblem:      return "param-problem"
     case EchoRequest:       return "echo-request"
     case EchoReply:         return "echo-reply"
+    case MLDQuery:          return "mld-query"
+    case MLDReport:         return "mld-report"
+    case MLDDone:           return "mld-done"
+    case RouterSolicit:     return "router-solicit"
+    case RouterAdvert:      return "router-advert"
+    case NeighborSolicit:   return "neighbor-solicit"
+    case NeighborAdvert:    return "neighbor-advert"
+    case MLDv2Report:       return "mldv2-report"
     default:                return "unknown"
     }
 }
@@ -32,10 +32,12 @@ package icmpv6_test
 
 import "bytes"
 import "net"
+import "strings"
 import "testing"
 
 import "github.com/adigal150/go.pkt/packet"
 import "github.com/adigal150/go.pkt/packet/icmpv6"
+import "github.com/adigal150/go.pkt/packet/igmp"
 import "github.com/adigal150/go.pkt/packet/ipv6"
 
 var test_simple = []byte{
@@ -150,3 +152,213 @@ func TestUnpackWithIPv6(t *testing.T) {
         t.Fatalf("Packet mismatch:\n%s\n%s", &p, cmp)
     }
 }
+
+var test_mld_report = []byte{
+    0x83, 0x00, 0x80, 0x1d, 0x00, 0x00, 0x00, 0x00, 0xff, 0x02, 0x00, 0x00,
+    0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x01, 0x00, 0x03,
+}
+
+var test_mldv2_report = []byte{
+    0x8f, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x01, 0x01, 0x00, 0x00, 0x01,
+    0xff, 0x05, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00,
+    0x00, 0x01, 0x00, 0x03, 0x20, 0x01, 0x0d, 0xb8, 0x00, 0x00, 0x00, 0x00,
+    0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x01,
+}
+
+func MakeTestMLDReport() *icmpv6.Packet {
+    return &icmpv6.Packet{
+        Type: icmpv6.MLDReport,
+        MulticastAddr: net.ParseIP("ff02::1:3"),
+    }
+}
+
+func TestPackMLDReport(t *testing.T) {
+    var b packet.Buffer
+    b.Init(make([]byte, len(test_mld_report)))
+
+    ip6 := ipv6.Make()
+    ip6.SrcAddr = net.ParseIP("fe80::1")
+    ip6.DstAddr = net.ParseIP("ff02::1:3")
+
+    p := MakeTestMLDReport()
+
+    ip6.SetPayload(p)
+
+    err := p.Pack(&b)
+    if err != nil {
+        t.Fatalf("Error packing: %s", err)
+    }
+
+    if !bytes.Equal(test_mld_report, b.Buffer()) {
+        t.Fatalf("Raw packet mismatch: %x", b.Buffer())
+    }
+}
+
+func TestUnpackMLDReport(t *testing.T) {
+    var p icmpv6.Packet
+
+    cmp := MakeTestMLDReport()
+    cmp.Checksum = 0x801d
+
+    var b packet.Buffer
+    b.Init(test_mld_report)
+
+    err := p.Unpack(&b)
+    if err != nil {
+        t.Fatalf("Error unpacking: %s", err)
+    }
+
+    if !p.Equals(cmp) {
+        t.Fatalf("Packet mismatch:\n%s\n%s", &p, cmp)
+    }
+}
+
+func TestPackUnpackMLDv2Report(t *testing.T) {
+    p := &icmpv6.Packet{
+        Type: icmpv6.MLDv2Report,
+        Records: []icmpv6.MLDRecord{
+            { Type: igmp.ModeIsInclude,
+              MulticastAddr: net.ParseIP("ff05::1:3"),
+              Sources: []net.IP{ net.ParseIP("2001:db8::1") } },
+        },
+    }
+
+    if p.GetLength() != uint16(len(test_mldv2_report)) {
+        t.Fatalf("Length mismatch: %d", p.GetLength())
+    }
+
+    var b packet.Buffer
+    b.Init(make([]byte, len(test_mldv2_report)))
+
+    err := p.Pack(&b)
+    if err != nil {
+        t.Fatalf("Error packing: %s", err)
+    }
+
+    if !bytes.Equal(test_mldv2_report, b.Buffer()) {
+        t.Fatalf("Raw packet mismatch: %x", b.Buffer())
+    }
+
+    var q icmpv6.Packet
+
+    b.Init(test_mldv2_report)
+
+    err = q.Unpack(&b)
+    if err != nil {
+        t.Fatalf("Error unpacking: %s", err)
+    }
+
+    if len(q.Records) != 1 ||
+       q.Records[0].Type != igmp.ModeIsInclude ||
+       !q.Records[0].MulticastAddr.Equal(net.ParseIP("ff05::1:3")) ||
+       len(q.Records[0].Sources) != 1 ||
+       !q.Records[0].Sources[0].Equal(net.ParseIP("2001:db8::1")) {
+        t.Fatalf("Records mismatch: %v", q.Records)
+    }
+}
+
+var test_router_advert = []byte{
+    0x86, 0x00, 0x2e, 0xa2, 0x40, 0x40, 0x07, 0x08, 0x00, 0x00, 0x00, 0x00,
+    0x00, 0x00, 0x00, 0x00, 0x05, 0x01, 0x00, 0x00, 0x00, 0x00, 0x05, 0xdc,
+    0x03, 0x04, 0x40, 0xc0, 0x00, 0x01, 0x51, 0x80, 0x00, 0x00, 0x38, 0x40,
+    0x00, 0x00, 0x00, 0x00, 0x20, 0x01, 0x0d, 0xb8, 0x00, 0x01, 0x00, 0x00,
+    0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00,
+}
+
+func TestPackUnpackRouterAdvertisement(t *testing.T) {
+    _, prefix, _ := net.ParseCIDR("2001:db8:1::/64")
+
+    p := icmpv6.RouterAdvertisement(icmpv6.RAOptions{
+        CurHopLimit:    64,
+        Flags:          icmpv6.OtherConfig,
+        RouterLifetime: 1800,
+        MTU:            1500,
+        Prefixes: []icmpv6.PrefixInfo{
+            { Prefix: prefix, OnLink: true, Autonomous: true,
+              ValidLifetime: 86400, PreferredLifetime: 14400 },
+        },
+    })
+
+    if p.GetLength() != uint16(len(test_router_advert)) {
+        t.Fatalf("Length mismatch: %d", p.GetLength())
+    }
+
+    ip6 := ipv6.Make()
+    ip6.SrcAddr = net.ParseIP("fe80::1")
+    ip6.DstAddr = net.ParseIP("ff02::1")
+
+    ip6.SetPayload(p)
+
+    var b packet.Buffer
+    b.Init(make([]byte, len(test_router_advert)))
+
+    err := p.Pack(&b)
+    if err != nil {
+        t.Fatalf("Error packing: %s", err)
+    }
+
+    if !bytes.Equal(test_router_advert, b.Buffer()) {
+        t.Fatalf("Raw packet mismatch: %x", b.Buffer())
+    }
+
+    var q icmpv6.Packet
+
+    b.Init(test_router_advert)
+
+    err = q.Unpack(&b)
+    if err != nil {
+        t.Fatalf("Error unpacking: %s", err)
+    }
+
+    if q.CurHopLimit() != 64 || q.RAFlags() != icmpv6.OtherConfig ||
+       q.RouterLifetime() != 1800 || len(q.Options) != 2 {
+        t.Fatalf("Packet mismatch: %s", &q)
+    }
+
+    prefixes := q.Prefixes()
+    if len(prefixes) != 1 ||
+       prefixes[0].Prefix.String() != "2001:db8:1::/64" ||
+       !prefixes[0].OnLink || !prefixes[0].Autonomous ||
+       prefixes[0].ValidLifetime != 86400 ||
+       prefixes[0].PreferredLifetime != 14400 {
+        t.Fatalf("Prefixes mismatch: %v", prefixes)
+    }
+}
+
+func TestTypeName(t *testing.T) {
+    names := []struct {
+        t    icmpv6.Type
+        code icmpv6.Code
+        name string
+    }{
+        { icmpv6.EchoRequest, 0, "Echo Request" },
+        { icmpv6.EchoReply, 0, "Echo Reply" },
+        { icmpv6.DstUnreachable, 0,
+          "Destination Unreachable (No route to destination)" },
+        { icmpv6.DstUnreachable, 3,
+          "Destination Unreachable (Address unreachable)" },
+        { icmpv6.DstUnreachable, 4,
+          "Destination Unreachable (Port unreachable)" },
+        { icmpv6.DstUnreachable, 42, "Destination Unreachable (Code 42)" },
+        { icmpv6.TimeExceeded, 0,
+          "Time Exceeded (Hop limit exceeded in transit)" },
+        { icmpv6.TimeExceeded, 1,
+          "Time Exceeded (Fragment reassembly time exceeded)" },
+        { icmpv6.PacketTooBig, 0, "Packet Too Big" },
+        { 42, 0, "Type 42" },
+    }
+
+    for _, n := range names {
+        name := icmpv6.TypeName(n.t, n.code)
+        if name != n.name {
+            t.Fatalf("Name mismatch: %s", name)
+        }
+    }
+
+    p := MakeTestSimple()
+
+    s := "icmpv6(Echo Request, type=echo-request"
+    if !strings.HasPrefix(p.String(), s) {
+        t.Fatalf("String mismatch: %s", p.String())
+    }
+}
@@ -0,0 +1,305 @@
+/*
+ * Network packet analysis framework.
+ *
+ * Copyright (c) 2014, Alessandro Ghedini
+ * All rights reserved.
+ *
+ * Redistribution and use in source and binary forms, with or without
+ * modification, are permitted provided that the following conditions are
+ * met:
+ *
+ *     * Redistributions of source code must retain the above copyright
+ *       notice, this list of conditions and the following disclaimer.
+ *
+ *     * Redistributions in binary form must reproduce the above copyright
+ *       notice, this list of conditions and the following disclaimer in the
+ *       documentation and/or other materials provided with the distribution.
+ *
+ * THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS
+ * IS" AND ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO,
+ * THE IMPLIED WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR
+ * PURPOSE ARE DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT HOLDER OR
+ * CONTRIBUTORS BE LIABLE FOR ANY DIRECT, INDIRECT, INCIDENTAL, SPECIAL,
+ * EXEMPLARY, OR CONSEQUENTIAL DAMAGES (INCLUDING, BUT NOT LIMITED TO,
+ * PROCUREMENT OF SUBSTITUTE GOODS OR SERVICES; LOSS OF USE, DATA, OR
+ * PROFITS; OR BUSINESS INTERRUPTION) HOWEVER CAUSED AND ON ANY THEORY OF
+ * LIABILITY, WHETHER IN CONTRACT, STRICT LIABILITY, OR TORT (INCLUDING
+ * NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE OF THIS
+ * SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+ */
+
+// Provides encoding and decoding for IGMP (v1, v2 and v3) packets.
+//
+// IGMPv3 membership reports are decoded into their group records. The
+// additional fields of IGMPv3 queries are not decoded.
+package igmp
+
+import "fmt"
+import "net"
+
+import "github.com/adigal150/go.pkt/packet"
+
+type Packet struct {
+    Type        Type
+    MaxRespTime uint8    `string:"mrt"`
+    Checksum    uint16   `string:"sum"`
+    GroupAddr   net.IP   `string:"group"`
+
+    /* IGMPv3 membership reports only */
+    Records     []Record `cmp:"skip" string:"skip"`
+
+    pkt_raw     []byte   `cmp:"skip" string:"skip"`
+}
+
+type Type uint8
+
+const (
+    MembershipQuery Type = 0x11
+    V1Report             = 0x12
+    V2Report             = 0x16
+    LeaveGroup           = 0x17
+    V3Report             = 0x22
+)
+
+// A group record of an IGMPv3 membership report.
+type Record struct {
+    Type      RecordType
+    GroupAddr net.IP
+    Sources   []net.IP
+    AuxData   []byte
+}
+
+type RecordType uint8
+
+const (
+    ModeIsInclude   RecordType = 1
+    ModeIsExclude              = 2
+    ChangeToInclude            = 3
+    ChangeToExclude            = 4
+    AllowNewSources            = 5
+    BlockOldSources            = 6
+)
+
+func Make() *Packet {
+    return &Packet{
+        Type: V2Report,
+    }
+}
+
+func (p *Packet) GetType() packet.Type {
+    return packet.IGMP
+}
+
+func (p *Packet) GetLength() uint16 {
+    length := uint16(8)
+
+    if p.Type == V3Report {
+        for _, r := range p.Records {
+            length += 8 + uint16(len(r.Sources)) * 4 + uint16(len(r.AuxData))
+        }
+    }
+
+    return length
+}
+
+func (p *Packet) Equals(other packet.Packet) bool {
+    return packet.Compare(p, other)
+}
+
+func (p *Packet) Answers(other packet.Packet) bool {
+    if other == nil || other.GetType() != packet.IGMP {
+        return false
+    }
+
+    q := other.(*Packet)
+
+    if q.Type != MembershipQuery ||
+       (p.Type != V1Report && p.Type != V2Report && p.Type != V3Report) {
+        return false
+    }
+
+    /* general queries are answered by any report */
+    if q.GroupAddr == nil || q.GroupAddr.IsUnspecified() {
+        return true
+    }
+
+    return q.GroupAddr.Equal(p.GroupAddr)
+}
+
+func (p *Packet) Pack(buf *packet.Buffer) error {
+    buf.WriteN(p.Type)
+
+    if p.Type == V3Report {
+        buf.WriteN(uint8(0))
+        buf.WriteN(uint16(0))
+        buf.WriteN(uint16(0))
+        buf.WriteN(uint16(len(p.Records)))
+
+        for _, r := range p.Records {
+            if len(r.AuxData) % 4 != 0 {
+                return fmt.Errorf("Invalid IGMP aux data length: %d",
+                                  len(r.AuxData))
+            }
+
+            buf.WriteN(r.Type)
+            buf.WriteN(uint8(len(r.AuxData) / 4))
+            buf.WriteN(uint16(len(r.Sources)))
+            buf.Write(r.GroupAddr.To4())
+
+            for _, src := range r.Sources {
+                buf.Write(src.To4())
+            }
+
+            buf.Write(r.AuxData)
+        }
+    } else {
+        buf.WriteN(p.MaxRespTime)
+        buf.WriteN(uint16(0))
+        buf.Write(p.GroupAddr.To4())
+    }
+
+    if buf.Err() != nil {
+        return buf.Err()
+    }
+
+    p.Checksum = packet.Checksum(buf.LayerBytes()[:p.GetLength()], 0)
+    buf.PutUint16N(2, p.Checksum)
+
+    return buf.Err()
+}
+
+func (p *Packet) Unpack(buf *packet.Buffer) error {
+    p.pkt_raw = buf.Bytes()
+
+    if buf.Len() < 8 {
+        return packet.Errorf(packet.ErrTruncated, "Invalid IGMP message")
+    }
+
+    buf.ReadN(&p.Type)
+    buf.ReadN(&p.MaxRespTime)
+    buf.ReadN(&p.Checksum)
+
+    if p.Type != V3Report {
+        p.GroupAddr = net.IP(buf.Next(4))
+
+        return buf.Err()
+    }
+
+    var count uint16
+
+    buf.Next(2)
+    buf.ReadN(&count)
+
+    p.Records = nil
+
+    for i := 0; i < int(count); i++ {
+        if buf.Len() < 8 {
+            return packet.Errorf(packet.ErrTruncated,
+                                 "Invalid IGMP group record")
+        }
+
+        var r Record
+        var aux_len uint8
+        var sources uint16
+
+        buf.ReadN(&r.Type)
+        buf.ReadN(&aux_len)
+        buf.ReadN(&sources)
+
+        r.GroupAddr = net.IP(buf.Next(4))
+
+        if buf.Len() < int(sources) * 4 + int(aux_len) * 4 {
+            return packet.Errorf(packet.ErrTruncated,
+                                 "Invalid IGMP group record")
+        }
+
+        for j := 0; j < int(sources); j++ {
+            r.Sources = append(r.Sources, net.IP(buf.Next(4)))
+        }
+
+        r.AuxData = buf.Next(int(aux_len) * 4)
+
+        p.Records = append(p.Records, r)
+    }
+
+    return buf.Err()
+}
+
+func (p *Packet) Payload() packet.Packet {
+    return nil
+}
+
+func (p *Packet) RawBytes() []byte {
+    return p.pkt_raw
+}
+
+func (p *Packet) HeaderBytes() []byte {
+    return packet.HeaderBytes(p)
+}
+
+func (p *Packet) GuessPayloadType() packet.Type {
+    return packet.None
+}
+
+func (p *Packet) SetPayload(pl packet.Packet) error {
+    return nil
+}
+
+func (p *Packet) InitChecksum(csum uint32) {
+}
+
+func (p *Packet) Clone() packet.Packet {
+    c := *p
+
+    c.GroupAddr = packet.CloneBytes(p.GroupAddr)
+    c.Records   = clone_records(p.Records)
+
+    return &c
+}
+
+func (p *Packet) String() string {
+    return packet.Stringify(p)
+}
+
+func (t Type) String() string {
+    switch t {
+    case MembershipQuery: return "query"
+    case V1Report:        return "v1-report"
+    case V2Report:        return "v2-report"
+    case LeaveGroup:      return "leave"
+    case V3Report:        return "v3-report"
+    default:              return fmt.Sprintf("0x%x", uint8(t))
+    }
+}
+
+func clone_records(records []Record) []Record {
+    if records == nil {
+        return nil
+    }
+
+    clone := make([]Record, len(records))
+
+    for i, rec := range records {
+        rec.GroupAddr = packet.CloneBytes(rec.GroupAddr)
+        rec.Sources   = clone_addrs(rec.Sources)
+        rec.AuxData   = packet.CloneBytes(rec.AuxData)
+
+        clone[i] = rec
+    }
+
+    return clone
+}
+
+func clone_addrs(addrs []net.IP) []net.IP {
+    if addrs == nil {
+        return nil
+    }
+
+    clone := make([]net.IP, len(addrs))
+
+    for i, addr := range addrs {
+        clone[i] = packet.CloneBytes(addr)
+    }
+
+    return clone
+}
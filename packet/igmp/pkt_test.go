@@ -0,0 +1,167 @@
+/*
+ * Network packet analysis framework.
+ *
+ * Copyright (c) 2014, Alessandro Ghedini
+ * All rights reserved.
+ *
+ * Redistribution and use in source and binary forms, with or without
+ * modification, are permitted provided that the following conditions are
+ * met:
+ *
+ *     * Redistributions of source code must retain the above copyright
+ *       notice, this list of conditions and the following disclaimer.
+ *
+ *     * Redistributions in binary form must reproduce the above copyright
+ *       notice, this list of conditions and the following disclaimer in the
+ *       documentation and/or other materials provided with the distribution.
+ *
+ * THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS
+ * IS" AND ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO,
+ * THE IMPLIED WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR
+ * PURPOSE ARE DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT HOLDER OR
+ * CONTRIBUTORS BE LIABLE FOR ANY DIRECT, INDIRECT, INCIDENTAL, SPECIAL,
+ * EXEMPLARY, OR CONSEQUENTIAL DAMAGES (INCLUDING, BUT NOT LIMITED TO,
+ * PROCUREMENT OF SUBSTITUTE GOODS OR SERVICES; LOSS OF USE, DATA, OR
+ * PROFITS; OR BUSINESS INTERRUPTION) HOWEVER CAUSED AND ON ANY THEORY OF
+ * LIABILITY, WHETHER IN CONTRACT, STRICT LIABILITY, OR TORT (INCLUDING
+ * NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE OF THIS
+ * SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+ */
+
+package igmp_test
+
+import "bytes"
+import "net"
+import "testing"
+
+import "github.com/adigal150/go.pkt/packet"
+import "github.com/adigal150/go.pkt/packet/igmp"
+
+var test_simple = []byte{
+    0x16, 0x64, 0xf8, 0x96, 0xef, 0x01, 0x02, 0x03,
+}
+
+var test_v3_report = []byte{
+    0x22, 0x00, 0xec, 0xf0, 0x00, 0x00, 0x00, 0x02, 0x04, 0x00, 0x00, 0x00,
+    0xef, 0x01, 0x02, 0x03, 0x01, 0x00, 0x00, 0x01, 0xef, 0x01, 0x02, 0x04,
+    0x0a, 0x00, 0x00, 0x01,
+}
+
+func MakeTestSimple() *igmp.Packet {
+    return &igmp.Packet{
+        Type: igmp.V2Report,
+        MaxRespTime: 100,
+        GroupAddr: net.ParseIP("239.1.2.3"),
+    }
+}
+
+func TestPack(t *testing.T) {
+    var b packet.Buffer
+    b.Init(make([]byte, len(test_simple)))
+
+    p := MakeTestSimple()
+
+    err := p.Pack(&b)
+    if err != nil {
+        t.Fatalf("Error packing: %s", err)
+    }
+
+    if !bytes.Equal(test_simple, b.Buffer()) {
+        t.Fatalf("Raw packet mismatch: %x", b.Buffer())
+    }
+}
+
+func BenchmarkPack(bn *testing.B) {
+    var b packet.Buffer
+    b.Init(make([]byte, len(test_simple)))
+
+    p := MakeTestSimple()
+
+    for n := 0; n < bn.N; n++ {
+        p.Pack(&b)
+    }
+}
+
+func TestUnpack(t *testing.T) {
+    var p igmp.Packet
+
+    cmp := MakeTestSimple()
+    cmp.Checksum = 0xf896
+
+    var b packet.Buffer
+    b.Init(test_simple)
+
+    err := p.Unpack(&b)
+    if err != nil {
+        t.Fatalf("Error unpacking: %s", err)
+    }
+
+    if !p.Equals(cmp) {
+        t.Fatalf("Packet mismatch:\n%s\n%s", &p, cmp)
+    }
+}
+
+func BenchmarkUnpack(bn *testing.B) {
+    var p igmp.Packet
+    var b packet.Buffer
+
+    for n := 0; n < bn.N; n++ {
+        b.Init(test_simple)
+        p.Unpack(&b)
+    }
+}
+
+func TestPackUnpackV3Report(t *testing.T) {
+    p := &igmp.Packet{
+        Type: igmp.V3Report,
+        Records: []igmp.Record{
+            { Type: igmp.ChangeToExclude,
+              GroupAddr: net.ParseIP("239.1.2.3") },
+            { Type: igmp.ModeIsInclude,
+              GroupAddr: net.ParseIP("239.1.2.4"),
+              Sources: []net.IP{ net.ParseIP("10.0.0.1") } },
+        },
+    }
+
+    var b packet.Buffer
+    b.Init(make([]byte, len(test_v3_report)))
+
+    err := p.Pack(&b)
+    if err != nil {
+        t.Fatalf("Error packing: %s", err)
+    }
+
+    if !bytes.Equal(test_v3_report, b.Buffer()) {
+        t.Fatalf("Raw packet mismatch: %x", b.Buffer())
+    }
+
+    var q igmp.Packet
+
+    b.Init(test_v3_report)
+
+    err = q.Unpack(&b)
+    if err != nil {
+        t.Fatalf("Error unpacking: %s", err)
+    }
+
+    if len(q.Records) != 2 ||
+       q.Records[0].Type != igmp.ChangeToExclude ||
+       !q.Records[1].GroupAddr.Equal(net.ParseIP("239.1.2.4")) ||
+       len(q.Records[1].Sources) != 1 {
+        t.Fatalf("Records mismatch: %v", q.Records)
+    }
+}
+
+func TestAnswers(t *testing.T) {
+    q := &igmp.Packet{ Type: igmp.MembershipQuery }
+
+    if !MakeTestSimple().Answers(q) {
+        t.Fatalf("Report doesn't answer general query")
+    }
+
+    q.GroupAddr = net.ParseIP("239.9.9.9")
+
+    if MakeTestSimple().Answers(q) {
+        t.Fatalf("Report answers query for other group")
+    }
+}
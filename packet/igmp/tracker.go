@@ -0,0 +1,213 @@
+/*
+ * Network packet analysis framework.
+ *
+ * Copyright (c) 2014, Alessandro Ghedini
+ * All rights reserved.
+ *
+ * Redistribution and use in source and binary forms, with or without
+ * modification, are permitted provided that the following conditions are
+ * met:
+ *
+ *     * Redistributions of source code must retain the above copyright
+ *       notice, this list of conditions and the following disclaimer.
+ *
+ *     * Redistributions in binary form must reproduce the above copyright
+ *       notice, this list of conditions and the following disclaimer in the
+ *       documentation and/or other materials provided with the distribution.
+ *
+ * THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS
+ * IS" AND ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO,
+ * THE IMPLIED WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR
+ * PURPOSE ARE DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT HOLDER OR
+ * CONTRIBUTORS BE LIABLE FOR ANY DIRECT, INDIRECT, INCIDENTAL, SPECIAL,
+ * EXEMPLARY, OR CONSEQUENTIAL DAMAGES (INCLUDING, BUT NOT LIMITED TO,
+ * PROCUREMENT OF SUBSTITUTE GOODS OR SERVICES; LOSS OF USE, DATA, OR
+ * PROFITS; OR BUSINESS INTERRUPTION) HOWEVER CAUSED AND ON ANY THEORY OF
+ * LIABILITY, WHETHER IN CONTRACT, STRICT LIABILITY, OR TORT (INCLUDING
+ * NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE OF THIS
+ * SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+ */
+
+package igmp
+
+import "bytes"
+import "net"
+import "sort"
+import "sync"
+import "time"
+
+import "github.com/adigal150/go.pkt/packet"
+import "github.com/adigal150/go.pkt/packet/ipv4"
+
+// GroupTracker keeps track of the multicast group memberships announced by the
+// hosts of a network, as seen from observed IGMP reports and leaves, e.g. to
+// verify the behavior of IGMP snooping switches. It is safe for concurrent use.
+type GroupTracker struct {
+    mutex   sync.Mutex
+    members map[string]Membership
+    joins   []Membership
+    leaves  []Membership
+}
+
+// A membership of a host to a multicast group, and the time it was announced
+// (or revoked) at.
+type Membership struct {
+    Group net.IP
+    Host  net.IP
+    Time  time.Time
+}
+
+// Create a new, empty, group tracker.
+func NewGroupTracker() *GroupTracker {
+    return &GroupTracker{
+        members: map[string]Membership{},
+    }
+}
+
+// Update the memberships according to the IGMP message carried by the given
+// packet, at the current time. See ObserveAt().
+func (t *GroupTracker) Observe(pkt packet.Packet) {
+    t.ObserveAt(pkt, time.Now())
+}
+
+// Update the memberships according to the IGMP message carried by the given
+// packet (which must include the IPv4 layer, to identify the sending host), as
+// seen at the given time (e.g. the timestamp of a captured packet). Packets
+// that don't carry IGMP reports or leaves are ignored.
+//
+// IGMPv3 records that exclude sources are handled as joins, and records that
+// include no sources as leaves.
+func (t *GroupTracker) ObserveAt(pkt packet.Packet, ts time.Time) {
+    var host net.IP
+    var msg *Packet
+
+    for ; pkt != nil; pkt = pkt.Payload() {
+        switch p := pkt.(type) {
+        case *ipv4.Packet:
+            host = p.SrcAddr
+
+        case *Packet:
+            msg = p
+        }
+    }
+
+    if host == nil || msg == nil {
+        return
+    }
+
+    t.mutex.Lock()
+    defer t.mutex.Unlock()
+
+    switch msg.Type {
+    case V1Report, V2Report:
+        t.join(msg.GroupAddr, host, ts)
+
+    case LeaveGroup:
+        t.leave(msg.GroupAddr, host, ts)
+
+    case V3Report:
+        for _, r := range msg.Records {
+            switch r.Type {
+            case ModeIsExclude, ChangeToExclude:
+                t.join(r.GroupAddr, host, ts)
+
+            case ModeIsInclude, ChangeToInclude, AllowNewSources:
+                if len(r.Sources) > 0 {
+                    t.join(r.GroupAddr, host, ts)
+                } else if r.Type != AllowNewSources {
+                    t.leave(r.GroupAddr, host, ts)
+                }
+            }
+        }
+    }
+}
+
+// Return the current members of the given group.
+func (t *GroupTracker) Members(group net.IP) []net.IP {
+    var hosts []net.IP
+
+    for _, m := range t.Memberships() {
+        if m.Group.Equal(group) {
+            hosts = append(hosts, m.Host)
+        }
+    }
+
+    return hosts
+}
+
+// Return the current memberships, ordered by group and host address.
+func (t *GroupTracker) Memberships() []Membership {
+    t.mutex.Lock()
+    defer t.mutex.Unlock()
+
+    var members []Membership
+
+    for _, m := range t.members {
+        members = append(members, m)
+    }
+
+    sort.Slice(members, func(i, j int) bool {
+        cmp := bytes.Compare(members[i].Group.To16(), members[j].Group.To16())
+        if cmp != 0 {
+            return cmp < 0
+        }
+
+        return bytes.Compare(members[i].Host.To16(), members[j].Host.To16()) < 0
+    })
+
+    return members
+}
+
+// Return the groups joined so far, oldest first. Reports for memberships that
+// are already known are not included.
+func (t *GroupTracker) Joins() []Membership {
+    t.mutex.Lock()
+    defer t.mutex.Unlock()
+
+    return append([]Membership(nil), t.joins...)
+}
+
+// Return the groups left so far, oldest first. Leaves for unknown memberships
+// are not included.
+func (t *GroupTracker) Leaves() []Membership {
+    t.mutex.Lock()
+    defer t.mutex.Unlock()
+
+    return append([]Membership(nil), t.leaves...)
+}
+
+func (t *GroupTracker) join(group, host net.IP, ts time.Time) {
+    if group == nil || group.IsUnspecified() {
+        return
+    }
+
+    key := string(group.To16()) + string(host.To16())
+
+    /* the addresses may alias the capture buffer, so copy them */
+    m := Membership{
+        Group: append(net.IP(nil), group...),
+        Host:  append(net.IP(nil), host...),
+        Time:  ts,
+    }
+
+    if _, ok := t.members[key]; !ok {
+        t.joins = append(t.joins, m)
+    }
+
+    t.members[key] = m
+}
+
+func (t *GroupTracker) leave(group, host net.IP, ts time.Time) {
+    key := string(group.To16()) + string(host.To16())
+
+    m, ok := t.members[key]
+    if !ok {
+        return
+    }
+
+    m.Time = ts
+
+    t.leaves = append(t.leaves, m)
+
+    delete(t.members, key)
+}
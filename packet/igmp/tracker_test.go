@@ -0,0 +1,125 @@
+/*
+ * Network packet analysis framework.
+ *
+ * Copyright (c) 2014, Alessandro Ghedini
+ * All rights reserved.
+ *
+ * Redistribution and use in source and binary forms, with or without
+ * modification, are permitted provided that the following conditions are
+ * met:
+ *
+ *     * Redistributions of source code must retain the above copyright
+ *       notice, this list of conditions and the following disclaimer.
+ *
+ *     * Redistributions in binary form must reproduce the above copyright
+ *       notice, this list of conditions and the following disclaimer in the
+ *       documentation and/or other materials provided with the distribution.
+ *
+ * THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS
+ * IS" AND ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO,
+ * THE IMPLIED WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR
+ * PURPOSE ARE DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT HOLDER OR
+ * CONTRIBUTORS BE LIABLE FOR ANY DIRECT, INDIRECT, INCIDENTAL, SPECIAL,
+ * EXEMPLARY, OR CONSEQUENTIAL DAMAGES (INCLUDING, BUT NOT LIMITED TO,
+ * PROCUREMENT OF SUBSTITUTE GOODS OR SERVICES; LOSS OF USE, DATA, OR
+ * PROFITS; OR BUSINESS INTERRUPTION) HOWEVER CAUSED AND ON ANY THEORY OF
+ * LIABILITY, WHETHER IN CONTRACT, STRICT LIABILITY, OR TORT (INCLUDING
+ * NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE OF THIS
+ * SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+ */
+
+package igmp_test
+
+import "net"
+import "testing"
+import "time"
+
+import "github.com/adigal150/go.pkt/packet/igmp"
+import "github.com/adigal150/go.pkt/packet/ipv4"
+
+func make_msg(msg_type igmp.Type, group, host string) *ipv4.Packet {
+    ip := ipv4.Make()
+    ip.SrcAddr = net.ParseIP(host)
+    ip.DstAddr = net.ParseIP(group)
+
+    p := igmp.Make()
+    p.Type = msg_type
+    p.GroupAddr = net.ParseIP(group)
+
+    ip.SetPayload(p)
+
+    return ip
+}
+
+func TestGroupTracker(t *testing.T) {
+    tr := igmp.NewGroupTracker()
+
+    ts := time.Unix(1000, 0)
+
+    tr.ObserveAt(make_msg(igmp.V2Report, "239.1.1.1", "10.0.0.1"), ts)
+    tr.ObserveAt(make_msg(igmp.V2Report, "239.1.1.1", "10.0.0.2"), ts)
+    tr.ObserveAt(make_msg(igmp.V2Report, "239.2.2.2", "10.0.0.1"), ts)
+
+    /* refresh of a known membership */
+    tr.ObserveAt(make_msg(igmp.V2Report, "239.1.1.1", "10.0.0.1"), ts)
+
+    tr.ObserveAt(make_msg(igmp.LeaveGroup, "239.1.1.1", "10.0.0.1"),
+                 ts.Add(time.Second))
+
+    /* leave of an unknown membership */
+    tr.ObserveAt(make_msg(igmp.LeaveGroup, "239.3.3.3", "10.0.0.1"), ts)
+
+    if len(tr.Joins()) != 3 {
+        t.Fatalf("Joins mismatch: %v", tr.Joins())
+    }
+
+    leaves := tr.Leaves()
+    if len(leaves) != 1 ||
+       !leaves[0].Host.Equal(net.ParseIP("10.0.0.1")) ||
+       !leaves[0].Time.Equal(ts.Add(time.Second)) {
+        t.Fatalf("Leaves mismatch: %v", leaves)
+    }
+
+    members := tr.Members(net.ParseIP("239.1.1.1"))
+    if len(members) != 1 || !members[0].Equal(net.ParseIP("10.0.0.2")) {
+        t.Fatalf("Members mismatch: %v", members)
+    }
+
+    all := tr.Memberships()
+    if len(all) != 2 ||
+       !all[0].Group.Equal(net.ParseIP("239.1.1.1")) ||
+       !all[1].Group.Equal(net.ParseIP("239.2.2.2")) {
+        t.Fatalf("Memberships mismatch: %v", all)
+    }
+}
+
+func TestGroupTrackerV3(t *testing.T) {
+    tr := igmp.NewGroupTracker()
+
+    ip := ipv4.Make()
+    ip.SrcAddr = net.ParseIP("10.0.0.1")
+
+    report := &igmp.Packet{
+        Type: igmp.V3Report,
+        Records: []igmp.Record{
+            { Type: igmp.ChangeToExclude,
+              GroupAddr: net.ParseIP("239.1.1.1") },
+            { Type: igmp.ChangeToExclude,
+              GroupAddr: net.ParseIP("239.2.2.2") },
+        },
+    }
+
+    ip.SetPayload(report)
+    tr.Observe(ip)
+
+    report.Records = []igmp.Record{
+        { Type: igmp.ChangeToInclude, GroupAddr: net.ParseIP("239.2.2.2") },
+    }
+
+    tr.Observe(ip)
+
+    all := tr.Memberships()
+    if len(all) != 1 || !all[0].Group.Equal(net.ParseIP("239.1.1.1")) {
+        t.Fatalf("Memberships mismatch: %v", all)
+    }
+}
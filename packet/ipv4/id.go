@@ -0,0 +1,77 @@
+/*
+ * Network packet analysis framework.
+ *
+ * Copyright (c) 2014, Alessandro Ghedini
+ * All rights reserved.
+ *
+ * Redistribution and use in source and binary forms, with or without
+ * modification, are permitted provided that the following conditions are
+ * met:
+ *
+ *     * Redistributions of source code must retain the above copyright
+ *       notice, this list of conditions and the following disclaimer.
+ *
+ *     * Redistributions in binary form must reproduce the above copyright
+ *       notice, this list of conditions and the following disclaimer in the
+ *       documentation and/or other materials provided with the distribution.
+ *
+ * THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS
+ * IS" AND ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO,
+ * THE IMPLIED WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR
+ * PURPOSE ARE DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT HOLDER OR
+ * CONTRIBUTORS BE LIABLE FOR ANY DIRECT, INDIRECT, INCIDENTAL, SPECIAL,
+ * EXEMPLARY, OR CONSEQUENTIAL DAMAGES (INCLUDING, BUT NOT LIMITED TO,
+ * PROCUREMENT OF SUBSTITUTE GOODS OR SERVICES; LOSS OF USE, DATA, OR
+ * PROFITS; OR BUSINESS INTERRUPTION) HOWEVER CAUSED AND ON ANY THEORY OF
+ * LIABILITY, WHETHER IN CONTRACT, STRICT LIABILITY, OR TORT (INCLUDING
+ * NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE OF THIS
+ * SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+ */
+
+package ipv4
+
+import "math/rand"
+import "sync"
+
+// Generator of the Identification values of the packets of a crafted flow, so
+// that they don't all share the same value (which looks suspicious, and breaks
+// the reassembly of fragments). It is safe for concurrent use.
+type IdGenerator struct {
+    mutex  sync.Mutex
+    next   uint16
+    random bool
+}
+
+// Create a new generator that returns consecutive values, starting from the
+// given one.
+func NewIdGenerator(start uint16) *IdGenerator {
+    return &IdGenerator{ next: start }
+}
+
+// Create a new generator that starts from a random value and increments it by
+// a random amount (between 1 and 255) for every packet, so that the values are
+// increasing but hard to predict.
+func NewRandomIdGenerator() *IdGenerator {
+    return &IdGenerator{ next: uint16(rand.Uint32()), random: true }
+}
+
+// Return the next Identification value. Values wrap around after 0xFFFF.
+func (g *IdGenerator) Next() uint16 {
+    g.mutex.Lock()
+    defer g.mutex.Unlock()
+
+    id := g.next
+
+    if g.random {
+        g.next += uint16(1 + rand.Intn(255))
+    } else {
+        g.next++
+    }
+
+    return id
+}
+
+// Set the Identification field of the given packet to the next value.
+func (g *IdGenerator) Set(p *Packet) {
+    p.Id = g.Next()
+}
@@ -0,0 +1,210 @@
+/*
+ * Network packet analysis framework.
+ *
+ * Copyright (c) 2014, Alessandro Ghedini
+ * All rights reserved.
+ *
+ * Redistribution and use in source and binary forms, with or without
+ * modification, are permitted provided that the following conditions are
+ * met:
+ *
+ *     * Redistributions of source code must retain the above copyright
+ *       notice, this list of conditions and the following disclaimer.
+ *
+ *     * Redistributions in binary form must reproduce the above copyright
+ *       notice, this list of conditions and the following disclaimer in the
+ *       documentation and/or other materials provided with the distribution.
+ *
+ * THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS
+ * IS" AND ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO,
+ * THE IMPLIED WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR
+ * PURPOSE ARE DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT HOLDER OR
+ * CONTRIBUTORS BE LIABLE FOR ANY DIRECT, INDIRECT, INCIDENTAL, SPECIAL,
+ * EXEMPLARY, OR CONSEQUENTIAL DAMAGES (INCLUDING, BUT NOT LIMITED TO,
+ * PROCUREMENT OF SUBSTITUTE GOODS OR SERVICES; LOSS OF USE, DATA, OR
+ * PROFITS; OR BUSINESS INTERRUPTION) HOWEVER CAUSED AND ON ANY THEORY OF
+ * LIABILITY, WHETHER IN CONTRACT, STRICT LIABILITY, OR TORT (INCLUDING
+ * NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE OF THIS
+ * SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+ */
+
+package ipv4
+
+import "net"
+
+import "github.com/adigal150/go.pkt/packet"
+
+// IPv4 header option. The length includes the type and length fields, and is
+// ignored for single byte options (i.e. End and Nop). It is computed from the
+// data on Pack, unless KeepLength is set on the packet.
+type Option struct {
+    Type OptType
+    Len  uint8
+    Data []byte
+}
+
+type OptType uint8
+
+const (
+    End               OptType = 0x00
+    Nop                       = 0x01
+    RecordRoute               = 0x07
+    Timestamp                 = 0x44
+    LooseSourceRoute          = 0x83
+    StrictSourceRoute         = 0x89
+    RouterAlert               = 0x94
+)
+
+// Create a Loose Source and Record Route option with the given route. The
+// destination address of the packet is the first hop, so the route lists the
+// hops that follow it, the final destination last.
+func LSRR(route ...net.IP) Option {
+    return make_source_route(LooseSourceRoute, route)
+}
+
+// Create a Strict Source and Record Route option with the given route, like
+// LSRR().
+func SSRR(route ...net.IP) Option {
+    return make_source_route(StrictSourceRoute, route)
+}
+
+func make_source_route(t OptType, route []net.IP) Option {
+    /* the pointer starts at the first address */
+    data := []byte{ 4 }
+
+    for _, addr := range route {
+        data = append(data, addr.To4()...)
+    }
+
+    return Option{ Type: t, Len: uint8(2 + len(data)), Data: data }
+}
+
+// Return the route of a source route or record route option, or nil if the
+// option is of a different type or is malformed.
+func (o Option) Route() []net.IP {
+    switch o.Type {
+    case RecordRoute, LooseSourceRoute, StrictSourceRoute:
+    default:
+        return nil
+    }
+
+    if len(o.Data) < 1 || (len(o.Data) - 1) % 4 != 0 {
+        return nil
+    }
+
+    var route []net.IP
+
+    for i := 1; i < len(o.Data); i += 4 {
+        route = append(route, net.IP(o.Data[i:i + 4]))
+    }
+
+    return route
+}
+
+/* maximum length of the header, options included */
+const max_header_len = 60
+
+/* length of the header, options and padding included */
+func (p *Packet) header_len() uint16 {
+    length := 20
+
+    for _, opt := range p.Options {
+        if opt.Type == End || opt.Type == Nop {
+            length += 1
+        } else {
+            length += 2 + len(opt.Data)
+        }
+    }
+
+    return uint16((length + 3) / 4 * 4)
+}
+
+func (p *Packet) pack_options(buf *packet.Buffer) error {
+    for i := range p.Options {
+        opt := &p.Options[i]
+
+        buf.WriteN(opt.Type)
+
+        /* single byte options */
+        if opt.Type == End || opt.Type == Nop {
+            continue
+        }
+
+        if !p.KeepLength {
+            opt.Len = uint8(2 + len(opt.Data))
+        }
+
+        buf.WriteN(opt.Len)
+        buf.Write(opt.Data)
+    }
+
+    /* add padding */
+    for buf.LayerLen() < int(p.header_len()) && buf.Err() == nil {
+        buf.WriteN(uint8(End))
+    }
+
+    return buf.Err()
+}
+
+func (p *Packet) unpack_options(buf *packet.Buffer) error {
+    p.Options = nil
+
+    if p.IHL <= 5 {
+        return nil
+    }
+
+    if buf.Len() < int(p.IHL) * 4 - 20 {
+        return packet.Errorf(packet.ErrTruncated, "Truncated IPv4 options")
+    }
+
+    data := buf.Next(int(p.IHL) * 4 - 20)
+
+    for len(data) > 0 {
+        t := OptType(data[0])
+
+        if t == End {
+            /* the rest is padding */
+            p.Options = append(p.Options, Option{ Type: End })
+            break
+        }
+
+        if t == Nop {
+            p.Options = append(p.Options, Option{ Type: Nop })
+            data = data[1:]
+            continue
+        }
+
+        if len(data) < 2 || data[1] < 2 || int(data[1]) > len(data) {
+            return packet.Errorf(packet.ErrTruncated,
+                                 "Truncated IPv4 option: %d", t)
+        }
+
+        l := int(data[1])
+
+        p.Options = append(p.Options, Option{
+            Type: t,
+            Len:  data[1],
+            Data: data[2:l],
+        })
+
+        data = data[l:]
+    }
+
+    return nil
+}
+
+func clone_options(opts []Option) []Option {
+    if opts == nil {
+        return nil
+    }
+
+    clone := make([]Option, len(opts))
+
+    for i, opt := range opts {
+        opt.Data = packet.CloneBytes(opt.Data)
+
+        clone[i] = opt
+    }
+
+    return clone
+}
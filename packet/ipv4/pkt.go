@@ -38,19 +38,30 @@ import "strings"
 import "github.com/adigal150/go.pkt/packet"
 
 type Packet struct {
-    Version     uint8
-    IHL         uint8
-    TOS         uint8         `cmp:"skip"`
-    Length      uint16        `cmp:"skip"`
-    Id          uint16
-    Flags       Flags
-    FragOff     uint16
-    TTL         uint8         `cmp:"skip"`
-    Protocol    Protocol      `string:"proto"`
-    Checksum    uint16        `cmp:"skip" string:"sum"`
-    SrcAddr     net.IP        `string:"src"`
-    DstAddr     net.IP        `string:"dst"`
-    pkt_payload packet.Packet `cmp:"skip" string:"skip"`
+    Version      uint8
+    IHL          uint8
+    TOS          uint8                `cmp:"skip"`
+    Length       uint16               `cmp:"skip"`
+    Id           uint16
+    Flags        Flags
+    FragOff      uint16
+    TTL          uint8                `cmp:"skip"`
+    Protocol     Protocol             `string:"proto"`
+    Checksum     uint16               `cmp:"skip" string:"sum"`
+    SrcAddr      net.IP               `string:"src"`
+    DstAddr      net.IP               `string:"dst"`
+    Options      []Option             `cmp:"skip" string:"skip"`
+
+    // Encode the Length (and IHL) and Checksum fields as-is, instead of
+    // computing them from the packet, e.g. to craft malformed packets.
+    // KeepLength is set by Unpack() when Length doesn't match the decoded
+    // data (e.g. because of Ethernet padding), so that it is packed unchanged.
+    KeepLength   bool                 `cmp:"skip" string:"skip"`
+    KeepChecksum bool                 `cmp:"skip" string:"skip"`
+
+    pkt_payload  packet.Packet        `cmp:"skip" string:"skip"`
+    pkt_decode   func() packet.Packet `cmp:"skip" string:"skip"`
+    pkt_raw      []byte               `cmp:"skip" string:"skip"`
 }
 
 type Flags uint8
@@ -65,16 +76,20 @@ type Protocol uint8
 
 const (
     None Protocol = 0x00
+    DCCP          = 0x21
+    EtherIP       = 0x61
     GRE           = 0x2F
     ICMPv4        = 0x01
     ICMPv6        = 0x3A
     IGMP          = 0x02
     IPSecAH       = 0x33
     IPSecESP      = 0x32
+    IPv4          = 0x04
     IPv6          = 0x29
     ISIS          = 0x7C
     L2TP          = 0x73
     OSPF          = 0x59
+    PIM           = 0x67
     SCTP          = 0x84
     TCP           = 0x06
     UDP           = 0x11
@@ -96,11 +111,11 @@ func (p *Packet) GetType() packet.Type {
 }
 
 func (p *Packet) GetLength() uint16 {
-    if p.pkt_payload != nil {
-        return p.pkt_payload.GetLength() + 20
+    if p.Payload() != nil {
+        return p.Payload().GetLength() + p.header_len()
     }
 
-    return 20
+    return p.header_len()
 }
 
 func (p *Packet) Equals(other packet.Packet) bool {
@@ -131,6 +146,17 @@ func (p *Packet) Answers(other packet.Packet) bool {
 }
 
 func (p *Packet) Pack(buf *packet.Buffer) error {
+    if p.header_len() > max_header_len {
+        return packet.Errorf(packet.ErrInvalidLength,
+                             "IPv4 options too long: %d",
+                             p.header_len() - 20)
+    }
+
+    if !p.KeepLength {
+        p.Length = p.GetLength()
+        p.IHL    = uint8(p.header_len() / 4)
+    }
+
     buf.WriteN((p.Version << 4) | p.IHL)
     buf.WriteN(p.TOS)
     buf.WriteN(p.Length)
@@ -142,37 +168,39 @@ func (p *Packet) Pack(buf *packet.Buffer) error {
     buf.Write(p.SrcAddr.To4())
     buf.Write(p.DstAddr.To4())
 
-    p.checksum(buf.LayerBytes()[:20])
+    err := p.pack_options(buf)
+    if err != nil {
+        return err
+    }
+
+    if !p.KeepChecksum {
+        p.checksum(buf.LayerBytes()[:p.header_len()])
+    }
+
     buf.PutUint16N(10, p.Checksum)
 
-    return nil
+    return buf.Err()
 }
 
 func (p *Packet) checksum(raw_bytes []byte) {
-    var csum uint32
-
-    for i := 0; i < len(raw_bytes) - 1; i += 2 {
-        csum += uint32(raw_bytes[i]) << 8
-        csum += uint32(raw_bytes[i + 1])
-    }
-
-    p.Checksum = ^uint16((csum >> 16) + csum)
+    p.Checksum = packet.Checksum(raw_bytes, 0)
 }
 
 func (p *Packet) pseudo_checksum() uint32 {
-    var csum uint32
+    length := p.pkt_payload.GetLength()
 
-    csum += (uint32(p.SrcAddr.To4()[0]) + uint32(p.SrcAddr.To4()[2])) << 8
-    csum +=  uint32(p.SrcAddr.To4()[1]) + uint32(p.SrcAddr.To4()[3])
-    csum += (uint32(p.DstAddr.To4()[0]) + uint32(p.DstAddr.To4()[2])) << 8
-    csum +=  uint32(p.DstAddr.To4()[1]) + uint32(p.DstAddr.To4()[3])
-    csum +=  uint32(p.Protocol)
-    csum +=  uint32(p.pkt_payload.GetLength())
+    /* the payload may include padding that is not covered by Length */
+    if p.KeepLength {
+        length = uint16(p.PayloadLength())
+    }
 
-    return csum
+    return packet.PseudoHeaderV4(p.SrcAddr, p.DstAddr, uint8(p.Protocol),
+                                 length)
 }
 
 func (p *Packet) Unpack(buf *packet.Buffer) error {
+    p.pkt_raw = buf.Bytes()
+
     var versihl uint8
     buf.ReadN(&versihl)
 
@@ -197,36 +225,113 @@ func (p *Packet) Unpack(buf *packet.Buffer) error {
     p.SrcAddr = net.IP(buf.Next(4))
     p.DstAddr = net.IP(buf.Next(4))
 
-    /* TODO: Options */
+    if buf.Err() != nil {
+        return buf.Err()
+    }
+
+    p.KeepLength = int(p.Length) != len(p.pkt_raw)
 
-    return nil
+    return p.unpack_options(buf)
+}
+
+// Return the length of the payload declared by the header, which may be less
+// than the length of the decoded data (e.g. because of Ethernet padding).
+func (p *Packet) PayloadLength() uint32 {
+    hdr_len := uint16(p.IHL) * 4
+    if hdr_len < 20 {
+        hdr_len = 20
+    }
+
+    if p.Length < hdr_len {
+        return 0
+    }
+
+    return uint32(p.Length - hdr_len)
 }
 
 func (p *Packet) Payload() packet.Packet {
+    if p.pkt_decode != nil {
+        p.pkt_payload = p.pkt_decode()
+        p.pkt_decode  = nil
+    }
+
     return p.pkt_payload
 }
 
+func (p *Packet) RawBytes() []byte {
+    return p.pkt_raw
+}
+
+func (p *Packet) HeaderBytes() []byte {
+    return packet.HeaderBytes(p)
+}
+
 func (p *Packet) GuessPayloadType() packet.Type {
     return ProtocolToType(p.Protocol)
 }
 
 func (p *Packet) SetPayload(pl packet.Packet) error {
     p.pkt_payload = pl
+    p.pkt_decode  = nil
     p.Protocol    = TypeToProtocol(pl.GetType())
-    p.Length      = p.GetLength()
 
-    pl.InitChecksum(p.pseudo_checksum())
+    if !p.KeepLength {
+        p.Length = p.GetLength()
+    }
+
+    /* PIM only uses a pseudo-header over IPv6 */
+    if pl.GetType() != packet.PIM {
+        pl.InitChecksum(p.pseudo_checksum())
+    }
 
     return nil
 }
 
+func (p *Packet) SetPayloadDecoder(decode func() packet.Packet) {
+    p.pkt_payload = nil
+    p.pkt_decode  = decode
+}
+
 func (p *Packet) InitChecksum(csum uint32) {
 }
 
+func (p *Packet) Clone() packet.Packet {
+    c := *p
+
+    c.SrcAddr     = packet.CloneBytes(p.SrcAddr)
+    c.DstAddr     = packet.CloneBytes(p.DstAddr)
+    c.Options     = clone_options(p.Options)
+    c.pkt_payload = packet.ClonePayload(p.Payload())
+    c.pkt_decode  = nil
+
+    return &c
+}
+
 func (p *Packet) String() string {
     return packet.Stringify(p)
 }
 
+func (p *Packet) Validate() error {
+    if p.Version != 4 {
+        return fmt.Errorf("Invalid version: %d", p.Version)
+    }
+
+    if p.IHL < 5 {
+        return packet.Errorf(packet.ErrInvalidLength,
+                             "Invalid header length: %d", p.IHL)
+    }
+
+    if p.FragOff > 0x1FFF {
+        return fmt.Errorf("Invalid fragment offset: %d", p.FragOff)
+    }
+
+    if p.SrcAddr.To4() == nil || p.DstAddr.To4() == nil {
+        return fmt.Errorf("Invalid address: %s/%s", p.SrcAddr, p.DstAddr)
+    }
+
+    return nil
+}
+
 func (f Flags) String() string {
     var flags []string
 
@@ -245,39 +350,58 @@ func (f Flags) String() string {
     return strings.Join(flags, "|")
 }
 
+// Calculate the Internet checksum of the given data.
+//
+// Deprecated: use packet.Checksum() instead.
 func CalculateChecksum(raw_bytes []byte, csum uint32) uint16 {
-    length := len(raw_bytes) - 1
-
-    for i := 0; i < length; i += 2 {
-        csum += uint32(raw_bytes[i]) << 8
-        csum += uint32(raw_bytes[i + 1])
-    }
-
-    csum = (csum >> 16) + (csum & 0xffff)
-
-    return ^uint16(csum + (csum >> 16))
+    return packet.Checksum(raw_bytes, csum)
 }
 
 var ipv4proto_to_type_map = map[Protocol]packet.Type{
     None:     packet.None,
+    DCCP:     packet.DCCP,
+    EtherIP:  packet.EtherIP,
     GRE:      packet.GRE,
     ICMPv4:   packet.ICMPv4,
     ICMPv6:   packet.ICMPv6,
     IGMP:     packet.IGMP,
     IPSecAH:  packet.IPSec,
     IPSecESP: packet.IPSec,
+    IPv4:     packet.IPv4,
     IPv6:     packet.IPv6,
     UDP:      packet.UDP,
     ISIS:     packet.ISIS,
     L2TP:     packet.L2TP,
     OSPF:     packet.OSPF,
+    PIM:      packet.PIM,
     SCTP:     packet.SCTP,
     UDPLite:  packet.UDPLite,
     TCP:      packet.TCP,
 }
 
+var ipv4proto_registry = map[Protocol]packet.Type{}
+
+// Register a packet type for the given IP protocol ID, so that IPv4 and IPv6
+// packets carrying it are decoded without changes to the core mapping. This is
+// meant to be called during initialization (e.g. from an init() function) and
+// must not be called concurrently with packet decoding.
+func RegisterProtocol(proto Protocol, pkttype packet.Type) {
+    ipv4proto_registry[proto] = pkttype
+}
+
+// Remove the packet type registered for the given IP protocol ID, restoring the
+// core mapping (e.g. at the end of a test). The same restrictions as for
+// RegisterProtocol() apply.
+func UnregisterProtocol(proto Protocol) {
+    delete(ipv4proto_registry, proto)
+}
+
 // Create a new Type from the given IP protocol ID.
 func ProtocolToType(proto Protocol) packet.Type {
+    if t, ok := ipv4proto_registry[proto]; ok {
+        return t
+    }
+
     for p, t := range ipv4proto_to_type_map {
         if p == proto {
             return t
@@ -287,30 +411,54 @@ func ProtocolToType(proto Protocol) packet.Type {
     return packet.Raw
 }
 
-// Convert the Type to the corresponding IP protocol ID.
+// Convert the Type to the corresponding IP protocol ID. If several IDs map to
+// the Type (e.g. IPSecESP and IPSecAH), the lowest one is returned.
 func TypeToProtocol(pkttype packet.Type) Protocol {
-    for p, t := range ipv4proto_to_type_map {
-        if t == pkttype {
-            return p
-        }
+    if p, ok := lowest_protocol(ipv4proto_to_type_map, pkttype); ok {
+        return p
+    }
+
+    if p, ok := lowest_protocol(ipv4proto_registry, pkttype); ok {
+        return p
     }
 
     return None
 }
 
+/* Return the lowest protocol ID mapped to the given type, so that the result
+ * doesn't depend on the map iteration order */
+func lowest_protocol(protos map[Protocol]packet.Type,
+                     pkttype packet.Type) (Protocol, bool) {
+    var lowest Protocol
+    found := false
+
+    for p, t := range protos {
+        if t == pkttype && (!found || p < lowest) {
+            lowest = p
+            found  = true
+        }
+    }
+
+    return lowest, found
+}
+
 func (p Protocol) String() string {
     switch p {
+    case DCCP:     return "DCCP"
+    case EtherIP:  return "EtherIP"
     case GRE:      return "GRE"
     case ICMPv4:   return "ICMPv4"
     case ICMPv6:   return "ICMPv6"
     case IGMP:     return "IGMP"
     case IPSecAH:  return "IPSecAH"
     case IPSecESP: return "IPSecESP"
+    case IPv4:     return "IPv4"
     case IPv6:     return "IPv6"
     case UDP:      return "UDP"
     case ISIS:     return "ISIS"
     case L2TP:     return "L2TP"
     case OSPF:     return "OSPF"
+    case PIM:      return "PIM"
     case SCTP:     return "SCTP"
     case UDPLite:  return "UDPLite"
     case TCP:      return "TCP"
@@ -31,6 +31,7 @@
 package ipv4_test
 
 import "bytes"
+import "errors"
 import "net"
 import "testing"
 
@@ -115,3 +116,254 @@ func BenchmarkUnpack(bn *testing.B) {
         p.Unpack(&b)
     }
 }
+
+func TestRegisterProtocol(t *testing.T) {
+    ipv4.RegisterProtocol(253, packet.UDP)
+    defer ipv4.UnregisterProtocol(253)
+
+    p := MakeTestSimple()
+    p.Protocol = 253
+
+    if p.GuessPayloadType() != packet.UDP {
+        t.Fatalf("Payload type mismatch: %s", p.GuessPayloadType())
+    }
+
+    if ipv4.TypeToProtocol(packet.UDP) != ipv4.UDP {
+        t.Fatalf("Protocol mismatch: %s", ipv4.TypeToProtocol(packet.UDP))
+    }
+
+    ipv4.UnregisterProtocol(253)
+
+    if p.GuessPayloadType() == packet.UDP {
+        t.Fatalf("Protocol not unregistered")
+    }
+}
+
+func TestTypeToProtocolLowest(t *testing.T) {
+    ipv4.RegisterProtocol(254, packet.VLAN)
+    defer ipv4.UnregisterProtocol(254)
+
+    ipv4.RegisterProtocol(253, packet.VLAN)
+    defer ipv4.UnregisterProtocol(253)
+
+    for i := 0; i < 100; i++ {
+        if ipv4.TypeToProtocol(packet.VLAN) != 253 {
+            t.Fatalf("Protocol mismatch: %s",
+                     ipv4.TypeToProtocol(packet.VLAN))
+        }
+
+        if ipv4.TypeToProtocol(packet.IPSec) != ipv4.IPSecESP {
+            t.Fatalf("Protocol mismatch: %s",
+                     ipv4.TypeToProtocol(packet.IPSec))
+        }
+    }
+}
+
+func TestPackMalformed(t *testing.T) {
+    var b packet.Buffer
+    b.Init(make([]byte, len(test_simple)))
+
+    p := MakeTestSimple()
+    p.Length       = 1500
+    p.Checksum     = 0xdead
+    p.KeepLength   = true
+    p.KeepChecksum = true
+
+    err := p.Pack(&b)
+    if err != nil {
+        t.Fatalf("Error packing: %s", err)
+    }
+
+    buf := b.Buffer()
+
+    if !bytes.Equal(buf[2:4], []byte{ 0x05, 0xdc }) ||
+       !bytes.Equal(buf[10:12], []byte{ 0xde, 0xad }) {
+        t.Fatalf("Raw packet mismatch: %x", buf)
+    }
+
+    p.KeepLength   = false
+    p.KeepChecksum = false
+
+    b.Init(make([]byte, len(test_simple)))
+
+    err = p.Pack(&b)
+    if err != nil {
+        t.Fatalf("Error packing: %s", err)
+    }
+
+    if !bytes.Equal(test_simple, b.Buffer()) {
+        t.Fatalf("Raw packet mismatch: %x", b.Buffer())
+    }
+}
+
+func TestPackSourceRoute(t *testing.T) {
+    var b packet.Buffer
+    b.Init(make([]byte, 32))
+
+    p := MakeTestSimple()
+    p.Options = []ipv4.Option{
+        ipv4.LSRR(net.ParseIP("10.0.0.1"), net.ParseIP("10.0.0.2")),
+    }
+
+    err := p.Pack(&b)
+    if err != nil {
+        t.Fatalf("Error packing: %s", err)
+    }
+
+    if p.IHL != 8 || p.Length != 32 {
+        t.Fatalf("Header length mismatch: %d/%d", p.IHL, p.Length)
+    }
+
+    buf := b.Buffer()
+
+    opts := []byte{
+        0x83, 0x0b, 0x04, 0x0a, 0x00, 0x00, 0x01, 0x0a, 0x00, 0x00, 0x02,
+        0x00,
+    }
+
+    if buf[0] != 0x48 || !bytes.Equal(buf[20:], opts) {
+        t.Fatalf("Raw packet mismatch: %x", buf)
+    }
+
+    if packet.Checksum(buf, 0) != 0 {
+        t.Fatalf("Invalid checksum: %x", p.Checksum)
+    }
+
+    var u ipv4.Packet
+
+    b.Init(buf)
+
+    err = u.Unpack(&b)
+    if err != nil {
+        t.Fatalf("Error unpacking: %s", err)
+    }
+
+    if len(u.Options) != 2 || u.Options[0].Type != ipv4.LooseSourceRoute ||
+       len(u.Options[0].Route()) != 2 ||
+       !u.Options[0].Route()[1].Equal(net.ParseIP("10.0.0.2")) {
+        t.Fatalf("Options mismatch: %v", u.Options)
+    }
+}
+
+func TestPackOptionLength(t *testing.T) {
+    var b packet.Buffer
+    b.Init(make([]byte, 24))
+
+    p := MakeTestSimple()
+    p.Options = []ipv4.Option{
+        { Type: ipv4.RouterAlert, Len: 10, Data: []byte{ 0x00, 0x00 } },
+    }
+
+    err := p.Pack(&b)
+    if err != nil {
+        t.Fatalf("Error packing: %s", err)
+    }
+
+    if p.Options[0].Len != 4 || b.Buffer()[21] != 0x04 {
+        t.Fatalf("Option length mismatch: %x", b.Buffer())
+    }
+
+    p.Options[0].Len = 10
+    p.KeepLength     = true
+
+    b.Init(make([]byte, 24))
+
+    err = p.Pack(&b)
+    if err != nil {
+        t.Fatalf("Error packing: %s", err)
+    }
+
+    if b.Buffer()[21] != 0x0a {
+        t.Fatalf("Option length mismatch: %x", b.Buffer())
+    }
+}
+
+func TestPackOptionsTooLong(t *testing.T) {
+    var b packet.Buffer
+    b.Init(make([]byte, 80))
+
+    p := MakeTestSimple()
+
+    for i := 0; i < 41; i++ {
+        p.Options = append(p.Options, ipv4.Option{ Type: ipv4.Nop })
+    }
+
+    err := p.Pack(&b)
+    if !errors.Is(err, packet.ErrInvalidLength) {
+        t.Fatalf("Unexpected error: %v", err)
+    }
+
+    p.Options = p.Options[:40]
+
+    b.Init(make([]byte, 60))
+
+    err = p.Pack(&b)
+    if err != nil {
+        t.Fatalf("Error packing: %s", err)
+    }
+
+    if p.IHL != 15 || b.Buffer()[0] != 0x4f {
+        t.Fatalf("Header length mismatch: %x", b.Buffer())
+    }
+}
+
+func TestValidate(t *testing.T) {
+    p := MakeTestSimple()
+
+    err := p.Validate()
+    if err != nil {
+        t.Fatalf("Error validating: %s", err)
+    }
+
+    p.IHL = 4
+
+    err = p.Validate()
+    if err == nil || err.Error() != "Invalid header length: 4" ||
+       !errors.Is(err, packet.ErrInvalidLength) {
+        t.Fatalf("Invalid header length not detected: %v", err)
+    }
+
+    p.IHL     = 5
+    p.SrcAddr = net.IP{ 192, 168 }
+
+    if p.Validate() == nil {
+        t.Fatalf("Invalid address not detected")
+    }
+}
+
+func TestIdGenerator(t *testing.T) {
+    gen := ipv4.NewIdGenerator(100)
+
+    for i := 0; i < 5; i++ {
+        p := MakeTestSimple()
+        gen.Set(p)
+
+        var b packet.Buffer
+        b.Init(make([]byte, len(test_simple)))
+
+        err := p.Pack(&b)
+        if err != nil {
+            t.Fatalf("Error packing: %s", err)
+        }
+
+        id := uint16(b.Buffer()[4]) << 8 | uint16(b.Buffer()[5])
+        if id != uint16(100 + i) {
+            t.Fatalf("Id mismatch: %d", id)
+        }
+    }
+
+    gen = ipv4.NewRandomIdGenerator()
+
+    prev := gen.Next()
+
+    for i := 1; i < 5; i++ {
+        id := gen.Next()
+
+        /* the values may wrap around */
+        if diff := id - prev; diff == 0 || diff > 255 {
+            t.Fatalf("Id not increasing: %d %d", prev, id)
+        }
+
+        prev = id
+    }
+}
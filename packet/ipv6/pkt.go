@@ -32,7 +32,9 @@
 package ipv6
 
 import "encoding/binary"
+import "fmt"
 import "net"
+import "strings"
 
 import "github.com/adigal150/go.pkt/packet"
 import "github.com/adigal150/go.pkt/packet/ipv4"
@@ -41,16 +43,25 @@ type Packet struct {
     Version     uint8
     Class       uint8
     Label       uint32
-    Length      uint16        `string:"len"`
-    NextHdr     ipv4.Protocol `string:"next"`
-    HopLimit    uint8         `cmp:"skip" string:"hop"`
-    SrcAddr     net.IP        `string:"src"`
-    DstAddr     net.IP        `string:"dst"`
-    pkt_payload packet.Packet `cmp:"skip" string:"skip"`
+    Length      uint16               `string:"len"`
+    Jumbo       uint32               `string:"jumbo"`
+    NextHdr     ipv4.Protocol        `string:"next"`
+    HopLimit    uint8                `cmp:"skip" string:"hop"`
+    SrcAddr     net.IP               `string:"src"`
+    DstAddr     net.IP               `string:"dst"`
+    pkt_payload packet.Packet        `cmp:"skip" string:"skip"`
+    pkt_decode  func() packet.Packet `cmp:"skip" string:"skip"`
+    pkt_raw     []byte               `cmp:"skip" string:"skip"`
 }
 
 type Flags uint8
 
+// Next header value of the Hop-by-Hop Options extension header.
+const HopByHop ipv4.Protocol = 0x00
+
+/* RFC 2675 Jumbo Payload option type */
+const jumbo_option = 0xC2
+
 func Make() *Packet {
     return &Packet{
         Version: 6,
@@ -63,11 +74,11 @@ func (p *Packet) GetType() packet.Type {
 }
 
 func (p *Packet) GetLength() uint16 {
-    if p.pkt_payload != nil {
-        return p.pkt_payload.GetLength() + 40
+    if p.Payload() != nil {
+        return p.Payload().GetLength() + p.header_len()
     }
 
-    return 40
+    return p.header_len()
 }
 
 func (p *Packet) Equals(other packet.Packet) bool {
@@ -98,68 +109,129 @@ func (p *Packet) Pack(buf *packet.Buffer) error {
     buf.WriteN(p.Class << 4 | uint8(p.Label >> 16))
     buf.WriteN(uint16(p.Label))
 
-    buf.WriteN(p.Length)
-    buf.WriteN(p.NextHdr)
+    if p.Jumbo > 0xFFFF {
+        buf.WriteN(uint16(0))
+        buf.WriteN(HopByHop)
+    } else {
+        buf.WriteN(p.Length)
+        buf.WriteN(p.NextHdr)
+    }
+
     buf.WriteN(p.HopLimit)
 
-    buf.Write(p.SrcAddr.To16())
-    buf.Write(p.DstAddr.To16())
+    err := write_addr(buf, p.SrcAddr)
+    if err != nil {
+        return err
+    }
 
-    return nil
-}
+    err = write_addr(buf, p.DstAddr)
+    if err != nil {
+        return err
+    }
 
-func (p *Packet) pseudo_checksum() uint32 {
-    var csum uint32
+    if p.Jumbo > 0xFFFF {
+        buf.WriteN(p.NextHdr)
+        buf.WriteN(uint8(0))
+        buf.WriteN(uint8(jumbo_option))
+        buf.WriteN(uint8(4))
+        buf.WriteN(p.Jumbo)
+    }
+
+    return buf.Err()
+}
 
-    for i := 0; i < 16; i += 2 {
-        csum += uint32(p.SrcAddr.To16()[i]) << 8
-        csum += uint32(p.SrcAddr.To16()[i + 1])
-        csum += uint32(p.DstAddr.To16()[i]) << 8
-        csum += uint32(p.DstAddr.To16()[i + 1])
+func (p *Packet) header_len() uint16 {
+    if p.Jumbo > 0xFFFF {
+        return 48
     }
 
-    csum += uint32(p.Length)
-    csum += uint32(p.NextHdr)
+    return 40
+}
 
-    return csum
+func (p *Packet) pseudo_checksum() uint32 {
+    return packet.PseudoHeaderV6(p.SrcAddr, p.DstAddr, uint8(p.NextHdr),
+                                 p.PayloadLength())
 }
 
 func (p *Packet) Unpack(buf *packet.Buffer) error {
-    var versclass uint8
-    buf.ReadN(&versclass)
+    p.pkt_raw = buf.Bytes()
 
-    p.Version = versclass >> 4
+    var versclasslabel uint32
+    buf.ReadN(&versclasslabel)
 
-    p.Class =
-     uint8((binary.BigEndian.Uint16(buf.LayerBytes()[0:2]) >> 4) & 0x00FF)
-
-    p.Label =
-     binary.BigEndian.Uint32(buf.LayerBytes()[0:4]) & 0x000FFFFF
-
-    buf.Next(3)
+    p.Version = uint8(versclasslabel >> 28)
+    p.Class   = uint8(versclasslabel >> 20)
+    p.Label   = versclasslabel & 0x000FFFFF
 
     buf.ReadN(&p.Length)
     buf.ReadN(&p.NextHdr)
     buf.ReadN(&p.HopLimit)
 
+    if buf.Len() < 32 {
+        return packet.Errorf(packet.ErrTruncated, "Invalid IPv6 header")
+    }
+
     p.SrcAddr = net.IP(buf.Next(16))
     p.DstAddr = net.IP(buf.Next(16))
 
+    /* A Hop-by-Hop header carrying only the Jumbo Payload option is decoded
+     * as part of the IPv6 header */
+    if p.Length == 0 && p.NextHdr == HopByHop && buf.Len() >= 8 {
+        hdr := buf.Bytes()[:8]
+
+        if hdr[1] == 0 && hdr[2] == jumbo_option && hdr[3] == 4 {
+            buf.Next(8)
+
+            p.NextHdr = ipv4.Protocol(hdr[0])
+            p.Jumbo   = binary.BigEndian.Uint32(hdr[4:])
+
+            if p.Jumbo <= 0xFFFF {
+                return packet.Errorf(packet.ErrInvalidLength,
+                                     "Invalid jumbo payload length: %d",
+                                     p.Jumbo)
+            }
+        }
+    }
+
     /* TODO: Options */
 
-    return nil
+    return buf.Err()
+}
+
+// Return the length of the payload, taking into account the Jumbo Payload
+// option. Note that GetLength() can't represent the length of jumbograms.
+func (p *Packet) PayloadLength() uint32 {
+    if p.Jumbo > 0xFFFF {
+        return p.Jumbo
+    }
+
+    return uint32(p.Length)
 }
 
 func (p *Packet) Payload() packet.Packet {
+    if p.pkt_decode != nil {
+        p.pkt_payload = p.pkt_decode()
+        p.pkt_decode  = nil
+    }
+
     return p.pkt_payload
 }
 
+func (p *Packet) RawBytes() []byte {
+    return p.pkt_raw
+}
+
+func (p *Packet) HeaderBytes() []byte {
+    return packet.HeaderBytes(p)
+}
+
 func (p *Packet) GuessPayloadType() packet.Type {
     return ipv4.ProtocolToType(p.NextHdr)
 }
 
 func (p *Packet) SetPayload(pl packet.Packet) error {
     p.pkt_payload = pl
+    p.pkt_decode  = nil
     p.NextHdr     = ipv4.TypeToProtocol(pl.GetType())
     p.Length      = pl.GetLength()
 
@@ -168,9 +240,76 @@ func (p *Packet) SetPayload(pl packet.Packet) error {
     return nil
 }
 
+func (p *Packet) SetPayloadDecoder(decode func() packet.Packet) {
+    p.pkt_payload = nil
+    p.pkt_decode  = decode
+}
+
 func (p *Packet) InitChecksum(csum uint32) {
 }
 
+func (p *Packet) Clone() packet.Packet {
+    c := *p
+
+    c.SrcAddr     = packet.CloneBytes(p.SrcAddr)
+    c.DstAddr     = packet.CloneBytes(p.DstAddr)
+    c.pkt_payload = packet.ClonePayload(p.Payload())
+    c.pkt_decode  = nil
+
+    return &c
+}
+
 func (p *Packet) String() string {
     return packet.Stringify(p)
 }
+
+func (p *Packet) Validate() error {
+    if p.Version != 6 {
+        return fmt.Errorf("Invalid version: %d", p.Version)
+    }
+
+    if p.Label > 0xFFFFF {
+        return fmt.Errorf("Invalid flow label: %d", p.Label)
+    }
+
+    if p.SrcAddr.To16() == nil || p.DstAddr.To16() == nil {
+        return fmt.Errorf("Invalid address: %s/%s", p.SrcAddr, p.DstAddr)
+    }
+
+    return nil
+}
+
+// Parse the given textual IPv6 address, optionally followed by an interface
+// zone (e.g. "fe80::1%eth0"), and return the address and the zone. The zone is
+// not part of the wire format, so it's returned separately and is empty if not
+// present. A nil address is returned if the address is not valid.
+func ParseAddr(s string) (net.IP, string) {
+    var zone string
+
+    if i := strings.LastIndex(s, "%"); i >= 0 {
+        s, zone = s[:i], s[i + 1:]
+    }
+
+    ip := net.ParseIP(s)
+    if ip == nil || !strings.Contains(s, ":") {
+        return nil, ""
+    }
+
+    return ip, zone
+}
+
+/* Write the full 16 bytes of the given address, or all zeros if it's nil */
+func write_addr(buf *packet.Buffer, addr net.IP) error {
+    if addr == nil {
+        buf.Write(net.IPv6unspecified)
+        return buf.Err()
+    }
+
+    if addr.To16() == nil {
+        return fmt.Errorf("Invalid IPv6 address: %v", []byte(addr))
+    }
+
+    buf.Write(addr.To16())
+
+    return buf.Err()
+}
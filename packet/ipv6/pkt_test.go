@@ -32,6 +32,7 @@ package ipv6_test
 
 import "bytes"
 import "net"
+import "strings"
 import "testing"
 
 import "github.com/adigal150/go.pkt/packet"
@@ -115,3 +116,119 @@ func BenchmarkUnpack(bn *testing.B) {
         p.Unpack(&b)
     }
 }
+
+func TestRegisterProtocol(t *testing.T) {
+    ipv4.RegisterProtocol(253, packet.UDP)
+    defer ipv4.UnregisterProtocol(253)
+
+    p := MakeTestSimple()
+    p.NextHdr = 253
+
+    if p.GuessPayloadType() != packet.UDP {
+        t.Fatalf("Payload type mismatch: %s", p.GuessPayloadType())
+    }
+}
+
+func TestJumbogram(t *testing.T) {
+    p := MakeTestSimple()
+    p.Length = 0
+    p.Jumbo  = 70000
+
+    var b packet.Buffer
+    b.Init(make([]byte, 48))
+
+    err := p.Pack(&b)
+    if err != nil {
+        t.Fatalf("Error packing: %s", err)
+    }
+
+    hdr := b.Buffer()
+
+    if !bytes.Equal(hdr[4:7], []byte{ 0x00, 0x00, 0x00 }) ||
+       !bytes.Equal(hdr[40:], []byte{ 0x11, 0x00, 0xc2, 0x04,
+                                      0x00, 0x01, 0x11, 0x70 }) {
+        t.Fatalf("Raw packet mismatch: %x", hdr)
+    }
+
+    data := append(hdr, make([]byte, 70000)...)
+
+    var q ipv6.Packet
+
+    b.Init(data)
+
+    err = q.Unpack(&b)
+    if err != nil {
+        t.Fatalf("Error unpacking: %s", err)
+    }
+
+    if !q.Equals(p) {
+        t.Fatalf("Packet mismatch:\n%s\n%s", &q, p)
+    }
+
+    if q.PayloadLength() != 70000 || b.Len() != 70000 {
+        t.Fatalf("Payload length mismatch: %d", q.PayloadLength())
+    }
+
+    if q.GuessPayloadType() != packet.UDP {
+        t.Fatalf("Payload type mismatch: %s", q.GuessPayloadType())
+    }
+}
+
+func TestLinkLocal(t *testing.T) {
+    src, zone := ipv6.ParseAddr("fe80:0:0::0001%eth0")
+    if src == nil || zone != "eth0" {
+        t.Fatalf("Error parsing address: %v %s", src, zone)
+    }
+
+    dst, zone := ipv6.ParseAddr("fe80::2")
+    if dst == nil || zone != "" {
+        t.Fatalf("Error parsing address: %v %s", dst, zone)
+    }
+
+    if ip, _ := ipv6.ParseAddr("192.0.2.1%eth0"); ip != nil {
+        t.Fatalf("IPv4 address accepted: %s", ip)
+    }
+
+    p := ipv6.Make()
+    p.SrcAddr = src
+    p.DstAddr = dst
+
+    var b packet.Buffer
+    b.Init(make([]byte, 40))
+
+    err := p.Pack(&b)
+    if err != nil {
+        t.Fatalf("Error packing: %s", err)
+    }
+
+    if !bytes.Equal(b.Buffer()[8:24], src.To16()) ||
+       !bytes.Equal(b.Buffer()[24:40], dst.To16()) {
+        t.Fatalf("Raw packet mismatch: %x", b.Buffer())
+    }
+
+    var q ipv6.Packet
+
+    b.Init(b.Buffer())
+
+    err = q.Unpack(&b)
+    if err != nil {
+        t.Fatalf("Error unpacking: %s", err)
+    }
+
+    if !q.Equals(p) {
+        t.Fatalf("Packet mismatch:\n%s\n%s", &q, p)
+    }
+
+    if !strings.Contains(q.String(), "src=fe80::1,") ||
+       !strings.Contains(q.String(), "dst=fe80::2)") {
+        t.Fatalf("String mismatch: %s", &q)
+    }
+
+    p.SrcAddr = net.IP{ 0xfe, 0x80 }
+
+    b.Init(make([]byte, 40))
+
+    if p.Pack(&b) == nil {
+        t.Fatalf("Invalid address packed")
+    }
+}
@@ -0,0 +1,341 @@
+/*
+ * Network packet analysis framework.
+ *
+ * Copyright (c) 2014, Alessandro Ghedini
+ * All rights reserved.
+ *
+ * Redistribution and use in source and binary forms, with or without
+ * modification, are permitted provided that the following conditions are
+ * met:
+ *
+ *     * Redistributions of source code must retain the above copyright
+ *       notice, this list of conditions and the following disclaimer.
+ *
+ *     * Redistributions in binary form must reproduce the above copyright
+ *       notice, this list of conditions and the following disclaimer in the
+ *       documentation and/or other materials provided with the distribution.
+ *
+ * THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS
+ * IS" AND ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO,
+ * THE IMPLIED WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR
+ * PURPOSE ARE DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT HOLDER OR
+ * CONTRIBUTORS BE LIABLE FOR ANY DIRECT, INDIRECT, INCIDENTAL, SPECIAL,
+ * EXEMPLARY, OR CONSEQUENTIAL DAMAGES (INCLUDING, BUT NOT LIMITED TO,
+ * PROCUREMENT OF SUBSTITUTE GOODS OR SERVICES; LOSS OF USE, DATA, OR
+ * PROFITS; OR BUSINESS INTERRUPTION) HOWEVER CAUSED AND ON ANY THEORY OF
+ * LIABILITY, WHETHER IN CONTRACT, STRICT LIABILITY, OR TORT (INCLUDING
+ * NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE OF THIS
+ * SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+ */
+// Provides encoding and decoding for IS-IS (ISO 10589) packets.
+//
+// Only the common header and the fixed fields of Hello PDUs are decoded, along
+// with the TLVs of Hello PDUs. The body of the other PDUs is left opaque.
+package isis
+
+import "fmt"
+
+import "github.com/adigal150/go.pkt/packet"
+
+type Packet struct {
+    /* length of the fixed part of the PDU, computed for Hello PDUs only */
+    HeaderLen      uint8        `cmp:"skip" string:"hlen"`
+
+    IDLen          uint8        `string:"idlen"`
+    Type           PDUType
+    Version        uint8        `string:"ver"`
+    MaxAreas       uint8        `string:"areas"`
+
+    /* Hello PDUs only */
+    CircuitType    uint8        `string:"circuit"`
+    SourceId       []byte       `string:"src"`
+    HoldingTime    uint16       `string:"hold"`
+    PDULength      uint16       `cmp:"skip" string:"len"`
+
+    /* LAN Hello PDUs only */
+    Priority       uint8        `string:"prio"`
+    LANId          []byte       `string:"lan"`
+
+    /* Point-to-point Hello PDUs only */
+    LocalCircuitId uint8        `string:"circid"`
+
+    TLVs           []packet.TLV `cmp:"skip" string:"skip"`
+
+    /* body of PDUs other than Hello */
+    Data           []byte       `cmp:"skip" string:"skip"`
+
+    pkt_raw        []byte       `cmp:"skip" string:"skip"`
+}
+
+type PDUType uint8
+
+const (
+    L1LANHello PDUType = 15
+    L2LANHello         = 16
+    P2PHello           = 17
+    L1LSP              = 18
+    L2LSP              = 20
+    L1CSNP             = 24
+    L2CSNP             = 25
+    L1PSNP             = 26
+    L2PSNP             = 27
+)
+
+const (
+    AreaAddresses      uint16 = 1
+    ISNeighbors               = 6
+    Padding                   = 8
+    Authentication            = 10
+    ProtocolsSupported        = 129
+    IPInterfaceAddr           = 132
+    Hostname                  = 137
+    P2PAdjacencyState         = 240
+)
+
+/* Intradomain Routing Protocol Discriminator */
+const discriminator = 0x83
+
+func Make() *Packet {
+    return &Packet{
+        Type:        L1LANHello,
+        Version:     1,
+        CircuitType: 1,
+    }
+}
+
+func (p *Packet) GetType() packet.Type {
+    return packet.ISIS
+}
+
+func (p *Packet) GetLength() uint16 {
+    length := p.header_len()
+
+    if p.IsHello() {
+        for _, tlv := range p.TLVs {
+            length += 2 + uint16(len(tlv.Value))
+        }
+    } else {
+        length += uint16(len(p.Data))
+    }
+
+    return length
+}
+
+func (p *Packet) Equals(other packet.Packet) bool {
+    return packet.Compare(p, other)
+}
+
+func (p *Packet) Answers(other packet.Packet) bool {
+    return false
+}
+
+func (p *Packet) Pack(buf *packet.Buffer) error {
+    buf.WriteN(uint8(discriminator))
+    buf.WriteN(p.length_indicator())
+    buf.WriteN(uint8(1))
+    buf.WriteN(p.IDLen)
+    buf.WriteN(p.Type & 0x1F)
+    buf.WriteN(p.Version)
+    buf.WriteN(uint8(0x00))
+    buf.WriteN(p.MaxAreas)
+
+    if !p.IsHello() {
+        buf.Write(p.Data)
+        return buf.Err()
+    }
+
+    if len(p.SourceId) != p.id_len() {
+        return fmt.Errorf("Invalid source ID length: %d", len(p.SourceId))
+    }
+
+    buf.WriteN(p.CircuitType & 0x03)
+    buf.Write(p.SourceId)
+    buf.WriteN(p.HoldingTime)
+    buf.WriteN(p.GetLength())
+
+    if p.Type == P2PHello {
+        buf.WriteN(p.LocalCircuitId)
+    } else {
+        if len(p.LANId) != p.id_len() + 1 {
+            return fmt.Errorf("Invalid LAN ID length: %d", len(p.LANId))
+        }
+
+        buf.WriteN(p.Priority & 0x7F)
+        buf.Write(p.LANId)
+    }
+
+    return packet.EncodeTLV8(buf, p.TLVs)
+}
+
+func (p *Packet) Unpack(buf *packet.Buffer) error {
+    p.pkt_raw = buf.Bytes()
+
+    if buf.Len() < 8 {
+        return packet.Errorf(packet.ErrTruncated, "Invalid IS-IS header")
+    }
+
+    var irpd, pid_ext, reserved uint8
+
+    buf.ReadN(&irpd)
+
+    if irpd != discriminator {
+        return packet.Errorf(packet.ErrUnsupported,
+                             "Invalid IS-IS discriminator: 0x%02x", irpd)
+    }
+
+    buf.ReadN(&p.HeaderLen)
+    buf.ReadN(&pid_ext)
+    buf.ReadN(&p.IDLen)
+    buf.ReadN(&p.Type)
+    buf.ReadN(&p.Version)
+    buf.ReadN(&reserved)
+    buf.ReadN(&p.MaxAreas)
+
+    p.Type &= 0x1F
+
+    if !p.IsHello() {
+        p.Data = buf.Next(buf.Len())
+        return buf.Err()
+    }
+
+    if p.HeaderLen != uint8(p.header_len()) ||
+       buf.Len() < int(p.header_len()) - 8 {
+        return packet.Errorf(packet.ErrInvalidLength,
+                             "Invalid IS-IS Hello header")
+    }
+
+    buf.ReadN(&p.CircuitType)
+    p.CircuitType &= 0x03
+
+    p.SourceId = buf.Next(p.id_len())
+
+    buf.ReadN(&p.HoldingTime)
+    buf.ReadN(&p.PDULength)
+
+    if p.Type == P2PHello {
+        buf.ReadN(&p.LocalCircuitId)
+    } else {
+        buf.ReadN(&p.Priority)
+        p.Priority &= 0x7F
+
+        p.LANId = buf.Next(p.id_len() + 1)
+    }
+
+    if int(p.PDULength) < int(p.HeaderLen) ||
+       int(p.PDULength) - int(p.HeaderLen) > buf.Len() {
+        return packet.Errorf(packet.ErrInvalidLength,
+                             "Invalid IS-IS PDU length: %d", p.PDULength)
+    }
+
+    var err error
+
+    /* Hello PDUs may be padded up to the MTU with Padding TLVs, anything
+     * following the PDU length is ignored */
+    p.TLVs, err = packet.DecodeTLV8(buf.Next(int(p.PDULength - uint16(p.HeaderLen))))
+    if err != nil {
+        return err
+    }
+
+    return buf.Err()
+}
+
+func (p *Packet) Payload() packet.Packet {
+    return nil
+}
+
+func (p *Packet) RawBytes() []byte {
+    return p.pkt_raw
+}
+
+func (p *Packet) HeaderBytes() []byte {
+    return packet.HeaderBytes(p)
+}
+
+func (p *Packet) GuessPayloadType() packet.Type {
+    return packet.None
+}
+
+func (p *Packet) SetPayload(pl packet.Packet) error {
+    return nil
+}
+
+func (p *Packet) InitChecksum(csum uint32) {
+}
+
+func (p *Packet) Clone() packet.Packet {
+    c := *p
+
+    c.SourceId = packet.CloneBytes(p.SourceId)
+    c.LANId    = packet.CloneBytes(p.LANId)
+    c.TLVs     = packet.CloneTLVs(p.TLVs)
+    c.Data     = packet.CloneBytes(p.Data)
+
+    return &c
+}
+
+func (p *Packet) String() string {
+    return packet.Stringify(p)
+}
+
+// Check whether the packet is a LAN or point-to-point Hello PDU.
+func (p *Packet) IsHello() bool {
+    return p.Type == L1LANHello || p.Type == L2LANHello || p.Type == P2PHello
+}
+
+// Return the first TLV with the given type, or nil.
+func (p *Packet) TLV(t uint16) *packet.TLV {
+    for i := range p.TLVs {
+        if p.TLVs[i].Type == t {
+            return &p.TLVs[i]
+        }
+    }
+
+    return nil
+}
+
+/* length of the system IDs, where 0 stands for the default of 6 bytes */
+func (p *Packet) id_len() int {
+    switch p.IDLen {
+    case 0:   return 6
+    case 255: return 0
+    default:  return int(p.IDLen)
+    }
+}
+
+/* length of the fixed part of the PDU, only known for Hello PDUs since the
+ * body of the other ones is not decoded */
+func (p *Packet) length_indicator() uint8 {
+    if p.IsHello() {
+        return uint8(p.header_len())
+    }
+
+    return p.HeaderLen
+}
+
+func (p *Packet) header_len() uint16 {
+    switch p.Type {
+    case L1LANHello, L2LANHello:
+        return 8 + 7 + 2 * uint16(p.id_len())
+
+    case P2PHello:
+        return 8 + 6 + uint16(p.id_len())
+
+    default:
+        return 8
+    }
+}
+
+func (t PDUType) String() string {
+    switch t {
+    case L1LANHello: return "l1-lan-hello"
+    case L2LANHello: return "l2-lan-hello"
+    case P2PHello:   return "p2p-hello"
+    case L1LSP:      return "l1-lsp"
+    case L2LSP:      return "l2-lsp"
+    case L1CSNP:     return "l1-csnp"
+    case L2CSNP:     return "l2-csnp"
+    case L1PSNP:     return "l1-psnp"
+    case L2PSNP:     return "l2-psnp"
+    default:         return "unknown"
+    }
+}
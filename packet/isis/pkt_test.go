@@ -0,0 +1,166 @@
+/*
+ * Network packet analysis framework.
+ *
+ * Copyright (c) 2014, Alessandro Ghedini
+ * All rights reserved.
+ *
+ * Redistribution and use in source and binary forms, with or without
+ * modification, are permitted provided that the following conditions are
+ * met:
+ *
+ *     * Redistributions of source code must retain the above copyright
+ *       notice, this list of conditions and the following disclaimer.
+ *
+ *     * Redistributions in binary form must reproduce the above copyright
+ *       notice, this list of conditions and the following disclaimer in the
+ *       documentation and/or other materials provided with the distribution.
+ *
+ * THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS
+ * IS" AND ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO,
+ * THE IMPLIED WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR
+ * PURPOSE ARE DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT HOLDER OR
+ * CONTRIBUTORS BE LIABLE FOR ANY DIRECT, INDIRECT, INCIDENTAL, SPECIAL,
+ * EXEMPLARY, OR CONSEQUENTIAL DAMAGES (INCLUDING, BUT NOT LIMITED TO,
+ * PROCUREMENT OF SUBSTITUTE GOODS OR SERVICES; LOSS OF USE, DATA, OR
+ * PROFITS; OR BUSINESS INTERRUPTION) HOWEVER CAUSED AND ON ANY THEORY OF
+ * LIABILITY, WHETHER IN CONTRACT, STRICT LIABILITY, OR TORT (INCLUDING
+ * NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE OF THIS
+ * SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+ */
+package isis_test
+
+import "bytes"
+import "testing"
+
+import "github.com/adigal150/go.pkt/layers"
+import "github.com/adigal150/go.pkt/packet"
+import "github.com/adigal150/go.pkt/packet/isis"
+
+/* Level 1 LAN Hello with Area Addresses, Protocols Supported, IP Interface
+ * Address and IS Neighbors TLVs */
+var test_simple = []byte{
+    0x83, 0x1b, 0x01, 0x00, 0x0f, 0x01, 0x00, 0x03, 0x01, 0x00, 0x00, 0x00,
+    0x00, 0x00, 0x01, 0x00, 0x1e, 0x00, 0x32, 0x40, 0x00, 0x00, 0x00, 0x00,
+    0x00, 0x02, 0x01, 0x01, 0x04, 0x03, 0x49, 0x00, 0x01, 0x81, 0x01, 0xcc,
+    0x84, 0x04, 0x0a, 0x00, 0x00, 0x01, 0x06, 0x06, 0xaa, 0xbb, 0xcc, 0xdd,
+    0xee, 0xff,
+}
+
+var test_eth_llc = []byte{
+    0x01, 0x80, 0xc2, 0x00, 0x00, 0x14, 0x4c, 0x72, 0xb9, 0x54, 0xe5, 0x3d,
+    0x00, 0x35, 0xfe, 0xfe, 0x03,
+}
+
+func MakeTestSimple() *isis.Packet {
+    return &isis.Packet{
+        Type:        isis.L1LANHello,
+        Version:     1,
+        MaxAreas:    3,
+        CircuitType: 1,
+        SourceId:    []byte{ 0x00, 0x00, 0x00, 0x00, 0x00, 0x01 },
+        HoldingTime: 30,
+        Priority:    64,
+        LANId:       []byte{ 0x00, 0x00, 0x00, 0x00, 0x00, 0x02, 0x01 },
+        TLVs: []packet.TLV{
+            { Type: isis.AreaAddresses, Value: []byte{ 0x03, 0x49, 0x00, 0x01 } },
+            { Type: isis.ProtocolsSupported, Value: []byte{ 0xcc } },
+            { Type: isis.IPInterfaceAddr, Value: []byte{ 0x0a, 0x00, 0x00, 0x01 } },
+            {
+                Type:  isis.ISNeighbors,
+                Value: []byte{ 0xaa, 0xbb, 0xcc, 0xdd, 0xee, 0xff },
+            },
+        },
+    }
+}
+
+func TestPack(t *testing.T) {
+    var b packet.Buffer
+    b.Init(make([]byte, len(test_simple)))
+
+    p := MakeTestSimple()
+
+    if int(p.GetLength()) != len(test_simple) {
+        t.Fatalf("Length mismatch: %d", p.GetLength())
+    }
+
+    err := p.Pack(&b)
+    if err != nil {
+        t.Fatalf("Error packing: %s", err)
+    }
+
+    if !bytes.Equal(test_simple, b.Buffer()) {
+        t.Fatalf("Raw packet mismatch: %x", b.Buffer())
+    }
+}
+
+func BenchmarkPack(bn *testing.B) {
+    var b packet.Buffer
+    b.Init(make([]byte, len(test_simple)))
+
+    p := MakeTestSimple()
+
+    for n := 0; n < bn.N; n++ {
+        p.Pack(&b)
+    }
+}
+
+func TestUnpack(t *testing.T) {
+    var p isis.Packet
+
+    cmp := MakeTestSimple()
+
+    var b packet.Buffer
+    b.Init(test_simple)
+
+    err := p.Unpack(&b)
+    if err != nil {
+        t.Fatalf("Error unpacking: %s", err)
+    }
+
+    if !p.Equals(cmp) {
+        t.Fatalf("Packet mismatch:\n%s\n%s", &p, cmp)
+    }
+
+    if p.Type.String() != "l1-lan-hello" || p.PDULength != 50 {
+        t.Fatalf("Header mismatch: %s", &p)
+    }
+
+    if len(p.TLVs) != len(cmp.TLVs) {
+        t.Fatalf("TLVs mismatch: %v", p.TLVs)
+    }
+
+    for i := range p.TLVs {
+        if p.TLVs[i].Type != cmp.TLVs[i].Type ||
+           !bytes.Equal(p.TLVs[i].Value, cmp.TLVs[i].Value) {
+            t.Fatalf("TLV mismatch: %v", p.TLVs[i])
+        }
+    }
+}
+
+func BenchmarkUnpack(bn *testing.B) {
+    var p isis.Packet
+    var b packet.Buffer
+
+    for n := 0; n < bn.N; n++ {
+        b.Init(test_simple)
+        p.Unpack(&b)
+    }
+}
+
+func TestUnpackAllLLC(t *testing.T) {
+    data := append(append([]byte{}, test_eth_llc...), test_simple...)
+
+    p, err := layers.UnpackAll(data, packet.Eth)
+    if err != nil {
+        t.Fatalf("Error unpacking: %s", err)
+    }
+
+    hello := layers.FindLayer(p, packet.ISIS)
+    if hello == nil || !hello.Equals(MakeTestSimple()) {
+        t.Fatalf("IS-IS layer mismatch: %v", hello)
+    }
+
+    if hello.(*isis.Packet).TLV(isis.IPInterfaceAddr) == nil {
+        t.Fatalf("IP Interface Address not found")
+    }
+}
@@ -0,0 +1,153 @@
+/*
+ * Network packet analysis framework.
+ *
+ * Copyright (c) 2014, Alessandro Ghedini
+ * All rights reserved.
+ *
+ * Redistribution and use in source and binary forms, with or without
+ * modification, are permitted provided that the following conditions are
+ * met:
+ *
+ *     * Redistributions of source code must retain the above copyright
+ *       notice, this list of conditions and the following disclaimer.
+ *
+ *     * Redistributions in binary form must reproduce the above copyright
+ *       notice, this list of conditions and the following disclaimer in the
+ *       documentation and/or other materials provided with the distribution.
+ *
+ * THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS
+ * IS" AND ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO,
+ * THE IMPLIED WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR
+ * PURPOSE ARE DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT HOLDER OR
+ * CONTRIBUTORS BE LIABLE FOR ANY DIRECT, INDIRECT, INCIDENTAL, SPECIAL,
+ * EXEMPLARY, OR CONSEQUENTIAL DAMAGES (INCLUDING, BUT NOT LIMITED TO,
+ * PROCUREMENT OF SUBSTITUTE GOODS OR SERVICES; LOSS OF USE, DATA, OR
+ * PROFITS; OR BUSINESS INTERRUPTION) HOWEVER CAUSED AND ON ANY THEORY OF
+ * LIABILITY, WHETHER IN CONTRACT, STRICT LIABILITY, OR TORT (INCLUDING
+ * NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE OF THIS
+ * SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+ */
+
+package llc
+
+// Format of the control field.
+type Format uint8
+
+const (
+    IFormat Format = iota
+    SFormat
+    UFormat
+)
+
+// Command of a U-format frame, or function of an S-format frame, with the
+// poll/final bit cleared.
+type Command uint8
+
+const (
+    RR     Command = 0x01
+    RNR            = 0x05
+    REJ            = 0x09
+
+    UI             = 0x03
+    DM             = 0x0f
+    DISC           = 0x43
+    UA             = 0x63
+    SABME          = 0x6f
+    FRMR           = 0x87
+    XID            = 0xaf
+    TEST           = 0xe3
+)
+
+// Format identifier of the basic XID information field.
+const XIDBasicFormat = 0x81
+
+// Return the format of the control field.
+func (p *Packet) Format() Format {
+    if p.Control <= 0xff && p.Control & 0x3 == 0x3 {
+        return UFormat
+    }
+
+    if (p.Control >> 8) & 0x1 == 0 {
+        return IFormat
+    }
+
+    return SFormat
+}
+
+// Return the command of U-format frames or the function of S-format frames.
+// Zero is returned for I-format frames.
+func (p *Packet) Command() Command {
+    switch p.Format() {
+    case UFormat:
+        return Command(p.Control) &^ 0x10
+
+    case SFormat:
+        return Command(p.Control >> 8) & 0x0f
+    }
+
+    return 0
+}
+
+// Return the send sequence number N(S) of I-format frames, or zero.
+func (p *Packet) SendSeq() uint8 {
+    if p.Format() != IFormat {
+        return 0
+    }
+
+    return uint8(p.Control >> 9)
+}
+
+// Return the receive sequence number N(R) of I-format and S-format frames, or
+// zero.
+func (p *Packet) RecvSeq() uint8 {
+    if p.Format() == UFormat {
+        return 0
+    }
+
+    return uint8(p.Control) >> 1
+}
+
+// Return whether the poll/final bit is set.
+func (p *Packet) PollFinal() bool {
+    if p.Format() == UFormat {
+        return p.Control & 0x10 != 0
+    }
+
+    return p.Control & 0x01 != 0
+}
+
+func (p *Packet) header_len() uint16 {
+    length := uint16(3)
+
+    if p.Format() != UFormat {
+        length += 1
+    }
+
+    if p.has_xid_info() {
+        length += 3
+    }
+
+    return length
+}
+
+func (p *Packet) has_xid_info() bool {
+    return p.Format() == UFormat && p.Command() == XID &&
+           p.XIDFormat == XIDBasicFormat
+}
+
+func (c Command) String() string {
+    switch c {
+    case RR:    return "rr"
+    case RNR:   return "rnr"
+    case REJ:   return "rej"
+    case UI:    return "ui"
+    case DM:    return "dm"
+    case DISC:  return "disc"
+    case UA:    return "ua"
+    case SABME: return "sabme"
+    case FRMR:  return "frmr"
+    case XID:   return "xid"
+    case TEST:  return "test"
+    default:    return "unknown"
+    }
+}
@@ -29,8 +29,15 @@
  */
 
 // Provides encoding and decoding for LLC (802.2 Logical Link Control) packets.
+//
+// The control field is one byte long for U-format (unnumbered) frames, and two
+// bytes long for I-format (information) and S-format (supervisory) frames, in
+// which case the first byte is stored in the most significant bits of Control.
+// The only ambiguous values, I-format fields starting with a zero byte whose
+// second byte ends with two bits set, are treated as U-format ones.
 package llc
 
+
 import "github.com/adigal150/go.pkt/packet"
 
 type Packet struct {
@@ -38,7 +45,13 @@ type Packet struct {
     SSAP        uint8
     Control     uint16        `string:"ctrl"`
 
+    /* XID frames carrying the basic information field only */
+    XIDFormat   uint8         `string:"xid"`
+    XIDClass    uint8         `string:"class"`
+    XIDWindow   uint8         `string:"win"`
+
     pkt_payload packet.Packet `string:"skip"`
+    pkt_raw     []byte        `cmp:"skip" string:"skip"`
 }
 
 func Make() *Packet {
@@ -51,10 +64,10 @@ func (p *Packet) GetType() packet.Type {
 
 func (p *Packet) GetLength() uint16 {
     if p.pkt_payload != nil {
-        return p.pkt_payload.GetLength() + 2
+        return p.pkt_payload.GetLength() + p.header_len()
     }
 
-    return 2
+    return p.header_len()
 }
 
 func (p *Packet) Equals(other packet.Packet) bool {
@@ -69,19 +82,29 @@ func (p *Packet) Pack(buf *packet.Buffer) error {
     buf.WriteN(p.DSAP)
     buf.WriteN(p.SSAP)
 
-    if p.Control & 0x1 == 0 || p.Control & 0x3 == 0x1 {
+    if p.Format() != UFormat {
         buf.WriteN(p.Control)
     } else {
         buf.WriteN(uint8(p.Control))
     }
 
-    return nil
+    if p.has_xid_info() {
+        buf.WriteN(p.XIDFormat, p.XIDClass, p.XIDWindow)
+    }
+
+    return buf.Err()
 }
 
 func (p *Packet) Unpack(buf *packet.Buffer) error {
+    p.pkt_raw = buf.Bytes()
+
     buf.ReadN(&p.DSAP)
     buf.ReadN(&p.SSAP)
 
+    if buf.Len() < 1 {
+        return packet.Errorf(packet.ErrTruncated, "Invalid LLC header")
+    }
+
     if buf.Bytes()[:1][0] & 0x1 == 0 ||
        buf.Bytes()[:1][0] & 0x3 == 0x1 {
         buf.ReadN(&p.Control)
@@ -91,18 +114,39 @@ func (p *Packet) Unpack(buf *packet.Buffer) error {
         p.Control = uint16(ctrl)
     }
 
-    return nil
+    p.XIDFormat = 0
+    p.XIDClass  = 0
+    p.XIDWindow = 0
+
+    if p.Format() == UFormat && p.Command() == XID && buf.Len() >= 3 &&
+       buf.Bytes()[0] == XIDBasicFormat {
+        buf.ReadN(&p.XIDFormat, &p.XIDClass, &p.XIDWindow)
+    }
+
+    return buf.Err()
 }
 
 func (p *Packet) Payload() packet.Packet {
     return p.pkt_payload
 }
 
+func (p *Packet) RawBytes() []byte {
+    return p.pkt_raw
+}
+
+func (p *Packet) HeaderBytes() []byte {
+    return packet.HeaderBytes(p)
+}
+
 func (p *Packet) GuessPayloadType() packet.Type {
     if p.DSAP == 0xaa && p.SSAP == 0xaa {
         return packet.SNAP
     }
 
+    if p.DSAP == 0xfe && p.SSAP == 0xfe {
+        return packet.ISIS
+    }
+
     return packet.None
 }
 
@@ -115,6 +159,14 @@ func (p *Packet) SetPayload(pl packet.Packet) error {
 func (p *Packet) InitChecksum(csum uint32) {
 }
 
+func (p *Packet) Clone() packet.Packet {
+    c := *p
+
+    c.pkt_payload = packet.ClonePayload(p.pkt_payload)
+
+    return &c
+}
+
 func (p *Packet) String() string {
     return packet.Stringify(p)
 }
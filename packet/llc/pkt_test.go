@@ -102,3 +102,86 @@ func BenchmarkUnpack(bn *testing.B) {
         p.Unpack(&b)
     }
 }
+
+var test_xid = []byte{
+    0x00, 0x01, 0xbf, 0x81, 0x03, 0x0e,
+}
+
+func TestXID(t *testing.T) {
+    var p llc.Packet
+
+    var b packet.Buffer
+    b.Init(test_xid)
+
+    err := p.Unpack(&b)
+    if err != nil {
+        t.Fatalf("Error unpacking: %s", err)
+    }
+
+    if p.Format() != llc.UFormat || p.Command() != llc.XID ||
+       !p.PollFinal() {
+        t.Fatalf("Control mismatch: %s", &p)
+    }
+
+    if p.XIDFormat != llc.XIDBasicFormat || p.XIDClass != 3 ||
+       p.XIDWindow != 0x0e || b.Len() != 0 {
+        t.Fatalf("XID information mismatch: %s", &p)
+    }
+
+    if p.GetLength() != uint16(len(test_xid)) {
+        t.Fatalf("Length mismatch: %d", p.GetLength())
+    }
+
+    b.Init(make([]byte, len(test_xid)))
+
+    err = p.Pack(&b)
+    if err != nil {
+        t.Fatalf("Error packing: %s", err)
+    }
+
+    if !bytes.Equal(test_xid, b.Buffer()) {
+        t.Fatalf("Raw packet mismatch: %x", b.Buffer())
+    }
+}
+
+var test_iframe = []byte{
+    0xf0, 0xf0, 0x0a, 0x0b,
+}
+
+func TestIFrame(t *testing.T) {
+    var p llc.Packet
+
+    var b packet.Buffer
+    b.Init(test_iframe)
+
+    err := p.Unpack(&b)
+    if err != nil {
+        t.Fatalf("Error unpacking: %s", err)
+    }
+
+    if p.Format() != llc.IFormat || p.Command() != 0 {
+        t.Fatalf("Control mismatch: %s", &p)
+    }
+
+    if p.SendSeq() != 5 || p.RecvSeq() != 5 || !p.PollFinal() {
+        t.Fatalf("Sequence mismatch: %d %d", p.SendSeq(), p.RecvSeq())
+    }
+
+    b.Init(make([]byte, len(test_iframe)))
+
+    err = p.Pack(&b)
+    if err != nil {
+        t.Fatalf("Error packing: %s", err)
+    }
+
+    if !bytes.Equal(test_iframe, b.Buffer()) {
+        t.Fatalf("Raw packet mismatch: %x", b.Buffer())
+    }
+
+    p.Control = 0x0901
+
+    if p.Format() != llc.SFormat || p.Command() != llc.REJ ||
+       p.RecvSeq() != 0 || p.SendSeq() != 0 || !p.PollFinal() {
+        t.Fatalf("Control mismatch: %s", &p)
+    }
+}
@@ -0,0 +1,239 @@
+/*
+ * Network packet analysis framework.
+ *
+ * Copyright (c) 2014, Alessandro Ghedini
+ * All rights reserved.
+ *
+ * Redistribution and use in source and binary forms, with or without
+ * modification, are permitted provided that the following conditions are
+ * met:
+ *
+ *     * Redistributions of source code must retain the above copyright
+ *       notice, this list of conditions and the following disclaimer.
+ *
+ *     * Redistributions in binary form must reproduce the above copyright
+ *       notice, this list of conditions and the following disclaimer in the
+ *       documentation and/or other materials provided with the distribution.
+ *
+ * THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS
+ * IS" AND ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO,
+ * THE IMPLIED WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR
+ * PURPOSE ARE DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT HOLDER OR
+ * CONTRIBUTORS BE LIABLE FOR ANY DIRECT, INDIRECT, INCIDENTAL, SPECIAL,
+ * EXEMPLARY, OR CONSEQUENTIAL DAMAGES (INCLUDING, BUT NOT LIMITED TO,
+ * PROCUREMENT OF SUBSTITUTE GOODS OR SERVICES; LOSS OF USE, DATA, OR
+ * PROFITS; OR BUSINESS INTERRUPTION) HOWEVER CAUSED AND ON ANY THEORY OF
+ * LIABILITY, WHETHER IN CONTRACT, STRICT LIABILITY, OR TORT (INCLUDING
+ * NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE OF THIS
+ * SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+ */
+
+// Provides encoding and decoding for MACsec (IEEE 802.1AE) packets.
+//
+// Only the SecTAG is decoded. When the payload is encrypted it's left opaque,
+// otherwise it's decoded according to the EtherType that follows the SecTAG.
+// The ICV that terminates the frame is not removed.
+package macsec
+
+import "net"
+import "strings"
+
+import "github.com/adigal150/go.pkt/packet"
+import "github.com/adigal150/go.pkt/packet/eth"
+
+type Packet struct {
+    Flags        Flags
+    AN           uint8         `string:"an"`
+    ShortLen     uint8         `string:"sl"`
+    PacketNumber uint32        `string:"pn"`
+    SCI          uint64        `string:"sci"`
+    Type         eth.EtherType
+    pkt_payload  packet.Packet `cmp:"skip" string:"skip"`
+    pkt_raw      []byte        `cmp:"skip" string:"skip"`
+}
+
+type Flags uint8
+
+const (
+    EndStation   Flags = 0x40
+    SCIPresent         = 0x20
+    SingleCopy         = 0x10
+    Encrypted          = 0x08
+    Changed            = 0x04
+)
+
+func Make() *Packet {
+    return &Packet{
+        Flags: Encrypted | Changed,
+    }
+}
+
+func (p *Packet) GetType() packet.Type {
+    return packet.MACsec
+}
+
+func (p *Packet) GetLength() uint16 {
+    if p.pkt_payload != nil {
+        return p.pkt_payload.GetLength() + p.header_len()
+    }
+
+    return p.header_len()
+}
+
+func (p *Packet) Equals(other packet.Packet) bool {
+    return packet.Compare(p, other)
+}
+
+func (p *Packet) Answers(other packet.Packet) bool {
+    return false
+}
+
+func (p *Packet) Pack(buf *packet.Buffer) error {
+    buf.WriteN(uint8(p.Flags & 0x7C) | p.AN & 0x03)
+    buf.WriteN(p.ShortLen & 0x3F)
+    buf.WriteN(p.PacketNumber)
+
+    if p.Flags & SCIPresent != 0 {
+        buf.WriteN(p.SCI)
+    }
+
+    if p.Flags & Encrypted == 0 {
+        buf.WriteN(p.Type)
+    }
+
+    return buf.Err()
+}
+
+func (p *Packet) Unpack(buf *packet.Buffer) error {
+    p.pkt_raw = buf.Bytes()
+
+    if buf.Len() < 6 {
+        return packet.Errorf(packet.ErrTruncated, "Invalid MACsec SecTAG")
+    }
+
+    var tci uint8
+    buf.ReadN(&tci)
+
+    p.Flags = Flags(tci & 0x7C)
+    p.AN    = tci & 0x03
+
+    if buf.Len() < int(p.header_len()) - 1 {
+        return packet.Errorf(packet.ErrTruncated, "Invalid MACsec SecTAG")
+    }
+
+    buf.ReadN(&p.ShortLen)
+    p.ShortLen &= 0x3F
+
+    buf.ReadN(&p.PacketNumber)
+
+    if p.Flags & SCIPresent != 0 {
+        buf.ReadN(&p.SCI)
+    }
+
+    if p.Flags & Encrypted == 0 {
+        buf.ReadN(&p.Type)
+    }
+
+    return buf.Err()
+}
+
+func (p *Packet) Payload() packet.Packet {
+    return p.pkt_payload
+}
+
+func (p *Packet) RawBytes() []byte {
+    return p.pkt_raw
+}
+
+func (p *Packet) HeaderBytes() []byte {
+    return packet.HeaderBytes(p)
+}
+
+func (p *Packet) GuessPayloadType() packet.Type {
+    if p.Flags & Encrypted != 0 {
+        return packet.Raw
+    }
+
+    return eth.EtherTypeToType(p.Type)
+}
+
+func (p *Packet) SetPayload(pl packet.Packet) error {
+    p.pkt_payload = pl
+
+    if p.Flags & Encrypted == 0 {
+        p.Type = eth.TypeToEtherType(pl.GetType())
+    }
+
+    return nil
+}
+
+func (p *Packet) InitChecksum(csum uint32) {
+}
+
+func (p *Packet) Clone() packet.Packet {
+    c := *p
+
+    c.pkt_payload = packet.ClonePayload(p.pkt_payload)
+
+    return &c
+}
+
+func (p *Packet) String() string {
+    return packet.Stringify(p)
+}
+
+func (p *Packet) header_len() uint16 {
+    length := uint16(6)
+
+    if p.Flags & SCIPresent != 0 {
+        length += 8
+    }
+
+    if p.Flags & Encrypted == 0 {
+        length += 2
+    }
+
+    return length
+}
+
+// Return the MAC address part of the Secure Channel Identifier.
+func (p *Packet) SCIAddr() net.HardwareAddr {
+    addr := make(net.HardwareAddr, 6)
+
+    for i := 0; i < 6; i++ {
+        addr[i] = byte(p.SCI >> uint(56 - i * 8))
+    }
+
+    return addr
+}
+
+// Return the port part of the Secure Channel Identifier.
+func (p *Packet) SCIPort() uint16 {
+    return uint16(p.SCI)
+}
+
+func (f Flags) String() string {
+    var flags []string
+
+    if f & EndStation != 0 {
+        flags = append(flags, "es")
+    }
+
+    if f & SCIPresent != 0 {
+        flags = append(flags, "sc")
+    }
+
+    if f & SingleCopy != 0 {
+        flags = append(flags, "scb")
+    }
+
+    if f & Encrypted != 0 {
+        flags = append(flags, "e")
+    }
+
+    if f & Changed != 0 {
+        flags = append(flags, "c")
+    }
+
+    return strings.Join(flags, "|")
+}
@@ -0,0 +1,113 @@
+/*
+ * Network packet analysis framework.
+ *
+ * Copyright (c) 2014, Alessandro Ghedini
+ * All rights reserved.
+ *
+ * Redistribution and use in source and binary forms, with or without
+ * modification, are permitted provided that the following conditions are
+ * met:
+ *
+ *     * Redistributions of source code must retain the above copyright
+ *       notice, this list of conditions and the following disclaimer.
+ *
+ *     * Redistributions in binary form must reproduce the above copyright
+ *       notice, this list of conditions and the following disclaimer in the
+ *       documentation and/or other materials provided with the distribution.
+ *
+ * THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS
+ * IS" AND ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO,
+ * THE IMPLIED WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR
+ * PURPOSE ARE DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT HOLDER OR
+ * CONTRIBUTORS BE LIABLE FOR ANY DIRECT, INDIRECT, INCIDENTAL, SPECIAL,
+ * EXEMPLARY, OR CONSEQUENTIAL DAMAGES (INCLUDING, BUT NOT LIMITED TO,
+ * PROCUREMENT OF SUBSTITUTE GOODS OR SERVICES; LOSS OF USE, DATA, OR
+ * PROFITS; OR BUSINESS INTERRUPTION) HOWEVER CAUSED AND ON ANY THEORY OF
+ * LIABILITY, WHETHER IN CONTRACT, STRICT LIABILITY, OR TORT (INCLUDING
+ * NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE OF THIS
+ * SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+ */
+
+package packet
+
+import "strconv"
+
+var protocol_names = map[uint8]string{
+    1:   "icmp",
+    2:   "igmp",
+    4:   "ipip",
+    6:   "tcp",
+    17:  "udp",
+    41:  "ipv6",
+    47:  "gre",
+    50:  "esp",
+    51:  "ah",
+    58:  "ipv6-icmp",
+    89:  "ospf",
+    97:  "etherip",
+    103: "pim",
+    112: "vrrp",
+    115: "l2tp",
+    132: "sctp",
+    136: "udplite",
+}
+
+var port_names = map[uint16]string{
+    20:   "ftp-data",
+    21:   "ftp",
+    22:   "ssh",
+    23:   "telnet",
+    25:   "smtp",
+    53:   "domain",
+    67:   "bootps",
+    68:   "bootpc",
+    69:   "tftp",
+    80:   "http",
+    110:  "pop3",
+    123:  "ntp",
+    137:  "netbios-ns",
+    143:  "imap",
+    161:  "snmp",
+    162:  "snmptrap",
+    179:  "bgp",
+    389:  "ldap",
+    443:  "https",
+    445:  "microsoft-ds",
+    514:  "syslog",
+    546:  "dhcpv6-client",
+    547:  "dhcpv6-server",
+    587:  "submission",
+    993:  "imaps",
+    995:  "pop3s",
+    1701: "l2tp",
+    1812: "radius",
+    3306: "mysql",
+    3389: "ms-wbt-server",
+    4789: "vxlan",
+    5060: "sip",
+    5061: "sips",
+    5432: "postgresql",
+    8080: "http-alt",
+}
+
+// Return the IANA keyword of the given IP protocol number (e.g. "tcp"), or the
+// number itself if the protocol is not a common one.
+func ProtocolName(proto uint8) string {
+    name, ok := protocol_names[proto]
+    if !ok {
+        return strconv.Itoa(int(proto))
+    }
+
+    return name
+}
+
+// Return the IANA service name of the given well-known TCP or UDP port (e.g.
+// "http"), or the number itself if the port is not a common one.
+func PortName(port uint16) string {
+    name, ok := port_names[port]
+    if !ok {
+        return strconv.Itoa(int(port))
+    }
+
+    return name
+}
@@ -0,0 +1,70 @@
+/*
+ * Network packet analysis framework.
+ *
+ * Copyright (c) 2014, Alessandro Ghedini
+ * All rights reserved.
+ *
+ * Redistribution and use in source and binary forms, with or without
+ * modification, are permitted provided that the following conditions are
+ * met:
+ *
+ *     * Redistributions of source code must retain the above copyright
+ *       notice, this list of conditions and the following disclaimer.
+ *
+ *     * Redistributions in binary form must reproduce the above copyright
+ *       notice, this list of conditions and the following disclaimer in the
+ *       documentation and/or other materials provided with the distribution.
+ *
+ * THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS
+ * IS" AND ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO,
+ * THE IMPLIED WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR
+ * PURPOSE ARE DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT HOLDER OR
+ * CONTRIBUTORS BE LIABLE FOR ANY DIRECT, INDIRECT, INCIDENTAL, SPECIAL,
+ * EXEMPLARY, OR CONSEQUENTIAL DAMAGES (INCLUDING, BUT NOT LIMITED TO,
+ * PROCUREMENT OF SUBSTITUTE GOODS OR SERVICES; LOSS OF USE, DATA, OR
+ * PROFITS; OR BUSINESS INTERRUPTION) HOWEVER CAUSED AND ON ANY THEORY OF
+ * LIABILITY, WHETHER IN CONTRACT, STRICT LIABILITY, OR TORT (INCLUDING
+ * NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE OF THIS
+ * SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+ */
+
+package packet_test
+
+import "testing"
+
+import "github.com/adigal150/go.pkt/packet"
+
+func TestProtocolName(t *testing.T) {
+    names := map[uint8]string{
+        1:   "icmp",
+        6:   "tcp",
+        17:  "udp",
+        47:  "gre",
+        58:  "ipv6-icmp",
+        253: "253",
+    }
+
+    for proto, name := range names {
+        if packet.ProtocolName(proto) != name {
+            t.Fatalf("Name mismatch for %d: %s", proto,
+                     packet.ProtocolName(proto))
+        }
+    }
+}
+
+func TestPortName(t *testing.T) {
+    names := map[uint16]string{
+        22:    "ssh",
+        53:    "domain",
+        80:    "http",
+        443:   "https",
+        5060:  "sip",
+        41562: "41562",
+    }
+
+    for port, name := range names {
+        if packet.PortName(port) != name {
+            t.Fatalf("Name mismatch for %d: %s", port, packet.PortName(port))
+        }
+    }
+}
@@ -0,0 +1,719 @@
+/*
+ * Network packet analysis framework.
+ *
+ * Copyright (c) 2014, Alessandro Ghedini
+ * All rights reserved.
+ *
+ * Redistribution and use in source and binary forms, with or without
+ * modification, are permitted provided that the following conditions are
+ * met:
+ *
+ *     * Redistributions of source code must retain the above copyright
+ *       notice, this list of conditions and the following disclaimer.
+ *
+ *     * Redistributions in binary form must reproduce the above copyright
+ *       notice, this list of conditions and the following disclaimer in the
+ *       documentation and/or other materials provided with the distribution.
+ *
+ * THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS
+ * IS" AND ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO,
+ * THE IMPLIED WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR
+ * PURPOSE ARE DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT HOLDER OR
+ * CONTRIBUTORS BE LIABLE FOR ANY DIRECT, INDIRECT, INCIDENTAL, SPECIAL,
+ * EXEMPLARY, OR CONSEQUENTIAL DAMAGES (INCLUDING, BUT NOT LIMITED TO,
+ * PROCUREMENT OF SUBSTITUTE GOODS OR SERVICES; LOSS OF USE, DATA, OR
+ * PROFITS; OR BUSINESS INTERRUPTION) HOWEVER CAUSED AND ON ANY THEORY OF
+ * LIABILITY, WHETHER IN CONTRACT, STRICT LIABILITY, OR TORT (INCLUDING
+ * NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE OF THIS
+ * SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+ */
+
+// Provides encoding and decoding for NetFlow v5, NetFlow v9 and IPFIX packets.
+//
+// NetFlow v9 and IPFIX data records can only be interpreted using the template
+// that describes them, which is usually sent in a previous packet. When a
+// packet has a TemplateCache, templates are stored in it when decoded, and
+// looked up when data records are found. Otherwise only the templates of the
+// same packet are used, so that decoding doesn't keep state between packets.
+// Data flowsets whose template is not known yet are kept as raw bytes.
+package netflow
+
+import "encoding/binary"
+import "fmt"
+import "net"
+import "sync"
+
+import "github.com/adigal150/go.pkt/packet"
+import "github.com/adigal150/go.pkt/packet/udp"
+
+type Packet struct {
+    Version          uint16        `string:"ver"`
+    Count            uint16
+    Length           uint16        `string:"len"`
+    SysUptime        uint32        `string:"uptime"`
+    UnixSecs         uint32        `string:"secs"`
+    UnixNsecs        uint32        `string:"nsecs"`
+    Sequence         uint32        `string:"seq"`
+
+    /* NetFlow v5 only */
+    EngineType       uint8
+    EngineId         uint8
+    SamplingInterval uint16        `string:"sampling"`
+
+    /* NetFlow v9 source ID, or IPFIX observation domain ID */
+    SourceId         uint32        `string:"src"`
+
+    Records          []V5Record    `cmp:"skip" string:"skip"`
+    FlowSets         []FlowSet     `cmp:"skip" string:"skip"`
+
+    // Cache used to store and look up templates. If nil, templates are only
+    // used for the data records of the same packet. When decoding with
+    // layers.UnpackAllWith() it can be set with packet.DecodeOptions.Prepare.
+    Templates        *TemplateCache `cmp:"skip" string:"skip"`
+
+    pkt_raw          []byte         `cmp:"skip" string:"skip"`
+}
+
+// NetFlow v5 flow record.
+type V5Record struct {
+    SrcAddr  net.IP
+    DstAddr  net.IP
+    NextHop  net.IP
+    Input    uint16
+    Output   uint16
+    Packets  uint32
+    Octets   uint32
+    First    uint32
+    Last     uint32
+    SrcPort  uint16
+    DstPort  uint16
+    TCPFlags uint8
+    Protocol uint8
+    TOS      uint8
+    SrcAS    uint16
+    DstAS    uint16
+    SrcMask  uint8
+    DstMask  uint8
+}
+
+// NetFlow v9 flowset, or IPFIX set. Depending on the ID, either Templates or
+// Records is filled. Data is only set when the flowset could not be decoded
+// (e.g. options templates, or data records with an unknown template).
+type FlowSet struct {
+    Id        uint16
+    Templates []Template
+    Records   []DataRecord
+    Data      []byte
+}
+
+type Template struct {
+    Id     uint16
+    Fields []Field
+}
+
+type Field struct {
+    Type         uint16
+    Length       uint16
+
+    /* IPFIX enterprise-specific fields only */
+    EnterpriseId uint32
+}
+
+// Length value of IPFIX variable-length fields.
+const VariableLength = 0xFFFF
+
+type DataRecord struct {
+    Fields []Field
+    Values [][]byte
+}
+
+const (
+    V9TemplateId        uint16 = 0
+    V9OptionsTemplateId        = 1
+    TemplateId                 = 2
+    OptionsTemplateId          = 3
+)
+
+// Cache of the templates received from exporters, indexed by source ID (or
+// observation domain ID) and template ID. At most MaxSourceTemplates templates
+// are stored for each source, to bound the memory that a misbehaving (or
+// forged) exporter can use. It is safe for concurrent use.
+type TemplateCache struct {
+    mutex     sync.Mutex
+    templates map[template_key]*Template
+    counts    map[source_key]int
+}
+
+// Maximum number of templates stored by a TemplateCache for each source.
+const MaxSourceTemplates = 256
+
+type template_key struct {
+    version uint16
+    source  uint32
+    id      uint16
+}
+
+type source_key struct {
+    version uint16
+    source  uint32
+}
+
+func init() {
+    udp.RegisterPort(2055, packet.NetFlow)
+    udp.RegisterPort(4739, packet.NetFlow)
+}
+
+func Make() *Packet {
+    return &Packet{
+        Version: 10,
+    }
+}
+
+// Create a new empty template cache.
+func NewTemplateCache() *TemplateCache {
+    return &TemplateCache{
+        templates: map[template_key]*Template{},
+        counts:    map[source_key]int{},
+    }
+}
+
+// Store a template received with the given version and source ID, replacing
+// any previous template with the same ID. New templates are ignored once the
+// source has MaxSourceTemplates of them.
+func (c *TemplateCache) Add(version uint16, source uint32, t *Template) {
+    c.mutex.Lock()
+    defer c.mutex.Unlock()
+
+    key := template_key{ version, source, t.Id }
+    src := source_key{ version, source }
+
+    if _, ok := c.templates[key]; !ok {
+        if c.counts[src] >= MaxSourceTemplates {
+            return
+        }
+
+        c.counts[src] += 1
+    }
+
+    c.templates[key] = t
+}
+
+// Look up the template with the given version, source ID and template ID, or
+// return nil if it's not known.
+func (c *TemplateCache) Get(version uint16, source uint32, id uint16) *Template {
+    c.mutex.Lock()
+    defer c.mutex.Unlock()
+
+    return c.templates[template_key{ version, source, id }]
+}
+
+func (p *Packet) GetType() packet.Type {
+    return packet.NetFlow
+}
+
+func (p *Packet) GetLength() uint16 {
+    switch p.Version {
+    case 5:
+        return uint16(24 + 48 * len(p.Records))
+
+    case 9:
+        return uint16(20 + p.flowsets_len())
+
+    default:
+        return uint16(16 + p.flowsets_len())
+    }
+}
+
+func (p *Packet) Equals(other packet.Packet) bool {
+    return packet.Compare(p, other)
+}
+
+func (p *Packet) Answers(other packet.Packet) bool {
+    return false
+}
+
+func (p *Packet) Pack(buf *packet.Buffer) error {
+    buf.WriteN(p.Version)
+
+    switch p.Version {
+    case 5:
+        buf.WriteN(uint16(len(p.Records)))
+        buf.WriteN(p.SysUptime)
+        buf.WriteN(p.UnixSecs)
+        buf.WriteN(p.UnixNsecs)
+        buf.WriteN(p.Sequence)
+        buf.WriteN(p.EngineType)
+        buf.WriteN(p.EngineId)
+        buf.WriteN(p.SamplingInterval)
+
+        for _, r := range p.Records {
+            buf.Write(r.SrcAddr.To4())
+            buf.Write(r.DstAddr.To4())
+            buf.Write(r.NextHop.To4())
+            buf.WriteN(r.Input)
+            buf.WriteN(r.Output)
+            buf.WriteN(r.Packets)
+            buf.WriteN(r.Octets)
+            buf.WriteN(r.First)
+            buf.WriteN(r.Last)
+            buf.WriteN(r.SrcPort)
+            buf.WriteN(r.DstPort)
+            buf.WriteN(uint8(0x00))
+            buf.WriteN(r.TCPFlags)
+            buf.WriteN(r.Protocol)
+            buf.WriteN(r.TOS)
+            buf.WriteN(r.SrcAS)
+            buf.WriteN(r.DstAS)
+            buf.WriteN(r.SrcMask)
+            buf.WriteN(r.DstMask)
+            buf.WriteN(uint16(0x00))
+        }
+
+        return buf.Err()
+
+    case 9:
+        buf.WriteN(p.Count)
+        buf.WriteN(p.SysUptime)
+        buf.WriteN(p.UnixSecs)
+        buf.WriteN(p.Sequence)
+        buf.WriteN(p.SourceId)
+
+    case 10:
+        buf.WriteN(p.GetLength())
+        buf.WriteN(p.UnixSecs)
+        buf.WriteN(p.Sequence)
+        buf.WriteN(p.SourceId)
+
+    default:
+        return fmt.Errorf("Unsupported NetFlow version: %d", p.Version)
+    }
+
+    for _, fs := range p.FlowSets {
+        data := fs.pack(p.Version)
+
+        buf.WriteN(fs.Id)
+        buf.WriteN(uint16(4 + len(data)))
+        buf.Write(data)
+    }
+
+    return buf.Err()
+}
+
+func (p *Packet) Unpack(buf *packet.Buffer) error {
+    p.pkt_raw = buf.Bytes()
+
+    if buf.Len() < 2 {
+        return packet.Errorf(packet.ErrTruncated, "Invalid NetFlow header")
+    }
+
+    buf.ReadN(&p.Version)
+
+    switch p.Version {
+    case 5:
+        if buf.Len() < 22 {
+            return packet.Errorf(packet.ErrTruncated,
+                                 "Invalid NetFlow v5 header")
+        }
+
+        buf.ReadN(&p.Count)
+        buf.ReadN(&p.SysUptime)
+        buf.ReadN(&p.UnixSecs)
+        buf.ReadN(&p.UnixNsecs)
+        buf.ReadN(&p.Sequence)
+        buf.ReadN(&p.EngineType)
+        buf.ReadN(&p.EngineId)
+        buf.ReadN(&p.SamplingInterval)
+
+        if buf.Len() < 48 * int(p.Count) {
+            return packet.Errorf(packet.ErrTruncated,
+                                 "Invalid NetFlow v5 record count: %d", p.Count)
+        }
+
+        p.Records = nil
+
+        for i := 0; i < int(p.Count); i++ {
+            p.Records = append(p.Records, unpack_v5_record(buf.Next(48)))
+        }
+
+        return buf.Err()
+
+    case 9:
+        if buf.Len() < 18 {
+            return packet.Errorf(packet.ErrTruncated,
+                                 "Invalid NetFlow v9 header")
+        }
+
+        buf.ReadN(&p.Count)
+        buf.ReadN(&p.SysUptime)
+        buf.ReadN(&p.UnixSecs)
+        buf.ReadN(&p.Sequence)
+        buf.ReadN(&p.SourceId)
+
+    case 10:
+        if buf.Len() < 14 {
+            return packet.Errorf(packet.ErrTruncated, "Invalid IPFIX header")
+        }
+
+        buf.ReadN(&p.Length)
+        buf.ReadN(&p.UnixSecs)
+        buf.ReadN(&p.Sequence)
+        buf.ReadN(&p.SourceId)
+
+    default:
+        return packet.Errorf(packet.ErrUnsupported,
+                             "Unsupported NetFlow version: %d", p.Version)
+    }
+
+    data := buf.Next(buf.Len())
+
+    if p.Version == 10 && int(p.Length) - 16 < len(data) && p.Length >= 16 {
+        data = data[:p.Length - 16]
+    }
+
+    /* without a cache, keep the templates for this packet only */
+    cache := p.Templates
+    if cache == nil {
+        cache = NewTemplateCache()
+    }
+
+    p.FlowSets = nil
+
+    for len(data) > 0 {
+        if len(data) < 4 {
+            return packet.Errorf(packet.ErrTruncated,
+                                 "Invalid NetFlow flowset header")
+        }
+
+        fs := FlowSet{ Id: binary.BigEndian.Uint16(data[0:2]) }
+
+        length := int(binary.BigEndian.Uint16(data[2:4]))
+        if length < 4 || length > len(data) {
+            return packet.Errorf(packet.ErrInvalidLength,
+                                 "Invalid NetFlow flowset length: %d", length)
+        }
+
+        err := fs.unpack(p.Version, p.SourceId, cache, data[4:length])
+        if err != nil {
+            return err
+        }
+
+        p.FlowSets = append(p.FlowSets, fs)
+
+        data = data[length:]
+    }
+
+    return buf.Err()
+}
+
+func (p *Packet) Payload() packet.Packet {
+    return nil
+}
+
+func (p *Packet) RawBytes() []byte {
+    return p.pkt_raw
+}
+
+func (p *Packet) HeaderBytes() []byte {
+    return packet.HeaderBytes(p)
+}
+
+func (p *Packet) GuessPayloadType() packet.Type {
+    return packet.None
+}
+
+func (p *Packet) SetPayload(pl packet.Packet) error {
+    return nil
+}
+
+func (p *Packet) InitChecksum(csum uint32) {
+}
+
+func (p *Packet) Clone() packet.Packet {
+    c := *p
+
+    if p.Records != nil {
+        c.Records = make([]V5Record, len(p.Records))
+
+        for i, rec := range p.Records {
+            rec.SrcAddr = packet.CloneBytes(rec.SrcAddr)
+            rec.DstAddr = packet.CloneBytes(rec.DstAddr)
+            rec.NextHop = packet.CloneBytes(rec.NextHop)
+
+            c.Records[i] = rec
+        }
+    }
+
+    if p.FlowSets != nil {
+        c.FlowSets = make([]FlowSet, len(p.FlowSets))
+
+        for i, set := range p.FlowSets {
+            c.FlowSets[i] = set.clone()
+        }
+    }
+
+    return &c
+}
+
+func (p *Packet) String() string {
+    return packet.Stringify(p)
+}
+
+// Return the value of the first field of the given type, or nil.
+func (r *DataRecord) Value(field_type uint16) []byte {
+    for i, f := range r.Fields {
+        if f.Type == field_type && f.EnterpriseId == 0 {
+            return r.Values[i]
+        }
+    }
+
+    return nil
+}
+
+func (p *Packet) flowsets_len() int {
+    length := 0
+
+    for _, fs := range p.FlowSets {
+        length += 4 + len(fs.pack(p.Version))
+    }
+
+    return length
+}
+
+func (fs *FlowSet) is_template(version uint16) bool {
+    if version == 9 {
+        return fs.Id == V9TemplateId
+    }
+
+    return fs.Id == TemplateId
+}
+
+func (fs *FlowSet) pack(version uint16) []byte {
+    var data []byte
+
+    switch {
+    case fs.Data != nil:
+        return fs.Data
+
+    case fs.is_template(version):
+        for _, t := range fs.Templates {
+            data = append_uint16(data, t.Id)
+            data = append_uint16(data, uint16(len(t.Fields)))
+
+            for _, f := range t.Fields {
+                if f.EnterpriseId != 0 {
+                    data = append_uint16(data, f.Type | 0x8000)
+                    data = append_uint16(data, f.Length)
+                    data = append_uint16(data, uint16(f.EnterpriseId >> 16))
+                    data = append_uint16(data, uint16(f.EnterpriseId))
+                } else {
+                    data = append_uint16(data, f.Type)
+                    data = append_uint16(data, f.Length)
+                }
+            }
+        }
+
+    case fs.Id >= 256:
+        for _, r := range fs.Records {
+            for i, v := range r.Values {
+                if r.Fields[i].Length == VariableLength {
+                    if len(v) < 255 {
+                        data = append(data, byte(len(v)))
+                    } else {
+                        data = append(data, 0xFF)
+                        data = append_uint16(data, uint16(len(v)))
+                    }
+                }
+
+                data = append(data, v...)
+            }
+        }
+    }
+
+    /* pad to a 4 bytes boundary */
+    for len(data) % 4 != 0 {
+        data = append(data, 0x00)
+    }
+
+    return data
+}
+
+func (fs *FlowSet) unpack(version uint16, source uint32, cache *TemplateCache, data []byte) error {
+    switch {
+    case fs.is_template(version):
+        for len(data) >= 4 {
+            t := Template{
+                Id: binary.BigEndian.Uint16(data[0:2]),
+            }
+
+            count := int(binary.BigEndian.Uint16(data[2:4]))
+            data = data[4:]
+
+            /* padding */
+            if t.Id == 0 && count == 0 {
+                break
+            }
+
+            for i := 0; i < count; i++ {
+                if len(data) < 4 {
+                    return packet.Errorf(packet.ErrTruncated,
+                                         "Invalid NetFlow template field")
+                }
+
+                f := Field{
+                    Type:   binary.BigEndian.Uint16(data[0:2]),
+                    Length: binary.BigEndian.Uint16(data[2:4]),
+                }
+
+                data = data[4:]
+
+                if version == 10 && f.Type & 0x8000 != 0 {
+                    if len(data) < 4 {
+                        return packet.Errorf(packet.ErrTruncated,
+                                             "Invalid NetFlow template field")
+                    }
+
+                    f.Type        &= 0x7FFF
+                    f.EnterpriseId = binary.BigEndian.Uint32(data[0:4])
+
+                    data = data[4:]
+                }
+
+                t.Fields = append(t.Fields, f)
+            }
+
+            cache.Add(version, source, &t)
+
+            fs.Templates = append(fs.Templates, t)
+        }
+
+    case fs.Id >= 256:
+        t := cache.Get(version, source, fs.Id)
+        if t == nil {
+            fs.Data = data
+            return nil
+        }
+
+        min_len := 0
+
+        for _, f := range t.Fields {
+            if f.Length == VariableLength {
+                min_len += 1
+            } else {
+                min_len += int(f.Length)
+            }
+        }
+
+        if min_len == 0 {
+            fs.Data = data
+            return nil
+        }
+
+        for len(data) >= min_len {
+            r := DataRecord{ Fields: t.Fields }
+
+            for _, f := range t.Fields {
+                l := int(f.Length)
+
+                if f.Length == VariableLength {
+                    if len(data) < 1 {
+                        return packet.Errorf(packet.ErrTruncated,
+                                             "Invalid NetFlow field length")
+                    }
+
+                    l = int(data[0])
+                    data = data[1:]
+
+                    if l == 255 {
+                        if len(data) < 2 {
+                            return packet.Errorf(packet.ErrTruncated,
+                                                 "Invalid NetFlow field length")
+                        }
+
+                        l = int(binary.BigEndian.Uint16(data[0:2]))
+                        data = data[2:]
+                    }
+                }
+
+                if l > len(data) {
+                    return packet.Errorf(packet.ErrTruncated,
+                                         "Invalid NetFlow field length: %d", l)
+                }
+
+                r.Values = append(r.Values, data[:l])
+                data = data[l:]
+            }
+
+            fs.Records = append(fs.Records, r)
+        }
+
+    default:
+        fs.Data = data
+    }
+
+    return nil
+}
+
+func unpack_v5_record(data []byte) V5Record {
+    return V5Record{
+        SrcAddr:  net.IP(data[0:4]),
+        DstAddr:  net.IP(data[4:8]),
+        NextHop:  net.IP(data[8:12]),
+        Input:    binary.BigEndian.Uint16(data[12:14]),
+        Output:   binary.BigEndian.Uint16(data[14:16]),
+        Packets:  binary.BigEndian.Uint32(data[16:20]),
+        Octets:   binary.BigEndian.Uint32(data[20:24]),
+        First:    binary.BigEndian.Uint32(data[24:28]),
+        Last:     binary.BigEndian.Uint32(data[28:32]),
+        SrcPort:  binary.BigEndian.Uint16(data[32:34]),
+        DstPort:  binary.BigEndian.Uint16(data[34:36]),
+        TCPFlags: data[37],
+        Protocol: data[38],
+        TOS:      data[39],
+        SrcAS:    binary.BigEndian.Uint16(data[40:42]),
+        DstAS:    binary.BigEndian.Uint16(data[42:44]),
+        SrcMask:  data[44],
+        DstMask:  data[45],
+    }
+}
+
+func append_uint16(data []byte, v uint16) []byte {
+    return append(data, byte(v >> 8), byte(v))
+}
+
+func (s FlowSet) clone() FlowSet {
+    s.Data = packet.CloneBytes(s.Data)
+
+    if s.Templates != nil {
+        templates := make([]Template, len(s.Templates))
+
+        for i, t := range s.Templates {
+            templates[i] = Template{
+                Id:     t.Id,
+                Fields: append([]Field(nil), t.Fields...),
+            }
+        }
+
+        s.Templates = templates
+    }
+
+    if s.Records != nil {
+        records := make([]DataRecord, len(s.Records))
+
+        for i, rec := range s.Records {
+            values := make([][]byte, len(rec.Values))
+
+            for j, v := range rec.Values {
+                values[j] = packet.CloneBytes(v)
+            }
+
+            records[i] = DataRecord{
+                Fields: append([]Field(nil), rec.Fields...),
+                Values: values,
+            }
+        }
+
+        s.Records = records
+    }
+
+    return s
+}
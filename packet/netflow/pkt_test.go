@@ -0,0 +1,358 @@
+/*
+ * Network packet analysis framework.
+ *
+ * Copyright (c) 2014, Alessandro Ghedini
+ * All rights reserved.
+ *
+ * Redistribution and use in source and binary forms, with or without
+ * modification, are permitted provided that the following conditions are
+ * met:
+ *
+ *     * Redistributions of source code must retain the above copyright
+ *       notice, this list of conditions and the following disclaimer.
+ *
+ *     * Redistributions in binary form must reproduce the above copyright
+ *       notice, this list of conditions and the following disclaimer in the
+ *       documentation and/or other materials provided with the distribution.
+ *
+ * THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS
+ * IS" AND ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO,
+ * THE IMPLIED WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR
+ * PURPOSE ARE DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT HOLDER OR
+ * CONTRIBUTORS BE LIABLE FOR ANY DIRECT, INDIRECT, INCIDENTAL, SPECIAL,
+ * EXEMPLARY, OR CONSEQUENTIAL DAMAGES (INCLUDING, BUT NOT LIMITED TO,
+ * PROCUREMENT OF SUBSTITUTE GOODS OR SERVICES; LOSS OF USE, DATA, OR
+ * PROFITS; OR BUSINESS INTERRUPTION) HOWEVER CAUSED AND ON ANY THEORY OF
+ * LIABILITY, WHETHER IN CONTRACT, STRICT LIABILITY, OR TORT (INCLUDING
+ * NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE OF THIS
+ * SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+ */
+
+package netflow_test
+
+import "bytes"
+import "net"
+import "testing"
+
+import "github.com/adigal150/go.pkt/layers"
+import "github.com/adigal150/go.pkt/packet"
+import "github.com/adigal150/go.pkt/packet/netflow"
+
+var test_simple = []byte{
+    0x00, 0x05, 0x00, 0x01, 0x00, 0x01, 0xe2, 0x40, 0x53, 0x72, 0x4e, 0x00,
+    0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x2a, 0x00, 0x00, 0x00, 0x00,
+    0x0a, 0x00, 0x00, 0x01, 0x0a, 0x00, 0x00, 0x02, 0xc0, 0xa8, 0x01, 0x01,
+    0x00, 0x01, 0x00, 0x02, 0x00, 0x00, 0x00, 0x0a, 0x00, 0x00, 0x05, 0xdc,
+    0x00, 0x00, 0x03, 0xe8, 0x00, 0x00, 0x07, 0xd0, 0x9c, 0x40, 0x00, 0x50,
+    0x00, 0x1b, 0x06, 0x00, 0xfc, 0x00, 0xfc, 0x01, 0x18, 0x10, 0x00, 0x00,
+}
+
+var test_ipfix_template = []byte{
+    0x00, 0x0a, 0x00, 0x2c, 0x53, 0x72, 0x4e, 0x00, 0x00, 0x00, 0x00, 0x01,
+    0x00, 0x00, 0x00, 0x07, 0x00, 0x02, 0x00, 0x1c, 0x01, 0x00, 0x00, 0x05,
+    0x00, 0x08, 0x00, 0x04, 0x00, 0x0c, 0x00, 0x04, 0x00, 0x07, 0x00, 0x02,
+    0x00, 0x0b, 0x00, 0x02, 0x00, 0x04, 0x00, 0x01,
+}
+
+var test_ipfix_data = []byte{
+    0x00, 0x0a, 0x00, 0x24, 0x53, 0x72, 0x4e, 0x01, 0x00, 0x00, 0x00, 0x02,
+    0x00, 0x00, 0x00, 0x07, 0x01, 0x00, 0x00, 0x14, 0x0a, 0x00, 0x00, 0x01,
+    0x0a, 0x00, 0x00, 0x02, 0x9c, 0x40, 0x00, 0x50, 0x06, 0x00, 0x00, 0x00,
+}
+
+var test_v9 = []byte{
+    0x00, 0x09, 0x00, 0x02, 0x00, 0x01, 0xe2, 0x40, 0x53, 0x72, 0x4e, 0x00,
+    0x00, 0x00, 0x00, 0x03, 0x00, 0x00, 0x00, 0x2a, 0x00, 0x00, 0x00, 0x1c,
+    0x01, 0x00, 0x00, 0x05, 0x00, 0x08, 0x00, 0x04, 0x00, 0x0c, 0x00, 0x04,
+    0x00, 0x07, 0x00, 0x02, 0x00, 0x0b, 0x00, 0x02, 0x00, 0x04, 0x00, 0x01,
+    0x01, 0x00, 0x00, 0x14, 0x0a, 0x00, 0x00, 0x01, 0x0a, 0x00, 0x00, 0x02,
+    0x9c, 0x40, 0x00, 0x50, 0x06, 0x00, 0x00, 0x00,
+}
+
+func MakeTestSimple() *netflow.Packet {
+    return &netflow.Packet{
+        Version: 5,
+        Count: 1,
+        SysUptime: 123456,
+        UnixSecs: 1400000000,
+        Sequence: 42,
+        Records: []netflow.V5Record{
+            {
+                SrcAddr: net.ParseIP("10.0.0.1"),
+                DstAddr: net.ParseIP("10.0.0.2"),
+                NextHop: net.ParseIP("192.168.1.1"),
+                Input: 1,
+                Output: 2,
+                Packets: 10,
+                Octets: 1500,
+                First: 1000,
+                Last: 2000,
+                SrcPort: 40000,
+                DstPort: 80,
+                TCPFlags: 0x1b,
+                Protocol: 6,
+                SrcAS: 64512,
+                DstAS: 64513,
+                SrcMask: 24,
+                DstMask: 16,
+            },
+        },
+    }
+}
+
+func TestPack(t *testing.T) {
+    var b packet.Buffer
+    b.Init(make([]byte, len(test_simple)))
+
+    p := MakeTestSimple()
+
+    err := p.Pack(&b)
+    if err != nil {
+        t.Fatalf("Error packing: %s", err)
+    }
+
+    if !bytes.Equal(test_simple, b.Buffer()) {
+        t.Fatalf("Raw packet mismatch: %x", b.Buffer())
+    }
+}
+
+func BenchmarkPack(bn *testing.B) {
+    var b packet.Buffer
+    b.Init(make([]byte, len(test_simple)))
+
+    p := MakeTestSimple()
+
+    for n := 0; n < bn.N; n++ {
+        p.Pack(&b)
+    }
+}
+
+func TestUnpack(t *testing.T) {
+    var p netflow.Packet
+
+    cmp := MakeTestSimple()
+
+    var b packet.Buffer
+    b.Init(test_simple)
+
+    err := p.Unpack(&b)
+    if err != nil {
+        t.Fatalf("Error unpacking: %s", err)
+    }
+
+    if !p.Equals(cmp) {
+        t.Fatalf("Packet mismatch:\n%s\n%s", &p, cmp)
+    }
+
+    if len(p.Records) != 1 {
+        t.Fatalf("Record count mismatch: %d", len(p.Records))
+    }
+
+    r := p.Records[0]
+    if !r.SrcAddr.Equal(cmp.Records[0].SrcAddr) ||
+       r.DstPort != 80 || r.Octets != 1500 || r.DstAS != 64513 {
+        t.Fatalf("Record mismatch: %v", r)
+    }
+}
+
+func BenchmarkUnpack(bn *testing.B) {
+    var p netflow.Packet
+    var b packet.Buffer
+
+    for n := 0; n < bn.N; n++ {
+        b.Init(test_simple)
+        p.Unpack(&b)
+    }
+}
+
+func check_data_record(t *testing.T, fs netflow.FlowSet) {
+    if fs.Id != 256 || len(fs.Records) != 1 {
+        t.Fatalf("Data flowset mismatch: %v", fs)
+    }
+
+    r := fs.Records[0]
+
+    if !net.IP(r.Value(8)).Equal(net.ParseIP("10.0.0.1")) ||
+       !net.IP(r.Value(12)).Equal(net.ParseIP("10.0.0.2")) {
+        t.Fatalf("Address mismatch: %v", r)
+    }
+
+    if !bytes.Equal(r.Value(11), []byte{ 0x00, 0x50 }) ||
+       !bytes.Equal(r.Value(4), []byte{ 0x06 }) {
+        t.Fatalf("Value mismatch: %v", r)
+    }
+}
+
+func TestUnpackIPFIX(t *testing.T) {
+    cache := netflow.NewTemplateCache()
+
+    p := netflow.Packet{ Templates: cache }
+
+    var b packet.Buffer
+    b.Init(test_ipfix_data)
+
+    err := p.Unpack(&b)
+    if err != nil {
+        t.Fatalf("Error unpacking: %s", err)
+    }
+
+    if len(p.FlowSets) != 1 || p.FlowSets[0].Data == nil {
+        t.Fatalf("Data flowset decoded without template: %v", p.FlowSets)
+    }
+
+    p = netflow.Packet{ Templates: cache }
+
+    b.Init(test_ipfix_template)
+
+    err = p.Unpack(&b)
+    if err != nil {
+        t.Fatalf("Error unpacking: %s", err)
+    }
+
+    if p.SourceId != 7 || len(p.FlowSets) != 1 ||
+       len(p.FlowSets[0].Templates) != 1 {
+        t.Fatalf("Template flowset mismatch: %v", p.FlowSets)
+    }
+
+    tmpl := cache.Get(10, 7, 256)
+    if tmpl == nil || len(tmpl.Fields) != 5 {
+        t.Fatalf("Template not cached: %v", tmpl)
+    }
+
+    p = netflow.Packet{ Templates: cache }
+
+    b.Init(test_ipfix_data)
+
+    err = p.Unpack(&b)
+    if err != nil {
+        t.Fatalf("Error unpacking: %s", err)
+    }
+
+    if len(p.FlowSets) != 1 {
+        t.Fatalf("Flowset count mismatch: %d", len(p.FlowSets))
+    }
+
+    check_data_record(t, p.FlowSets[0])
+
+    var out packet.Buffer
+    out.Init(make([]byte, p.GetLength()))
+
+    err = p.Pack(&out)
+    if err != nil {
+        t.Fatalf("Error packing: %s", err)
+    }
+
+    if !bytes.Equal(test_ipfix_data, out.Buffer()) {
+        t.Fatalf("Raw packet mismatch: %x", out.Buffer())
+    }
+}
+
+func TestUnpackV9(t *testing.T) {
+    p := netflow.Packet{ Templates: netflow.NewTemplateCache() }
+
+    var b packet.Buffer
+    b.Init(test_v9)
+
+    err := p.Unpack(&b)
+    if err != nil {
+        t.Fatalf("Error unpacking: %s", err)
+    }
+
+    if p.Version != 9 || p.SourceId != 42 || len(p.FlowSets) != 2 {
+        t.Fatalf("Packet mismatch: %s", &p)
+    }
+
+    if len(p.FlowSets[0].Templates) != 1 {
+        t.Fatalf("Template flowset mismatch: %v", p.FlowSets[0])
+    }
+
+    check_data_record(t, p.FlowSets[1])
+
+    var out packet.Buffer
+    out.Init(make([]byte, p.GetLength()))
+
+    err = p.Pack(&out)
+    if err != nil {
+        t.Fatalf("Error packing: %s", err)
+    }
+
+    if !bytes.Equal(test_v9, out.Buffer()) {
+        t.Fatalf("Raw packet mismatch: %x", out.Buffer())
+    }
+}
+
+func TestUnpackWithoutCache(t *testing.T) {
+    for _, buf := range [][]byte{ test_ipfix_template, test_ipfix_data } {
+        var p netflow.Packet
+
+        var b packet.Buffer
+        b.Init(buf)
+
+        err := p.Unpack(&b)
+        if err != nil {
+            t.Fatalf("Error unpacking: %s", err)
+        }
+
+        if len(p.FlowSets) != 1 {
+            t.Fatalf("Flowset count mismatch: %d", len(p.FlowSets))
+        }
+
+        if p.FlowSets[0].Id >= 256 && p.FlowSets[0].Data == nil {
+            t.Fatalf("Template kept between packets: %v", p.FlowSets)
+        }
+    }
+}
+
+func TestUnpackAllWithCache(t *testing.T) {
+    cache := netflow.NewTemplateCache()
+
+    opts := packet.DecodeOptions{
+        Prepare: func(p packet.Packet) {
+            if nf, ok := p.(*netflow.Packet); ok {
+                nf.Templates = cache
+            }
+        },
+    }
+
+    _, err := layers.UnpackAllWith(test_ipfix_template, packet.NetFlow, opts)
+    if err != nil {
+        t.Fatalf("Error unpacking: %s", err)
+    }
+
+    pkt, err := layers.UnpackAllWith(test_ipfix_data, packet.NetFlow, opts)
+    if err != nil {
+        t.Fatalf("Error unpacking: %s", err)
+    }
+
+    check_data_record(t, pkt.(*netflow.Packet).FlowSets[0])
+}
+
+func TestTemplateCacheLimit(t *testing.T) {
+    cache := netflow.NewTemplateCache()
+
+    for i := 0; i <= netflow.MaxSourceTemplates; i++ {
+        cache.Add(10, 7, &netflow.Template{ Id: uint16(256 + i) })
+    }
+
+    last := uint16(256 + netflow.MaxSourceTemplates)
+
+    if cache.Get(10, 7, last) != nil {
+        t.Fatalf("Template limit not enforced")
+    }
+
+    cache.Add(10, 8, &netflow.Template{ Id: last })
+
+    if cache.Get(10, 8, last) == nil {
+        t.Fatalf("Template of another source not stored")
+    }
+
+    tmpl := &netflow.Template{
+        Id:     256,
+        Fields: []netflow.Field{ { Type: 8, Length: 4 } },
+    }
+    cache.Add(10, 7, tmpl)
+
+    if cache.Get(10, 7, 256) != tmpl {
+        t.Fatalf("Template not replaced")
+    }
+}
@@ -33,6 +33,8 @@
 // package (e.g. packet/ipv4, packet/tcp, ...).
 package packet
 
+import "bytes"
+import "errors"
 import "fmt"
 import "reflect"
 import "strconv"
@@ -44,32 +46,50 @@ type Type uint16
 const (
     None Type = iota
     ARP
+    BGP
     Bluetooth /* TODO */
+    DCCP
+    DHCPv6
+    Diameter
+    DNS
+    DTP
     Eth
+    EtherIP
+    FCoE
     GRE       /* TODO */
+    GTPU
+    GTPv2
     ICMPv4
     ICMPv6
-    IGMP      /* TODO */
+    IGMP
     IPSec     /* TODO */
     IPv4
     IPv6
-    ISIS      /* TODO */
+    ISIS
     L2TP      /* TODO */
     LLC
     LLDP      /* TODO */
+    MACsec
+    NetFlow
     OSPF      /* TODO */
+    PIM
     RadioTap  /* TODO */
     Raw
+    RIP
+    RIPng
     SCTP      /* TODO */
+    SIP
     SLL
     SNAP
     TCP
+    TLS
     TRILL     /* TODO */
+    Truncated
     UDP
-    UDPLite   /* TODO */
+    UDPLite
     VLAN
     WiFi      /* TODO */
-    WoL       /* TODO */
+    WoL
 )
 
 // Packet is the interface used internally to implement packet encoding and
@@ -96,6 +116,13 @@ type Packet interface {
     /* Return the payload of the packet or nil */
     Payload() Packet
 
+    /* Return the data the packet was decoded from, including the payload,
+     * or nil if the packet wasn't decoded. The data is not copied */
+    RawBytes() []byte
+
+    /* Return the encoded header of the packet, without the payload */
+    HeaderBytes() []byte
+
     /* Initialize the payload of the packet */
     SetPayload(payload Packet) error
 
@@ -105,9 +132,120 @@ type Packet interface {
     /* Initialize the checksum of the packet with the given seed */
     InitChecksum(seed uint32)
 
+    /* Return a deep copy of the packet, including its payload. The data
+     * returned by RawBytes() is shared with the original packet */
+    Clone() Packet
+
     String() string
 }
 
+// DecodeOptions controls how complete packet stacks are decoded (see the
+// layers.UnpackAllWith() function). The zero value decodes all the layers,
+// without copying the input data.
+type DecodeOptions struct {
+    /* Maximum number of nested layers to decode, or 0 for DefaultMaxDepth,
+     * or a negative value for no limit. Decoding fails with ErrMaxDepth when
+     * more layers follow, so that crafted packets nesting many encapsulations
+     * can't make the decoding arbitrarily expensive. Consecutive messages
+     * (see MessagePacket) count as a single layer */
+    MaxDepth  int
+
+    /* Copy the input data before decoding, so that packets don't alias it */
+    Copy      bool
+
+    /* Stop decoding after the first layer of this type, unless None */
+    StopAt    Type
+
+    /* Decode the payload of packets that support it (see LazyPacket) only
+     * when Payload() is first called. Decoding errors found at that point
+     * are ignored, and the payload is left empty */
+    Lazy      bool
+
+    /* Discard the data that follows the payload length declared by packets
+     * that support it (see BoundedPacket), e.g. Ethernet padding and FCS,
+     * instead of decoding it as part of the payload. A zero length (e.g. as
+     * captured with TCP segmentation offload) doesn't discard anything */
+    Trim      bool
+
+    /* Strip the trailing FCS of Ethernet frames, when the frame is exactly 4
+     * bytes longer than the length declared by the IP layer that follows, and
+     * store it in the Ethernet packet (see eth.Packet.CheckFCS()) */
+    FCS       bool
+
+    /* Instead of failing, return the layers decoded so far when the data
+     * ends before a layer is complete (e.g. captures limited to the packet
+     * headers). The incomplete layer is followed by a truncated.Packet
+     * marker reporting how many bytes were missing, as declared by the
+     * enclosing layers (zero when no length was declared) */
+    Truncated bool
+
+    /* Called on every layer before it's decoded, unless nil, e.g. to let
+     * NetFlow packets store their templates in a netflow.TemplateCache */
+    Prepare   func(p Packet)
+}
+
+// Maximum number of layers decoded when DecodeOptions.MaxDepth is 0.
+const DefaultMaxDepth = 25
+
+// Returned when a packet has more layers than allowed by DecodeOptions.MaxDepth.
+// The layers decoded up to the limit are returned along with it.
+var ErrMaxDepth = errors.New("Maximum decoding depth exceeded")
+
+// BoundedPacket is implemented by packets whose header declares the length of
+// their payload (e.g. IPv4, IPv6 and UDP).
+type BoundedPacket interface {
+    Packet
+
+    /* Return the length of the payload declared by the header */
+    PayloadLength() uint32
+}
+
+// LazyPacket is implemented by packets whose payload can be decoded on first
+// access, instead of together with the packet itself. The decoding function is
+// called at most once, and is discarded when the payload is replaced with
+// SetPayload().
+//
+// Note that this makes Payload() modify the packet, so lazily decoded packets
+// must not be accessed concurrently.
+type LazyPacket interface {
+    Packet
+
+    /* Set the function used to decode the payload on first access */
+    SetPayloadDecoder(decode func() Packet)
+}
+
+// MessagePacket is implemented by packets of protocols whose messages can
+// follow one another in the same payload (e.g. BGP messages in a TCP segment).
+// Each message is decoded as the payload of the previous one, but they don't
+// count as nested layers for DecodeOptions.MaxDepth.
+type MessagePacket interface {
+    Packet
+
+    /* Return true if the payload is the next message of the same protocol,
+     * rather than an encapsulated packet */
+    NextMessage() bool
+}
+
+// Validator is implemented by packets that can check the consistency of their
+// fields (e.g. the header length of an IPv4 packet) before being encoded, to
+// catch errors while crafting packets. See ValidateStack().
+type Validator interface {
+    Packet
+
+    /* Return an error if the fields of the packet are not consistent */
+    Validate() error
+}
+
+// Summarizer is implemented by packets that can describe themselves in a few
+// words (e.g. the message type and code of ICMP packets). The summary is shown
+// by Stringify() before the fields, and by Tree() next to the layer name.
+type Summarizer interface {
+    Packet
+
+    /* Return a short human readable description of the packet */
+    Summary() string
+}
+
 var pcap_link_type_to_type_map = [][2]uint32{
     {   1, uint32(Eth)      },
     { 113, uint32(SLL)      },
@@ -141,9 +279,19 @@ func (pkttype Type) ToLinkType() uint32 {
 func (t Type) String() string {
     switch t {
     case ARP:       return "ARP"
+    case BGP:       return "BGP"
     case Bluetooth: return "Bluetooth"
+    case DCCP:      return "DCCP"
+    case DHCPv6:    return "DHCPv6"
+    case Diameter:  return "Diameter"
+    case DNS:       return "DNS"
+    case DTP:       return "DTP"
     case Eth:       return "Ethernet"
+    case EtherIP:   return "EtherIP"
+    case FCoE:      return "FCoE"
     case GRE:       return "GRE"
+    case GTPU:      return "GTP-U"
+    case GTPv2:     return "GTPv2"
     case ICMPv4:    return "ICMPv4"
     case ICMPv6:    return "ICMPv6"
     case IGMP:      return "IGMP"
@@ -154,14 +302,22 @@ func (t Type) String() string {
     case L2TP:      return "L2TP"
     case LLC:       return "LLC"
     case LLDP:      return "LLDP"
+    case MACsec:    return "MACsec"
+    case NetFlow:   return "NetFlow"
     case None:      return "None"
     case OSPF:      return "OSPF"
+    case PIM:       return "PIM"
     case RadioTap:  return "RadioTap"
+    case RIP:       return "RIP"
+    case RIPng:     return "RIPng"
     case SCTP:      return "SCTP"
+    case SIP:       return "SIP"
     case SNAP:      return "SNAP"
     case SLL:       return "SLL"
     case TCP:       return "TCP"
+    case TLS:       return "TLS"
     case TRILL:     return "TRILL"
+    case Truncated: return "Truncated"
     case UDPLite:   return "UDP Lite"
     case UDP:       return "UDP"
     case VLAN:      return "VLAN"
@@ -172,6 +328,120 @@ func (t Type) String() string {
     }
 }
 
+// Update the fields that depend on the payload (e.g. lengths, payload types and
+// checksum seeds) of every packet in the chain starting at head, from the
+// innermost one outwards, by setting the payload of each packet again. This is
+// useful after modifying a packet deep in an already composed chain.
+func Finalize(head Packet) error {
+    var pkts []Packet
+
+    for p := head; p != nil; p = p.Payload() {
+        pkts = append(pkts, p)
+    }
+
+    for i := len(pkts) - 2; i >= 0; i-- {
+        err := pkts[i].SetPayload(pkts[i + 1])
+        if err != nil {
+            return err
+        }
+    }
+
+    return nil
+}
+
+// Validate every packet in the chain starting at head that implements the
+// Validator interface, and return the first error, prefixed by the type of the
+// invalid packet.
+func ValidateStack(head Packet) error {
+    for p := head; p != nil; p = p.Payload() {
+        v, ok := p.(Validator)
+        if !ok {
+            continue
+        }
+
+        err := v.Validate()
+        if err != nil {
+            return fmt.Errorf("%s: %w", p.GetType(), err)
+        }
+    }
+
+    return nil
+}
+
+// Check whether the chains starting at a and b are encoded to the same bytes.
+// Differently from Compare(), this also takes into account the fields that are
+// normally ignored (e.g. checksums and lengths) and those that depend on the
+// payload, and ignores how the fields are represented (e.g. IPv4 addresses in
+// 4 or 16 bytes form). As with encoding, the checksums of the packets are
+// updated. An error in encoding either chain makes them different.
+func EqualBytes(a, b Packet) bool {
+    if a == nil || b == nil {
+        return a == b
+    }
+
+    a_buf, err := pack_chain(a)
+    if err != nil {
+        return false
+    }
+
+    b_buf, err := pack_chain(b)
+    if err != nil {
+        return false
+    }
+
+    return bytes.Equal(a_buf, b_buf)
+}
+
+// Return the header of the given packet, i.e. its encoded data without the
+// payload (e.g. to hash or fingerprint a single layer). For decoded packets
+// this is a slice of the data returned by RawBytes(), otherwise a copy of the
+// packet is encoded together with its payload, so that lengths and checksums
+// have their final values. If encoding fails, nil is returned.
+func HeaderBytes(p Packet) []byte {
+    hdr_len := int(p.GetLength())
+
+    if p.Payload() != nil {
+        hdr_len -= int(p.Payload().GetLength())
+    }
+
+    if raw := p.RawBytes(); raw != nil && len(raw) >= hdr_len {
+        return raw[:hdr_len]
+    }
+
+    data, err := pack_chain(p.Clone())
+    if err != nil {
+        return nil
+    }
+
+    return data[:hdr_len]
+}
+
+/* Encode the chain starting at head as is, from the innermost packet outwards
+ * like layers.Pack() does, and return the encoded data */
+func pack_chain(head Packet) ([]byte, error) {
+    var pkts []Packet
+
+    for p := head; p != nil; p = p.Payload() {
+        pkts = append(pkts, p)
+    }
+
+    tot_len := int(head.GetLength())
+
+    buf := NewBuffer(tot_len)
+
+    for i := len(pkts) - 1; i >= 0; i-- {
+        buf.SetOffset(tot_len - int(pkts[i].GetLength()))
+        buf.NewLayer()
+
+        err := pkts[i].Pack(buf)
+        if err != nil {
+            return nil, err
+        }
+    }
+
+    return buf.Buffer(), nil
+}
+
 func Compare(a, b Packet) bool {
     if a == nil || b == nil {
         return a == b
@@ -218,6 +488,9 @@ func compare_value(a, b reflect.Value) bool {
     case reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
         return a.Uint() == b.Uint()
 
+    case reflect.String:
+        return a.String() == b.String()
+
     case reflect.Array:
         for i := 0; i < a.Len(); i++ {
             if !compare_value(a.Index(i), b.Index(i)) {
@@ -257,10 +530,32 @@ func compare_value(a, b reflect.Value) bool {
 }
 
 func Stringify(p Packet) string {
-    value := reflect.ValueOf(p).Elem()
-    name  := strings.ToLower(p.GetType().String())
+    name := strings.ToLower(p.GetType().String())
 
     var fields []string
+
+    if sp, ok := p.(Summarizer); ok && sp.Summary() != "" {
+        fields = append(fields, sp.Summary())
+    }
+
+    each_field(p, func(key, val string) {
+        fields = append(fields, fmt.Sprintf("%s=%s", key, val))
+    })
+
+    s := fmt.Sprintf("%s(%s)", name, strings.Join(fields, ", "))
+
+    if p.Payload() != nil {
+        s = strings.Join([]string{s, p.Payload().String()}, " | ")
+    }
+
+    return s
+}
+
+/* Call fn with the name and value of every non-empty field of the packet, as
+ * shown by Stringify() */
+func each_field(p Packet, fn func(key, val string)) {
+    value := reflect.ValueOf(p).Elem()
+
     for i := 0; i < value.NumField(); i++ {
         field := value.Field(i)
         ftype := value.Type().Field(i)
@@ -277,17 +572,9 @@ func Stringify(p Packet) string {
 
         val := stringify_value(key, field)
         if val != "" {
-            fields = append(fields, fmt.Sprintf("%s=%s", key, val))
+            fn(key, val)
         }
     }
-
-    s := fmt.Sprintf("%s(%s)", name, strings.Join(fields, ", "))
-
-    if p.Payload() != nil {
-        s = strings.Join([]string{s, p.Payload().String()}, " | ")
-    }
-
-    return s
 }
 
 func stringify_value(key string, val reflect.Value) string {
@@ -317,6 +604,9 @@ func stringify_value(key string, val reflect.Value) string {
         if val.Bool() {
             s = "true"
         }
+
+    case reflect.String:
+        s = val.String()
     }
 
     m = val.MethodByName("String")
@@ -0,0 +1,88 @@
+/*
+ * Network packet analysis framework.
+ *
+ * Copyright (c) 2014, Alessandro Ghedini
+ * All rights reserved.
+ *
+ * Redistribution and use in source and binary forms, with or without
+ * modification, are permitted provided that the following conditions are
+ * met:
+ *
+ *     * Redistributions of source code must retain the above copyright
+ *       notice, this list of conditions and the following disclaimer.
+ *
+ *     * Redistributions in binary form must reproduce the above copyright
+ *       notice, this list of conditions and the following disclaimer in the
+ *       documentation and/or other materials provided with the distribution.
+ *
+ * THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS
+ * IS" AND ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO,
+ * THE IMPLIED WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR
+ * PURPOSE ARE DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT HOLDER OR
+ * CONTRIBUTORS BE LIABLE FOR ANY DIRECT, INDIRECT, INCIDENTAL, SPECIAL,
+ * EXEMPLARY, OR CONSEQUENTIAL DAMAGES (INCLUDING, BUT NOT LIMITED TO,
+ * PROCUREMENT OF SUBSTITUTE GOODS OR SERVICES; LOSS OF USE, DATA, OR
+ * PROFITS; OR BUSINESS INTERRUPTION) HOWEVER CAUSED AND ON ANY THEORY OF
+ * LIABILITY, WHETHER IN CONTRACT, STRICT LIABILITY, OR TORT (INCLUDING
+ * NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE OF THIS
+ * SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+ */
+
+package packet_test
+
+import "net"
+import "testing"
+
+import "github.com/adigal150/go.pkt/layers"
+import "github.com/adigal150/go.pkt/packet"
+import "github.com/adigal150/go.pkt/packet/eth"
+import "github.com/adigal150/go.pkt/packet/ipv4"
+import "github.com/adigal150/go.pkt/packet/raw"
+import "github.com/adigal150/go.pkt/packet/udp"
+
+func make_udp_stack(src string, data string) packet.Packet {
+    ip4_pkt := ipv4.Make()
+    ip4_pkt.SrcAddr = net.ParseIP(src)
+    ip4_pkt.DstAddr = net.ParseIP("192.168.1.2")
+
+    udp_pkt := udp.Make()
+    udp_pkt.SrcPort = 41562
+    udp_pkt.DstPort = 8338
+
+    raw_pkt := raw.Make()
+    raw_pkt.Data = []byte(data)
+
+    pkt, _ := layers.Compose(eth.Make(), ip4_pkt, udp_pkt, raw_pkt)
+
+    return pkt
+}
+
+func TestEqualBytes(t *testing.T) {
+    a := make_udp_stack("192.168.1.1", "some data")
+    b := make_udp_stack("192.168.1.1", "some data")
+
+    if a == b || !packet.EqualBytes(a, b) {
+        t.Fatalf("Identical stacks not equal")
+    }
+
+    /* 4 and 16 bytes forms of the same address */
+    b.Payload().(*ipv4.Packet).SrcAddr = net.IP{ 192, 168, 1, 1 }
+
+    if !packet.EqualBytes(a, b) {
+        t.Fatalf("Address representation affects equality")
+    }
+
+    c := make_udp_stack("192.168.1.1", "other data")
+    if packet.EqualBytes(a, c) {
+        t.Fatalf("Different payloads equal")
+    }
+
+    d := make_udp_stack("192.168.1.3", "some data")
+    if packet.EqualBytes(a, d) {
+        t.Fatalf("Different addresses equal")
+    }
+
+    if packet.EqualBytes(a, nil) || !packet.EqualBytes(nil, nil) {
+        t.Fatalf("Nil stack mismatch")
+    }
+}
@@ -0,0 +1,562 @@
+/*
+ * Network packet analysis framework.
+ *
+ * Copyright (c) 2014, Alessandro Ghedini
+ * All rights reserved.
+ *
+ * Redistribution and use in source and binary forms, with or without
+ * modification, are permitted provided that the following conditions are
+ * met:
+ *
+ *     * Redistributions of source code must retain the above copyright
+ *       notice, this list of conditions and the following disclaimer.
+ *
+ *     * Redistributions in binary form must reproduce the above copyright
+ *       notice, this list of conditions and the following disclaimer in the
+ *       documentation and/or other materials provided with the distribution.
+ *
+ * THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS
+ * IS" AND ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO,
+ * THE IMPLIED WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR
+ * PURPOSE ARE DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT HOLDER OR
+ * CONTRIBUTORS BE LIABLE FOR ANY DIRECT, INDIRECT, INCIDENTAL, SPECIAL,
+ * EXEMPLARY, OR CONSEQUENTIAL DAMAGES (INCLUDING, BUT NOT LIMITED TO,
+ * PROCUREMENT OF SUBSTITUTE GOODS OR SERVICES; LOSS OF USE, DATA, OR
+ * PROFITS; OR BUSINESS INTERRUPTION) HOWEVER CAUSED AND ON ANY THEORY OF
+ * LIABILITY, WHETHER IN CONTRACT, STRICT LIABILITY, OR TORT (INCLUDING
+ * NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE OF THIS
+ * SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+ */
+// Provides encoding and decoding for PIM (version 2, RFC 7761) packets.
+//
+// The options of Hello messages and the groups of Join/Prune messages are
+// decoded, while the body of the other messages is left opaque.
+package pim
+
+import "fmt"
+import "net"
+
+import "github.com/adigal150/go.pkt/packet"
+
+type Packet struct {
+    Version      uint8         `string:"ver"`
+    Type         Type
+    Checksum     uint16        `string:"sum"`
+
+    /* Hello messages only */
+    Options      []packet.TLV  `cmp:"skip" string:"skip"`
+
+    /* Join/Prune messages only */
+    Upstream     net.IP        `string:"upstream"`
+    HoldTime     uint16        `string:"hold"`
+    Groups       []Group       `cmp:"skip" string:"skip"`
+
+    /* body of the other messages */
+    Data         []byte        `cmp:"skip" string:"skip"`
+
+    // Encode the Checksum field as-is, instead of computing it from the
+    // packet, e.g. to craft malformed packets.
+    KeepChecksum bool          `cmp:"skip" string:"skip"`
+
+    csum_seed    uint32        `cmp:"skip" string:"skip"`
+    pkt_raw      []byte        `cmp:"skip" string:"skip"`
+}
+
+type Type uint8
+
+const (
+    Hello          Type = 0
+    Register            = 1
+    RegisterStop        = 2
+    JoinPrune           = 3
+    Bootstrap           = 4
+    Assert              = 5
+    Graft               = 6
+    GraftAck            = 7
+    CandidateRPAdv      = 8
+)
+
+// Hello option types.
+const (
+    OptHoldTime      uint16 = 1
+    OptLANPruneDelay        = 2
+    OptDRPriority           = 19
+    OptGenerationId         = 20
+    OptAddressList          = 24
+)
+
+// Multicast group of a Join/Prune message, along with the sources joined and
+// pruned for it.
+type Group struct {
+    Addr    net.IP
+    MaskLen uint8
+    Flags   uint8
+    Joined  []Source
+    Pruned  []Source
+}
+
+// Source of a Join/Prune message group.
+type Source struct {
+    Addr    net.IP
+    MaskLen uint8
+    Flags   SourceFlags
+}
+
+type SourceFlags uint8
+
+const (
+    Sparse   SourceFlags = 0x04
+    Wildcard             = 0x02
+    RPTree               = 0x01
+)
+
+/* PIM address families */
+const (
+    family_ipv4 = 1
+    family_ipv6 = 2
+)
+
+func Make() *Packet {
+    return &Packet{
+        Version: 2,
+        Type:    Hello,
+    }
+}
+
+func (p *Packet) GetType() packet.Type {
+    return packet.PIM
+}
+
+func (p *Packet) GetLength() uint16 {
+    length := 4
+
+    switch p.Type {
+    case Hello:
+        for _, opt := range p.Options {
+            length += 4 + len(opt.Value)
+        }
+
+    case JoinPrune:
+        length += addr_len(p.Upstream) + 6
+
+        for _, g := range p.Groups {
+            length += 4 + addr_len(g.Addr) + 4
+
+            for _, s := range g.Joined {
+                length += 4 + addr_len(s.Addr)
+            }
+
+            for _, s := range g.Pruned {
+                length += 4 + addr_len(s.Addr)
+            }
+        }
+
+    default:
+        length += len(p.Data)
+    }
+
+    return uint16(length)
+}
+
+func (p *Packet) Equals(other packet.Packet) bool {
+    return packet.Compare(p, other)
+}
+
+func (p *Packet) Answers(other packet.Packet) bool {
+    return false
+}
+
+func (p *Packet) Pack(buf *packet.Buffer) error {
+    buf.WriteN(p.Version << 4 | uint8(p.Type) & 0x0F)
+    buf.WriteN(uint8(0x00))
+    buf.WriteN(uint16(0x0000))
+
+    var err error
+
+    switch p.Type {
+    case Hello:
+        err = packet.EncodeTLV16(buf, p.Options)
+
+    case JoinPrune:
+        err = p.pack_join_prune(buf)
+
+    default:
+        buf.Write(p.Data)
+    }
+
+    if err != nil {
+        return err
+    }
+
+    if buf.Err() != nil {
+        return buf.Err()
+    }
+
+    if !p.KeepChecksum {
+        data := buf.LayerBytes()[:p.GetLength()]
+
+        /* the checksum of Register messages doesn't cover the data */
+        if p.Type == Register && len(data) > 8 {
+            data = data[:8]
+        }
+
+        p.Checksum = packet.Checksum(data, p.csum_seed)
+    }
+
+    buf.PutUint16N(2, p.Checksum)
+
+    return buf.Err()
+}
+
+func (p *Packet) Unpack(buf *packet.Buffer) error {
+    p.pkt_raw = buf.Bytes()
+
+    if buf.Len() < 4 {
+        return packet.Errorf(packet.ErrTruncated, "Invalid PIM header")
+    }
+
+    var vt uint8
+
+    buf.ReadN(&vt)
+    buf.Next(1)
+    buf.ReadN(&p.Checksum)
+
+    p.Version = vt >> 4
+    p.Type    = Type(vt & 0x0F)
+
+    if p.Version != 2 {
+        return packet.Errorf(packet.ErrUnsupported,
+                             "Unsupported PIM version: %d", p.Version)
+    }
+
+    switch p.Type {
+    case Hello:
+        var err error
+
+        p.Options, err = packet.DecodeTLV16(buf.Next(buf.Len()))
+        if err != nil {
+            return err
+        }
+
+    case JoinPrune:
+        err := p.unpack_join_prune(buf.Next(buf.Len()))
+        if err != nil {
+            return err
+        }
+
+    default:
+        p.Data = buf.Next(buf.Len())
+    }
+
+    return buf.Err()
+}
+
+func (p *Packet) Payload() packet.Packet {
+    return nil
+}
+
+func (p *Packet) RawBytes() []byte {
+    return p.pkt_raw
+}
+
+func (p *Packet) HeaderBytes() []byte {
+    return packet.HeaderBytes(p)
+}
+
+func (p *Packet) GuessPayloadType() packet.Type {
+    return packet.None
+}
+
+func (p *Packet) SetPayload(pl packet.Packet) error {
+    return nil
+}
+
+func (p *Packet) InitChecksum(csum uint32) {
+    p.csum_seed = csum
+}
+
+func (p *Packet) Clone() packet.Packet {
+    c := *p
+
+    c.Options  = packet.CloneTLVs(p.Options)
+    c.Upstream = packet.CloneBytes(p.Upstream)
+    c.Data     = packet.CloneBytes(p.Data)
+
+    if p.Groups != nil {
+        c.Groups = make([]Group, len(p.Groups))
+
+        for i, g := range p.Groups {
+            g.Addr   = packet.CloneBytes(g.Addr)
+            g.Joined = clone_sources(g.Joined)
+            g.Pruned = clone_sources(g.Pruned)
+
+            c.Groups[i] = g
+        }
+    }
+
+    return &c
+}
+
+func (p *Packet) String() string {
+    return packet.Stringify(p)
+}
+
+// Return the first Hello option with the given type, or nil.
+func (p *Packet) Option(t uint16) *packet.TLV {
+    for i := range p.Options {
+        if p.Options[i].Type == t {
+            return &p.Options[i]
+        }
+    }
+
+    return nil
+}
+
+func (p *Packet) pack_join_prune(buf *packet.Buffer) error {
+    err := write_unicast(buf, p.Upstream)
+    if err != nil {
+        return err
+    }
+
+    if len(p.Groups) > 0xFF {
+        return fmt.Errorf("Invalid PIM group count: %d", len(p.Groups))
+    }
+
+    buf.WriteN(uint8(0x00))
+    buf.WriteN(uint8(len(p.Groups)))
+    buf.WriteN(p.HoldTime)
+
+    for _, g := range p.Groups {
+        err = write_encoded(buf, g.Addr, g.Flags, g.MaskLen)
+        if err != nil {
+            return err
+        }
+
+        buf.WriteN(uint16(len(g.Joined)))
+        buf.WriteN(uint16(len(g.Pruned)))
+
+        err = write_sources(buf, g.Joined)
+        if err != nil {
+            return err
+        }
+
+        err = write_sources(buf, g.Pruned)
+        if err != nil {
+            return err
+        }
+    }
+
+    return buf.Err()
+}
+
+func (p *Packet) unpack_join_prune(data []byte) error {
+    var err error
+
+    p.Upstream, data, err = read_unicast(data)
+    if err != nil {
+        return err
+    }
+
+    if len(data) < 4 {
+        return packet.Errorf(packet.ErrTruncated,
+                             "Truncated PIM Join/Prune message")
+    }
+
+    count := int(data[1])
+
+    p.HoldTime = uint16(data[2]) << 8 | uint16(data[3])
+    p.Groups   = nil
+
+    data = data[4:]
+
+    for i := 0; i < count; i++ {
+        var g Group
+
+        g.Addr, g.Flags, g.MaskLen, data, err = read_encoded(data)
+        if err != nil {
+            return err
+        }
+
+        if len(data) < 4 {
+            return packet.Errorf(packet.ErrTruncated,
+                                 "Truncated PIM Join/Prune group")
+        }
+
+        joined := int(data[0]) << 8 | int(data[1])
+        pruned := int(data[2]) << 8 | int(data[3])
+
+        data = data[4:]
+
+        g.Joined, data, err = read_sources(data, joined)
+        if err != nil {
+            return err
+        }
+
+        g.Pruned, data, err = read_sources(data, pruned)
+        if err != nil {
+            return err
+        }
+
+        p.Groups = append(p.Groups, g)
+    }
+
+    return nil
+}
+
+func addr_len(addr net.IP) int {
+    if addr.To4() != nil {
+        return 4
+    }
+
+    return 16
+}
+
+/* write an encoded-unicast address */
+func write_unicast(buf *packet.Buffer, addr net.IP) error {
+    if ip4 := addr.To4(); ip4 != nil {
+        buf.WriteN(uint8(family_ipv4))
+        buf.WriteN(uint8(0x00))
+        buf.Write(ip4)
+    } else if ip6 := addr.To16(); ip6 != nil {
+        buf.WriteN(uint8(family_ipv6))
+        buf.WriteN(uint8(0x00))
+        buf.Write(ip6)
+    } else {
+        return fmt.Errorf("Invalid PIM address: %s", addr)
+    }
+
+    return nil
+}
+
+/* write an encoded-group or encoded-source address */
+func write_encoded(buf *packet.Buffer, addr net.IP, flags, mask_len uint8) error {
+    family := uint8(family_ipv6)
+    ip     := addr.To16()
+
+    if ip4 := addr.To4(); ip4 != nil {
+        family = family_ipv4
+        ip     = ip4
+    }
+
+    if ip == nil {
+        return fmt.Errorf("Invalid PIM address: %s", addr)
+    }
+
+    buf.WriteN(family)
+    buf.WriteN(uint8(0x00))
+    buf.WriteN(flags)
+    buf.WriteN(mask_len)
+    buf.Write(ip)
+
+    return nil
+}
+
+func write_sources(buf *packet.Buffer, sources []Source) error {
+    for _, s := range sources {
+        err := write_encoded(buf, s.Addr, uint8(s.Flags), s.MaskLen)
+        if err != nil {
+            return err
+        }
+    }
+
+    return nil
+}
+
+func family_len(family uint8) (int, error) {
+    switch family {
+    case family_ipv4: return 4, nil
+    case family_ipv6: return 16, nil
+    }
+
+    return 0, packet.Errorf(packet.ErrUnsupported,
+                            "Unsupported PIM address family: %d", family)
+}
+
+func read_unicast(data []byte) (net.IP, []byte, error) {
+    if len(data) < 2 {
+        return nil, data, packet.Errorf(packet.ErrTruncated,
+                                        "Truncated PIM address")
+    }
+
+    l, err := family_len(data[0])
+    if err != nil {
+        return nil, data, err
+    }
+
+    if len(data) < 2 + l {
+        return nil, data, packet.Errorf(packet.ErrTruncated,
+                                        "Truncated PIM address")
+    }
+
+    return net.IP(data[2:2 + l]), data[2 + l:], nil
+}
+
+func read_encoded(data []byte) (net.IP, uint8, uint8, []byte, error) {
+    if len(data) < 4 {
+        return nil, 0, 0, data, packet.Errorf(packet.ErrTruncated,
+                                              "Truncated PIM address")
+    }
+
+    l, err := family_len(data[0])
+    if err != nil {
+        return nil, 0, 0, data, err
+    }
+
+    if len(data) < 4 + l {
+        return nil, 0, 0, data, packet.Errorf(packet.ErrTruncated,
+                                              "Truncated PIM address")
+    }
+
+    return net.IP(data[4:4 + l]), data[2], data[3], data[4 + l:], nil
+}
+
+func read_sources(data []byte, count int) ([]Source, []byte, error) {
+    var sources []Source
+
+    for i := 0; i < count; i++ {
+        var s Source
+        var flags uint8
+        var err error
+
+        s.Addr, flags, s.MaskLen, data, err = read_encoded(data)
+        if err != nil {
+            return nil, data, err
+        }
+
+        s.Flags = SourceFlags(flags)
+        sources = append(sources, s)
+    }
+
+    return sources, data, nil
+}
+
+func clone_sources(sources []Source) []Source {
+    if sources == nil {
+        return nil
+    }
+
+    clone := make([]Source, len(sources))
+
+    for i, s := range sources {
+        s.Addr = packet.CloneBytes(s.Addr)
+
+        clone[i] = s
+    }
+
+    return clone
+}
+
+func (t Type) String() string {
+    switch t {
+    case Hello:          return "hello"
+    case Register:       return "register"
+    case RegisterStop:   return "register-stop"
+    case JoinPrune:      return "join-prune"
+    case Bootstrap:      return "bootstrap"
+    case Assert:         return "assert"
+    case Graft:          return "graft"
+    case GraftAck:       return "graft-ack"
+    case CandidateRPAdv: return "candidate-rp-adv"
+    default:             return "unknown"
+    }
+}
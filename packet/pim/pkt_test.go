@@ -0,0 +1,198 @@
+/*
+ * Network packet analysis framework.
+ *
+ * Copyright (c) 2014, Alessandro Ghedini
+ * All rights reserved.
+ *
+ * Redistribution and use in source and binary forms, with or without
+ * modification, are permitted provided that the following conditions are
+ * met:
+ *
+ *     * Redistributions of source code must retain the above copyright
+ *       notice, this list of conditions and the following disclaimer.
+ *
+ *     * Redistributions in binary form must reproduce the above copyright
+ *       notice, this list of conditions and the following disclaimer in the
+ *       documentation and/or other materials provided with the distribution.
+ *
+ * THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS
+ * IS" AND ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO,
+ * THE IMPLIED WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR
+ * PURPOSE ARE DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT HOLDER OR
+ * CONTRIBUTORS BE LIABLE FOR ANY DIRECT, INDIRECT, INCIDENTAL, SPECIAL,
+ * EXEMPLARY, OR CONSEQUENTIAL DAMAGES (INCLUDING, BUT NOT LIMITED TO,
+ * PROCUREMENT OF SUBSTITUTE GOODS OR SERVICES; LOSS OF USE, DATA, OR
+ * PROFITS; OR BUSINESS INTERRUPTION) HOWEVER CAUSED AND ON ANY THEORY OF
+ * LIABILITY, WHETHER IN CONTRACT, STRICT LIABILITY, OR TORT (INCLUDING
+ * NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE OF THIS
+ * SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+ */
+package pim_test
+
+import "bytes"
+import "net"
+import "testing"
+
+import "github.com/adigal150/go.pkt/layers"
+import "github.com/adigal150/go.pkt/packet"
+import "github.com/adigal150/go.pkt/packet/ipv4"
+import "github.com/adigal150/go.pkt/packet/pim"
+
+/* Hello with Holdtime, DR Priority and Generation ID options */
+var test_simple = []byte{
+    0x20, 0x00, 0x76, 0xb7, 0x00, 0x01, 0x00, 0x02, 0x00, 0x69, 0x00, 0x13,
+    0x00, 0x04, 0x00, 0x00, 0x00, 0x01, 0x00, 0x14, 0x00, 0x04, 0x12, 0x34,
+    0x56, 0x78,
+}
+
+/* Join/Prune joining source 10.0.0.100 for group 225.1.1.1 */
+var test_join_prune = []byte{
+    0x23, 0x00, 0xde, 0x82, 0x01, 0x00, 0x0a, 0x00, 0x00, 0x02, 0x00, 0x01,
+    0x00, 0xd2, 0x01, 0x00, 0x00, 0x20, 0xe1, 0x01, 0x01, 0x01, 0x00, 0x01,
+    0x00, 0x00, 0x01, 0x00, 0x04, 0x20, 0x0a, 0x00, 0x00, 0x64,
+}
+
+func MakeTestSimple() *pim.Packet {
+    return &pim.Packet{
+        Version:  2,
+        Type:     pim.Hello,
+        Checksum: 0x76b7,
+        Options: []packet.TLV{
+            { Type: pim.OptHoldTime, Value: []byte{ 0x00, 0x69 } },
+            { Type: pim.OptDRPriority, Value: []byte{ 0x00, 0x00, 0x00, 0x01 } },
+            { Type: pim.OptGenerationId, Value: []byte{ 0x12, 0x34, 0x56, 0x78 } },
+        },
+    }
+}
+
+func MakeTestJoinPrune() *pim.Packet {
+    return &pim.Packet{
+        Version:  2,
+        Type:     pim.JoinPrune,
+        Checksum: 0xde82,
+        Upstream: net.ParseIP("10.0.0.2"),
+        HoldTime: 210,
+        Groups: []pim.Group{
+            {
+                Addr:    net.ParseIP("225.1.1.1"),
+                MaskLen: 32,
+                Joined: []pim.Source{
+                    {
+                        Addr:    net.ParseIP("10.0.0.100"),
+                        MaskLen: 32,
+                        Flags:   pim.Sparse,
+                    },
+                },
+            },
+        },
+    }
+}
+
+func TestPack(t *testing.T) {
+    var b packet.Buffer
+    b.Init(make([]byte, len(test_simple)))
+
+    p := MakeTestSimple()
+
+    if int(p.GetLength()) != len(test_simple) {
+        t.Fatalf("Length mismatch: %d", p.GetLength())
+    }
+
+    err := p.Pack(&b)
+    if err != nil {
+        t.Fatalf("Error packing: %s", err)
+    }
+
+    if !bytes.Equal(test_simple, b.Buffer()) {
+        t.Fatalf("Raw packet mismatch: %x", b.Buffer())
+    }
+}
+
+func TestUnpack(t *testing.T) {
+    var p pim.Packet
+
+    cmp := MakeTestSimple()
+
+    var b packet.Buffer
+    b.Init(test_simple)
+
+    err := p.Unpack(&b)
+    if err != nil {
+        t.Fatalf("Error unpacking: %s", err)
+    }
+
+    if !p.Equals(cmp) {
+        t.Fatalf("Packet mismatch:\n%s\n%s", &p, cmp)
+    }
+
+    prio := p.Option(pim.OptDRPriority)
+    if prio == nil || !bytes.Equal(prio.Value, cmp.Options[1].Value) {
+        t.Fatalf("DR Priority mismatch: %v", prio)
+    }
+}
+
+func TestPackJoinPrune(t *testing.T) {
+    var b packet.Buffer
+    b.Init(make([]byte, len(test_join_prune)))
+
+    p := MakeTestJoinPrune()
+
+    if int(p.GetLength()) != len(test_join_prune) {
+        t.Fatalf("Length mismatch: %d", p.GetLength())
+    }
+
+    err := p.Pack(&b)
+    if err != nil {
+        t.Fatalf("Error packing: %s", err)
+    }
+
+    if !bytes.Equal(test_join_prune, b.Buffer()) {
+        t.Fatalf("Raw packet mismatch: %x", b.Buffer())
+    }
+}
+
+func TestUnpackJoinPrune(t *testing.T) {
+    var p pim.Packet
+
+    cmp := MakeTestJoinPrune()
+
+    var b packet.Buffer
+    b.Init(test_join_prune)
+
+    err := p.Unpack(&b)
+    if err != nil {
+        t.Fatalf("Error unpacking: %s", err)
+    }
+
+    if !p.Equals(cmp) {
+        t.Fatalf("Packet mismatch:\n%s\n%s", &p, cmp)
+    }
+
+    if len(p.Groups) != 1 || !p.Groups[0].Addr.Equal(cmp.Groups[0].Addr) ||
+       len(p.Groups[0].Joined) != 1 || len(p.Groups[0].Pruned) != 0 {
+        t.Fatalf("Groups mismatch: %v", p.Groups)
+    }
+
+    src := p.Groups[0].Joined[0]
+    if !src.Addr.Equal(net.ParseIP("10.0.0.100")) || src.Flags != pim.Sparse {
+        t.Fatalf("Source mismatch: %v", src)
+    }
+}
+
+func TestPackIPv4(t *testing.T) {
+    ip4 := ipv4.Make()
+    ip4.SrcAddr = net.ParseIP("10.0.0.1")
+    ip4.DstAddr = net.ParseIP("224.0.0.13")
+
+    p := MakeTestSimple()
+    p.Checksum = 0
+
+    data, err := layers.Pack(ip4, p)
+    if err != nil {
+        t.Fatalf("Error packing: %s", err)
+    }
+
+    if ip4.Protocol != ipv4.PIM || !bytes.Equal(data[20:], test_simple) {
+        t.Fatalf("Raw packet mismatch: %x", data)
+    }
+}
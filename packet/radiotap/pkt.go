@@ -41,6 +41,7 @@ type Packet struct {
     Present         Present
     Data            []byte        `cmp:"skip" string:"skip"`
     pkt_payload     packet.Packet `cmp:"skip" string:"skip"`
+    pkt_raw         []byte        `cmp:"skip" string:"skip"`
 }
 
 type Present uint32
@@ -97,10 +98,12 @@ func (p *Packet) Pack(buf *packet.Buffer) error {
     /* TODO: actually decode fields */
     buf.Write(p.Data)
 
-    return nil
+    return buf.Err()
 }
 
 func (p *Packet) Unpack(buf *packet.Buffer) error {
+    p.pkt_raw = buf.Bytes()
+
     buf.ReadN(&p.Version)
 
     var pad uint8
@@ -112,13 +115,21 @@ func (p *Packet) Unpack(buf *packet.Buffer) error {
     /* TODO: actually decode fields */
     p.Data = buf.Next(int(p.Length) - 8)
 
-    return nil
+    return buf.Err()
 }
 
 func (p *Packet) Payload() packet.Packet {
     return p.pkt_payload
 }
 
+func (p *Packet) RawBytes() []byte {
+    return p.pkt_raw
+}
+
+func (p *Packet) HeaderBytes() []byte {
+    return packet.HeaderBytes(p)
+}
+
 func (p *Packet) GuessPayloadType() packet.Type {
     return packet.WiFi
 }
@@ -133,6 +144,15 @@ func (p *Packet) SetPayload(pl packet.Packet) error {
 func (p *Packet) InitChecksum(csum uint32) {
 }
 
+func (p *Packet) Clone() packet.Packet {
+    c := *p
+
+    c.Data        = packet.CloneBytes(p.Data)
+    c.pkt_payload = packet.ClonePayload(p.pkt_payload)
+
+    return &c
+}
+
 func (p *Packet) String() string {
     return packet.Stringify(p)
 }
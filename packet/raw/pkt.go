@@ -36,7 +36,8 @@ import "fmt"
 import "github.com/adigal150/go.pkt/packet"
 
 type Packet struct {
-    Data   []byte `string:"skip"`
+    Data    []byte `string:"skip"`
+    pkt_raw []byte `cmp:"skip" string:"skip"`
 }
 
 func Make() *Packet {
@@ -62,19 +63,28 @@ func (p *Packet) Answers(other packet.Packet) bool {
 func (p *Packet) Pack(buf *packet.Buffer) error {
     buf.Write(p.Data)
 
-    return nil
+    return buf.Err()
 }
 
 func (p *Packet) Unpack(buf *packet.Buffer) error {
-    p.Data   = buf.Next(buf.Len())
+    p.pkt_raw = buf.Bytes()
+    p.Data    = buf.Next(buf.Len())
 
-    return nil
+    return buf.Err()
 }
 
 func (p *Packet) Payload() packet.Packet {
     return nil
 }
 
+func (p *Packet) RawBytes() []byte {
+    return p.pkt_raw
+}
+
+func (p *Packet) HeaderBytes() []byte {
+    return packet.HeaderBytes(p)
+}
+
 func (p *Packet) GuessPayloadType() packet.Type {
     return packet.None
 }
@@ -86,6 +96,14 @@ func (p *Packet) SetPayload(pl packet.Packet) error {
 func (p *Packet) InitChecksum(csum uint32) {
 }
 
+func (p *Packet) Clone() packet.Packet {
+    c := *p
+
+    c.Data = packet.CloneBytes(p.Data)
+
+    return &c
+}
+
 func (p *Packet) String() string {
     return fmt.Sprintf("data(len=%d)", len(p.Data))
 }
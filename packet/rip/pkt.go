@@ -0,0 +1,285 @@
+/*
+ * Network packet analysis framework.
+ *
+ * Copyright (c) 2014, Alessandro Ghedini
+ * All rights reserved.
+ *
+ * Redistribution and use in source and binary forms, with or without
+ * modification, are permitted provided that the following conditions are
+ * met:
+ *
+ *     * Redistributions of source code must retain the above copyright
+ *       notice, this list of conditions and the following disclaimer.
+ *
+ *     * Redistributions in binary form must reproduce the above copyright
+ *       notice, this list of conditions and the following disclaimer in the
+ *       documentation and/or other materials provided with the distribution.
+ *
+ * THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS
+ * IS" AND ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO,
+ * THE IMPLIED WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR
+ * PURPOSE ARE DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT HOLDER OR
+ * CONTRIBUTORS BE LIABLE FOR ANY DIRECT, INDIRECT, INCIDENTAL, SPECIAL,
+ * EXEMPLARY, OR CONSEQUENTIAL DAMAGES (INCLUDING, BUT NOT LIMITED TO,
+ * PROCUREMENT OF SUBSTITUTE GOODS OR SERVICES; LOSS OF USE, DATA, OR
+ * PROFITS; OR BUSINESS INTERRUPTION) HOWEVER CAUSED AND ON ANY THEORY OF
+ * LIABILITY, WHETHER IN CONTRACT, STRICT LIABILITY, OR TORT (INCLUDING
+ * NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE OF THIS
+ * SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+ */
+// Provides encoding and decoding for RIP (version 1 and 2) packets.
+package rip
+
+import "fmt"
+import "net"
+
+import "github.com/adigal150/go.pkt/packet"
+import "github.com/adigal150/go.pkt/packet/udp"
+
+type Packet struct {
+    Command  Command
+    Version  uint8   `string:"ver"`
+
+    /* RIPv2 authenticated messages only */
+    AuthType uint16  `string:"auth"`
+    Auth     []byte  `cmp:"skip" string:"skip"`
+
+    Routes   []Route `cmp:"skip" string:"skip"`
+    pkt_raw  []byte  `cmp:"skip" string:"skip"`
+}
+
+type Command uint8
+
+const (
+    Request  Command = 1
+    Response         = 2
+)
+
+// Route entry. The route tag, subnet mask and next hop are only used by RIPv2.
+type Route struct {
+    Family  uint16
+    Tag     uint16
+    Addr    net.IP
+    Mask    net.IPMask
+    NextHop net.IP
+    Metric  uint32
+}
+
+const (
+    /* address family of IPv4 routes */
+    FamilyIPv4 uint16 = 2
+
+    /* address family of the authentication entry of RIPv2 messages */
+    FamilyAuth        = 0xFFFF
+)
+
+// Metric of unreachable routes.
+const Infinity = 16
+
+func init() {
+    udp.RegisterPort(520, packet.RIP)
+}
+
+func Make() *Packet {
+    return &Packet{
+        Command: Request,
+        Version: 2,
+    }
+}
+
+func (p *Packet) GetType() packet.Type {
+    return packet.RIP
+}
+
+func (p *Packet) GetLength() uint16 {
+    length := 4 + 20 * len(p.Routes)
+
+    if p.Auth != nil {
+        length += 20
+    }
+
+    return uint16(length)
+}
+
+func (p *Packet) Equals(other packet.Packet) bool {
+    return packet.Compare(p, other)
+}
+
+func (p *Packet) Answers(other packet.Packet) bool {
+    if other == nil || other.GetType() != packet.RIP {
+        return false
+    }
+
+    return p.Command == Response && other.(*Packet).Command == Request
+}
+
+func (p *Packet) Pack(buf *packet.Buffer) error {
+    buf.WriteN(p.Command)
+    buf.WriteN(p.Version)
+    buf.WriteN(uint16(0x0000))
+
+    if p.Auth != nil {
+        if len(p.Auth) != 16 {
+            return fmt.Errorf("Invalid authentication length: %d", len(p.Auth))
+        }
+
+        buf.WriteN(uint16(FamilyAuth))
+        buf.WriteN(p.AuthType)
+        buf.Write(p.Auth)
+    }
+
+    for _, r := range p.Routes {
+        buf.WriteN(r.Family)
+        buf.WriteN(r.Tag)
+
+        err := write_addr(buf, r.Addr)
+        if err != nil {
+            return err
+        }
+
+        err = write_addr(buf, net.IP(r.Mask))
+        if err != nil {
+            return err
+        }
+
+        err = write_addr(buf, r.NextHop)
+        if err != nil {
+            return err
+        }
+
+        buf.WriteN(r.Metric)
+    }
+
+    return buf.Err()
+}
+
+func (p *Packet) Unpack(buf *packet.Buffer) error {
+    p.pkt_raw = buf.Bytes()
+
+    if buf.Len() < 4 || (buf.Len() - 4) % 20 != 0 {
+        return packet.Errorf(packet.ErrInvalidLength,
+                             "Invalid RIP message length: %d", buf.Len())
+    }
+
+    buf.ReadN(&p.Command)
+    buf.ReadN(&p.Version)
+    buf.Next(2)
+
+    for buf.Len() > 0 {
+        var r Route
+
+        buf.ReadN(&r.Family)
+        buf.ReadN(&r.Tag)
+
+        if r.Family == FamilyAuth {
+            if p.Auth != nil || len(p.Routes) > 0 {
+                return fmt.Errorf("Unexpected RIP authentication entry")
+            }
+
+            p.AuthType = r.Tag
+            p.Auth     = buf.Next(16)
+            continue
+        }
+
+        r.Addr    = net.IP(buf.Next(4))
+        r.Mask    = net.IPMask(buf.Next(4))
+        r.NextHop = net.IP(buf.Next(4))
+
+        buf.ReadN(&r.Metric)
+
+        p.Routes = append(p.Routes, r)
+    }
+
+    return buf.Err()
+}
+
+func (p *Packet) Payload() packet.Packet {
+    return nil
+}
+
+func (p *Packet) RawBytes() []byte {
+    return p.pkt_raw
+}
+
+func (p *Packet) HeaderBytes() []byte {
+    return packet.HeaderBytes(p)
+}
+
+func (p *Packet) GuessPayloadType() packet.Type {
+    return packet.None
+}
+
+func (p *Packet) SetPayload(pl packet.Packet) error {
+    return nil
+}
+
+func (p *Packet) InitChecksum(csum uint32) {
+}
+
+func (p *Packet) Clone() packet.Packet {
+    c := *p
+
+    c.Auth = packet.CloneBytes(p.Auth)
+
+    if p.Routes != nil {
+        c.Routes = make([]Route, len(p.Routes))
+
+        for i, r := range p.Routes {
+            r.Addr    = packet.CloneBytes(r.Addr)
+            r.Mask    = packet.CloneBytes(r.Mask)
+            r.NextHop = packet.CloneBytes(r.NextHop)
+
+            c.Routes[i] = r
+        }
+    }
+
+    return &c
+}
+
+func (p *Packet) String() string {
+    return packet.Stringify(p)
+}
+
+// Call fn for each route entry of the packet, until it returns false.
+func (p *Packet) EachRoute(fn func(r *Route) bool) {
+    for i := range p.Routes {
+        if !fn(&p.Routes[i]) {
+            return
+        }
+    }
+}
+
+// Return the prefix length of the route's subnet mask, or -1 if the mask is
+// not canonical.
+func (r *Route) PrefixLen() int {
+    ones, bits := r.Mask.Size()
+    if bits == 0 {
+        return -1
+    }
+
+    return ones
+}
+
+/* write an IPv4 address, or zeros if it's nil */
+func write_addr(buf *packet.Buffer, addr net.IP) error {
+    if addr == nil {
+        buf.WriteN(uint32(0))
+        return nil
+    }
+
+    ip4 := addr.To4()
+    if ip4 == nil {
+        return fmt.Errorf("Invalid IPv4 address: %s", addr)
+    }
+
+    buf.Write(ip4)
+    return nil
+}
+
+func (c Command) String() string {
+    switch c {
+    case Request:  return "request"
+    case Response: return "response"
+    default:       return "unknown"
+    }
+}
@@ -0,0 +1,152 @@
+/*
+ * Network packet analysis framework.
+ *
+ * Copyright (c) 2014, Alessandro Ghedini
+ * All rights reserved.
+ *
+ * Redistribution and use in source and binary forms, with or without
+ * modification, are permitted provided that the following conditions are
+ * met:
+ *
+ *     * Redistributions of source code must retain the above copyright
+ *       notice, this list of conditions and the following disclaimer.
+ *
+ *     * Redistributions in binary form must reproduce the above copyright
+ *       notice, this list of conditions and the following disclaimer in the
+ *       documentation and/or other materials provided with the distribution.
+ *
+ * THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS
+ * IS" AND ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO,
+ * THE IMPLIED WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR
+ * PURPOSE ARE DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT HOLDER OR
+ * CONTRIBUTORS BE LIABLE FOR ANY DIRECT, INDIRECT, INCIDENTAL, SPECIAL,
+ * EXEMPLARY, OR CONSEQUENTIAL DAMAGES (INCLUDING, BUT NOT LIMITED TO,
+ * PROCUREMENT OF SUBSTITUTE GOODS OR SERVICES; LOSS OF USE, DATA, OR
+ * PROFITS; OR BUSINESS INTERRUPTION) HOWEVER CAUSED AND ON ANY THEORY OF
+ * LIABILITY, WHETHER IN CONTRACT, STRICT LIABILITY, OR TORT (INCLUDING
+ * NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE OF THIS
+ * SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+ */
+package rip_test
+
+import "bytes"
+import "net"
+import "testing"
+
+import "github.com/adigal150/go.pkt/packet"
+import "github.com/adigal150/go.pkt/packet/rip"
+
+/* RIPv2 response with two routes, the second one with a route tag and an
+ * explicit next hop */
+var test_simple = []byte{
+    0x02, 0x02, 0x00, 0x00, 0x00, 0x02, 0x00, 0x00, 0x0a, 0x00, 0x01, 0x00,
+    0xff, 0xff, 0xff, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x01,
+    0x00, 0x02, 0x00, 0x05, 0xc0, 0xa8, 0x02, 0x00, 0xff, 0xff, 0xff, 0x00,
+    0x0a, 0x00, 0x00, 0xfe, 0x00, 0x00, 0x00, 0x03,
+}
+
+func MakeTestSimple() *rip.Packet {
+    return &rip.Packet{
+        Command: rip.Response,
+        Version: 2,
+        Routes: []rip.Route{
+            {
+                Family: rip.FamilyIPv4,
+                Addr:   net.ParseIP("10.0.1.0"),
+                Mask:   net.CIDRMask(24, 32),
+                Metric: 1,
+            },
+            {
+                Family:  rip.FamilyIPv4,
+                Tag:     5,
+                Addr:    net.ParseIP("192.168.2.0"),
+                Mask:    net.CIDRMask(24, 32),
+                NextHop: net.ParseIP("10.0.0.254"),
+                Metric:  3,
+            },
+        },
+    }
+}
+
+func TestPack(t *testing.T) {
+    var b packet.Buffer
+    b.Init(make([]byte, len(test_simple)))
+
+    p := MakeTestSimple()
+
+    if int(p.GetLength()) != len(test_simple) {
+        t.Fatalf("Length mismatch: %d", p.GetLength())
+    }
+
+    err := p.Pack(&b)
+    if err != nil {
+        t.Fatalf("Error packing: %s", err)
+    }
+
+    if !bytes.Equal(test_simple, b.Buffer()) {
+        t.Fatalf("Raw packet mismatch: %x", b.Buffer())
+    }
+}
+
+func BenchmarkPack(bn *testing.B) {
+    var b packet.Buffer
+    b.Init(make([]byte, len(test_simple)))
+
+    p := MakeTestSimple()
+
+    for n := 0; n < bn.N; n++ {
+        p.Pack(&b)
+    }
+}
+
+func TestUnpack(t *testing.T) {
+    var p rip.Packet
+
+    cmp := MakeTestSimple()
+
+    var b packet.Buffer
+    b.Init(test_simple)
+
+    err := p.Unpack(&b)
+    if err != nil {
+        t.Fatalf("Error unpacking: %s", err)
+    }
+
+    if !p.Equals(cmp) {
+        t.Fatalf("Packet mismatch:\n%s\n%s", &p, cmp)
+    }
+
+    var count int
+
+    p.EachRoute(func(r *rip.Route) bool {
+        exp := &cmp.Routes[count]
+
+        if r.Family != exp.Family || r.Tag != exp.Tag ||
+           !r.Addr.Equal(exp.Addr) || r.PrefixLen() != 24 ||
+           r.Metric != exp.Metric {
+            t.Fatalf("Route mismatch: %v", r)
+        }
+
+        count++
+        return true
+    })
+
+    if count != 2 {
+        t.Fatalf("Route count mismatch: %d", count)
+    }
+
+    if p.Routes[0].NextHop.String() != "0.0.0.0" ||
+       !p.Routes[1].NextHop.Equal(net.ParseIP("10.0.0.254")) {
+        t.Fatalf("Next hop mismatch: %v", p.Routes)
+    }
+}
+
+func BenchmarkUnpack(bn *testing.B) {
+    var p rip.Packet
+    var b packet.Buffer
+
+    for n := 0; n < bn.N; n++ {
+        b.Init(test_simple)
+        p.Unpack(&b)
+    }
+}
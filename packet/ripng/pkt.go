@@ -0,0 +1,205 @@
+/*
+ * Network packet analysis framework.
+ *
+ * Copyright (c) 2014, Alessandro Ghedini
+ * All rights reserved.
+ *
+ * Redistribution and use in source and binary forms, with or without
+ * modification, are permitted provided that the following conditions are
+ * met:
+ *
+ *     * Redistributions of source code must retain the above copyright
+ *       notice, this list of conditions and the following disclaimer.
+ *
+ *     * Redistributions in binary form must reproduce the above copyright
+ *       notice, this list of conditions and the following disclaimer in the
+ *       documentation and/or other materials provided with the distribution.
+ *
+ * THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS
+ * IS" AND ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO,
+ * THE IMPLIED WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR
+ * PURPOSE ARE DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT HOLDER OR
+ * CONTRIBUTORS BE LIABLE FOR ANY DIRECT, INDIRECT, INCIDENTAL, SPECIAL,
+ * EXEMPLARY, OR CONSEQUENTIAL DAMAGES (INCLUDING, BUT NOT LIMITED TO,
+ * PROCUREMENT OF SUBSTITUTE GOODS OR SERVICES; LOSS OF USE, DATA, OR
+ * PROFITS; OR BUSINESS INTERRUPTION) HOWEVER CAUSED AND ON ANY THEORY OF
+ * LIABILITY, WHETHER IN CONTRACT, STRICT LIABILITY, OR TORT (INCLUDING
+ * NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE OF THIS
+ * SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+ */
+// Provides encoding and decoding for RIPng (RFC 2080) packets.
+package ripng
+
+import "fmt"
+import "net"
+
+import "github.com/adigal150/go.pkt/packet"
+import "github.com/adigal150/go.pkt/packet/rip"
+import "github.com/adigal150/go.pkt/packet/udp"
+
+type Packet struct {
+    Command rip.Command
+    Version uint8       `string:"ver"`
+    Routes  []Route     `cmp:"skip" string:"skip"`
+    pkt_raw []byte      `cmp:"skip" string:"skip"`
+}
+
+// Route table entry. Entries with the NextHop metric carry the next hop of the
+// entries that follow them in the Prefix field, instead of a route.
+type Route struct {
+    Prefix    net.IP
+    Tag       uint16
+    PrefixLen uint8
+    Metric    uint8
+}
+
+// Metric of the entries specifying a next hop.
+const NextHop = 0xFF
+
+func init() {
+    udp.RegisterPort(521, packet.RIPng)
+}
+
+func Make() *Packet {
+    return &Packet{
+        Command: rip.Request,
+        Version: 1,
+    }
+}
+
+func (p *Packet) GetType() packet.Type {
+    return packet.RIPng
+}
+
+func (p *Packet) GetLength() uint16 {
+    return uint16(4 + 20 * len(p.Routes))
+}
+
+func (p *Packet) Equals(other packet.Packet) bool {
+    return packet.Compare(p, other)
+}
+
+func (p *Packet) Answers(other packet.Packet) bool {
+    if other == nil || other.GetType() != packet.RIPng {
+        return false
+    }
+
+    return p.Command == rip.Response && other.(*Packet).Command == rip.Request
+}
+
+func (p *Packet) Pack(buf *packet.Buffer) error {
+    buf.WriteN(p.Command)
+    buf.WriteN(p.Version)
+    buf.WriteN(uint16(0x0000))
+
+    for _, r := range p.Routes {
+        if r.Prefix == nil {
+            buf.Write(net.IPv6zero)
+        } else if len(r.Prefix.To16()) == net.IPv6len {
+            buf.Write(r.Prefix.To16())
+        } else {
+            return fmt.Errorf("Invalid IPv6 prefix: %s", r.Prefix)
+        }
+
+        buf.WriteN(r.Tag)
+        buf.WriteN(r.PrefixLen)
+        buf.WriteN(r.Metric)
+    }
+
+    return buf.Err()
+}
+
+func (p *Packet) Unpack(buf *packet.Buffer) error {
+    p.pkt_raw = buf.Bytes()
+
+    if buf.Len() < 4 || (buf.Len() - 4) % 20 != 0 {
+        return packet.Errorf(packet.ErrInvalidLength,
+                             "Invalid RIPng message length: %d", buf.Len())
+    }
+
+    buf.ReadN(&p.Command)
+    buf.ReadN(&p.Version)
+    buf.Next(2)
+
+    for buf.Len() > 0 {
+        var r Route
+
+        r.Prefix = net.IP(buf.Next(16))
+
+        buf.ReadN(&r.Tag)
+        buf.ReadN(&r.PrefixLen)
+        buf.ReadN(&r.Metric)
+
+        p.Routes = append(p.Routes, r)
+    }
+
+    return buf.Err()
+}
+
+func (p *Packet) Payload() packet.Packet {
+    return nil
+}
+
+func (p *Packet) RawBytes() []byte {
+    return p.pkt_raw
+}
+
+func (p *Packet) HeaderBytes() []byte {
+    return packet.HeaderBytes(p)
+}
+
+func (p *Packet) GuessPayloadType() packet.Type {
+    return packet.None
+}
+
+func (p *Packet) SetPayload(pl packet.Packet) error {
+    return nil
+}
+
+func (p *Packet) InitChecksum(csum uint32) {
+}
+
+func (p *Packet) Clone() packet.Packet {
+    c := *p
+
+    if p.Routes != nil {
+        c.Routes = make([]Route, len(p.Routes))
+
+        for i, r := range p.Routes {
+            r.Prefix = packet.CloneBytes(r.Prefix)
+
+            c.Routes[i] = r
+        }
+    }
+
+    return &c
+}
+
+func (p *Packet) String() string {
+    return packet.Stringify(p)
+}
+
+// Call fn for each route entry of the packet, along with the next hop that
+// applies to it (nil for the originator of the packet), until it returns
+// false. Next hop entries are not passed to fn.
+func (p *Packet) EachRoute(fn func(r *Route, next_hop net.IP) bool) {
+    var next_hop net.IP
+
+    for i := range p.Routes {
+        r := &p.Routes[i]
+
+        if r.Metric == NextHop {
+            next_hop = r.Prefix
+
+            if next_hop.IsUnspecified() {
+                next_hop = nil
+            }
+
+            continue
+        }
+
+        if !fn(r, next_hop) {
+            return
+        }
+    }
+}
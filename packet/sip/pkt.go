@@ -0,0 +1,375 @@
+/*
+ * Network packet analysis framework.
+ *
+ * Copyright (c) 2014, Alessandro Ghedini
+ * All rights reserved.
+ *
+ * Redistribution and use in source and binary forms, with or without
+ * modification, are permitted provided that the following conditions are
+ * met:
+ *
+ *     * Redistributions of source code must retain the above copyright
+ *       notice, this list of conditions and the following disclaimer.
+ *
+ *     * Redistributions in binary form must reproduce the above copyright
+ *       notice, this list of conditions and the following disclaimer in the
+ *       documentation and/or other materials provided with the distribution.
+ *
+ * THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS
+ * IS" AND ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO,
+ * THE IMPLIED WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR
+ * PURPOSE ARE DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT HOLDER OR
+ * CONTRIBUTORS BE LIABLE FOR ANY DIRECT, INDIRECT, INCIDENTAL, SPECIAL,
+ * EXEMPLARY, OR CONSEQUENTIAL DAMAGES (INCLUDING, BUT NOT LIMITED TO,
+ * PROCUREMENT OF SUBSTITUTE GOODS OR SERVICES; LOSS OF USE, DATA, OR
+ * PROFITS; OR BUSINESS INTERRUPTION) HOWEVER CAUSED AND ON ANY THEORY OF
+ * LIABILITY, WHETHER IN CONTRACT, STRICT LIABILITY, OR TORT (INCLUDING
+ * NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE OF THIS
+ * SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+ */
+
+// Provides encoding and decoding for SIP (Session Initiation Protocol) packets.
+//
+// Both requests and responses are supported, over either UDP or TCP. The start
+// line, the header fields and the message body are decoded, and the common
+// header fields are made available through accessor methods.
+package sip
+
+import "bytes"
+import "fmt"
+import "strconv"
+import "strings"
+
+import "github.com/adigal150/go.pkt/packet"
+import "github.com/adigal150/go.pkt/packet/tcp"
+import "github.com/adigal150/go.pkt/packet/udp"
+
+type Packet struct {
+    StartLine   string        `string:"line"`
+    Headers     []Header      `cmp:"skip" string:"skip"`
+    Body        []byte        `cmp:"skip" string:"skip"`
+    eol         string        `cmp:"skip" string:"skip"`
+    pkt_payload packet.Packet `cmp:"skip" string:"skip"`
+    pkt_raw     []byte        `cmp:"skip" string:"skip"`
+}
+
+type Header struct {
+    Name  string
+    Value string
+}
+
+var compact_names = map[string]string{
+    "i": "call-id",
+    "l": "content-length",
+    "c": "content-type",
+    "f": "from",
+    "m": "contact",
+    "t": "to",
+    "v": "via",
+}
+
+func init() {
+    udp.RegisterPort(5060, packet.SIP)
+    tcp.RegisterPort(5060, packet.SIP)
+}
+
+func Make() *Packet {
+    return &Packet{ }
+}
+
+func (p *Packet) GetType() packet.Type {
+    return packet.SIP
+}
+
+func (p *Packet) GetLength() uint16 {
+    eol := p.line_end()
+
+    length := len(p.StartLine) + len(eol)
+
+    for _, h := range p.Headers {
+        length += len(h.Name) + 2 + len(h.Value) + len(eol)
+    }
+
+    length += len(eol) + len(p.Body)
+
+    if p.pkt_payload != nil {
+        length += int(p.pkt_payload.GetLength())
+    }
+
+    return uint16(length)
+}
+
+func (p *Packet) Equals(other packet.Packet) bool {
+    return packet.Compare(p, other)
+}
+
+func (p *Packet) Answers(other packet.Packet) bool {
+    if other == nil || other.GetType() != packet.SIP {
+        return false
+    }
+
+    req := other.(*Packet)
+
+    return !p.IsRequest() && req.IsRequest() &&
+           p.CallID() == req.CallID() && p.CSeq() == req.CSeq()
+}
+
+func (p *Packet) Pack(buf *packet.Buffer) error {
+    eol := p.line_end()
+
+    buf.Write([]byte(p.StartLine + eol))
+
+    for _, h := range p.Headers {
+        buf.Write([]byte(h.Name + ": " + h.Value + eol))
+    }
+
+    buf.Write([]byte(eol))
+    buf.Write(p.Body)
+
+    return buf.Err()
+}
+
+/* Return the line terminator of the message, which is CRLF unless the message
+ * was decoded with bare LF terminators */
+func (p *Packet) line_end() string {
+    if p.eol == "" {
+        return "\r\n"
+    }
+
+    return p.eol
+}
+
+func (p *Packet) Unpack(buf *packet.Buffer) error {
+    p.pkt_raw = buf.Bytes()
+
+    data := buf.Bytes()
+
+    hdr_len  := bytes.Index(data, []byte("\r\n\r\n"))
+    term_len := 4
+
+    if hdr_len < 0 {
+        hdr_len  = bytes.Index(data, []byte("\n\n"))
+        term_len = 2
+    }
+
+    if hdr_len < 0 {
+        hdr_len  = len(data)
+        term_len = 0
+    }
+
+    p.eol = "\r\n"
+    if term_len == 2 {
+        p.eol = "\n"
+    }
+
+    lines := strings.Split(string(data[:hdr_len]), "\n")
+
+    p.StartLine = strings.TrimRight(lines[0], "\r")
+    p.Headers   = nil
+
+    for _, line := range lines[1:] {
+        line = strings.TrimRight(line, "\r")
+
+        /* folded header value */
+        if (strings.HasPrefix(line, " ") || strings.HasPrefix(line, "\t")) &&
+           len(p.Headers) > 0 {
+            last := &p.Headers[len(p.Headers) - 1]
+            last.Value += " " + strings.TrimSpace(line)
+            continue
+        }
+
+        sep := strings.Index(line, ":")
+        if sep < 0 {
+            return packet.Errorf(packet.ErrUnsupported,
+                                 "Invalid SIP header: %s", line)
+        }
+
+        p.Headers = append(p.Headers, Header{
+            Name:  strings.TrimSpace(line[:sep]),
+            Value: strings.TrimSpace(line[sep + 1:]),
+        })
+    }
+
+    buf.Next(hdr_len + term_len)
+
+    body_len := buf.Len()
+
+    if h := p.Header("content-length"); h != "" {
+        n, err := strconv.Atoi(h)
+        if err != nil {
+            return packet.Errorf(packet.ErrInvalidLength,
+                                 "Invalid SIP content length: %s", h)
+        }
+
+        if n < 0 {
+            return packet.Errorf(packet.ErrInvalidLength,
+                                 "Invalid SIP content length: %d", n)
+        }
+
+        if n < body_len {
+            body_len = n
+        }
+    }
+
+    p.Body = buf.Next(body_len)
+
+    return buf.Err()
+}
+
+func (p *Packet) Payload() packet.Packet {
+    return p.pkt_payload
+}
+
+func (p *Packet) RawBytes() []byte {
+    return p.pkt_raw
+}
+
+func (p *Packet) HeaderBytes() []byte {
+    return packet.HeaderBytes(p)
+}
+
+func (p *Packet) GuessPayloadType() packet.Type {
+    /* multiple messages can share the same TCP segment */
+    return packet.SIP
+}
+
+// Return true, since the payload of a message can only be the next message in
+// the same segment (see packet.MessagePacket).
+func (p *Packet) NextMessage() bool {
+    return true
+}
+
+func (p *Packet) SetPayload(pl packet.Packet) error {
+    p.pkt_payload = pl
+
+    return nil
+}
+
+func (p *Packet) InitChecksum(csum uint32) {
+}
+
+func (p *Packet) Clone() packet.Packet {
+    c := *p
+
+    c.Headers     = append([]Header(nil), p.Headers...)
+    c.Body        = packet.CloneBytes(p.Body)
+    c.pkt_payload = packet.ClonePayload(p.pkt_payload)
+
+    return &c
+}
+
+func (p *Packet) String() string {
+    s := fmt.Sprintf("sip(line=%s, call-id=%s, len=%d)",
+                     p.StartLine, p.CallID(), len(p.Body))
+
+    if p.pkt_payload != nil {
+        s += " | " + p.pkt_payload.String()
+    }
+
+    return s
+}
+
+// Return the value of the first header field with the given name (compact
+// forms are also recognized), or the empty string if none was found.
+func (p *Packet) Header(name string) string {
+    name = strings.ToLower(name)
+
+    for _, h := range p.Headers {
+        hname := strings.ToLower(h.Name)
+
+        if long, ok := compact_names[hname]; ok {
+            hname = long
+        }
+
+        if hname == name {
+            return h.Value
+        }
+    }
+
+    return ""
+}
+
+// Check whether the message is a request (as opposed to a response).
+func (p *Packet) IsRequest() bool {
+    return !strings.HasPrefix(p.StartLine, "SIP/")
+}
+
+// Return the request method, or the empty string for responses.
+func (p *Packet) Method() string {
+    if !p.IsRequest() {
+        return ""
+    }
+
+    return p.start_field(0)
+}
+
+// Return the request URI, or the empty string for responses.
+func (p *Packet) URI() string {
+    if !p.IsRequest() {
+        return ""
+    }
+
+    return p.start_field(1)
+}
+
+// Return the response status code, or 0 for requests.
+func (p *Packet) StatusCode() int {
+    if p.IsRequest() {
+        return 0
+    }
+
+    code, err := strconv.Atoi(p.start_field(1))
+    if err != nil {
+        return 0
+    }
+
+    return code
+}
+
+// Return the response reason phrase, or the empty string for requests.
+func (p *Packet) Reason() string {
+    if p.IsRequest() {
+        return ""
+    }
+
+    fields := strings.SplitN(p.StartLine, " ", 3)
+    if len(fields) < 3 {
+        return ""
+    }
+
+    return fields[2]
+}
+
+func (p *Packet) start_field(i int) string {
+    fields := strings.SplitN(p.StartLine, " ", 3)
+    if len(fields) <= i {
+        return ""
+    }
+
+    return fields[i]
+}
+
+// Return the value of the Via header field.
+func (p *Packet) Via() string {
+    return p.Header("via")
+}
+
+// Return the value of the From header field.
+func (p *Packet) From() string {
+    return p.Header("from")
+}
+
+// Return the value of the To header field.
+func (p *Packet) To() string {
+    return p.Header("to")
+}
+
+// Return the value of the Call-ID header field.
+func (p *Packet) CallID() string {
+    return p.Header("call-id")
+}
+
+// Return the value of the CSeq header field.
+func (p *Packet) CSeq() string {
+    return p.Header("cseq")
+}
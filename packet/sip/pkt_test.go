@@ -0,0 +1,301 @@
+/*
+ * Network packet analysis framework.
+ *
+ * Copyright (c) 2014, Alessandro Ghedini
+ * All rights reserved.
+ *
+ * Redistribution and use in source and binary forms, with or without
+ * modification, are permitted provided that the following conditions are
+ * met:
+ *
+ *     * Redistributions of source code must retain the above copyright
+ *       notice, this list of conditions and the following disclaimer.
+ *
+ *     * Redistributions in binary form must reproduce the above copyright
+ *       notice, this list of conditions and the following disclaimer in the
+ *       documentation and/or other materials provided with the distribution.
+ *
+ * THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS
+ * IS" AND ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO,
+ * THE IMPLIED WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR
+ * PURPOSE ARE DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT HOLDER OR
+ * CONTRIBUTORS BE LIABLE FOR ANY DIRECT, INDIRECT, INCIDENTAL, SPECIAL,
+ * EXEMPLARY, OR CONSEQUENTIAL DAMAGES (INCLUDING, BUT NOT LIMITED TO,
+ * PROCUREMENT OF SUBSTITUTE GOODS OR SERVICES; LOSS OF USE, DATA, OR
+ * PROFITS; OR BUSINESS INTERRUPTION) HOWEVER CAUSED AND ON ANY THEORY OF
+ * LIABILITY, WHETHER IN CONTRACT, STRICT LIABILITY, OR TORT (INCLUDING
+ * NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE OF THIS
+ * SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+ */
+
+package sip_test
+
+import "bytes"
+import "errors"
+import "testing"
+
+import "github.com/adigal150/go.pkt/layers"
+import "github.com/adigal150/go.pkt/packet"
+import "github.com/adigal150/go.pkt/packet/sip"
+
+var test_invite = []byte(
+    "INVITE sip:bob@biloxi.example.com SIP/2.0\r\n" +
+    "Via: SIP/2.0/UDP pc33.atlanta.example.com;branch=z9hG4bK776asdhds\r\n" +
+    "Max-Forwards: 70\r\n" +
+    "To: Bob <sip:bob@biloxi.example.com>\r\n" +
+    "From: Alice <sip:alice@atlanta.example.com>;tag=1928301774\r\n" +
+    "Call-ID: a84b4c76e66710@pc33.atlanta.example.com\r\n" +
+    "CSeq: 314159 INVITE\r\n" +
+    "Content-Type: application/sdp\r\n" +
+    "Content-Length: 4\r\n" +
+    "\r\n" +
+    "v=0\n",
+)
+
+var test_ok = []byte(
+    "SIP/2.0 200 OK\r\n" +
+    "Via: SIP/2.0/UDP pc33.atlanta.example.com;branch=z9hG4bK776asdhds\r\n" +
+    "To: Bob <sip:bob@biloxi.example.com>;tag=a6c85cf\r\n" +
+    "From: Alice <sip:alice@atlanta.example.com>;tag=1928301774\r\n" +
+    "i: a84b4c76e66710@pc33.atlanta.example.com\r\n" +
+    "CSeq: 314159 INVITE\r\n" +
+    "l: 0\r\n" +
+    "\r\n",
+)
+
+func MakeTestSimple() *sip.Packet {
+    return &sip.Packet{
+        StartLine: "INVITE sip:bob@biloxi.example.com SIP/2.0",
+        Headers: []sip.Header{
+            { "Via", "SIP/2.0/UDP pc33.atlanta.example.com;branch=z9hG4bK776asdhds" },
+            { "Max-Forwards", "70" },
+            { "To", "Bob <sip:bob@biloxi.example.com>" },
+            { "From", "Alice <sip:alice@atlanta.example.com>;tag=1928301774" },
+            { "Call-ID", "a84b4c76e66710@pc33.atlanta.example.com" },
+            { "CSeq", "314159 INVITE" },
+            { "Content-Type", "application/sdp" },
+            { "Content-Length", "4" },
+        },
+        Body: []byte("v=0\n"),
+    }
+}
+
+func TestPack(t *testing.T) {
+    var b packet.Buffer
+    b.Init(make([]byte, len(test_invite)))
+
+    p := MakeTestSimple()
+
+    if p.GetLength() != uint16(len(test_invite)) {
+        t.Fatalf("Length mismatch: %d", p.GetLength())
+    }
+
+    err := p.Pack(&b)
+    if err != nil {
+        t.Fatalf("Error packing: %s", err)
+    }
+
+    if !bytes.Equal(test_invite, b.Buffer()) {
+        t.Fatalf("Raw packet mismatch: %s", b.Buffer())
+    }
+}
+
+func BenchmarkPack(bn *testing.B) {
+    var b packet.Buffer
+    b.Init(make([]byte, len(test_invite)))
+
+    p := MakeTestSimple()
+
+    for n := 0; n < bn.N; n++ {
+        p.Pack(&b)
+    }
+}
+
+func TestUnpack(t *testing.T) {
+    var p sip.Packet
+
+    cmp := MakeTestSimple()
+
+    var b packet.Buffer
+    b.Init(test_invite)
+
+    err := p.Unpack(&b)
+    if err != nil {
+        t.Fatalf("Error unpacking: %s", err)
+    }
+
+    if !p.Equals(cmp) {
+        t.Fatalf("Packet mismatch:\n%s\n%s", &p, cmp)
+    }
+
+    if !p.IsRequest() || p.Method() != "INVITE" || p.StatusCode() != 0 {
+        t.Fatalf("Start line mismatch: %s", p.StartLine)
+    }
+
+    if p.URI() != "sip:bob@biloxi.example.com" {
+        t.Fatalf("URI mismatch: %s", p.URI())
+    }
+
+    if p.CallID() != "a84b4c76e66710@pc33.atlanta.example.com" {
+        t.Fatalf("Call-ID mismatch: %s", p.CallID())
+    }
+
+    if p.CSeq() != "314159 INVITE" {
+        t.Fatalf("CSeq mismatch: %s", p.CSeq())
+    }
+
+    if len(p.Headers) != len(cmp.Headers) {
+        t.Fatalf("Headers mismatch: %v", p.Headers)
+    }
+
+    if !bytes.Equal(p.Body, cmp.Body) {
+        t.Fatalf("Body mismatch: %s", p.Body)
+    }
+}
+
+func BenchmarkUnpack(bn *testing.B) {
+    var p sip.Packet
+    var b packet.Buffer
+
+    for n := 0; n < bn.N; n++ {
+        b.Init(test_invite)
+        p.Unpack(&b)
+    }
+}
+
+func TestUnpackResponse(t *testing.T) {
+    var req sip.Packet
+    var rsp sip.Packet
+
+    var b packet.Buffer
+
+    b.Init(test_ok)
+
+    err := rsp.Unpack(&b)
+    if err != nil {
+        t.Fatalf("Error unpacking: %s", err)
+    }
+
+    if rsp.IsRequest() || rsp.Method() != "" {
+        t.Fatalf("Start line mismatch: %s", rsp.StartLine)
+    }
+
+    if rsp.StatusCode() != 200 || rsp.Reason() != "OK" {
+        t.Fatalf("Status mismatch: %d %s", rsp.StatusCode(), rsp.Reason())
+    }
+
+    if rsp.CallID() != "a84b4c76e66710@pc33.atlanta.example.com" {
+        t.Fatalf("Call-ID mismatch: %s", rsp.CallID())
+    }
+
+    if len(rsp.Body) != 0 {
+        t.Fatalf("Body mismatch: %s", rsp.Body)
+    }
+
+    b.Init(test_invite)
+
+    err = req.Unpack(&b)
+    if err != nil {
+        t.Fatalf("Error unpacking: %s", err)
+    }
+
+    if !rsp.Answers(&req) {
+        t.Fatalf("No answer")
+    }
+
+    if req.Answers(&rsp) {
+        t.Fatalf("Request answers response")
+    }
+}
+
+func TestUnpackPipelined(t *testing.T) {
+    buf := append(append([]byte{}, test_invite...), test_ok...)
+
+    pkt, err := layers.UnpackAll(buf, packet.SIP)
+    if err != nil {
+        t.Fatalf("Error unpacking: %s", err)
+    }
+
+    req := pkt.(*sip.Packet)
+    if !req.IsRequest() || !bytes.Equal(req.HeaderBytes(), test_invite) {
+        t.Fatalf("Request mismatch: %s", req)
+    }
+
+    rsp, ok := req.Payload().(*sip.Packet)
+    if !ok || rsp.StatusCode() != 200 || !rsp.Answers(req) {
+        t.Fatalf("Response mismatch: %v", req.Payload())
+    }
+
+    if req.GetLength() != uint16(len(buf)) {
+        t.Fatalf("Length mismatch: %d", req.GetLength())
+    }
+}
+
+func TestUnpackNegativeLength(t *testing.T) {
+    var p sip.Packet
+
+    msg := bytes.Replace(test_invite, []byte("Content-Length: 4"),
+                         []byte("Content-Length: -4"), 1)
+
+    var b packet.Buffer
+    b.Init(msg)
+
+    err := p.Unpack(&b)
+    if !errors.Is(err, packet.ErrInvalidLength) {
+        t.Fatalf("Negative length not detected: %v", err)
+    }
+}
+
+func TestUnpackBareLF(t *testing.T) {
+    invite := bytes.ReplaceAll(test_invite, []byte("\r\n"), []byte("\n"))
+    ok     := bytes.ReplaceAll(test_ok, []byte("\r\n"), []byte("\n"))
+
+    buf := append(append([]byte{}, invite...), ok...)
+
+    pkt, err := layers.UnpackAll(buf, packet.SIP)
+    if err != nil {
+        t.Fatalf("Error unpacking: %s", err)
+    }
+
+    req := pkt.(*sip.Packet)
+    if !bytes.Equal(req.HeaderBytes(), invite) {
+        t.Fatalf("Request mismatch: %s", req)
+    }
+
+    if req.GetLength() != uint16(len(buf)) {
+        t.Fatalf("Length mismatch: %d", req.GetLength())
+    }
+
+    var b packet.Buffer
+    b.Init(make([]byte, len(invite)))
+
+    err = req.Pack(&b)
+    if err != nil {
+        t.Fatalf("Error packing: %s", err)
+    }
+
+    if !bytes.Equal(b.Buffer(), invite) {
+        t.Fatalf("Raw packet mismatch: %q", b.Buffer())
+    }
+}
+
+func TestUnpackInvalid(t *testing.T) {
+    msgs := map[string]error{
+        "INVITE sip:bob@biloxi.example.com SIP/2.0\r\nVia\r\n\r\n":
+            packet.ErrUnsupported,
+        "INVITE sip:bob@biloxi.example.com SIP/2.0\r\nl: x\r\n\r\n":
+            packet.ErrInvalidLength,
+    }
+
+    for msg, want := range msgs {
+        var p sip.Packet
+
+        var b packet.Buffer
+        b.Init([]byte(msg))
+
+        err := p.Unpack(&b)
+        if !errors.Is(err, want) {
+            t.Fatalf("Unexpected error: %v", err)
+        }
+    }
+}
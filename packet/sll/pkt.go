@@ -38,11 +38,13 @@ import "github.com/adigal150/go.pkt/packet/eth"
 
 type Packet struct {
     Type        Type
-    AddrType    uint16           `string:"atype"`
-    AddrLen     uint16           `string:"alen"`
-    SrcAddr     net.HardwareAddr `string:"src"`
+    AddrType    uint16               `string:"atype"`
+    AddrLen     uint16               `string:"alen"`
+    SrcAddr     net.HardwareAddr     `string:"src"`
     EtherType   eth.EtherType
-    pkt_payload packet.Packet    `cmp:"skip" string:"skip"`
+    pkt_payload packet.Packet        `cmp:"skip" string:"skip"`
+    pkt_decode  func() packet.Packet `cmp:"skip" string:"skip"`
+    pkt_raw     []byte               `cmp:"skip" string:"skip"`
 }
 
 type Type uint16
@@ -68,8 +70,8 @@ func (p *Packet) GetType() packet.Type {
 }
 
 func (p *Packet) GetLength() uint16 {
-    if p.pkt_payload != nil {
-        return p.pkt_payload.GetLength() + 16
+    if p.Payload() != nil {
+        return p.Payload().GetLength() + 16
     }
 
     return p.AddrLen + 16
@@ -95,10 +97,12 @@ func (p *Packet) Pack(buf *packet.Buffer) error {
 
     buf.WriteN(p.EtherType)
 
-    return nil
+    return buf.Err()
 }
 
 func (p *Packet) Unpack(buf *packet.Buffer) error {
+    p.pkt_raw = buf.Bytes()
+
     buf.ReadN(&p.Type)
     buf.ReadN(&p.AddrType)
     buf.ReadN(&p.AddrLen)
@@ -108,27 +112,56 @@ func (p *Packet) Unpack(buf *packet.Buffer) error {
 
     buf.ReadN(&p.EtherType)
 
-    return nil
+    return buf.Err()
 }
 
 func (p *Packet) Payload() packet.Packet {
+    if p.pkt_decode != nil {
+        p.pkt_payload = p.pkt_decode()
+        p.pkt_decode  = nil
+    }
+
     return p.pkt_payload
 }
 
+func (p *Packet) RawBytes() []byte {
+    return p.pkt_raw
+}
+
+func (p *Packet) HeaderBytes() []byte {
+    return packet.HeaderBytes(p)
+}
+
 func (p *Packet) GuessPayloadType() packet.Type {
     return eth.EtherTypeToType(p.EtherType)
 }
 
 func (p *Packet) SetPayload(pl packet.Packet) error {
     p.pkt_payload = pl
+    p.pkt_decode  = nil
     p.EtherType   = eth.TypeToEtherType(pl.GetType())
 
     return nil
 }
 
+func (p *Packet) SetPayloadDecoder(decode func() packet.Packet) {
+    p.pkt_payload = nil
+    p.pkt_decode  = decode
+}
+
 func (p *Packet) InitChecksum(csum uint32) {
 }
 
+func (p *Packet) Clone() packet.Packet {
+    c := *p
+
+    c.SrcAddr     = packet.CloneBytes(p.SrcAddr)
+    c.pkt_payload = packet.ClonePayload(p.Payload())
+    c.pkt_decode  = nil
+
+    return &c
+}
+
 func (p *Packet) String() string {
     return packet.Stringify(p)
 }
@@ -39,6 +39,19 @@ type Packet struct {
     Type        eth.EtherType
 
     pkt_payload packet.Packet `cmp:"skip" string:"skip"`
+    pkt_raw     []byte        `cmp:"skip" string:"skip"`
+}
+
+// Organizationally unique identifier of Cisco, used by its SNAP protocols.
+var CiscoOUI = [3]byte{ 0x00, 0x00, 0x0c }
+
+/* protocols identified by both the OUI and the protocol id */
+var oui_protocols = []struct {
+    oui      [3]byte
+    pid      eth.EtherType
+    pkt_type packet.Type
+}{
+    { CiscoOUI, 0x2004, packet.DTP },
 }
 
 func Make() *Packet {
@@ -69,21 +82,37 @@ func (p *Packet) Pack(buf *packet.Buffer) error {
     buf.WriteN(p.OUI)
     buf.WriteN(p.Type)
 
-    return nil
+    return buf.Err()
 }
 
 func (p *Packet) Unpack(buf *packet.Buffer) error {
+    p.pkt_raw = buf.Bytes()
+
     buf.ReadN(&p.OUI)
     buf.ReadN(&p.Type)
 
-    return nil
+    return buf.Err()
 }
 
 func (p *Packet) Payload() packet.Packet {
     return p.pkt_payload
 }
 
+func (p *Packet) RawBytes() []byte {
+    return p.pkt_raw
+}
+
+func (p *Packet) HeaderBytes() []byte {
+    return packet.HeaderBytes(p)
+}
+
 func (p *Packet) GuessPayloadType() packet.Type {
+    for _, proto := range oui_protocols {
+        if p.OUI == proto.oui && p.Type == proto.pid {
+            return proto.pkt_type
+        }
+    }
+
     if p.OUI[0] == 0x00 && p.OUI[1] == 0x00 && p.OUI[2] == 0x00 {
         return eth.EtherTypeToType(p.Type)
     } else {
@@ -93,7 +122,16 @@ func (p *Packet) GuessPayloadType() packet.Type {
 
 func (p *Packet) SetPayload(pl packet.Packet) error {
     p.pkt_payload = pl
-    p.Type        = eth.TypeToEtherType(pl.GetType())
+
+    for _, proto := range oui_protocols {
+        if pl.GetType() == proto.pkt_type {
+            p.OUI  = proto.oui
+            p.Type = proto.pid
+            return nil
+        }
+    }
+
+    p.Type = eth.TypeToEtherType(pl.GetType())
 
     return nil
 }
@@ -101,6 +139,14 @@ func (p *Packet) SetPayload(pl packet.Packet) error {
 func (p *Packet) InitChecksum(csum uint32) {
 }
 
+func (p *Packet) Clone() packet.Packet {
+    c := *p
+
+    c.pkt_payload = packet.ClonePayload(p.pkt_payload)
+
+    return &c
+}
+
 func (p *Packet) String() string {
     return packet.Stringify(p)
 }
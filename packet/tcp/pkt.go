@@ -34,21 +34,27 @@ package tcp
 import "strings"
 
 import "github.com/adigal150/go.pkt/packet"
-import "github.com/adigal150/go.pkt/packet/ipv4"
 
 type Packet struct {
-    SrcPort     uint16        `string:"sport"`
-    DstPort     uint16        `string:"dport"`
-    Seq         uint32
-    Ack         uint32
-    DataOff     uint8         `string:"off"`
-    Flags       Flags
-    WindowSize  uint16        `string:"win"`
-    Checksum    uint16        `string:"sum"`
-    Urgent      uint16        `string:"urg"`
-    Options     []Option      `cmp:"skip" string:"skip"`
-    csum_seed   uint32        `cmp:"skip" string:"skip"`
-    pkt_payload packet.Packet `cmp:"skip" string:"skip"`
+    SrcPort      uint16               `string:"sport"`
+    DstPort      uint16               `string:"dport"`
+    Seq          uint32
+    Ack          uint32
+    DataOff      uint8                `string:"off"`
+    Flags        Flags
+    WindowSize   uint16               `string:"win"`
+    Checksum     uint16               `string:"sum"`
+    Urgent       uint16               `string:"urg"`
+    Options      []Option             `cmp:"skip" string:"skip"`
+
+    // Encode the Checksum field as-is, instead of computing it from the
+    // packet, e.g. to craft malformed packets.
+    KeepChecksum bool                 `cmp:"skip" string:"skip"`
+
+    csum_seed    uint32               `cmp:"skip" string:"skip"`
+    pkt_payload  packet.Packet        `cmp:"skip" string:"skip"`
+    pkt_decode   func() packet.Packet `cmp:"skip" string:"skip"`
+    pkt_raw      []byte               `cmp:"skip" string:"skip"`
 }
 
 type Flags uint16
@@ -96,8 +102,8 @@ func (p *Packet) GetType() packet.Type {
 }
 
 func (p *Packet) GetLength() uint16 {
-    if p.pkt_payload != nil {
-        return p.pkt_payload.GetLength() + uint16(p.DataOff) * 4
+    if p.Payload() != nil {
+        return p.Payload().GetLength() + uint16(p.DataOff) * 4
     }
 
     return uint16(p.DataOff) * 4
@@ -172,26 +178,33 @@ func (p *Packet) Pack(buf *packet.Buffer) error {
 
     for _, opt := range p.Options {
         buf.WriteN(opt.Type)
+
+        /* single byte options */
+        if opt.Type == End || opt.Type == Nop {
+            continue
+        }
+
         buf.WriteN(opt.Len)
         buf.WriteN(opt.Data)
     }
 
-    if p.csum_seed != 0 {
-        p.Checksum =
-          ipv4.CalculateChecksum(buf.LayerBytes(), p.csum_seed)
+    if p.csum_seed != 0 && !p.KeepChecksum {
+        p.Checksum = packet.Checksum(buf.LayerBytes(), p.csum_seed)
     }
 
     buf.PutUint16N(16, p.Checksum)
 
     /* add padding */
-    for buf.LayerLen() < int(p.DataOff) * 4 {
+    for buf.LayerLen() < int(p.DataOff) * 4 && buf.Err() == nil {
         buf.WriteN(uint8(0x00))
     }
 
-    return nil
+    return buf.Err()
 }
 
 func (p *Packet) Unpack(buf *packet.Buffer) error {
+    p.pkt_raw = buf.Bytes()
+
     buf.ReadN(&p.SrcPort)
     buf.ReadN(&p.DstPort)
     buf.ReadN(&p.Seq)
@@ -246,7 +259,7 @@ func (p *Packet) Unpack(buf *packet.Buffer) error {
     buf.ReadN(&p.Urgent)
 
 options:
-    for buf.LayerLen() < int(p.DataOff) * 4 {
+    for buf.LayerLen() < int(p.DataOff) * 4 && buf.Err() == nil {
         var opt_type OptType
         buf.ReadN(&opt_type)
 
@@ -272,31 +285,129 @@ options:
         buf.Next(int(p.DataOff) * 4 - buf.LayerLen())
     }
 
-    return nil
+    return buf.Err()
 }
 
 func (p *Packet) Payload() packet.Packet {
+    if p.pkt_decode != nil {
+        p.pkt_payload = p.pkt_decode()
+        p.pkt_decode  = nil
+    }
+
     return p.pkt_payload
 }
 
+func (p *Packet) RawBytes() []byte {
+    return p.pkt_raw
+}
+
+func (p *Packet) HeaderBytes() []byte {
+    return packet.HeaderBytes(p)
+}
+
 func (p *Packet) GuessPayloadType() packet.Type {
-    return packet.Raw
+    return PortToType(p.SrcPort, p.DstPort)
 }
 
 func (p *Packet) SetPayload(pl packet.Packet) error {
     p.pkt_payload = pl
+    p.pkt_decode  = nil
 
     return nil
 }
 
+func (p *Packet) SetPayloadDecoder(decode func() packet.Packet) {
+    p.pkt_payload = nil
+    p.pkt_decode  = decode
+}
+
 func (p *Packet) InitChecksum(csum uint32) {
     p.csum_seed = csum
 }
 
+func (p *Packet) Clone() packet.Packet {
+    c := *p
+
+    c.pkt_payload = packet.ClonePayload(p.Payload())
+    c.pkt_decode  = nil
+
+    if p.Options != nil {
+        c.Options = make([]Option, len(p.Options))
+
+        for i, opt := range p.Options {
+            c.Options[i] = Option{
+                Type: opt.Type,
+                Len:  opt.Len,
+                Data: packet.CloneBytes(opt.Data),
+            }
+        }
+    }
+
+    return &c
+}
+
 func (p *Packet) String() string {
     return packet.Stringify(p)
 }
 
+func (p *Packet) Validate() error {
+    if p.DataOff < 5 || p.DataOff > 15 {
+        return packet.Errorf(packet.ErrInvalidLength,
+                             "Invalid data offset: %d", p.DataOff)
+    }
+
+    opts_len := 0
+
+    for _, opt := range p.Options {
+        if opt.Type == End || opt.Type == Nop {
+            opts_len += 1
+        } else {
+            opts_len += int(opt.Len)
+        }
+    }
+
+    if 20 + opts_len > int(p.DataOff) * 4 {
+        return packet.Errorf(packet.ErrInvalidLength,
+                             "Options don't fit data offset: %d", p.DataOff)
+    }
+
+    return nil
+}
+
+var port_to_type_map = map[uint16]packet.Type{}
+
+// Register a packet type for the given TCP port, so that application layers can
+// be decoded without changes to the TCP code. This is meant to be called during
+// initialization (e.g. from an init() function) and must not be called
+// concurrently with packet decoding.
+func RegisterPort(port uint16, pkttype packet.Type) {
+    port_to_type_map[port] = pkttype
+}
+
+// Remove the packet type registered for the given TCP port (e.g. at the end of
+// a test). The same restrictions as for RegisterPort() apply.
+func UnregisterPort(port uint16) {
+    delete(port_to_type_map, port)
+}
+
+// Create a new Type from the given source and destination TCP ports. The lower
+// (usually well-known) port is looked up first.
+func PortToType(src_port, dst_port uint16) packet.Type {
+    if dst_port < src_port {
+        src_port, dst_port = dst_port, src_port
+    }
+
+    if t, ok := port_to_type_map[src_port]; ok {
+        return t
+    }
+
+    if t, ok := port_to_type_map[dst_port]; ok {
+        return t
+    }
+
+    return packet.Raw
+}
+
 func (f Flags) String() string {
     var flags []string
 
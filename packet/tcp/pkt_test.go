@@ -222,6 +222,33 @@ func TestPackOptions(t *testing.T) {
     }
 }
 
+func TestPackSingleByteOptions(t *testing.T) {
+    var b packet.Buffer
+    b.Init(make([]byte, 28))
+
+    p := MakeTestSimple()
+
+    p.DataOff = 7
+    p.Options = []tcp.Option{
+        { Type: tcp.Nop, Len: 1, Data: []byte{ 0xff } },
+        { Type: tcp.Nop },
+        { Type: tcp.WindowScale, Len: 3, Data: []byte{ 0x0a } },
+        { Type: tcp.End },
+    }
+
+    err := p.Pack(&b)
+    if err != nil {
+        t.Fatalf("Error packing: %s", err)
+    }
+
+    /* Len and Data of End and Nop options are not encoded */
+    opts := []byte{ 0x01, 0x01, 0x03, 0x03, 0x0a, 0x00, 0x00, 0x00 }
+
+    if !bytes.Equal(opts, b.Buffer()[20:]) {
+        t.Fatalf("Raw options mismatch: %x", b.Buffer()[20:])
+    }
+}
+
 func TestUnpackOptions(t *testing.T) {
     var p tcp.Packet
 
@@ -253,3 +280,61 @@ func TestUnpackOptions(t *testing.T) {
         t.Fatalf("Option WindowScale mismatch: %x", p.Options[3].Data)
     }
 }
+
+func TestRegisterPort(t *testing.T) {
+    p := MakeTestSimple()
+    p.SrcPort = 179
+    p.DstPort = 50000
+
+    if p.GuessPayloadType() != packet.Raw {
+        t.Fatalf("Payload type mismatch: %s", p.GuessPayloadType())
+    }
+
+    tcp.RegisterPort(179, packet.IPv4)
+    tcp.RegisterPort(50000, packet.IPv6)
+    defer tcp.UnregisterPort(179)
+    defer tcp.UnregisterPort(50000)
+
+    if p.GuessPayloadType() != packet.IPv4 {
+        t.Fatalf("Payload type mismatch: %s", p.GuessPayloadType())
+    }
+
+    p.SrcPort, p.DstPort = p.DstPort, p.SrcPort
+
+    if p.GuessPayloadType() != packet.IPv4 {
+        t.Fatalf("Payload type mismatch: %s", p.GuessPayloadType())
+    }
+}
+
+func TestValidate(t *testing.T) {
+    p := tcp.Make()
+
+    err := p.Validate()
+    if err != nil {
+        t.Fatalf("Error validating: %s", err)
+    }
+
+    p.DataOff = 4
+
+    err = p.Validate()
+    if err == nil || err.Error() != "Invalid data offset: 4" {
+        t.Fatalf("Invalid data offset not detected: %v", err)
+    }
+
+    p.DataOff = 5
+    p.Options = []tcp.Option{
+        { Type: tcp.MSS, Len: 4, Data: []byte{ 0x05, 0xb4 } },
+    }
+
+    err = p.Validate()
+    if err == nil || err.Error() != "Options don't fit data offset: 5" {
+        t.Fatalf("Options overflow not detected: %v", err)
+    }
+
+    p.DataOff = 6
+
+    err = p.Validate()
+    if err != nil {
+        t.Fatalf("Error validating: %s", err)
+    }
+}
@@ -0,0 +1,364 @@
+/*
+ * Network packet analysis framework.
+ *
+ * Copyright (c) 2014, Alessandro Ghedini
+ * All rights reserved.
+ *
+ * Redistribution and use in source and binary forms, with or without
+ * modification, are permitted provided that the following conditions are
+ * met:
+ *
+ *     * Redistributions of source code must retain the above copyright
+ *       notice, this list of conditions and the following disclaimer.
+ *
+ *     * Redistributions in binary form must reproduce the above copyright
+ *       notice, this list of conditions and the following disclaimer in the
+ *       documentation and/or other materials provided with the distribution.
+ *
+ * THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS
+ * IS" AND ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO,
+ * THE IMPLIED WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR
+ * PURPOSE ARE DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT HOLDER OR
+ * CONTRIBUTORS BE LIABLE FOR ANY DIRECT, INDIRECT, INCIDENTAL, SPECIAL,
+ * EXEMPLARY, OR CONSEQUENTIAL DAMAGES (INCLUDING, BUT NOT LIMITED TO,
+ * PROCUREMENT OF SUBSTITUTE GOODS OR SERVICES; LOSS OF USE, DATA, OR
+ * PROFITS; OR BUSINESS INTERRUPTION) HOWEVER CAUSED AND ON ANY THEORY OF
+ * LIABILITY, WHETHER IN CONTRACT, STRICT LIABILITY, OR TORT (INCLUDING
+ * NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE OF THIS
+ * SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+ */
+
+// Provides encoding and decoding for TLS record layer packets.
+//
+// Only the record header is decoded for every record, and for Handshake records
+// the handshake message header is decoded as well. The server name indication
+// (SNI) extension is extracted from ClientHello messages. Records that don't
+// fit in the decoded segment are kept partially, and Missing() reports how many
+// bytes are needed to complete them. Data that doesn't start with a valid
+// record header (e.g. the rest of a split record) is rejected, so that it is
+// decoded as raw data instead.
+package tls
+
+import "fmt"
+
+import "github.com/adigal150/go.pkt/packet"
+import "github.com/adigal150/go.pkt/packet/tcp"
+
+type Packet struct {
+    ContentType   ContentType   `string:"type"`
+    Version       Version       `string:"ver"`
+    Length        uint16        `string:"len"`
+    HandshakeType HandshakeType `string:"hs"`
+    HandshakeLen  uint32        `string:"hslen"`
+    ServerName    string        `string:"sni"`
+    Data          []byte        `cmp:"skip" string:"skip"`
+
+    // Encode the Length field as-is, instead of computing it from Data, e.g.
+    // to craft malformed packets. It is set by Unpack() for records that
+    // don't fit in the decoded data, so that they are packed unchanged.
+    KeepLength    bool          `cmp:"skip" string:"skip"`
+
+    missing       int           `cmp:"skip" string:"skip"`
+    pkt_payload   packet.Packet `cmp:"skip" string:"skip"`
+    pkt_raw       []byte        `cmp:"skip" string:"skip"`
+}
+
+type ContentType uint8
+
+const (
+    ChangeCipherSpec ContentType = 20
+    Alert                        = 21
+    Handshake                    = 22
+    ApplicationData              = 23
+    Heartbeat                    = 24
+)
+
+type Version uint16
+
+const (
+    SSLv30 Version = 0x0300
+    TLSv10         = 0x0301
+    TLSv11         = 0x0302
+    TLSv12         = 0x0303
+    TLSv13         = 0x0304
+)
+
+type HandshakeType uint8
+
+const (
+    HelloRequest       HandshakeType = 0
+    ClientHello                      = 1
+    ServerHello                      = 2
+    NewSessionTicket                 = 4
+    EncryptedExtensions              = 8
+    Certificate                      = 11
+    ServerKeyExchange                = 12
+    CertificateRequest               = 13
+    ServerHelloDone                  = 14
+    CertificateVerify                = 15
+    ClientKeyExchange                = 16
+    Finished                         = 20
+)
+
+func init() {
+    tcp.RegisterPort(443, packet.TLS)
+}
+
+func Make() *Packet {
+    return &Packet{
+        ContentType: ApplicationData,
+        Version: TLSv12,
+    }
+}
+
+func (p *Packet) GetType() packet.Type {
+    return packet.TLS
+}
+
+func (p *Packet) GetLength() uint16 {
+    if p.pkt_payload != nil {
+        return p.pkt_payload.GetLength() + 5 + uint16(len(p.Data))
+    }
+
+    return 5 + uint16(len(p.Data))
+}
+
+func (p *Packet) Equals(other packet.Packet) bool {
+    return packet.Compare(p, other)
+}
+
+func (p *Packet) Answers(other packet.Packet) bool {
+    return false
+}
+
+func (p *Packet) Pack(buf *packet.Buffer) error {
+    if !p.KeepLength {
+        p.Length = uint16(len(p.Data))
+    }
+
+    buf.WriteN(p.ContentType)
+    buf.WriteN(p.Version)
+    buf.WriteN(p.Length)
+    buf.Write(p.Data)
+
+    return buf.Err()
+}
+
+func (p *Packet) Unpack(buf *packet.Buffer) error {
+    p.pkt_raw = buf.Bytes()
+
+    if buf.Len() < 5 {
+        p.missing = 5 - buf.Len()
+        p.Data    = buf.Next(buf.Len())
+        return nil
+    }
+
+    buf.ReadN(&p.ContentType)
+    buf.ReadN(&p.Version)
+    buf.ReadN(&p.Length)
+
+    if p.ContentType < ChangeCipherSpec || p.ContentType > Heartbeat ||
+       p.Version >> 8 != 3 {
+        return packet.Errorf(packet.ErrUnsupported,
+                             "Invalid TLS record: type %d, version 0x%04x",
+                             p.ContentType, p.Version)
+    }
+
+    p.Data       = buf.Next(int(p.Length))
+    p.missing    = int(p.Length) - len(p.Data)
+    p.KeepLength = p.missing > 0
+
+    if p.ContentType == Handshake && len(p.Data) >= 4 {
+        p.HandshakeType = HandshakeType(p.Data[0])
+        p.HandshakeLen  = uint32(p.Data[1]) << 16 |
+                          uint32(p.Data[2]) << 8  |
+                          uint32(p.Data[3])
+
+        if p.HandshakeType == ClientHello {
+            p.ServerName = server_name(p.Data[4:])
+        }
+    }
+
+    return buf.Err()
+}
+
+// Return the number of bytes that are needed to complete the record, or 0 if
+// the whole record was decoded. Records split across TCP segments need to
+// be reassembled before being decoded again.
+func (p *Packet) Missing() int {
+    return p.missing
+}
+
+func (p *Packet) Payload() packet.Packet {
+    return p.pkt_payload
+}
+
+func (p *Packet) RawBytes() []byte {
+    return p.pkt_raw
+}
+
+func (p *Packet) HeaderBytes() []byte {
+    return packet.HeaderBytes(p)
+}
+
+func (p *Packet) GuessPayloadType() packet.Type {
+    /* multiple records can share the same segment */
+    return packet.TLS
+}
+
+// Return true, since the payload of a record can only be the next record in
+// the same segment (see packet.MessagePacket).
+func (p *Packet) NextMessage() bool {
+    return true
+}
+
+func (p *Packet) SetPayload(pl packet.Packet) error {
+    p.pkt_payload = pl
+
+    return nil
+}
+
+func (p *Packet) InitChecksum(csum uint32) {
+}
+
+func (p *Packet) Clone() packet.Packet {
+    c := *p
+
+    c.Data        = packet.CloneBytes(p.Data)
+    c.pkt_payload = packet.ClonePayload(p.pkt_payload)
+
+    return &c
+}
+
+func (p *Packet) String() string {
+    s := fmt.Sprintf("tls(type=%s, ver=%s, len=%d",
+                     p.ContentType, p.Version, p.Length)
+
+    if p.ContentType == Handshake {
+        s += fmt.Sprintf(", hs=%s, hslen=%d", p.HandshakeType, p.HandshakeLen)
+    }
+
+    if p.ServerName != "" {
+        s += fmt.Sprintf(", sni=%s", p.ServerName)
+    }
+
+    if p.missing > 0 {
+        s += fmt.Sprintf(", missing=%d", p.missing)
+    }
+
+    s += ")"
+
+    if p.pkt_payload != nil {
+        s += " | " + p.pkt_payload.String()
+    }
+
+    return s
+}
+
+/* extract the server_name extension from a ClientHello body */
+func server_name(body []byte) string {
+    off := 2 + 32 /* version + random */
+
+    if len(body) < off + 1 {
+        return ""
+    }
+    off += 1 + int(body[off]) /* session id */
+
+    if len(body) < off + 2 {
+        return ""
+    }
+    off += 2 + (int(body[off]) << 8 | int(body[off + 1])) /* cipher suites */
+
+    if len(body) < off + 1 {
+        return ""
+    }
+    off += 1 + int(body[off]) /* compression methods */
+
+    if len(body) < off + 2 {
+        return ""
+    }
+    end := off + 2 + (int(body[off]) << 8 | int(body[off + 1]))
+    off += 2
+
+    if end > len(body) {
+        end = len(body)
+    }
+
+    for off + 4 <= end {
+        ext_type := int(body[off]) << 8 | int(body[off + 1])
+        ext_len  := int(body[off + 2]) << 8 | int(body[off + 3])
+        off += 4
+
+        if off + ext_len > end {
+            return ""
+        }
+
+        if ext_type != 0x0000 {
+            off += ext_len
+            continue
+        }
+
+        ext := body[off:off + ext_len]
+
+        /* server name list length, name type, name length */
+        for i := 2; i + 3 <= len(ext); {
+            name_type := ext[i]
+            name_len  := int(ext[i + 1]) << 8 | int(ext[i + 2])
+            i += 3
+
+            if i + name_len > len(ext) {
+                return ""
+            }
+
+            if name_type == 0x00 {
+                return string(ext[i:i + name_len])
+            }
+
+            i += name_len
+        }
+
+        return ""
+    }
+
+    return ""
+}
+
+func (t ContentType) String() string {
+    switch t {
+    case ChangeCipherSpec: return "change-cipher-spec"
+    case Alert:            return "alert"
+    case Handshake:        return "handshake"
+    case ApplicationData:  return "application-data"
+    case Heartbeat:        return "heartbeat"
+    default:               return fmt.Sprintf("0x%x", uint8(t))
+    }
+}
+
+func (v Version) String() string {
+    switch v {
+    case SSLv30: return "ssl3.0"
+    case TLSv10: return "tls1.0"
+    case TLSv11: return "tls1.1"
+    case TLSv12: return "tls1.2"
+    case TLSv13: return "tls1.3"
+    default:     return fmt.Sprintf("0x%x", uint16(v))
+    }
+}
+
+func (t HandshakeType) String() string {
+    switch t {
+    case HelloRequest:        return "hello-request"
+    case ClientHello:         return "client-hello"
+    case ServerHello:         return "server-hello"
+    case NewSessionTicket:    return "new-session-ticket"
+    case EncryptedExtensions: return "encrypted-extensions"
+    case Certificate:         return "certificate"
+    case ServerKeyExchange:   return "server-key-exchange"
+    case CertificateRequest:  return "certificate-request"
+    case ServerHelloDone:     return "server-hello-done"
+    case CertificateVerify:   return "certificate-verify"
+    case ClientKeyExchange:   return "client-key-exchange"
+    case Finished:            return "finished"
+    default:                  return fmt.Sprintf("0x%x", uint8(t))
+    }
+}
@@ -0,0 +1,278 @@
+/*
+ * Network packet analysis framework.
+ *
+ * Copyright (c) 2014, Alessandro Ghedini
+ * All rights reserved.
+ *
+ * Redistribution and use in source and binary forms, with or without
+ * modification, are permitted provided that the following conditions are
+ * met:
+ *
+ *     * Redistributions of source code must retain the above copyright
+ *       notice, this list of conditions and the following disclaimer.
+ *
+ *     * Redistributions in binary form must reproduce the above copyright
+ *       notice, this list of conditions and the following disclaimer in the
+ *       documentation and/or other materials provided with the distribution.
+ *
+ * THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS
+ * IS" AND ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO,
+ * THE IMPLIED WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR
+ * PURPOSE ARE DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT HOLDER OR
+ * CONTRIBUTORS BE LIABLE FOR ANY DIRECT, INDIRECT, INCIDENTAL, SPECIAL,
+ * EXEMPLARY, OR CONSEQUENTIAL DAMAGES (INCLUDING, BUT NOT LIMITED TO,
+ * PROCUREMENT OF SUBSTITUTE GOODS OR SERVICES; LOSS OF USE, DATA, OR
+ * PROFITS; OR BUSINESS INTERRUPTION) HOWEVER CAUSED AND ON ANY THEORY OF
+ * LIABILITY, WHETHER IN CONTRACT, STRICT LIABILITY, OR TORT (INCLUDING
+ * NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE OF THIS
+ * SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+ */
+
+package tls_test
+
+import "bytes"
+import "errors"
+import "testing"
+
+import "github.com/adigal150/go.pkt/capture"
+import "github.com/adigal150/go.pkt/capture/file"
+import "github.com/adigal150/go.pkt/layers"
+import "github.com/adigal150/go.pkt/packet"
+import "github.com/adigal150/go.pkt/packet/tls"
+
+var test_client_hello = []byte{
+    0x16, 0x03, 0x01, 0x00, 0x43, 0x01, 0x00, 0x00, 0x3f, 0x03, 0x03, 0x00,
+    0x01, 0x02, 0x03, 0x04, 0x05, 0x06, 0x07, 0x08, 0x09, 0x0a, 0x0b, 0x0c,
+    0x0d, 0x0e, 0x0f, 0x10, 0x11, 0x12, 0x13, 0x14, 0x15, 0x16, 0x17, 0x18,
+    0x19, 0x1a, 0x1b, 0x1c, 0x1d, 0x1e, 0x1f, 0x00, 0x00, 0x02, 0x13, 0x01,
+    0x01, 0x00, 0x00, 0x14, 0x00, 0x00, 0x00, 0x10, 0x00, 0x0e, 0x00, 0x00,
+    0x0b, 0x65, 0x78, 0x61, 0x6d, 0x70, 0x6c, 0x65, 0x2e, 0x63, 0x6f, 0x6d,
+}
+
+func MakeTestSimple() *tls.Packet {
+    return &tls.Packet{
+        ContentType: tls.Handshake,
+        Version: tls.TLSv10,
+        Length: 67,
+        HandshakeType: tls.ClientHello,
+        HandshakeLen: 63,
+        ServerName: "example.com",
+        Data: test_client_hello[5:],
+    }
+}
+
+func TestPack(t *testing.T) {
+    var b packet.Buffer
+    b.Init(make([]byte, len(test_client_hello)))
+
+    p := MakeTestSimple()
+
+    err := p.Pack(&b)
+    if err != nil {
+        t.Fatalf("Error packing: %s", err)
+    }
+
+    if !bytes.Equal(test_client_hello, b.Buffer()) {
+        t.Fatalf("Raw packet mismatch: %x", b.Buffer())
+    }
+}
+
+func BenchmarkPack(bn *testing.B) {
+    var b packet.Buffer
+    b.Init(make([]byte, len(test_client_hello)))
+
+    p := MakeTestSimple()
+
+    for n := 0; n < bn.N; n++ {
+        p.Pack(&b)
+    }
+}
+
+func TestUnpack(t *testing.T) {
+    var p tls.Packet
+
+    cmp := MakeTestSimple()
+
+    var b packet.Buffer
+    b.Init(test_client_hello)
+
+    err := p.Unpack(&b)
+    if err != nil {
+        t.Fatalf("Error unpacking: %s", err)
+    }
+
+    if !p.Equals(cmp) {
+        t.Fatalf("Packet mismatch:\n%s\n%s", &p, cmp)
+    }
+
+    if p.Missing() != 0 {
+        t.Fatalf("Missing mismatch: %d", p.Missing())
+    }
+}
+
+func BenchmarkUnpack(bn *testing.B) {
+    var p tls.Packet
+    var b packet.Buffer
+
+    for n := 0; n < bn.N; n++ {
+        b.Init(test_client_hello)
+        p.Unpack(&b)
+    }
+}
+
+func TestUnpackSplit(t *testing.T) {
+    var p tls.Packet
+
+    var b packet.Buffer
+    b.Init(test_client_hello[:40])
+
+    err := p.Unpack(&b)
+    if err != nil {
+        t.Fatalf("Error unpacking: %s", err)
+    }
+
+    if p.Missing() != 32 {
+        t.Fatalf("Missing mismatch: %d", p.Missing())
+    }
+
+    if p.ServerName != "" {
+        t.Fatalf("Server name mismatch: %s", p.ServerName)
+    }
+
+    b.Init(test_client_hello[:3])
+
+    err = p.Unpack(&b)
+    if err != nil {
+        t.Fatalf("Error unpacking: %s", err)
+    }
+
+    if p.Missing() != 2 {
+        t.Fatalf("Missing mismatch: %d", p.Missing())
+    }
+}
+
+/* a ClientHello sent by OpenSSL, with the extensions of a real client */
+func TestUnpackCapture(t *testing.T) {
+    src, err := file.Open("pkt_test.pcap")
+    if err != nil {
+        t.Fatalf("Error opening: %s", err)
+    }
+    defer src.Close()
+
+    var count int
+
+    err = capture.Each(src, func(buf []byte, info capture.CaptureInfo) error {
+        pkt, err := layers.UnpackAll(buf, src.LinkType())
+        if err != nil {
+            return err
+        }
+
+        p, ok := layers.FindLayer(pkt, packet.TLS).(*tls.Packet)
+        if !ok {
+            t.Fatalf("Missing TLS layer: %s", pkt)
+        }
+
+        if p.ContentType != tls.Handshake ||
+           p.HandshakeType != tls.ClientHello ||
+           p.Length != 316 || p.HandshakeLen != 312 || p.Missing() != 0 {
+            t.Fatalf("Record mismatch: %s", p)
+        }
+
+        if p.ServerName != "www.example.com" {
+            t.Fatalf("Server name mismatch: %s", p.ServerName)
+        }
+
+        count++
+
+        return nil
+    })
+    if err != nil {
+        t.Fatalf("Error reading: %s", err)
+    }
+
+    if count != 1 {
+        t.Fatalf("Packet count mismatch: %d", count)
+    }
+}
+
+func TestUnpackRecords(t *testing.T) {
+    var buf []byte
+
+    /* more ChangeCipherSpec records than packet.DefaultMaxDepth */
+    for i := 0; i < 30; i++ {
+        buf = append(buf, 0x14, 0x03, 0x03, 0x00, 0x01, 0x01)
+    }
+
+    pkt, err := layers.UnpackAll(buf, packet.TLS)
+    if err != nil {
+        t.Fatalf("Error unpacking: %s", err)
+    }
+
+    var count int
+
+    for p := pkt; p != nil; p = p.Payload() {
+        count++
+    }
+
+    if count != 30 {
+        t.Fatalf("Record count mismatch: %d", count)
+    }
+}
+
+func TestPackLength(t *testing.T) {
+    var b packet.Buffer
+    b.Init(make([]byte, len(test_client_hello)))
+
+    p := MakeTestSimple()
+    p.Length = 0
+
+    err := p.Pack(&b)
+    if err != nil {
+        t.Fatalf("Error packing: %s", err)
+    }
+
+    if p.Length != 67 || !bytes.Equal(test_client_hello, b.Buffer()) {
+        t.Fatalf("Raw packet mismatch: %x", b.Buffer())
+    }
+
+    p.Length     = 1000
+    p.KeepLength = true
+
+    b.Init(make([]byte, len(test_client_hello)))
+
+    err = p.Pack(&b)
+    if err != nil {
+        t.Fatalf("Error packing: %s", err)
+    }
+
+    if !bytes.Equal(b.Buffer()[3:5], []byte{ 0x03, 0xe8 }) {
+        t.Fatalf("Raw packet mismatch: %x", b.Buffer())
+    }
+}
+
+func TestUnpackInvalid(t *testing.T) {
+    var p tls.Packet
+
+    var b packet.Buffer
+    b.Init([]byte("GET / HTTP/1.1\r\n"))
+
+    err := p.Unpack(&b)
+    if !errors.Is(err, packet.ErrUnsupported) {
+        t.Fatalf("Unexpected error: %v", err)
+    }
+}
+
+func TestUnpackAllInvalid(t *testing.T) {
+    buf := []byte{ 0x14, 0x03, 0x03, 0x00, 0x01, 0x01 }
+    buf  = append(buf, "GET / HTTP/1.1\r\n"...)
+
+    pkt, err := layers.UnpackAll(buf, packet.TLS)
+    if err != nil {
+        t.Fatalf("Error unpacking: %s", err)
+    }
+
+    if pkt.GetType() != packet.TLS || pkt.Payload() == nil ||
+       pkt.Payload().GetType() != packet.Raw {
+        t.Fatalf("Packet mismatch: %s", pkt)
+    }
+}
@@ -0,0 +1,219 @@
+/*
+ * Network packet analysis framework.
+ *
+ * Copyright (c) 2014, Alessandro Ghedini
+ * All rights reserved.
+ *
+ * Redistribution and use in source and binary forms, with or without
+ * modification, are permitted provided that the following conditions are
+ * met:
+ *
+ *     * Redistributions of source code must retain the above copyright
+ *       notice, this list of conditions and the following disclaimer.
+ *
+ *     * Redistributions in binary form must reproduce the above copyright
+ *       notice, this list of conditions and the following disclaimer in the
+ *       documentation and/or other materials provided with the distribution.
+ *
+ * THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS
+ * IS" AND ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO,
+ * THE IMPLIED WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR
+ * PURPOSE ARE DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT HOLDER OR
+ * CONTRIBUTORS BE LIABLE FOR ANY DIRECT, INDIRECT, INCIDENTAL, SPECIAL,
+ * EXEMPLARY, OR CONSEQUENTIAL DAMAGES (INCLUDING, BUT NOT LIMITED TO,
+ * PROCUREMENT OF SUBSTITUTE GOODS OR SERVICES; LOSS OF USE, DATA, OR
+ * PROFITS; OR BUSINESS INTERRUPTION) HOWEVER CAUSED AND ON ANY THEORY OF
+ * LIABILITY, WHETHER IN CONTRACT, STRICT LIABILITY, OR TORT (INCLUDING
+ * NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE OF THIS
+ * SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+ */
+
+package packet
+
+import "fmt"
+
+// A TLV is a generic type-length-value element, as used by the options of many
+// protocols. Only the type and value are stored, since the length is implied
+// by the value and depends on the encoding.
+//
+// The decoding functions stop at the first malformed element, and return the
+// elements decoded so far together with the error. Values are sub-slices of
+// the decoded data, and are not copied.
+type TLV struct {
+    Type  uint16
+    Value []byte
+}
+
+// Decode a list of TLVs with 1-byte type and 1-byte length (in bytes) fields,
+// as used by e.g. DHCP and CDP.
+func DecodeTLV8(data []byte) ([]TLV, error) {
+    var tlvs []TLV
+
+    for len(data) > 0 {
+        if len(data) < 2 {
+            return tlvs, Errorf(ErrTruncated, "Truncated TLV header")
+        }
+
+        l := int(data[1])
+
+        if 2 + l > len(data) {
+            return tlvs, Errorf(ErrTruncated, "Truncated TLV value: %d", l)
+        }
+
+        tlvs = append(tlvs, TLV{ Type: uint16(data[0]), Value: data[2:2 + l] })
+        data = data[2 + l:]
+    }
+
+    return tlvs, nil
+}
+
+// Encode a list of TLVs with 1-byte type and 1-byte length (in bytes) fields.
+func EncodeTLV8(buf *Buffer, tlvs []TLV) error {
+    for _, tlv := range tlvs {
+        if tlv.Type > 0xFF || len(tlv.Value) > 0xFF {
+            return fmt.Errorf("Invalid TLV: %d/%d", tlv.Type, len(tlv.Value))
+        }
+
+        buf.WriteN(uint8(tlv.Type))
+        buf.WriteN(uint8(len(tlv.Value)))
+        buf.Write(tlv.Value)
+    }
+
+    return buf.Err()
+}
+
+// Decode a list of TLVs with 2-byte type and 2-byte length (in bytes) fields,
+// in network byte order, as used by e.g. DHCPv6.
+func DecodeTLV16(data []byte) ([]TLV, error) {
+    var tlvs []TLV
+
+    for len(data) > 0 {
+        if len(data) < 4 {
+            return tlvs, Errorf(ErrTruncated, "Truncated TLV header")
+        }
+
+        t := uint16(data[0]) << 8 | uint16(data[1])
+        l := int(data[2]) << 8 | int(data[3])
+
+        if 4 + l > len(data) {
+            return tlvs, Errorf(ErrTruncated, "Truncated TLV value: %d", l)
+        }
+
+        tlvs = append(tlvs, TLV{ Type: t, Value: data[4:4 + l] })
+        data = data[4 + l:]
+    }
+
+    return tlvs, nil
+}
+
+// Encode a list of TLVs with 2-byte type and 2-byte length (in bytes) fields.
+func EncodeTLV16(buf *Buffer, tlvs []TLV) error {
+    for _, tlv := range tlvs {
+        if len(tlv.Value) > 0xFFFF {
+            return fmt.Errorf("Invalid TLV length: %d", len(tlv.Value))
+        }
+
+        buf.WriteN(tlv.Type)
+        buf.WriteN(uint16(len(tlv.Value)))
+        buf.Write(tlv.Value)
+    }
+
+    return buf.Err()
+}
+
+// Decode a list of TLVs with 7-bit type and 9-bit length (in bytes) fields, as
+// used by LLDP.
+func DecodeTLV7(data []byte) ([]TLV, error) {
+    var tlvs []TLV
+
+    for len(data) > 0 {
+        if len(data) < 2 {
+            return tlvs, Errorf(ErrTruncated, "Truncated TLV header")
+        }
+
+        hdr := uint16(data[0]) << 8 | uint16(data[1])
+
+        t := hdr >> 9
+        l := int(hdr & 0x01FF)
+
+        if 2 + l > len(data) {
+            return tlvs, Errorf(ErrTruncated, "Truncated TLV value: %d", l)
+        }
+
+        tlvs = append(tlvs, TLV{ Type: t, Value: data[2:2 + l] })
+        data = data[2 + l:]
+    }
+
+    return tlvs, nil
+}
+
+// Encode a list of TLVs with 7-bit type and 9-bit length (in bytes) fields.
+func EncodeTLV7(buf *Buffer, tlvs []TLV) error {
+    for _, tlv := range tlvs {
+        if tlv.Type > 0x7F || len(tlv.Value) > 0x01FF {
+            return fmt.Errorf("Invalid TLV: %d/%d", tlv.Type, len(tlv.Value))
+        }
+
+        buf.WriteN(tlv.Type << 9 | uint16(len(tlv.Value)))
+        buf.Write(tlv.Value)
+    }
+
+    return buf.Err()
+}
+
+// Decode a list of TLVs with 1-byte type and 1-byte length fields, where the
+// length is expressed in units of the given number of bytes and covers the
+// whole element, type and length fields included, as used by e.g. ICMPv6
+// Neighbor Discovery (with 8 bytes units). The value includes any padding.
+func DecodeTLVUnits(data []byte, unit int) ([]TLV, error) {
+    var tlvs []TLV
+
+    for len(data) > 0 {
+        if len(data) < 2 {
+            return tlvs, Errorf(ErrTruncated, "Truncated TLV header")
+        }
+
+        l := int(data[1]) * unit
+
+        if l < 2 {
+            return tlvs, Errorf(ErrInvalidLength,
+                                "Invalid TLV length: %d", data[1])
+        }
+
+        if l > len(data) {
+            return tlvs, Errorf(ErrTruncated, "Truncated TLV value: %d", l)
+        }
+
+        tlvs = append(tlvs, TLV{ Type: uint16(data[0]), Value: data[2:l] })
+        data = data[l:]
+    }
+
+    return tlvs, nil
+}
+
+// Encode a list of TLVs with 1-byte type and 1-byte length (in units of the
+// given number of bytes) fields. Values are padded with zeros to a multiple of
+// the unit size.
+func EncodeTLVUnits(buf *Buffer, tlvs []TLV, unit int) error {
+    if unit <= 0 {
+        return fmt.Errorf("Invalid TLV unit size: %d", unit)
+    }
+
+    for _, tlv := range tlvs {
+        units := (2 + len(tlv.Value) + unit - 1) / unit
+
+        if tlv.Type > 0xFF || units > 0xFF {
+            return fmt.Errorf("Invalid TLV: %d/%d", tlv.Type, len(tlv.Value))
+        }
+
+        buf.WriteN(uint8(tlv.Type))
+        buf.WriteN(uint8(units))
+        buf.Write(tlv.Value)
+
+        for i := 2 + len(tlv.Value); i < units * unit; i++ {
+            buf.WriteN(uint8(0x00))
+        }
+    }
+
+    return buf.Err()
+}
@@ -0,0 +1,201 @@
+/*
+ * Network packet analysis framework.
+ *
+ * Copyright (c) 2014, Alessandro Ghedini
+ * All rights reserved.
+ *
+ * Redistribution and use in source and binary forms, with or without
+ * modification, are permitted provided that the following conditions are
+ * met:
+ *
+ *     * Redistributions of source code must retain the above copyright
+ *       notice, this list of conditions and the following disclaimer.
+ *
+ *     * Redistributions in binary form must reproduce the above copyright
+ *       notice, this list of conditions and the following disclaimer in the
+ *       documentation and/or other materials provided with the distribution.
+ *
+ * THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS
+ * IS" AND ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO,
+ * THE IMPLIED WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR
+ * PURPOSE ARE DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT HOLDER OR
+ * CONTRIBUTORS BE LIABLE FOR ANY DIRECT, INDIRECT, INCIDENTAL, SPECIAL,
+ * EXEMPLARY, OR CONSEQUENTIAL DAMAGES (INCLUDING, BUT NOT LIMITED TO,
+ * PROCUREMENT OF SUBSTITUTE GOODS OR SERVICES; LOSS OF USE, DATA, OR
+ * PROFITS; OR BUSINESS INTERRUPTION) HOWEVER CAUSED AND ON ANY THEORY OF
+ * LIABILITY, WHETHER IN CONTRACT, STRICT LIABILITY, OR TORT (INCLUDING
+ * NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE OF THIS
+ * SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+ */
+
+package packet_test
+
+import "bytes"
+import "testing"
+
+import "github.com/adigal150/go.pkt/packet"
+
+var test_tlvs = []packet.TLV{
+    { Type: 1, Value: []byte{ 0xaa, 0xbb } },
+    { Type: 5, Value: []byte{} },
+    { Type: 3, Value: []byte{ 0x01, 0x02, 0x03 } },
+}
+
+var test_tlv8 = []byte{
+    0x01, 0x02, 0xaa, 0xbb, 0x05, 0x00, 0x03, 0x03, 0x01, 0x02, 0x03,
+}
+
+var test_tlv16 = []byte{
+    0x00, 0x01, 0x00, 0x02, 0xaa, 0xbb, 0x00, 0x05, 0x00, 0x00, 0x00, 0x03,
+    0x00, 0x03, 0x01, 0x02, 0x03,
+}
+
+var test_tlv7 = []byte{
+    0x02, 0x02, 0xaa, 0xbb, 0x0a, 0x00, 0x06, 0x03, 0x01, 0x02, 0x03,
+}
+
+var test_tlv_units = []byte{
+    0x01, 0x01, 0xaa, 0xbb, 0x05, 0x01, 0x00, 0x00, 0x03, 0x02, 0x01, 0x02,
+    0x03, 0x00, 0x00, 0x00,
+}
+
+func check_tlvs(t *testing.T, tlvs []packet.TLV, cmp []packet.TLV, units bool) {
+    if len(tlvs) != len(cmp) {
+        t.Fatalf("TLV count mismatch: %d", len(tlvs))
+    }
+
+    for i := range tlvs {
+        value := tlvs[i].Value
+
+        /* values carry the padding */
+        if units {
+            value = value[:len(cmp[i].Value)]
+        }
+
+        if tlvs[i].Type != cmp[i].Type || !bytes.Equal(value, cmp[i].Value) {
+            t.Fatalf("TLV mismatch: %v", tlvs[i])
+        }
+    }
+}
+
+func check_truncated(t *testing.T, data []byte,
+                     decode func([]byte) ([]packet.TLV, error)) {
+    /* truncated value */
+    tlvs, err := decode(data[:len(data) - 1])
+    if err == nil {
+        t.Fatalf("Truncated value not detected")
+    }
+
+    if len(tlvs) != 2 {
+        t.Fatalf("TLV count mismatch: %d", len(tlvs))
+    }
+
+    /* truncated header */
+    _, err = decode(data[:1])
+    if err == nil {
+        t.Fatalf("Truncated header not detected")
+    }
+}
+
+func TestTLV8(t *testing.T) {
+    tlvs, err := packet.DecodeTLV8(test_tlv8)
+    if err != nil {
+        t.Fatalf("Error decoding: %s", err)
+    }
+
+    check_tlvs(t, tlvs, test_tlvs, false)
+    check_truncated(t, test_tlv8, packet.DecodeTLV8)
+
+    var b packet.Buffer
+    b.Init(make([]byte, len(test_tlv8)))
+
+    err = packet.EncodeTLV8(&b, test_tlvs)
+    if err != nil {
+        t.Fatalf("Error encoding: %s", err)
+    }
+
+    if !bytes.Equal(test_tlv8, b.Buffer()) {
+        t.Fatalf("Raw TLV mismatch: %x", b.Buffer())
+    }
+}
+
+func TestTLV16(t *testing.T) {
+    tlvs, err := packet.DecodeTLV16(test_tlv16)
+    if err != nil {
+        t.Fatalf("Error decoding: %s", err)
+    }
+
+    check_tlvs(t, tlvs, test_tlvs, false)
+    check_truncated(t, test_tlv16, packet.DecodeTLV16)
+
+    var b packet.Buffer
+    b.Init(make([]byte, len(test_tlv16)))
+
+    err = packet.EncodeTLV16(&b, test_tlvs)
+    if err != nil {
+        t.Fatalf("Error encoding: %s", err)
+    }
+
+    if !bytes.Equal(test_tlv16, b.Buffer()) {
+        t.Fatalf("Raw TLV mismatch: %x", b.Buffer())
+    }
+}
+
+func TestTLV7(t *testing.T) {
+    tlvs, err := packet.DecodeTLV7(test_tlv7)
+    if err != nil {
+        t.Fatalf("Error decoding: %s", err)
+    }
+
+    check_tlvs(t, tlvs, test_tlvs, false)
+    check_truncated(t, test_tlv7, packet.DecodeTLV7)
+
+    var b packet.Buffer
+    b.Init(make([]byte, len(test_tlv7)))
+
+    err = packet.EncodeTLV7(&b, test_tlvs)
+    if err != nil {
+        t.Fatalf("Error encoding: %s", err)
+    }
+
+    if !bytes.Equal(test_tlv7, b.Buffer()) {
+        t.Fatalf("Raw TLV mismatch: %x", b.Buffer())
+    }
+
+    err = packet.EncodeTLV7(&b, []packet.TLV{ { Type: 128 } })
+    if err == nil {
+        t.Fatalf("Invalid type not detected")
+    }
+}
+
+func TestTLVUnits(t *testing.T) {
+    decode := func(data []byte) ([]packet.TLV, error) {
+        return packet.DecodeTLVUnits(data, 4)
+    }
+
+    tlvs, err := decode(test_tlv_units)
+    if err != nil {
+        t.Fatalf("Error decoding: %s", err)
+    }
+
+    check_tlvs(t, tlvs, test_tlvs, true)
+    check_truncated(t, test_tlv_units, decode)
+
+    /* zero length */
+    _, err = decode([]byte{ 0x01, 0x00, 0x00, 0x00 })
+    if err == nil {
+        t.Fatalf("Zero length not detected")
+    }
+
+    var b packet.Buffer
+    b.Init(make([]byte, len(test_tlv_units)))
+
+    err = packet.EncodeTLVUnits(&b, test_tlvs, 4)
+    if err != nil {
+        t.Fatalf("Error encoding: %s", err)
+    }
+
+    if !bytes.Equal(test_tlv_units, b.Buffer()) {
+        t.Fatalf("Raw TLV mismatch: %x", b.Buffer())
+    }
+}
@@ -0,0 +1,99 @@
+/*
+ * Network packet analysis framework.
+ *
+ * Copyright (c) 2014, Alessandro Ghedini
+ * All rights reserved.
+ *
+ * Redistribution and use in source and binary forms, with or without
+ * modification, are permitted provided that the following conditions are
+ * met:
+ *
+ *     * Redistributions of source code must retain the above copyright
+ *       notice, this list of conditions and the following disclaimer.
+ *
+ *     * Redistributions in binary form must reproduce the above copyright
+ *       notice, this list of conditions and the following disclaimer in the
+ *       documentation and/or other materials provided with the distribution.
+ *
+ * THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS
+ * IS" AND ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO,
+ * THE IMPLIED WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR
+ * PURPOSE ARE DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT HOLDER OR
+ * CONTRIBUTORS BE LIABLE FOR ANY DIRECT, INDIRECT, INCIDENTAL, SPECIAL,
+ * EXEMPLARY, OR CONSEQUENTIAL DAMAGES (INCLUDING, BUT NOT LIMITED TO,
+ * PROCUREMENT OF SUBSTITUTE GOODS OR SERVICES; LOSS OF USE, DATA, OR
+ * PROFITS; OR BUSINESS INTERRUPTION) HOWEVER CAUSED AND ON ANY THEORY OF
+ * LIABILITY, WHETHER IN CONTRACT, STRICT LIABILITY, OR TORT (INCLUDING
+ * NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE OF THIS
+ * SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+ */
+
+package packet
+
+import "fmt"
+import "strings"
+
+// Return a human readable tree of the chain starting at head, similar to the
+// packet details view of Wireshark. Each layer is shown on its own line with a
+// summary of its addresses (or ports) and flags, followed by its fields (as
+// shown by Stringify()) and then by its payload, indented one level more.
+//
+//     Ethernet (00:11:22:33:44:55 -> 66:77:88:99:aa:bb)
+//       dst: 66:77:88:99:aa:bb
+//       ...
+//       IPv4 (10.0.0.1 -> 10.0.0.2)
+//         ...
+//         TCP (443 -> 51000 [syn|ack])
+//           ...
+func Tree(head Packet) string {
+    var lines []string
+
+    indent := ""
+
+    for p := head; p != nil; p = p.Payload() {
+        lines = append(lines, indent + summary(p))
+
+        indent += "  "
+
+        each_field(p, func(key, val string) {
+            lines = append(lines, fmt.Sprintf("%s%s: %s", indent, key, val))
+        })
+    }
+
+    return strings.Join(lines, "\n")
+}
+
+/* Return the name of the layer, followed by its own summary (see Summarizer),
+ * its source and destination addresses or ports and its flags, when it has
+ * them */
+func summary(p Packet) string {
+    fields := map[string]string{}
+
+    each_field(p, func(key, val string) {
+        fields[key] = val
+    })
+
+    var info []string
+
+    if sp, ok := p.(Summarizer); ok && sp.Summary() != "" {
+        info = append(info, sp.Summary())
+    }
+
+    switch {
+    case fields["src"] != "" && fields["dst"] != "":
+        info = append(info, fields["src"] + " -> " + fields["dst"])
+
+    case fields["sport"] != "" && fields["dport"] != "":
+        info = append(info, fields["sport"] + " -> " + fields["dport"])
+    }
+
+    if fields["flags"] != "" {
+        info = append(info, "[" + fields["flags"] + "]")
+    }
+
+    if len(info) == 0 {
+        return p.GetType().String()
+    }
+
+    return fmt.Sprintf("%s (%s)", p.GetType().String(), strings.Join(info, " "))
+}
@@ -0,0 +1,90 @@
+/*
+ * Network packet analysis framework.
+ *
+ * Copyright (c) 2014, Alessandro Ghedini
+ * All rights reserved.
+ *
+ * Redistribution and use in source and binary forms, with or without
+ * modification, are permitted provided that the following conditions are
+ * met:
+ *
+ *     * Redistributions of source code must retain the above copyright
+ *       notice, this list of conditions and the following disclaimer.
+ *
+ *     * Redistributions in binary form must reproduce the above copyright
+ *       notice, this list of conditions and the following disclaimer in the
+ *       documentation and/or other materials provided with the distribution.
+ *
+ * THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS
+ * IS" AND ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO,
+ * THE IMPLIED WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR
+ * PURPOSE ARE DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT HOLDER OR
+ * CONTRIBUTORS BE LIABLE FOR ANY DIRECT, INDIRECT, INCIDENTAL, SPECIAL,
+ * EXEMPLARY, OR CONSEQUENTIAL DAMAGES (INCLUDING, BUT NOT LIMITED TO,
+ * PROCUREMENT OF SUBSTITUTE GOODS OR SERVICES; LOSS OF USE, DATA, OR
+ * PROFITS; OR BUSINESS INTERRUPTION) HOWEVER CAUSED AND ON ANY THEORY OF
+ * LIABILITY, WHETHER IN CONTRACT, STRICT LIABILITY, OR TORT (INCLUDING
+ * NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE OF THIS
+ * SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+ */
+
+package packet_test
+
+import "net"
+import "testing"
+
+import "github.com/adigal150/go.pkt/layers"
+import "github.com/adigal150/go.pkt/packet"
+import "github.com/adigal150/go.pkt/packet/eth"
+import "github.com/adigal150/go.pkt/packet/ipv4"
+import "github.com/adigal150/go.pkt/packet/tcp"
+
+var test_tree = `Ethernet (00:11:22:33:44:55 -> 66:77:88:99:aa:bb)
+  dst: 66:77:88:99:aa:bb
+  src: 00:11:22:33:44:55
+  type: IPv4
+  length: 14
+  IPv4 (10.0.0.1 -> 10.0.0.2)
+    version: 4
+    ihl: 5
+    length: 40
+    id: 1
+    ttl: 64
+    proto: TCP
+    src: 10.0.0.1
+    dst: 10.0.0.2
+    TCP (443 -> 51000 [syn|ack])
+      sport: 443
+      dport: 51000
+      seq: 1000
+      ack: 2000
+      off: 5
+      flags: syn|ack
+      win: 5840`
+
+func TestTree(t *testing.T) {
+    eth_pkt := eth.Make()
+    eth_pkt.SrcAddr, _ = net.ParseMAC("00:11:22:33:44:55")
+    eth_pkt.DstAddr, _ = net.ParseMAC("66:77:88:99:aa:bb")
+
+    ip4_pkt := ipv4.Make()
+    ip4_pkt.SrcAddr = net.ParseIP("10.0.0.1")
+    ip4_pkt.DstAddr = net.ParseIP("10.0.0.2")
+
+    tcp_pkt := tcp.Make()
+    tcp_pkt.SrcPort = 443
+    tcp_pkt.DstPort = 51000
+    tcp_pkt.Seq     = 1000
+    tcp_pkt.Ack     = 2000
+    tcp_pkt.Flags   = tcp.Syn | tcp.Ack
+
+    pkt, err := layers.Compose(eth_pkt, ip4_pkt, tcp_pkt)
+    if err != nil {
+        t.Fatalf("Error composing: %s", err)
+    }
+
+    tree := packet.Tree(pkt)
+    if tree != test_tree {
+        t.Fatalf("Tree mismatch:\n%s", tree)
+    }
+}
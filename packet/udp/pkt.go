@@ -32,15 +32,24 @@
 package udp
 
 import "github.com/adigal150/go.pkt/packet"
-import "github.com/adigal150/go.pkt/packet/ipv4"
 
 type Packet struct {
-    SrcPort     uint16        `string:"sport"`
-    DstPort     uint16        `string:"dport"`
-    Length      uint16        `string:"len"`
-    Checksum    uint16        `string:"sum"`
-    csum_seed   uint32        `cmp:"skip" string:"skip"`
-    pkt_payload packet.Packet `cmp:"skip" string:"skip"`
+    SrcPort      uint16               `string:"sport"`
+    DstPort      uint16               `string:"dport"`
+    Length       uint16               `string:"len"`
+    Checksum     uint16               `string:"sum"`
+
+    // Encode the Length and Checksum fields as-is, instead of computing them
+    // from the packet, e.g. to craft malformed packets. KeepLength is set by
+    // Unpack() when Length doesn't match the decoded data (e.g. because of
+    // Ethernet padding), so that it is packed unchanged.
+    KeepLength   bool                 `cmp:"skip" string:"skip"`
+    KeepChecksum bool                 `cmp:"skip" string:"skip"`
+
+    csum_seed    uint32               `cmp:"skip" string:"skip"`
+    pkt_payload  packet.Packet        `cmp:"skip" string:"skip"`
+    pkt_decode   func() packet.Packet `cmp:"skip" string:"skip"`
+    pkt_raw      []byte               `cmp:"skip" string:"skip"`
 }
 
 func Make() *Packet {
@@ -54,8 +63,8 @@ func (p *Packet) GetType() packet.Type {
 }
 
 func (p *Packet) GetLength() uint16 {
-    if p.pkt_payload != nil {
-        return p.pkt_payload.GetLength() + 8
+    if p.Payload() != nil {
+        return p.Payload().GetLength() + 8
     }
 
     return 8
@@ -79,48 +88,137 @@ func (p *Packet) Answers(other packet.Packet) bool {
 }
 
 func (p *Packet) Pack(buf *packet.Buffer) error {
+    if !p.KeepLength {
+        p.Length = p.GetLength()
+    }
+
     buf.WriteN(p.SrcPort)
     buf.WriteN(p.DstPort)
     buf.WriteN(p.Length)
 
-    if p.csum_seed != 0 {
-        p.Checksum =
-          ipv4.CalculateChecksum(buf.LayerBytes(), p.csum_seed)
+    if p.csum_seed != 0 && !p.KeepChecksum {
+        data := buf.LayerBytes()
+
+        /* padding following the datagram is not checksummed */
+        if p.KeepLength && int(p.Length) >= 8 && int(p.Length) < len(data) {
+            data = data[:p.Length]
+        }
+
+        p.Checksum = packet.Checksum(data, p.csum_seed)
     }
 
     buf.WriteN(p.Checksum)
 
-    return nil
+    return buf.Err()
 }
 
 func (p *Packet) Unpack(buf *packet.Buffer) error {
+    p.pkt_raw = buf.Bytes()
+
     buf.ReadN(&p.SrcPort)
     buf.ReadN(&p.DstPort)
     buf.ReadN(&p.Length)
     buf.ReadN(&p.Checksum)
 
-    return nil
+    p.KeepLength = int(p.Length) != len(p.pkt_raw)
+
+    return buf.Err()
+}
+
+// Return the length of the payload declared by the header, which may be less
+// than the length of the decoded data (e.g. because of Ethernet padding).
+func (p *Packet) PayloadLength() uint32 {
+    if p.Length < 8 {
+        return 0
+    }
+
+    return uint32(p.Length) - 8
 }
 
 func (p *Packet) Payload() packet.Packet {
+    if p.pkt_decode != nil {
+        p.pkt_payload = p.pkt_decode()
+        p.pkt_decode  = nil
+    }
+
     return p.pkt_payload
 }
 
+func (p *Packet) RawBytes() []byte {
+    return p.pkt_raw
+}
+
+func (p *Packet) HeaderBytes() []byte {
+    return packet.HeaderBytes(p)
+}
+
 func (p *Packet) GuessPayloadType() packet.Type {
-    return packet.Raw
+    return PortToType(p.SrcPort, p.DstPort)
 }
 
 func (p *Packet) SetPayload(pl packet.Packet) error {
     p.pkt_payload = pl
-    p.Length      = p.GetLength()
+    p.pkt_decode  = nil
+
+    if !p.KeepLength {
+        p.Length = p.GetLength()
+    }
 
     return nil
 }
 
+func (p *Packet) SetPayloadDecoder(decode func() packet.Packet) {
+    p.pkt_payload = nil
+    p.pkt_decode  = decode
+}
+
 func (p *Packet) InitChecksum(csum uint32) {
     p.csum_seed = csum
 }
 
+func (p *Packet) Clone() packet.Packet {
+    c := *p
+
+    c.pkt_payload = packet.ClonePayload(p.Payload())
+    c.pkt_decode  = nil
+
+    return &c
+}
+
 func (p *Packet) String() string {
     return packet.Stringify(p)
 }
+
+var port_to_type_map = map[uint16]packet.Type{}
+
+// Register a packet type for the given UDP port, so that application layers can
+// be decoded without changes to the UDP code. This is meant to be called during
+// initialization (e.g. from an init() function) and must not be called
+// concurrently with packet decoding.
+func RegisterPort(port uint16, pkttype packet.Type) {
+    port_to_type_map[port] = pkttype
+}
+
+// Remove the packet type registered for the given UDP port (e.g. at the end of
+// a test). The same restrictions as for RegisterPort() apply.
+func UnregisterPort(port uint16) {
+    delete(port_to_type_map, port)
+}
+
+// Create a new Type from the given source and destination UDP ports. The lower
+// (usually well-known) port is looked up first.
+func PortToType(src_port, dst_port uint16) packet.Type {
+    if dst_port < src_port {
+        src_port, dst_port = dst_port, src_port
+    }
+
+    if t, ok := port_to_type_map[src_port]; ok {
+        return t
+    }
+
+    if t, ok := port_to_type_map[dst_port]; ok {
+        return t
+    }
+
+    return packet.Raw
+}
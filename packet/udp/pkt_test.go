@@ -31,11 +31,13 @@
 package udp_test
 
 import "bytes"
+import "errors"
 import "net"
 import "testing"
 
 import "github.com/adigal150/go.pkt/packet"
 import "github.com/adigal150/go.pkt/packet/ipv4"
+import "github.com/adigal150/go.pkt/packet/raw"
 import "github.com/adigal150/go.pkt/packet/udp"
 
 var test_simple = []byte{
@@ -47,6 +49,7 @@ func MakeTestSimple() *udp.Packet {
         SrcPort: 52134,
         DstPort: 80,
         Length: 18,
+        KeepLength: true,
     }
 }
 
@@ -105,6 +108,18 @@ func BenchmarkUnpack(bn *testing.B) {
     }
 }
 
+func TestUnpackTruncated(t *testing.T) {
+    var p udp.Packet
+
+    var b packet.Buffer
+    b.Init(test_simple[:6])
+
+    err := p.Unpack(&b)
+    if !errors.Is(err, packet.ErrTruncated) {
+        t.Fatalf("Truncated packet not detected: %v", err)
+    }
+}
+
 var test_with_ipv4 = []byte{
     0xcb, 0xa6, 0x00, 0x50, 0x00, 0x12, 0x61, 0x9e,
 }
@@ -124,6 +139,7 @@ func TestPackWithIPv4(t *testing.T) {
         SrcPort: 52134,
         DstPort: 80,
         Length: 18,
+        KeepLength: true,
     }
 
     ip4.SetPayload(udp)
@@ -156,3 +172,119 @@ func TestUnpackWithIPv4(t *testing.T) {
         t.Fatalf("Packet mismatch:\n%s\n%s", &p, cmp)
     }
 }
+
+func TestRegisterPort(t *testing.T) {
+    p := MakeTestSimple()
+
+    if p.GuessPayloadType() != packet.Raw {
+        t.Fatalf("Payload type mismatch: %s", p.GuessPayloadType())
+    }
+
+    udp.RegisterPort(80, packet.IPv4)
+    defer udp.UnregisterPort(80)
+
+    if p.GuessPayloadType() != packet.IPv4 {
+        t.Fatalf("Payload type mismatch: %s", p.GuessPayloadType())
+    }
+
+    p.SrcPort, p.DstPort = p.DstPort, p.SrcPort
+
+    if p.GuessPayloadType() != packet.IPv4 {
+        t.Fatalf("Payload type mismatch: %s", p.GuessPayloadType())
+    }
+}
+
+func TestPackLength(t *testing.T) {
+    ip4 := ipv4.Make()
+    ip4.SrcAddr = net.ParseIP(ipsrc_str)
+    ip4.DstAddr = net.ParseIP(ipdst_str)
+
+    udp := udp.Make()
+    udp.SrcPort = 52134
+    udp.DstPort = 80
+
+    ip4.SetPayload(udp)
+
+    data := raw.Make()
+    data.Data = []byte("0123456789")
+
+    /* the IPv4 length is stale, since the payload was set after the UDP
+     * packet was added to the IPv4 one, and the UDP one is hand-edited */
+    udp.SetPayload(data)
+    udp.Length = 0
+
+    var b packet.Buffer
+    b.Init(make([]byte, ip4.GetLength()))
+
+    for _, p := range []packet.Packet{ ip4, udp, data } {
+        err := p.Pack(&b)
+        if err != nil {
+            t.Fatalf("Error packing: %s", err)
+        }
+    }
+
+    buf := b.Buffer()
+
+    if ip4.Length != uint16(len(buf)) || buf[2] != 0x00 || buf[3] != 38 {
+        t.Fatalf("IPv4 length mismatch: %d %x", ip4.Length, buf[2:4])
+    }
+
+    if udp.Length != uint16(len(buf) - 20) || buf[24] != 0x00 || buf[25] != 18 {
+        t.Fatalf("UDP length mismatch: %d %x", udp.Length, buf[24:26])
+    }
+
+    udp.KeepLength = true
+    udp.Length     = 4000
+
+    b.Init(make([]byte, 8))
+
+    err := udp.Pack(&b)
+    if err != nil {
+        t.Fatalf("Error packing: %s", err)
+    }
+
+    if !bytes.Equal(b.Buffer()[4:6], []byte{ 0x0f, 0xa0 }) {
+        t.Fatalf("UDP length overridden: %x", b.Buffer()[4:6])
+    }
+}
+
+func TestPackKeepLengthSetPayload(t *testing.T) {
+    ip4 := ipv4.Make()
+    ip4.SrcAddr    = net.ParseIP(ipsrc_str)
+    ip4.DstAddr    = net.ParseIP(ipdst_str)
+    ip4.Length     = 1500
+    ip4.KeepLength = true
+
+    udp := udp.Make()
+    udp.SrcPort    = 52134
+    udp.DstPort    = 80
+    udp.Length     = 4000
+    udp.KeepLength = true
+
+    data := raw.Make()
+    data.Data = []byte("0123456789")
+
+    /* attaching the payloads must not overwrite the kept lengths */
+    ip4.SetPayload(udp)
+    udp.SetPayload(data)
+
+    var b packet.Buffer
+    b.Init(make([]byte, ip4.GetLength()))
+
+    for _, p := range []packet.Packet{ ip4, udp, data } {
+        err := p.Pack(&b)
+        if err != nil {
+            t.Fatalf("Error packing: %s", err)
+        }
+    }
+
+    buf := b.Buffer()
+
+    if !bytes.Equal(buf[2:4], []byte{ 0x05, 0xdc }) {
+        t.Fatalf("IPv4 length overridden: %x", buf[2:4])
+    }
+
+    if !bytes.Equal(buf[24:26], []byte{ 0x0f, 0xa0 }) {
+        t.Fatalf("UDP length overridden: %x", buf[24:26])
+    }
+}
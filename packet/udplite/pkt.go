@@ -0,0 +1,200 @@
+/*
+ * Network packet analysis framework.
+ *
+ * Copyright (c) 2014, Alessandro Ghedini
+ * All rights reserved.
+ *
+ * Redistribution and use in source and binary forms, with or without
+ * modification, are permitted provided that the following conditions are
+ * met:
+ *
+ *     * Redistributions of source code must retain the above copyright
+ *       notice, this list of conditions and the following disclaimer.
+ *
+ *     * Redistributions in binary form must reproduce the above copyright
+ *       notice, this list of conditions and the following disclaimer in the
+ *       documentation and/or other materials provided with the distribution.
+ *
+ * THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS
+ * IS" AND ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO,
+ * THE IMPLIED WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR
+ * PURPOSE ARE DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT HOLDER OR
+ * CONTRIBUTORS BE LIABLE FOR ANY DIRECT, INDIRECT, INCIDENTAL, SPECIAL,
+ * EXEMPLARY, OR CONSEQUENTIAL DAMAGES (INCLUDING, BUT NOT LIMITED TO,
+ * PROCUREMENT OF SUBSTITUTE GOODS OR SERVICES; LOSS OF USE, DATA, OR
+ * PROFITS; OR BUSINESS INTERRUPTION) HOWEVER CAUSED AND ON ANY THEORY OF
+ * LIABILITY, WHETHER IN CONTRACT, STRICT LIABILITY, OR TORT (INCLUDING
+ * NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE OF THIS
+ * SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+ */
+
+// Provides encoding and decoding for UDP-Lite (RFC 3828) packets.
+//
+// The header replaces the UDP length with the checksum coverage, i.e. the
+// number of bytes, starting from the header, covered by the checksum. The
+// payload is decoded according to the registered UDP ports (see
+// udp.RegisterPort()).
+package udplite
+
+import "github.com/adigal150/go.pkt/packet"
+import "github.com/adigal150/go.pkt/packet/udp"
+
+type Packet struct {
+    SrcPort      uint16               `string:"sport"`
+    DstPort      uint16               `string:"dport"`
+    Coverage     uint16               `string:"cov"`
+    Checksum     uint16               `string:"sum"`
+
+    // Encode the Checksum field as-is, instead of computing it from the
+    // packet, e.g. to craft malformed packets.
+    KeepChecksum bool                 `cmp:"skip" string:"skip"`
+
+    csum_seed    uint32               `cmp:"skip" string:"skip"`
+    pkt_payload  packet.Packet        `cmp:"skip" string:"skip"`
+    pkt_decode   func() packet.Packet `cmp:"skip" string:"skip"`
+    pkt_raw      []byte               `cmp:"skip" string:"skip"`
+}
+
+func Make() *Packet {
+    return &Packet{}
+}
+
+func (p *Packet) GetType() packet.Type {
+    return packet.UDPLite
+}
+
+func (p *Packet) GetLength() uint16 {
+    if p.Payload() != nil {
+        return p.Payload().GetLength() + 8
+    }
+
+    return 8
+}
+
+func (p *Packet) Equals(other packet.Packet) bool {
+    return packet.Compare(p, other)
+}
+
+func (p *Packet) Answers(other packet.Packet) bool {
+    if other == nil || other.GetType() != packet.UDPLite {
+        return false
+    }
+
+    if p.SrcPort != other.(*Packet).DstPort ||
+       p.DstPort != other.(*Packet).SrcPort {
+        return false
+    }
+
+    return true
+}
+
+func (p *Packet) Pack(buf *packet.Buffer) error {
+    buf.WriteN(p.SrcPort)
+    buf.WriteN(p.DstPort)
+    buf.WriteN(p.Coverage)
+
+    if p.csum_seed != 0 && !p.KeepChecksum {
+        data := buf.LayerBytes()[:p.GetLength()]
+
+        p.Checksum = packet.Checksum(data[:p.CoverageLength(len(data))],
+                                     p.csum_seed)
+    }
+
+    buf.WriteN(p.Checksum)
+
+    return buf.Err()
+}
+
+func (p *Packet) Unpack(buf *packet.Buffer) error {
+    p.pkt_raw = buf.Bytes()
+
+    buf.ReadN(&p.SrcPort)
+    buf.ReadN(&p.DstPort)
+    buf.ReadN(&p.Coverage)
+    buf.ReadN(&p.Checksum)
+
+    if buf.Err() != nil {
+        return buf.Err()
+    }
+
+    /* packets with an invalid coverage must be discarded */
+    if (p.Coverage > 0 && p.Coverage < 8) ||
+       int(p.Coverage) > len(p.pkt_raw) {
+        return packet.Errorf(packet.ErrInvalidLength,
+                             "Invalid checksum coverage: %d", p.Coverage)
+    }
+
+    return nil
+}
+
+func (p *Packet) Payload() packet.Packet {
+    if p.pkt_decode != nil {
+        p.pkt_payload = p.pkt_decode()
+        p.pkt_decode  = nil
+    }
+
+    return p.pkt_payload
+}
+
+func (p *Packet) RawBytes() []byte {
+    return p.pkt_raw
+}
+
+func (p *Packet) HeaderBytes() []byte {
+    return packet.HeaderBytes(p)
+}
+
+func (p *Packet) GuessPayloadType() packet.Type {
+    return udp.PortToType(p.SrcPort, p.DstPort)
+}
+
+func (p *Packet) SetPayload(pl packet.Packet) error {
+    p.pkt_payload = pl
+    p.pkt_decode  = nil
+
+    return nil
+}
+
+func (p *Packet) SetPayloadDecoder(decode func() packet.Packet) {
+    p.pkt_payload = nil
+    p.pkt_decode  = decode
+}
+
+func (p *Packet) InitChecksum(csum uint32) {
+    p.csum_seed = csum
+}
+
+func (p *Packet) Clone() packet.Packet {
+    c := *p
+
+    c.pkt_payload = packet.ClonePayload(p.Payload())
+    c.pkt_decode  = nil
+
+    return &c
+}
+
+func (p *Packet) String() string {
+    return packet.Stringify(p)
+}
+
+// Return the number of bytes covered by the checksum, for a packet of the
+// given total length. A zero Coverage field means that the whole packet is
+// covered.
+func (p *Packet) CoverageLength(length int) int {
+    if p.Coverage == 0 || int(p.Coverage) > length {
+        return length
+    }
+
+    return int(p.Coverage)
+}
+
+// Check whether the checksum of a decoded packet is correct, taking into
+// account only the covered bytes. This requires the pseudo-header sum of the
+// IP layer, which covers the length of the payload: after decoding the whole
+// chain (e.g. with layers.UnpackAll()), packet.Finalize() must be called on it
+// so that the sum is updated.
+func (p *Packet) VerifyChecksum() bool {
+    data := p.pkt_raw[:p.CoverageLength(len(p.pkt_raw))]
+
+    return packet.Checksum(data, p.csum_seed) == 0
+}
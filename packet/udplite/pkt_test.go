@@ -0,0 +1,198 @@
+/*
+ * Network packet analysis framework.
+ *
+ * Copyright (c) 2014, Alessandro Ghedini
+ * All rights reserved.
+ *
+ * Redistribution and use in source and binary forms, with or without
+ * modification, are permitted provided that the following conditions are
+ * met:
+ *
+ *     * Redistributions of source code must retain the above copyright
+ *       notice, this list of conditions and the following disclaimer.
+ *
+ *     * Redistributions in binary form must reproduce the above copyright
+ *       notice, this list of conditions and the following disclaimer in the
+ *       documentation and/or other materials provided with the distribution.
+ *
+ * THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS
+ * IS" AND ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO,
+ * THE IMPLIED WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR
+ * PURPOSE ARE DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT HOLDER OR
+ * CONTRIBUTORS BE LIABLE FOR ANY DIRECT, INDIRECT, INCIDENTAL, SPECIAL,
+ * EXEMPLARY, OR CONSEQUENTIAL DAMAGES (INCLUDING, BUT NOT LIMITED TO,
+ * PROCUREMENT OF SUBSTITUTE GOODS OR SERVICES; LOSS OF USE, DATA, OR
+ * PROFITS; OR BUSINESS INTERRUPTION) HOWEVER CAUSED AND ON ANY THEORY OF
+ * LIABILITY, WHETHER IN CONTRACT, STRICT LIABILITY, OR TORT (INCLUDING
+ * NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE OF THIS
+ * SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+ */
+
+package udplite_test
+
+import "bytes"
+import "errors"
+import "net"
+import "testing"
+
+import "github.com/adigal150/go.pkt/layers"
+import "github.com/adigal150/go.pkt/packet"
+import "github.com/adigal150/go.pkt/packet/ipv4"
+import "github.com/adigal150/go.pkt/packet/raw"
+import "github.com/adigal150/go.pkt/packet/udplite"
+
+var test_simple = []byte{
+    0xcb, 0xa6, 0x13, 0x8c, 0x00, 0x08, 0x00, 0x00,
+}
+
+func MakeTestSimple() *udplite.Packet {
+    return &udplite.Packet{
+        SrcPort: 52134,
+        DstPort: 5004,
+        Coverage: 8,
+    }
+}
+
+func TestPack(t *testing.T) {
+    var b packet.Buffer
+    b.Init(make([]byte, len(test_simple)))
+
+    p := MakeTestSimple()
+
+    err := p.Pack(&b)
+    if err != nil {
+        t.Fatalf("Error packing: %s", err)
+    }
+
+    if !bytes.Equal(test_simple, b.Buffer()) {
+        t.Fatalf("Raw packet mismatch: %x", b.Buffer())
+    }
+}
+
+func BenchmarkPack(bn *testing.B) {
+    var b packet.Buffer
+    b.Init(make([]byte, len(test_simple)))
+
+    p := MakeTestSimple()
+
+    for n := 0; n < bn.N; n++ {
+        p.Pack(&b)
+    }
+}
+
+func TestUnpack(t *testing.T) {
+    var p udplite.Packet
+
+    cmp := MakeTestSimple()
+
+    var b packet.Buffer
+    b.Init(test_simple)
+
+    err := p.Unpack(&b)
+    if err != nil {
+        t.Fatalf("Error unpacking: %s", err)
+    }
+
+    if !p.Equals(cmp) {
+        t.Fatalf("Packet mismatch:\n%s\n%s", &p, cmp)
+    }
+}
+
+func BenchmarkUnpack(bn *testing.B) {
+    var p udplite.Packet
+    var b packet.Buffer
+
+    for n := 0; n < bn.N; n++ {
+        b.Init(test_simple)
+        p.Unpack(&b)
+    }
+}
+
+func TestUnpackInvalidCoverage(t *testing.T) {
+    var p udplite.Packet
+
+    data := append([]byte(nil), test_simple...)
+    data[5] = 4
+
+    var b packet.Buffer
+    b.Init(data)
+
+    err := p.Unpack(&b)
+    if !errors.Is(err, packet.ErrInvalidLength) {
+        t.Fatalf("Invalid coverage not detected: %v", err)
+    }
+}
+
+func unpack_udplite(t *testing.T, data []byte) *udplite.Packet {
+    pkt, err := layers.UnpackAll(data, packet.IPv4)
+    if err != nil {
+        t.Fatalf("Error unpacking: %s", err)
+    }
+
+    err = packet.Finalize(pkt)
+    if err != nil {
+        t.Fatalf("Error finalizing: %s", err)
+    }
+
+    p, ok := layers.FindLayer(pkt, packet.UDPLite).(*udplite.Packet)
+    if !ok {
+        t.Fatalf("UDP-Lite layer not found: %s", pkt)
+    }
+
+    return p
+}
+
+func TestChecksumCoverage(t *testing.T) {
+    ip4 := ipv4.Make()
+    ip4.SrcAddr = net.ParseIP("192.168.1.135")
+    ip4.DstAddr = net.ParseIP("8.8.8.8")
+
+    p := MakeTestSimple()
+
+    pl := raw.Make()
+    pl.Data = []byte("payload")
+
+    data, err := layers.Pack(ip4, p, pl)
+    if err != nil {
+        t.Fatalf("Error packing: %s", err)
+    }
+
+    if ip4.Protocol != ipv4.UDPLite || p.Checksum == 0 {
+        t.Fatalf("Header mismatch: %s %s", ip4, p)
+    }
+
+    if !unpack_udplite(t, data).VerifyChecksum() {
+        t.Fatalf("Checksum mismatch: %x", data)
+    }
+
+    /* the payload is not covered by the checksum */
+    data[len(data) - 1] ^= 0xff
+
+    if !unpack_udplite(t, data).VerifyChecksum() {
+        t.Fatalf("Uncovered payload affected the checksum")
+    }
+
+    data[21] ^= 0xff
+
+    if unpack_udplite(t, data).VerifyChecksum() {
+        t.Fatalf("Corrupted header not detected")
+    }
+
+    /* a zero coverage covers the whole packet */
+    p.Coverage = 0
+
+    data, err = layers.Pack(ip4, p, pl)
+    if err != nil {
+        t.Fatalf("Error packing: %s", err)
+    }
+
+    if !unpack_udplite(t, data).VerifyChecksum() {
+        t.Fatalf("Checksum mismatch: %x", data)
+    }
+
+    data[len(data) - 1] ^= 0xff
+
+    if unpack_udplite(t, data).VerifyChecksum() {
+        t.Fatalf("Corrupted payload not detected")
+    }
+}
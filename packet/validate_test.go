@@ -0,0 +1,75 @@
+/*
+ * Network packet analysis framework.
+ *
+ * Copyright (c) 2014, Alessandro Ghedini
+ * All rights reserved.
+ *
+ * Redistribution and use in source and binary forms, with or without
+ * modification, are permitted provided that the following conditions are
+ * met:
+ *
+ *     * Redistributions of source code must retain the above copyright
+ *       notice, this list of conditions and the following disclaimer.
+ *
+ *     * Redistributions in binary form must reproduce the above copyright
+ *       notice, this list of conditions and the following disclaimer in the
+ *       documentation and/or other materials provided with the distribution.
+ *
+ * THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS
+ * IS" AND ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO,
+ * THE IMPLIED WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR
+ * PURPOSE ARE DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT HOLDER OR
+ * CONTRIBUTORS BE LIABLE FOR ANY DIRECT, INDIRECT, INCIDENTAL, SPECIAL,
+ * EXEMPLARY, OR CONSEQUENTIAL DAMAGES (INCLUDING, BUT NOT LIMITED TO,
+ * PROCUREMENT OF SUBSTITUTE GOODS OR SERVICES; LOSS OF USE, DATA, OR
+ * PROFITS; OR BUSINESS INTERRUPTION) HOWEVER CAUSED AND ON ANY THEORY OF
+ * LIABILITY, WHETHER IN CONTRACT, STRICT LIABILITY, OR TORT (INCLUDING
+ * NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE OF THIS
+ * SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+ */
+
+package packet_test
+
+import "testing"
+
+import "github.com/adigal150/go.pkt/layers"
+import "github.com/adigal150/go.pkt/packet"
+import "github.com/adigal150/go.pkt/packet/eth"
+import "github.com/adigal150/go.pkt/packet/ipv4"
+import "github.com/adigal150/go.pkt/packet/raw"
+import "github.com/adigal150/go.pkt/packet/tcp"
+
+func TestValidateStack(t *testing.T) {
+    ip4_pkt := ipv4.Make()
+    ip4_pkt.SrcAddr = []byte{ 192, 168, 1, 1 }
+    ip4_pkt.DstAddr = []byte{ 192, 168, 1, 2 }
+
+    tcp_pkt := tcp.Make()
+
+    raw_pkt := raw.Make()
+    raw_pkt.Data = []byte("data")
+
+    pkt, err := layers.Compose(eth.Make(), ip4_pkt, tcp_pkt, raw_pkt)
+    if err != nil {
+        t.Fatalf("Error composing: %s", err)
+    }
+
+    err = packet.ValidateStack(pkt)
+    if err != nil {
+        t.Fatalf("Error validating: %s", err)
+    }
+
+    tcp_pkt.DataOff = 2
+
+    err = packet.ValidateStack(pkt)
+    if err == nil || err.Error() != "TCP: Invalid data offset: 2" {
+        t.Fatalf("Invalid TCP packet not detected: %v", err)
+    }
+
+    ip4_pkt.Version = 6
+
+    err = packet.ValidateStack(pkt)
+    if err == nil || err.Error() != "IPv4: Invalid version: 6" {
+        t.Fatalf("Invalid IPv4 packet not detected: %v", err)
+    }
+}
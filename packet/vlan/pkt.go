@@ -35,15 +35,48 @@ import "github.com/adigal150/go.pkt/packet"
 import "github.com/adigal150/go.pkt/packet/eth"
 
 type Packet struct {
-    Priority     uint8         `string:"prio"`
-    DropEligible bool          `string:"drop"`
+    Priority     uint8                `string:"prio"`
+    DropEligible bool                 `string:"drop"`
     VLAN         uint16
     Type         eth.EtherType
-    pkt_payload  packet.Packet `cmp:"skip" string:"skip"`
+    pkt_payload  packet.Packet        `cmp:"skip" string:"skip"`
+    pkt_decode   func() packet.Packet `cmp:"skip" string:"skip"`
+    pkt_raw      []byte               `cmp:"skip" string:"skip"`
 }
 
-func Make() *Packet {
-    return &Packet{ }
+func Make(vid uint16) *Packet {
+    return &Packet{
+        VLAN: vid & 0x0FFF,
+    }
+}
+
+// Insert a VLAN tag with the given VLAN identifier and priority between the
+// given Ethernet packet and its payload. The EtherType of the Ethernet packet
+// is moved to the tag and replaced with the VLAN one.
+//
+// This is not provided by the eth package itself, to avoid an import cycle.
+func Tag(p *eth.Packet, vid uint16, pcp uint8) *Packet {
+    tag := Make(vid)
+    tag.SetPCP(pcp)
+
+    tag.Type        = p.Type
+    tag.pkt_payload = p.Payload()
+
+    p.SetPayload(tag)
+
+    return tag
+}
+
+// Insert an 802.1ad S-TAG and C-TAG with the given VLAN identifiers between the
+// given Ethernet packet and its payload, and return them. The EtherType of the
+// Ethernet packet is set to the 802.1ad one.
+func QinQ(p *eth.Packet, stag, ctag uint16) (*Packet, *Packet) {
+    inner := Tag(p, ctag, 0)
+    outer := Tag(p, stag, 0)
+
+    p.Type = eth.QinQ
+
+    return outer, inner
 }
 
 func (p *Packet) GetType() packet.Type {
@@ -51,8 +84,8 @@ func (p *Packet) GetType() packet.Type {
 }
 
 func (p *Packet) GetLength() uint16 {
-    if p.pkt_payload != nil {
-        return p.pkt_payload.GetLength() + 4
+    if p.Payload() != nil {
+        return p.Payload().GetLength() + 4
     }
 
     return 4
@@ -63,12 +96,12 @@ func (p *Packet) Equals(other packet.Packet) bool {
 }
 
 func (p *Packet) Answers(other packet.Packet) bool {
-    if other == nil {
+    if other == nil || other.GetType() != packet.VLAN {
         return false
     }
 
-    if  other.GetType() == packet.VLAN &&
-        p.VLAN != other.(*Packet).VLAN {
+    /* the inner protocols only match within the same VLAN */
+    if p.VLAN != other.(*Packet).VLAN || p.Type != other.(*Packet).Type {
         return false
     }
 
@@ -82,46 +115,96 @@ func (p *Packet) Answers(other packet.Packet) bool {
 func (p *Packet) Pack(buf *packet.Buffer) error {
     tci := uint16(p.Priority) << 13 | p.VLAN
     if p.DropEligible {
-        tci |= 0x10
+        tci |= 0x1000
     }
 
     buf.WriteN(tci)
     buf.WriteN(p.Type)
 
-    return nil
+    return buf.Err()
 }
 
 func (p *Packet) Unpack(buf *packet.Buffer) error {
+    p.pkt_raw = buf.Bytes()
+
     var tci uint16
     buf.ReadN(&tci)
 
     p.Priority     = (uint8(tci >> 8) & 0xE0) >> 5
-    p.DropEligible = uint8(tci) & 0x10 != 0
+    p.DropEligible = tci & 0x1000 != 0
     p.VLAN         = tci & 0x0FFF
 
     buf.ReadN(&p.Type)
 
-    return nil
+    return buf.Err()
 }
 
 func (p *Packet) Payload() packet.Packet {
+    if p.pkt_decode != nil {
+        p.pkt_payload = p.pkt_decode()
+        p.pkt_decode  = nil
+    }
+
     return p.pkt_payload
 }
 
+func (p *Packet) RawBytes() []byte {
+    return p.pkt_raw
+}
+
+func (p *Packet) HeaderBytes() []byte {
+    return packet.HeaderBytes(p)
+}
+
 func (p *Packet) GuessPayloadType() packet.Type {
     return eth.EtherTypeToType(p.Type)
 }
 
 func (p *Packet) SetPayload(pl packet.Packet) error {
     p.pkt_payload = pl
+    p.pkt_decode  = nil
     p.Type        = eth.TypeToEtherType(pl.GetType())
 
     return nil
 }
 
+func (p *Packet) SetPayloadDecoder(decode func() packet.Packet) {
+    p.pkt_payload = nil
+    p.pkt_decode  = decode
+}
+
+// Return the Priority Code Point (i.e. the 802.1p priority) of the tag.
+func (p *Packet) PCP() uint8 {
+    return p.Priority
+}
+
+// Set the Priority Code Point of the tag. Only the lower 3 bits are used.
+func (p *Packet) SetPCP(pcp uint8) {
+    p.Priority = pcp & 0x07
+}
+
+// Return the Drop Eligible Indicator of the tag.
+func (p *Packet) DEI() bool {
+    return p.DropEligible
+}
+
+// Set the Drop Eligible Indicator of the tag.
+func (p *Packet) SetDEI(dei bool) {
+    p.DropEligible = dei
+}
+
 func (p *Packet) InitChecksum(csum uint32) {
 }
 
+func (p *Packet) Clone() packet.Packet {
+    c := *p
+
+    c.pkt_payload = packet.ClonePayload(p.Payload())
+    c.pkt_decode  = nil
+
+    return &c
+}
+
 func (p *Packet) String() string {
     return packet.Stringify(p)
 }
@@ -103,3 +103,25 @@ func BenchmarkUnpack(bn *testing.B) {
         p.Unpack(&b)
     }
 }
+
+func TestMake(t *testing.T) {
+    p := vlan.Make(0x1123)
+    p.SetPCP(0x0d)
+    p.SetDEI(true)
+
+    if p.VLAN != 0x0123 || p.PCP() != 5 || !p.DEI() {
+        t.Fatalf("Packet mismatch: %s", p)
+    }
+
+    var b packet.Buffer
+    b.Init(make([]byte, 4))
+
+    err := p.Pack(&b)
+    if err != nil {
+        t.Fatalf("Error packing: %s", err)
+    }
+
+    if !bytes.Equal([]byte{ 0xb1, 0x23, 0x00, 0x00 }, b.Buffer()) {
+        t.Fatalf("Raw packet mismatch: %x", b.Buffer())
+    }
+}
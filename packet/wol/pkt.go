@@ -0,0 +1,179 @@
+/*
+ * Network packet analysis framework.
+ *
+ * Copyright (c) 2014, Alessandro Ghedini
+ * All rights reserved.
+ *
+ * Redistribution and use in source and binary forms, with or without
+ * modification, are permitted provided that the following conditions are
+ * met:
+ *
+ *     * Redistributions of source code must retain the above copyright
+ *       notice, this list of conditions and the following disclaimer.
+ *
+ *     * Redistributions in binary form must reproduce the above copyright
+ *       notice, this list of conditions and the following disclaimer in the
+ *       documentation and/or other materials provided with the distribution.
+ *
+ * THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS
+ * IS" AND ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO,
+ * THE IMPLIED WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR
+ * PURPOSE ARE DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT HOLDER OR
+ * CONTRIBUTORS BE LIABLE FOR ANY DIRECT, INDIRECT, INCIDENTAL, SPECIAL,
+ * EXEMPLARY, OR CONSEQUENTIAL DAMAGES (INCLUDING, BUT NOT LIMITED TO,
+ * PROCUREMENT OF SUBSTITUTE GOODS OR SERVICES; LOSS OF USE, DATA, OR
+ * PROFITS; OR BUSINESS INTERRUPTION) HOWEVER CAUSED AND ON ANY THEORY OF
+ * LIABILITY, WHETHER IN CONTRACT, STRICT LIABILITY, OR TORT (INCLUDING
+ * NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE OF THIS
+ * SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+ */
+
+// Provides encoding and decoding for Wake-on-LAN magic packets, sent either
+// directly over Ethernet or over UDP (port 9).
+//
+// A magic packet is made of 6 bytes with all bits set followed by 16
+// repetitions of the MAC address of the target, and optionally by a SecureOn
+// password (4 or 6 bytes long) that the target checks before waking up.
+package wol
+
+import "bytes"
+import "crypto/subtle"
+import "fmt"
+import "net"
+
+import "github.com/adigal150/go.pkt/packet"
+import "github.com/adigal150/go.pkt/packet/udp"
+
+type Packet struct {
+    Target   net.HardwareAddr `string:"target"`
+    Password []byte           `cmp:"skip" string:"skip"`
+    pkt_raw  []byte           `cmp:"skip" string:"skip"`
+}
+
+var sync_stream = []byte{ 0xff, 0xff, 0xff, 0xff, 0xff, 0xff }
+
+func init() {
+    udp.RegisterPort(9, packet.WoL)
+}
+
+func Make() *Packet {
+    return &Packet{ }
+}
+
+// Create a magic packet waking up the given target, protected by the given
+// SecureOn password.
+func MakeSecureOn(target net.HardwareAddr, password []byte) *Packet {
+    return &Packet{
+        Target:   target,
+        Password: password,
+    }
+}
+
+func (p *Packet) GetType() packet.Type {
+    return packet.WoL
+}
+
+func (p *Packet) GetLength() uint16 {
+    return 6 + 16 * 6 + uint16(len(p.Password))
+}
+
+func (p *Packet) Equals(other packet.Packet) bool {
+    return packet.Compare(p, other)
+}
+
+func (p *Packet) Answers(other packet.Packet) bool {
+    return false
+}
+
+func (p *Packet) Pack(buf *packet.Buffer) error {
+    if len(p.Target) != 6 {
+        return fmt.Errorf("Invalid target address: %s", p.Target)
+    }
+
+    if len(p.Password) != 0 && len(p.Password) != 4 &&
+       len(p.Password) != 6 {
+        return fmt.Errorf("Invalid password length: %d", len(p.Password))
+    }
+
+    buf.Write(sync_stream)
+
+    for i := 0; i < 16; i++ {
+        buf.Write(p.Target)
+    }
+
+    buf.Write(p.Password)
+
+    return buf.Err()
+}
+
+func (p *Packet) Unpack(buf *packet.Buffer) error {
+    p.pkt_raw = buf.Bytes()
+
+    if buf.Len() < 6 + 16 * 6 {
+        return packet.Errorf(packet.ErrTruncated, "Invalid magic packet")
+    }
+
+    if !bytes.Equal(buf.Next(6), sync_stream) {
+        return fmt.Errorf("Invalid magic packet synchronization stream")
+    }
+
+    p.Target = net.HardwareAddr(buf.Next(6))
+
+    for i := 1; i < 16; i++ {
+        if !bytes.Equal(buf.Next(6), p.Target) {
+            return fmt.Errorf("Invalid magic packet target repetition")
+        }
+    }
+
+    /* any other trailer (e.g. Ethernet padding) is not a password */
+    p.Password = nil
+
+    if buf.Len() == 4 || buf.Len() == 6 {
+        p.Password = buf.Next(buf.Len())
+    }
+
+    return buf.Err()
+}
+
+func (p *Packet) Payload() packet.Packet {
+    return nil
+}
+
+func (p *Packet) RawBytes() []byte {
+    return p.pkt_raw
+}
+
+func (p *Packet) HeaderBytes() []byte {
+    return packet.HeaderBytes(p)
+}
+
+func (p *Packet) GuessPayloadType() packet.Type {
+    return packet.None
+}
+
+func (p *Packet) SetPayload(pl packet.Packet) error {
+    return nil
+}
+
+func (p *Packet) InitChecksum(csum uint32) {
+}
+
+func (p *Packet) Clone() packet.Packet {
+    c := *p
+
+    c.Target   = packet.CloneBytes(p.Target)
+    c.Password = packet.CloneBytes(p.Password)
+
+    return &c
+}
+
+func (p *Packet) String() string {
+    return packet.Stringify(p)
+}
+
+// Check whether the SecureOn password of the magic packet matches the expected
+// one. A packet without a password only matches an empty one. The comparison
+// takes a constant time, so that it doesn't leak the expected password.
+func (p *Packet) CheckPassword(expected []byte) bool {
+    return subtle.ConstantTimeCompare(p.Password, expected) == 1
+}
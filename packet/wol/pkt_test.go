@@ -0,0 +1,176 @@
+/*
+ * Network packet analysis framework.
+ *
+ * Copyright (c) 2014, Alessandro Ghedini
+ * All rights reserved.
+ *
+ * Redistribution and use in source and binary forms, with or without
+ * modification, are permitted provided that the following conditions are
+ * met:
+ *
+ *     * Redistributions of source code must retain the above copyright
+ *       notice, this list of conditions and the following disclaimer.
+ *
+ *     * Redistributions in binary form must reproduce the above copyright
+ *       notice, this list of conditions and the following disclaimer in the
+ *       documentation and/or other materials provided with the distribution.
+ *
+ * THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS
+ * IS" AND ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO,
+ * THE IMPLIED WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR
+ * PURPOSE ARE DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT HOLDER OR
+ * CONTRIBUTORS BE LIABLE FOR ANY DIRECT, INDIRECT, INCIDENTAL, SPECIAL,
+ * EXEMPLARY, OR CONSEQUENTIAL DAMAGES (INCLUDING, BUT NOT LIMITED TO,
+ * PROCUREMENT OF SUBSTITUTE GOODS OR SERVICES; LOSS OF USE, DATA, OR
+ * PROFITS; OR BUSINESS INTERRUPTION) HOWEVER CAUSED AND ON ANY THEORY OF
+ * LIABILITY, WHETHER IN CONTRACT, STRICT LIABILITY, OR TORT (INCLUDING
+ * NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE OF THIS
+ * SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+ */
+
+package wol_test
+
+import "bytes"
+import "net"
+import "testing"
+
+import "github.com/adigal150/go.pkt/layers"
+import "github.com/adigal150/go.pkt/packet"
+import "github.com/adigal150/go.pkt/packet/ipv4"
+import "github.com/adigal150/go.pkt/packet/udp"
+import "github.com/adigal150/go.pkt/packet/wol"
+
+var target_str = "4c:72:b9:54:e5:3d"
+
+var test_password = []byte{ 0x01, 0x02, 0x03, 0x04, 0x05, 0x06 }
+
+func make_magic(password []byte) []byte {
+    data := []byte{ 0xff, 0xff, 0xff, 0xff, 0xff, 0xff }
+    target, _ := net.ParseMAC(target_str)
+
+    for i := 0; i < 16; i++ {
+        data = append(data, target...)
+    }
+
+    return append(data, password...)
+}
+
+var test_simple = make_magic(nil)
+
+func MakeTestSimple() *wol.Packet {
+    target, _ := net.ParseMAC(target_str)
+
+    return &wol.Packet{
+        Target: target,
+    }
+}
+
+func TestPack(t *testing.T) {
+    var b packet.Buffer
+    b.Init(make([]byte, len(test_simple)))
+
+    p := MakeTestSimple()
+
+    err := p.Pack(&b)
+    if err != nil {
+        t.Fatalf("Error packing: %s", err)
+    }
+
+    if !bytes.Equal(test_simple, b.Buffer()) {
+        t.Fatalf("Raw packet mismatch: %x", b.Buffer())
+    }
+}
+
+func BenchmarkPack(bn *testing.B) {
+    var b packet.Buffer
+    b.Init(make([]byte, len(test_simple)))
+
+    p := MakeTestSimple()
+
+    for n := 0; n < bn.N; n++ {
+        p.Pack(&b)
+    }
+}
+
+func TestUnpack(t *testing.T) {
+    var p wol.Packet
+
+    cmp := MakeTestSimple()
+
+    var b packet.Buffer
+    b.Init(test_simple)
+
+    err := p.Unpack(&b)
+    if err != nil {
+        t.Fatalf("Error unpacking: %s", err)
+    }
+
+    if !p.Equals(cmp) {
+        t.Fatalf("Packet mismatch:\n%s\n%s", &p, cmp)
+    }
+
+    if p.Password != nil || !p.CheckPassword(nil) ||
+       p.CheckPassword(test_password) {
+        t.Fatalf("Password mismatch: %x", p.Password)
+    }
+}
+
+func BenchmarkUnpack(bn *testing.B) {
+    var p wol.Packet
+    var b packet.Buffer
+
+    for n := 0; n < bn.N; n++ {
+        b.Init(test_simple)
+        p.Unpack(&b)
+    }
+}
+
+func TestSecureOn(t *testing.T) {
+    target, _ := net.ParseMAC(target_str)
+
+    ip4_pkt := ipv4.Make()
+    ip4_pkt.SrcAddr = net.ParseIP("192.168.1.10")
+    ip4_pkt.DstAddr = net.ParseIP("192.168.1.255")
+
+    udp_pkt := udp.Make()
+    udp_pkt.SrcPort = 41562
+    udp_pkt.DstPort = 9
+
+    buf, err := layers.Pack(ip4_pkt, udp_pkt,
+                            wol.MakeSecureOn(target, test_password))
+    if err != nil {
+        t.Fatalf("Error packing: %s", err)
+    }
+
+    if !bytes.Equal(buf[28:], make_magic(test_password)) {
+        t.Fatalf("Raw packet mismatch: %x", buf[28:])
+    }
+
+    pkt, err := layers.UnpackAll(buf, packet.IPv4)
+    if err != nil {
+        t.Fatalf("Error unpacking: %s", err)
+    }
+
+    p, ok := layers.FindLayer(pkt, packet.WoL).(*wol.Packet)
+    if !ok || p.Target.String() != target_str {
+        t.Fatalf("Packet mismatch: %s", pkt)
+    }
+
+    if !p.CheckPassword(test_password) {
+        t.Fatalf("Password mismatch: %x", p.Password)
+    }
+
+    if p.CheckPassword([]byte{ 0x01, 0x02, 0x03, 0x04, 0x05, 0x07 }) ||
+       p.CheckPassword(nil) {
+        t.Fatalf("Wrong password accepted")
+    }
+}
+
+func TestPackInvalidPassword(t *testing.T) {
+    target, _ := net.ParseMAC(target_str)
+
+    _, err := layers.Pack(wol.MakeSecureOn(target, []byte{ 0x01, 0x02 }))
+    if err == nil {
+        t.Fatalf("Invalid password packed")
+    }
+}